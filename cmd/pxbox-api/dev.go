@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"go.uber.org/zap"
+)
+
+// devMode reports whether the command line asks for dev mode, which only
+// `pxbox-api serve --dev` does; plain `serve` and no command never do
+func devMode(args []string) bool {
+	return len(args) > 2 && args[1] == "serve" && args[2] == "--dev"
+}
+
+// startDev runs the dependencies of `pxbox-api serve --dev` in process, so
+// pxbox runs from one binary without containers: an embedded Postgres
+// keeping its data under DEV_DATA_DIR (default .pxbox-dev) and an
+// in-memory Redis whose streams and jobs are lost on restart. It points
+// DATABASE_URL and REDIS_ADDR at them, applies the migrations and returns a
+// function stopping both.
+func startDev(logger *zap.Logger) (func(), error) {
+	if os.Getenv("ENV") == "production" {
+		return nil, errors.New("dev mode cannot run with ENV=production")
+	}
+
+	dir := os.Getenv("DEV_DATA_DIR")
+	if dir == "" {
+		dir = ".pxbox-dev"
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	port := uint32(54329)
+	if v := os.Getenv("DEV_PG_PORT"); v != "" {
+		p, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DEV_PG_PORT: %w", err)
+		}
+		port = uint32(p)
+	}
+
+	config := embeddedpostgres.DefaultConfig().
+		Port(port).
+		Database("pxbox").
+		DataPath(filepath.Join(dir, "data")).
+		RuntimePath(filepath.Join(dir, "runtime")).
+		CachePath(filepath.Join(dir, "cache")).
+		Logger(io.Discard)
+	pg := embeddedpostgres.NewDatabase(config)
+	logger.Info("Starting embedded Postgres", zap.String("dir", dir), zap.Uint32("port", port))
+	if err := pg.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start embedded Postgres: %w", err)
+	}
+
+	redis, err := miniredis.Run()
+	if err != nil {
+		pg.Stop()
+		return nil, fmt.Errorf("failed to start in-memory Redis: %w", err)
+	}
+	// miniredis only expires keys when told time has passed
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				redis.FastForward(time.Second)
+			case <-done:
+				return
+			}
+		}
+	}()
+	stop := func() {
+		close(done)
+		redis.Close()
+		if err := pg.Stop(); err != nil {
+			logger.Warn("Failed to stop embedded Postgres", zap.Error(err))
+		}
+	}
+
+	os.Setenv("DATABASE_URL", config.GetConnectionURL()+"?sslmode=disable")
+	os.Setenv("REDIS_ADDR", redis.Addr())
+	if err := runMigrate(nil); err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to migrate dev database: %w", err)
+	}
+
+	logger.Info("Dev mode ready",
+		zap.String("database_url", os.Getenv("DATABASE_URL")),
+		zap.String("redis_addr", redis.Addr()),
+	)
+	return stop, nil
+}
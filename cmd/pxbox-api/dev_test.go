@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDevMode(t *testing.T) {
+	assert.True(t, devMode([]string{"pxbox-api", "serve", "--dev"}))
+
+	for _, args := range [][]string{
+		nil,
+		{"pxbox-api"},
+		{"pxbox-api", "serve"},
+		{"pxbox-api", "migrate", "--dev"},
+		{"pxbox-api", "--dev"},
+		{"pxbox-api", "serve", "--devx"},
+	} {
+		assert.False(t, devMode(args), args)
+	}
+}
+
+func TestStartDevRefusesProduction(t *testing.T) {
+	t.Setenv("ENV", "production")
+	_, err := startDev(zap.NewNop())
+	assert.ErrorContains(t, err, "ENV=production")
+}
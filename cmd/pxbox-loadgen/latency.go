@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// histogram counts latencies in buckets growing by 10%, from 1µs to well
+// past a minute, so percentiles are within 10% without keeping samples
+type histogram struct {
+	buckets [200]atomic.Int64
+	max     atomic.Int64
+}
+
+const bucketGrowth = 1.1
+
+func (h *histogram) observe(d time.Duration) {
+	us := d.Microseconds()
+	if us < 1 {
+		us = 1
+	}
+	i := int(math.Log(float64(us)) / math.Log(bucketGrowth))
+	if i >= len(h.buckets) {
+		i = len(h.buckets) - 1
+	}
+	h.buckets[i].Add(1)
+	for {
+		max := h.max.Load()
+		if int64(d) <= max || h.max.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// Latency summarizes delivery latencies: from publishing an event to
+// reading it on a connection
+type Latency struct {
+	P50 string `json:"p50"`
+	P95 string `json:"p95"`
+	P99 string `json:"p99"`
+	Max string `json:"max"`
+
+	p99 time.Duration
+}
+
+func (h *histogram) summary() Latency {
+	p99 := h.percentile(0.99)
+	return Latency{
+		P50: round(h.percentile(0.50)),
+		P95: round(h.percentile(0.95)),
+		P99: round(p99),
+		Max: round(time.Duration(h.max.Load())),
+		p99: p99,
+	}
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// latency
+func (h *histogram) percentile(p float64) time.Duration {
+	var total int64
+	for i := range h.buckets {
+		total += h.buckets[i].Load()
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p * float64(total)))
+	var seen int64
+	for i := range h.buckets {
+		seen += h.buckets[i].Load()
+		if seen >= rank {
+			return time.Duration(math.Pow(bucketGrowth, float64(i+1))) * time.Microsecond
+		}
+	}
+	return time.Duration(h.max.Load())
+}
+
+func round(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(100 * time.Microsecond).String()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"pxbox/internal/events"
+)
+
+// load is the state of a run: the connections, what was published per
+// channel and what arrived
+type load struct {
+	cfg      config
+	base     time.Time // Events carry their publish time relative to base
+	padding  string
+	channels []string
+
+	mu         sync.Mutex
+	conns      []*websocket.Conn
+	subs       []int64 // Subscribed connections per channel
+	failed     int
+	firstErr   error
+	published  []int64 // Events published per channel
+	pubFailed  int64
+	readers    sync.WaitGroup
+	closing    atomic.Bool
+	received   atomic.Int64
+	disconnect atomic.Int64
+	latency    histogram
+}
+
+func newLoad(cfg config) *load {
+	lg := &load{
+		cfg:       cfg,
+		base:      time.Now(),
+		padding:   strings.Repeat("x", cfg.payload),
+		subs:      make([]int64, cfg.channels),
+		published: make([]int64, cfg.channels),
+	}
+	for i := 0; i < cfg.channels; i++ {
+		lg.channels = append(lg.channels, fmt.Sprintf("loadgen:%d", i))
+	}
+	return lg
+}
+
+// connect opens the connections and subscribes connection i to channel
+// i mod channels, cfg.dialers at a time
+func (lg *load) connect(target, token string) {
+	deadline := time.Now().Add(lg.cfg.connTimeout)
+	sem := make(chan struct{}, lg.cfg.dialers)
+	var wg sync.WaitGroup
+	for i := 0; i < lg.cfg.conns; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			channel := i % lg.cfg.channels
+			err := lg.open(target, token, fmt.Sprintf("loadgen-%d", i), channel, deadline)
+			lg.mu.Lock()
+			defer lg.mu.Unlock()
+			if err != nil {
+				lg.failed++
+				if lg.firstErr == nil {
+					lg.firstErr = err
+				}
+				return
+			}
+			lg.subs[channel]++
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (lg *load) open(target, token, entityID string, channel int, deadline time.Time) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("X-Entity-ID", entityID)
+	u.RawQuery = q.Encode()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: time.Until(deadline)}
+	c, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return err
+	}
+	lg.mu.Lock()
+	lg.conns = append(lg.conns, c)
+	lg.mu.Unlock()
+
+	subscribed := make(chan struct{})
+	lg.readers.Add(1)
+	go lg.read(c, subscribed)
+
+	if err := c.WriteJSON(map[string]interface{}{"type": "subscribe", "channel": lg.channels[channel]}); err != nil {
+		return err
+	}
+	select {
+	case <-subscribed:
+		return nil
+	case <-time.After(time.Until(deadline)):
+		return fmt.Errorf("no subscribe acknowledgement from %s", lg.channels[channel])
+	}
+}
+
+// frame holds the fields of the server's frames the load test looks at
+type frame struct {
+	Type string `json:"type"`
+	Ack  string `json:"ack"`
+	Data struct {
+		Data events.LoadgenTick `json:"data"`
+	} `json:"data"`
+}
+
+// read counts the events arriving on a connection. A text frame can hold
+// several messages, one per line.
+func (lg *load) read(c *websocket.Conn, subscribed chan struct{}) {
+	defer lg.readers.Done()
+	var once sync.Once
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			if !lg.closing.Load() {
+				lg.disconnect.Add(1)
+			}
+			return
+		}
+		now := time.Since(lg.base)
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var f frame
+			if json.Unmarshal(line, &f) != nil {
+				continue
+			}
+			switch {
+			case f.Type == "ack" && f.Ack == "subscribed":
+				once.Do(func() { close(subscribed) })
+			case f.Type == "event":
+				lg.received.Add(1)
+				lg.latency.observe(now - time.Duration(f.Data.Data.SentAt)*time.Microsecond)
+			}
+		}
+	}
+}
+
+func (lg *load) subscribed() (int, int) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	var n int64
+	for _, s := range lg.subs {
+		n += s
+	}
+	return int(n), lg.failed
+}
+
+func (lg *load) firstError() error {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	return lg.firstErr
+}
+
+// publish sends rate events per second round robin over the channels for
+// duration, topping up every 10ms to stay on schedule
+func (lg *load) publish(t target, rate int, duration time.Duration) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+	var sent int64
+	for now := range ticker.C {
+		elapsed := now.Sub(start)
+		if elapsed > duration {
+			elapsed = duration
+		}
+		due := int64(float64(rate) * elapsed.Seconds())
+		for ; sent < due; sent++ {
+			channel := int(sent % int64(len(lg.channels)))
+			err := t.Publish(lg.channels[channel], events.New(context.Background(), events.LoadgenTick{
+				SentAt: time.Since(lg.base).Microseconds(),
+				Pad:    lg.padding,
+			}))
+			if err != nil {
+				lg.pubFailed++
+				continue
+			}
+			lg.published[channel]++
+		}
+		if elapsed == duration {
+			return
+		}
+	}
+}
+
+func (lg *load) closeAll() {
+	lg.closing.Store(true)
+	lg.mu.Lock()
+	for _, c := range lg.conns {
+		c.Close()
+	}
+	lg.mu.Unlock()
+	lg.readers.Wait()
+}
+
+func (lg *load) fill(r *Report) {
+	for i, n := range lg.published {
+		r.Published += n
+		r.Expected += n * lg.subs[i]
+	}
+	r.PublishFailed = lg.pubFailed
+	r.Received = lg.received.Load()
+	if r.Expected > 0 {
+		r.Delivered = float64(r.Received) / float64(r.Expected)
+	}
+	r.Disconnects = lg.disconnect.Load()
+	r.Latency = lg.latency.summary()
+}
@@ -0,0 +1,133 @@
+// Command pxbox-loadgen measures WebSocket event delivery. It opens many
+// connections, subscribes each to one of a set of channels, publishes events
+// at a fixed rate and reports how many deliveries arrived and how late:
+//
+//	pxbox-loadgen [-url ws://localhost:8080/v1/ws] [-conns 10000] [-channels 1000] [-rate 2000] [-duration 30s]
+//
+// Without -url it runs against an in-process hub, which isolates the hub
+// from the database and the event backend. With -url it connects to a
+// running pxbox-api and publishes through the Postgres event backend, which
+// the server must use too (EVENT_BACKEND=postgres), so events reach it.
+//
+// The report is JSON on stdout. -max-p99 and -min-delivered set a
+// performance budget; the command exits with status 1 when a run misses it.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+type config struct {
+	url         string
+	token       string
+	conns       int
+	channels    int
+	rate        int
+	duration    time.Duration
+	payload     int
+	dialers     int
+	connTimeout time.Duration
+	drain       time.Duration
+	maxP99      time.Duration
+	minRatio    float64
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.url, "url", "", "WebSocket URL of a running server; empty runs an in-process hub")
+	flag.StringVar(&cfg.token, "token", "", "bearer token for -url, when the server requires one")
+	flag.IntVar(&cfg.conns, "conns", 1000, "connections to open")
+	flag.IntVar(&cfg.channels, "channels", 100, "channels to spread the connections over")
+	flag.IntVar(&cfg.rate, "rate", 1000, "events published per second, over all channels")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to publish")
+	flag.IntVar(&cfg.payload, "payload", 256, "padding bytes per event")
+	flag.IntVar(&cfg.dialers, "dialers", 50, "connections opened concurrently")
+	flag.DurationVar(&cfg.connTimeout, "connect-timeout", time.Minute, "limit for opening and subscribing all connections")
+	flag.DurationVar(&cfg.drain, "drain", 2*time.Second, "wait for late deliveries after publishing")
+	flag.DurationVar(&cfg.maxP99, "max-p99", 0, "budget: highest acceptable 99th percentile delivery latency")
+	flag.Float64Var(&cfg.minRatio, "min-delivered", 0, "budget: lowest acceptable share of expected deliveries, e.g. 0.999")
+	flag.Parse()
+
+	if cfg.conns <= 0 || cfg.channels <= 0 || cfg.rate < 0 {
+		log.Fatal("-conns and -channels must be positive, -rate not negative")
+	}
+
+	report, err := run(cfg)
+	if err != nil {
+		log.Fatalf("Load test failed: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if len(report.Violations) > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(cfg config) (*Report, error) {
+	target, err := newTarget(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer target.Close()
+
+	lg := newLoad(cfg)
+	start := time.Now()
+	lg.connect(target.URL(), cfg.token)
+	report := &Report{
+		Mode:        target.Mode(),
+		Connections: cfg.conns,
+		Channels:    cfg.channels,
+		Rate:        cfg.rate,
+		Duration:    cfg.duration.String(),
+		ConnectTime: time.Since(start).Round(time.Millisecond).String(),
+	}
+	report.Subscribed, report.ConnectFailed = lg.subscribed()
+	if report.Subscribed == 0 {
+		return nil, fmt.Errorf("no connection subscribed; first error: %v", lg.firstError())
+	}
+
+	lg.publish(target, cfg.rate, cfg.duration)
+	time.Sleep(cfg.drain)
+	report.Hub = target.Stats()
+	lg.closeAll()
+
+	lg.fill(report)
+	report.checkBudget(cfg)
+	return report, nil
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Mode          string      `json:"mode"` // "in-process" or the server URL
+	Connections   int         `json:"connections"`
+	Subscribed    int         `json:"subscribed"`
+	ConnectFailed int         `json:"connectFailed"`
+	ConnectTime   string      `json:"connectTime"`
+	Channels      int         `json:"channels"`
+	Rate          int         `json:"rate"`
+	Duration      string      `json:"duration"`
+	Published     int64       `json:"published"`
+	PublishFailed int64       `json:"publishFailed"`
+	Expected      int64       `json:"expected"` // Published events times their channel's subscribers
+	Received      int64       `json:"received"`
+	Delivered     float64     `json:"delivered"` // Received / Expected
+	Disconnects   int64       `json:"disconnects"`
+	Latency       Latency     `json:"latency"`
+	Hub           interface{} `json:"hub,omitempty"` // Hub counters of an in-process run
+	Violations    []string    `json:"violations,omitempty"`
+}
+
+func (r *Report) checkBudget(cfg config) {
+	if cfg.maxP99 > 0 && r.Latency.p99 > cfg.maxP99 {
+		r.Violations = append(r.Violations, fmt.Sprintf("p99 latency %s exceeds %s", r.Latency.P99, cfg.maxP99))
+	}
+	if cfg.minRatio > 0 && r.Delivered < cfg.minRatio {
+		r.Violations = append(r.Violations, fmt.Sprintf("delivered %.4f of expected events, below %.4f", r.Delivered, cfg.minRatio))
+	}
+}
@@ -90,7 +90,7 @@ export function EmailInbox({ onSelectRequest }) {
     if (ws && entityId) {
       ws.subscribe(`entity:${entityId}`);
       ws.on(`entity:${entityId}`, (event) => {
-        if (event.data?.event === 'request.created' || event.data?.event === 'request.answered') {
+        if (event.data?.type === 'request.created' || event.data?.type === 'request.answered') {
           const url = entityId ? `/v1/inquiries?entityId=${entityId}` : '/v1/inquiries';
           fetch(url)
             .then(res => res.json())
@@ -36,21 +36,19 @@ export function FileUpload({ requestId, filesPolicy, onFilesChange }) {
           });
 
           if (!uploadResponse.ok) {
-            throw new Error('Failed to upload file');
+            const err = await uploadResponse.json().catch(() => ({}));
+            throw new Error(err.message || 'Failed to upload file');
           }
 
-          // Calculate SHA-256 hash (simplified - in production use crypto API)
-          const arrayBuffer = await file.arrayBuffer();
-          const hashBuffer = await crypto.subtle.digest('SHA-256', arrayBuffer);
-          const hashArray = Array.from(new Uint8Array(hashBuffer));
-          const sha256 = hashArray.map(b => b.toString(16).padStart(2, '0')).join('');
+          // The server sniffs the type and hashes the content while storing it
+          const uploaded = await uploadResponse.json();
 
           return {
             name: file.name,
             url: getUrl,
-            size: file.size,
-            mimeType: file.type,
-            sha256: sha256,
+            size: uploaded.size,
+            mimeType: uploaded.mime,
+            sha256: uploaded.sha256,
           };
         })
       );
@@ -71,7 +71,7 @@ export function Inbox({ onSelectRequest }) {
     if (ws && entityId) {
       ws.subscribe(`entity:${entityId}`);
       ws.on(`entity:${entityId}`, (event) => {
-        if (event.data?.event === 'request.created' || event.data?.event === 'request.answered') {
+        if (event.data?.type === 'request.created' || event.data?.type === 'request.answered') {
           // Refresh inquiries
           const url = entityId ? `/v1/inquiries?entityId=${entityId}` : '/v1/inquiries';
           fetch(url)
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// getActivity returns the timeline of a request
+func (d Dependencies) getActivity(w http.ResponseWriter, r *http.Request) {
+	items, err := d.requestService().GetActivity(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": items,
+	})
+}
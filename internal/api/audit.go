@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/db"
+	"pxbox/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+func (d Dependencies) listAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var f db.AuditFilter
+
+	if v := q.Get("actor"); v != "" {
+		f.Actor = &v
+	}
+	if v := q.Get("action"); v != "" {
+		f.Action = &v
+	}
+	if v := q.Get("resourceType"); v != "" {
+		f.ResourceType = &v
+	}
+	if v := q.Get("resourceId"); v != "" {
+		f.ResourceID = &v
+	}
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_filter", "Invalid since: "+err.Error(), d.Log)
+			return
+		}
+		f.Since = &t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_filter", "Invalid until: "+err.Error(), d.Log)
+			return
+		}
+		f.Until = &t
+	}
+
+	limit := 100
+	offset := 0
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	entries, err := d.DB.Queries.ListAuditEntries(r.Context(), f, limit, offset)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "query_failed", err.Error(), d.Log)
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, map[string]interface{}{
+			"id":           e.ID,
+			"occurredAt":   e.OccurredAt.Format("2006-01-02T15:04:05Z07:00"),
+			"actor":        e.Actor,
+			"action":       e.Action,
+			"resourceType": e.ResourceType,
+			"resourceId":   e.ResourceID,
+			"beforeStatus": e.BeforeStatus,
+			"afterStatus":  e.AfterStatus,
+			"ip":           e.IP,
+			"meta":         e.Meta,
+			"prevHash":     e.PrevHash,
+			"hash":         e.Hash,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": result,
+		"total": len(result),
+	})
+}
+
+func (d Dependencies) verifyAudit(w http.ResponseWriter, r *http.Request) {
+	// Anchor copies in storage are checked when storage is configured
+	stor, err := storage.NewFromEnv()
+	if err != nil {
+		d.Log.Warn("Verifying audit chain without storage anchors", zap.Error(err))
+		stor = nil
+	}
+
+	result, err := audit.Verify(r.Context(), d.DB.Queries, stor, 1000)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "verify_failed", err.Error(), d.Log)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/service"
+)
+
+// CreateRequestsRequest is the body of POST /requests/batch
+type CreateRequestsRequest struct {
+	Requests []service.CreateRequestInput `json:"requests"`
+}
+
+// batchItem is the outcome of one request of a batch
+type batchItem struct {
+	Index     int            `json:"index"`
+	RequestID string         `json:"requestId,omitempty"`
+	Status    string         `json:"status,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// createRequests creates up to service.MaxBatchRequests requests in one
+// transaction. It answers 201 when all were created and 207 with the error
+// of each rejected request otherwise.
+func (d Dependencies) createRequests(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequestsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	createdBy := r.Header.Get("X-Client-ID")
+	if createdBy == "" {
+		createdBy = "anonymous"
+	}
+
+	results, err := d.requestService().CreateRequests(r.Context(), req.Requests, createdBy)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	items := make([]batchItem, len(results))
+	created := 0
+	for i, res := range results {
+		items[i].Index = i
+		if res.Err != nil {
+			e := service.Classify(res.Err)
+			items[i].Error = &ErrorResponse{
+				Error:   e.Code,
+				Code:    e.Code,
+				Message: e.Message,
+				Details: e.Details,
+			}
+			continue
+		}
+		items[i].RequestID = res.Request.ID
+		items[i].Status = string(res.Request.Status)
+		created++
+	}
+
+	status := http.StatusCreated
+	if created < len(items) {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"created": created,
+		"failed":  len(items) - created,
+		"results": items,
+	})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BotHandlerRequest registers the URL requests addressed to a bot are
+// pushed to
+type BotHandlerRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // Generated when omitted
+}
+
+// setBotHandler registers or replaces the handler of a bot. The response
+// carries the signing secret, which is not returned again.
+func (d Dependencies) setBotHandler(w http.ResponseWriter, r *http.Request) {
+	var req BotHandlerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	handler, err := d.entityService().SetBotHandler(r.Context(), chi.URLParam(r, "id"), req.URL, req.Secret)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(handler)
+}
+
+func (d Dependencies) getBotHandler(w http.ResponseWriter, r *http.Request) {
+	handler, err := d.entityService().GetBotHandler(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(handler)
+}
+
+func (d Dependencies) deleteBotHandler(w http.ResponseWriter, r *http.Request) {
+	if err := d.entityService().DeleteBotHandler(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// createBundle sends several requests to one entity as a bundle
+func (d Dependencies) createBundle(w http.ResponseWriter, r *http.Request) {
+	var input service.CreateBundleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	input.CreatedBy = r.Header.Get("X-Client-ID")
+	if input.CreatedBy == "" {
+		input.CreatedBy = "anonymous"
+	}
+
+	bundle, err := d.requestService().CreateBundle(r.Context(), input)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bundle)
+}
+
+func (d Dependencies) getBundle(w http.ResponseWriter, r *http.Request) {
+	bundle, err := d.requestService().GetBundle(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundle)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"pxbox/internal/ics"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// deadlineFeedURL is the subscription URL of an entity's deadline feed
+func deadlineFeedURL(entityID, token string) string {
+	return publicBaseURL() + "/entities/" + url.PathEscape(entityID) + "/deadlines.ics?token=" + url.QueryEscape(token)
+}
+
+// createCalendarFeed issues a new deadline feed token, revoking the old one
+func (d Dependencies) createCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+	feed, err := d.entityService().CreateCalendarFeed(r.Context(), entityID)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":     feed.Token,
+		"url":       deadlineFeedURL(entityID, feed.Token),
+		"createdAt": feed.CreatedAt,
+	})
+}
+
+// deleteCalendarFeed revokes the deadline feed token
+func (d Dependencies) deleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if err := d.entityService().DeleteCalendarFeed(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deadlineFeed serves the deadlines of an entity's open requests as an
+// iCalendar feed, authenticated by ?token= for calendar clients
+func (d Dependencies) deadlineFeed(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+	template := requestLinkTemplate()
+	link := func(requestID string) string {
+		return expandRequestLink(template, requestID, entityID, "")
+	}
+
+	cal, err := d.requestService().DeadlineCalendar(r.Context(), entityID, r.URL.Query().Get("token"), link)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	body := cal.Bytes(time.Now())
+	w.Header().Set("Content-Type", ics.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(body)
+}
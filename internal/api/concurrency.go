@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// expectedVersion reads the version a mutation is conditional on, from the
+// If-Match header, the expectedVersion query parameter or bodyVersion. When
+// REQUIRE_IF_MATCH=true a version is mandatory. On failure it writes the
+// error response and returns ok=false.
+func (d Dependencies) expectedVersion(w http.ResponseWriter, r *http.Request, bodyVersion *int) (version *int, ok bool) {
+	raw := r.Header.Get("If-Match")
+	if raw == "" {
+		raw = r.URL.Query().Get("expectedVersion")
+	}
+
+	if raw != "" {
+		raw = strings.Trim(strings.TrimPrefix(strings.TrimSpace(raw), "W/"), `"`)
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_version", "If-Match must be a request version", d.Log)
+			return nil, false
+		}
+		version = &v
+	} else {
+		version = bodyVersion
+	}
+
+	if version == nil && os.Getenv("REQUIRE_IF_MATCH") == "true" {
+		WriteError(w, http.StatusPreconditionRequired, "version_required", "If-Match or expectedVersion is required", d.Log)
+		return nil, false
+	}
+	return version, true
+}
+
+// etag formats a request version as an entity tag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (d Dependencies) listDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := d.entityService().ListDevices(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": devices,
+	})
+}
+
+func (d Dependencies) registerDevice(w http.ResponseWriter, r *http.Request) {
+	var req service.DeviceInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	device, err := d.entityService().RegisterDevice(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(device)
+}
+
+func (d Dependencies) deleteDevice(w http.ResponseWriter, r *http.Request) {
+	err := d.entityService().DeleteDevice(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "deviceId"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"pxbox/internal/mailin"
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// maxInboundEmailBytes bounds inbound email webhooks: the largest email,
+// base64 encoded inside a JSON notification
+const maxInboundEmailBytes = mailin.MaxMessageBytes * 3 / 2
+
+// snsClient confirms Amazon SNS subscriptions
+var snsClient = &http.Client{Timeout: 10 * time.Second}
+
+// ReplyAddress is the address that answers a request by email
+type ReplyAddress struct {
+	RequestID string `json:"requestId"`
+	Address   string `json:"address"`
+}
+
+// InboundEmailResult reports what became of an inbound email. Rejected
+// replies are acknowledged too, so the provider does not retry them.
+type InboundEmailResult struct {
+	Status     string `json:"status"` // "answered", "rejected" or "subscribed"
+	RequestID  string `json:"requestId,omitempty"`
+	ResponseID string `json:"responseId,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func (d Dependencies) getReplyAddress(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	address, err := d.requestService().ReplyAddress(r.Context(), id)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReplyAddress{RequestID: id, Address: address})
+}
+
+// inboundEmail receives email sent to reply addresses from Mailgun
+// (/email/inbound/mailgun, a route forwarding to the URL) or Amazon SES
+// (/email/inbound/ses, a receipt rule publishing to an SNS topic the URL
+// subscribes to, with ?secret=EMAIL_INBOUND_SECRET).
+func (d Dependencies) inboundEmail(w http.ResponseWriter, r *http.Request) {
+	if d.MailIn == nil {
+		WriteError(w, http.StatusNotFound, "not_found", "Answering by email is not configured", d.Log)
+		return
+	}
+
+	var msg *mailin.Message
+	var err error
+	switch provider := chi.URLParam(r, "provider"); provider {
+	case "mailgun":
+		msg, err = mailin.ParseMailgun(r, os.Getenv("MAILGUN_SIGNING_KEY"))
+	case "ses":
+		secret := os.Getenv("EMAIL_INBOUND_SECRET")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("secret")), []byte(secret)) != 1 {
+			err = mailin.ErrUnauthenticated
+			break
+		}
+		var body []byte
+		if body, err = io.ReadAll(r.Body); err != nil {
+			break
+		}
+		var subscribeURL string
+		if msg, subscribeURL, err = mailin.ParseSES(body); err == nil && subscribeURL != "" {
+			d.confirmSNS(w, r, subscribeURL)
+			return
+		}
+	default:
+		WriteError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Unknown email provider %q", provider), d.Log)
+		return
+	}
+	if errors.Is(err, mailin.ErrUnauthenticated) {
+		WriteError(w, http.StatusUnauthorized, "unauthorized", "Invalid webhook signature", d.Log)
+		return
+	}
+	if errors.Is(err, mailin.ErrReplayed) {
+		// Acknowledged, so a provider retrying a delivery gives up
+		d.writeInboundResult(w, InboundEmailResult{Status: "rejected", Code: "duplicate_email", Message: err.Error()})
+		return
+	}
+	if err != nil {
+		d.Log.Info("Rejected inbound email", zap.Error(err))
+		d.writeInboundResult(w, InboundEmailResult{Status: "rejected", Code: "invalid_email", Message: err.Error()})
+		return
+	}
+
+	resp, err := d.requestService().AnswerByEmail(r.Context(), msg)
+	if err != nil {
+		e := service.Classify(err)
+		if e.Kind == nil || errors.Is(e.Kind, service.ErrUnavailable) {
+			// Failed here rather than because of the email; let the
+			// provider retry
+			d.writeServiceError(w, err)
+			return
+		}
+		d.Log.Info("Rejected email reply", zap.String("code", e.Code), zap.String("message", e.Message))
+		d.writeInboundResult(w, InboundEmailResult{Status: "rejected", Code: e.Code, Message: e.Message})
+		return
+	}
+	d.writeInboundResult(w, InboundEmailResult{Status: "answered", RequestID: resp.RequestID, ResponseID: resp.ID})
+}
+
+// confirmSNS confirms the subscription of the SES endpoint to an SNS topic
+func (d Dependencies) confirmSNS(w http.ResponseWriter, r *http.Request, subscribeURL string) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, subscribeURL, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = snsClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("SNS returned %s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		d.Log.Warn("Failed to confirm SNS subscription", zap.Error(err))
+		WriteError(w, http.StatusBadGateway, "subscription_failed", "Failed to confirm SNS subscription", d.Log)
+		return
+	}
+	d.writeInboundResult(w, InboundEmailResult{Status: "subscribed"})
+}
+
+func (d Dependencies) writeInboundResult(w http.ResponseWriter, result InboundEmailResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -3,17 +3,24 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
 	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
 	"pxbox/internal/service"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 type CreateEntityRequest struct {
 	Kind   string                 `json:"kind"`
 	Handle string                 `json:"handle"`
 	Meta   map[string]interface{} `json:"meta,omitempty"`
+	// Sandbox entities have their requests purged after SANDBOX_TTL
+	Sandbox bool `json:"sandbox,omitempty"`
 }
 
 func (d Dependencies) createEntity(w http.ResponseWriter, r *http.Request) {
@@ -25,17 +32,16 @@ func (d Dependencies) createEntity(w http.ResponseWriter, r *http.Request) {
 
 	// Validate kind
 	kind := model.EntityKind(req.Kind)
-	if kind != model.EntityKindUser && kind != model.EntityKindGroup && 
-		kind != model.EntityKindRole && kind != model.EntityKindBot {
+	if !kind.Valid() {
 		WriteError(w, http.StatusBadRequest, "invalid_kind", "Invalid entity kind. Must be: user, group, role, or bot", d.Log)
 		return
 	}
 
 	entitySvc := service.NewEntityService(d.DB.Queries)
 
-	entity, err := entitySvc.CreateEntity(r.Context(), kind, req.Handle, req.Meta)
+	entity, err := entitySvc.CreateEntity(r.Context(), kind, req.Handle, req.Meta, req.Sandbox)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "create_failed", err.Error(), d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -51,7 +57,7 @@ func (d Dependencies) getEntity(w http.ResponseWriter, r *http.Request) {
 	
 	entity, err := entitySvc.ResolveEntity(r.Context(), id, "")
 	if err != nil {
-		WriteError(w, http.StatusNotFound, "not_found", "Entity not found", d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -59,3 +65,165 @@ func (d Dependencies) getEntity(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(entity)
 }
 
+
+// entityPresence reports whether an entity is connected over WebSocket
+func (d Dependencies) entityPresence(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	entitySvc := service.NewEntityService(d.DB.Queries)
+	if _, err := entitySvc.ResolveEntity(r.Context(), id, ""); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	var status pubsub.PresenceStatus
+	if d.Presence != nil {
+		var err error
+		status, err = d.Presence.Status(r.Context(), id)
+		if err != nil {
+			d.Log.Error("Failed to read presence", zap.String("entityID", id), zap.Error(err))
+			WriteError(w, http.StatusServiceUnavailable, "presence_unavailable", "Presence is unavailable", d.Log)
+			return
+		}
+	} else {
+		status = pubsub.PresenceStatus{EntityID: id, Online: d.Hub != nil && d.Hub.IsConnected(id)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// entityTags counts the entity's requests per tag
+func (d Dependencies) entityTags(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	entitySvc := service.NewEntityService(d.DB.Queries)
+	if _, err := entitySvc.ResolveEntity(r.Context(), id, ""); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	summary, err := entitySvc.TagSummary(r.Context(), id)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": summary,
+	})
+}
+
+// UpdateEntityRequest changes an entity's handle and metadata; omitted
+// fields are left unchanged and meta is merged into the existing metadata
+type UpdateEntityRequest struct {
+	Handle *string                `json:"handle,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// updateEntity changes an entity's handle or metadata
+func (d Dependencies) updateEntity(w http.ResponseWriter, r *http.Request) {
+	var req UpdateEntityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	entity, err := d.entityService().UpdateEntity(r.Context(), chi.URLParam(r, "id"), req.Handle, req.Meta)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity)
+}
+
+// listEntities lists entities newest first, filtered by kind and handle
+// prefix. Deactivated entities are left out unless includeDeactivated=true.
+func (d Dependencies) listEntities(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := db.EntityFilter{IncludeDeactivated: q.Get("includeDeactivated") == "true"}
+	if v := q.Get("kind"); v != "" {
+		f.Kind = &v
+	}
+	if v := q.Get("handle"); v != "" {
+		f.HandlePrefix = &v
+	}
+
+	limit := service.DefaultInquiryLimit
+	offset := 0
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	entities, err := d.entityService().ListEntities(r.Context(), f, limit, offset)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":  entities,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// deactivateEntity stops an entity from receiving new requests
+func (d Dependencies) deactivateEntity(w http.ResponseWriter, r *http.Request) {
+	entity, err := d.entityService().DeactivateEntity(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity)
+}
+
+// reactivateEntity lets a deactivated entity receive requests again
+func (d Dependencies) reactivateEntity(w http.ResponseWriter, r *http.Request) {
+	entity, err := d.entityService().ReactivateEntity(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity)
+}
+
+// MergeEntitiesRequest names the entity to merge and the one it is merged
+// into
+type MergeEntitiesRequest struct {
+	SourceID string `json:"sourceId"`
+	TargetID string `json:"targetId"`
+}
+
+// mergeEntities merges a duplicate entity into another one
+func (d Dependencies) mergeEntities(w http.ResponseWriter, r *http.Request) {
+	var req MergeEntitiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	merge, err := d.entityService().MergeEntities(r.Context(), req.SourceID, req.TargetID, auth.Actor(r.Context()))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merge)
+}
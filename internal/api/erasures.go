@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"pxbox/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EraseEntityRequest selects how an entity's data is erased
+type EraseEntityRequest struct {
+	Mode string `json:"mode,omitempty"` // "anonymize" (default) or "delete"
+}
+
+// eraseEntity starts a background erasure of an entity's data. The
+// requestor is notified with erasure.completed or erasure.failed.
+func (d Dependencies) eraseEntity(w http.ResponseWriter, r *http.Request) {
+	var req EraseEntityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	requestedBy := auth.GetClientID(r.Context())
+	if requestedBy == "" {
+		requestedBy = auth.Actor(r.Context())
+	}
+
+	erasure, err := d.erasureService().RequestErasure(r.Context(), chi.URLParam(r, "id"), req.Mode, requestedBy)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"erasureId": erasure.ID,
+		"status":    erasure.Status,
+		"channel":   "requestor:" + requestedBy,
+	})
+}
+
+// getErasure returns an erasure with its report once completed
+func (d Dependencies) getErasure(w http.ResponseWriter, r *http.Request) {
+	erasure, err := d.erasureService().GetErasure(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(erasure)
+}
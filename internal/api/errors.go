@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"pxbox/internal/service"
+)
+
+// serviceStatus maps service error categories to HTTP status codes
+var serviceStatus = map[error]int{
+	service.ErrNotFound:      http.StatusNotFound,
+	service.ErrConflict:      http.StatusConflict,
+	service.ErrValidation:    http.StatusBadRequest,
+	service.ErrForbidden:     http.StatusForbidden,
+	service.ErrUnavailable:   http.StatusServiceUnavailable,
+	service.ErrTooLarge:      http.StatusRequestEntityTooLarge,
+	service.ErrQuotaExceeded: http.StatusTooManyRequests,
+}
+
+// writeServiceError writes a service error with the status and code of its
+// category; uncategorized errors are reported as 500 internal_error
+func (d Dependencies) writeServiceError(w http.ResponseWriter, err error) {
+	e := service.Classify(err)
+	writeErrorResponse(w, serviceErrorStatus(e), ErrorResponse{
+		Error:   e.Code,
+		Code:    e.Code,
+		Message: e.Message,
+		Details: e.Details,
+	}, d.Log)
+}
+
+// serviceErrorStatus returns the HTTP status for the category of e
+func serviceErrorStatus(e *service.Error) int {
+	for kind, s := range serviceStatus {
+		if errors.Is(e.Kind, kind) {
+			return s
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/export"
+
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+func (d Dependencies) exportRequests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format, err := export.ParseFormat(q.Get("format"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_format", err.Error(), d.Log)
+		return
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_filter", err.Error(), d.Log)
+		return
+	}
+
+	// Get requestor from auth context (TODO: implement auth)
+	requestedBy := r.Header.Get("X-Client-ID")
+	if requestedBy == "" {
+		requestedBy = "anonymous"
+	}
+
+	// Async mode: hand the export to the job server and notify on completion
+	if q.Get("async") == "true" {
+		if d.JobClient == nil {
+			WriteError(w, http.StatusServiceUnavailable, "jobs_unavailable", "Background jobs are not available", d.Log)
+			return
+		}
+
+		job := export.Job{
+			ID:          ulid.Make().String(),
+			Format:      format,
+			Filter:      filter,
+			RequestedBy: requestedBy,
+		}
+		if err := d.JobClient.EnqueueExport(r.Context(), job); err != nil {
+			WriteError(w, http.StatusInternalServerError, "enqueue_failed", err.Error(), d.Log)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"exportId": job.ID,
+			"status":   "PENDING",
+			"channel":  "requestor:" + requestedBy,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", "attachment; filename=\"requests."+format.Extension()+"\"")
+
+	count, err := export.Run(r.Context(), d.DB.Queries, d.Sealer, filter, format, w)
+	if err != nil {
+		// Headers are already sent, so we can only log the failure
+		d.Log.Error("Export failed", zap.Error(err), zap.Int("count", count))
+		return
+	}
+}
+
+func parseExportFilter(r *http.Request) (db.ExportFilter, error) {
+	q := r.URL.Query()
+	var f db.ExportFilter
+
+	if v := q.Get("entityId"); v != "" {
+		f.EntityID = &v
+	}
+	if v := q.Get("status"); v != "" {
+		f.Status = &v
+	}
+	if v := q.Get("createdBy"); v != "" {
+		f.CreatedBy = &v
+	}
+	if v := q.Get("createdAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, err
+		}
+		f.CreatedAfter = &t
+	}
+	if v := q.Get("createdBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, err
+		}
+		f.CreatedBefore = &t
+	}
+
+	return f, nil
+}
@@ -2,13 +2,19 @@ package api
 
 import (
 	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
-	"os"
+	"path"
 	"strconv"
 	"strings"
-	"time"
 
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
 	"pxbox/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 func (d Dependencies) signFile(w http.ResponseWriter, r *http.Request) {
@@ -24,7 +30,7 @@ func (d Dependencies) signFile(w http.ResponseWriter, r *http.Request) {
 
 	// If requestId is provided, validate against request's file policy
 	if requestID != "" {
-		req, err := d.DB.Queries.GetRequestByID(r.Context(), requestID)
+		req, err := d.DB.Queries.GetRequestRef(r.Context(), requestID)
 		if err != nil {
 			WriteError(w, http.StatusNotFound, "request_not_found", "Request not found", d.Log)
 			return
@@ -63,38 +69,119 @@ func (d Dependencies) signFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Initialize storage (local filesystem for now)
-	baseDir := os.Getenv("STORAGE_BASE_DIR")
-	if baseDir == "" {
-		baseDir = "./storage"
+	fileSvc, err := d.fileService()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
 	}
-	baseURL := os.Getenv("STORAGE_BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8080"
+
+	signed, err := fileSvc.Sign(r.Context(), service.SignFileInput{
+		Key:         name,
+		ContentType: contentType,
+		RequestID:   requestID,
+		CreatedBy:   auth.Actor(r.Context()),
+	})
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
 	}
 
-	stor, err := storage.NewLocalStorage(baseDir, baseURL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signed)
+}
+
+// fileKey returns the object key from a /files/* route, rejecting keys that
+// could escape the storage root
+func fileKey(r *http.Request) (string, bool) {
+	key := chi.URLParam(r, "*")
+	if key == "" || strings.Contains(key, "..") || strings.HasPrefix(key, "/") {
+		return "", false
+	}
+	return key, true
+}
+
+func (d Dependencies) uploadFile(w http.ResponseWriter, r *http.Request) {
+	key, ok := fileKey(r)
+	if !ok {
+		WriteError(w, http.StatusBadRequest, "invalid_key", "Invalid file key", d.Log)
+		return
+	}
+
+	fileSvc, err := d.fileService()
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
 		return
 	}
 
-	putURL, err := stor.PresignPut(r.Context(), name, contentType, 15*time.Minute)
+	file, err := fileSvc.Upload(r.Context(), key, r.Header.Get("Content-Type"), r.Body)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "url_generation_failed", "Failed to generate presigned URL", d.Log)
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(file)
+}
+
+func (d Dependencies) downloadFile(w http.ResponseWriter, r *http.Request) {
+	key, ok := fileKey(r)
+	if !ok {
+		WriteError(w, http.StatusBadRequest, "invalid_key", "Invalid file key", d.Log)
 		return
 	}
 
-	getURL, err := stor.PresignGet(r.Context(), name, 24*time.Hour)
+	fileSvc, err := d.fileService()
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "url_generation_failed", "Failed to generate presigned URL", d.Log)
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
+	}
+
+	file, content, err := fileSvc.Open(r.Context(), key)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+	defer content.Close()
+
+	if file.SHA256 != "" {
+		etag := `"` + file.SHA256 + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if file.MIME != "" {
+		w.Header().Set("Content-Type", file.MIME)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(file.Name)}))
+	if _, err := io.Copy(w, content); err != nil {
+		d.Log.Warn("Failed to stream file", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// storageUsage reports uploaded file volume per entity (admin only)
+func (d Dependencies) storageUsage(w http.ResponseWriter, r *http.Request) {
+	fileSvc, err := d.fileService()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
+	}
+
+	usage, total, err := fileSvc.StorageUsage(r.Context(), r.URL.Query().Get("entityId"))
+	if err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"putUrl": putURL,
-		"getUrl": getURL,
+		"entities": usage,
+		"total":    total,
 	})
 }
-
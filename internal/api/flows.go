@@ -3,17 +3,20 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
-	"pxbox/internal/schema"
+	"pxbox/internal/db"
 	"pxbox/internal/service"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type CreateFlowRequest struct {
-	Kind        string                 `json:"kind"`
-	OwnerEntity string                 `json:"ownerEntity"`
-	Cursor      map[string]interface{} `json:"cursor,omitempty"`
+	Kind         string                 `json:"kind"`
+	OwnerEntity  string                 `json:"ownerEntity"`
+	Cursor       map[string]interface{} `json:"cursor,omitempty"`
+	ParentFlowID string                 `json:"parentFlowId,omitempty"`
 }
 
 func (d Dependencies) createFlow(w http.ResponseWriter, r *http.Request) {
@@ -23,18 +26,16 @@ func (d Dependencies) createFlow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
-	flowSvc := service.NewFlowService(d.DB.Queries, d.Bus, requestSvc)
+	flowSvc := d.flowService()
 
 	flow, err := flowSvc.CreateFlow(r.Context(), service.CreateFlowInput{
-		Kind:        req.Kind,
-		OwnerEntity: req.OwnerEntity,
-		Cursor:      req.Cursor,
+		Kind:         req.Kind,
+		OwnerEntity:  req.OwnerEntity,
+		Cursor:       req.Cursor,
+		ParentFlowID: req.ParentFlowID,
 	})
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "create_failed", err.Error(), d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -43,17 +44,57 @@ func (d Dependencies) createFlow(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(flow)
 }
 
+func (d Dependencies) listFlows(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var f db.FlowFilter
+
+	if v := q.Get("ownerEntity"); v != "" {
+		f.OwnerEntity = &v
+	}
+	if v := q.Get("kind"); v != "" {
+		f.Kind = &v
+	}
+	if v := q.Get("status"); v != "" {
+		f.Status = &v
+	}
+	if v := q.Get("createdAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_filter", "Invalid createdAfter: "+err.Error(), d.Log)
+			return
+		}
+		f.CreatedAfter = &t
+	}
+
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	page, err := d.flowService().ListFlows(r.Context(), f, q.Get("cursor"), limit)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
 func (d Dependencies) getFlow(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
-	flowSvc := service.NewFlowService(d.DB.Queries, d.Bus, requestSvc)
+	flowSvc := d.flowService()
 
-	flow, err := flowSvc.GetFlow(r.Context(), id)
+	get := flowSvc.GetFlow
+	if r.URL.Query().Get("includeChildren") == "true" {
+		get = flowSvc.GetFlowTree
+	}
+	flow, err := get(r.Context(), id)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, "not_found", "Flow not found", d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -62,8 +103,9 @@ func (d Dependencies) getFlow(w http.ResponseWriter, r *http.Request) {
 }
 
 type ResumeFlowRequest struct {
-	Event string                 `json:"event"`
-	Data  map[string]interface{} `json:"data,omitempty"`
+	Event   string                 `json:"event"`
+	EventID string                 `json:"eventId,omitempty"` // Deduplicates redelivered events
+	Data    map[string]interface{} `json:"data,omitempty"`
 }
 
 func (d Dependencies) resumeFlow(w http.ResponseWriter, r *http.Request) {
@@ -75,30 +117,34 @@ func (d Dependencies) resumeFlow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
-	flowSvc := service.NewFlowService(d.DB.Queries, d.Bus, requestSvc)
+	flowSvc := d.flowService()
 
-	if err := flowSvc.ResumeFlow(r.Context(), id, req.Event, req.Data); err != nil {
-		WriteError(w, http.StatusInternalServerError, "resume_failed", err.Error(), d.Log)
+	applied, err := flowSvc.ResumeFlowEvent(r.Context(), id, req.EventID, req.Event, req.Data)
+	if err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if !applied {
+		flow, err := flowSvc.GetFlow(r.Context(), id)
+		if err != nil {
+			d.writeServiceError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": flow.Status, "duplicate": true})
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]string{"status": "RUNNING"})
 }
 
 func (d Dependencies) cancelFlow(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
-	flowSvc := service.NewFlowService(d.DB.Queries, d.Bus, requestSvc)
+	flowSvc := d.flowService()
 
 	if err := flowSvc.CancelFlow(r.Context(), id); err != nil {
-		WriteError(w, http.StatusInternalServerError, "cancel_failed", err.Error(), d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -106,3 +152,12 @@ func (d Dependencies) cancelFlow(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "CANCELLED"})
 }
 
+// deleteFlow soft-deletes a finished flow and its sub-flows
+func (d Dependencies) deleteFlow(w http.ResponseWriter, r *http.Request) {
+	if err := d.flowService().DeleteFlow(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
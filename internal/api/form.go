@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/form"
+	"pxbox/internal/model"
+	"pxbox/internal/schema"
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// requestForm serves a server-rendered HTML form for answering a request,
+// for callers without a client app. It is opened with the caller's entity
+// credentials or with a share link token in ?token=.
+func (d Dependencies) requestForm(w http.ResponseWriter, r *http.Request) {
+	req, ok := d.formRequest(w, r)
+	if !ok {
+		return
+	}
+	f, err := form.Build(formSchema(req), req.UIHints, req.Prefill)
+	if err != nil {
+		d.writeFormMessage(w, http.StatusUnprocessableEntity, "This request cannot be answered in a browser form; please use a pxbox client.")
+		return
+	}
+	d.writeForm(w, http.StatusOK, r, req, f)
+}
+
+// formSchema returns the schema the form of a request is built from, the
+// inferred one for jsonexample requests
+func formSchema(req *model.Request) map[string]interface{} {
+	if req.SchemaKind == model.SchemaKindExample {
+		return schema.ExampleSchema(req.SchemaPayload)
+	}
+	return req.SchemaPayload
+}
+
+// submitRequestForm answers a request from its HTML form. Rejected answers
+// are shown again with the validation failures next to their fields.
+func (d Dependencies) submitRequestForm(w http.ResponseWriter, r *http.Request) {
+	req, ok := d.formRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		d.writeFormMessage(w, http.StatusBadRequest, "The form could not be read.")
+		return
+	}
+	payload := form.Decode(formSchema(req), r.PostForm)
+
+	var err error
+	if token := r.URL.Query().Get("token"); token != "" {
+		_, err = d.requestService().AnswerShareLink(r.Context(), token, service.Respondent{
+			Name:  r.PostForm.Get(form.RespondentNameField),
+			Email: r.PostForm.Get(form.RespondentEmailField),
+		}, payload, nil)
+	} else {
+		_, err = d.requestService().PostResponse(r.Context(), req.ID, auth.GetEntityID(r.Context()), payload, nil, nil)
+	}
+	if err == nil {
+		d.writeFormMessage(w, http.StatusOK, "Thank you, your answer has been recorded.")
+		return
+	}
+
+	e := service.Classify(err)
+	if !errors.Is(e.Kind, service.ErrValidation) {
+		d.writeFormError(w, err)
+		return
+	}
+	f, buildErr := form.Build(formSchema(req), req.UIHints, payload)
+	if buildErr != nil {
+		d.writeFormError(w, err)
+		return
+	}
+	if violations, ok := e.Details.([]schema.Violation); ok {
+		f.SetViolations(violations)
+	} else {
+		f.Errors = append(f.Errors, e.Message)
+	}
+	d.writeForm(w, http.StatusUnprocessableEntity, r, req, f)
+}
+
+// formRequest loads the request a form is for, writing an error page if it
+// cannot be answered by the caller
+func (d Dependencies) formRequest(w http.ResponseWriter, r *http.Request) (*model.Request, bool) {
+	id := chi.URLParam(r, "id")
+	locales := acceptLanguages(r.Header.Get("Accept-Language"))
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		locales = append([]string{locale}, locales...)
+	}
+
+	var req *model.Request
+	var err error
+	if token := r.URL.Query().Get("token"); token != "" {
+		req, err = d.requestService().OpenShareLink(r.Context(), token, locales)
+		if err == nil && req.ID != id {
+			d.writeFormMessage(w, http.StatusNotFound, "This link is invalid, used or expired.")
+			return nil, false
+		}
+	} else if auth.GetEntityID(r.Context()) == "" {
+		d.writeFormMessage(w, http.StatusUnauthorized, "Sign in or use the link you were sent to answer this request.")
+		return nil, false
+	} else {
+		req, err = d.requestService().GetLocalizedRequest(r.Context(), id, locales)
+	}
+	if err != nil {
+		d.writeFormError(w, err)
+		return nil, false
+	}
+
+	if model.RequestStatusMachine.Check(req.Status, model.StatusAnswered) != nil {
+		d.writeFormMessage(w, http.StatusConflict, "This request is no longer open for answers.")
+		return nil, false
+	}
+	return req, true
+}
+
+func (d Dependencies) writeForm(w http.ResponseWriter, status int, r *http.Request, req *model.Request, f *form.Form) {
+	page := form.Page{
+		Form:       f,
+		Respondent: r.URL.Query().Get("token") != "",
+	}
+	if req.Locale != nil {
+		page.Lang = *req.Locale
+	}
+	if req.DeadlineDisplay != nil {
+		page.Deadline = req.DeadlineDisplay.Local + " (" + req.DeadlineDisplay.Relative + ")"
+	}
+	for _, a := range req.Attachments {
+		name, _ := a["name"].(string)
+		url, _ := a["url"].(string)
+		page.Attachments = append(page.Attachments, form.Attachment{Name: name, URL: url})
+	}
+	if r.Method == http.MethodPost {
+		page.RespondentName = r.PostForm.Get(form.RespondentNameField)
+		page.RespondentEmail = r.PostForm.Get(form.RespondentEmailField)
+	}
+	d.writeFormPage(w, status, page)
+}
+
+// writeFormError shows a service error as a message page with the status
+// of its category
+func (d Dependencies) writeFormError(w http.ResponseWriter, err error) {
+	e := service.Classify(err)
+	status := serviceErrorStatus(e)
+	message := e.Message
+	switch {
+	case e.Code == "invalid_share_link":
+		message = "This link is invalid, used or expired."
+	case status == http.StatusInternalServerError:
+		message = "Something went wrong; please try again later."
+	}
+	d.writeFormMessage(w, status, message)
+}
+
+func (d Dependencies) writeFormMessage(w http.ResponseWriter, status int, message string) {
+	d.writeFormPage(w, status, form.Page{Message: message})
+}
+
+func (d Dependencies) writeFormPage(w http.ResponseWriter, status int, page form.Page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Share tokens are in the URL; keep them out of Referer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'self'")
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	if err := form.Render(w, page); err != nil {
+		d.Log.Error("Failed to render form", zap.Error(err))
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"strconv"
 	"time"
 
-	"pxbox/internal/schema"
 	"pxbox/internal/service"
 
 	"github.com/go-chi/chi/v5"
@@ -16,11 +15,8 @@ import (
 func (d Dependencies) listInquiries(w http.ResponseWriter, r *http.Request) {
 	entityID := r.URL.Query().Get("entityId")
 	status := r.URL.Query().Get("status")
-	includeDeleted := r.URL.Query().Get("includeDeleted") == "true"
+	createdBy := r.URL.Query().Get("createdBy")
 	sortBy := r.URL.Query().Get("sortBy")
-	if sortBy == "" {
-		sortBy = "created"
-	}
 
 	limit := 50
 	offset := 0
@@ -35,29 +31,24 @@ func (d Dependencies) listInquiries(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var entityIDPtr *string
-	if entityID != "" {
-		entityIDPtr = &entityID
-	}
-	var statusPtr *string
-	if status != "" {
-		statusPtr = &status
-	}
-
-	d.Log.Info("ListInquiries called", zap.String("entityID", entityID), zap.Bool("entityIDPtrNil", entityIDPtr == nil), zap.Any("statusPtr", statusPtr))
-	if entityIDPtr != nil {
-		d.Log.Info("EntityIDPtr value", zap.String("value", *entityIDPtr))
-	}
-
-	requests, err := d.DB.Queries.ListInquiries(r.Context(), entityIDPtr, statusPtr, includeDeleted, sortBy, limit, offset)
+	requests, err := d.requestService().ListInquiries(r.Context(), service.InquiryQuery{
+		ViewID:         r.URL.Query().Get("view"),
+		EntityID:       entityID,
+		Status:         status,
+		CreatedBy:      createdBy,
+		Tags:           queryList(r, "tags"),
+		SortBy:         sortBy,
+		IncludeDeleted: r.URL.Query().Get("includeDeleted") == "true",
+		IncludeSnoozed: r.URL.Query().Get("includeSnoozed") == "true",
+		IncludeExpired: r.URL.Query().Get("includeExpired") == "true",
+		Limit:          limit,
+		Offset:         offset,
+	})
 	if err != nil {
-		d.Log.Error("Failed to list inquiries", zap.Error(err), zap.String("entityID", entityID), zap.Any("entityIDPtr", entityIDPtr))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		d.writeServiceError(w, err)
 		return
 	}
 
-	d.Log.Info("ListInquiries result", zap.Int("count", len(requests)), zap.String("entityID", entityID))
-
 	result := make([]map[string]interface{}, 0)
 	for _, req := range requests {
 		result = append(result, map[string]interface{}{
@@ -65,12 +56,24 @@ func (d Dependencies) listInquiries(w http.ResponseWriter, r *http.Request) {
 			"status":     req.Status,
 			"createdBy":  req.CreatedBy,
 			"entityId":   req.EntityID,
-			"createdAt":  req.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			"deadlineAt": timePtrToString(req.DeadlineAt),
-			"readAt":     timePtrToString(req.ReadAt),
+			"createdAt":  req.CreatedAt,
+			"deadlineAt": req.DeadlineAt,
+			"deadlineDisplay": req.DeadlineDisplay,
+			"attentionAt": req.AttentionAt,
+			"attentionDisplay": req.AttentionDisplay,
+			"readAt":     req.ReadAt,
+			"deliveredAt": req.DeliveredAt,
+			"snoozedUntil": req.SnoozedUntil,
+			"sandbox":    req.Sandbox,
+			"tags":       req.Tags,
 		})
 	}
 
+	logFields(r.Context(),
+		zap.String("entity_id", entityID),
+		zap.String("status_filter", status),
+		zap.Int("count", len(result)))
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"items": result,
@@ -81,8 +84,8 @@ func (d Dependencies) listInquiries(w http.ResponseWriter, r *http.Request) {
 func (d Dependencies) markRead(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	if err := d.DB.Queries.MarkInquiryRead(r.Context(), id); err != nil {
-		WriteError(w, http.StatusInternalServerError, "update_failed", err.Error(), d.Log)
+	if err := d.requestService().MarkRead(r.Context(), id); err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -103,40 +106,53 @@ func (d Dependencies) snooze(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get entity ID from auth context (TODO: implement auth)
-	entityID := r.Header.Get("X-Entity-ID")
-	if entityID == "" {
-		WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized", d.Log)
-		return
-	}
-
-	// Create reminder
-	_, err := d.DB.Queries.CreateReminder(r.Context(), id, entityID, req.RemindAt)
+	remindAt, err := d.requestService().Snooze(r.Context(), id, req.RemindAt)
 	if err != nil {
-		d.Log.Error("Failed to create reminder", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		d.writeServiceError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":   "snoozed",
-		"remindAt": req.RemindAt.Format("2006-01-02T15:04:05Z07:00"),
+		"remindAt": remindAt.Format("2006-01-02T15:04:05Z07:00"),
 	})
 }
 
+// listReminders lists the reminders the caller set on an inquiry by
+// snoozing it
+func (d Dependencies) listReminders(w http.ResponseWriter, r *http.Request) {
+	reminders, err := d.requestService().ListReminders(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"reminders": reminders})
+}
+
+// deleteReminder cancels a pending reminder and its scheduled job
+func (d Dependencies) deleteReminder(w http.ResponseWriter, r *http.Request) {
+	if err := d.requestService().CancelReminder(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (d Dependencies) cancelInquiry(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
-	if d.JobClient != nil {
-		requestSvc.SetJobClient(d.JobClient)
+	version, ok := d.expectedVersion(w, r, nil)
+	if !ok {
+		return
 	}
 
-	if err := requestSvc.CancelRequest(r.Context(), id); err != nil {
-		WriteError(w, http.StatusInternalServerError, "cancel_failed", err.Error(), d.Log)
+	requestSvc := d.requestService()
+
+	if err := requestSvc.CancelRequest(r.Context(), id, version); err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -147,8 +163,13 @@ func (d Dependencies) cancelInquiry(w http.ResponseWriter, r *http.Request) {
 func (d Dependencies) deleteInquiry(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	if err := d.DB.Queries.SoftDeleteInquiry(r.Context(), id); err != nil {
-		WriteError(w, http.StatusInternalServerError, "delete_failed", err.Error(), d.Log)
+	version, ok := d.expectedVersion(w, r, nil)
+	if !ok {
+		return
+	}
+
+	if err := d.requestService().DeleteRequest(r.Context(), id, version); err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
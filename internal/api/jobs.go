@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pxbox/internal/jobs"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// listDeadJobs lists background tasks that exhausted their retries (admin only)
+func (d Dependencies) listDeadJobs(w http.ResponseWriter, r *http.Request) {
+	if d.DeadLetters == nil {
+		WriteError(w, http.StatusServiceUnavailable, "jobs_unavailable", "Job inspection is not configured", d.Log)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	dead, err := d.DeadLetters.List(r.URL.Query().Get("queue"), limit)
+	if err != nil {
+		d.Log.Error("Failed to list dead jobs", zap.Error(err))
+		WriteError(w, http.StatusInternalServerError, "query_failed", "Failed to list dead jobs", d.Log)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": dead,
+	})
+}
+
+// retryJob requeues a dead task (admin only)
+func (d Dependencies) retryJob(w http.ResponseWriter, r *http.Request) {
+	if d.DeadLetters == nil {
+		WriteError(w, http.StatusServiceUnavailable, "jobs_unavailable", "Job inspection is not configured", d.Log)
+		return
+	}
+
+	job, err := d.DeadLetters.Retry(r.URL.Query().Get("queue"), chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		WriteError(w, http.StatusNotFound, "not_found", "Job not found", d.Log)
+		return
+	case errors.Is(err, jobs.ErrJobNotDead):
+		WriteError(w, http.StatusConflict, "job_not_dead", err.Error(), d.Log)
+		return
+	case err != nil:
+		d.Log.Error("Failed to retry job", zap.Error(err))
+		WriteError(w, http.StatusInternalServerError, "retry_failed", "Failed to retry job", d.Log)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "requeued",
+		"job":    job,
+	})
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/skip2/go-qrcode"
+)
+
+// QR code sizes in pixels
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+// requestLinkTemplate is the deep link to a request, from
+// REQUEST_LINK_TEMPLATE. {id}, {entityId} and {token} are replaced; the
+// default points at the hosted answer form.
+func requestLinkTemplate() string {
+	if v := os.Getenv("REQUEST_LINK_TEMPLATE"); v != "" {
+		return v
+	}
+	return publicBaseURL() + "/requests/{id}/form"
+}
+
+// expandRequestLink fills in a link template. A share token is appended as
+// ?token= when the template has no {token}.
+func expandRequestLink(template, requestID, entityID, token string) string {
+	link := strings.NewReplacer(
+		"{id}", url.PathEscape(requestID),
+		"{entityId}", url.PathEscape(entityID),
+		"{token}", url.QueryEscape(token),
+	).Replace(template)
+	if token != "" && !strings.Contains(template, "{token}") {
+		sep := "?"
+		if strings.Contains(link, "?") {
+			sep = "&"
+		}
+		link += sep + "token=" + url.QueryEscape(token)
+	}
+	return link
+}
+
+// requestLink returns a deep link to a request as JSON or, with
+// ?format=qr, as a QR code PNG. It carries no token; see shareRequestLink.
+func (d Dependencies) requestLink(w http.ResponseWriter, r *http.Request) {
+	format, size, ok := d.linkFormat(w, r)
+	if !ok {
+		return
+	}
+	req, err := d.requestService().GetRequest(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+	link := expandRequestLink(requestLinkTemplate(), req.ID, req.EntityID, "")
+	d.writeRequestLink(w, http.StatusOK, format, size, map[string]interface{}{"requestId": req.ID, "url": link})
+}
+
+// shareRequestLink creates a share link for a request and returns a deep
+// link carrying its token, so whoever follows or scans it can answer
+// without an account. It takes the body and format of requestLink and
+// createShareLink.
+func (d Dependencies) shareRequestLink(w http.ResponseWriter, r *http.Request) {
+	format, size, ok := d.linkFormat(w, r)
+	if !ok {
+		return
+	}
+	ttl, ok := d.shareTTL(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	req, err := d.requestService().GetRequest(r.Context(), id)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+	share, err := d.requestService().CreateShareLink(r.Context(), id, ttl)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	link := expandRequestLink(requestLinkTemplate(), req.ID, req.EntityID, share.Token)
+	w.Header().Set("Cache-Control", "no-store")
+	d.writeRequestLink(w, http.StatusCreated, format, size, map[string]interface{}{
+		"requestId": req.ID,
+		"url":       link,
+		"expiresAt": share.ExpiresAt,
+	})
+}
+
+// linkFormat reads the format and QR code size of a request link, writing
+// the error if they are invalid
+func (d Dependencies) linkFormat(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "url"
+	}
+	if format != "url" && format != "qr" {
+		WriteError(w, http.StatusBadRequest, "invalid_format", "format must be url or qr", d.Log)
+		return "", 0, false
+	}
+	size := defaultQRSize
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			WriteError(w, http.StatusBadRequest, "invalid_size", "size must be between 64 and 1024 pixels", d.Log)
+			return "", 0, false
+		}
+		size = n
+	}
+	return format, size, true
+}
+
+// writeRequestLink writes body as JSON or, for the qr format, its url as a
+// QR code PNG
+func (d Dependencies) writeRequestLink(w http.ResponseWriter, status int, format string, size int, body map[string]interface{}) {
+	if format == "qr" {
+		png, err := qrcode.Encode(body["url"].(string), qrcode.Medium, size)
+		if err != nil {
+			WriteError(w, http.StatusUnprocessableEntity, "link_too_long", "The link is too long for a QR code", d.Log)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(status)
+		w.Write(png)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestExpandRequestLink(t *testing.T) {
+	const id, entityID = "01ARZ3NDEKTSV4RRFFQ69G5FAV", "ent/1"
+
+	assert.Equal(t, "https://x.example.com/requests/"+id+"/form",
+		expandRequestLink("https://x.example.com/requests/{id}/form", id, entityID, ""))
+	assert.Equal(t, "https://x.example.com/requests/"+id+"/form?token=a%2Bb%3D",
+		expandRequestLink("https://x.example.com/requests/{id}/form", id, entityID, "a+b="))
+	assert.Equal(t, "https://x.example.com/inbox?entityId=ent%2F1&request="+id+"&token=tok",
+		expandRequestLink("https://x.example.com/inbox?entityId={entityId}&request={id}", id, entityID, "tok"))
+
+	// A template placing the token is not given another one
+	assert.Equal(t, "app://answer/"+id+"/a%2Bb%3D",
+		expandRequestLink("app://answer/{id}/{token}", id, entityID, "a+b="))
+	assert.Equal(t, "app://answer/"+id+"/",
+		expandRequestLink("app://answer/{id}/{token}", id, entityID, ""))
+}
+
+func TestRequestLinkTemplate(t *testing.T) {
+	t.Setenv("REQUEST_LINK_TEMPLATE", "")
+	t.Setenv("PUBLIC_BASE_URL", "https://pxbox.example.com/v1/")
+	assert.Equal(t, "https://pxbox.example.com/v1/requests/{id}/form", requestLinkTemplate())
+
+	t.Setenv("REQUEST_LINK_TEMPLATE", "app://requests/{id}")
+	assert.Equal(t, "app://requests/{id}", requestLinkTemplate())
+}
+
+func TestLinkFormat(t *testing.T) {
+	d := Dependencies{Log: zap.NewNop()}
+	for query, want := range map[string]struct {
+		format string
+		size   int
+	}{
+		"":                   {"url", defaultQRSize},
+		"?format=url":        {"url", defaultQRSize},
+		"?format=qr&size=64": {"qr", 64},
+	} {
+		w := httptest.NewRecorder()
+		format, size, ok := d.linkFormat(w, httptest.NewRequest("GET", "/requests/r/link"+query, nil))
+		assert.True(t, ok, query)
+		assert.Equal(t, want.format, format, query)
+		assert.Equal(t, want.size, size, query)
+	}
+
+	for query, code := range map[string]string{
+		"?format=svg": "invalid_format",
+		"?size=32":    "invalid_size",
+		"?size=2048":  "invalid_size",
+		"?size=big":   "invalid_size",
+	} {
+		w := httptest.NewRecorder()
+		_, _, ok := d.linkFormat(w, httptest.NewRequest("GET", "/requests/r/link"+query, nil))
+		assert.False(t, ok, query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Contains(t, w.Body.String(), code, query)
+	}
+}
+
+func TestWriteRequestLink(t *testing.T) {
+	d := Dependencies{Log: zap.NewNop()}
+	body := map[string]interface{}{"requestId": "r1", "url": "https://pxbox.example.com/v1/requests/r1/form"}
+
+	w := httptest.NewRecorder()
+	d.writeRequestLink(w, http.StatusOK, "url", defaultQRSize, body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, body, got)
+
+	w = httptest.NewRecorder()
+	d.writeRequestLink(w, http.StatusCreated, "qr", 128, body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+
+	w = httptest.NewRecorder()
+	d.writeRequestLink(w, http.StatusOK, "qr", defaultQRSize, map[string]interface{}{"url": "https://x.example.com/" + strings.Repeat("a", 4000)})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "link_too_long")
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/auth"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// getLogLevel returns the current log level (admin only)
+func (d Dependencies) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	if d.LogLevel == nil {
+		WriteError(w, http.StatusServiceUnavailable, "loglevel_unavailable", "The log level cannot be changed at runtime", d.Log)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"level": d.LogLevel.Level().String(),
+	})
+}
+
+// setLogLevel changes the log level of this instance until it restarts
+// (admin only)
+func (d Dependencies) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	if d.LogLevel == nil {
+		WriteError(w, http.StatusServiceUnavailable, "loglevel_unavailable", "The log level cannot be changed at runtime", d.Log)
+		return
+	}
+
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+	level, err := zapcore.ParseLevel(req.Level)
+	if err != nil || req.Level == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_input", "level must be one of debug, info, warn, error, dpanic, panic or fatal", d.Log)
+		return
+	}
+
+	previous := d.LogLevel.Level()
+	d.LogLevel.SetLevel(level)
+	// Logged at warn so the change shows up at the default level
+	d.Log.Warn("Log level changed",
+		zap.String("from", previous.String()),
+		zap.String("to", level.String()),
+		zap.String("actor", auth.Actor(r.Context())))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"level":    level.String(),
+		"previous": previous.String(),
+	})
+}
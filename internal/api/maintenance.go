@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (d Dependencies) listMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	windows, err := d.entityService().ListMaintenanceWindows(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": windows,
+	})
+}
+
+func (d Dependencies) createMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	var req service.MaintenanceWindowInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	window, err := d.entityService().CreateMaintenanceWindow(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(window)
+}
+
+func (d Dependencies) deleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	err := d.entityService().DeleteMaintenanceWindow(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "windowId"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,27 +1,35 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"pxbox/internal/auth"
+	"pxbox/internal/correlation"
+	"pxbox/internal/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 )
 
 // ErrorResponse represents a standardized error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    string `json:"code,omitempty"`
-	Message string `json:"message"`
+	Error         string      `json:"error"`
+	Code          string      `json:"code,omitempty"`
+	Message       string      `json:"message"`
+	Details       interface{} `json:"details,omitempty"`
+	CorrelationID string      `json:"correlationId,omitempty"` // The call's X-Request-Id, to find its logs and events
 }
 
 // Error writes a standardized error response
 func WriteError(w http.ResponseWriter, code int, errCode, message string, log *zap.Logger) {
-	log.Error("API error", zap.String("code", errCode), zap.String("message", message))
-	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	
 	resp := ErrorResponse{
 		Error:   errCode,
 		Message: message,
@@ -30,10 +38,40 @@ func WriteError(w http.ResponseWriter, code int, errCode, message string, log *z
 		resp.Code = errCode
 	}
 	
+	writeErrorResponse(w, code, resp, log)
+}
+
+func writeErrorResponse(w http.ResponseWriter, code int, resp ErrorResponse, log *zap.Logger) {
+	resp.CorrelationID = w.Header().Get(correlation.Header)
+	log.Error("API error", zap.String("code", resp.Code), zap.String("message", resp.Message), zap.String("correlation_id", resp.CorrelationID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(resp)
 }
 
-// RequestLogger logs HTTP requests and responses
+// requestLog collects the fields handlers add to the log line of their API
+// call
+type requestLog struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+type requestLogKey struct{}
+
+// logFields adds fields to the log line of the API call of ctx, such as the
+// caller or the number of results
+func logFields(ctx context.Context, fields ...zap.Field) {
+	if l, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		l.mu.Lock()
+		l.fields = append(l.fields, fields...)
+		l.mu.Unlock()
+	}
+}
+
+// RequestLogger logs one line per HTTP request, with its route, status,
+// latency, caller and the fields its handler adds with logFields. Server
+// errors are logged at error level.
 func RequestLogger(log *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -47,18 +85,32 @@ func RequestLogger(log *zap.Logger) func(http.Handler) http.Handler {
 			
 			// Wrap response writer to capture status code
 			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			rl := &requestLog{}
 			
-			next.ServeHTTP(wrapped, r)
+			next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl)))
 			
 			duration := time.Since(start)
 			
-			log.Info("HTTP request",
+			fields := []zap.Field{
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.Int("status", wrapped.statusCode),
 				zap.Duration("duration", duration),
 				zap.String("remote_addr", r.RemoteAddr),
-			)
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				fields = append(fields, zap.String("route", rctx.RoutePattern()))
+			}
+			rl.mu.Lock()
+			fields = append(fields, rl.fields...)
+			rl.mu.Unlock()
+
+			logger := correlation.Logger(r.Context(), log)
+			if wrapped.statusCode >= http.StatusInternalServerError {
+				logger.Error("HTTP request", fields...)
+			} else {
+				logger.Info("HTTP request", fields...)
+			}
 		})
 	}
 }
@@ -73,3 +125,76 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+
+// maxCorrelationID bounds the request IDs taken from callers
+const maxCorrelationID = 128
+
+// Correlate makes the call's request ID, as set by chi's RequestID
+// middleware from X-Request-Id, the correlation ID of the events, jobs and
+// log lines it causes, and returns it in the X-Request-Id response header.
+// Without a usable request ID a new one is generated.
+func Correlate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetReqID(r.Context())
+		if id == "" || len(id) > maxCorrelationID || strings.ContainsFunc(id, unicode.IsControl) {
+			id = correlation.New()
+		}
+		w.Header().Set(correlation.Header, id)
+		next.ServeHTTP(w, r.WithContext(correlation.With(r.Context(), id, "")))
+	})
+}
+
+// LimitBody rejects request bodies larger than limit bytes with 413. Bodies
+// without a declared length are cut off at the limit while being read.
+func LimitBody(limit int64, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				WriteError(w, http.StatusRequestEntityTooLarge, "payload_too_large", "Request body too large", log)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CallerContext stores the caller's IP address and requestor client ID in the
+// request context for auditing
+func CallerContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ctx := auth.WithClientIP(r.Context(), ip)
+		if clientID := r.Header.Get("X-Client-ID"); clientID != "" {
+			ctx = auth.WithClientID(ctx, clientID)
+		}
+		logFields(ctx, zap.String("actor", auth.Actor(ctx)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestMemo lets the handlers of one API call share the requests they look
+// up by ID
+func RequestMemo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(db.WithRequestMemo(r.Context())))
+	})
+}
+
+// RequireAdmin rejects requests from callers without admin access
+func RequireAdmin(log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.IsAdmin(r.Context()) {
+				WriteError(w, http.StatusForbidden, "forbidden", "Admin access required", log)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (d Dependencies) getPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := service.NewEntityService(d.DB.Queries).GetPreferences(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+func (d Dependencies) updatePreferences(w http.ResponseWriter, r *http.Request) {
+	var req model.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	prefs, err := service.NewEntityService(d.DB.Queries).UpdatePreferences(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+func (d Dependencies) getBusinessCalendar(w http.ResponseWriter, r *http.Request) {
+	calendar, err := service.NewEntityService(d.DB.Queries).GetBusinessCalendar(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+func (d Dependencies) updateBusinessCalendar(w http.ResponseWriter, r *http.Request) {
+	var req model.BusinessCalendar
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	calendar, err := service.NewEntityService(d.DB.Queries).UpdateBusinessCalendar(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"pxbox/internal/auth"
+
+	"go.uber.org/zap"
+)
+
+// defaultShareRateLimit is how many share link requests a client IP may
+// make per minute
+const defaultShareRateLimit = 30
+
+// shareRateLimit returns the per-IP limit of share link requests per
+// minute from SHARE_RATE_LIMIT; 0 disables limiting
+func shareRateLimit() int {
+	if v := os.Getenv("SHARE_RATE_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultShareRateLimit
+}
+
+// RateLimiter counts requests per key in fixed windows. Counts are kept in
+// memory, so each API instance limits on its own.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	swept   time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter allows limit requests per key and window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, windows: map[string]*rateWindow{}}
+}
+
+// Allow counts a request for key and reports whether it is within the
+// limit, and if not, how long until the window resets
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop finished windows now and then so idle keys don't pile up
+	if now.Sub(l.swept) > l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// RateLimit rejects requests of a client IP over the limiter's limit with
+// 429 and a Retry-After header. A nil limiter lets everything through.
+func RateLimit(limiter *RateLimiter, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter := limiter.Allow(auth.GetClientIP(r.Context()), time.Now())
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				WriteError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests", log)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
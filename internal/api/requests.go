@@ -3,9 +3,12 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"pxbox/internal/schema"
+	"pxbox/internal/fieldmask"
 	"pxbox/internal/service"
 
 	"github.com/go-chi/chi/v5"
@@ -21,9 +24,15 @@ type CreateRequestRequest struct {
 	Prefill     map[string]interface{} `json:"prefill,omitempty"`
 	ExpiresAt   *time.Time             `json:"expiresAt,omitempty"`
 	DeadlineAt  *time.Time              `json:"deadlineAt,omitempty"`
+	DeadlineIn  *string                 `json:"deadlineIn,omitempty"`
 	AttentionAt *time.Time              `json:"attentionAt,omitempty"`
 	CallbackURL *string                 `json:"callbackUrl,omitempty"`
+	CallbackFields []string             `json:"callbackFields,omitempty"`
 	FilesPolicy map[string]interface{}  `json:"filesPolicy,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Locale      *string                 `json:"locale,omitempty"`
+	Timezone    *string                 `json:"timezone,omitempty"`
+	Attachments []map[string]interface{} `json:"attachments,omitempty"`
 }
 
 func (d Dependencies) createRequest(w http.ResponseWriter, r *http.Request) {
@@ -40,12 +49,7 @@ func (d Dependencies) createRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Initialize services
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
-	if d.JobClient != nil {
-		requestSvc.SetJobClient(d.JobClient)
-	}
+	requestSvc := d.requestService()
 
 	// Create request
 	result, err := requestSvc.CreateRequest(r.Context(), service.CreateRequestInput{
@@ -55,13 +59,19 @@ func (d Dependencies) createRequest(w http.ResponseWriter, r *http.Request) {
 		Prefill:     req.Prefill,
 		ExpiresAt:   req.ExpiresAt,
 		DeadlineAt:  req.DeadlineAt,
+		DeadlineIn:  req.DeadlineIn,
 		AttentionAt: req.AttentionAt,
 		CallbackURL: req.CallbackURL,
+		CallbackFields: req.CallbackFields,
 		FilesPolicy: req.FilesPolicy,
+		Tags:        req.Tags,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+		Attachments: req.Attachments,
 		CreatedBy:   createdBy,
 	})
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "create_failed", err.Error(), d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -76,29 +86,120 @@ func (d Dependencies) createRequest(w http.ResponseWriter, r *http.Request) {
 func (d Dependencies) getRequest(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
+	requestSvc := d.requestService()
+
+	// ?locale= wins over Accept-Language
+	locales := acceptLanguages(r.Header.Get("Accept-Language"))
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		locales = append([]string{locale}, locales...)
+	}
+
+	req, err := requestSvc.GetLocalizedRequest(r.Context(), id, locales)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(req.Version))
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(req)
+}
+
+// getRequestSchema returns the JSON Schema a request's answers must match,
+// inferred from the example for jsonexample requests, to render a form by
+func (d Dependencies) getRequestSchema(w http.ResponseWriter, r *http.Request) {
+	locales := acceptLanguages(r.Header.Get("Accept-Language"))
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		locales = append([]string{locale}, locales...)
+	}
+
+	s, err := d.requestService().GetRequestSchema(r.Context(), chi.URLParam(r, "id"), locales)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(s)
+}
+
+// updateRequest edits the mutable fields of a request, currently its tags
+func (d Dependencies) updateRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var body struct {
+		Tags            *[]string `json:"tags,omitempty"`
+		AddTags         []string  `json:"addTags,omitempty"`
+		RemoveTags      []string  `json:"removeTags,omitempty"`
+		ExpectedVersion *int      `json:"expectedVersion,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
 
-	req, err := requestSvc.GetRequest(r.Context(), id)
+	version, ok := d.expectedVersion(w, r, body.ExpectedVersion)
+	if !ok {
+		return
+	}
+
+	req, err := d.requestService().UpdateTags(r.Context(), id, service.TagUpdate{
+		Set:    body.Tags,
+		Add:    body.AddTags,
+		Remove: body.RemoveTags,
+	}, version)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, "not_found", "Request not found", d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(req.Version))
+	json.NewEncoder(w).Encode(req)
+}
+
+func (d Dependencies) updateDeadline(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var body struct {
+		DeadlineAt      *time.Time `json:"deadlineAt"`
+		ExpectedVersion *int       `json:"expectedVersion,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.DeadlineAt == nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "deadlineAt required", d.Log)
+		return
+	}
+
+	version, ok := d.expectedVersion(w, r, body.ExpectedVersion)
+	if !ok {
+		return
+	}
+
+	req, err := d.requestService().UpdateDeadline(r.Context(), id, *body.DeadlineAt, version)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(req.Version))
 	json.NewEncoder(w).Encode(req)
 }
 
 func (d Dependencies) cancelRequest(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
+	version, ok := d.expectedVersion(w, r, nil)
+	if !ok {
+		return
+	}
+
+	requestSvc := d.requestService()
 
-	if err := requestSvc.CancelRequest(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := requestSvc.CancelRequest(r.Context(), id, version); err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -109,12 +210,15 @@ func (d Dependencies) cancelRequest(w http.ResponseWriter, r *http.Request) {
 func (d Dependencies) claimRequest(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
+	version, ok := d.expectedVersion(w, r, nil)
+	if !ok {
+		return
+	}
 
-	if err := requestSvc.ClaimRequest(r.Context(), id); err != nil {
-		WriteError(w, http.StatusConflict, "claim_failed", err.Error(), d.Log)
+	requestSvc := d.requestService()
+
+	if err := requestSvc.ClaimRequest(r.Context(), id, version); err != nil {
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -122,12 +226,30 @@ func (d Dependencies) claimRequest(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "CLAIMED"})
 }
 
+func (d Dependencies) unclaimRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	version, ok := d.expectedVersion(w, r, nil)
+	if !ok {
+		return
+	}
+
+	if err := d.requestService().UnclaimRequest(r.Context(), id, version); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "PENDING"})
+}
+
 func (d Dependencies) postResponse(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
 	var body struct {
-		Payload map[string]interface{} `json:"payload"`
-		Files   []map[string]interface{} `json:"files,omitempty"`
+		Payload         map[string]interface{}   `json:"payload"`
+		Files           []map[string]interface{} `json:"files,omitempty"`
+		ExpectedVersion *int                     `json:"expectedVersion,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
@@ -141,13 +263,16 @@ func (d Dependencies) postResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
+	version, ok := d.expectedVersion(w, r, body.ExpectedVersion)
+	if !ok {
+		return
+	}
+
+	requestSvc := d.requestService()
 
-	resp, err := requestSvc.PostResponse(r.Context(), id, answeredBy, body.Payload, body.Files)
+	resp, err := requestSvc.PostResponse(r.Context(), id, answeredBy, body.Payload, body.Files, version)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, "validation_failed", err.Error(), d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
@@ -161,19 +286,29 @@ func (d Dependencies) postResponse(w http.ResponseWriter, r *http.Request) {
 
 func (d Dependencies) getResponse(w http.ResponseWriter, r *http.Request) {
 	requestID := chi.URLParam(r, "id")
+
+	mask, err := fieldmask.Parse(r.URL.Query().Get("fields"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_fields", err.Error(), d.Log)
+		return
+	}
 	
-	schemaComp := schema.NewCompilerWithCache(64)
-	entitySvc := service.NewEntityService(d.DB.Queries)
-	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
+	requestSvc := d.requestService()
 
 	resp, err := requestSvc.GetResponseByRequestID(r.Context(), requestID)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, "not_found", "Response not found", d.Log)
+		d.writeServiceError(w, err)
+		return
+	}
+
+	projected, err := mask.ApplyTo(resp)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "internal_error", err.Error(), d.Log)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(projected)
 }
 
 func (d Dependencies) entityQueue(w http.ResponseWriter, r *http.Request) {
@@ -185,25 +320,36 @@ func (d Dependencies) entityQueue(w http.ResponseWriter, r *http.Request) {
 		statusPtr = &status
 	}
 
-	limit := 50
-	offset := 0
-	// TODO: Parse limit and offset from query params
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-	requests, err := d.DB.Queries.GetEntityQueue(r.Context(), entityID, statusPtr, limit, offset)
+	includeSnoozed := r.URL.Query().Get("includeSnoozed") == "true"
+
+	requests, err := d.requestService().EntityQueue(r.Context(), entityID, statusPtr, includeSnoozed, limit, offset)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "query_failed", err.Error(), d.Log)
+		d.writeServiceError(w, err)
 		return
 	}
 
 	// Convert to model
 	var result []map[string]interface{}
 	for _, req := range requests {
-		result = append(result, map[string]interface{}{
+		item := map[string]interface{}{
 			"id":         req.ID,
 			"status":     req.Status,
-			"createdAt":  req.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			"deadlineAt": timePtrToString(req.DeadlineAt),
-		})
+			"createdAt":  req.CreatedAt,
+			"deadlineAt": req.DeadlineAt,
+			"deadlineDisplay": req.DeadlineDisplay,
+			"attentionAt": req.AttentionAt,
+			"attentionDisplay": req.AttentionDisplay,
+			"snoozedUntil": req.SnoozedUntil,
+		}
+		// The requests of a bundle share one entry
+		if req.Bundle != nil {
+			item["bundleId"] = req.Bundle.ID
+			item["bundle"] = req.Bundle
+		}
+		result = append(result, item)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -212,11 +358,58 @@ func (d Dependencies) entityQueue(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func timePtrToString(t *time.Time) *string {
-	if t == nil {
-		return nil
+
+func (d Dependencies) validateResponse(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var body struct {
+		Page    string                 `json:"page,omitempty"`
+		Payload map[string]interface{} `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	result, err := d.requestService().ValidatePage(r.Context(), id, body.Page, body.Payload)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
 	}
-	s := t.Format("2006-01-02T15:04:05Z07:00")
-	return &s
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
+// acceptLanguages lists the language tags of an Accept-Language header in
+// order of preference, e.g. "cs-CZ,cs;q=0.9,en;q=0.5" gives cs-CZ, cs, en.
+// Wildcards and tags with q=0 are dropped.
+func acceptLanguages(header string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if name == "" || name == "*" || q <= 0 {
+			continue
+		}
+		tags = append(tags, tag{name, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	locales := make([]string, len(tags))
+	for i, t := range tags {
+		locales[i] = t.name
+	}
+	return locales
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// acceptResponse closes an answered request as ACCEPTED
+func (d Dependencies) acceptResponse(w http.ResponseWriter, r *http.Request) {
+	version, ok := d.expectedVersion(w, r, nil)
+	if !ok {
+		return
+	}
+
+	req, err := d.requestService().AcceptResponse(r.Context(), chi.URLParam(r, "id"), version)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(req.Version))
+	json.NewEncoder(w).Encode(req)
+}
+
+// rejectResponse rejects the answer to a request, closing it as REJECTED
+// or reopening it for a corrected answer
+func (d Dependencies) rejectResponse(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		service.RejectInput
+		ExpectedVersion *int `json:"expectedVersion,omitempty"`
+	}
+	// The body is optional: a rejection without reason closes the request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	version, ok := d.expectedVersion(w, r, body.ExpectedVersion)
+	if !ok {
+		return
+	}
+
+	req, err := d.requestService().RejectResponse(r.Context(), chi.URLParam(r, "id"), body.RejectInput, version)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(req.Version))
+	json.NewEncoder(w).Encode(req)
+}
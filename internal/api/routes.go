@@ -3,11 +3,18 @@ package api
 import (
 	"net/http"
 	"os"
+	"time"
 
+	"pxbox/internal/audit"
 	"pxbox/internal/auth"
 	"pxbox/internal/db"
+	"pxbox/internal/jobs"
+	"pxbox/internal/mailin"
 	"pxbox/internal/pubsub"
+	"pxbox/internal/schema"
+	"pxbox/internal/seal"
 	"pxbox/internal/service"
+	"pxbox/internal/telegram"
 	"pxbox/internal/ws"
 
 	"github.com/go-chi/chi/v5"
@@ -15,52 +22,185 @@ import (
 )
 
 type Dependencies struct {
-	DB        *db.Pool
-	Bus       *pubsub.Bus
-	Hub       *ws.Hub
-	Log       *zap.Logger
-	JobClient service.JobClient
+	DB          *db.Pool
+	Bus         *pubsub.Bus
+	Hub         *ws.Hub
+	Log         *zap.Logger
+	JobClient   service.JobClient
+	Audit       *audit.Logger
+	Schema      *schema.Compiler  // Shared so fetched $refs and compiled schemas are reused
+	Auth        *auth.JWTConfig   // Token verification; built from JWT_SECRET when nil
+	Presence    *pubsub.Presence  // Cross-instance presence; the local hub is used when nil
+	DeadLetters *jobs.DeadLetters // Failed background tasks; the admin job endpoints return 503 when nil
+	Sealer      *seal.Sealer      // Encrypts prefills and response payloads; stored in plaintext when nil
+	LogLevel    *zap.AtomicLevel  // Level of Log, changed by /admin/loglevel; the endpoint returns 503 when nil
+	Telegram    *telegram.Bot     // Telegram bot; its webhook returns 404 when nil
+	MailIn      *mailin.Addresser // Reply addresses of requests; answering by email is off when nil
 }
 
 func Routes(d Dependencies) http.Handler {
 	r := chi.NewRouter()
 	
 	// Add request logging middleware
+	r.Use(Correlate)
 	r.Use(RequestLogger(d.Log))
 	
 	// Add JWT authentication middleware (optional - allows anonymous access)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	jwtConfig := auth.NewJWTConfig(jwtSecret)
-	r.Use(jwtConfig.Middleware)
-
-	// Request endpoints
-	r.Post("/requests", d.createRequest)
-	r.Get("/requests/{id}", d.getRequest)
-	r.Post("/requests/{id}/cancel", d.cancelRequest)
-	r.Post("/requests/{id}/claim", d.claimRequest)
-	r.Post("/requests/{id}/response", d.postResponse)
-	r.Get("/requests/{id}/response", d.getResponse)
-
-	// Entity endpoints
-	r.Post("/entities", d.createEntity)
-	r.Get("/entities/{id}", d.getEntity)
-	r.Get("/entities/{id}/queue", d.entityQueue)
-
-	// Flow endpoints
-	r.Post("/flows", d.createFlow)
-	r.Get("/flows/{id}", d.getFlow)
-	r.Post("/flows/{id}/resume", d.resumeFlow)
-	r.Post("/flows/{id}/cancel", d.cancelFlow)
-
-	// Inquiry endpoints
-	r.Get("/inquiries", d.listInquiries)
-	r.Post("/inquiries/{id}/markRead", d.markRead)
-	r.Post("/inquiries/{id}/snooze", d.snooze)
-	r.Post("/inquiries/{id}/cancel", d.cancelInquiry)
-	r.Delete("/inquiries/{id}", d.deleteInquiry)
-
-	// File endpoints
-	r.Post("/files/sign", d.signFile)
+	if d.Auth == nil {
+		d.Auth = auth.NewJWTConfig(os.Getenv("JWT_SECRET"))
+	}
+	r.Use(d.Auth.Middleware)
+	if d.Hub != nil {
+		d.Hub.SetAuthenticator(d.Auth.Authenticate)
+	}
+	r.Use(CallerContext)
+	r.Use(RequestMemo)
+
+	// File content is streamed with its own size cap from the file policy
+	r.Put("/files/*", d.uploadFile)
+	r.Get("/files/*", d.downloadFile)
+
+	// Resumable uploads (tus protocol)
+	r.Options("/files/tus", d.tusOptions)
+	r.Post("/files/tus", d.tusCreate)
+	r.Head("/files/tus/{id}", d.tusHead)
+	r.Patch("/files/tus/{id}", d.tusPatch)
+	r.Delete("/files/tus/{id}", d.tusDelete)
+
+	// Replies to request emails, authenticated per provider; an email can
+	// be larger than other bodies
+	r.With(LimitBody(maxInboundEmailBytes, d.Log)).Post("/email/inbound/{provider}", d.inboundEmail)
+
+	var shareLimiter *RateLimiter
+	if limit := shareRateLimit(); limit > 0 {
+		shareLimiter = NewRateLimiter(limit, time.Minute)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(LimitBody(maxBodyBytes(), d.Log))
+
+		// Request endpoints
+		r.Post("/requests", d.createRequest)
+		r.Post("/requests/batch", d.createRequests)
+		r.Get("/requests/search", d.searchRequests)
+		r.Get("/requests/{id}", d.getRequest)
+		r.Get("/requests/{id}/schema", d.getRequestSchema)
+		r.Patch("/requests/{id}", d.updateRequest)
+		r.Post("/requests/{id}/cancel", d.cancelRequest)
+		r.Post("/requests/{id}/claim", d.claimRequest)
+		r.Post("/requests/{id}/unclaim", d.unclaimRequest)
+		r.Patch("/requests/{id}/deadline", d.updateDeadline)
+		r.Post("/requests/{id}/response", d.postResponse)
+		r.Get("/requests/{id}/response", d.getResponse)
+		r.Post("/requests/{id}/accept", d.acceptResponse)
+		r.Post("/requests/{id}/reject", d.rejectResponse)
+		r.Post("/requests/{id}/validate", d.validateResponse)
+		r.Post("/requests/{id}/comments", d.postComment)
+		r.Get("/requests/{id}/comments", d.listComments)
+		r.Get("/requests/{id}/activity", d.getActivity)
+		r.Post("/requests/{id}/share", d.createShareLink)
+		r.Get("/requests/{id}/link", d.requestLink)
+		r.Post("/requests/{id}/link", d.shareRequestLink)
+		r.Get("/requests/{id}/reply-address", d.getReplyAddress)
+
+		// Public answer links, used without an account
+		r.With(RateLimit(shareLimiter, d.Log)).Get("/share/{token}", d.openShareLink)
+		r.With(RateLimit(shareLimiter, d.Log)).Post("/share/{token}/response", d.answerShareLink)
+
+		// Server-rendered answer form, for callers without a client app
+		r.With(RateLimit(shareLimiter, d.Log)).Get("/requests/{id}/form", d.requestForm)
+		r.With(RateLimit(shareLimiter, d.Log)).Post("/requests/{id}/form", d.submitRequestForm)
+
+		// Telegram bot updates, authenticated with the webhook secret
+		r.Post("/telegram/webhook", d.telegramWebhook)
+
+		// Bundle endpoints
+		r.Post("/bundles", d.createBundle)
+		r.Get("/bundles/{id}", d.getBundle)
+
+		// Entity endpoints
+		r.Post("/entities", d.createEntity)
+		r.Get("/entities", d.listEntities)
+		r.Get("/entities/{id}", d.getEntity)
+		r.Patch("/entities/{id}", d.updateEntity)
+		r.Get("/entities/{id}/queue", d.entityQueue)
+		r.Get("/entities/{id}/presence", d.entityPresence)
+		r.Get("/entities/{id}/tags", d.entityTags)
+		r.Get("/entities/{id}/views", d.listViews)
+		r.Post("/entities/{id}/views", d.createView)
+		r.Get("/entities/{id}/views/{viewId}", d.getView)
+		r.Put("/entities/{id}/views/{viewId}", d.updateView)
+		r.Delete("/entities/{id}/views/{viewId}", d.deleteView)
+		r.Get("/entities/{id}/preferences", d.getPreferences)
+		r.Put("/entities/{id}/preferences", d.updatePreferences)
+		r.Get("/entities/{id}/calendar", d.getBusinessCalendar)
+		r.Put("/entities/{id}/calendar", d.updateBusinessCalendar)
+		r.Get("/entities/{id}/deadlines.ics", d.deadlineFeed)
+		r.Post("/entities/{id}/deadlines.ics/token", d.createCalendarFeed)
+		r.Delete("/entities/{id}/deadlines.ics/token", d.deleteCalendarFeed)
+		r.Get("/entities/{id}/maintenance", d.listMaintenanceWindows)
+		r.Post("/entities/{id}/maintenance", d.createMaintenanceWindow)
+		r.Delete("/entities/{id}/maintenance/{windowId}", d.deleteMaintenanceWindow)
+		r.Get("/entities/{id}/devices", d.listDevices)
+		r.Post("/entities/{id}/devices", d.registerDevice)
+		r.Delete("/entities/{id}/devices/{deviceId}", d.deleteDevice)
+		r.Get("/entities/{id}/telegram", d.getTelegramLink)
+		r.Post("/entities/{id}/telegram", d.createTelegramLink)
+		r.Delete("/entities/{id}/telegram", d.deleteTelegramLink)
+		r.Get("/entities/{id}/bot-handler", d.getBotHandler)
+		r.Put("/entities/{id}/bot-handler", d.setBotHandler)
+		r.Delete("/entities/{id}/bot-handler", d.deleteBotHandler)
+
+		// Flow endpoints
+		r.Post("/flows", d.createFlow)
+		r.Get("/flows", d.listFlows)
+		r.Get("/flows/{id}", d.getFlow)
+		r.Delete("/flows/{id}", d.deleteFlow)
+		r.Post("/flows/{id}/resume", d.resumeFlow)
+		r.Post("/flows/{id}/cancel", d.cancelFlow)
+
+		// Webhook endpoints
+		r.Post("/webhooks", d.createWebhook)
+		r.Get("/webhooks", d.listWebhooks)
+		r.Get("/webhooks/{id}", d.getWebhook)
+		r.Patch("/webhooks/{id}", d.updateWebhook)
+		r.Delete("/webhooks/{id}", d.deleteWebhook)
+		r.Post("/webhooks/{id}/rotate-secret", d.rotateWebhookSecret)
+		r.Get("/webhooks/{id}/deliveries", d.listWebhookDeliveries)
+		r.Post("/webhooks/{id}/deliveries/{deliveryId}/redeliver", d.redeliverWebhook)
+
+		// Inquiry endpoints
+		r.Get("/inquiries", d.listInquiries)
+		r.Post("/inquiries/{id}/markRead", d.markRead)
+		r.Post("/inquiries/{id}/snooze", d.snooze)
+		r.Get("/inquiries/{id}/reminders", d.listReminders)
+		r.Delete("/reminders/{id}", d.deleteReminder)
+		r.Post("/inquiries/{id}/cancel", d.cancelInquiry)
+		r.Delete("/inquiries/{id}", d.deleteInquiry)
+
+		// Export endpoints
+		r.Get("/exports/requests", d.exportRequests)
+
+		// Audit endpoints (admin only)
+		r.With(RequireAdmin(d.Log)).Get("/audit", d.listAudit)
+		r.With(RequireAdmin(d.Log)).Get("/audit/verify", d.verifyAudit)
+		r.With(RequireAdmin(d.Log)).Get("/admin/storage/usage", d.storageUsage)
+		r.With(RequireAdmin(d.Log)).Get("/admin/jobs/dead", d.listDeadJobs)
+		r.With(RequireAdmin(d.Log)).Post("/admin/jobs/{id}/retry", d.retryJob)
+		r.With(RequireAdmin(d.Log)).Get("/admin/ws/stats", d.wsStats)
+		r.With(RequireAdmin(d.Log)).Get("/admin/loglevel", d.getLogLevel)
+		r.With(RequireAdmin(d.Log)).Put("/admin/loglevel", d.setLogLevel)
+		r.With(RequireAdmin(d.Log)).Post("/entities/{id}/erase", d.eraseEntity)
+		r.With(RequireAdmin(d.Log)).Post("/entities/{id}/deactivate", d.deactivateEntity)
+		r.With(RequireAdmin(d.Log)).Post("/entities/{id}/reactivate", d.reactivateEntity)
+		r.With(RequireAdmin(d.Log)).Post("/admin/entities/merge", d.mergeEntities)
+		r.With(RequireAdmin(d.Log)).Get("/erasures/{id}", d.getErasure)
+		r.With(RequireAdmin(d.Log)).Get("/stats/requests", d.requestStats)
+		r.With(RequireAdmin(d.Log)).Get("/stats/flows", d.flowStats)
+
+		// File endpoints
+		r.Post("/files/sign", d.signFile)
+	})
 
 	// WebSocket endpoint
 	r.Get("/ws", d.wsHandler)
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pxbox/internal/db"
+)
+
+func (d Dependencies) searchRequests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter, err := parseRequestFilter(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_filter", err.Error(), d.Log)
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+	sortBy := q.Get("sortBy")
+	if sortBy == "" {
+		sortBy = "created"
+	}
+
+	requests, err := d.requestService().SearchRequests(r.Context(), filter, sortBy, limit, offset)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": requests,
+	})
+}
+
+func parseRequestFilter(r *http.Request) (db.RequestFilter, error) {
+	q := r.URL.Query()
+	f := db.RequestFilter{
+		Tags:           queryList(r, "tags"),
+		AnyTags:        queryList(r, "anyTags"),
+		IncludeDeleted: q.Get("includeDeleted") == "true",
+	}
+
+	if v := q.Get("entityId"); v != "" {
+		f.EntityID = &v
+	}
+	if v := q.Get("status"); v != "" {
+		f.Status = &v
+	}
+	if v := q.Get("createdBy"); v != "" {
+		f.CreatedBy = &v
+	}
+	if v := q.Get("createdAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, err
+		}
+		f.CreatedAfter = &t
+	}
+	if v := q.Get("createdBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, err
+		}
+		f.CreatedBefore = &t
+	}
+
+	return f, nil
+}
+
+// queryList reads a comma-separated query parameter, which may also be
+// repeated
+func queryList(r *http.Request, name string) []string {
+	var values []string
+	for _, v := range r.URL.Query()[name] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
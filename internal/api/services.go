@@ -0,0 +1,102 @@
+package api
+
+import (
+	"pxbox/internal/scan"
+	"pxbox/internal/schema"
+	"pxbox/internal/service"
+	"pxbox/internal/storage"
+)
+
+// requestService builds a request service wired with the job client and
+// audit logger
+func (d Dependencies) requestService() *service.RequestService {
+	schemaComp := d.Schema
+	if schemaComp == nil {
+		schemaComp = schema.NewCompilerWithCache(64)
+	}
+	entitySvc := service.NewEntityService(d.DB.Queries)
+	requestSvc := service.NewRequestService(d.DB.Queries, schemaComp, entitySvc, d.Bus)
+	if d.JobClient != nil {
+		requestSvc.SetJobClient(d.JobClient)
+	}
+	requestSvc.SetAuditLogger(d.Audit)
+	requestSvc.SetSealer(d.Sealer)
+	requestSvc.SetStrictUIHints(service.StrictUIHintsFromEnv())
+	requestSvc.SetReplyAddresser(d.MailIn)
+	if ttl, err := service.ClaimTTLFromEnv(); err == nil {
+		requestSvc.SetClaimTTL(ttl)
+	}
+	if quotas, err := service.QuotasFromEnv(); err == nil {
+		requestSvc.SetQuotas(quotas)
+	}
+	if limits, err := schema.ResponseLimitsFromEnv(); err == nil {
+		requestSvc.SetResponseLimits(limits)
+	}
+	if stor, err := storage.NewFromEnv(); err == nil {
+		if resolver, ok := stor.(storage.URLResolver); ok {
+			requestSvc.SetFileResolver(resolver)
+			requestSvc.SetFileStorage(stor)
+			requestSvc.SetFileScanEnforcement(scan.EnforcementFromEnv())
+		}
+	}
+	return requestSvc
+}
+
+// entityService builds an entity service that announces and audits entity
+// changes
+func (d Dependencies) entityService() *service.EntityService {
+	entitySvc := service.NewEntityService(d.DB.Queries)
+	if d.Bus != nil {
+		entitySvc.SetEventBus(d.Bus)
+	}
+	entitySvc.SetAuditLogger(d.Audit)
+	return entitySvc
+}
+
+// flowService builds a flow service on top of requestService
+func (d Dependencies) flowService() *service.FlowService {
+	flowSvc := service.NewFlowService(d.DB.Queries, d.Bus, d.requestService())
+	flowSvc.SetAuditLogger(d.Audit)
+	return flowSvc
+}
+
+// fileService builds a file service on the configured storage backend
+func (d Dependencies) fileService() (*service.FileService, error) {
+	stor, err := storage.NewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	fileSvc := service.NewFileService(d.DB.Queries, stor, d.Bus)
+	if d.JobClient != nil {
+		fileSvc.SetJobClient(d.JobClient)
+	}
+	return fileSvc, nil
+}
+
+// erasureService builds an erasure service that records and enqueues
+// erasures; they run in the job server
+func (d Dependencies) erasureService() *service.ErasureService {
+	erasureSvc := service.NewErasureService(d.DB.Queries, d.Bus, d.Log)
+	if d.JobClient != nil {
+		erasureSvc.SetJobClient(d.JobClient)
+	}
+	erasureSvc.SetAuditLogger(d.Audit)
+	return erasureSvc
+}
+
+// webhookService builds a webhook service that audits webhook changes and
+// enqueues redeliveries
+func (d Dependencies) webhookService() *service.WebhookService {
+	webhookSvc := service.NewWebhookService(d.DB.Queries, d.Log)
+	if d.JobClient != nil {
+		webhookSvc.SetJobClient(d.JobClient)
+	}
+	webhookSvc.SetAuditLogger(d.Audit)
+	return webhookSvc
+}
+
+// statsService builds a stats service reading the materialized views when
+// STATS_MATERIALIZED is set
+func (d Dependencies) statsService() *service.StatsService {
+	return service.NewStatsService(d.DB.Queries, service.StatsMaterializedFromEnv())
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// publicBaseURL is where the API is reached from outside, including the
+// API prefix, from PUBLIC_BASE_URL
+func publicBaseURL() string {
+	if v := os.Getenv("PUBLIC_BASE_URL"); v != "" {
+		return strings.TrimSuffix(v, "/")
+	}
+	return "http://localhost:8080/v1"
+}
+
+type ShareRequest struct {
+	TTL string `json:"ttl,omitempty"` // e.g. "72h"
+}
+
+// shareTTL reads the lifetime of a new share link from an optional
+// ShareRequest body, writing the error if it is invalid
+func (d Dependencies) shareTTL(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	var req ShareRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+			return 0, false
+		}
+	}
+	if req.TTL == "" {
+		return 0, true
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_ttl", "ttl must be a duration such as 72h", d.Log)
+		return 0, false
+	}
+	return ttl, true
+}
+
+// createShareLink creates a public answer link for a request
+func (d Dependencies) createShareLink(w http.ResponseWriter, r *http.Request) {
+	ttl, ok := d.shareTTL(w, r)
+	if !ok {
+		return
+	}
+
+	link, err := d.requestService().CreateShareLink(r.Context(), chi.URLParam(r, "id"), ttl)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        link.ID,
+		"requestId": link.RequestID,
+		"token":     link.Token,
+		"url":       publicBaseURL() + "/share/" + link.Token,
+		"formUrl":   publicBaseURL() + "/requests/" + link.RequestID + "/form?token=" + link.Token,
+		"expiresAt": link.ExpiresAt,
+	})
+}
+
+// openShareLink returns what an external party needs to answer a shared
+// request. Requestor-side details such as callbacks and tags are left out.
+func (d Dependencies) openShareLink(w http.ResponseWriter, r *http.Request) {
+	locales := acceptLanguages(r.Header.Get("Accept-Language"))
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		locales = append([]string{locale}, locales...)
+	}
+
+	req, err := d.requestService().OpenShareLink(r.Context(), chi.URLParam(r, "token"), locales)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":              req.ID,
+		"status":          req.Status,
+		"schemaKind":      req.SchemaKind,
+		"schemaPayload":   req.SchemaPayload,
+		"uiHints":         req.UIHints,
+		"prefill":         req.Prefill,
+		"filesPolicy":     req.FilesPolicy,
+		"attachments":     req.Attachments,
+		"deadlineAt":      req.DeadlineAt,
+		"deadlineDisplay": req.DeadlineDisplay,
+		"expiresAt":       req.ExpiresAt,
+		"locale":          req.Locale,
+	})
+}
+
+type ShareResponseRequest struct {
+	Payload    map[string]interface{}   `json:"payload"`
+	Files      []map[string]interface{} `json:"files,omitempty"`
+	Respondent service.Respondent       `json:"respondent"`
+}
+
+// answerShareLink answers a shared request and uses up its link
+func (d Dependencies) answerShareLink(w http.ResponseWriter, r *http.Request) {
+	var body ShareResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	resp, err := d.requestService().AnswerShareLink(r.Context(), chi.URLParam(r, "token"), body.Respondent, body.Payload, body.Files)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"responseId": resp.ID,
+		"status":     "ANSWERED",
+	})
+}
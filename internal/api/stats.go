@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/service"
+)
+
+// statsFilter reads the from, to and entityId query parameters of the
+// stats endpoints
+func statsFilter(r *http.Request) (db.StatsFilter, error) {
+	q := r.URL.Query()
+	f, err := service.StatsRange(q.Get("from"), q.Get("to"), time.Now())
+	if err != nil {
+		return f, err
+	}
+	if v := q.Get("entityId"); v != "" {
+		f.EntityID = &v
+	}
+	return f, nil
+}
+
+// requestStats counts requests by status, day, entity and schema kind
+func (d Dependencies) requestStats(w http.ResponseWriter, r *http.Request) {
+	f, err := statsFilter(r)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	stats, err := d.statsService().RequestStats(r.Context(), f)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// flowStats reports completion rates and durations of flows by kind
+func (d Dependencies) flowStats(w http.ResponseWriter, r *http.Request) {
+	f, err := statsFilter(r)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	stats, err := d.statsService().FlowStats(r.Context(), f)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
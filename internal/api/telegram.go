@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"pxbox/internal/service"
+	"pxbox/internal/telegram"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// maxCallbackText is the longest text Telegram shows for a button press
+const maxCallbackText = 200
+
+func (d Dependencies) createTelegramLink(w http.ResponseWriter, r *http.Request) {
+	link, err := d.entityService().CreateTelegramLink(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+	if d.Telegram != nil {
+		link.URL = d.Telegram.StartURL(link.Code)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+func (d Dependencies) getTelegramLink(w http.ResponseWriter, r *http.Request) {
+	link, err := d.entityService().GetTelegramLink(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+func (d Dependencies) deleteTelegramLink(w http.ResponseWriter, r *http.Request) {
+	if err := d.entityService().DeleteTelegramLink(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// telegramWebhook receives the updates of the Telegram bot: "/start <code>"
+// messages that link a chat, and presses of answer buttons. Telegram
+// retries updates that are not acknowledged with 200, so failures are
+// reported in the chat instead.
+func (d Dependencies) telegramWebhook(w http.ResponseWriter, r *http.Request) {
+	if d.Telegram == nil {
+		WriteError(w, http.StatusNotFound, "not_found", "Telegram is not configured", d.Log)
+		return
+	}
+	if !d.Telegram.VerifyWebhook(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")) {
+		WriteError(w, http.StatusUnauthorized, "unauthorized", "Invalid webhook secret", d.Log)
+		return
+	}
+	var update telegram.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid update", d.Log)
+		return
+	}
+
+	ctx := r.Context()
+	var err error
+	switch {
+	case update.CallbackQuery != nil:
+		err = d.telegramAnswer(ctx, update.CallbackQuery)
+	case update.Message != nil:
+		err = d.telegramStart(ctx, update.Message)
+	}
+	if err != nil {
+		d.Log.Warn("Failed to handle Telegram update", zap.Int64("update_id", update.UpdateID), zap.Error(err))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// telegramStart links the chat of a "/start <code>" message
+func (d Dependencies) telegramStart(ctx context.Context, m *telegram.Message) error {
+	code, ok := m.StartPayload()
+	if !ok {
+		return nil
+	}
+	if code == "" {
+		return d.Telegram.SendMessage(ctx, m.Chat.ID, "To get your requests here, open the link pxbox gives you when you connect Telegram.", nil)
+	}
+	if _, err := d.entityService().LinkTelegramChat(ctx, code, m.Chat.ID); err != nil {
+		text := "This link is invalid or expired. Ask pxbox for a new one."
+		if service.Classify(err).Kind != service.ErrNotFound {
+			text = "Linking failed, please try again later."
+		}
+		return errors.Join(err, d.Telegram.SendMessage(ctx, m.Chat.ID, text, nil))
+	}
+	return d.Telegram.SendMessage(ctx, m.Chat.ID, "Linked. New requests will appear here.", nil)
+}
+
+// telegramAnswer answers a request with the pressed button and replaces
+// the buttons with the answer
+func (d Dependencies) telegramAnswer(ctx context.Context, q *telegram.CallbackQuery) error {
+	requestID, i, ok := telegram.ParseAnswerData(q.Data)
+	if !ok || q.Message == nil {
+		return d.Telegram.AnswerCallback(ctx, q.ID, "", false)
+	}
+	label, err := d.requestService().AnswerFromTelegram(ctx, q.Message.Chat.ID, requestID, i)
+	if err != nil {
+		e := service.Classify(err)
+		if e.Kind == nil || e.Kind == service.ErrUnavailable {
+			return errors.Join(err, d.Telegram.AnswerCallback(ctx, q.ID, "Answering failed, please try again later.", true))
+		}
+		text := []rune(e.Message)
+		if len(text) > maxCallbackText {
+			text = text[:maxCallbackText]
+		}
+		return d.Telegram.AnswerCallback(ctx, q.ID, string(text), true)
+	}
+	if err := d.Telegram.AnswerCallback(ctx, q.ID, "Answered: "+label, false); err != nil {
+		return err
+	}
+	return d.Telegram.EditMessage(ctx, q.Message.Chat.ID, q.Message.MessageID, q.Message.Text+"\n\nAnswered: "+label)
+}
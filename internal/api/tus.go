@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// tusVersion is the tus protocol version implemented by the upload endpoints
+const tusVersion = "1.0.0"
+
+// tusHeaders sets the headers every tus response carries
+func tusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// uploadExpires announces when an upload will be garbage-collected
+func uploadExpires(w http.ResponseWriter, upload *service.ResumableUpload) {
+	if upload.ExpiresAt != nil {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkTusVersion rejects requests for a protocol version we do not speak
+func (d Dependencies) checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		WriteError(w, http.StatusPreconditionFailed, "unsupported_version", "Tus-Resumable "+tusVersion+" required", d.Log)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated keys,
+// each followed by an optional space and base64 value
+func parseTusMetadata(header string) (map[string]string, bool) {
+	meta := make(map[string]string)
+	if header == "" {
+		return meta, true
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, false
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, false
+		}
+		meta[key] = string(decoded)
+	}
+	return meta, true
+}
+
+func (d Dependencies) tusOptions(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,expiration,termination")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(service.MaxUploadBytesFromEnv(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusCreate starts an upload. The "filename" metadata is required;
+// "filetype" and "requestId" are optional.
+func (d Dependencies) tusCreate(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	if !d.checkTusVersion(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Upload-Length header required", d.Log)
+		return
+	}
+	meta, ok := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if !ok {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid Upload-Metadata header", d.Log)
+		return
+	}
+
+	fileSvc, err := d.fileService()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
+	}
+
+	upload, err := fileSvc.CreateUpload(r.Context(), service.CreateUploadInput{
+		Name:        meta["filename"],
+		ContentType: meta["filetype"],
+		RequestID:   meta["requestId"],
+		CreatedBy:   auth.Actor(r.Context()),
+		Length:      length,
+	})
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	uploadExpires(w, upload)
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (d Dependencies) tusHead(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	if !d.checkTusVersion(w, r) {
+		return
+	}
+
+	fileSvc, err := d.fileService()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
+	}
+
+	upload, err := fileSvc.GetUpload(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	uploadExpires(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (d Dependencies) tusPatch(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	if !d.checkTusVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		WriteError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/offset+octet-stream", d.Log)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Upload-Offset header required", d.Log)
+		return
+	}
+
+	fileSvc, err := d.fileService()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
+	}
+
+	// The chunk's type is unknown; the file's type comes from its metadata
+	// and the sniffed first chunk
+	upload, err := fileSvc.WriteChunk(r.Context(), chi.URLParam(r, "id"), offset, "", r.Body)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	uploadExpires(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d Dependencies) tusDelete(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	if !d.checkTusVersion(w, r) {
+		return
+	}
+
+	fileSvc, err := d.fileService()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "storage_init_failed", "Storage initialization failed", d.Log)
+		return
+	}
+
+	if err := fileSvc.TerminateUpload(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SavedViewRequest struct {
+	Name   string           `json:"name"`
+	Filter model.ViewFilter `json:"filter"`
+}
+
+func (d Dependencies) listViews(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+
+	views, err := service.NewEntityService(d.DB.Queries).ListViews(r.Context(), entityID)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": views,
+	})
+}
+
+func (d Dependencies) createView(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+
+	var req SavedViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	view, err := service.NewEntityService(d.DB.Queries).CreateView(r.Context(), entityID, req.Name, req.Filter)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+func (d Dependencies) getView(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+	viewID := chi.URLParam(r, "viewId")
+
+	view, err := service.NewEntityService(d.DB.Queries).GetView(r.Context(), entityID, viewID)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+func (d Dependencies) updateView(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+	viewID := chi.URLParam(r, "viewId")
+
+	var req SavedViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	view, err := service.NewEntityService(d.DB.Queries).UpdateView(r.Context(), entityID, viewID, req.Name, req.Filter)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+func (d Dependencies) deleteView(w http.ResponseWriter, r *http.Request) {
+	entityID := chi.URLParam(r, "id")
+	viewID := chi.URLParam(r, "viewId")
+
+	if err := service.NewEntityService(d.DB.Queries).DeleteView(r.Context(), entityID, viewID); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pxbox/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RotateSecretRequest sets how long the previous secret keeps signing
+// deliveries after a rotation, e.g. "24h" (the default)
+type RotateSecretRequest struct {
+	Grace string `json:"grace,omitempty"`
+}
+
+// createWebhook subscribes a URL to events. The response carries the
+// signing secret, which is not returned again.
+func (d Dependencies) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var input service.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	webhook, err := d.webhookService().CreateWebhook(r.Context(), input)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (d Dependencies) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := d.webhookService().ListWebhooks(r.Context(), r.URL.Query().Get("entityId"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": hooks,
+		"total": len(hooks),
+	})
+}
+
+func (d Dependencies) getWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := d.webhookService().GetWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (d Dependencies) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	var update service.WebhookUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+		return
+	}
+
+	webhook, err := d.webhookService().UpdateWebhook(r.Context(), chi.URLParam(r, "id"), update)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (d Dependencies) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := d.webhookService().DeleteWebhook(r.Context(), chi.URLParam(r, "id")); err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotateWebhookSecret replaces the signing secret of a webhook. The
+// response carries the new secret.
+func (d Dependencies) rotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	var req RotateSecretRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_request", "Invalid request body", d.Log)
+			return
+		}
+	}
+	grace := 24 * time.Hour
+	if req.Grace != "" {
+		parsed, err := time.ParseDuration(req.Grace)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_grace", "grace must be a duration such as 24h", d.Log)
+			return
+		}
+		grace = parsed
+	}
+
+	webhook, err := d.webhookService().RotateWebhookSecret(r.Context(), chi.URLParam(r, "id"), grace)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (d Dependencies) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	offset := 0
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	deliveries, err := d.webhookService().ListDeliveries(r.Context(), chi.URLParam(r, "id"), q.Get("status"), limit, offset)
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": deliveries,
+		"total": len(deliveries),
+	})
+}
+
+// redeliverWebhook posts a logged delivery again
+func (d Dependencies) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	delivery, err := d.webhookService().Redeliver(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		d.writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
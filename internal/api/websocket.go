@@ -1,13 +1,16 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"pxbox/internal/auth"
 	"pxbox/internal/ws"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
@@ -17,6 +20,26 @@ var upgrader = websocket.Upgrader{
 		// TODO: Implement proper origin checking
 		return true
 	},
+	// msgpack switches the connection to MessagePack frames. "jwt" is echoed
+	// so browsers passing the token alongside the "jwt" subprotocol accept
+	// the handshake.
+	Subprotocols: []string{ws.SubprotocolMsgpack, "jwt"},
+	// permessage-deflate, used for frames of 1 KiB or more
+	EnableCompression: true,
+}
+
+// wsAuthRequired reports whether WebSocket connections must present a valid
+// token. WS_AUTH is "required" or "optional"; it defaults to required with
+// ENV=production.
+func wsAuthRequired() bool {
+	switch os.Getenv("WS_AUTH") {
+	case "required":
+		return true
+	case "optional":
+		return false
+	default:
+		return os.Getenv("ENV") == "production"
+	}
 }
 
 func (d Dependencies) wsHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,8 +56,26 @@ func (d Dependencies) wsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract user ID from JWT token or header
-	userID := extractUserIDFromRequest(r, d.Log)
+	// Authenticate before upgrading, so rejected callers get a plain 401
+	principal, err := d.authenticateWS(r)
+	required := wsAuthRequired()
+	if err != nil && required {
+		WriteError(w, http.StatusUnauthorized, "unauthorized", "Valid token required", d.Log)
+		return
+	}
+
+	userID := ""
+	var expiresAt time.Time
+	if principal != nil {
+		userID = principal.ID()
+		expiresAt = principal.ExpiresAt
+	} else if !required {
+		// Development fallback without a token
+		userID = r.Header.Get("X-Entity-ID")
+		if userID == "" {
+			userID = r.URL.Query().Get("X-Entity-ID")
+		}
+	}
 	if userID == "" {
 		userID = "anonymous"
 	}
@@ -49,56 +90,46 @@ func (d Dependencies) wsHandler(w http.ResponseWriter, r *http.Request) {
 	d.Log.Info("WebSocket connection upgraded successfully")
 
 	wsConn := ws.NewConn(conn, d.Hub, userID)
+	wsConn.SetExpiry(expiresAt)
+	wsConn.SetAdmin(principal != nil && principal.Admin)
 	d.Hub.Register(wsConn)
 
 	go wsConn.WritePump()
 	go wsConn.ReadPump()
 }
 
-func extractUserIDFromRequest(r *http.Request, log *zap.Logger) string {
-	// Try JWT subprotocol first
-	if subprotocols := websocket.Subprotocols(r); len(subprotocols) > 0 {
-		for _, subprotocol := range subprotocols {
-			if subprotocol == "jwt" {
-				// Extract token from query parameter or header
-				tokenString := r.URL.Query().Get("token")
-				if tokenString == "" {
-					tokenString = r.Header.Get("Authorization")
-					if strings.HasPrefix(tokenString, "Bearer ") {
-						tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-					}
-				}
-				
-				if tokenString != "" {
-					jwtSecret := os.Getenv("JWT_SECRET")
-					if jwtSecret == "" {
-						jwtSecret = "default-secret-key-change-in-production"
-					}
-					
-					token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-						return []byte(jwtSecret), nil
-					})
-					
-					if err == nil && token.Valid {
-						if claims, ok := token.Claims.(jwt.MapClaims); ok {
-							if entityID, ok := claims["entity_id"].(string); ok && entityID != "" {
-								return entityID
-							}
-							if userID, ok := claims["sub"].(string); ok && userID != "" {
-								return userID
-							}
-						}
-					}
-				}
-			}
-		}
+// errNoToken is returned by authenticateWS when the caller sent no token
+var errNoToken = errors.New("no token")
+
+// authenticateWS verifies the token from the "token" query parameter or
+// the Authorization header
+func (d Dependencies) authenticateWS(r *http.Request) (*auth.Principal, error) {
+	tokenString := r.URL.Query().Get("token")
+	if tokenString == "" {
+		tokenString = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if tokenString == "" {
+		return nil, errNoToken
+	}
+
+	p, err := d.Auth.Authenticate(r.Context(), tokenString)
+	if err != nil {
+		d.Log.Debug("WebSocket token rejected", zap.Error(err))
+		return nil, err
 	}
-	
-	// Fallback to X-Entity-ID header (for development)
-	if entityID := r.Header.Get("X-Entity-ID"); entityID != "" {
-		return entityID
+	if p.ID() == "" {
+		return nil, errors.New("token does not identify a caller")
 	}
-	
-	return ""
+	return p, nil
 }
 
+// wsStats reports the hub's delivery counters
+func (d Dependencies) wsStats(w http.ResponseWriter, r *http.Request) {
+	if d.Hub == nil {
+		WriteError(w, http.StatusServiceUnavailable, "ws_unavailable", "WebSocket hub not initialized", d.Log)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.Hub.Stats())
+}
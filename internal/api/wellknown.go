@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+
+	"pxbox/internal/model"
+	"pxbox/internal/scan"
+	"pxbox/internal/schema"
+	"pxbox/internal/service"
+	"pxbox/internal/ws"
+)
+
+// defaultMaxBodyBytes caps REST request bodies unless MAX_BODY_BYTES is set
+const defaultMaxBodyBytes = 1 << 20
+
+// maxBodyBytes returns the REST request body limit from MAX_BODY_BYTES
+func maxBodyBytes() int64 {
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxBodyBytes
+}
+
+// Capabilities describes what this server supports, so clients can adapt
+// instead of hardcoding assumptions
+type Capabilities struct {
+	Service     string          `json:"service"`
+	APIVersions []string        `json:"apiVersions"`
+	Schema      SchemaSupport   `json:"schema"`
+	WebSocket   WebSocketInfo   `json:"websocket"`
+	Limits      Limits          `json:"limits"`
+	Features    []string        `json:"features"`
+	Flags       map[string]bool `json:"flags"`
+	Auth        []string        `json:"auth"`
+}
+
+// SchemaSupport lists the accepted schema kinds and JSON Schema drafts
+type SchemaSupport struct {
+	Kinds        []model.SchemaKind `json:"kinds"`
+	Drafts       []string           `json:"drafts"`
+	DefaultDraft string             `json:"defaultDraft"`
+}
+
+// WebSocketInfo describes the WebSocket endpoint
+type WebSocketInfo struct {
+	Path             string   `json:"path"`
+	ProtocolVersions []string `json:"protocolVersions"`
+	Auth             []string `json:"auth"`
+	Encodings        []string `json:"encodings"`   // Message encodings; all but json are negotiated as subprotocols
+	Compression      bool     `json:"compression"` // permessage-deflate is accepted
+}
+
+// Limits are the size limits enforced by the server, in bytes
+type Limits struct {
+	MaxBodyBytes      int64 `json:"maxBodyBytes"`
+	MaxWSMessageBytes int64 `json:"maxWsMessageBytes"`
+	MaxUploadBytes    int64 `json:"maxUploadBytes"`
+}
+
+// capabilities reports the server's current configuration
+func (d Dependencies) capabilities() Capabilities {
+	maxWS := int64(ws.DefaultMaxMessageSize)
+	if d.Hub != nil {
+		maxWS = d.Hub.MaxMessageSize()
+	}
+
+	wsAuth := []string{"jwt-subprotocol", "reauth"}
+	if !wsAuthRequired() {
+		wsAuth = append(wsAuth, "entity-header")
+	}
+	restAuth := []string{"bearer-jwt", "entity-header", "anonymous"}
+	if d.Auth != nil && d.Auth.OIDC != nil {
+		restAuth = append(restAuth, "oidc")
+	}
+
+	return Capabilities{
+		Service:     "pxbox",
+		APIVersions: []string{"v1"},
+		Schema: SchemaSupport{
+			Kinds:        []model.SchemaKind{model.SchemaKindJSON, model.SchemaKindExample, model.SchemaKindRef},
+			Drafts:       schema.Drafts,
+			DefaultDraft: schema.Drafts[0],
+		},
+		WebSocket: WebSocketInfo{
+			Path:             "/v1/ws",
+			ProtocolVersions: ws.ProtocolVersions,
+			Auth:             wsAuth,
+			Encodings:        ws.Encodings,
+			Compression:      true,
+		},
+		Limits: Limits{
+			MaxBodyBytes:      maxBodyBytes(),
+			MaxWSMessageBytes: maxWS,
+			MaxUploadBytes:    service.MaxUploadBytesFromEnv(),
+		},
+		Features: []string{
+			"flows",
+			"exports",
+			"audit",
+			"audit-chain",
+			"callbacks",
+			"field-projection",
+			"optimistic-concurrency",
+			"sandbox",
+			"wizard-pages",
+			"file-upload-proxy",
+			"tus",
+			"presence",
+			"comments",
+			"tags",
+			"saved-views",
+		},
+		Flags: map[string]bool{
+			"requireIfMatch":  os.Getenv("REQUIRE_IF_MATCH") == "true",
+			"schemaRefStrict": os.Getenv("SCHEMA_REF_STRICT") == "true",
+			"jobs":            d.JobClient != nil,
+			"fileScan":        scan.Enabled() && d.JobClient != nil,
+			"wsAuthRequired":  wsAuthRequired(),
+		},
+		Auth: restAuth,
+	}
+}
+
+func (d Dependencies) wellKnown(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(d.capabilities())
+}
+
+// WellKnownHandler serves the capabilities document at /.well-known/pxbox,
+// outside the versioned API
+func WellKnownHandler(d Dependencies) http.HandlerFunc {
+	return d.wellKnown
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+
+	"go.uber.org/zap"
+)
+
+// Resource types recorded in the audit log
+const (
+	ResourceRequest = "request"
+	ResourceFlow    = "flow"
+	ResourceEntity  = "entity"
+	ResourceWebhook = "webhook"
+	ResourceBundle  = "bundle"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate     = "create"
+	ActionClaim      = "claim"
+	ActionUnclaim    = "unclaim"
+	ActionAnswer     = "answer"
+	ActionCancel     = "cancel"
+	ActionDelete     = "delete"
+	ActionExpire     = "expire"
+	ActionResume     = "resume"
+	ActionSuspend    = "suspend"
+	ActionComplete   = "complete"
+	ActionFail       = "fail"
+	ActionPurge      = "purge"
+	ActionComment    = "comment"
+	ActionTag        = "tag"
+	ActionDeadline   = "deadline"
+	ActionErase      = "erase"
+	ActionUpdate     = "update"
+	ActionDeactivate = "deactivate"
+	ActionReactivate = "reactivate"
+	ActionMerge      = "merge"
+	ActionRotate     = "rotate"
+	ActionShare      = "share"
+	ActionArchive    = "archive"
+	ActionAccept     = "accept"
+	ActionReject     = "reject"
+)
+
+// SystemActor is recorded for actions performed by background jobs
+const SystemActor = "system"
+
+type contextKey string
+
+const actorKey contextKey = "auditActor"
+
+// WithActor returns a context whose audit entries are attributed to actor,
+// overriding the caller identity. Used by background processing.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Entry describes a state-changing action
+type Entry struct {
+	Actor        string // Defaults to the actor or caller identity from context
+	Action       string
+	ResourceType string
+	ResourceID   string
+	BeforeStatus string
+	AfterStatus  string
+	Meta         map[string]interface{}
+}
+
+// Logger appends entries to the audit log
+type Logger struct {
+	queries *db.Queries
+	log     *zap.Logger
+}
+
+// NewLogger creates a new audit logger
+func NewLogger(queries *db.Queries, log *zap.Logger) *Logger {
+	return &Logger{queries: queries, log: log}
+}
+
+// Record appends an entry to the audit log. Failures are logged rather than
+// returned so auditing never blocks the action being audited. A nil Logger
+// is a no-op.
+func (l *Logger) Record(ctx context.Context, e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Actor == "" {
+		if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+			e.Actor = actor
+		} else {
+			e.Actor = auth.Actor(ctx)
+		}
+	}
+
+	err := appendEntry(ctx, l.queries, db.InsertAuditEntryParams{
+		Actor:        e.Actor,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		BeforeStatus: optional(e.BeforeStatus),
+		AfterStatus:  optional(e.AfterStatus),
+		IP:           optional(auth.GetClientIP(ctx)),
+		Meta:         e.Meta,
+	})
+	if err != nil {
+		l.log.Error("Failed to record audit entry",
+			zap.String("action", e.Action),
+			zap.String("resourceType", e.ResourceType),
+			zap.String("resourceId", e.ResourceID),
+			zap.Error(err),
+		)
+	}
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,252 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// chainedFields is the canonical form of an entry covered by its hash
+type chainedFields struct {
+	PrevHash     string      `json:"prevHash"`
+	OccurredAt   string      `json:"occurredAt"`
+	Actor        string      `json:"actor"`
+	Action       string      `json:"action"`
+	ResourceType string      `json:"resourceType"`
+	ResourceID   string      `json:"resourceId"`
+	BeforeStatus *string     `json:"beforeStatus"`
+	AfterStatus  *string     `json:"afterStatus"`
+	IP           *string     `json:"ip"`
+	Meta         interface{} `json:"meta"`
+}
+
+// Hash computes the chain hash of an entry given the hash of its
+// predecessor ("" for the first entry in the chain)
+func Hash(prevHash string, e db.AuditEntry) (string, error) {
+	// Round-trip meta through JSON so values hash the same before insert as
+	// after being read back from JSONB
+	var meta interface{} = map[string]interface{}{}
+	if e.Meta != nil {
+		raw, err := json.Marshal(e.Meta)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal meta: %w", err)
+		}
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return "", fmt.Errorf("failed to normalize meta: %w", err)
+		}
+	}
+
+	raw, err := json.Marshal(chainedFields{
+		PrevHash:     prevHash,
+		OccurredAt:   e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		Actor:        e.Actor,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		BeforeStatus: e.BeforeStatus,
+		AfterStatus:  e.AfterStatus,
+		IP:           e.IP,
+		Meta:         meta,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// appendEntry chains and inserts an entry. Appends are serialized with a
+// transaction-scoped lock so concurrent writers (API and worker) agree on
+// the predecessor.
+func appendEntry(ctx context.Context, queries *db.Queries, params db.InsertAuditEntryParams) error {
+	return queries.InTx(ctx, func(q db.Querier) error {
+		if err := q.LockAuditChain(ctx); err != nil {
+			return fmt.Errorf("failed to lock audit chain: %w", err)
+		}
+
+		prevHash := ""
+		head, err := q.GetAuditChainHead(ctx)
+		switch {
+		case err == nil:
+			prevHash = *head.Hash
+			params.PrevHash = head.Hash
+		case !errors.Is(err, pgx.ErrNoRows):
+			return fmt.Errorf("failed to read audit chain head: %w", err)
+		}
+
+		// Postgres stores microseconds; truncate so the hash matches what is
+		// read back
+		params.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+		params.Hash, err = Hash(prevHash, db.AuditEntry{
+			OccurredAt:   params.OccurredAt,
+			Actor:        params.Actor,
+			Action:       params.Action,
+			ResourceType: params.ResourceType,
+			ResourceID:   params.ResourceID,
+			BeforeStatus: params.BeforeStatus,
+			AfterStatus:  params.AfterStatus,
+			IP:           params.IP,
+			Meta:         params.Meta,
+		})
+		if err != nil {
+			return err
+		}
+
+		return q.InsertAuditEntry(ctx, params)
+	})
+}
+
+// VerifyResult reports the outcome of a chain verification
+type VerifyResult struct {
+	Valid          bool   `json:"valid"`
+	Checked        int    `json:"checked"`
+	Unchained      int    `json:"unchained"`
+	HeadID         int64  `json:"headId,omitempty"`
+	HeadHash       string `json:"headHash,omitempty"`
+	AnchorsChecked int    `json:"anchorsChecked"`
+	FirstInvalidID int64  `json:"firstInvalidId,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// chainVerifier checks entries in id order, carrying state across batches.
+// It remembers the verified hashes of anchored entries only.
+type chainVerifier struct {
+	result   VerifyResult
+	prevHash string
+	started  bool
+	hashes   map[int64]string
+}
+
+func newChainVerifier(anchors []db.AuditAnchor) *chainVerifier {
+	v := &chainVerifier{result: VerifyResult{Valid: true}, hashes: make(map[int64]string)}
+	for _, a := range anchors {
+		v.hashes[a.EntryID] = ""
+	}
+	return v
+}
+
+func (v *chainVerifier) fail(id int64, reason string) {
+	v.result.Valid = false
+	v.result.FirstInvalidID = id
+	v.result.Reason = reason
+}
+
+// check verifies the next entry and reports whether verification can go on
+func (v *chainVerifier) check(e db.AuditEntry) bool {
+	if e.Hash == nil {
+		// Entries written before chaining was enabled precede the chain
+		if v.started {
+			v.fail(e.ID, "entry is missing its hash")
+			return false
+		}
+		v.result.Unchained++
+		return true
+	}
+	v.started = true
+
+	prev := ""
+	if e.PrevHash != nil {
+		prev = *e.PrevHash
+	}
+	if prev != v.prevHash {
+		v.fail(e.ID, "previous hash does not match the preceding entry")
+		return false
+	}
+
+	want, err := Hash(prev, e)
+	if err != nil {
+		v.fail(e.ID, err.Error())
+		return false
+	}
+	if want != *e.Hash {
+		v.fail(e.ID, "entry hash does not match its contents")
+		return false
+	}
+
+	v.prevHash = want
+	if _, ok := v.hashes[e.ID]; ok {
+		v.hashes[e.ID] = want
+	}
+	v.result.Checked++
+	v.result.HeadID = e.ID
+	v.result.HeadHash = want
+	return true
+}
+
+// Verify walks the whole audit chain, recomputing every hash, and checks
+// that each recorded anchor matches the chain. If stor is non-nil, the
+// anchor copies kept in storage are compared as well.
+func Verify(ctx context.Context, queries *db.Queries, stor storage.Storage, batchSize int) (VerifyResult, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	// Anchors are loaded first so every one refers to an entry the walk
+	// below will see
+	anchors, err := queries.ListAuditAnchors(ctx)
+	if err != nil {
+		return VerifyResult{}, fmt.Errorf("failed to list audit anchors: %w", err)
+	}
+
+	v := newChainVerifier(anchors)
+	var afterID int64
+	for {
+		entries, err := queries.ListAuditChain(ctx, afterID, batchSize)
+		if err != nil {
+			return VerifyResult{}, fmt.Errorf("failed to list audit entries: %w", err)
+		}
+		for _, e := range entries {
+			if !v.check(e) {
+				return v.result, nil
+			}
+			afterID = e.ID
+		}
+		if len(entries) < batchSize {
+			break
+		}
+	}
+
+	for _, a := range anchors {
+		if v.hashes[a.EntryID] != a.Hash {
+			v.fail(a.EntryID, fmt.Sprintf("anchor %d does not match the chain", a.ID))
+			return v.result, nil
+		}
+		if stor != nil && a.Location != nil {
+			stored, err := readAnchor(ctx, stor, *a.Location)
+			if err != nil {
+				return VerifyResult{}, err
+			}
+			if stored.EntryID != a.EntryID || stored.Hash != a.Hash {
+				v.fail(a.EntryID, fmt.Sprintf("anchor %d does not match its stored copy", a.ID))
+				return v.result, nil
+			}
+		}
+		v.result.AnchorsChecked++
+	}
+
+	return v.result, nil
+}
+
+func readAnchor(ctx context.Context, stor storage.Storage, location string) (anchorRecord, error) {
+	var rec anchorRecord
+	rc, err := stor.Get(ctx, location)
+	if err != nil {
+		return rec, fmt.Errorf("failed to read anchor %s: %w", location, err)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(&rec); err != nil {
+		return rec, fmt.Errorf("invalid anchor %s: %w", location, err)
+	}
+	return rec, nil
+}
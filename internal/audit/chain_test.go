@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chain(t *testing.T, n int) []db.AuditEntry {
+	t.Helper()
+	var entries []db.AuditEntry
+	prev := ""
+	for i := 0; i < n; i++ {
+		e := db.AuditEntry{
+			ID:           int64(i + 1),
+			OccurredAt:   time.Date(2024, 1, 1, 12, 0, i, 123000, time.UTC),
+			Actor:        "user-1",
+			Action:       ActionClaim,
+			ResourceType: ResourceRequest,
+			ResourceID:   "req-1",
+			Meta:         map[string]interface{}{"n": i},
+		}
+		h, err := Hash(prev, e)
+		require.NoError(t, err)
+		if prev != "" {
+			p := prev
+			e.PrevHash = &p
+		}
+		e.Hash = &h
+		prev = h
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func verify(entries []db.AuditEntry) VerifyResult {
+	v := newChainVerifier(nil)
+	for _, e := range entries {
+		if !v.check(e) {
+			break
+		}
+	}
+	return v.result
+}
+
+func TestHashNormalizesMeta(t *testing.T) {
+	e := db.AuditEntry{OccurredAt: time.Unix(0, 0), Meta: map[string]interface{}{"n": 1}}
+	h1, err := Hash("", e)
+	require.NoError(t, err)
+
+	// Values read back from JSONB decode as float64
+	e.Meta = map[string]interface{}{"n": float64(1)}
+	h2, err := Hash("", e)
+	require.NoError(t, err)
+	assert.Equal(t, h1, h2)
+
+	h3, err := Hash("other", e)
+	require.NoError(t, err)
+	assert.NotEqual(t, h1, h3)
+}
+
+func TestVerifyChain(t *testing.T) {
+	entries := chain(t, 5)
+	result := verify(entries)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 5, result.Checked)
+	assert.Equal(t, int64(5), result.HeadID)
+	assert.Equal(t, *entries[4].Hash, result.HeadHash)
+}
+
+func TestVerifyChainDetectsTampering(t *testing.T) {
+	t.Run("modified entry", func(t *testing.T) {
+		entries := chain(t, 5)
+		entries[2].Actor = "someone-else"
+		result := verify(entries)
+		assert.False(t, result.Valid)
+		assert.Equal(t, int64(3), result.FirstInvalidID)
+	})
+
+	t.Run("removed entry", func(t *testing.T) {
+		entries := chain(t, 5)
+		entries = append(entries[:2], entries[3:]...)
+		result := verify(entries)
+		assert.False(t, result.Valid)
+		assert.Equal(t, int64(4), result.FirstInvalidID)
+	})
+
+	t.Run("unhashed entry inside chain", func(t *testing.T) {
+		entries := chain(t, 3)
+		entries[1].Hash = nil
+		result := verify(entries)
+		assert.False(t, result.Valid)
+		assert.Equal(t, int64(2), result.FirstInvalidID)
+	})
+}
+
+func TestVerifyChainSkipsLegacyEntries(t *testing.T) {
+	legacy := db.AuditEntry{ID: 0, Actor: "old"}
+	result := verify(append([]db.AuditEntry{legacy}, chain(t, 2)...))
+	assert.True(t, result.Valid)
+	assert.Equal(t, 1, result.Unchained)
+	assert.Equal(t, 2, result.Checked)
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when a token names a key the JWKS does not have
+var ErrUnknownKey = errors.New("signing key not found in JWKS")
+
+const (
+	defaultJWKSTTL = time.Hour
+	// minJWKSRefresh limits refetches triggered by unknown key IDs, so forged
+	// tokens cannot make us hammer the IdP
+	minJWKSRefresh = 30 * time.Second
+	maxJWKSSize    = 1 << 20
+)
+
+// JWKS fetches and caches an identity provider's signing keys. Keys are
+// refetched when the cache expires or a token names a key ID not seen yet,
+// which picks up key rotation; if a refetch fails the previous keys are kept.
+type JWKS struct {
+	URL        string
+	TTL        time.Duration // Used when the response has no Cache-Control max-age
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	expiresAt   time.Time
+	lastFetched time.Time
+}
+
+// NewJWKS creates a key set fetched from url
+func NewJWKS(url string, ttl time.Duration) *JWKS {
+	if ttl <= 0 {
+		ttl = defaultJWKSTTL
+	}
+	return &JWKS{URL: url, TTL: ttl, HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Key returns the public key with the given ID. An empty kid matches the
+// only key of a single-key set.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	key, found := j.lookup(kid)
+	stale := now.After(j.expiresAt)
+	canRefresh := now.Sub(j.lastFetched) >= minJWKSRefresh
+	if (stale || !found) && canRefresh {
+		if err := j.refresh(ctx); err != nil && j.keys == nil {
+			return nil, err
+		}
+		key, found = j.lookup(kid)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+func (j *JWKS) url() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.URL
+}
+
+func (j *JWKS) setURL(url string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.URL = url
+}
+
+func (j *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set; the caller holds j.mu
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.lastFetched = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := j.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip key types we do not support rather than failing the set
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable signing keys")
+	}
+
+	j.keys = keys
+	j.expiresAt = j.lastFetched.Add(cacheMaxAge(resp.Header.Get("Cache-Control"), j.TTL))
+	return nil
+}
+
+// cacheMaxAge reads max-age from a Cache-Control header, falling back to def
+func cacheMaxAge(header string, def time.Duration) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return def
+}
+
+// jwk is a single JSON Web Key (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -3,8 +3,11 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -13,18 +16,162 @@ type contextKey string
 
 const userIDKey contextKey = "userID"
 const entityIDKey contextKey = "entityID"
+const clientIDKey contextKey = "clientID"
+const clientIPKey contextKey = "clientIP"
+const adminKey contextKey = "admin"
+
+// DefaultSecret is the HMAC key used when JWT_SECRET is not set. It is only
+// accepted outside production.
+const DefaultSecret = "default-secret-key-change-in-production"
+
+// ErrInsecureSecret is returned when production would run on the default key
+var ErrInsecureSecret = errors.New("JWT_SECRET must be set to a non-default value when ENV=production")
 
 // JWTConfig holds JWT configuration
 type JWTConfig struct {
-	SecretKey string
+	SecretKey    string          // HMAC key; empty disables HMAC-signed tokens
+	AdminIDs     map[string]bool // User/entity IDs granted admin access by token
+	OIDC         *OIDCConfig     // External identity provider, if configured
+	EntityHeader bool            // Accept the unverified X-Entity-ID header (never in production)
 }
 
 // NewJWTConfig creates a new JWT config
 func NewJWTConfig(secretKey string) *JWTConfig {
 	if secretKey == "" {
-		secretKey = "default-secret-key-change-in-production" // Default for development
+		secretKey = DefaultSecret // Default for development
+	}
+	return &JWTConfig{SecretKey: secretKey, AdminIDs: adminIDsFromEnv(), EntityHeader: entityHeaderAllowed()}
+}
+
+// ConfigFromEnv builds the JWT config from JWT_SECRET, ADMIN_IDS and the
+// OIDC_* variables. With ENV=production the default secret is refused; if
+// an identity provider is configured, JWT_SECRET may instead be left empty
+// to accept only the provider's tokens.
+func ConfigFromEnv() (*JWTConfig, error) {
+	oidc, err := OIDCConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if os.Getenv("ENV") == "production" {
+		if secret == DefaultSecret || (secret == "" && oidc == nil) {
+			return nil, ErrInsecureSecret
+		}
+	} else if secret == "" {
+		secret = DefaultSecret
+	}
+
+	return &JWTConfig{SecretKey: secret, AdminIDs: adminIDsFromEnv(), OIDC: oidc, EntityHeader: entityHeaderAllowed()}, nil
+}
+
+// entityHeaderAllowed reports whether the X-Entity-ID development fallback
+// is accepted; it never is with ENV=production
+func entityHeaderAllowed() bool {
+	return os.Getenv("ENV") != "production"
+}
+
+// Principal is the caller identified by a token
+type Principal struct {
+	UserID    string
+	EntityID  string
+	Admin     bool
+	ExpiresAt time.Time // Zero if the token does not expire
+}
+
+// ID returns the entity ID, or the user ID for tokens without one
+func (p *Principal) ID() string {
+	if p.EntityID != "" {
+		return p.EntityID
+	}
+	return p.UserID
+}
+
+// Authenticate verifies a bearer token. Tokens whose issuer is the
+// configured identity provider are checked against its JWKS; all others
+// must be signed with the HMAC secret.
+func (c *JWTConfig) Authenticate(ctx context.Context, tokenString string) (*Principal, error) {
+	if c.OIDC != nil && tokenIssuer(tokenString) == c.OIDC.Issuer {
+		claims, err := c.OIDC.verify(ctx, tokenString)
+		if err != nil {
+			return nil, err
+		}
+		p, err := c.OIDC.principal(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		p.Admin = c.isAdmin(claims, p)
+		p.ExpiresAt = expiresAt(claims)
+		return p, nil
+	}
+
+	if c.SecretKey == "" {
+		return nil, errors.New("HMAC-signed tokens are disabled")
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(c.SecretKey), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
 	}
-	return &JWTConfig{SecretKey: secretKey}
+
+	p := &Principal{}
+	p.UserID, _ = claims["sub"].(string)
+	p.EntityID, _ = claims["entity_id"].(string)
+	p.Admin = c.isAdmin(claims, p)
+	p.ExpiresAt = expiresAt(claims)
+	return p, nil
+}
+
+func expiresAt(claims jwt.MapClaims) time.Time {
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		return exp.Time
+	}
+	return time.Time{}
+}
+
+func (c *JWTConfig) isAdmin(claims jwt.MapClaims, p *Principal) bool {
+	return hasAdminRole(claims) || (p.UserID != "" && c.AdminIDs[p.UserID]) || (p.EntityID != "" && c.AdminIDs[p.EntityID])
+}
+
+// tokenIssuer reads the unverified "iss" claim to pick the verification path
+func tokenIssuer(tokenString string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return ""
+	}
+	iss, _ := claims["iss"].(string)
+	return strings.TrimSuffix(iss, "/")
+}
+
+// adminIDsFromEnv reads the comma-separated ADMIN_IDS list
+func adminIDsFromEnv() map[string]bool {
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("ADMIN_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// hasAdminRole checks the "roles" claim for the admin role
+func hasAdminRole(claims jwt.MapClaims) bool {
+	roles, _ := claims["roles"].([]interface{})
+	for _, r := range roles {
+		if role, ok := r.(string); ok && role == "admin" {
+			return true
+		}
+	}
+	return false
 }
 
 // Middleware creates a JWT authentication middleware
@@ -33,8 +180,9 @@ func (c *JWTConfig) Middleware(next http.Handler) http.Handler {
 		// Extract token from Authorization header or X-Entity-ID header (for development)
 		// In production, use JWT token from Authorization header
 		entityID := r.Header.Get("X-Entity-ID")
-		if entityID != "" {
-			// Development mode: allow X-Entity-ID header
+		if entityID != "" && c.EntityHeader {
+			// Development mode: allow X-Entity-ID header. The ID is not
+			// verified, so it never grants admin access.
 			ctx := context.WithValue(r.Context(), entityIDKey, entityID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
@@ -54,37 +202,27 @@ func (c *JWTConfig) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return []byte(c.SecretKey), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		p, err := c.Authenticate(r.Context(), parts[1])
+		if errors.Is(err, ErrEntityResolution) {
+			http.Error(w, "Identity lookup failed", http.StatusServiceUnavailable)
 			return
 		}
-
-		// Extract claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID, _ := claims["sub"].(string)
-			entityID, _ := claims["entity_id"].(string)
-			
-			ctx := r.Context()
-			if userID != "" {
-				ctx = context.WithValue(ctx, userIDKey, userID)
-			}
-			if entityID != "" {
-				ctx = context.WithValue(ctx, entityIDKey, entityID)
-			}
-			next.ServeHTTP(w, r.WithContext(ctx))
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		ctx := r.Context()
+		if p.UserID != "" {
+			ctx = context.WithValue(ctx, userIDKey, p.UserID)
+		}
+		if p.EntityID != "" {
+			ctx = context.WithValue(ctx, entityIDKey, p.EntityID)
+		}
+		if p.Admin {
+			ctx = context.WithValue(ctx, adminKey, true)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -104,3 +242,54 @@ func GetEntityID(ctx context.Context) string {
 	return ""
 }
 
+
+// WithEntityID returns a context carrying the given entity ID
+func WithEntityID(ctx context.Context, entityID string) context.Context {
+	return context.WithValue(ctx, entityIDKey, entityID)
+}
+
+// WithClientID returns a context carrying the requestor client ID
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	return context.WithValue(ctx, clientIDKey, clientID)
+}
+
+// GetClientID extracts the requestor client ID from context
+func GetClientID(ctx context.Context) string {
+	if clientID, ok := ctx.Value(clientIDKey).(string); ok {
+		return clientID
+	}
+	return ""
+}
+
+// WithClientIP returns a context carrying the caller's IP address
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// GetClientIP extracts the caller's IP address from context
+func GetClientIP(ctx context.Context) string {
+	if ip, ok := ctx.Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return ""
+}
+
+// IsAdmin reports whether the caller has admin access
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey).(bool)
+	return admin
+}
+
+// Actor returns the best available identity of the caller, for auditing
+func Actor(ctx context.Context) string {
+	if userID := GetUserID(ctx); userID != "" {
+		return userID
+	}
+	if entityID := GetEntityID(ctx); entityID != "" {
+		return entityID
+	}
+	if clientID := GetClientID(ctx); clientID != "" {
+		return clientID
+	}
+	return "anonymous"
+}
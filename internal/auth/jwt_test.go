@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActor(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "anonymous", Actor(ctx))
+
+	ctx = WithClientID(ctx, "client-1")
+	assert.Equal(t, "client-1", Actor(ctx))
+
+	ctx = WithEntityID(ctx, "entity-1")
+	assert.Equal(t, "entity-1", Actor(ctx))
+
+	ctx = context.WithValue(ctx, userIDKey, "user-1")
+	assert.Equal(t, "user-1", Actor(ctx))
+}
+
+func TestMiddleware_Admin(t *testing.T) {
+	cfg := NewJWTConfig("test-secret")
+	cfg.AdminIDs = map[string]bool{"admin-entity": true}
+
+	var isAdmin bool
+	handler := cfg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isAdmin = IsAdmin(r.Context())
+	}))
+
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   bool
+	}{
+		{"anonymous", nil, false},
+		{"entity header", map[string]string{"X-Entity-ID": "someone"}, false},
+		{"admin entity header", map[string]string{"X-Entity-ID": "admin-entity"}, false},
+		{"admin entity claim", map[string]string{"Authorization": "Bearer " + sign(jwt.MapClaims{"sub": "u1", "entity_id": "admin-entity"})}, true},
+		{"admin subject", map[string]string{"Authorization": "Bearer " + sign(jwt.MapClaims{"sub": "admin-entity"})}, true},
+		{"admin role claim", map[string]string{"Authorization": "Bearer " + sign(jwt.MapClaims{"sub": "u1", "roles": []string{"admin"}})}, true},
+		{"other role claim", map[string]string{"Authorization": "Bearer " + sign(jwt.MapClaims{"sub": "u1", "roles": []string{"viewer"}})}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isAdmin = false
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, isAdmin)
+		})
+	}
+}
+
+func TestMiddleware_EntityHeader(t *testing.T) {
+	var entityID string
+	handler := func(cfg *JWTConfig) http.Handler {
+		return cfg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entityID = GetEntityID(r.Context())
+		}))
+	}
+	serve := func(h http.Handler) {
+		entityID = ""
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Entity-ID", "someone")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve(handler(NewJWTConfig("test-secret")))
+	assert.Equal(t, "someone", entityID)
+
+	t.Setenv("ENV", "production")
+	serve(handler(NewJWTConfig("test-secret")))
+	assert.Empty(t, entityID, "the header is ignored in production")
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Identity is the caller an identity provider vouches for
+type Identity struct {
+	Issuer  string
+	Subject string
+	Handle  string // Suggested handle for a provisioned entity
+	Email   string
+	Name    string
+}
+
+// ErrEntityResolution is returned when a verified identity could not be
+// mapped to an entity, e.g. because the database is unavailable
+var ErrEntityResolution = errors.New("failed to resolve entity")
+
+// EntityResolver maps an external identity to an entity ID. It returns ""
+// when the identity is not linked to an entity.
+type EntityResolver func(ctx context.Context, id Identity, provision bool) (string, error)
+
+// OIDCConfig validates tokens issued by an external OpenID Connect provider
+type OIDCConfig struct {
+	Issuer        string
+	Audience      []string // A token must be issued for at least one of these
+	EntityClaim   string   // Claim carrying the entity ID directly (default "entity_id")
+	HandleClaim   string   // Claim used as handle of provisioned entities (default "preferred_username")
+	AutoProvision bool     // Create an entity on first login of an unknown identity
+	JWKS          *JWKS    // Signing keys; the URL is discovered from the issuer when empty
+
+	resolve  EntityResolver
+	mu       sync.Mutex
+	entities map[string]string // issuer+subject -> entity ID
+}
+
+// OIDCConfigFromEnv reads OIDC_ISSUER, OIDC_AUDIENCE, OIDC_JWKS_URL,
+// OIDC_JWKS_TTL, OIDC_ENTITY_CLAIM, OIDC_HANDLE_CLAIM and
+// OIDC_AUTO_PROVISION. It returns nil when OIDC_ISSUER is not set.
+func OIDCConfigFromEnv() (*OIDCConfig, error) {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	var audience []string
+	for _, aud := range strings.Split(os.Getenv("OIDC_AUDIENCE"), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audience = append(audience, aud)
+		}
+	}
+	if len(audience) == 0 {
+		return nil, errors.New("OIDC_AUDIENCE is required when OIDC_ISSUER is set")
+	}
+
+	var ttl time.Duration
+	if v := os.Getenv("OIDC_JWKS_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OIDC_JWKS_TTL: %w", err)
+		}
+		ttl = d
+	}
+
+	cfg := &OIDCConfig{
+		Issuer:        issuer,
+		Audience:      audience,
+		EntityClaim:   os.Getenv("OIDC_ENTITY_CLAIM"),
+		HandleClaim:   os.Getenv("OIDC_HANDLE_CLAIM"),
+		AutoProvision: os.Getenv("OIDC_AUTO_PROVISION") == "true",
+	}
+	cfg.JWKS = NewJWKS(os.Getenv("OIDC_JWKS_URL"), ttl)
+	return cfg, nil
+}
+
+// SetEntityResolver sets how identities without an entity claim are mapped
+// to entities
+func (c *OIDCConfig) SetEntityResolver(resolve EntityResolver) {
+	c.resolve = resolve
+}
+
+// verify checks the signature, issuer, audience and expiry of a token
+func (c *OIDCConfig) verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(c.Issuer),
+		jwt.WithAudience(c.Audience...),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if err := c.discover(ctx); err != nil {
+			return nil, err
+		}
+		kid, _ := token.Header["kid"].(string)
+		return c.JWKS.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// discover looks up the JWKS URL in the issuer's discovery document
+func (c *OIDCConfig) discover(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.JWKS.url() != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.JWKS.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch OIDC discovery document: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode OIDC discovery document: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != c.Issuer {
+		return fmt.Errorf("OIDC discovery document is for issuer %q", doc.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return errors.New("OIDC discovery document has no jwks_uri")
+	}
+	c.JWKS.setURL(doc.JWKSURI)
+	return nil
+}
+
+// principal maps verified IdP claims to the caller's identity
+func (c *OIDCConfig) principal(ctx context.Context, claims jwt.MapClaims) (*Principal, error) {
+	p := &Principal{}
+	p.UserID, _ = claims["sub"].(string)
+
+	entityClaim := c.EntityClaim
+	if entityClaim == "" {
+		entityClaim = "entity_id"
+	}
+	if entityID, _ := claims[entityClaim].(string); entityID != "" {
+		p.EntityID = entityID
+		return p, nil
+	}
+	if p.UserID == "" || c.resolve == nil {
+		return p, nil
+	}
+
+	// Linked identities rarely change, so resolved entities are remembered
+	// to keep a database lookup off every request
+	key := c.Issuer + "\x00" + p.UserID
+	c.mu.Lock()
+	entityID, ok := c.entities[key]
+	c.mu.Unlock()
+	if ok {
+		p.EntityID = entityID
+		return p, nil
+	}
+
+	handleClaim := c.HandleClaim
+	if handleClaim == "" {
+		handleClaim = "preferred_username"
+	}
+	id := Identity{Issuer: c.Issuer, Subject: p.UserID}
+	id.Handle, _ = claims[handleClaim].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+
+	entityID, err := c.resolve(ctx, id, c.AutoProvision)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEntityResolution, err)
+	}
+	if entityID != "" {
+		c.mu.Lock()
+		if c.entities == nil {
+			c.entities = make(map[string]string)
+		}
+		c.entities[key] = entityID
+		c.mu.Unlock()
+	}
+	p.EntityID = entityID
+	return p, nil
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIdP serves a discovery document and a JWKS holding the current keys
+type fakeIdP struct {
+	server  *httptest.Server
+	keys    atomic.Value // []map[string]string
+	fetches atomic.Int32
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	idp := &fakeIdP{}
+	idp.keys.Store([]map[string]string{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   idp.server.URL,
+			"jwks_uri": idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": idp.keys.Load()})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func signRS256(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestAuthenticate_OIDC(t *testing.T) {
+	idp := newFakeIdP(t)
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp.keys.Store([]map[string]string{rsaJWK("k1", key1)})
+
+	var resolved []Identity
+	oidc := &OIDCConfig{Issuer: idp.server.URL, Audience: []string{"pxbox"}, AutoProvision: true, JWKS: NewJWKS("", 0)}
+	oidc.SetEntityResolver(func(ctx context.Context, id Identity, provision bool) (string, error) {
+		resolved = append(resolved, id)
+		assert.True(t, provision)
+		return "entity-" + id.Subject, nil
+	})
+	cfg := &JWTConfig{SecretKey: "test-secret", OIDC: oidc}
+
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": idp.server.URL,
+			"aud": "pxbox",
+			"sub": "alice",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	ctx := context.Background()
+
+	t.Run("entity claim", func(t *testing.T) {
+		p, err := cfg.Authenticate(ctx, signRS256(t, "k1", key1, claims(jwt.MapClaims{"entity_id": "e1", "roles": []string{"admin"}})))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", p.UserID)
+		assert.Equal(t, "e1", p.EntityID)
+		assert.True(t, p.Admin)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), p.ExpiresAt, 5*time.Second)
+		assert.Empty(t, resolved)
+	})
+
+	t.Run("resolved and cached", func(t *testing.T) {
+		token := signRS256(t, "k1", key1, claims(jwt.MapClaims{"preferred_username": "alice.a", "email": "alice@example.com"}))
+		for i := 0; i < 2; i++ {
+			p, err := cfg.Authenticate(ctx, token)
+			require.NoError(t, err)
+			assert.Equal(t, "entity-alice", p.EntityID)
+		}
+		require.Len(t, resolved, 1)
+		assert.Equal(t, Identity{Issuer: idp.server.URL, Subject: "alice", Handle: "alice.a", Email: "alice@example.com"}, resolved[0])
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		_, err := cfg.Authenticate(ctx, signRS256(t, "k1", key1, claims(jwt.MapClaims{"aud": "other"})))
+		assert.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		_, err := cfg.Authenticate(ctx, signRS256(t, "k1", key1, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})))
+		assert.Error(t, err)
+	})
+
+	t.Run("HMAC token claiming the issuer", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("test-secret"))
+		require.NoError(t, err)
+		_, err = cfg.Authenticate(ctx, token)
+		assert.Error(t, err)
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		key2, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		idp.keys.Store([]map[string]string{rsaJWK("k2", key2)})
+		oidc.JWKS.mu.Lock()
+		oidc.JWKS.lastFetched = time.Time{} // Skip the refresh rate limit
+		oidc.JWKS.mu.Unlock()
+
+		before := idp.fetches.Load()
+		p, err := cfg.Authenticate(ctx, signRS256(t, "k2", key2, claims(jwt.MapClaims{"entity_id": "e2"})))
+		require.NoError(t, err)
+		assert.Equal(t, "e2", p.EntityID)
+		assert.Equal(t, before+1, idp.fetches.Load())
+
+		// An unknown key right after a refresh does not fetch again
+		_, err = cfg.Authenticate(ctx, signRS256(t, "k3", key2, claims(nil)))
+		assert.ErrorIs(t, err, ErrUnknownKey)
+		assert.Equal(t, before+1, idp.fetches.Load())
+	})
+}
+
+func TestJWKS_ECKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=120")
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+		}}})
+	}))
+	defer server.Close()
+
+	jwks := NewJWKS(server.URL, 0)
+	pub, err := jwks.Key(context.Background(), "")
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(pub))
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), jwks.expiresAt, 5*time.Second)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("development default", func(t *testing.T) {
+		t.Setenv("ENV", "")
+		t.Setenv("JWT_SECRET", "")
+		cfg, err := ConfigFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, DefaultSecret, cfg.SecretKey)
+	})
+
+	t.Run("production default secret", func(t *testing.T) {
+		t.Setenv("ENV", "production")
+		for _, secret := range []string{"", DefaultSecret} {
+			t.Setenv("JWT_SECRET", secret)
+			_, err := ConfigFromEnv()
+			assert.ErrorIs(t, err, ErrInsecureSecret)
+		}
+	})
+
+	t.Run("production OIDC only", func(t *testing.T) {
+		t.Setenv("ENV", "production")
+		t.Setenv("JWT_SECRET", "")
+		t.Setenv("OIDC_ISSUER", "https://idp.example.com/")
+		t.Setenv("OIDC_AUDIENCE", "pxbox")
+		cfg, err := ConfigFromEnv()
+		require.NoError(t, err)
+		assert.Empty(t, cfg.SecretKey)
+		assert.Equal(t, "https://idp.example.com", cfg.OIDC.Issuer)
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1"}).SignedString([]byte(""))
+		require.NoError(t, err)
+		_, err = cfg.Authenticate(context.Background(), token)
+		assert.Error(t, err)
+	})
+
+	t.Run("OIDC without audience", func(t *testing.T) {
+		t.Setenv("OIDC_ISSUER", "https://idp.example.com")
+		t.Setenv("OIDC_AUDIENCE", "")
+		_, err := ConfigFromEnv()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,214 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrOpen is returned (wrapped in *OpenError) when a call is rejected because
+// the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError reports which dependency's breaker rejected the call
+type OpenError struct {
+	Name string
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s unavailable: %s", e.Name, ErrOpen)
+}
+
+// Is makes errors.Is(err, ErrOpen) match
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// State is the state of a breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Settings configures a breaker
+type Settings struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before allowing a probe
+	OpenTimeout time.Duration
+	// IsFailure decides whether an error counts against the dependency.
+	// Defaults to any non-nil error.
+	IsFailure func(err error) bool
+	// OnStateChange is called whenever the breaker changes state. It runs
+	// under the breaker's lock and must not call back into the breaker.
+	OnStateChange func(name string, from, to State)
+}
+
+// FromEnv overrides the threshold and open timeout of s with the
+// BREAKER_FAILURE_THRESHOLD and BREAKER_OPEN_TIMEOUT environment variables
+func FromEnv(s Settings) Settings {
+	if v := os.Getenv("BREAKER_FAILURE_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			s.FailureThreshold = n
+		}
+	}
+	if v := os.Getenv("BREAKER_OPEN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			s.OpenTimeout = d
+		}
+	}
+	return s
+}
+
+// LogStateChange returns an OnStateChange callback that logs transitions
+func LogStateChange(log *zap.Logger) func(name string, from, to State) {
+	return func(name string, from, to State) {
+		log.Warn("Circuit breaker state changed",
+			zap.String("dependency", name),
+			zap.Stringer("from", from),
+			zap.Stringer("to", to),
+		)
+	}
+}
+
+// Breaker is a consecutive-failure circuit breaker. When open, calls fail fast
+// with an *OpenError; after OpenTimeout a single probe call is let through
+// (half-open) and its outcome closes or re-opens the breaker.
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// New creates a new breaker for the named dependency
+func New(name string, settings Settings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 5
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = 30 * time.Second
+	}
+	if settings.IsFailure == nil {
+		settings.IsFailure = func(err error) bool { return err != nil }
+	}
+	return &Breaker{name: name, settings: settings, now: time.Now}
+}
+
+// Name returns the dependency name
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// Execute runs fn if the breaker allows it and records the outcome
+func (b *Breaker) Execute(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Done(err)
+	return err
+}
+
+// Allow reports whether a call may proceed. Every successful Allow must be
+// followed by exactly one Done with the call's outcome.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case StateOpen:
+		return &OpenError{Name: b.name}
+	case StateHalfOpen:
+		if b.probing {
+			return &OpenError{Name: b.name}
+		}
+		b.probing = true
+		if b.state != StateHalfOpen {
+			b.setState(StateHalfOpen)
+		}
+	}
+	return nil
+}
+
+// Done records the outcome of a call admitted by Allow
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := b.settings.IsFailure(err)
+	if b.state == StateHalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+		} else {
+			b.failures = 0
+			b.setState(StateClosed)
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.settings.FailureThreshold {
+		b.trip()
+	}
+}
+
+// currentState returns the effective state, treating an expired open period
+// as half-open. Must be called with mu held.
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.settings.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) trip() {
+	b.openedAt = b.now()
+	b.failures = 0
+	b.setState(StateOpen)
+}
+
+func (b *Breaker) setState(to State) {
+	from := b.state
+	b.state = to
+	if from != to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.name, from, to)
+	}
+}
@@ -0,0 +1,102 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("down")
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 3, OpenTimeout: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, b.Execute(func() error { return errDown }), errDown)
+	}
+	assert.Equal(t, StateOpen, b.State())
+
+	called := false
+	err := b.Execute(func() error { called = true; return nil })
+	assert.False(t, called, "open breaker must not call through")
+	assert.ErrorIs(t, err, ErrOpen)
+
+	var openErr *OpenError
+	require.ErrorAs(t, err, &openErr)
+	assert.Equal(t, "test", openErr.Name)
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+	_ = b.Execute(func() error { return errDown })
+	_ = b.Execute(func() error { return nil })
+	_ = b.Execute(func() error { return errDown })
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreaker_HalfOpenProbe(t *testing.T) {
+	now := time.Now()
+	b := New("test", Settings{FailureThreshold: 1, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	_ = b.Execute(func() error { return errDown })
+	require.Equal(t, StateOpen, b.State())
+
+	// After the open timeout a single probe is allowed through
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrOpen, "only one probe at a time")
+
+	// Failed probe re-opens the breaker
+	b.Done(errDown)
+	assert.Equal(t, StateOpen, b.State())
+
+	// Successful probe closes it
+	now = now.Add(2 * time.Second)
+	require.NoError(t, b.Execute(func() error { return nil }))
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreaker_IsFailure(t *testing.T) {
+	notFound := errors.New("not found")
+	b := New("test", Settings{
+		FailureThreshold: 1,
+		IsFailure:        func(err error) bool { return err != nil && err != notFound },
+	})
+
+	_ = b.Execute(func() error { return notFound })
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestTransport_PerHost(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	client := &http.Client{Transport: NewTransport(nil, Settings{FailureThreshold: 2, OpenTimeout: time.Minute})}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(failing.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	_, err := client.Get(failing.URL)
+	assert.ErrorIs(t, err, ErrOpen)
+
+	resp, err := client.Get(healthy.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
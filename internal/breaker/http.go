@@ -0,0 +1,56 @@
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Transport is an http.RoundTripper that keeps a breaker per destination
+// host, so one failing callback endpoint does not affect others. Transport
+// errors and 5xx responses count as failures.
+type Transport struct {
+	base     http.RoundTripper
+	settings Settings
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewTransport wraps base (http.DefaultTransport if nil)
+func NewTransport(base http.RoundTripper, settings Settings) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:     base,
+		settings: settings,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	if err := b.Allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 500 {
+		b.Done(fmt.Errorf("server error: %s", resp.Status))
+	} else {
+		b.Done(err)
+	}
+	return resp, err
+}
+
+func (t *Transport) breaker(host string) *Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = New("http:"+host, t.settings)
+		t.breakers[host] = b
+	}
+	return b
+}
@@ -0,0 +1,70 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisHook is a go-redis hook that guards every command, pipeline and dial
+// with a breaker
+type RedisHook struct {
+	b *Breaker
+}
+
+// NewRedisHook creates a hook around b. Use b = New("redis", Settings{IsFailure: IsRedisFailure}).
+func NewRedisHook(b *Breaker) *RedisHook {
+	return &RedisHook{b: b}
+}
+
+// IsRedisFailure reports whether err indicates Redis itself is unhealthy.
+// Missing keys, server error replies and cancelled contexts do not count.
+func IsRedisFailure(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var replyErr redis.Error
+	if errors.As(err, &replyErr) {
+		return false
+	}
+	return true
+}
+
+func (h *RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if err := h.b.Allow(); err != nil {
+			return nil, err
+		}
+		conn, err := next(ctx, network, addr)
+		h.b.Done(err)
+		return conn, err
+	}
+}
+
+func (h *RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.b.Allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err := next(ctx, cmd)
+		h.b.Done(err)
+		return err
+	}
+}
+
+func (h *RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.b.Allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err := next(ctx, cmds)
+		h.b.Done(err)
+		return err
+	}
+}
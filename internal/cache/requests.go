@@ -0,0 +1,106 @@
+// Package cache shares lookups between pxbox instances
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const requestRefPrefix = "request:ref:"
+
+// DefaultRequestRefTTL bounds how long a request's immutable fields are
+// cached. Writes through db.Queries drop them at once; the TTL covers
+// writes that bypass it, such as manual SQL.
+const DefaultRequestRefTTL = 10 * time.Minute
+
+// RedisRequestRefs caches the immutable fields of requests in Redis under
+// "request:ref:<id>". It is best effort: Redis errors read as misses.
+type RedisRequestRefs struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+var _ db.RequestRefCache = (*RedisRequestRefs)(nil)
+
+// NewRedisRequestRefs creates a request ref cache keeping entries for ttl
+func NewRedisRequestRefs(rdb *redis.Client, ttl time.Duration) *RedisRequestRefs {
+	return &RedisRequestRefs{rdb: rdb, ttl: ttl}
+}
+
+// RequestRefsFromEnv returns the request ref cache selected by
+// REQUEST_CACHE: none by default, or "redis" with entries kept for
+// REQUEST_CACHE_TTL
+func RequestRefsFromEnv(rdb *redis.Client) (db.RequestRefCache, error) {
+	ttl := DefaultRequestRefTTL
+	if v := os.Getenv("REQUEST_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid REQUEST_CACHE_TTL %q", v)
+		}
+		ttl = d
+	}
+
+	switch kind := os.Getenv("REQUEST_CACHE"); kind {
+	case "", "none":
+		return nil, nil
+	case "redis":
+		if rdb == nil {
+			return nil, fmt.Errorf("REQUEST_CACHE=redis requires a Redis client")
+		}
+		return NewRedisRequestRefs(rdb, ttl), nil
+	default:
+		return nil, fmt.Errorf("unknown REQUEST_CACHE %q", kind)
+	}
+}
+
+func (c *RedisRequestRefs) Get(ctx context.Context, id string) (db.RequestRef, bool) {
+	var ref db.RequestRef
+	data, err := c.rdb.Get(ctx, requestRefPrefix+id).Bytes()
+	if err != nil || json.Unmarshal(data, &ref) != nil {
+		return ref, false
+	}
+	return ref, true
+}
+
+func (c *RedisRequestRefs) Set(ctx context.Context, ref db.RequestRef) {
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return
+	}
+	c.rdb.Set(ctx, requestRefPrefix+ref.ID, data, c.ttl)
+}
+
+func (c *RedisRequestRefs) Delete(ctx context.Context, ids ...string) {
+	if len(ids) == 0 {
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = requestRefPrefix + id
+	}
+	c.rdb.Del(ctx, keys...)
+}
+
+// Clear drops every entry. It scans the keyspace, which is fine for the
+// merges and erasures that call it.
+func (c *RedisRequestRefs) Clear(ctx context.Context) {
+	iter := c.rdb.Scan(ctx, 0, requestRefPrefix+"*", 1000).Iterator()
+	keys := make([]string, 0, 1000)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			c.rdb.Del(ctx, keys...)
+			keys = keys[:0]
+		}
+	}
+	if len(keys) > 0 {
+		c.rdb.Del(ctx, keys...)
+	}
+}
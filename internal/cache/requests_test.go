@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisRequestRefs(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	refs := NewRedisRequestRefs(rdb, time.Minute)
+	_, ok := refs.Get(ctx, "req-1")
+	assert.False(t, ok)
+
+	ref := db.RequestRef{ID: "req-1", EntityID: "ent-1", CreatedBy: "client-1", Sandbox: true, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	refs.Set(ctx, ref)
+	refs.Set(ctx, db.RequestRef{ID: "req-2"})
+	got, ok := refs.Get(ctx, "req-1")
+	assert.True(t, ok)
+	assert.Equal(t, ref, got)
+
+	refs.Delete(ctx, "req-1")
+	_, ok = refs.Get(ctx, "req-1")
+	assert.False(t, ok)
+	_, ok = refs.Get(ctx, "req-2")
+	assert.True(t, ok)
+
+	refs.Clear(ctx)
+	_, ok = refs.Get(ctx, "req-2")
+	assert.False(t, ok)
+
+	refs.Set(ctx, ref)
+	mr.FastForward(2 * time.Minute)
+	_, ok = refs.Get(ctx, "req-1")
+	assert.False(t, ok)
+}
+
+func TestRequestRefsFromEnv(t *testing.T) {
+	t.Setenv("REQUEST_CACHE", "")
+	refs, err := RequestRefsFromEnv(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, refs)
+
+	t.Setenv("REQUEST_CACHE", "redis")
+	_, err = RequestRefsFromEnv(nil)
+	assert.Error(t, err)
+
+	t.Setenv("REQUEST_CACHE", "memcached")
+	_, err = RequestRefsFromEnv(redis.NewClient(&redis.Options{}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+// Package correlation carries the IDs that tie together what one API call
+// causes: the events it publishes, the jobs it enqueues, what those jobs do
+// in turn, and the log lines of all of them.
+//
+// The correlation ID is set once, from the API call's request ID, and
+// passed on unchanged. The causation ID names the immediate cause: the API
+// call itself, or the background task an event or job comes from.
+package correlation
+
+import (
+	"context"
+
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+// Header is the HTTP header that carries the request ID in and out of the
+// API; error responses repeat it as correlationId
+const Header = "X-Request-Id"
+
+type ctxKey struct{}
+
+type ids struct {
+	correlation string
+	causation   string
+}
+
+// With returns a context carrying a correlation and causation ID. An empty
+// causation ID defaults to the correlation ID.
+func With(ctx context.Context, correlationID, causationID string) context.Context {
+	if causationID == "" {
+		causationID = correlationID
+	}
+	return context.WithValue(ctx, ctxKey{}, ids{correlation: correlationID, causation: causationID})
+}
+
+// ID returns the correlation ID of ctx, or ""
+func ID(ctx context.Context) string {
+	v, _ := ctx.Value(ctxKey{}).(ids)
+	return v.correlation
+}
+
+// CausationID returns the causation ID of ctx, or ""
+func CausationID(ctx context.Context) string {
+	v, _ := ctx.Value(ctxKey{}).(ids)
+	return v.causation
+}
+
+// New returns a new ID, for work that does not start with an API call
+func New() string {
+	return ulid.Make().String()
+}
+
+// Logger returns log with the IDs of ctx as fields, or log itself when ctx
+// has none
+func Logger(ctx context.Context, log *zap.Logger) *zap.Logger {
+	v, ok := ctx.Value(ctxKey{}).(ids)
+	if !ok {
+		return log
+	}
+	return log.With(zap.String("correlation_id", v.correlation), zap.String("causation_id", v.causation))
+}
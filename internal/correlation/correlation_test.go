@@ -0,0 +1,36 @@
+package correlation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWith(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, ID(ctx))
+	assert.Empty(t, CausationID(ctx))
+
+	ctx = With(ctx, "req-1", "")
+	assert.Equal(t, "req-1", ID(ctx))
+	assert.Equal(t, "req-1", CausationID(ctx))
+
+	ctx = With(ctx, ID(ctx), "task-1")
+	assert.Equal(t, "req-1", ID(ctx))
+	assert.Equal(t, "task-1", CausationID(ctx))
+}
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := zap.New(core)
+
+	Logger(context.Background(), log).Info("plain")
+	Logger(With(context.Background(), "req-1", "task-1"), log).Info("correlated")
+
+	entries := logs.All()
+	assert.Empty(t, entries[0].ContextMap())
+	assert.Equal(t, map[string]interface{}{"correlation_id": "req-1", "causation_id": "task-1"}, entries[1].ContextMap())
+}
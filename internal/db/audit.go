@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// AuditEntry is a single row of the append-only audit log
+type AuditEntry struct {
+	ID           int64
+	OccurredAt   time.Time
+	Actor        string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	BeforeStatus *string
+	AfterStatus  *string
+	IP           *string
+	Meta         map[string]interface{}
+	PrevHash     *string
+	Hash         *string
+}
+
+type InsertAuditEntryParams struct {
+	OccurredAt   time.Time
+	Actor        string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	BeforeStatus *string
+	AfterStatus  *string
+	IP           *string
+	Meta         map[string]interface{}
+	PrevHash     *string
+	Hash         string
+}
+
+// AuditAnchor is a recorded snapshot of the audit chain head
+type AuditAnchor struct {
+	ID         int64
+	AnchoredAt time.Time
+	EntryID    int64
+	Hash       string
+	Location   *string
+}
+
+// AuditFilter narrows the audit entries returned by ListAuditEntries
+type AuditFilter struct {
+	Actor        *string
+	Action       *string
+	ResourceType *string
+	ResourceID   *string
+	Since        *time.Time
+	Until        *time.Time
+}
+
+func (q *Queries) InsertAuditEntry(ctx context.Context, e InsertAuditEntryParams) error {
+	if e.Meta == nil {
+		e.Meta = map[string]interface{}{}
+	}
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO audit_log (occurred_at, actor, action, resource_type, resource_id,
+			before_status, after_status, ip, meta, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		e.OccurredAt, e.Actor, e.Action, e.ResourceType, e.ResourceID,
+		e.BeforeStatus, e.AfterStatus, e.IP, e.Meta, e.PrevHash, e.Hash,
+	)
+	return err
+}
+
+// LockAuditChain serializes chain appends until the surrounding transaction
+// ends. It must be called inside InTx.
+func (q *Queries) LockAuditChain(ctx context.Context) error {
+	_, err := q.Pool.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('audit_log'))`)
+	return err
+}
+
+// GetAuditChainHead returns the newest hashed audit entry. It returns
+// pgx.ErrNoRows if the chain is empty.
+func (q *Queries) GetAuditChainHead(ctx context.Context) (AuditEntry, error) {
+	var e AuditEntry
+	err := q.Pool.QueryRow(ctx,
+		`SELECT id, occurred_at, actor, action, resource_type, resource_id,
+			before_status, after_status, ip, meta, prev_hash, hash
+		FROM audit_log
+		WHERE hash IS NOT NULL
+		ORDER BY id DESC
+		LIMIT 1`,
+	).Scan(
+		&e.ID, &e.OccurredAt, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID,
+		&e.BeforeStatus, &e.AfterStatus, &e.IP, &e.Meta, &e.PrevHash, &e.Hash,
+	)
+	return e, err
+}
+
+// ListAuditChain returns up to limit audit entries with id > afterID, oldest
+// first, for chain verification
+func (q *Queries) ListAuditChain(ctx context.Context, afterID int64, limit int) ([]AuditEntry, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, occurred_at, actor, action, resource_type, resource_id,
+			before_status, after_status, ip, meta, prev_hash, hash
+		FROM audit_log
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(
+			&e.ID, &e.OccurredAt, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID,
+			&e.BeforeStatus, &e.AfterStatus, &e.IP, &e.Meta, &e.PrevHash, &e.Hash,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (q *Queries) InsertAuditAnchor(ctx context.Context, entryID int64, hash string, location *string) (AuditAnchor, error) {
+	var a AuditAnchor
+	err := q.Pool.QueryRow(ctx,
+		`INSERT INTO audit_anchors (entry_id, hash, location)
+		VALUES ($1, $2, $3)
+		RETURNING id, anchored_at, entry_id, hash, location`,
+		entryID, hash, location,
+	).Scan(&a.ID, &a.AnchoredAt, &a.EntryID, &a.Hash, &a.Location)
+	return a, err
+}
+
+// GetLatestAuditAnchor returns the most recent anchor, or pgx.ErrNoRows
+func (q *Queries) GetLatestAuditAnchor(ctx context.Context) (AuditAnchor, error) {
+	var a AuditAnchor
+	err := q.Pool.QueryRow(ctx,
+		`SELECT id, anchored_at, entry_id, hash, location
+		FROM audit_anchors
+		ORDER BY id DESC
+		LIMIT 1`,
+	).Scan(&a.ID, &a.AnchoredAt, &a.EntryID, &a.Hash, &a.Location)
+	return a, err
+}
+
+// ListAuditAnchors returns all anchors, oldest first
+func (q *Queries) ListAuditAnchors(ctx context.Context) ([]AuditAnchor, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, anchored_at, entry_id, hash, location
+		FROM audit_anchors
+		ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anchors []AuditAnchor
+	for rows.Next() {
+		var a AuditAnchor
+		if err := rows.Scan(&a.ID, &a.AnchoredAt, &a.EntryID, &a.Hash, &a.Location); err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, a)
+	}
+	return anchors, rows.Err()
+}
+
+// ListAuditEntries returns matching audit entries, newest first
+func (q *Queries) ListAuditEntries(ctx context.Context, f AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, occurred_at, actor, action, resource_type, resource_id,
+			before_status, after_status, ip, meta, prev_hash, hash
+		FROM audit_log
+		WHERE ($1::text IS NULL OR actor = $1)
+		  AND ($2::text IS NULL OR action = $2)
+		  AND ($3::text IS NULL OR resource_type = $3)
+		  AND ($4::text IS NULL OR resource_id = $4)
+		  AND ($5::timestamptz IS NULL OR occurred_at >= $5)
+		  AND ($6::timestamptz IS NULL OR occurred_at < $6)
+		ORDER BY occurred_at DESC, id DESC
+		LIMIT $7 OFFSET $8`,
+		f.Actor, f.Action, f.ResourceType, f.ResourceID, f.Since, f.Until, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(
+			&e.ID, &e.OccurredAt, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID,
+			&e.BeforeStatus, &e.AfterStatus, &e.IP, &e.Meta, &e.PrevHash, &e.Hash,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
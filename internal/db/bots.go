@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// BotHandler is the URL requests addressed to a bot are pushed to
+type BotHandler struct {
+	EntityID  string
+	URL       string
+	Secret    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const botHandlerColumns = `entity_id, url, secret, created_at, updated_at`
+
+func scanBotHandler(row interface{ Scan(...interface{}) error }) (BotHandler, error) {
+	var h BotHandler
+	err := row.Scan(&h.EntityID, &h.URL, &h.Secret, &h.CreatedAt, &h.UpdatedAt)
+	return h, err
+}
+
+// UpsertBotHandler sets the handler of a bot, replacing an earlier one
+func (q *Queries) UpsertBotHandler(ctx context.Context, entityID, url, secret string) (BotHandler, error) {
+	return scanBotHandler(q.Pool.QueryRow(ctx,
+		`INSERT INTO bot_handlers (entity_id, url, secret)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (entity_id) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, updated_at = NOW()
+		RETURNING `+botHandlerColumns,
+		entityID, url, secret,
+	))
+}
+
+// GetBotHandler returns the handler of a bot
+func (q *Queries) GetBotHandler(ctx context.Context, entityID string) (BotHandler, error) {
+	return scanBotHandler(q.Pool.QueryRow(ctx,
+		`SELECT `+botHandlerColumns+` FROM bot_handlers WHERE entity_id = $1`,
+		entityID,
+	))
+}
+
+// DeleteBotHandler removes the handler of a bot and reports whether it
+// had one
+func (q *Queries) DeleteBotHandler(ctx context.Context, entityID string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM bot_handlers WHERE entity_id = $1`, entityID)
+	return tag.RowsAffected() > 0, err
+}
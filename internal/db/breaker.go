@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"pxbox/internal/breaker"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsDBFailure reports whether err indicates Postgres itself is unhealthy.
+// Missing rows, constraint violations and other statement-level errors do
+// not count; connection, resource and cancellation (statement timeout)
+// errors do.
+func IsDBFailure(err error) bool {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if len(pgErr.Code) < 2 {
+			return false
+		}
+		switch pgErr.Code[:2] {
+		case "08", "53", "57": // connection exception, insufficient resources, operator intervention
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// breakerDB guards a DBTX with a circuit breaker
+type breakerDB struct {
+	db DBTX
+	b  *breaker.Breaker
+}
+
+// WithBreaker wraps db so calls fail fast while b is open
+func WithBreaker(db DBTX, b *breaker.Breaker) DBTX {
+	return &breakerDB{db: db, b: b}
+}
+
+func (d *breakerDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := d.b.Allow(); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := d.db.Exec(ctx, sql, args...)
+	d.b.Done(err)
+	return tag, err
+}
+
+func (d *breakerDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := d.b.Allow(); err != nil {
+		return nil, err
+	}
+	rows, err := d.db.Query(ctx, sql, args...)
+	d.b.Done(err)
+	return rows, err
+}
+
+func (d *breakerDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := d.b.Allow(); err != nil {
+		return errRow{err: err}
+	}
+	// The outcome is only known once the row is scanned
+	return &breakerRow{row: d.db.QueryRow(ctx, sql, args...), b: d.b}
+}
+
+// Begin starts a transaction if the wrapped connection supports it. Only
+// the begin itself is guarded; statements inside the transaction are not.
+func (d *breakerDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	b, ok := d.db.(beginner)
+	if !ok {
+		return nil, errors.New("connection does not support transactions")
+	}
+	if err := d.b.Allow(); err != nil {
+		return nil, err
+	}
+	tx, err := b.Begin(ctx)
+	d.b.Done(err)
+	return tx, err
+}
+
+type breakerRow struct {
+	row pgx.Row
+	b   *breaker.Breaker
+}
+
+func (r *breakerRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	r.b.Done(err)
+	return err
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
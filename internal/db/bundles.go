@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Bundle groups requests to one entity; CompletedAt is set once all of
+// them are answered
+type Bundle struct {
+	ID          string
+	EntityID    string
+	CreatedBy   string
+	Title       *string
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+	Items       []BundleItem // In bundle order
+}
+
+// BundleItem is a request of a bundle with its current status
+type BundleItem struct {
+	RequestID string
+	Status    string
+}
+
+type CreateBundleParams struct {
+	ID         string
+	EntityID   string
+	CreatedBy  string
+	Title      *string
+	RequestIDs []string
+}
+
+const bundleColumns = `id, entity_id, created_by, title, created_at, completed_at`
+
+func scanBundle(row interface{ Scan(...interface{}) error }) (Bundle, error) {
+	var b Bundle
+	err := row.Scan(&b.ID, &b.EntityID, &b.CreatedBy, &b.Title, &b.CreatedAt, &b.CompletedAt)
+	return b, err
+}
+
+// CreateBundle records a bundle of existing requests, in the given order.
+// Run it in a transaction.
+func (q *Queries) CreateBundle(ctx context.Context, p CreateBundleParams) (Bundle, error) {
+	b, err := scanBundle(q.Pool.QueryRow(ctx,
+		`INSERT INTO request_bundles (id, entity_id, created_by, title)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+bundleColumns,
+		p.ID, p.EntityID, p.CreatedBy, p.Title,
+	))
+	if err != nil {
+		return b, err
+	}
+	_, err = q.Pool.Exec(ctx,
+		`INSERT INTO bundle_requests (request_id, bundle_id, position)
+		SELECT request_id, $1::text, position::int - 1
+		FROM unnest($2::text[]) WITH ORDINALITY AS ids(request_id, position)`,
+		p.ID, p.RequestIDs,
+	)
+	if err != nil {
+		return b, err
+	}
+	return q.withBundleItems(ctx, b)
+}
+
+// GetBundle returns a bundle with the status of its requests
+func (q *Queries) GetBundle(ctx context.Context, id string) (Bundle, error) {
+	b, err := scanBundle(q.Pool.QueryRow(ctx,
+		`SELECT `+bundleColumns+` FROM request_bundles WHERE id = $1`,
+		id,
+	))
+	if err != nil {
+		return b, err
+	}
+	return q.withBundleItems(ctx, b)
+}
+
+func (q *Queries) withBundleItems(ctx context.Context, b Bundle) (Bundle, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT br.request_id, r.status
+		FROM bundle_requests br
+		JOIN requests r ON r.id = br.request_id
+		WHERE br.bundle_id = $1 AND r.deleted_at IS NULL
+		ORDER BY br.position`,
+		b.ID,
+	)
+	if err != nil {
+		return b, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item BundleItem
+		if err := rows.Scan(&item.RequestID, &item.Status); err != nil {
+			return b, err
+		}
+		b.Items = append(b.Items, item)
+	}
+	return b, rows.Err()
+}
+
+// GetRequestBundleIDs returns the bundle of each of the requests that
+// belongs to one, by request ID
+func (q *Queries) GetRequestBundleIDs(ctx context.Context, requestIDs []string) (map[string]string, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT request_id, bundle_id FROM bundle_requests WHERE request_id = ANY($1)`,
+		requestIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bundles := map[string]string{}
+	for rows.Next() {
+		var requestID, bundleID string
+		if err := rows.Scan(&requestID, &bundleID); err != nil {
+			return nil, err
+		}
+		bundles[requestID] = bundleID
+	}
+	return bundles, rows.Err()
+}
+
+// CompleteRequestBundle marks the bundle of a request complete if all of
+// its requests are answered, or accepted, and returns it. pgx.ErrNoRows is returned if
+// the request is in no bundle, requests of the bundle are still open, or
+// the bundle was already completed, so only one caller completes it.
+func (q *Queries) CompleteRequestBundle(ctx context.Context, requestID string) (Bundle, error) {
+	b, err := scanBundle(q.Pool.QueryRow(ctx,
+		`UPDATE request_bundles b SET completed_at = NOW()
+		FROM bundle_requests br
+		WHERE br.request_id = $1 AND b.id = br.bundle_id AND b.completed_at IS NULL
+		  AND NOT EXISTS (
+		    SELECT 1 FROM bundle_requests o
+		    JOIN requests r ON r.id = o.request_id
+		    WHERE o.bundle_id = b.id AND r.status NOT IN ('ANSWERED', 'ACCEPTED')
+		  )
+		RETURNING b.id, b.entity_id, b.created_by, b.title, b.created_at, b.completed_at`,
+		requestID,
+	))
+	if err != nil {
+		return b, err
+	}
+	return q.withBundleItems(ctx, b)
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// SetCalendarFeedToken replaces the calendar feed token of an entity and
+// returns when it was created
+func (q *Queries) SetCalendarFeedToken(ctx context.Context, entityID, tokenHash string) (time.Time, error) {
+	var createdAt time.Time
+	err := q.Pool.QueryRow(ctx,
+		`INSERT INTO calendar_feeds (entity_id, token_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (entity_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, created_at = NOW()
+		RETURNING created_at`,
+		entityID, tokenHash,
+	).Scan(&createdAt)
+	return createdAt, err
+}
+
+// GetCalendarFeedEntity returns the entity a calendar feed token belongs
+// to, or pgx.ErrNoRows for unknown tokens
+func (q *Queries) GetCalendarFeedEntity(ctx context.Context, tokenHash string) (string, error) {
+	var entityID string
+	err := q.Pool.QueryRow(ctx,
+		`SELECT entity_id FROM calendar_feeds WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(&entityID)
+	return entityID, err
+}
+
+// DeleteCalendarFeedToken revokes the calendar feed token of an entity. It
+// reports whether there was one.
+func (q *Queries) DeleteCalendarFeedToken(ctx context.Context, entityID string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM calendar_feeds WHERE entity_id = $1`, entityID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
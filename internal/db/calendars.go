@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/model"
+)
+
+const calendarColumns = `timezone, work_days, work_start, work_end, holidays, updated_at`
+
+func scanCalendar(row interface{ Scan(...interface{}) error }) (model.BusinessCalendar, error) {
+	var c model.BusinessCalendar
+	var updatedAt time.Time
+	err := row.Scan(&c.Timezone, &c.WorkDays, &c.WorkStart, &c.WorkEnd, &c.Holidays, &updatedAt)
+	c.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return c, err
+}
+
+// GetBusinessCalendar returns the business calendar an entity set, or
+// pgx.ErrNoRows if it never set one
+func (q *Queries) GetBusinessCalendar(ctx context.Context, entityID string) (model.BusinessCalendar, error) {
+	return scanCalendar(q.Pool.QueryRow(ctx,
+		`SELECT `+calendarColumns+` FROM business_calendars WHERE entity_id = $1`,
+		entityID,
+	))
+}
+
+// UpsertBusinessCalendar replaces the business calendar of an entity
+func (q *Queries) UpsertBusinessCalendar(ctx context.Context, entityID string, c model.BusinessCalendar) (model.BusinessCalendar, error) {
+	return scanCalendar(q.Pool.QueryRow(ctx,
+		`INSERT INTO business_calendars (entity_id, timezone, work_days, work_start, work_end, holidays)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (entity_id) DO UPDATE
+		SET timezone = EXCLUDED.timezone, work_days = EXCLUDED.work_days, work_start = EXCLUDED.work_start,
+			work_end = EXCLUDED.work_end, holidays = EXCLUDED.holidays, updated_at = NOW()
+		RETURNING `+calendarColumns,
+		entityID, c.Timezone, c.WorkDays, c.WorkStart, c.WorkEnd, c.Holidays,
+	))
+}
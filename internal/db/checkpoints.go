@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// GetCheckpoint returns the saved progress of a task as JSON. It returns
+// pgx.ErrNoRows if there is none or it expired.
+func (q *Queries) GetCheckpoint(ctx context.Context, key string) ([]byte, error) {
+	var progress []byte
+	err := q.Pool.QueryRow(ctx,
+		`SELECT progress FROM checkpoints WHERE key = $1 AND expires_at > NOW()`,
+		key,
+	).Scan(&progress)
+	return progress, err
+}
+
+// SaveCheckpoint replaces the saved progress of a task, kept until
+// expiresAt
+func (q *Queries) SaveCheckpoint(ctx context.Context, key string, progress []byte, expiresAt time.Time) error {
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO checkpoints (key, progress, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET progress = EXCLUDED.progress, expires_at = EXCLUDED.expires_at`,
+		key, progress, expiresAt,
+	)
+	return err
+}
+
+// DeleteCheckpoint removes the saved progress of a task
+func (q *Queries) DeleteCheckpoint(ctx context.Context, key string) error {
+	_, err := q.Pool.Exec(ctx, `DELETE FROM checkpoints WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Comment is a message in the clarification thread of a request
+type Comment struct {
+	ID         string
+	RequestID  string
+	Author     string
+	AuthorRole string
+	Body       string
+	Files      []map[string]interface{}
+	CreatedAt  time.Time
+}
+
+type CreateCommentParams struct {
+	ID         string
+	RequestID  string
+	Author     string
+	AuthorRole string
+	Body       string
+	Files      []map[string]interface{}
+}
+
+// CreateComment adds a comment to a request's thread
+func (q *Queries) CreateComment(ctx context.Context, p CreateCommentParams) (Comment, error) {
+	var c Comment
+	err := q.Pool.QueryRow(ctx,
+		`INSERT INTO request_comments (id, request_id, author, author_role, body, files)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, request_id, author, author_role, body, files, created_at`,
+		p.ID, p.RequestID, p.Author, p.AuthorRole, p.Body, p.Files,
+	).Scan(&c.ID, &c.RequestID, &c.Author, &c.AuthorRole, &c.Body, &c.Files, &c.CreatedAt)
+	return c, err
+}
+
+// ListComments returns the comments of a request, oldest first
+func (q *Queries) ListComments(ctx context.Context, requestID string, limit, offset int) ([]Comment, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, request_id, author, author_role, body, files, created_at
+		FROM request_comments
+		WHERE request_id = $1
+		ORDER BY created_at ASC, id ASC
+		LIMIT $2 OFFSET $3`,
+		requestID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.RequestID, &c.Author, &c.AuthorRole, &c.Body, &c.Files, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Device is a mobile app of an entity that gets push notifications
+type Device struct {
+	ID        string
+	EntityID  string
+	Platform  string // "fcm" or "apns"
+	Token     string
+	Name      *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const deviceColumns = `id, entity_id, platform, token, name, created_at, updated_at`
+
+func scanDevice(row interface{ Scan(...interface{}) error }) (Device, error) {
+	var d Device
+	err := row.Scan(&d.ID, &d.EntityID, &d.Platform, &d.Token, &d.Name, &d.CreatedAt, &d.UpdatedAt)
+	return d, err
+}
+
+// UpsertDevice registers a device. A token registered before keeps its ID
+// and moves to d.EntityID.
+func (q *Queries) UpsertDevice(ctx context.Context, d Device) (Device, error) {
+	return scanDevice(q.Pool.QueryRow(ctx,
+		`INSERT INTO devices (id, entity_id, platform, token, name)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (platform, token) DO UPDATE
+		SET entity_id = EXCLUDED.entity_id, name = EXCLUDED.name, updated_at = NOW()
+		RETURNING `+deviceColumns,
+		d.ID, d.EntityID, d.Platform, d.Token, d.Name,
+	))
+}
+
+// ListDevices returns the devices of an entity, oldest first
+func (q *Queries) ListDevices(ctx context.Context, entityID string) ([]Device, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+deviceColumns+` FROM devices WHERE entity_id = $1 ORDER BY created_at, id`,
+		entityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make([]Device, 0)
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// DeleteDevice removes a device of an entity. It returns pgx.ErrNoRows if
+// the entity has no such device.
+func (q *Queries) DeleteDevice(ctx context.Context, entityID, id string) error {
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM devices WHERE id = $1 AND entity_id = $2`, id, entityID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteDeviceToken forgets a token the push service reported as invalid
+func (q *Queries) DeleteDeviceToken(ctx context.Context, platform, token string) error {
+	_, err := q.Pool.Exec(ctx, `DELETE FROM devices WHERE platform = $1 AND token = $2`, platform, token)
+	return err
+}
+
+// HasNotificationTargets reports whether an entity can be notified outside
+// the WebSocket, on a registered device or in a linked Telegram chat
+func (q *Queries) HasNotificationTargets(ctx context.Context, entityID string) (bool, error) {
+	var ok bool
+	err := q.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM devices WHERE entity_id = $1)
+		     OR EXISTS (SELECT 1 FROM telegram_chats WHERE entity_id = $1 AND chat_id IS NOT NULL)`,
+		entityID,
+	).Scan(&ok)
+	return ok, err
+}
+
+// CountOpenRequests counts the pending and claimed requests of an entity
+// that have not expired, the badge of its app icon
+func (q *Queries) CountOpenRequests(ctx context.Context, entityID string) (int, error) {
+	var n int
+	err := q.Pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM requests
+		WHERE entity_id = $1 AND status IN ('PENDING', 'CLAIMED') AND deleted_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > NOW())`,
+		entityID,
+	).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/model"
+)
+
+// Digest sections
+const (
+	DigestNew      = "new"
+	DigestOverdue  = "overdue"
+	DigestExpiring = "expiring"
+)
+
+// DigestItem is an open request listed in an entity's digest
+type DigestItem struct {
+	RequestID string
+	Title     string // The schema title, if any
+	CreatedBy string
+	Section   string // DigestNew, DigestOverdue or DigestExpiring
+	CreatedAt time.Time
+	DueAt     *time.Time // Deadline, or expiry without a deadline
+}
+
+// ListDigestItems returns up to limit open requests of an entity that are
+// overdue, due before soon or created since the given time, most urgent
+// first. Snoozed requests and requests past their expiry are left out.
+func (q *Queries) ListDigestItems(ctx context.Context, entityID string, since, soon time.Time, limit int) ([]DigestItem, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, COALESCE(schema_payload->>'title', ''), created_by,
+			CASE
+				WHEN COALESCE(deadline_at, expires_at) < NOW() OR attention_at < NOW() THEN 'overdue'
+				WHEN COALESCE(deadline_at, expires_at) < $3 THEN 'expiring'
+				ELSE 'new'
+			END,
+			created_at, COALESCE(deadline_at, expires_at)
+		FROM requests
+		WHERE entity_id = $1 AND deleted_at IS NULL AND status IN ('PENDING', 'CLAIMED')
+		  AND (snoozed_until IS NULL OR snoozed_until <= NOW())
+		  AND (expires_at IS NULL OR expires_at > NOW())
+		  AND (created_at >= $2 OR COALESCE(deadline_at, expires_at) < $3 OR attention_at < NOW())
+		ORDER BY COALESCE(deadline_at, expires_at) ASC NULLS LAST, created_at ASC
+		LIMIT $4`,
+		entityID, since, soon, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DigestItem
+	for rows.Next() {
+		var it DigestItem
+		if err := rows.Scan(&it.RequestID, &it.Title, &it.CreatedBy, &it.Section, &it.CreatedAt, &it.DueAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// DigestSubscriber is an entity that receives digests
+type DigestSubscriber struct {
+	EntityID     string
+	Preferences  model.NotificationPreferences
+	LastDigestAt *time.Time
+}
+
+// ListDigestSubscribers returns the entities with daily or weekly digests
+// enabled
+func (q *Queries) ListDigestSubscribers(ctx context.Context) ([]DigestSubscriber, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT entity_id, last_digest_at, `+preferencesColumns+`
+		FROM notification_preferences
+		WHERE digest <> 'off'
+		ORDER BY entity_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []DigestSubscriber
+	for rows.Next() {
+		var s DigestSubscriber
+		prefs, err := scanPreferences(rows, &s.EntityID, &s.LastDigestAt)
+		if err != nil {
+			return nil, err
+		}
+		s.Preferences = prefs
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, rows.Err()
+}
+
+// MarkDigestScheduled records the slot of the latest digest of an entity.
+// It returns false if that slot was already recorded, so each digest is
+// scheduled once.
+func (q *Queries) MarkDigestScheduled(ctx context.Context, entityID string, slot time.Time) (bool, error) {
+	tag, err := q.Pool.Exec(ctx,
+		`UPDATE notification_preferences SET last_digest_at = $2
+		WHERE entity_id = $1 AND (last_digest_at IS NULL OR last_digest_at < $2)`,
+		entityID, slot,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
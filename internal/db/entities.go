@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const entityColumns = `id, kind, handle, meta, created_at, sandbox, deactivated_at`
+
+func scanEntity(row interface{ Scan(...interface{}) error }) (Entity, error) {
+	var e Entity
+	err := row.Scan(&e.ID, &e.Kind, &e.Handle, &e.Meta, &e.CreatedAt, &e.Sandbox, &e.DeactivatedAt)
+	return e, err
+}
+
+// EntityFilter narrows an entity listing. Nil fields match all entities.
+type EntityFilter struct {
+	Kind               *string
+	HandlePrefix       *string
+	IncludeDeactivated bool
+}
+
+// ListEntities returns entities matching f, newest first
+func (q *Queries) ListEntities(ctx context.Context, f EntityFilter, limit, offset int) ([]Entity, error) {
+	var prefix *string
+	if f.HandlePrefix != nil {
+		p := escapeLike(*f.HandlePrefix) + "%"
+		prefix = &p
+	}
+
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+entityColumns+` FROM entities
+		WHERE ($1::text IS NULL OR kind = $1)
+		  AND ($2::text IS NULL OR handle LIKE $2)
+		  AND ($3::boolean OR deactivated_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4 OFFSET $5`,
+		f.Kind, prefix, f.IncludeDeactivated, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := make([]Entity, 0)
+	for rows.Next() {
+		e, err := scanEntity(rows)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, e)
+	}
+	return entities, rows.Err()
+}
+
+// SetEntityDeactivated deactivates an entity at the given time, or
+// reactivates it when at is nil. Deactivating keeps the original time of
+// an entity that is already deactivated.
+func (q *Queries) SetEntityDeactivated(ctx context.Context, id string, at *time.Time) (Entity, error) {
+	return scanEntity(q.Pool.QueryRow(ctx,
+		`UPDATE entities
+		SET deactivated_at = CASE WHEN $2::timestamptz IS NULL THEN NULL ELSE COALESCE(deactivated_at, $2) END
+		WHERE id = $1
+		RETURNING `+entityColumns,
+		id, at,
+	))
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
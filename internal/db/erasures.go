@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/model"
+)
+
+// Erasure is a run erasing the data of an entity
+type Erasure struct {
+	ID          string
+	EntityID    string
+	Mode        string
+	Status      string
+	RequestedBy string
+	Report      *model.ErasureReport
+	Error       *string
+	CreatedAt   time.Time
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// ErasureTargets is what an erasure has to remove outside the database:
+// stored objects and the events of the requests involved
+type ErasureTargets struct {
+	RequestIDs []string                 // Requests addressed to the entity or answered by it
+	Requestors []string                 // Clients that created those requests
+	ObjectKeys []string                 // Keys of uploaded files
+	Files      []map[string]interface{} // Files attached to responses and comments by URL
+}
+
+const erasureColumns = `id, entity_id, mode, status, requested_by, report, error, created_at, started_at, completed_at`
+
+func scanErasure(row interface{ Scan(...interface{}) error }) (Erasure, error) {
+	var e Erasure
+	err := row.Scan(&e.ID, &e.EntityID, &e.Mode, &e.Status, &e.RequestedBy, &e.Report, &e.Error,
+		&e.CreatedAt, &e.StartedAt, &e.CompletedAt)
+	return e, err
+}
+
+// CreateErasure records a pending erasure
+func (q *Queries) CreateErasure(ctx context.Context, id, entityID, mode, requestedBy string) (Erasure, error) {
+	return scanErasure(q.Pool.QueryRow(ctx,
+		`INSERT INTO erasures (id, entity_id, mode, requested_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+erasureColumns,
+		id, entityID, mode, requestedBy,
+	))
+}
+
+// GetErasure returns an erasure by ID
+func (q *Queries) GetErasure(ctx context.Context, id string) (Erasure, error) {
+	return scanErasure(q.Pool.QueryRow(ctx,
+		`SELECT `+erasureColumns+` FROM erasures WHERE id = $1`,
+		id,
+	))
+}
+
+// StartErasure marks an erasure running. Retries of a running or failed
+// erasure start it again; a completed one returns pgx.ErrNoRows.
+func (q *Queries) StartErasure(ctx context.Context, id string) (Erasure, error) {
+	return scanErasure(q.Pool.QueryRow(ctx,
+		`UPDATE erasures SET status = 'RUNNING', started_at = NOW()
+		WHERE id = $1 AND status IN ('PENDING', 'RUNNING', 'FAILED')
+		RETURNING `+erasureColumns,
+		id,
+	))
+}
+
+// FinishErasure records the outcome of an erasure: COMPLETED with its
+// report, or FAILED with an error
+func (q *Queries) FinishErasure(ctx context.Context, id, status string, report *model.ErasureReport, errMsg *string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE erasures SET status = $2, report = $3, error = $4, completed_at = NOW()
+		WHERE id = $1`,
+		id, status, report, errMsg,
+	)
+	return err
+}
+
+// GetErasureTargets lists the requests, requestors and files touched by
+// erasing an entity: requests addressed to it and responses it gave to
+// requests addressed elsewhere
+func (q *Queries) GetErasureTargets(ctx context.Context, entityID string) (ErasureTargets, error) {
+	var t ErasureTargets
+	err := q.Pool.QueryRow(ctx,
+		`WITH reqs AS (
+			SELECT id, created_by FROM requests WHERE entity_id = $1
+			UNION
+			SELECT r.id, r.created_by FROM requests r
+			JOIN responses resp ON resp.request_id = r.id
+			WHERE resp.answered_by = $1
+		), resps AS (
+			SELECT id, files FROM responses
+			WHERE answered_by = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1)
+		), comments AS (
+			SELECT id, files FROM request_comments
+			WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1)
+		)
+		SELECT
+			COALESCE((SELECT array_agg(id) FROM reqs), '{}'),
+			COALESCE((SELECT array_agg(DISTINCT created_by) FROM reqs), '{}'),
+			COALESCE((
+				SELECT array_agg(object_key) FROM files
+				WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1)
+				   OR response_id IN (SELECT id FROM resps)
+				   OR comment_id IN (SELECT id FROM comments)
+			), '{}'),
+			COALESCE((
+				SELECT jsonb_agg(f) FROM (
+					SELECT f FROM resps, jsonb_array_elements(resps.files) f
+					UNION ALL
+					SELECT f FROM comments, jsonb_array_elements(comments.files) f
+				) attached
+			), '[]'::jsonb)`,
+		entityID,
+	).Scan(&t.RequestIDs, &t.Requestors, &t.ObjectKeys, &t.Files)
+	return t, err
+}
+
+// DeleteEntityData deletes the requests addressed to an entity, the
+// responses it gave elsewhere, its reminders, the webhook deliveries of
+// its events, its push notification devices, Telegram chat and calendar
+// feed token, the file rows with the given keys and finally the entity
+// itself. Identities, saved views and owned
+// flows go with the entity through ON DELETE CASCADE. Run it in a
+// transaction.
+func (q *Queries) DeleteEntityData(ctx context.Context, entityID string, objectKeys []string) (model.ErasureReport, error) {
+	defer q.forgetRequests(ctx, nil)
+	var report model.ErasureReport
+	steps := []erasureStep{
+		{&report.Files, `DELETE FROM files WHERE object_key = ANY($1)`, []interface{}{objectKeys}},
+		{&report.WebhookDeliveries, `DELETE FROM webhook_deliveries
+			WHERE event->>'entityId' = $2
+			   OR event->>'requestId' IN (
+				SELECT id FROM requests WHERE entity_id = $1
+				UNION SELECT request_id FROM responses WHERE answered_by = $1
+			)`, []interface{}{entityID, entityID}},
+		{&report.Reminders, `DELETE FROM reminders
+			WHERE entity_id = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1)`, []interface{}{entityID}},
+		{&report.Comments, `DELETE FROM request_comments
+			WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1)`, []interface{}{entityID}},
+		{&report.Responses, `DELETE FROM responses
+			WHERE answered_by = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1)`, []interface{}{entityID}},
+		{&report.Identities, `DELETE FROM entity_identities WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.Devices, `DELETE FROM devices WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.TelegramChats, `DELETE FROM telegram_chats WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.CalendarFeeds, `DELETE FROM calendar_feeds WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.Requests, `DELETE FROM requests WHERE entity_id = $1`, []interface{}{entityID}},
+	}
+	if err := q.execSteps(ctx, steps); err != nil {
+		return report, err
+	}
+
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM entities WHERE id = $1`, entityID)
+	if err != nil {
+		return report, err
+	}
+	report.EntityDeleted = tag.RowsAffected() > 0
+	return report, nil
+}
+
+// AnonymizeEntityData keeps the requests addressed to an entity and the
+// responses it gave, stripped of their content: prefills, tags, answers,
+// comment bodies and attached files. Its reminders, identities, push
+// notification devices, Telegram chat, calendar feed token, the webhook
+// deliveries of its events and the file rows with the given keys are
+// deleted, and the entity loses its handle,
+// metadata and notification preferences, as do its redirects their
+// handles. Run it in a transaction.
+func (q *Queries) AnonymizeEntityData(ctx context.Context, entityID string, objectKeys []string) (model.ErasureReport, error) {
+	defer q.forgetRequests(ctx, nil)
+	var report model.ErasureReport
+	steps := []erasureStep{
+		{&report.Files, `DELETE FROM files WHERE object_key = ANY($1)`, []interface{}{objectKeys}},
+		{&report.WebhookDeliveries, `DELETE FROM webhook_deliveries
+			WHERE event->>'entityId' = $2
+			   OR event->>'requestId' IN (
+				SELECT id FROM requests WHERE entity_id = $1
+				UNION SELECT request_id FROM responses WHERE answered_by = $1
+			)`, []interface{}{entityID, entityID}},
+		{&report.Reminders, `DELETE FROM reminders
+			WHERE entity_id = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1)`, []interface{}{entityID}},
+		{&report.Comments, `UPDATE request_comments SET body = '', files = '[]'::jsonb
+			WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1)`, []interface{}{entityID}},
+		{&report.Responses, `UPDATE responses SET payload = '{}'::jsonb, files = '[]'::jsonb, signature_jws = NULL,
+			review_reason = NULL
+			WHERE answered_by = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1)`, []interface{}{entityID}},
+		{&report.Identities, `DELETE FROM entity_identities WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.Devices, `DELETE FROM devices WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.TelegramChats, `DELETE FROM telegram_chats WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.CalendarFeeds, `DELETE FROM calendar_feeds WHERE entity_id = $1`, []interface{}{entityID}},
+		{&report.Requests, `UPDATE requests SET prefill = NULL, tags = '{}', updated_at = NOW()
+			WHERE entity_id = $1`, []interface{}{entityID}},
+	}
+	if err := q.execSteps(ctx, steps); err != nil {
+		return report, err
+	}
+
+	if _, err := q.Pool.Exec(ctx, `DELETE FROM notification_preferences WHERE entity_id = $1`, entityID); err != nil {
+		return report, err
+	}
+	// Handles of entities merged into this one would still point at it
+	if _, err := q.Pool.Exec(ctx, `UPDATE entity_redirects SET source_handle = NULL WHERE target_id = $1`, entityID); err != nil {
+		return report, err
+	}
+	_, err := q.Pool.Exec(ctx, `UPDATE entities SET handle = NULL, meta = '{}'::jsonb WHERE id = $1`, entityID)
+	return report, err
+}
+
+// erasureStep is a statement of an erasure and where to count its rows
+type erasureStep struct {
+	count *int64
+	sql   string
+	args  []interface{}
+}
+
+func (q *Queries) execSteps(ctx context.Context, steps []erasureStep) error {
+	for _, step := range steps {
+		tag, err := q.Pool.Exec(ctx, step.sql, step.args...)
+		if err != nil {
+			return err
+		}
+		*step.count = tag.RowsAffected()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ExportFilter narrows the set of requests included in an export
+type ExportFilter struct {
+	EntityID      *string    `json:"entityId,omitempty"`
+	Status        *string    `json:"status,omitempty"`
+	CreatedBy     *string    `json:"createdBy,omitempty"`
+	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+}
+
+// StreamRequestsWithResponses iterates over matching requests joined with their
+// latest response (if any), calling fn for each row. Rows are streamed from the
+// database so large exports do not have to be buffered in memory. The stream
+// is exempt from statement timeouts; ctx bounds it.
+func (q *Queries) StreamRequestsWithResponses(ctx context.Context, f ExportFilter, fn func(Request, *Response) error) error {
+	return q.unbounded(ctx, func(ctx context.Context, conn DBTX) error {
+		return streamRequestsWithResponses(ctx, conn, f, fn)
+	})
+}
+
+func streamRequestsWithResponses(ctx context.Context, conn DBTX, f ExportFilter, fn func(Request, *Response) error) error {
+	rows, err := conn.Query(ctx,
+		`SELECT r.id, r.created_by, r.entity_id, r.status, r.schema_kind, r.schema_payload,
+			r.ui_hints, r.prefill, r.expires_at, r.deadline_at, r.attention_at,
+			r.autocancel_grace, r.callback_url, r.callback_secret, r.files_policy,
+			r.flow_id, r.deleted_at, r.read_at, r.delivered_at, r.created_at, r.updated_at, r.version, r.callback_fields, r.sandbox, r.tags, r.snoozed_until, r.claimed_by, r.claimed_at, r.claim_expires_at, r.locale, r.timezone, r.deferred_until,
+			resp.id, resp.answered_at, resp.answered_by, resp.payload, resp.files
+		FROM requests r
+		LEFT JOIN LATERAL (
+			SELECT id, answered_at, answered_by, payload, files
+			FROM responses
+			WHERE request_id = r.id
+			ORDER BY answered_at DESC
+			LIMIT 1
+		) resp ON TRUE
+		WHERE r.deleted_at IS NULL
+		  AND ($1::uuid IS NULL OR r.entity_id = $1)
+		  AND ($2::text IS NULL OR r.status = $2)
+		  AND ($3::text IS NULL OR r.created_by = $3)
+		  AND ($4::timestamptz IS NULL OR r.created_at >= $4)
+		  AND ($5::timestamptz IS NULL OR r.created_at < $5)
+		ORDER BY r.created_at ASC`,
+		f.EntityID, f.Status, f.CreatedBy, f.CreatedAfter, f.CreatedBefore,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Request
+		var respID, respAnsweredBy *string
+		var respAnsweredAt *time.Time
+		var respPayload map[string]interface{}
+		var respFiles []map[string]interface{}
+		err := rows.Scan(
+			&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
+			&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
+			&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
+			&r.DeletedAt, &r.ReadAt, &r.DeliveredAt, &r.CreatedAt, &r.UpdatedAt, &r.Version, &r.CallbackFields, &r.Sandbox, &r.Tags, &r.SnoozedUntil, &r.ClaimedBy, &r.ClaimedAt, &r.ClaimExpiresAt, &r.Locale, &r.Timezone, &r.DeferredUntil,
+			&respID, &respAnsweredAt, &respAnsweredBy, &respPayload, &respFiles,
+		)
+		if err != nil {
+			return err
+		}
+
+		var resp *Response
+		if respID != nil {
+			resp = &Response{
+				ID:        *respID,
+				RequestID: r.ID,
+				Payload:   respPayload,
+				Files:     respFiles,
+			}
+			if respAnsweredAt != nil {
+				resp.AnsweredAt = *respAnsweredAt
+			}
+			if respAnsweredBy != nil {
+				resp.AnsweredBy = *respAnsweredBy
+			}
+		}
+
+		if err := fn(r, resp); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
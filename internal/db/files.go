@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// File is an uploaded file object, optionally attached to a request
+type File struct {
+	ID         string
+	ObjectKey  string
+	RequestID  *string
+	Name       string
+	MIME       string
+	Size       int64
+	SHA256     *string
+	Status     string
+	CreatedBy  *string
+	CreatedAt  time.Time
+	UploadedAt *time.Time
+	ScanStatus string
+	ScanResult *string
+	ScannedAt  *time.Time
+	// Resumable uploads only
+	UploadLength *int64
+	UploadOffset int64
+	UploadParts  []string
+	// Set once a response references the file; unreferenced files are
+	// collected after ExpiresAt
+	ResponseID *string
+	ExpiresAt  *time.Time
+}
+
+type CreateFileParams struct {
+	ID           string
+	ObjectKey    string
+	RequestID    *string
+	Name         string
+	MIME         string
+	CreatedBy    *string
+	UploadLength *int64
+	ExpiresAt    *time.Time
+}
+
+const fileColumns = `id, object_key, request_id, name, mime, size, sha256, status,
+	created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+	upload_length, upload_offset, upload_parts, response_id, expires_at`
+
+func scanFile(row interface{ Scan(...interface{}) error }) (File, error) {
+	var f File
+	err := row.Scan(&f.ID, &f.ObjectKey, &f.RequestID, &f.Name, &f.MIME, &f.Size, &f.SHA256, &f.Status,
+		&f.CreatedBy, &f.CreatedAt, &f.UploadedAt, &f.ScanStatus, &f.ScanResult, &f.ScannedAt,
+		&f.UploadLength, &f.UploadOffset, &f.UploadParts, &f.ResponseID, &f.ExpiresAt)
+	return f, err
+}
+
+// CreatePendingFile records a signed upload. Signing a key again while it
+// is still pending replaces the pending row; it returns pgx.ErrNoRows if the
+// key has already been uploaded.
+func (q *Queries) CreatePendingFile(ctx context.Context, p CreateFileParams) (File, error) {
+	return scanFile(q.Pool.QueryRow(ctx,
+		`INSERT INTO files (id, object_key, request_id, name, mime, created_by, upload_length, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (object_key) DO UPDATE
+			SET request_id = EXCLUDED.request_id, name = EXCLUDED.name,
+				mime = EXCLUDED.mime, created_by = EXCLUDED.created_by, created_at = NOW(),
+				expires_at = EXCLUDED.expires_at
+			WHERE files.status = 'pending'
+		RETURNING `+fileColumns,
+		p.ID, p.ObjectKey, p.RequestID, p.Name, p.MIME, p.CreatedBy, p.UploadLength, p.ExpiresAt,
+	))
+}
+
+func (q *Queries) GetFileByKey(ctx context.Context, key string) (File, error) {
+	return scanFile(q.Pool.QueryRow(ctx,
+		`SELECT `+fileColumns+` FROM files WHERE object_key = $1`,
+		key,
+	))
+}
+
+func (q *Queries) GetFileByID(ctx context.Context, id string) (File, error) {
+	return scanFile(q.Pool.QueryRow(ctx,
+		`SELECT `+fileColumns+` FROM files WHERE id = $1`,
+		id,
+	))
+}
+
+// AppendFilePart records a received chunk of a resumable upload, moving the
+// offset from offset to offset+size. It returns pgx.ErrNoRows if the upload
+// is no longer pending at that offset, e.g. after a concurrent append.
+func (q *Queries) AppendFilePart(ctx context.Context, id string, offset, size int64, part, mime string) (File, error) {
+	return scanFile(q.Pool.QueryRow(ctx,
+		`UPDATE files
+		SET upload_offset = upload_offset + $3, upload_parts = array_append(upload_parts, $4),
+			mime = CASE WHEN $5 = '' THEN mime ELSE $5 END
+		WHERE id = $1 AND upload_offset = $2 AND status = 'pending'
+		RETURNING `+fileColumns,
+		id, offset, size, part, mime,
+	))
+}
+
+// DeleteFile removes a file row
+func (q *Queries) DeleteFile(ctx context.Context, id string) error {
+	_, err := q.Pool.Exec(ctx, `DELETE FROM files WHERE id = $1`, id)
+	return err
+}
+
+// CompleteFileUpload marks a pending file uploaded with its initial scan
+// status. It returns pgx.ErrNoRows if the file is not pending.
+func (q *Queries) CompleteFileUpload(ctx context.Context, key, mime string, size int64, sha256, scanStatus string) (File, error) {
+	return scanFile(q.Pool.QueryRow(ctx,
+		`UPDATE files
+		SET status = 'uploaded', mime = $2, size = $3, sha256 = $4, uploaded_at = NOW(), scan_status = $5
+		WHERE object_key = $1 AND status = 'pending'
+		RETURNING `+fileColumns,
+		key, mime, size, sha256, scanStatus,
+	))
+}
+
+// SetFileScanResult records the outcome of scanning a file
+func (q *Queries) SetFileScanResult(ctx context.Context, key, status string, result *string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE files SET scan_status = $2, scan_result = $3, scanned_at = NOW() WHERE object_key = $1`,
+		key, status, result,
+	)
+	return err
+}
+
+// SumRequestFileSizes returns the total size of files uploaded for a request
+func (q *Queries) SumRequestFileSizes(ctx context.Context, requestID string) (int64, error) {
+	var total int64
+	err := q.Pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(size), 0)::bigint FROM files WHERE request_id = $1 AND status = 'uploaded'`,
+		requestID,
+	).Scan(&total)
+	return total, err
+}
+
+// SetResponseFilePreview sets previewUrl on the files of a response whose
+// url matches fileURL
+func (q *Queries) SetResponseFilePreview(ctx context.Context, responseID, fileURL, previewURL string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE responses
+		SET files = (
+			SELECT jsonb_agg(CASE WHEN f->>'url' = $2 THEN f || jsonb_build_object('previewUrl', $3::text) ELSE f END ORDER BY i)
+			FROM jsonb_array_elements(files) WITH ORDINALITY AS t(f, i)
+		)
+		WHERE id = $1 AND jsonb_array_length(files) > 0`,
+		responseID, fileURL, previewURL,
+	)
+	return err
+}
+
+// AttachFilesToComment marks the files with the given keys as attached to a
+// comment, exempting them from garbage collection
+func (q *Queries) AttachFilesToComment(ctx context.Context, commentID string, keys []string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE files SET comment_id = $1, expires_at = NULL WHERE object_key = ANY($2)`,
+		commentID, keys,
+	)
+	return err
+}
+
+// AttachFilesToResponse marks the files with the given keys as referenced by
+// a response, exempting them from garbage collection
+func (q *Queries) AttachFilesToResponse(ctx context.Context, responseID string, keys []string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE files SET response_id = $1, expires_at = NULL WHERE object_key = ANY($2)`,
+		responseID, keys,
+	)
+	return err
+}
+
+// ListExpiredFiles returns up to limit files that are not referenced by a
+// response, comment or request attachment and either expired before the given time or lost their response
+func (q *Queries) ListExpiredFiles(ctx context.Context, before time.Time, limit int) ([]File, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+fileColumns+`
+		FROM files
+		WHERE response_id IS NULL AND comment_id IS NULL AND attached_request_id IS NULL AND (expires_at IS NULL OR expires_at < $1)
+		ORDER BY expires_at ASC NULLS FIRST
+		LIMIT $2`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// DeleteExpiredFiles removes the given file rows, skipping any that were
+// referenced by a response, comment or request in the meantime
+func (q *Queries) DeleteExpiredFiles(ctx context.Context, ids []string) ([]string, error) {
+	rows, err := q.Pool.Query(ctx,
+		`DELETE FROM files WHERE id = ANY($1) AND response_id IS NULL AND comment_id IS NULL AND attached_request_id IS NULL RETURNING id`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deleted []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, id)
+	}
+	return deleted, rows.Err()
+}
+
+// StorageUsage is the uploaded file volume of one entity. EntityID is empty
+// for files not linked to a request.
+type StorageUsage struct {
+	EntityID        string
+	Files           int64
+	Bytes           int64
+	UnattachedFiles int64
+	UnattachedBytes int64
+}
+
+// GetStorageUsage sums uploaded files per entity of the owning or attaching request,
+// largest first. A non-empty entityID limits the result to that entity.
+func (q *Queries) GetStorageUsage(ctx context.Context, entityID string) ([]StorageUsage, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT COALESCE(r.entity_id, ''),
+			COUNT(*),
+			COALESCE(SUM(f.size), 0)::bigint,
+			COUNT(*) FILTER (WHERE f.response_id IS NULL AND f.comment_id IS NULL AND f.attached_request_id IS NULL),
+			COALESCE(SUM(f.size) FILTER (WHERE f.response_id IS NULL AND f.comment_id IS NULL AND f.attached_request_id IS NULL), 0)::bigint
+		FROM files f
+		LEFT JOIN requests r ON r.id = COALESCE(f.request_id, f.attached_request_id)
+		WHERE f.status = 'uploaded' AND ($1 = '' OR r.entity_id = $1)
+		GROUP BY 1
+		ORDER BY 3 DESC`,
+		entityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []StorageUsage
+	for rows.Next() {
+		var u StorageUsage
+		if err := rows.Scan(&u.EntityID, &u.Files, &u.Bytes, &u.UnattachedFiles, &u.UnattachedBytes); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,37 @@
+package db
+
+import "context"
+
+// GetEntityIdentity returns the entity linked to an external identity
+func (q *Queries) GetEntityIdentity(ctx context.Context, issuer, subject string) (string, error) {
+	var entityID string
+	err := q.Pool.QueryRow(ctx,
+		"SELECT entity_id FROM entity_identities WHERE issuer = $1 AND subject = $2",
+		issuer, subject,
+	).Scan(&entityID)
+	return entityID, err
+}
+
+// CreateEntityIdentity links an external identity to an entity. It returns
+// pgx.ErrNoRows if the identity is already linked.
+func (q *Queries) CreateEntityIdentity(ctx context.Context, issuer, subject, entityID string) error {
+	var linked string
+	return q.Pool.QueryRow(ctx,
+		`INSERT INTO entity_identities (issuer, subject, entity_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO NOTHING
+		RETURNING entity_id`,
+		issuer, subject, entityID,
+	).Scan(&linked)
+}
+
+// CreateProvisionedEntity creates a user entity for a first login. The
+// handle is left empty when it is blank or already taken.
+func (q *Queries) CreateProvisionedEntity(ctx context.Context, handle string, meta map[string]interface{}) (Entity, error) {
+	return scanEntity(q.Pool.QueryRow(ctx,
+		`INSERT INTO entities (kind, handle, meta)
+		VALUES ('user', CASE WHEN EXISTS (SELECT 1 FROM entities WHERE handle = $1) THEN NULL ELSE NULLIF($1, '') END, $2)
+		RETURNING `+entityColumns,
+		handle, meta,
+	))
+}
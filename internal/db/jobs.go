@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// States of a job in the jobs table
+const (
+	JobPending  = "pending"
+	JobActive   = "active"
+	JobArchived = "archived"
+)
+
+// Job is a background task kept in the jobs table
+type Job struct {
+	ID           string
+	Queue        string
+	Type         string
+	Payload      []byte
+	State        string
+	RunAt        time.Time
+	Retried      int
+	MaxRetry     int
+	LastError    *string
+	LastFailedAt *time.Time
+	CreatedAt    time.Time
+}
+
+const jobColumns = `id, queue, type, payload, state, run_at, retried, max_retry, last_error, last_failed_at, created_at`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (Job, error) {
+	var j Job
+	err := row.Scan(&j.ID, &j.Queue, &j.Type, &j.Payload, &j.State, &j.RunAt, &j.Retried, &j.MaxRetry, &j.LastError, &j.LastFailedAt, &j.CreatedAt)
+	return j, err
+}
+
+// InsertJob enqueues a job to run at its RunAt. Inside InTx the job only
+// becomes visible to workers when the transaction commits.
+func (q *Queries) InsertJob(ctx context.Context, j Job) error {
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO jobs (id, queue, type, payload, run_at, max_retry)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		j.ID, j.Queue, j.Type, j.Payload, j.RunAt, j.MaxRetry,
+	)
+	return err
+}
+
+// ClaimJob takes the next due job of the given queues, preferring them in
+// the order listed, and holds it for lease. A job whose worker let its
+// lease lapse is taken again and counts as retried. It returns
+// pgx.ErrNoRows when no job is due.
+func (q *Queries) ClaimJob(ctx context.Context, queues []string, lease time.Duration) (Job, error) {
+	return scanJob(q.Pool.QueryRow(ctx,
+		`UPDATE jobs SET
+			state = 'active',
+			retried = CASE WHEN state = 'active' THEN retried + 1 ELSE retried END,
+			locked_until = NOW() + make_interval(secs => $2::bigint / 1000.0)
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE queue = ANY($1::text[])
+			  AND ((state = 'pending' AND run_at <= NOW())
+			    OR (state = 'active' AND locked_until < NOW()))
+			ORDER BY array_position($1::text[], queue), run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		queues, lease.Milliseconds(),
+	))
+}
+
+// CompleteJob removes a job that ran successfully
+func (q *Queries) CompleteJob(ctx context.Context, id string) error {
+	_, err := q.Pool.Exec(ctx, `DELETE FROM jobs WHERE id = $1`, id)
+	return err
+}
+
+// RetryJob returns a failed job to pending to run again at runAt
+func (q *Queries) RetryJob(ctx context.Context, id string, runAt time.Time, lastError string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE jobs SET state = 'pending', run_at = $2, retried = retried + 1, locked_until = NULL,
+			last_error = $3, last_failed_at = NOW()
+		WHERE id = $1`,
+		id, runAt, lastError,
+	)
+	return err
+}
+
+// ArchiveJob moves a job that will not be retried to the dead-letter state
+func (q *Queries) ArchiveJob(ctx context.Context, id string, lastError string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE jobs SET state = 'archived', locked_until = NULL, last_error = $2, last_failed_at = NOW()
+		WHERE id = $1`,
+		id, lastError,
+	)
+	return err
+}
+
+// CancelJob deletes a job that has not started and reports whether it did
+func (q *Queries) CancelJob(ctx context.Context, id string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM jobs WHERE id = $1 AND state = 'pending'`, id)
+	return tag.RowsAffected() > 0, err
+}
+
+// GetJob returns a job by ID, or pgx.ErrNoRows
+func (q *Queries) GetJob(ctx context.Context, id string) (Job, error) {
+	return scanJob(q.Pool.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+}
+
+// ListArchivedJobs returns up to limit archived jobs of the given queues,
+// most recently failed first
+func (q *Queries) ListArchivedJobs(ctx context.Context, queues []string, limit int) ([]Job, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+jobColumns+` FROM jobs
+		WHERE state = 'archived' AND queue = ANY($1::text[])
+		ORDER BY last_failed_at DESC
+		LIMIT $2`,
+		queues, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]Job, 0)
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// RequeueJob moves an archived job back to pending to run now. It returns
+// pgx.ErrNoRows if the job is not archived.
+func (q *Queries) RequeueJob(ctx context.Context, id string) (Job, error) {
+	return scanJob(q.Pool.QueryRow(ctx,
+		`UPDATE jobs SET state = 'pending', run_at = NOW()
+		WHERE id = $1 AND state = 'archived'
+		RETURNING `+jobColumns,
+		id,
+	))
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MaintenanceWindow puts an entity away for a time range
+type MaintenanceWindow struct {
+	ID             string
+	EntityID       string
+	StartsAt       time.Time
+	EndsAt         time.Time
+	PauseDeadlines bool
+	Reason         *string
+	CreatedBy      string
+	CreatedAt      time.Time
+}
+
+const maintenanceWindowColumns = `id, entity_id, starts_at, ends_at, pause_deadlines, reason, created_by, created_at`
+
+func scanMaintenanceWindow(row interface{ Scan(...interface{}) error }) (MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	err := row.Scan(&w.ID, &w.EntityID, &w.StartsAt, &w.EndsAt, &w.PauseDeadlines, &w.Reason, &w.CreatedBy, &w.CreatedAt)
+	return w, err
+}
+
+func (q *Queries) CreateMaintenanceWindow(ctx context.Context, w MaintenanceWindow) (MaintenanceWindow, error) {
+	return scanMaintenanceWindow(q.Pool.QueryRow(ctx,
+		`INSERT INTO maintenance_windows (id, entity_id, starts_at, ends_at, pause_deadlines, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+maintenanceWindowColumns,
+		w.ID, w.EntityID, w.StartsAt, w.EndsAt, w.PauseDeadlines, w.Reason, w.CreatedBy,
+	))
+}
+
+// ListMaintenanceWindows returns the windows of an entity that have not
+// ended by now, soonest first
+func (q *Queries) ListMaintenanceWindows(ctx context.Context, entityID string, now time.Time) ([]MaintenanceWindow, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+maintenanceWindowColumns+` FROM maintenance_windows
+		WHERE entity_id = $1 AND ends_at > $2
+		ORDER BY starts_at, id`,
+		entityID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []MaintenanceWindow{}
+	for rows.Next() {
+		w, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// GetActiveMaintenanceWindow returns the window of an entity in effect at
+// the given time, the one ending last if they overlap, or pgx.ErrNoRows
+func (q *Queries) GetActiveMaintenanceWindow(ctx context.Context, entityID string, at time.Time) (MaintenanceWindow, error) {
+	return scanMaintenanceWindow(q.Pool.QueryRow(ctx,
+		`SELECT `+maintenanceWindowColumns+` FROM maintenance_windows
+		WHERE entity_id = $1 AND starts_at <= $2 AND ends_at > $2
+		ORDER BY ends_at DESC
+		LIMIT 1`,
+		entityID, at,
+	))
+}
+
+// DeleteMaintenanceWindow deletes a window of an entity, or returns
+// pgx.ErrNoRows if it has no such window
+func (q *Queries) DeleteMaintenanceWindow(ctx context.Context, entityID, id string) error {
+	tag, err := q.Pool.Exec(ctx,
+		`DELETE FROM maintenance_windows WHERE id = $1 AND entity_id = $2`,
+		id, entityID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
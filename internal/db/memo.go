@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestRef holds the fields of a request that are set when it is created
+// and only change through entity merges and erasures
+type RequestRef struct {
+	ID          string                 `json:"id"`
+	CreatedBy   string                 `json:"createdBy"`
+	EntityID    string                 `json:"entityId"`
+	SchemaKind  string                 `json:"schemaKind"`
+	Sandbox     bool                   `json:"sandbox"`
+	FilesPolicy map[string]interface{} `json:"filesPolicy,omitempty"`
+	CreatedAt   time.Time              `json:"createdAt"`
+}
+
+// Ref returns the immutable fields of r
+func (r Request) Ref() RequestRef {
+	return RequestRef{
+		ID:          r.ID,
+		CreatedBy:   r.CreatedBy,
+		EntityID:    r.EntityID,
+		SchemaKind:  r.SchemaKind,
+		Sandbox:     r.Sandbox,
+		FilesPolicy: r.FilesPolicy,
+		CreatedAt:   r.CreatedAt,
+	}
+}
+
+// RequestRefCache keeps RequestRefs between operations, e.g. in Redis.
+// Queries drops a request's entry whenever it writes the request, and all
+// entries on entity merges and erasures.
+type RequestRefCache interface {
+	Get(ctx context.Context, id string) (RequestRef, bool)
+	Set(ctx context.Context, ref RequestRef)
+	Delete(ctx context.Context, ids ...string)
+	Clear(ctx context.Context)
+}
+
+// SetRequestRefCache makes GetRequestRef consult cache before the database
+func (q *Queries) SetRequestRefCache(cache RequestRefCache) {
+	q.refs = cache
+}
+
+// requestMemo holds the requests read by ID during one operation
+type requestMemo struct {
+	mu   sync.Mutex
+	rows map[string]Request
+}
+
+type requestMemoKey struct{}
+
+// WithRequestMemo returns a context in which GetRequestByID reads each
+// request from the database only once, until it is written through
+// Queries. It is meant for the span of one API call, WebSocket command or
+// job, where the same request is often looked up several times. Memoized
+// rows are shared, so callers must not modify their maps and slices.
+func WithRequestMemo(ctx context.Context) context.Context {
+	if memoFrom(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, requestMemoKey{}, &requestMemo{rows: make(map[string]Request)})
+}
+
+func memoFrom(ctx context.Context) *requestMemo {
+	m, _ := ctx.Value(requestMemoKey{}).(*requestMemo)
+	return m
+}
+
+func (m *requestMemo) get(id string) (Request, bool) {
+	if m == nil {
+		return Request{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rows[id]
+	return r, ok
+}
+
+func (m *requestMemo) put(r Request) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[r.ID] = r
+}
+
+func (m *requestMemo) forget(ids []string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ids == nil {
+		m.rows = make(map[string]Request)
+		return
+	}
+	for _, id := range ids {
+		delete(m.rows, id)
+	}
+}
+
+// forgetRequests drops requests from the memo and the ref cache after they
+// were written; nil drops all of them. Inside a transaction the ref cache
+// is cleared again on commit, in case a concurrent lookup cached the rows
+// as they were before it.
+func (q *Queries) forgetRequests(ctx context.Context, ids []string) {
+	memoFrom(ctx).forget(ids)
+	if q.written != nil {
+		q.written.add(ids)
+	}
+	if q.refs == nil {
+		return
+	}
+	if ids == nil {
+		q.refs.Clear(ctx)
+	} else {
+		q.refs.Delete(ctx, ids...)
+	}
+}
+
+// writtenRequests collects the requests written in a transaction
+type writtenRequests struct {
+	mu  sync.Mutex
+	ids []string
+	all bool
+}
+
+func (w *writtenRequests) add(ids []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ids == nil {
+		w.all = true
+	}
+	w.ids = append(w.ids, ids...)
+}
+
+// GetRequestRef returns the immutable fields of a request from the memo,
+// the ref cache or the database, in that order
+func (q *Queries) GetRequestRef(ctx context.Context, id string) (RequestRef, error) {
+	if r, ok := memoFrom(ctx).get(id); ok {
+		return r.Ref(), nil
+	}
+	if q.refs != nil {
+		if ref, ok := q.refs.Get(ctx, id); ok {
+			return ref, nil
+		}
+	}
+	r, err := q.GetRequestByID(ctx, id)
+	if err != nil {
+		return RequestRef{}, err
+	}
+	ref := r.Ref()
+	if q.refs != nil && q.written == nil {
+		q.refs.Set(ctx, ref)
+	}
+	return ref, nil
+}
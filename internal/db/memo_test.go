@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDB answers every query with a request row holding only its ID
+type countingDB struct {
+	reads, writes int
+}
+
+func (c *countingDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	c.writes++
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (c *countingDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	panic("not used")
+}
+
+func (c *countingDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	c.reads++
+	return idRow{id: args[0].(string)}
+}
+
+type idRow struct{ id string }
+
+func (r idRow) Scan(dest ...any) error {
+	*dest[0].(*string) = r.id
+	return nil
+}
+
+// memoryRefs is a RequestRefCache in a map
+type memoryRefs map[string]RequestRef
+
+func (m memoryRefs) Get(ctx context.Context, id string) (RequestRef, bool) {
+	ref, ok := m[id]
+	return ref, ok
+}
+func (m memoryRefs) Set(ctx context.Context, ref RequestRef) { m[ref.ID] = ref }
+func (m memoryRefs) Delete(ctx context.Context, ids ...string) {
+	for _, id := range ids {
+		delete(m, id)
+	}
+}
+func (m memoryRefs) Clear(ctx context.Context) {
+	for id := range m {
+		delete(m, id)
+	}
+}
+
+func TestRequestMemo(t *testing.T) {
+	conn := &countingDB{}
+	q := NewQueries(conn)
+
+	// Without a memo every lookup reads
+	_, err := q.GetRequestByID(context.Background(), "req-1")
+	require.NoError(t, err)
+	_, err = q.GetRequestByID(context.Background(), "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, conn.reads)
+
+	ctx := WithRequestMemo(context.Background())
+	assert.Equal(t, ctx, WithRequestMemo(ctx))
+	for i := 0; i < 3; i++ {
+		r, err := q.GetRequestByID(ctx, "req-1")
+		require.NoError(t, err)
+		assert.Equal(t, "req-1", r.ID)
+	}
+	assert.Equal(t, 3, conn.reads)
+
+	// A write drops the request from the memo
+	require.NoError(t, q.MarkInquiryRead(ctx, "req-1"))
+	_, err = q.GetRequestByID(ctx, "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 4, conn.reads)
+}
+
+func TestGetRequestRef(t *testing.T) {
+	conn := &countingDB{}
+	q := NewQueries(conn)
+	refs := memoryRefs{}
+	q.SetRequestRefCache(refs)
+	ctx := context.Background()
+
+	ref, err := q.GetRequestRef(ctx, "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", ref.ID)
+	assert.Contains(t, refs, "req-1")
+
+	// Served from the cache in another operation
+	_, err = q.GetRequestRef(ctx, "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, conn.reads)
+
+	require.NoError(t, q.UpdateRequestStatus(ctx, "req-1", "CANCELLED", nil))
+	assert.NotContains(t, refs, "req-1")
+
+	refs.Set(ctx, RequestRef{ID: "req-2"})
+	_, err = q.DeleteSandboxRequests(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, refs)
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetMergedEntity returns the entity an entity with the given ID was
+// merged into
+func (q *Queries) GetMergedEntity(ctx context.Context, sourceID string) (Entity, error) {
+	return scanEntity(q.Pool.QueryRow(ctx,
+		`SELECT `+entityColumns+` FROM entities
+		WHERE id = (SELECT target_id FROM entity_redirects WHERE source_id = $1)`,
+		sourceID,
+	))
+}
+
+// GetMergedEntityByHandle returns the entity the most recently merged
+// entity with the given handle went into
+func (q *Queries) GetMergedEntityByHandle(ctx context.Context, handle string) (Entity, error) {
+	return scanEntity(q.Pool.QueryRow(ctx,
+		`SELECT `+entityColumns+` FROM entities
+		WHERE id = (
+			SELECT target_id FROM entity_redirects
+			WHERE source_handle = $1
+			ORDER BY merged_at DESC LIMIT 1
+		)`,
+		handle,
+	))
+}
+
+// MergeEntityData moves everything of the source entity to the target:
+// requests addressed to it and their claims and bundles, its responses,
+// comments and share link answers, owned flows, reminders, linked
+// identities, push notification devices, saved views and maintenance
+// windows. Saved views whose name the target already uses are dropped, and
+// the source's notification preferences, business calendar, Telegram chat
+// and calendar feed token are only kept if the target has none. The target's metadata wins
+// over the source's. Redirects to the source are pointed at the target, a
+// redirect from the source is recorded and the source is deleted;
+// pgx.ErrNoRows is returned if it no longer exists. Run it in a
+// transaction.
+func (q *Queries) MergeEntityData(ctx context.Context, sourceID, targetID, mergedBy string) (model.MergeReport, error) {
+	defer q.forgetRequests(ctx, nil)
+	var report model.MergeReport
+	args := []interface{}{sourceID, targetID}
+	steps := []erasureStep{
+		{&report.Requests, `UPDATE requests SET entity_id = $2, updated_at = NOW() WHERE entity_id = $1`, args},
+		{&report.Claims, `UPDATE requests SET claimed_by = $2::text WHERE claimed_by = $1::text`, args},
+		{&report.Responses, `UPDATE responses SET answered_by = $2 WHERE answered_by = $1`, args},
+		{&report.Comments, `UPDATE request_comments SET author = $2::text
+			WHERE author = $1::text AND author_role = 'entity'`, args},
+		{&report.Flows, `UPDATE flows SET owner_entity = $2, updated_at = NOW() WHERE owner_entity = $1`, args},
+		{&report.Bundles, `UPDATE request_bundles SET entity_id = $2 WHERE entity_id = $1`, args},
+		{&report.ShareLinks, `UPDATE share_links SET used_by = $2 WHERE used_by = $1`, args},
+		{&report.Reminders, `UPDATE reminders SET entity_id = $2 WHERE entity_id = $1`, args},
+		{&report.Identities, `UPDATE entity_identities SET entity_id = $2 WHERE entity_id = $1`, args},
+		{&report.Devices, `UPDATE devices SET entity_id = $2, updated_at = NOW() WHERE entity_id = $1`, args},
+		{&report.TelegramChats, `UPDATE telegram_chats SET entity_id = $2
+			WHERE entity_id = $1
+			  AND NOT EXISTS (SELECT 1 FROM telegram_chats WHERE entity_id = $2)`, args},
+		{&report.CalendarFeeds, `UPDATE calendar_feeds SET entity_id = $2
+			WHERE entity_id = $1
+			  AND NOT EXISTS (SELECT 1 FROM calendar_feeds WHERE entity_id = $2)`, args},
+		{&report.SavedViews, `UPDATE saved_views SET entity_id = $2, updated_at = NOW()
+			WHERE entity_id = $1
+			  AND name NOT IN (SELECT name FROM saved_views WHERE entity_id = $2)`, args},
+		{&report.MaintenanceWindows, `UPDATE maintenance_windows SET entity_id = $2 WHERE entity_id = $1`, args},
+		{&report.BusinessCalendars, `UPDATE business_calendars SET entity_id = $2, updated_at = NOW()
+			WHERE entity_id = $1
+			  AND NOT EXISTS (SELECT 1 FROM business_calendars WHERE entity_id = $2)`, args},
+		{&report.Preferences, `UPDATE notification_preferences SET entity_id = $2, updated_at = NOW()
+			WHERE entity_id = $1
+			  AND NOT EXISTS (SELECT 1 FROM notification_preferences WHERE entity_id = $2)`, args},
+		{&report.Redirects, `UPDATE entity_redirects SET target_id = $2 WHERE target_id = $1`, args},
+	}
+	if err := q.execSteps(ctx, steps); err != nil {
+		return report, err
+	}
+
+	if _, err := q.Pool.Exec(ctx,
+		`UPDATE entities t SET meta = s.meta || t.meta
+		FROM entities s
+		WHERE t.id = $2 AND s.id = $1`,
+		sourceID, targetID,
+	); err != nil {
+		return report, err
+	}
+	if _, err := q.Pool.Exec(ctx,
+		`INSERT INTO entity_redirects (source_id, source_handle, target_id, merged_by)
+		SELECT id, handle, $2::uuid, $3::text FROM entities WHERE id = $1`,
+		sourceID, targetID, mergedBy,
+	); err != nil {
+		return report, err
+	}
+
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM entities WHERE id = $1`, sourceID)
+	if err != nil {
+		return report, err
+	}
+	if tag.RowsAffected() == 0 {
+		return report, pgx.ErrNoRows
+	}
+	return report, nil
+}
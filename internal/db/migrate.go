@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"pxbox/migrations"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// NewMigrator returns a goose provider for the embedded migrations. Its
+// operations hold a Postgres advisory lock, so instances started together
+// migrate one at a time. Versions recorded by the former schema_migrations
+// runner are carried over to goose on first use.
+func NewMigrator(ctx context.Context, sqlDB *sql.DB) (*goose.Provider, error) {
+	if err := adoptLegacyVersions(ctx, sqlDB); err != nil {
+		return nil, fmt.Errorf("failed to adopt schema_migrations: %w", err)
+	}
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, sqlDB, migrations.FS,
+		goose.WithSessionLocker(locker),
+		goose.WithDisableGlobalRegistry(true),
+	)
+}
+
+// Migrate applies all pending migrations
+func Migrate(ctx context.Context, sqlDB *sql.DB) ([]*goose.MigrationResult, error) {
+	m, err := NewMigrator(ctx, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+	return m.Up(ctx)
+}
+
+// adoptLegacyVersions records the versions in schema_migrations, the table
+// of the runner used before goose, as applied in goose's version table.
+// Nothing is done once that table exists.
+func adoptLegacyVersions(ctx context.Context, sqlDB *sql.DB) error {
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('pxbox_adopt_migrations'))`); err != nil {
+		return err
+	}
+	var legacy, adopted bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT to_regclass('schema_migrations') IS NOT NULL, to_regclass($1) IS NOT NULL`,
+		goose.DefaultTablename,
+	).Scan(&legacy, &adopted)
+	if err != nil || !legacy || adopted {
+		return err
+	}
+
+	store, err := database.NewStore(database.DialectPostgres, goose.DefaultTablename)
+	if err != nil {
+		return err
+	}
+	if err := store.CreateVersionTable(ctx, tx); err != nil {
+		return err
+	}
+	// goose records version 0 when it creates the table itself
+	if err := store.Insert(ctx, tx, database.InsertRequest{Version: 0}); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return err
+	}
+	var versions []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		versions = append(versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err := store.Insert(ctx, tx, database.InsertRequest{Version: v}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
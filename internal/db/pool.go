@@ -3,7 +3,13 @@ package db
 import (
 	"context"
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
+	"pxbox/internal/breaker"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
@@ -14,11 +20,27 @@ type Pool struct {
 	log *zap.Logger
 }
 
-func NewPool(databaseURL string) (*Pool, error) {
+// NewPool connects to databaseURL with the pool settings of the DB_*
+// environment variables. log receives circuit breaker and pool reports.
+func NewPool(databaseURL string, log *zap.Logger) (*Pool, error) {
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database URL: %w", err)
 	}
+	if err := poolConfigFromEnv(config); err != nil {
+		return nil, err
+	}
+	if err := statementCacheFromEnv(config.ConnConfig); err != nil {
+		return nil, err
+	}
+	timeouts, err := TimeoutsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	// A statement_timeout in DATABASE_URL takes precedence
+	if _, set := config.ConnConfig.RuntimeParams["statement_timeout"]; !set && timeouts.Statement > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(timeouts.Statement.Milliseconds(), 10)
+	}
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
@@ -30,14 +52,96 @@ func NewPool(databaseURL string) (*Pool, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	logger, _ := zap.NewProduction()
+	if log == nil {
+		log = zap.NewNop()
+	}
+	b := breaker.New("postgres", breaker.FromEnv(breaker.Settings{
+		IsFailure:     IsDBFailure,
+		OnStateChange: breaker.LogStateChange(log),
+	}))
 	return &Pool{
 		Pool:    pool,
-		Queries: NewQueries(pool),
-		log:     logger,
+		Queries: NewQueries(WithTimeouts(WithBreaker(pool, b), timeouts)),
+		log:     log,
 	}, nil
 }
 
+// poolConfigFromEnv applies DB_MAX_CONNS, DB_MIN_CONNS,
+// DB_MAX_CONN_LIFETIME, DB_MAX_CONN_IDLE_TIME and DB_HEALTH_CHECK_PERIOD.
+// Unset ones keep the pool_* parameters of the database URL or the pgxpool
+// defaults.
+func poolConfigFromEnv(config *pgxpool.Config) error {
+	for name, n := range map[string]*int32{
+		"DB_MAX_CONNS": &config.MaxConns,
+		"DB_MIN_CONNS": &config.MinConns,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+		*n = int32(parsed)
+	}
+	for name, d := range map[string]*time.Duration{
+		"DB_MAX_CONN_LIFETIME":   &config.MaxConnLifetime,
+		"DB_MAX_CONN_IDLE_TIME":  &config.MaxConnIdleTime,
+		"DB_HEALTH_CHECK_PERIOD": &config.HealthCheckPeriod,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+		*d = parsed
+	}
+	if config.MaxConns < 1 {
+		return fmt.Errorf("DB_MAX_CONNS must be at least 1")
+	}
+	if config.MinConns > config.MaxConns {
+		return fmt.Errorf("DB_MIN_CONNS (%d) exceeds DB_MAX_CONNS (%d)", config.MinConns, config.MaxConns)
+	}
+	return nil
+}
+
+// queryExecModes are the values of DB_QUERY_EXEC_MODE
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// statementCacheFromEnv applies DB_QUERY_EXEC_MODE and
+// DB_STATEMENT_CACHE_CAPACITY. By default pgx prepares each statement once
+// per connection and keeps 512 of them; behind a transaction pooler such as
+// PgBouncer, where connections change between statements, use exec or
+// simple_protocol instead.
+func statementCacheFromEnv(config *pgx.ConnConfig) error {
+	if v := os.Getenv("DB_QUERY_EXEC_MODE"); v != "" {
+		mode, ok := queryExecModes[v]
+		if !ok {
+			return fmt.Errorf("unknown DB_QUERY_EXEC_MODE %q", v)
+		}
+		config.DefaultQueryExecMode = mode
+	}
+	if v := os.Getenv("DB_STATEMENT_CACHE_CAPACITY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid DB_STATEMENT_CACHE_CAPACITY %q", v)
+		}
+		config.StatementCacheCapacity = n
+		config.DescriptionCacheCapacity = n
+	}
+	return nil
+}
+
 func (p *Pool) Close() {
 	p.Pool.Close()
 }
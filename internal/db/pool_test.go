@@ -0,0 +1,32 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolConfigFromEnv(t *testing.T) {
+	config, err := pgxpool.ParseConfig("postgres://localhost/pxbox?pool_max_conns=8")
+	require.NoError(t, err)
+	require.NoError(t, poolConfigFromEnv(config))
+	assert.Equal(t, int32(8), config.MaxConns)
+
+	t.Setenv("DB_MAX_CONNS", "20")
+	t.Setenv("DB_MIN_CONNS", "2")
+	t.Setenv("DB_MAX_CONN_LIFETIME", "30m")
+	t.Setenv("DB_HEALTH_CHECK_PERIOD", "10s")
+	require.NoError(t, poolConfigFromEnv(config))
+	assert.Equal(t, int32(20), config.MaxConns)
+	assert.Equal(t, int32(2), config.MinConns)
+	assert.Equal(t, 30*time.Minute, config.MaxConnLifetime)
+	assert.Equal(t, 10*time.Second, config.HealthCheckPeriod)
+
+	t.Setenv("DB_MIN_CONNS", "21")
+	assert.Error(t, poolConfigFromEnv(config))
+	t.Setenv("DB_MAX_CONN_IDLE_TIME", "forever")
+	assert.Error(t, poolConfigFromEnv(config))
+}
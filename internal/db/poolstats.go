@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// PoolReportInterval is how often ReportStats samples the pool
+const PoolReportInterval = 15 * time.Second
+
+// slowAcquire is the average acquire wait over a report interval above
+// which the pool is reported as undersized
+const slowAcquire = 50 * time.Millisecond
+
+// poolSample is the cumulative part of pgxpool.Stat
+type poolSample struct {
+	acquires      int64
+	emptyAcquires int64
+	acquireWait   time.Duration
+}
+
+func samplePool(s *pgxpool.Stat) poolSample {
+	return poolSample{
+		acquires:      s.AcquireCount(),
+		emptyAcquires: s.EmptyAcquireCount(),
+		acquireWait:   s.AcquireDuration(),
+	}
+}
+
+// ReportStats exports the pool's connection counts and acquire waits as
+// metrics every interval until ctx is cancelled, and warns when requests
+// waited long for a connection, which means DB_MAX_CONNS is too low for
+// the load or connections are held too long
+func (p *Pool) ReportStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := samplePool(p.Pool.Stat())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		last = p.report(last)
+	}
+}
+
+// report records the change since last and returns the new sample
+func (p *Pool) report(last poolSample) poolSample {
+	stat := p.Pool.Stat()
+	metrics.DBPoolConnections.WithLabelValues("idle").Set(float64(stat.IdleConns()))
+	metrics.DBPoolConnections.WithLabelValues("acquired").Set(float64(stat.AcquiredConns()))
+	metrics.DBPoolConnections.WithLabelValues("constructing").Set(float64(stat.ConstructingConns()))
+	metrics.DBPoolConnections.WithLabelValues("max").Set(float64(stat.MaxConns()))
+
+	cur := samplePool(stat)
+	acquires := cur.acquires - last.acquires
+	emptyAcquires := cur.emptyAcquires - last.emptyAcquires
+	wait := cur.acquireWait - last.acquireWait
+	metrics.DBPoolAcquires.Add(float64(acquires))
+	metrics.DBPoolEmptyAcquires.Add(float64(emptyAcquires))
+	metrics.DBPoolAcquireWait.Add(wait.Seconds())
+
+	if acquires > 0 && emptyAcquires > 0 {
+		if avg := wait / time.Duration(acquires); avg > slowAcquire {
+			p.log.Warn("Database connections are scarce",
+				zap.Duration("avgAcquireWait", avg),
+				zap.Int64("acquires", acquires),
+				zap.Int64("emptyAcquires", emptyAcquires),
+				zap.Int32("acquiredConns", stat.AcquiredConns()),
+				zap.Int32("maxConns", stat.MaxConns()),
+			)
+		}
+	}
+	return cur
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/model"
+)
+
+const preferencesColumns = `channels, quiet_start, quiet_end, timezone, digest, digest_at, updated_at`
+
+// scanPreferences scans preferencesColumns, after the leading columns
+// scanned into extra
+func scanPreferences(row interface{ Scan(...interface{}) error }, extra ...interface{}) (model.NotificationPreferences, error) {
+	var p model.NotificationPreferences
+	var quietStart, quietEnd *string
+	var updatedAt time.Time
+	err := row.Scan(append(extra, &p.Channels, &quietStart, &quietEnd, &p.Timezone, &p.Digest, &p.DigestAt, &updatedAt)...)
+	if quietStart != nil && quietEnd != nil {
+		p.QuietHours = &model.QuietHours{Start: *quietStart, End: *quietEnd}
+	}
+	p.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return p, err
+}
+
+// GetNotificationPreferences returns the preferences an entity set, or
+// pgx.ErrNoRows if it never set any
+func (q *Queries) GetNotificationPreferences(ctx context.Context, entityID string) (model.NotificationPreferences, error) {
+	return scanPreferences(q.Pool.QueryRow(ctx,
+		`SELECT `+preferencesColumns+` FROM notification_preferences WHERE entity_id = $1`,
+		entityID,
+	))
+}
+
+// UpsertNotificationPreferences replaces the preferences of an entity
+func (q *Queries) UpsertNotificationPreferences(ctx context.Context, entityID string, p model.NotificationPreferences) (model.NotificationPreferences, error) {
+	var quietStart, quietEnd *string
+	if p.QuietHours != nil {
+		quietStart, quietEnd = &p.QuietHours.Start, &p.QuietHours.End
+	}
+	return scanPreferences(q.Pool.QueryRow(ctx,
+		`INSERT INTO notification_preferences (entity_id, channels, quiet_start, quiet_end, timezone, digest, digest_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (entity_id) DO UPDATE
+		SET channels = EXCLUDED.channels, quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+			timezone = EXCLUDED.timezone, digest = EXCLUDED.digest, digest_at = EXCLUDED.digest_at, updated_at = NOW()
+		RETURNING `+preferencesColumns,
+		entityID, p.Channels, quietStart, quietEnd, p.Timezone, p.Digest, p.DigestAt,
+	))
+}
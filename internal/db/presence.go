@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RenewPresenceLease extends the lease of an API instance on an entity
+// until expiresAt and drops the lapsed leases of other instances
+func (q *Queries) RenewPresenceLease(ctx context.Context, entityID, instance string, expiresAt time.Time) error {
+	_, err := q.Pool.Exec(ctx,
+		`WITH lapsed AS (
+			DELETE FROM presence_leases WHERE entity_id = $1 AND instance <> $2 AND expires_at < NOW()
+		)
+		INSERT INTO presence_leases (entity_id, instance, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (entity_id, instance) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+		entityID, instance, expiresAt,
+	)
+	return err
+}
+
+// ClearPresenceLease drops the lease of an instance on an entity and
+// records when the entity was last seen
+func (q *Queries) ClearPresenceLease(ctx context.Context, entityID, instance string, lastSeenAt time.Time) error {
+	_, err := q.Pool.Exec(ctx,
+		`WITH cleared AS (
+			DELETE FROM presence_leases WHERE entity_id = $1 AND instance = $2
+		)
+		INSERT INTO presence_last_seen (entity_id, last_seen_at)
+		VALUES ($1, $3)
+		ON CONFLICT (entity_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at`,
+		entityID, instance, lastSeenAt,
+	)
+	return err
+}
+
+// EntityOnline reports whether any instance holds an unexpired lease on
+// an entity
+func (q *Queries) EntityOnline(ctx context.Context, entityID string) (bool, error) {
+	var online bool
+	err := q.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM presence_leases WHERE entity_id = $1 AND expires_at >= NOW())`,
+		entityID,
+	).Scan(&online)
+	return online, err
+}
+
+// GetEntityLastSeen returns when an entity's last connection closed. It
+// returns pgx.ErrNoRows if it was never seen.
+func (q *Queries) GetEntityLastSeen(ctx context.Context, entityID string) (time.Time, error) {
+	var lastSeenAt time.Time
+	err := q.Pool.QueryRow(ctx,
+		`SELECT last_seen_at FROM presence_last_seen WHERE entity_id = $1`,
+		entityID,
+	).Scan(&lastSeenAt)
+	return lastSeenAt, err
+}
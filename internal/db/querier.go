@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/model"
+)
+
+// Querier is the set of queries services run. *Queries implements it
+// against Postgres; tests can substitute an in-memory implementation.
+type Querier interface {
+	InsertAuditEntry(ctx context.Context, e InsertAuditEntryParams) error
+	LockAuditChain(ctx context.Context) error
+	GetAuditChainHead(ctx context.Context) (AuditEntry, error)
+	ListAuditChain(ctx context.Context, afterID int64, limit int) ([]AuditEntry, error)
+	InsertAuditAnchor(ctx context.Context, entryID int64, hash string, location *string) (AuditAnchor, error)
+	GetLatestAuditAnchor(ctx context.Context) (AuditAnchor, error)
+	ListAuditAnchors(ctx context.Context) ([]AuditAnchor, error)
+	ListAuditEntries(ctx context.Context, f AuditFilter, limit, offset int) ([]AuditEntry, error)
+
+	UpsertBotHandler(ctx context.Context, entityID, url, secret string) (BotHandler, error)
+	GetBotHandler(ctx context.Context, entityID string) (BotHandler, error)
+	DeleteBotHandler(ctx context.Context, entityID string) (bool, error)
+
+	CreateComment(ctx context.Context, p CreateCommentParams) (Comment, error)
+	ListComments(ctx context.Context, requestID string, limit, offset int) ([]Comment, error)
+
+	ListDigestItems(ctx context.Context, entityID string, since, soon time.Time, limit int) ([]DigestItem, error)
+	ListDigestSubscribers(ctx context.Context) ([]DigestSubscriber, error)
+	MarkDigestScheduled(ctx context.Context, entityID string, slot time.Time) (bool, error)
+
+	ListEntities(ctx context.Context, f EntityFilter, limit, offset int) ([]Entity, error)
+	SetEntityDeactivated(ctx context.Context, id string, at *time.Time) (Entity, error)
+
+	CreateErasure(ctx context.Context, id, entityID, mode, requestedBy string) (Erasure, error)
+	GetErasure(ctx context.Context, id string) (Erasure, error)
+	StartErasure(ctx context.Context, id string) (Erasure, error)
+	FinishErasure(ctx context.Context, id, status string, report *model.ErasureReport, errMsg *string) error
+	GetErasureTargets(ctx context.Context, entityID string) (ErasureTargets, error)
+	DeleteEntityData(ctx context.Context, entityID string, objectKeys []string) (model.ErasureReport, error)
+	AnonymizeEntityData(ctx context.Context, entityID string, objectKeys []string) (model.ErasureReport, error)
+
+	StreamRequestsWithResponses(ctx context.Context, f ExportFilter, fn func(Request, *Response) error) error
+
+	CreatePendingFile(ctx context.Context, p CreateFileParams) (File, error)
+	GetFileByKey(ctx context.Context, key string) (File, error)
+	GetFileByID(ctx context.Context, id string) (File, error)
+	AppendFilePart(ctx context.Context, id string, offset, size int64, part, mime string) (File, error)
+	DeleteFile(ctx context.Context, id string) error
+	CompleteFileUpload(ctx context.Context, key, mime string, size int64, sha256, scanStatus string) (File, error)
+	SetFileScanResult(ctx context.Context, key, status string, result *string) error
+	SumRequestFileSizes(ctx context.Context, requestID string) (int64, error)
+	SetResponseFilePreview(ctx context.Context, responseID, fileURL, previewURL string) error
+	AttachFilesToComment(ctx context.Context, commentID string, keys []string) error
+	CreateRequestFiles(ctx context.Context, requestID string, files []map[string]interface{}, keys []string) error
+	ListRequestFiles(ctx context.Context, requestID string) ([]map[string]interface{}, error)
+	AttachFilesToResponse(ctx context.Context, responseID string, keys []string) error
+	ListExpiredFiles(ctx context.Context, before time.Time, limit int) ([]File, error)
+	DeleteExpiredFiles(ctx context.Context, ids []string) ([]string, error)
+	GetStorageUsage(ctx context.Context, entityID string) ([]StorageUsage, error)
+
+	GetEntityIdentity(ctx context.Context, issuer, subject string) (string, error)
+	CreateEntityIdentity(ctx context.Context, issuer, subject, entityID string) error
+	CreateProvisionedEntity(ctx context.Context, handle string, meta map[string]interface{}) (Entity, error)
+
+	GetMergedEntity(ctx context.Context, sourceID string) (Entity, error)
+	GetMergedEntityByHandle(ctx context.Context, handle string) (Entity, error)
+	MergeEntityData(ctx context.Context, sourceID, targetID, mergedBy string) (model.MergeReport, error)
+
+	GetNotificationPreferences(ctx context.Context, entityID string) (model.NotificationPreferences, error)
+	UpsertNotificationPreferences(ctx context.Context, entityID string, p model.NotificationPreferences) (model.NotificationPreferences, error)
+	GetBusinessCalendar(ctx context.Context, entityID string) (model.BusinessCalendar, error)
+	UpsertBusinessCalendar(ctx context.Context, entityID string, c model.BusinessCalendar) (model.BusinessCalendar, error)
+	SetCalendarFeedToken(ctx context.Context, entityID, tokenHash string) (time.Time, error)
+	GetCalendarFeedEntity(ctx context.Context, tokenHash string) (string, error)
+	DeleteCalendarFeedToken(ctx context.Context, entityID string) (bool, error)
+	UpsertDevice(ctx context.Context, d Device) (Device, error)
+	ListDevices(ctx context.Context, entityID string) ([]Device, error)
+	DeleteDevice(ctx context.Context, entityID, id string) error
+	HasNotificationTargets(ctx context.Context, entityID string) (bool, error)
+	SetTelegramLinkCode(ctx context.Context, entityID, codeHash string, expiresAt time.Time) error
+	LinkTelegramChat(ctx context.Context, codeHash string, chatID int64) (string, error)
+	GetTelegramChat(ctx context.Context, entityID string) (TelegramChat, error)
+	GetTelegramChatEntity(ctx context.Context, chatID int64) (string, error)
+	DeleteTelegramChat(ctx context.Context, entityID string) (bool, error)
+
+	GetEntityByID(ctx context.Context, id string) (Entity, error)
+	GetEntityByHandle(ctx context.Context, handle string) (Entity, error)
+	CreateEntity(ctx context.Context, kind, handle string, meta map[string]interface{}, sandbox bool) (Entity, error)
+	UpdateEntity(ctx context.Context, id string, handle *string, meta map[string]interface{}) (Entity, error)
+	CreateRequest(ctx context.Context, req CreateRequestParams) (Request, error)
+	CreateRequests(ctx context.Context, reqs []CreateRequestParams) ([]Request, error)
+	GetRequestByID(ctx context.Context, id string) (Request, error)
+	GetRequestRef(ctx context.Context, id string) (RequestRef, error)
+	UpdateRequestStatus(ctx context.Context, id, status string, expectedVersion *int) error
+	ClaimRequest(ctx context.Context, id, claimedBy string, expiresAt *time.Time, expectedVersion *int) error
+	UnclaimRequest(ctx context.Context, id string, expiredOnly bool, expectedVersion *int) error
+	AnswerRequest(ctx context.Context, resp CreateResponseParams, expectedVersion *int) (Response, error)
+	ReviewResponse(ctx context.Context, p ReviewResponseParams, expectedVersion *int) (int, error)
+	GetEntityQueue(ctx context.Context, entityID string, status *string, includeSnoozed bool, limit, offset int) ([]Request, error)
+	CreateResponse(ctx context.Context, resp CreateResponseParams) (Response, error)
+	GetResponseByRequestID(ctx context.Context, requestID string) (Response, error)
+	CreateFlow(ctx context.Context, flow CreateFlowParams) (Flow, error)
+	GetFlowByID(ctx context.Context, id string) (Flow, error)
+	UpdateFlowStatus(ctx context.Context, id, status string) error
+	UpdateFlowCursor(ctx context.Context, id string, cursor map[string]interface{}) error
+	SetFlowLastEventID(ctx context.Context, id, eventID string) error
+	ListChildFlows(ctx context.Context, parentID string) ([]Flow, error)
+	LockFlow(ctx context.Context, id string) error
+	ListFlows(ctx context.Context, f FlowFilter, after *Flow, limit int) ([]Flow, error)
+	CountFlowsByStatus(ctx context.Context, f FlowFilter) (map[string]int, error)
+	SoftDeleteFlows(ctx context.Context, ids []string) error
+	ArchiveFlows(ctx context.Context, finishedBefore time.Time, limit int) ([]Flow, error)
+	GetReminderByID(ctx context.Context, id string) (Reminder, error)
+	CreateReminder(ctx context.Context, requestID, entityID string, remindAt time.Time) (Reminder, error)
+	DeletePendingReminders(ctx context.Context, requestID, entityID string) ([]Reminder, error)
+	SetReminderTask(ctx context.Context, id, taskID string) error
+	ListReminders(ctx context.Context, requestID, entityID string) ([]Reminder, error)
+	DeleteReminder(ctx context.Context, id string) (Reminder, error)
+	MarkRequestDelivered(ctx context.Context, id, entityID string) (time.Time, error)
+	SnoozeRequest(ctx context.Context, id, entityID string, until time.Time) error
+	UnsnoozeRequest(ctx context.Context, id string, dueAt time.Time) (bool, error)
+	MarkInquiryRead(ctx context.Context, id string) error
+	SoftDeleteInquiry(ctx context.Context, id string, expectedVersion *int) error
+	GetInquiryByID(ctx context.Context, id string) (Request, error)
+	GetFlowsByStatus(ctx context.Context, statuses []string) ([]Flow, error)
+	GetStaleFlows(ctx context.Context, statuses []string, updatedBefore time.Time, after *Flow, limit int) ([]Flow, error)
+	GetDueFlows(ctx context.Context, before time.Time, after *Flow, limit int) ([]Flow, error)
+	MarkFlowsChecked(ctx context.Context, ids []string) error
+
+	ListPrefills(ctx context.Context, afterID string, limit int) ([]StoredValue, error)
+	ListResponsePayloads(ctx context.Context, afterID string, limit int) ([]StoredValue, error)
+	UpdatePrefill(ctx context.Context, id string, prefill map[string]interface{}) error
+	UpdateResponsePayload(ctx context.Context, id string, payload map[string]interface{}) error
+
+	ListExpiredSandboxRequests(ctx context.Context, before time.Time, limit int) ([]SandboxRequest, error)
+	DeleteSandboxRequests(ctx context.Context, ids []string) (int64, error)
+
+	SearchRequests(ctx context.Context, f RequestFilter, sortBy string, limit, offset int) ([]Request, error)
+
+	ListRequestCounts(ctx context.Context, f StatsFilter, materialized bool) ([]RequestCount, *time.Time, error)
+	ListFlowCounts(ctx context.Context, f StatsFilter, materialized bool) ([]FlowCount, *time.Time, error)
+	RefreshStats(ctx context.Context) error
+
+	SetRequestTags(ctx context.Context, id string, tags []string, expectedVersion *int) (int, error)
+	GetEntityTagSummary(ctx context.Context, entityID string) ([]TagSummary, error)
+
+	SaveRequestTask(ctx context.Context, t RequestTask) error
+	ListRequestTasks(ctx context.Context, requestID string) ([]RequestTask, error)
+	DeleteRequestTask(ctx context.Context, requestID, kind string) error
+	UpdateRequestDeadline(ctx context.Context, id string, deadlineAt time.Time, expectedVersion *int) (int, error)
+	GetQuotaUsage(ctx context.Context, createdBy, entityID string, since time.Time) (QuotaUsage, error)
+	InsertJob(ctx context.Context, j Job) error
+
+	InTx(ctx context.Context, fn func(Querier) error) error
+
+	CreateSavedView(ctx context.Context, id, entityID, name string, filter map[string]interface{}) (SavedView, error)
+	GetSavedView(ctx context.Context, id string) (SavedView, error)
+	ListSavedViews(ctx context.Context, entityID string) ([]SavedView, error)
+	UpdateSavedView(ctx context.Context, id, entityID, name string, filter map[string]interface{}) (SavedView, error)
+	DeleteSavedView(ctx context.Context, id, entityID string) (bool, error)
+
+	CreateBundle(ctx context.Context, p CreateBundleParams) (Bundle, error)
+	GetBundle(ctx context.Context, id string) (Bundle, error)
+	GetRequestBundleIDs(ctx context.Context, requestIDs []string) (map[string]string, error)
+	CompleteRequestBundle(ctx context.Context, requestID string) (Bundle, error)
+
+	CreateShareLink(ctx context.Context, p CreateShareLinkParams) (ShareLink, error)
+	GetShareLinkByToken(ctx context.Context, tokenHash string) (ShareLink, error)
+	UseShareLink(ctx context.Context, tokenHash string) (ShareLink, error)
+	ReleaseShareLink(ctx context.Context, id string) error
+	SetShareLinkAnswerer(ctx context.Context, id, entityID string) error
+
+	CreateMaintenanceWindow(ctx context.Context, w MaintenanceWindow) (MaintenanceWindow, error)
+	ListMaintenanceWindows(ctx context.Context, entityID string, now time.Time) ([]MaintenanceWindow, error)
+	GetActiveMaintenanceWindow(ctx context.Context, entityID string, at time.Time) (MaintenanceWindow, error)
+	DeleteMaintenanceWindow(ctx context.Context, entityID, id string) error
+
+	CreateWebhook(ctx context.Context, p CreateWebhookParams) (Webhook, error)
+	GetWebhook(ctx context.Context, id string) (Webhook, error)
+	ListWebhooks(ctx context.Context, channel string, activeOnly bool) ([]Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, url *string, eventTypes []string, active *bool) (Webhook, error)
+	RotateWebhookSecret(ctx context.Context, id, secret string, previousExpiresAt time.Time) (Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) (bool, error)
+	CreateWebhookDelivery(ctx context.Context, id, webhookID, eventType string, event map[string]interface{}) (WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, id string) (WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, webhookID string, status *string, limit, offset int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id, status string, responseStatus *int, errMsg *string) error
+}
+
+var _ Querier = (*Queries)(nil)
@@ -2,57 +2,82 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
+	"pxbox/internal/model"
+
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// DBTX is the subset of pgxpool.Pool used by queries
+type DBTX interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // Queries wraps database queries
 type Queries struct {
-	*pgxpool.Pool
+	Pool DBTX
+
+	refs    RequestRefCache  // Optional, see SetRequestRefCache
+	written *writtenRequests // Set inside InTx
 }
 
 // NewQueries creates a new Queries instance
-func NewQueries(pool *pgxpool.Pool) *Queries {
+func NewQueries(pool DBTX) *Queries {
 	return &Queries{Pool: pool}
 }
 
 // Entity queries
 func (q *Queries) GetEntityByID(ctx context.Context, id string) (Entity, error) {
-	var e Entity
-	err := q.Pool.QueryRow(ctx,
-		"SELECT id, kind, handle, meta, created_at FROM entities WHERE id = $1",
+	return scanEntity(q.Pool.QueryRow(ctx,
+		"SELECT "+entityColumns+" FROM entities WHERE id = $1",
 		id,
-	).Scan(&e.ID, &e.Kind, &e.Handle, &e.Meta, &e.CreatedAt)
-	return e, err
+	))
 }
 
 func (q *Queries) GetEntityByHandle(ctx context.Context, handle string) (Entity, error) {
-	var e Entity
-	err := q.Pool.QueryRow(ctx,
-		"SELECT id, kind, handle, meta, created_at FROM entities WHERE handle = $1",
+	return scanEntity(q.Pool.QueryRow(ctx,
+		"SELECT "+entityColumns+" FROM entities WHERE handle = $1",
 		handle,
-	).Scan(&e.ID, &e.Kind, &e.Handle, &e.Meta, &e.CreatedAt)
-	return e, err
+	))
 }
 
-func (q *Queries) CreateEntity(ctx context.Context, kind, handle string, meta map[string]interface{}) (Entity, error) {
-	var e Entity
-	err := q.Pool.QueryRow(ctx,
-		"INSERT INTO entities (kind, handle, meta) VALUES ($1, $2, $3) RETURNING id, kind, handle, meta, created_at",
-		kind, handle, meta,
-	).Scan(&e.ID, &e.Kind, &e.Handle, &e.Meta, &e.CreatedAt)
-	return e, err
+// CreateEntity creates an entity; a blank handle is stored as NULL so
+// entities without one do not collide on the unique handle
+func (q *Queries) CreateEntity(ctx context.Context, kind, handle string, meta map[string]interface{}, sandbox bool) (Entity, error) {
+	return scanEntity(q.Pool.QueryRow(ctx,
+		"INSERT INTO entities (kind, handle, meta, sandbox) VALUES ($1, NULLIF($2, ''), $3, $4) RETURNING "+entityColumns,
+		kind, handle, meta, sandbox,
+	))
+}
+
+// UpdateEntity updates an entity's handle (if non-nil) and merges meta into
+// its existing metadata
+func (q *Queries) UpdateEntity(ctx context.Context, id string, handle *string, meta map[string]interface{}) (Entity, error) {
+	return scanEntity(q.Pool.QueryRow(ctx,
+		`UPDATE entities
+		SET handle = COALESCE($2, handle),
+			meta = meta || COALESCE($3::jsonb, '{}'::jsonb)
+		WHERE id = $1
+		RETURNING `+entityColumns,
+		id, handle, meta,
+	))
 }
 
 // Entity represents an entity row
 type Entity struct {
-	ID        string
-	Kind      string
-	Handle    *string
-	Meta      map[string]interface{}
-	CreatedAt time.Time
+	ID            string
+	Kind          string
+	Handle        *string
+	Meta          map[string]interface{}
+	CreatedAt     time.Time
+	Sandbox       bool
+	DeactivatedAt *time.Time // Set while the entity accepts no new requests
 }
 
 // Request queries
@@ -62,20 +87,22 @@ func (q *Queries) CreateRequest(ctx context.Context, req CreateRequestParams) (R
 		`INSERT INTO requests (
 			id, created_by, entity_id, status, schema_kind, schema_payload,
 			ui_hints, prefill, expires_at, deadline_at, attention_at,
-			autocancel_grace, callback_url, callback_secret, files_policy, flow_id
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			autocancel_grace, callback_url, callback_secret, files_policy, flow_id,
+			callback_fields, sandbox, tags, locale, timezone, deferred_until
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, COALESCE($19::text[], '{}'), $20, $21, $22)
 		RETURNING id, created_by, entity_id, status, schema_kind, schema_payload,
 			ui_hints, prefill, expires_at, deadline_at, attention_at,
 			autocancel_grace, callback_url, callback_secret, files_policy,
-			flow_id, deleted_at, read_at, created_at, updated_at`,
+			flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone, deferred_until`,
 		req.ID, req.CreatedBy, req.EntityID, req.Status, req.SchemaKind, req.SchemaPayload,
 		req.UIHints, req.Prefill, req.ExpiresAt, req.DeadlineAt, req.AttentionAt,
 		req.AutocancelGrace, req.CallbackURL, req.CallbackSecret, req.FilesPolicy, req.FlowID,
+		req.CallbackFields, req.Sandbox, req.Tags, req.Locale, req.Timezone, req.DeferredUntil,
 	).Scan(
 		&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
 		&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
 		&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
-		&r.DeletedAt, &r.ReadAt, &r.CreatedAt, &r.UpdatedAt,
+		&r.DeletedAt, &r.ReadAt, &r.DeliveredAt, &r.CreatedAt, &r.UpdatedAt, &r.Version, &r.CallbackFields, &r.Sandbox, &r.Tags, &r.SnoozedUntil, &r.ClaimedBy, &r.ClaimedAt, &r.ClaimExpiresAt, &r.Locale, &r.Timezone, &r.DeferredUntil,
 	)
 	return r, err
 }
@@ -95,40 +122,149 @@ type CreateRequestParams struct {
 	AutocancelGrace *time.Duration
 	CallbackURL     *string
 	CallbackSecret  *string
+	CallbackFields  []string
+	Sandbox         bool
+	Tags            []string
 	FilesPolicy     map[string]interface{}
 	FlowID          *string
+	Locale          *string
+	Timezone        *string
+	DeferredUntil   *time.Time
+}
+
+// CreateRequests inserts several requests with a single statement and
+// returns them in the order given
+func (q *Queries) CreateRequests(ctx context.Context, reqs []CreateRequestParams) ([]Request, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	const width = 22 // Parameters per request
+	var values strings.Builder
+	args := make([]any, 0, len(reqs)*width)
+	for i, req := range reqs {
+		if i > 0 {
+			values.WriteString(", ")
+		}
+		values.WriteString("(")
+		for j := 1; j <= width; j++ {
+			if j > 1 {
+				values.WriteString(", ")
+			}
+			if j == 19 {
+				fmt.Fprintf(&values, "COALESCE($%d::text[], '{}')", i*width+j)
+			} else {
+				fmt.Fprintf(&values, "$%d", i*width+j)
+			}
+		}
+		values.WriteString(")")
+		args = append(args,
+			req.ID, req.CreatedBy, req.EntityID, req.Status, req.SchemaKind, req.SchemaPayload,
+			req.UIHints, req.Prefill, req.ExpiresAt, req.DeadlineAt, req.AttentionAt,
+			req.AutocancelGrace, req.CallbackURL, req.CallbackSecret, req.FilesPolicy, req.FlowID,
+			req.CallbackFields, req.Sandbox, req.Tags, req.Locale, req.Timezone, req.DeferredUntil,
+		)
+	}
+
+	rows, err := q.Pool.Query(ctx,
+		`INSERT INTO requests (
+			id, created_by, entity_id, status, schema_kind, schema_payload,
+			ui_hints, prefill, expires_at, deadline_at, attention_at,
+			autocancel_grace, callback_url, callback_secret, files_policy, flow_id,
+			callback_fields, sandbox, tags, locale, timezone, deferred_until
+		) VALUES `+values.String()+`
+		RETURNING id, created_by, entity_id, status, schema_kind, schema_payload,
+			ui_hints, prefill, expires_at, deadline_at, attention_at,
+			autocancel_grace, callback_url, callback_secret, files_policy,
+			flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone, deferred_until`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// RETURNING does not promise the order of VALUES
+	byID := make(map[string]Request, len(reqs))
+	for rows.Next() {
+		var r Request
+		if err := rows.Scan(
+			&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
+			&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
+			&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
+			&r.DeletedAt, &r.ReadAt, &r.DeliveredAt, &r.CreatedAt, &r.UpdatedAt, &r.Version, &r.CallbackFields, &r.Sandbox, &r.Tags, &r.SnoozedUntil, &r.ClaimedBy, &r.ClaimedAt, &r.ClaimExpiresAt, &r.Locale, &r.Timezone, &r.DeferredUntil,
+		); err != nil {
+			return nil, err
+		}
+		byID[r.ID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	created := make([]Request, len(reqs))
+	for i, req := range reqs {
+		created[i] = byID[req.ID]
+	}
+	return created, nil
 }
 
+// GetRequestByID returns a request, memoized within WithRequestMemo
 func (q *Queries) GetRequestByID(ctx context.Context, id string) (Request, error) {
+	memo := memoFrom(ctx)
+	if r, ok := memo.get(id); ok {
+		return r, nil
+	}
 	var r Request
 	err := q.Pool.QueryRow(ctx,
 		`SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
 			ui_hints, prefill, expires_at, deadline_at, attention_at,
 			autocancel_grace, callback_url, callback_secret, files_policy,
-			flow_id, deleted_at, read_at, created_at, updated_at
+			flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone, deferred_until
 		FROM requests WHERE id = $1`,
 		id,
 	).Scan(
 		&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
 		&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
 		&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
-		&r.DeletedAt, &r.ReadAt, &r.CreatedAt, &r.UpdatedAt,
+		&r.DeletedAt, &r.ReadAt, &r.DeliveredAt, &r.CreatedAt, &r.UpdatedAt, &r.Version, &r.CallbackFields, &r.Sandbox, &r.Tags, &r.SnoozedUntil, &r.ClaimedBy, &r.ClaimedAt, &r.ClaimExpiresAt, &r.Locale, &r.Timezone, &r.DeferredUntil,
 	)
+	if err == nil {
+		memo.put(r)
+	}
 	return r, err
 }
 
-func (q *Queries) UpdateRequestStatus(ctx context.Context, id, status string) error {
-	_, err := q.Pool.Exec(ctx,
-		"UPDATE requests SET status = $2, updated_at = NOW() WHERE id = $1",
-		id, status,
+// UpdateRequestStatus moves a request to status, but only from a legal source
+// status and, if expectedVersion is set, only at that version. It bumps the
+// version and returns pgx.ErrNoRows if no row matched.
+func (q *Queries) UpdateRequestStatus(ctx context.Context, id, status string, expectedVersion *int) error {
+	defer q.forgetRequests(ctx, []string{id})
+	result, err := q.Pool.Exec(ctx,
+		`UPDATE requests SET status = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND status = ANY($3) AND ($4::int IS NULL OR version = $4)`,
+		id, status, transitionSources(status), expectedVersion,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
 }
 
-func (q *Queries) ClaimRequest(ctx context.Context, id string) error {
+// ClaimRequest moves a request to CLAIMED on behalf of claimedBy, subject to
+// the same checks as UpdateRequestStatus, unless the request's own
+// expires_at has passed. A nil expiresAt keeps the claim until it is
+// released.
+func (q *Queries) ClaimRequest(ctx context.Context, id, claimedBy string, expiresAt *time.Time, expectedVersion *int) error {
+	defer q.forgetRequests(ctx, []string{id})
 	result, err := q.Pool.Exec(ctx,
-		"UPDATE requests SET status = 'CLAIMED', updated_at = NOW() WHERE id = $1 AND status = 'PENDING'",
-		id,
+		`UPDATE requests SET status = 'CLAIMED', claimed_by = $2, claimed_at = NOW(), claim_expires_at = $3,
+			version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND status = ANY($4) AND ($5::int IS NULL OR version = $5)
+		  AND (expires_at IS NULL OR expires_at > NOW())`,
+		id, claimedBy, expiresAt, transitionSources(string(model.StatusClaimed)), expectedVersion,
 	)
 	if err != nil {
 		return err
@@ -139,7 +275,67 @@ func (q *Queries) ClaimRequest(ctx context.Context, id string) error {
 	return nil
 }
 
-func (q *Queries) GetEntityQueue(ctx context.Context, entityID string, status *string, limit, offset int) ([]Request, error) {
+// UnclaimRequest returns a claimed request to PENDING and clears its
+// claimer. With expiredOnly it only releases a claim whose expiry has
+// passed. Unlike reopening, it only applies to CLAIMED requests. It returns
+// pgx.ErrNoRows if no row matched.
+func (q *Queries) UnclaimRequest(ctx context.Context, id string, expiredOnly bool, expectedVersion *int) error {
+	defer q.forgetRequests(ctx, []string{id})
+	result, err := q.Pool.Exec(ctx,
+		`UPDATE requests SET status = 'PENDING', claimed_by = NULL, claimed_at = NULL, claim_expires_at = NULL,
+			version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND status = 'CLAIMED' AND ($2::int IS NULL OR version = $2)
+		  AND (NOT $3::boolean OR claim_expires_at <= NOW())`,
+		id, expectedVersion, expiredOnly,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// AnswerRequest atomically marks a request ANSWERED (subject to the same
+// checks as UpdateRequestStatus, and only before its expires_at) and stores
+// the response. It returns pgx.ErrNoRows if the request could not be
+// transitioned.
+func (q *Queries) AnswerRequest(ctx context.Context, resp CreateResponseParams, expectedVersion *int) (Response, error) {
+	defer q.forgetRequests(ctx, []string{resp.RequestID})
+	var r Response
+	err := q.Pool.QueryRow(ctx,
+		`WITH answered AS (
+			UPDATE requests SET status = 'ANSWERED', version = version + 1, updated_at = NOW()
+			WHERE id = $2 AND status = ANY($6) AND ($7::int IS NULL OR version = $7)
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			RETURNING id
+		)
+		INSERT INTO responses (id, request_id, answered_by, payload, files)
+		SELECT $1, answered.id, $3, $4, $5 FROM answered
+		RETURNING id, request_id, answered_at, answered_by, payload, files, signature_jws,
+			review, review_reason, reviewed_by, reviewed_at`,
+		resp.ID, resp.RequestID, resp.AnsweredBy, resp.Payload, resp.Files,
+		transitionSources(string(model.StatusAnswered)), expectedVersion,
+	).Scan(
+		&r.ID, &r.RequestID, &r.AnsweredAt, &r.AnsweredBy, &r.Payload, &r.Files, &r.SignatureJWS,
+		&r.Review, &r.ReviewReason, &r.ReviewedBy, &r.ReviewedAt,
+	)
+	return r, err
+}
+
+func transitionSources(status string) []string {
+	var from []string
+	for _, s := range model.RequestStatusMachine.Sources(model.Status(status)) {
+		from = append(from, string(s))
+	}
+	return from
+}
+
+// GetEntityQueue lists an entity's requests, newest first. Requests past
+// their expires_at are left out, as are requests snoozed until a future
+// time unless includeSnoozed is set.
+func (q *Queries) GetEntityQueue(ctx context.Context, entityID string, status *string, includeSnoozed bool, limit, offset int) ([]Request, error) {
 	var rows pgx.Rows
 	var err error
 
@@ -148,24 +344,28 @@ func (q *Queries) GetEntityQueue(ctx context.Context, entityID string, status *s
 			`SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
 				ui_hints, prefill, expires_at, deadline_at, attention_at,
 				autocancel_grace, callback_url, callback_secret, files_policy,
-				flow_id, deleted_at, read_at, created_at, updated_at
+				flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone, deferred_until
 			FROM requests
 			WHERE entity_id = $1 AND status = $2 AND deleted_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			  AND ($3::boolean OR snoozed_until IS NULL OR snoozed_until <= NOW())
 			ORDER BY created_at DESC
-			LIMIT $3 OFFSET $4`,
-			entityID, *status, limit, offset,
+			LIMIT $4 OFFSET $5`,
+			entityID, *status, includeSnoozed, limit, offset,
 		)
 	} else {
 		rows, err = q.Pool.Query(ctx,
 			`SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
 				ui_hints, prefill, expires_at, deadline_at, attention_at,
 				autocancel_grace, callback_url, callback_secret, files_policy,
-				flow_id, deleted_at, read_at, created_at, updated_at
+				flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone, deferred_until
 			FROM requests
 			WHERE entity_id = $1 AND deleted_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			  AND ($2::boolean OR snoozed_until IS NULL OR snoozed_until <= NOW())
 			ORDER BY created_at DESC
-			LIMIT $2 OFFSET $3`,
-			entityID, limit, offset,
+			LIMIT $3 OFFSET $4`,
+			entityID, includeSnoozed, limit, offset,
 		)
 	}
 	if err != nil {
@@ -180,7 +380,7 @@ func (q *Queries) GetEntityQueue(ctx context.Context, entityID string, status *s
 			&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
 			&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
 			&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
-			&r.DeletedAt, &r.ReadAt, &r.CreatedAt, &r.UpdatedAt,
+			&r.DeletedAt, &r.ReadAt, &r.DeliveredAt, &r.CreatedAt, &r.UpdatedAt, &r.Version, &r.CallbackFields, &r.Sandbox, &r.Tags, &r.SnoozedUntil, &r.ClaimedBy, &r.ClaimedAt, &r.ClaimExpiresAt, &r.Locale, &r.Timezone, &r.DeferredUntil,
 		)
 		if err != nil {
 			return nil, err
@@ -205,12 +405,24 @@ type Request struct {
 	AutocancelGrace *time.Duration
 	CallbackURL     *string
 	CallbackSecret  *string
+	CallbackFields  []string
+	Sandbox         bool
+	Tags            []string
 	FilesPolicy     map[string]interface{}
 	FlowID          *string
 	DeletedAt       *time.Time
 	ReadAt          *time.Time
+	DeliveredAt     *time.Time
+	SnoozedUntil    *time.Time
+	ClaimedBy       *string
+	ClaimedAt       *time.Time
+	ClaimExpiresAt  *time.Time
+	Locale          *string // Language the request is written in, e.g. "en"
+	Timezone        *string // IANA zone deadlines are displayed in
+	DeferredUntil   *time.Time // End of the maintenance window it arrived in
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
+	Version         int
 }
 
 // Response queries
@@ -219,10 +431,12 @@ func (q *Queries) CreateResponse(ctx context.Context, resp CreateResponseParams)
 	err := q.Pool.QueryRow(ctx,
 		`INSERT INTO responses (id, request_id, answered_by, payload, files)
 		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, request_id, answered_at, answered_by, payload, files, signature_jws`,
+		RETURNING id, request_id, answered_at, answered_by, payload, files, signature_jws,
+			review, review_reason, reviewed_by, reviewed_at`,
 		resp.ID, resp.RequestID, resp.AnsweredBy, resp.Payload, resp.Files,
 	).Scan(
 		&r.ID, &r.RequestID, &r.AnsweredAt, &r.AnsweredBy, &r.Payload, &r.Files, &r.SignatureJWS,
+		&r.Review, &r.ReviewReason, &r.ReviewedBy, &r.ReviewedAt,
 	)
 	return r, err
 }
@@ -243,12 +457,17 @@ type Response struct {
 	Payload     map[string]interface{}
 	Files       []map[string]interface{}
 	SignatureJWS *string
+	Review       *string // ACCEPTED or REJECTED once the requestor reviewed it
+	ReviewReason *string
+	ReviewedBy   *string
+	ReviewedAt   *time.Time
 }
 
 func (q *Queries) GetResponseByRequestID(ctx context.Context, requestID string) (Response, error) {
 	var r Response
 	err := q.Pool.QueryRow(ctx,
-		`SELECT id, request_id, answered_at, answered_by, payload, files, signature_jws
+		`SELECT id, request_id, answered_at, answered_by, payload, files, signature_jws,
+			review, review_reason, reviewed_by, reviewed_at
 		FROM responses
 		WHERE request_id = $1
 		ORDER BY answered_at DESC
@@ -256,6 +475,7 @@ func (q *Queries) GetResponseByRequestID(ctx context.Context, requestID string)
 		requestID,
 	).Scan(
 		&r.ID, &r.RequestID, &r.AnsweredAt, &r.AnsweredBy, &r.Payload, &r.Files, &r.SignatureJWS,
+		&r.Review, &r.ReviewReason, &r.ReviewedBy, &r.ReviewedAt,
 	)
 	return r, err
 }
@@ -264,32 +484,33 @@ func (q *Queries) GetResponseByRequestID(ctx context.Context, requestID string)
 func (q *Queries) CreateFlow(ctx context.Context, flow CreateFlowParams) (Flow, error) {
 	var f Flow
 	err := q.Pool.QueryRow(ctx,
-		`INSERT INTO flows (kind, owner_entity, status, cursor, last_event_id)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, kind, owner_entity, status, cursor, last_event_id, created_at, updated_at`,
-		flow.Kind, flow.OwnerEntity, flow.Status, flow.Cursor, flow.LastEventID,
+		`INSERT INTO flows (kind, owner_entity, status, cursor, last_event_id, parent_flow_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at`,
+		flow.Kind, flow.OwnerEntity, flow.Status, flow.Cursor, flow.LastEventID, flow.ParentFlowID,
 	).Scan(
-		&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.CreatedAt, &f.UpdatedAt,
+		&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID, &f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
 	)
 	return f, err
 }
 
 type CreateFlowParams struct {
-	Kind        string
-	OwnerEntity string
-	Status      string
-	Cursor      map[string]interface{}
-	LastEventID *string
+	Kind         string
+	OwnerEntity  string
+	Status       string
+	Cursor       map[string]interface{}
+	LastEventID  *string
+	ParentFlowID *string
 }
 
 func (q *Queries) GetFlowByID(ctx context.Context, id string) (Flow, error) {
 	var f Flow
 	err := q.Pool.QueryRow(ctx,
-		`SELECT id, kind, owner_entity, status, cursor, last_event_id, created_at, updated_at
-		FROM flows WHERE id = $1`,
+		`SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at
+		FROM flows WHERE id = $1 AND deleted_at IS NULL`,
 		id,
 	).Scan(
-		&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.CreatedAt, &f.UpdatedAt,
+		&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID, &f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
 	)
 	return f, err
 }
@@ -310,127 +531,255 @@ func (q *Queries) UpdateFlowCursor(ctx context.Context, id string, cursor map[st
 	return err
 }
 
-type Flow struct {
-	ID          string
-	Kind        string
-	OwnerEntity string
-	Status      string
-	Cursor      map[string]interface{}
-	LastEventID *string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+// SetFlowLastEventID records the ID of the last event applied to a flow
+func (q *Queries) SetFlowLastEventID(ctx context.Context, id, eventID string) error {
+	_, err := q.Pool.Exec(ctx,
+		"UPDATE flows SET last_event_id = $2 WHERE id = $1",
+		id, eventID,
+	)
+	return err
 }
 
-// Inquiry queries
-func (q *Queries) ListInquiries(ctx context.Context, entityID *string, status *string, includeDeleted bool, sortBy string, limit, offset int) ([]Request, error) {
-	// Use GetEntityQueue when entityID is provided (it works correctly with string parameter)
-	if entityID != nil && *entityID != "" {
-		var statusPtr *string
-		if status != nil && *status != "" {
-			statusPtr = status
-		}
-		// Call GetEntityQueue which we know works (verified via /v1/entities/{id}/queue endpoint)
-		requests, err := q.GetEntityQueue(ctx, *entityID, statusPtr, limit, offset)
+// ListChildFlows returns the flows spawned by parentID, oldest first
+func (q *Queries) ListChildFlows(ctx context.Context, parentID string) ([]Flow, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at
+		FROM flows
+		WHERE parent_flow_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at ASC, id ASC`,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flows := []Flow{}
+	for rows.Next() {
+		var f Flow
+		err := rows.Scan(
+			&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID,
+			&f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
+		)
 		if err != nil {
 			return nil, err
 		}
-		// Return empty slice instead of nil if no results
-		if requests == nil {
-			return []Request{}, nil
+		flows = append(flows, f)
+	}
+	return flows, rows.Err()
+}
+
+// LockFlow serializes steps of one flow until the surrounding transaction
+// ends. It must be called inside InTx.
+func (q *Queries) LockFlow(ctx context.Context, id string) error {
+	_, err := q.Pool.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('flow:' || $1))`, id)
+	return err
+}
+
+// SoftDeleteFlows hides the given flows from the API, listings and scans.
+// It returns pgx.ErrNoRows if none of them exists or all are deleted
+// already.
+func (q *Queries) SoftDeleteFlows(ctx context.Context, ids []string) error {
+	result, err := q.Pool.Exec(ctx,
+		`UPDATE flows SET deleted_at = NOW() WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL`,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ArchiveFlows moves up to limit flows that finished before the given time
+// to ARCHIVED, oldest first, keeping their final status in
+// archived_status. updated_at is left alone, so durations in the stats do
+// not change. It returns the flows archived.
+func (q *Queries) ArchiveFlows(ctx context.Context, finishedBefore time.Time, limit int) ([]Flow, error) {
+	rows, err := q.Pool.Query(ctx,
+		`UPDATE flows SET status = 'ARCHIVED', archived_status = status, archived_at = NOW()
+		WHERE id IN (
+			SELECT id FROM flows
+			WHERE status IN ('COMPLETED','CANCELLED','FAILED') AND deleted_at IS NULL AND updated_at < $1
+			ORDER BY updated_at ASC, id ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at`,
+		finishedBefore, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flows := []Flow{}
+	for rows.Next() {
+		var f Flow
+		err := rows.Scan(
+			&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID,
+			&f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
+		)
+		if err != nil {
+			return nil, err
 		}
-		return requests, nil
+		flows = append(flows, f)
 	}
-	
-	// Otherwise, query all requests (no entity filter)
-	var rows pgx.Rows
-	var err error
-	
-	var query string
-	var args []interface{}
-	
-	if status != nil && *status != "" {
-		query = `SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
-			ui_hints, prefill, expires_at, deadline_at, attention_at,
-			autocancel_grace, callback_url, callback_secret, files_policy,
-			flow_id, deleted_at, read_at, created_at, updated_at
-		FROM requests
-		WHERE status = $1
-		  AND deleted_at IS NULL
-		ORDER BY 
-		  CASE WHEN $2::text = 'deadline' THEN deadline_at END ASC NULLS LAST,
-		  CASE WHEN $2::text = 'created' THEN created_at END DESC
-		LIMIT $3 OFFSET $4`
-		args = []interface{}{*status, sortBy, limit, offset}
-	} else {
-		query = `SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
-			ui_hints, prefill, expires_at, deadline_at, attention_at,
-			autocancel_grace, callback_url, callback_secret, files_policy,
-			flow_id, deleted_at, read_at, created_at, updated_at
-		FROM requests
-		WHERE deleted_at IS NULL
-		ORDER BY 
-		  CASE WHEN $1::text = 'deadline' THEN deadline_at END ASC NULLS LAST,
-		  CASE WHEN $1::text = 'created' THEN created_at END DESC
-		LIMIT $2 OFFSET $3`
-		args = []interface{}{sortBy, limit, offset}
+	return flows, rows.Err()
+}
+
+// FlowFilter narrows the flows returned by ListFlows and CountFlowsByStatus
+type FlowFilter struct {
+	OwnerEntity  *string
+	Kind         *string
+	Status       *string // Ignored by CountFlowsByStatus
+	CreatedAfter *time.Time
+}
+
+// ListFlows returns matching flows, newest first. Results are
+// keyset-paginated by (created_at, id); pass the last flow of the previous
+// page as after.
+func (q *Queries) ListFlows(ctx context.Context, f FlowFilter, after *Flow, limit int) ([]Flow, error) {
+	var afterCreatedAt *time.Time
+	var afterID *string
+	if after != nil {
+		afterCreatedAt = &after.CreatedAt
+		afterID = &after.ID
 	}
 
-	rows, err = q.Pool.Query(ctx, query, args...)
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at
+		FROM flows
+		WHERE deleted_at IS NULL
+		  AND ($1::uuid IS NULL OR owner_entity = $1)
+		  AND ($2::text IS NULL OR kind = $2)
+		  AND ($3::text IS NULL OR status = $3)
+		  AND ($4::timestamptz IS NULL OR created_at > $4)
+		  AND ($5::timestamptz IS NULL OR (created_at, id) < ($5, $6::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $7`,
+		f.OwnerEntity, f.Kind, f.Status, f.CreatedAfter, afterCreatedAt, afterID, limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	requests := make([]Request, 0)
+	flows := []Flow{}
 	for rows.Next() {
-		var r Request
+		var f Flow
 		err := rows.Scan(
-			&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
-			&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
-			&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
-			&r.DeletedAt, &r.ReadAt, &r.CreatedAt, &r.UpdatedAt,
+			&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID,
+			&f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
-		requests = append(requests, r)
+		flows = append(flows, f)
 	}
-	if err := rows.Err(); err != nil {
+	return flows, rows.Err()
+}
+
+// CountFlowsByStatus counts matching flows per status
+func (q *Queries) CountFlowsByStatus(ctx context.Context, f FlowFilter) (map[string]int, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT status, COUNT(*)
+		FROM flows
+		WHERE deleted_at IS NULL
+		  AND ($1::uuid IS NULL OR owner_entity = $1)
+		  AND ($2::text IS NULL OR kind = $2)
+		  AND ($3::timestamptz IS NULL OR created_at > $3)
+		GROUP BY status`,
+		f.OwnerEntity, f.Kind, f.CreatedAfter,
+	)
+	if err != nil {
 		return nil, err
 	}
-	return requests, nil
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
 }
 
-type Reminder struct {
-	ID        string
-	RequestID string
-	EntityID  string
-	RemindAt  time.Time
-	CreatedAt time.Time
+type Flow struct {
+	ID           string
+	Kind         string
+	OwnerEntity  string
+	Status       string
+	Cursor       map[string]interface{}
+	LastEventID  *string
+	ParentFlowID *string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+
+	ArchivedStatus *string // The status an ARCHIVED flow finished with
+	ArchivedAt     *time.Time
 }
 
-func (q *Queries) GetReminderByID(ctx context.Context, id string) (Reminder, error) {
-	var r Reminder
+// Inquiry queries
+
+// MarkRequestDelivered records when the target entity's client first
+// received a request. It returns pgx.ErrNoRows if the request does not
+// exist, is addressed to another entity or was already delivered.
+func (q *Queries) MarkRequestDelivered(ctx context.Context, id, entityID string) (time.Time, error) {
+	defer q.forgetRequests(ctx, []string{id})
+	var deliveredAt time.Time
 	err := q.Pool.QueryRow(ctx,
-		`SELECT id::text, request_id, entity_id, remind_at, created_at
-		FROM reminders WHERE id = $1`,
-		id,
-	).Scan(&r.ID, &r.RequestID, &r.EntityID, &r.RemindAt, &r.CreatedAt)
-	return r, err
+		`UPDATE requests SET delivered_at = NOW()
+		WHERE id = $1 AND entity_id = $2 AND delivered_at IS NULL
+		RETURNING delivered_at`,
+		id, entityID,
+	).Scan(&deliveredAt)
+	return deliveredAt, err
 }
 
-func (q *Queries) CreateReminder(ctx context.Context, requestID, entityID string, remindAt time.Time) (Reminder, error) {
-	var r Reminder
-	err := q.Pool.QueryRow(ctx,
-		`INSERT INTO reminders (request_id, entity_id, remind_at)
-		VALUES ($1, $2, $3)
-		RETURNING id::text, request_id, entity_id, remind_at, created_at`,
-		requestID, entityID, remindAt,
-	).Scan(&r.ID, &r.RequestID, &r.EntityID, &r.RemindAt, &r.CreatedAt)
-	return r, err
+// SnoozeRequest hides a request from its entity's default listings until
+// the given time. It returns pgx.ErrNoRows if the request does not exist or
+// is addressed to another entity.
+func (q *Queries) SnoozeRequest(ctx context.Context, id, entityID string, until time.Time) error {
+	defer q.forgetRequests(ctx, []string{id})
+	result, err := q.Pool.Exec(ctx,
+		`UPDATE requests SET snoozed_until = $3, updated_at = NOW()
+		WHERE id = $1 AND entity_id = $2 AND deleted_at IS NULL`,
+		id, entityID, until,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// UnsnoozeRequest clears a snooze that ends at or before dueAt, so a
+// reminder does not cut short a later snooze of the same request. It
+// reports whether a snooze was cleared.
+func (q *Queries) UnsnoozeRequest(ctx context.Context, id string, dueAt time.Time) (bool, error) {
+	defer q.forgetRequests(ctx, []string{id})
+	result, err := q.Pool.Exec(ctx,
+		`UPDATE requests SET snoozed_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND snoozed_until IS NOT NULL AND snoozed_until <= $2`,
+		id, dueAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 func (q *Queries) MarkInquiryRead(ctx context.Context, id string) error {
+	defer q.forgetRequests(ctx, []string{id})
 	_, err := q.Pool.Exec(ctx,
 		"UPDATE requests SET read_at = NOW(), updated_at = NOW() WHERE id = $1",
 		id,
@@ -438,12 +787,22 @@ func (q *Queries) MarkInquiryRead(ctx context.Context, id string) error {
 	return err
 }
 
-func (q *Queries) SoftDeleteInquiry(ctx context.Context, id string) error {
-	_, err := q.Pool.Exec(ctx,
-		"UPDATE requests SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1",
-		id,
+// SoftDeleteInquiry marks a request deleted, only at expectedVersion if set.
+// It returns pgx.ErrNoRows if no row matched.
+func (q *Queries) SoftDeleteInquiry(ctx context.Context, id string, expectedVersion *int) error {
+	defer q.forgetRequests(ctx, []string{id})
+	result, err := q.Pool.Exec(ctx,
+		`UPDATE requests SET deleted_at = NOW(), version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND ($2::int IS NULL OR version = $2)`,
+		id, expectedVersion,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
 }
 
 func (q *Queries) GetInquiryByID(ctx context.Context, id string) (Request, error) {
@@ -456,9 +815,9 @@ func (q *Queries) GetFlowsByStatus(ctx context.Context, statuses []string) ([]Fl
 		return []Flow{}, nil
 	}
 
-	query := `SELECT id, kind, owner_entity, status, cursor, last_event_id, created_at, updated_at
+	query := `SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at
 		FROM flows
-		WHERE status = ANY($1)
+		WHERE status = ANY($1) AND deleted_at IS NULL
 		ORDER BY created_at ASC`
 
 	rows, err := q.Pool.Query(ctx, query, statuses)
@@ -471,8 +830,8 @@ func (q *Queries) GetFlowsByStatus(ctx context.Context, statuses []string) ([]Fl
 	for rows.Next() {
 		var f Flow
 		err := rows.Scan(
-			&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID,
-			&f.CreatedAt, &f.UpdatedAt,
+			&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID,
+			&f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -482,3 +841,68 @@ func (q *Queries) GetFlowsByStatus(ctx context.Context, statuses []string) ([]Fl
 	return flows, rows.Err()
 }
 
+
+// GetStaleFlows gets flows in the given statuses that have not been updated
+// since updatedBefore, oldest first. Results are keyset-paginated by
+// (updated_at, id); pass the last flow of the previous page as after.
+func (q *Queries) GetStaleFlows(ctx context.Context, statuses []string, updatedBefore time.Time, after *Flow, limit int) ([]Flow, error) {
+	if len(statuses) == 0 {
+		return []Flow{}, nil
+	}
+	return q.pageFlows(ctx, after, limit, `status = ANY($4) AND updated_at < $5`, statuses, updatedBefore)
+}
+
+// GetDueFlows gets running and suspended flows that have been neither
+// updated nor checked by the flow ticker since before, oldest first. It
+// pages like GetStaleFlows.
+func (q *Queries) GetDueFlows(ctx context.Context, before time.Time, after *Flow, limit int) ([]Flow, error) {
+	return q.pageFlows(ctx, after, limit, `status IN ('RUNNING', 'SUSPENDED') AND COALESCE(checked_at, updated_at) < $4`, before)
+}
+
+// MarkFlowsChecked records that the flow ticker has looked at the flows
+func (q *Queries) MarkFlowsChecked(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := q.Pool.Exec(ctx, `UPDATE flows SET checked_at = NOW() WHERE id = ANY($1::uuid[])`, ids)
+	return err
+}
+
+// pageFlows gets one page of the flows matching filter, whose arguments are
+// numbered from $4
+func (q *Queries) pageFlows(ctx context.Context, after *Flow, limit int, filter string, args ...any) ([]Flow, error) {
+	afterUpdatedAt := time.Time{}
+	afterID := "00000000-0000-0000-0000-000000000000"
+	if after != nil {
+		afterUpdatedAt = after.UpdatedAt
+		afterID = after.ID
+	}
+
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at, archived_status, archived_at
+		FROM flows
+		WHERE `+filter+` AND deleted_at IS NULL
+		  AND (updated_at, id) > ($1, $2::uuid)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $3`,
+		append([]any{afterUpdatedAt, afterID, limit}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flows []Flow
+	for rows.Next() {
+		var f Flow
+		err := rows.Scan(
+			&f.ID, &f.Kind, &f.OwnerEntity, &f.Status, &f.Cursor, &f.LastEventID, &f.ParentFlowID,
+			&f.CreatedAt, &f.UpdatedAt, &f.ArchivedStatus, &f.ArchivedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		flows = append(flows, f)
+	}
+	return flows, rows.Err()
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// QuotaUsage counts what a new request is checked against
+type QuotaUsage struct {
+	OpenByRequestor int64 // Pending or claimed requests of the requestor
+	OpenByEntity    int64 // Pending or claimed requests addressed to the entity
+	CreatedSince    int64 // Requests of the requestor created since the given time
+}
+
+// GetQuotaUsage counts the open requests of a requestor and of an entity,
+// and the requests the requestor created since a time
+func (q *Queries) GetQuotaUsage(ctx context.Context, createdBy, entityID string, since time.Time) (QuotaUsage, error) {
+	var u QuotaUsage
+	err := q.Pool.QueryRow(ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM requests
+			 WHERE created_by = $1 AND status IN ('PENDING', 'CLAIMED') AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM requests
+			 WHERE entity_id = $2 AND status IN ('PENDING', 'CLAIMED') AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM requests
+			 WHERE created_by = $1 AND created_at >= $3)`,
+		createdBy, entityID, since,
+	).Scan(&u.OpenByRequestor, &u.OpenByEntity, &u.CreatedSince)
+	return u, err
+}
@@ -0,0 +1,62 @@
+package db
+
+import "context"
+
+// StoredValue is a JSON value stored in a row
+type StoredValue struct {
+	ID    string
+	Value map[string]interface{}
+}
+
+// ListPrefills returns the prefills of requests after afterID in id order
+func (q *Queries) ListPrefills(ctx context.Context, afterID string, limit int) ([]StoredValue, error) {
+	return q.listValues(ctx,
+		`SELECT id, prefill FROM requests
+		WHERE id > $1 AND prefill IS NOT NULL
+		ORDER BY id
+		LIMIT $2`,
+		afterID, limit)
+}
+
+// ListResponsePayloads returns the payloads of responses after afterID in id
+// order
+func (q *Queries) ListResponsePayloads(ctx context.Context, afterID string, limit int) ([]StoredValue, error) {
+	return q.listValues(ctx,
+		`SELECT id, payload FROM responses
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`,
+		afterID, limit)
+}
+
+// UpdatePrefill rewrites the stored prefill of a request without changing
+// its version
+func (q *Queries) UpdatePrefill(ctx context.Context, id string, prefill map[string]interface{}) error {
+	defer q.forgetRequests(ctx, []string{id})
+	_, err := q.Pool.Exec(ctx, `UPDATE requests SET prefill = $2 WHERE id = $1`, id, prefill)
+	return err
+}
+
+// UpdateResponsePayload rewrites the stored payload of a response
+func (q *Queries) UpdateResponsePayload(ctx context.Context, id string, payload map[string]interface{}) error {
+	_, err := q.Pool.Exec(ctx, `UPDATE responses SET payload = $2 WHERE id = $1`, id, payload)
+	return err
+}
+
+func (q *Queries) listValues(ctx context.Context, query, afterID string, limit int) ([]StoredValue, error) {
+	rows, err := q.Pool.Query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []StoredValue
+	for rows.Next() {
+		var v StoredValue
+		if err := rows.Scan(&v.ID, &v.Value); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Reminder brings a snoozed request back to its entity at RemindAt. It is
+// pending until its job delivers it.
+type Reminder struct {
+	ID          string
+	RequestID   string
+	EntityID    string
+	RemindAt    time.Time
+	TaskID      *string
+	DeliveredAt *time.Time
+	CreatedAt   time.Time
+}
+
+const reminderColumns = `id::text, request_id, entity_id, remind_at, task_id, delivered_at, created_at`
+
+func scanReminder(row interface{ Scan(...interface{}) error }) (Reminder, error) {
+	var r Reminder
+	err := row.Scan(&r.ID, &r.RequestID, &r.EntityID, &r.RemindAt, &r.TaskID, &r.DeliveredAt, &r.CreatedAt)
+	return r, err
+}
+
+func (q *Queries) GetReminderByID(ctx context.Context, id string) (Reminder, error) {
+	return scanReminder(q.Pool.QueryRow(ctx, `SELECT `+reminderColumns+` FROM reminders WHERE id = $1`, id))
+}
+
+// CreateReminder adds a pending reminder. There can be only one per request
+// and entity; remove the previous one with DeletePendingReminders first.
+func (q *Queries) CreateReminder(ctx context.Context, requestID, entityID string, remindAt time.Time) (Reminder, error) {
+	return scanReminder(q.Pool.QueryRow(ctx,
+		`INSERT INTO reminders (request_id, entity_id, remind_at)
+		VALUES ($1, $2, $3)
+		RETURNING `+reminderColumns,
+		requestID, entityID, remindAt,
+	))
+}
+
+// DeletePendingReminders removes the undelivered reminders of a request
+// for an entity and returns them, so their jobs can be cancelled
+func (q *Queries) DeletePendingReminders(ctx context.Context, requestID, entityID string) ([]Reminder, error) {
+	rows, err := q.Pool.Query(ctx,
+		`DELETE FROM reminders
+		WHERE request_id = $1 AND entity_id = $2 AND delivered_at IS NULL
+		RETURNING `+reminderColumns,
+		requestID, entityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []Reminder
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// SetReminderTask records the job that delivers a reminder
+func (q *Queries) SetReminderTask(ctx context.Context, id, taskID string) error {
+	_, err := q.Pool.Exec(ctx, `UPDATE reminders SET task_id = $2 WHERE id = $1`, id, taskID)
+	return err
+}
+
+// ListReminders returns the reminders of a request for an entity, pending
+// and delivered, by time
+func (q *Queries) ListReminders(ctx context.Context, requestID, entityID string) ([]Reminder, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+reminderColumns+` FROM reminders
+		WHERE request_id = $1 AND entity_id = $2
+		ORDER BY remind_at, id`,
+		requestID, entityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := make([]Reminder, 0)
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// DeleteReminder cancels a pending reminder. It returns pgx.ErrNoRows if
+// the reminder does not exist or was already delivered.
+func (q *Queries) DeleteReminder(ctx context.Context, id string) (Reminder, error) {
+	return scanReminder(q.Pool.QueryRow(ctx,
+		`DELETE FROM reminders WHERE id = $1 AND delivered_at IS NULL
+		RETURNING `+reminderColumns,
+		id,
+	))
+}
+
+// MarkReminderDelivered records that a reminder was sent and reports
+// whether it was still pending, so a job that runs twice reminds once
+func (q *Queries) MarkReminderDelivered(ctx context.Context, id string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx,
+		`UPDATE reminders SET delivered_at = NOW() WHERE id = $1 AND delivered_at IS NULL`,
+		id,
+	)
+	return tag.RowsAffected() > 0, err
+}
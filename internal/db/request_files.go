@@ -0,0 +1,45 @@
+package db
+
+import "context"
+
+// CreateRequestFiles records the attachments of a request, in order, and
+// marks the uploaded files among them (by object key) as attached, exempting
+// them from garbage collection
+func (q *Queries) CreateRequestFiles(ctx context.Context, requestID string, files []map[string]interface{}, keys []string) error {
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO request_files (request_id, position, file)
+		SELECT $1, t.position, t.file
+		FROM jsonb_array_elements($2::jsonb) WITH ORDINALITY AS t(file, position)`,
+		requestID, files,
+	)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	_, err = q.Pool.Exec(ctx,
+		`UPDATE files SET attached_request_id = $1, expires_at = NULL WHERE object_key = ANY($2)`,
+		requestID, keys,
+	)
+	return err
+}
+
+// ListRequestFiles returns the attachments of a request in order
+func (q *Queries) ListRequestFiles(ctx context.Context, requestID string) ([]map[string]interface{}, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT file FROM request_files WHERE request_id = $1 ORDER BY position`,
+		requestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []map[string]interface{}
+	for rows.Next() {
+		var f map[string]interface{}
+		if err := rows.Scan(&f); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
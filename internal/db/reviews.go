@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+)
+
+// ReviewResponseParams is the requestor's review of an answer
+type ReviewResponseParams struct {
+	RequestID  string
+	Status     string // ACCEPTED, REJECTED, or PENDING to reopen the request
+	Review     string // ACCEPTED or REJECTED
+	Reason     *string
+	ReviewedBy string
+}
+
+// ReviewResponse moves an ANSWERED request to p.Status and records the
+// review on its latest response. Reopening to PENDING clears the claim, so
+// the corrected answer can come from any member. It returns the request's
+// new version, or pgx.ErrNoRows if the request is not ANSWERED or not at
+// expectedVersion.
+func (q *Queries) ReviewResponse(ctx context.Context, p ReviewResponseParams, expectedVersion *int) (int, error) {
+	defer q.forgetRequests(ctx, []string{p.RequestID})
+	var version int
+	// Only answers are reviewed, so the source is ANSWERED whatever other
+	// statuses may move to p.Status
+	err := q.Pool.QueryRow(ctx,
+		`WITH reviewed AS (
+			UPDATE requests SET status = $2, version = version + 1, updated_at = NOW(),
+				claimed_by = CASE WHEN $2::text = 'PENDING' THEN NULL ELSE claimed_by END,
+				claimed_at = CASE WHEN $2::text = 'PENDING' THEN NULL ELSE claimed_at END,
+				claim_expires_at = CASE WHEN $2::text = 'PENDING' THEN NULL ELSE claim_expires_at END
+			WHERE id = $1 AND status = 'ANSWERED' AND ($6::int IS NULL OR version = $6)
+			RETURNING id, version
+		), latest AS (
+			SELECT id FROM responses WHERE request_id = $1 ORDER BY answered_at DESC LIMIT 1
+		)
+		UPDATE responses SET review = $3, review_reason = $4, reviewed_by = $5, reviewed_at = NOW()
+		FROM reviewed, latest
+		WHERE responses.id = latest.id
+		RETURNING reviewed.version`,
+		p.RequestID, p.Status, p.Review, p.Reason, p.ReviewedBy, expectedVersion,
+	).Scan(&version)
+	return version, err
+}
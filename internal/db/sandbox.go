@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// SandboxRequest is a sandbox request due for purging, together with the
+// files attached to its responses and the keys of files uploaded for it
+type SandboxRequest struct {
+	ID         string
+	EntityID   string
+	CreatedBy  string
+	Files      []map[string]interface{}
+	ObjectKeys []string
+}
+
+// ListExpiredSandboxRequests returns up to limit sandbox requests created
+// before the given time, oldest first
+func (q *Queries) ListExpiredSandboxRequests(ctx context.Context, before time.Time, limit int) ([]SandboxRequest, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT r.id, r.entity_id, r.created_by,
+			COALESCE((
+				SELECT jsonb_agg(f)
+				FROM responses resp, jsonb_array_elements(resp.files) f
+				WHERE resp.request_id = r.id
+			), '[]'::jsonb),
+			COALESCE((SELECT array_agg(object_key) FROM files WHERE request_id = r.id), '{}')
+		FROM requests r
+		WHERE r.sandbox AND r.created_at < $1
+		ORDER BY r.created_at ASC
+		LIMIT $2`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []SandboxRequest
+	for rows.Next() {
+		var r SandboxRequest
+		if err := rows.Scan(&r.ID, &r.EntityID, &r.CreatedBy, &r.Files, &r.ObjectKeys); err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// DeleteSandboxRequests removes the given sandbox requests. Responses,
+// reminders and file rows go with them through ON DELETE CASCADE. Requests that are not
+// sandboxed are never deleted.
+func (q *Queries) DeleteSandboxRequests(ctx context.Context, ids []string) (int64, error) {
+	defer q.forgetRequests(ctx, ids)
+	tag, err := q.Pool.Exec(ctx,
+		"DELETE FROM requests WHERE id = ANY($1) AND sandbox",
+		ids,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RequestFilter narrows a request search. Nil and empty fields match all
+// requests.
+type RequestFilter struct {
+	EntityID       *string
+	Status         *string
+	CreatedBy      *string
+	Tags           []string // Requests must carry all of these
+	AnyTags        []string // Requests must carry at least one of these
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	IncludeDeleted bool
+	ExcludeSnoozed bool // Hide requests snoozed until a future time
+	ExcludeExpired bool // Hide requests past their expires_at
+}
+
+// SearchRequests returns matching requests, newest first or, with sortBy
+// "deadline", by deadline
+func (q *Queries) SearchRequests(ctx context.Context, f RequestFilter, sortBy string, limit, offset int) ([]Request, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
+			ui_hints, prefill, expires_at, deadline_at, attention_at,
+			autocancel_grace, callback_url, callback_secret, files_policy,
+			flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone, deferred_until
+		FROM requests
+		WHERE ($1::uuid IS NULL OR entity_id = $1)
+		  AND ($2::text IS NULL OR status = $2)
+		  AND ($3::text IS NULL OR created_by = $3)
+		  AND tags @> COALESCE($4::text[], '{}')
+		  AND (COALESCE(cardinality($5::text[]), 0) = 0 OR tags && $5)
+		  AND ($6::timestamptz IS NULL OR created_at >= $6)
+		  AND ($7::timestamptz IS NULL OR created_at < $7)
+		  AND ($8::boolean OR deleted_at IS NULL)
+		  AND (NOT $9::boolean OR snoozed_until IS NULL OR snoozed_until <= NOW())
+		  AND (NOT $10::boolean OR expires_at IS NULL OR expires_at > NOW())
+		ORDER BY
+		  CASE WHEN $11::text = 'deadline' THEN deadline_at END ASC NULLS LAST,
+		  created_at DESC
+		LIMIT $12 OFFSET $13`,
+		f.EntityID, f.Status, f.CreatedBy, f.Tags, f.AnyTags, f.CreatedAfter, f.CreatedBefore, f.IncludeDeleted,
+		f.ExcludeSnoozed, f.ExcludeExpired, sortBy, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]Request, 0)
+	for rows.Next() {
+		var r Request
+		err := rows.Scan(
+			&r.ID, &r.CreatedBy, &r.EntityID, &r.Status, &r.SchemaKind, &r.SchemaPayload,
+			&r.UIHints, &r.Prefill, &r.ExpiresAt, &r.DeadlineAt, &r.AttentionAt,
+			&r.AutocancelGrace, &r.CallbackURL, &r.CallbackSecret, &r.FilesPolicy, &r.FlowID,
+			&r.DeletedAt, &r.ReadAt, &r.DeliveredAt, &r.CreatedAt, &r.UpdatedAt, &r.Version, &r.CallbackFields, &r.Sandbox, &r.Tags, &r.SnoozedUntil, &r.ClaimedBy, &r.ClaimedAt, &r.ClaimExpiresAt, &r.Locale, &r.Timezone, &r.DeferredUntil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ShareLink is a single-use public answer link for a request. Only the
+// SHA-256 of its token is stored.
+type ShareLink struct {
+	ID        string
+	TokenHash string
+	RequestID string
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	UsedBy    *string // Ad-hoc entity that answered
+}
+
+type CreateShareLinkParams struct {
+	ID        string
+	TokenHash string
+	RequestID string
+	CreatedBy string
+	ExpiresAt time.Time
+}
+
+const shareLinkColumns = `id, token_hash, request_id, created_by, created_at, expires_at, used_at, used_by`
+
+func scanShareLink(row interface{ Scan(...interface{}) error }) (ShareLink, error) {
+	var l ShareLink
+	err := row.Scan(&l.ID, &l.TokenHash, &l.RequestID, &l.CreatedBy, &l.CreatedAt, &l.ExpiresAt, &l.UsedAt, &l.UsedBy)
+	return l, err
+}
+
+func (q *Queries) CreateShareLink(ctx context.Context, p CreateShareLinkParams) (ShareLink, error) {
+	return scanShareLink(q.Pool.QueryRow(ctx,
+		`INSERT INTO share_links (id, token_hash, request_id, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+shareLinkColumns,
+		p.ID, p.TokenHash, p.RequestID, p.CreatedBy, p.ExpiresAt,
+	))
+}
+
+// GetShareLinkByToken returns the unused, unexpired link with the given
+// token hash, or pgx.ErrNoRows
+func (q *Queries) GetShareLinkByToken(ctx context.Context, tokenHash string) (ShareLink, error) {
+	return scanShareLink(q.Pool.QueryRow(ctx,
+		`SELECT `+shareLinkColumns+` FROM share_links
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()`,
+		tokenHash,
+	))
+}
+
+// UseShareLink marks the link with the given token hash used, if it is
+// unused and unexpired; otherwise it returns pgx.ErrNoRows. Of concurrent
+// callers only one gets the link.
+func (q *Queries) UseShareLink(ctx context.Context, tokenHash string) (ShareLink, error) {
+	return scanShareLink(q.Pool.QueryRow(ctx,
+		`UPDATE share_links SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING `+shareLinkColumns,
+		tokenHash,
+	))
+}
+
+// ReleaseShareLink makes a used link usable again, e.g. after the answer
+// it was used for was rejected
+func (q *Queries) ReleaseShareLink(ctx context.Context, id string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE share_links SET used_at = NULL, used_by = NULL WHERE id = $1`,
+		id,
+	)
+	return err
+}
+
+// SetShareLinkAnswerer records the entity that answered through a link
+func (q *Queries) SetShareLinkAnswerer(ctx context.Context, id, entityID string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE share_links SET used_by = $2 WHERE id = $1`,
+		id, entityID,
+	)
+	return err
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// StatsFilter narrows the stats to requests or flows created on days
+// From through To, UTC, and optionally to one entity
+type StatsFilter struct {
+	From     time.Time
+	To       time.Time
+	EntityID *string
+}
+
+// RequestCount is the number of requests created on a day for an entity
+// with a status and schema kind
+type RequestCount struct {
+	Day        time.Time
+	EntityID   string
+	Status     string
+	SchemaKind string
+	Count      int64
+}
+
+// FlowCount is the number of flows of a kind with a status created on a
+// day, and the seconds the completed ones took in total
+type FlowCount struct {
+	Day              time.Time
+	Kind             string
+	Status           string
+	Count            int64
+	CompletedSeconds float64
+}
+
+// ListRequestCounts aggregates the requests matching f, live from the
+// requests table or, when materialized, from request_stats_daily as of
+// its last refresh, which is returned with the counts. Sandbox and
+// deleted requests are not counted.
+func (q *Queries) ListRequestCounts(ctx context.Context, f StatsFilter, materialized bool) ([]RequestCount, *time.Time, error) {
+	query := `SELECT (created_at AT TIME ZONE 'UTC')::date, entity_id, status, schema_kind, COUNT(*), NULL::timestamptz
+		FROM requests
+		WHERE deleted_at IS NULL AND NOT sandbox
+		  AND created_at >= $1::date AT TIME ZONE 'UTC' AND created_at < ($2::date + 1) AT TIME ZONE 'UTC'
+		  AND ($3::uuid IS NULL OR entity_id = $3)
+		GROUP BY 1, 2, 3, 4`
+	if materialized {
+		query = `SELECT day, entity_id, status, schema_kind, count, refreshed_at
+			FROM request_stats_daily
+			WHERE day >= $1::date AND day <= $2::date AND ($3::uuid IS NULL OR entity_id = $3)`
+	}
+
+	rows, err := q.Pool.Query(ctx, query, f.From, f.To, f.EntityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var counts []RequestCount
+	var refreshedAt *time.Time
+	for rows.Next() {
+		var c RequestCount
+		if err := rows.Scan(&c.Day, &c.EntityID, &c.Status, &c.SchemaKind, &c.Count, &refreshedAt); err != nil {
+			return nil, nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, refreshedAt, rows.Err()
+}
+
+// ListFlowCounts aggregates the flows matching f, owned by the filter's
+// entity if set, like ListRequestCounts
+func (q *Queries) ListFlowCounts(ctx context.Context, f StatsFilter, materialized bool) ([]FlowCount, *time.Time, error) {
+	// Archived flows count under the status they finished with
+	query := `SELECT (created_at AT TIME ZONE 'UTC')::date, kind, COALESCE(archived_status, status), COUNT(*),
+			COALESCE(SUM(EXTRACT(EPOCH FROM updated_at - created_at)) FILTER (WHERE COALESCE(archived_status, status) = 'COMPLETED'), 0)::float8,
+			NULL::timestamptz
+		FROM flows
+		WHERE created_at >= $1::date AT TIME ZONE 'UTC' AND created_at < ($2::date + 1) AT TIME ZONE 'UTC'
+		  AND deleted_at IS NULL
+		  AND ($3::uuid IS NULL OR owner_entity = $3)
+		GROUP BY 1, 2, 3`
+	if materialized {
+		query = `SELECT day, kind, status, SUM(count)::bigint, SUM(completed_seconds)::float8, MAX(refreshed_at)
+			FROM flow_stats_daily
+			WHERE day >= $1::date AND day <= $2::date AND ($3::uuid IS NULL OR owner_entity = $3)
+			GROUP BY 1, 2, 3`
+	}
+
+	rows, err := q.Pool.Query(ctx, query, f.From, f.To, f.EntityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var counts []FlowCount
+	var refreshedAt *time.Time
+	for rows.Next() {
+		var c FlowCount
+		if err := rows.Scan(&c.Day, &c.Kind, &c.Status, &c.Count, &c.CompletedSeconds, &refreshedAt); err != nil {
+			return nil, nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, refreshedAt, rows.Err()
+}
+
+// RefreshStats refreshes the materialized stats views without blocking
+// readers
+func (q *Queries) RefreshStats(ctx context.Context) error {
+	for _, view := range []string{"request_stats_daily", "flow_stats_daily"} {
+		if _, err := q.Pool.Exec(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY `+view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// StoredEvent is an event kept for replay in stream_events
+type StoredEvent struct {
+	Channel   string
+	Seq       int64
+	Event     map[string]interface{}
+	CreatedAt time.Time
+}
+
+// AppendStreamEvent stores an event under the channel's next sequence
+// number and returns it. Events beyond the newest maxLen, or older than
+// maxAge, are trimmed from the channel; zero keeps them.
+func (q *Queries) AppendStreamEvent(ctx context.Context, channel string, event map[string]interface{}, maxLen int64, maxAge time.Duration) (int64, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	var seq int64
+	err = q.Pool.QueryRow(ctx,
+		`WITH next AS (
+			INSERT INTO stream_sequences (channel, seq) VALUES ($1, 1)
+			ON CONFLICT (channel) DO UPDATE SET seq = stream_sequences.seq + 1
+			RETURNING seq
+		)
+		INSERT INTO stream_events (channel, seq, event)
+		SELECT $1, seq, $2 FROM next
+		RETURNING seq`,
+		channel, data,
+	).Scan(&seq)
+	if err != nil {
+		return 0, err
+	}
+
+	if maxLen > 0 || maxAge > 0 {
+		_, err = q.Pool.Exec(ctx,
+			`DELETE FROM stream_events
+			WHERE channel = $1
+			  AND (($2::bigint > 0 AND seq <= $3::bigint - $2::bigint)
+			    OR ($4::bigint > 0 AND created_at < NOW() - make_interval(secs => $4::bigint / 1000.0)))`,
+			channel, maxLen, seq, maxAge.Milliseconds(),
+		)
+	}
+	return seq, err
+}
+
+// GetStreamEvent returns a stored event by its sequence number
+func (q *Queries) GetStreamEvent(ctx context.Context, channel string, seq int64) (StoredEvent, error) {
+	e := StoredEvent{Channel: channel, Seq: seq}
+	var data []byte
+	err := q.Pool.QueryRow(ctx,
+		`SELECT event, created_at FROM stream_events WHERE channel = $1 AND seq = $2`,
+		channel, seq,
+	).Scan(&data, &e.CreatedAt)
+	if err != nil {
+		return e, err
+	}
+	return e, json.Unmarshal(data, &e.Event)
+}
+
+// ListStreamEvents returns up to limit events of a channel after sinceSeq,
+// oldest first
+func (q *Queries) ListStreamEvents(ctx context.Context, channel string, sinceSeq, limit int64) ([]StoredEvent, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT seq, event, created_at FROM stream_events
+		WHERE channel = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3`,
+		channel, sinceSeq, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]StoredEvent, 0)
+	for rows.Next() {
+		e := StoredEvent{Channel: channel}
+		var data []byte
+		if err := rows.Scan(&e.Seq, &data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e.Event); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// DeleteStreamEvents removes stored events of a channel: all of them if
+// seqs is nil, otherwise those listed. The sequence counter is kept.
+func (q *Queries) DeleteStreamEvents(ctx context.Context, channel string, seqs []int64) (int64, error) {
+	tag, err := q.Pool.Exec(ctx,
+		`DELETE FROM stream_events
+		WHERE channel = $1 AND ($2::bigint[] IS NULL OR seq = ANY($2))`,
+		channel, seqs,
+	)
+	return tag.RowsAffected(), err
+}
+
+// DeleteExpiredStreamEvents removes the events older than before from the
+// channels of the given types (the part of the name before the first
+// colon), or with exclude from the channels of all other types, and returns
+// how many it removed
+func (q *Queries) DeleteExpiredStreamEvents(ctx context.Context, types []string, exclude bool, before time.Time) (int64, error) {
+	tag, err := q.Pool.Exec(ctx,
+		`DELETE FROM stream_events
+		WHERE (split_part(channel, ':', 1) = ANY($1::text[])) <> $2 AND created_at < $3`,
+		types, exclude, before,
+	)
+	return tag.RowsAffected(), err
+}
+
+// GetStreamAck returns the last sequence a connection acknowledged on a
+// channel, or pgx.ErrNoRows
+func (q *Queries) GetStreamAck(ctx context.Context, channel, connectionID string) (int64, error) {
+	var seq int64
+	err := q.Pool.QueryRow(ctx,
+		`SELECT seq FROM stream_acks WHERE channel = $1 AND connection_id = $2`,
+		channel, connectionID,
+	).Scan(&seq)
+	return seq, err
+}
+
+// SetStreamAck records the last sequence a connection acknowledged
+func (q *Queries) SetStreamAck(ctx context.Context, channel, connectionID string, seq int64) error {
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO stream_acks (channel, connection_id, seq) VALUES ($1, $2, $3)
+		ON CONFLICT (channel, connection_id) DO UPDATE SET seq = EXCLUDED.seq, updated_at = NOW()`,
+		channel, connectionID, seq,
+	)
+	return err
+}
+
+// NotifyEvent sends payload to the listeners of a NOTIFY channel
+func (q *Queries) NotifyEvent(ctx context.Context, notifyChannel, payload string) error {
+	_, err := q.Pool.Exec(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, payload)
+	return err
+}
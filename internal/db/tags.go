@@ -0,0 +1,57 @@
+package db
+
+import "context"
+
+// SetRequestTags replaces the tags of a request. If expectedVersion is set,
+// the update only applies at that version; it returns pgx.ErrNoRows if the
+// request does not exist or is at another version.
+func (q *Queries) SetRequestTags(ctx context.Context, id string, tags []string, expectedVersion *int) (int, error) {
+	defer q.forgetRequests(ctx, []string{id})
+	var version int
+	err := q.Pool.QueryRow(ctx,
+		`UPDATE requests
+		SET tags = COALESCE($2::text[], '{}'), version = version + 1, updated_at = NOW()
+		WHERE id = $1
+		  AND ($3::int IS NULL OR version = $3)
+		RETURNING version`,
+		id, tags, expectedVersion,
+	).Scan(&version)
+	return version, err
+}
+
+// TagSummary counts the requests of an entity carrying a tag
+type TagSummary struct {
+	Tag    string
+	Total  int64
+	Open   int64 // Pending or claimed
+	Unread int64 // Open and not yet read
+}
+
+// GetEntityTagSummary counts the requests of an entity per tag, in tag order
+func (q *Queries) GetEntityTagSummary(ctx context.Context, entityID string) ([]TagSummary, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT t.tag,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE r.status IN ('PENDING', 'CLAIMED')),
+			COUNT(*) FILTER (WHERE r.status IN ('PENDING', 'CLAIMED') AND r.read_at IS NULL)
+		FROM requests r, unnest(r.tags) AS t(tag)
+		WHERE r.entity_id = $1 AND r.deleted_at IS NULL
+		GROUP BY t.tag
+		ORDER BY t.tag`,
+		entityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := make([]TagSummary, 0)
+	for rows.Next() {
+		var s TagSummary
+		if err := rows.Scan(&s.Tag, &s.Total, &s.Open, &s.Unread); err != nil {
+			return nil, err
+		}
+		summary = append(summary, s)
+	}
+	return summary, rows.Err()
+}
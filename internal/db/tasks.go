@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RequestTask is a scheduled background task of a request
+type RequestTask struct {
+	RequestID string
+	Kind      string
+	TaskID    string
+	ProcessAt time.Time
+}
+
+// SaveRequestTask records the scheduled task of a kind, replacing the
+// previous one
+func (q *Queries) SaveRequestTask(ctx context.Context, t RequestTask) error {
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO request_tasks (request_id, kind, task_id, process_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (request_id, kind)
+		DO UPDATE SET task_id = EXCLUDED.task_id, process_at = EXCLUDED.process_at, created_at = NOW()`,
+		t.RequestID, t.Kind, t.TaskID, t.ProcessAt,
+	)
+	return err
+}
+
+// ListRequestTasks returns the recorded tasks of a request
+func (q *Queries) ListRequestTasks(ctx context.Context, requestID string) ([]RequestTask, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT request_id, kind, task_id, process_at
+		FROM request_tasks WHERE request_id = $1
+		ORDER BY kind`,
+		requestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []RequestTask
+	for rows.Next() {
+		var t RequestTask
+		if err := rows.Scan(&t.RequestID, &t.Kind, &t.TaskID, &t.ProcessAt); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// DeleteRequestTask forgets the recorded task of a kind
+func (q *Queries) DeleteRequestTask(ctx context.Context, requestID, kind string) error {
+	_, err := q.Pool.Exec(ctx,
+		`DELETE FROM request_tasks WHERE request_id = $1 AND kind = $2`,
+		requestID, kind,
+	)
+	return err
+}
+
+// UpdateRequestDeadline moves the deadline of an open request, only at
+// expectedVersion if set. It bumps the version and returns pgx.ErrNoRows if
+// no row matched.
+func (q *Queries) UpdateRequestDeadline(ctx context.Context, id string, deadlineAt time.Time, expectedVersion *int) (int, error) {
+	defer q.forgetRequests(ctx, []string{id})
+	var version int
+	err := q.Pool.QueryRow(ctx,
+		`UPDATE requests
+		SET deadline_at = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND status IN ('PENDING', 'CLAIMED')
+		  AND ($3::int IS NULL OR version = $3)
+		RETURNING version`,
+		id, deadlineAt, expectedVersion,
+	).Scan(&version)
+	return version, err
+}
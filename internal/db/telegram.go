@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// TelegramChat is the Telegram chat of an entity, or its pending link code
+type TelegramChat struct {
+	EntityID      string
+	ChatID        *int64 // Nil until the link code was sent to the bot
+	CodeExpiresAt *time.Time
+	LinkedAt      *time.Time
+	CreatedAt     time.Time
+}
+
+// SetTelegramLinkCode replaces the pending link code of an entity. A chat
+// linked before stays linked until the code is used.
+func (q *Queries) SetTelegramLinkCode(ctx context.Context, entityID, codeHash string, expiresAt time.Time) error {
+	_, err := q.Pool.Exec(ctx,
+		`INSERT INTO telegram_chats (entity_id, code_hash, code_expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (entity_id) DO UPDATE
+		SET code_hash = EXCLUDED.code_hash, code_expires_at = EXCLUDED.code_expires_at`,
+		entityID, codeHash, expiresAt,
+	)
+	return err
+}
+
+// LinkTelegramChat links a chat to the entity of an unexpired link code,
+// taking it from an entity it was linked to before, and returns the
+// entity. It returns pgx.ErrNoRows for unknown or expired codes. It must be
+// called inside InTx.
+func (q *Queries) LinkTelegramChat(ctx context.Context, codeHash string, chatID int64) (string, error) {
+	var entityID string
+	err := q.Pool.QueryRow(ctx,
+		`SELECT entity_id FROM telegram_chats
+		WHERE code_hash = $1 AND code_expires_at > NOW()
+		FOR UPDATE`,
+		codeHash,
+	).Scan(&entityID)
+	if err != nil {
+		return "", err
+	}
+	_, err = q.Pool.Exec(ctx,
+		`UPDATE telegram_chats SET chat_id = NULL, linked_at = NULL
+		WHERE chat_id = $1 AND entity_id <> $2`,
+		chatID, entityID,
+	)
+	if err != nil {
+		return "", err
+	}
+	_, err = q.Pool.Exec(ctx,
+		`UPDATE telegram_chats
+		SET chat_id = $2, linked_at = NOW(), code_hash = NULL, code_expires_at = NULL
+		WHERE entity_id = $1`,
+		entityID, chatID,
+	)
+	return entityID, err
+}
+
+// GetTelegramChat returns the Telegram chat of an entity, or pgx.ErrNoRows
+// if it never asked for a link code
+func (q *Queries) GetTelegramChat(ctx context.Context, entityID string) (TelegramChat, error) {
+	var c TelegramChat
+	err := q.Pool.QueryRow(ctx,
+		`SELECT entity_id, chat_id, code_expires_at, linked_at, created_at
+		FROM telegram_chats WHERE entity_id = $1`,
+		entityID,
+	).Scan(&c.EntityID, &c.ChatID, &c.CodeExpiresAt, &c.LinkedAt, &c.CreatedAt)
+	return c, err
+}
+
+// GetTelegramChatEntity returns the entity a chat is linked to, or
+// pgx.ErrNoRows for chats that are not linked
+func (q *Queries) GetTelegramChatEntity(ctx context.Context, chatID int64) (string, error) {
+	var entityID string
+	err := q.Pool.QueryRow(ctx,
+		`SELECT entity_id FROM telegram_chats WHERE chat_id = $1`,
+		chatID,
+	).Scan(&entityID)
+	return entityID, err
+}
+
+// DeleteTelegramChat unlinks the chat of an entity and drops its link
+// code. It reports whether there was either.
+func (q *Queries) DeleteTelegramChat(ctx context.Context, entityID string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM telegram_chats WHERE entity_id = $1`, entityID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UnlinkTelegramChatID unlinks a chat Telegram no longer delivers to, e.g.
+// because the user blocked the bot
+func (q *Queries) UnlinkTelegramChatID(ctx context.Context, chatID int64) error {
+	_, err := q.Pool.Exec(ctx, `DELETE FROM telegram_chats WHERE chat_id = $1`, chatID)
+	return err
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Default statement timeouts. Reads get longer than writes since searches
+// and listings scan more rows; DefaultStatementTimeout is the server-side
+// backstop for statements that bypass Queries.
+const (
+	DefaultReadTimeout      = 10 * time.Second
+	DefaultWriteTimeout     = 5 * time.Second
+	DefaultStatementTimeout = 30 * time.Second
+)
+
+// Timeouts bound single statements by class, so that a slow query cannot
+// hold a pool connection for long. Zero leaves a class unbounded. A
+// deadline already on the context still applies when it is sooner.
+type Timeouts struct {
+	Read      time.Duration // SELECT statements
+	Write     time.Duration // Everything else
+	Statement time.Duration // statement_timeout set on each connection
+}
+
+// TimeoutsFromEnv reads DB_READ_TIMEOUT, DB_WRITE_TIMEOUT and
+// DB_STATEMENT_TIMEOUT, falling back to the defaults; "0" disables one
+func TimeoutsFromEnv() (Timeouts, error) {
+	t := Timeouts{Read: DefaultReadTimeout, Write: DefaultWriteTimeout, Statement: DefaultStatementTimeout}
+	for name, d := range map[string]*time.Duration{
+		"DB_READ_TIMEOUT":      &t.Read,
+		"DB_WRITE_TIMEOUT":     &t.Write,
+		"DB_STATEMENT_TIMEOUT": &t.Statement,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if v == "0" {
+			parsed, err = 0, nil
+		}
+		if err != nil || parsed < 0 {
+			return Timeouts{}, fmt.Errorf("invalid %s %q", name, v)
+		}
+		*d = parsed
+	}
+	return t, nil
+}
+
+// timeoutDB bounds the statements of a DBTX by class, including those of
+// the transactions it begins
+type timeoutDB struct {
+	db DBTX
+	t  Timeouts
+}
+
+// WithTimeouts wraps db so each statement runs under the timeout of its
+// class
+func WithTimeouts(db DBTX, t Timeouts) DBTX {
+	return &timeoutDB{db: db, t: t}
+}
+
+type unboundedKey struct{}
+
+// withoutTimeouts exempts the statements run under ctx from Timeouts, for
+// ones that legitimately run long such as streaming exports
+func withoutTimeouts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unboundedKey{}, true)
+}
+
+// bound returns ctx limited by the timeout of the class of sql
+func (t Timeouts) bound(ctx context.Context, sql string) (context.Context, context.CancelFunc) {
+	d := t.Write
+	if isRead(sql) {
+		d = t.Read
+	}
+	if d <= 0 || ctx.Value(unboundedKey{}) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// isRead reports whether sql is a plain SELECT. Statements starting with
+// WITH may modify data and count as writes.
+func isRead(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	return len(sql) >= 6 && strings.EqualFold(sql[:6], "SELECT")
+}
+
+func (d *timeoutDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return execBounded(ctx, d.db, d.t, sql, args...)
+}
+
+func (d *timeoutDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return queryBounded(ctx, d.db, d.t, sql, args...)
+}
+
+func (d *timeoutDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return queryRowBounded(ctx, d.db, d.t, sql, args...)
+}
+
+// Begin starts a transaction whose statements are bounded like the
+// connection's
+func (d *timeoutDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	b, ok := d.db.(beginner)
+	if !ok {
+		return nil, errors.New("connection does not support transactions")
+	}
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutTx{Tx: tx, t: d.t}, nil
+}
+
+// timeoutTx bounds the statements of a transaction
+type timeoutTx struct {
+	pgx.Tx
+	t Timeouts
+}
+
+func (tx *timeoutTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return execBounded(ctx, tx.Tx, tx.t, sql, args...)
+}
+
+func (tx *timeoutTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return queryBounded(ctx, tx.Tx, tx.t, sql, args...)
+}
+
+func (tx *timeoutTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return queryRowBounded(ctx, tx.Tx, tx.t, sql, args...)
+}
+
+func execBounded(ctx context.Context, db DBTX, t Timeouts, sql string, args ...any) (pgconn.CommandTag, error) {
+	ctx, cancel := t.bound(ctx, sql)
+	defer cancel()
+	return db.Exec(ctx, sql, args...)
+}
+
+func queryBounded(ctx context.Context, db DBTX, t Timeouts, sql string, args ...any) (pgx.Rows, error) {
+	ctx, cancel := t.bound(ctx, sql)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Rows are read after Query returns, so the timeout ends with them
+	return &boundedRows{Rows: rows, cancel: cancel}, nil
+}
+
+func queryRowBounded(ctx context.Context, db DBTX, t Timeouts, sql string, args ...any) pgx.Row {
+	ctx, cancel := t.bound(ctx, sql)
+	return &boundedRow{row: db.QueryRow(ctx, sql, args...), cancel: cancel}
+}
+
+type boundedRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *boundedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+	return false
+}
+
+func (r *boundedRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+type boundedRow struct {
+	row    pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r *boundedRow) Scan(dest ...any) error {
+	defer r.cancel()
+	return r.row.Scan(dest...)
+}
+
+// unbounded runs fn on a transaction exempt from Timeouts and from the
+// server-side statement_timeout. Only ctx bounds it.
+func (q *Queries) unbounded(ctx context.Context, fn func(context.Context, DBTX) error) error {
+	ctx = withoutTimeouts(ctx)
+	b, ok := q.Pool.(beginner)
+	if !ok {
+		return fn(ctx, q.Pool)
+	}
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
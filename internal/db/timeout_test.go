@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRead(t *testing.T) {
+	assert.True(t, isRead("SELECT 1"))
+	assert.True(t, isRead("\n\t\tselect id FROM requests"))
+	assert.False(t, isRead("UPDATE requests SET status = $2"))
+	assert.False(t, isRead("WITH moved AS (DELETE FROM jobs RETURNING *) SELECT 1"))
+	assert.False(t, isRead(""))
+}
+
+func TestTimeoutsFromEnv(t *testing.T) {
+	timeouts, err := TimeoutsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Timeouts{Read: DefaultReadTimeout, Write: DefaultWriteTimeout, Statement: DefaultStatementTimeout}, timeouts)
+
+	t.Setenv("DB_READ_TIMEOUT", "2s")
+	t.Setenv("DB_STATEMENT_TIMEOUT", "0")
+	timeouts, err = TimeoutsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, timeouts.Read)
+	assert.Zero(t, timeouts.Statement)
+
+	t.Setenv("DB_WRITE_TIMEOUT", "soon")
+	_, err = TimeoutsFromEnv()
+	assert.Error(t, err)
+}
+
+func TestTimeoutsBound(t *testing.T) {
+	timeouts := Timeouts{Read: time.Hour, Write: time.Minute}
+
+	ctx, cancel := timeouts.bound(context.Background(), "UPDATE requests SET read_at = NOW()")
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// A sooner deadline of the caller is kept
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	ctx, cancel = timeouts.bound(parent, "SELECT 1")
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+
+	ctx, cancel = timeouts.bound(withoutTimeouts(context.Background()), "SELECT 1")
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// beginner is implemented by connections that can start a transaction
+type beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// InTx runs fn with Queries bound to a single transaction, committing if fn
+// returns nil and rolling back otherwise. If the underlying connection cannot
+// start transactions, fn runs against q directly.
+func (q *Queries) InTx(ctx context.Context, fn func(Querier) error) error {
+	b, ok := q.Pool.(beginner)
+	if !ok {
+		return fn(q)
+	}
+
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txq := &Queries{Pool: tx, refs: q.refs, written: &writtenRequests{}}
+	if err := fn(txq); err != nil {
+		// The memo may hold rows as the transaction saw them
+		memoFrom(ctx).forget(nil)
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		memoFrom(ctx).forget(nil)
+		return err
+	}
+	if w := txq.written; w.all {
+		q.forgetRequests(ctx, nil)
+	} else if len(w.ids) > 0 {
+		q.forgetRequests(ctx, w.ids)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// SavedView is a named inquiry filter of an entity
+type SavedView struct {
+	ID        string
+	EntityID  string
+	Name      string
+	Filter    map[string]interface{}
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const savedViewColumns = `id, entity_id, name, filter, created_at, updated_at`
+
+func scanSavedView(row interface{ Scan(...interface{}) error }) (SavedView, error) {
+	var v SavedView
+	err := row.Scan(&v.ID, &v.EntityID, &v.Name, &v.Filter, &v.CreatedAt, &v.UpdatedAt)
+	return v, err
+}
+
+// CreateSavedView stores a view. A name the entity already uses fails with
+// a unique violation.
+func (q *Queries) CreateSavedView(ctx context.Context, id, entityID, name string, filter map[string]interface{}) (SavedView, error) {
+	return scanSavedView(q.Pool.QueryRow(ctx,
+		`INSERT INTO saved_views (id, entity_id, name, filter)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+savedViewColumns,
+		id, entityID, name, filter,
+	))
+}
+
+// GetSavedView returns a view by ID
+func (q *Queries) GetSavedView(ctx context.Context, id string) (SavedView, error) {
+	return scanSavedView(q.Pool.QueryRow(ctx,
+		`SELECT `+savedViewColumns+` FROM saved_views WHERE id = $1`,
+		id,
+	))
+}
+
+// ListSavedViews returns the views of an entity by name
+func (q *Queries) ListSavedViews(ctx context.Context, entityID string) ([]SavedView, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+savedViewColumns+` FROM saved_views WHERE entity_id = $1 ORDER BY name`,
+		entityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := make([]SavedView, 0)
+	for rows.Next() {
+		v, err := scanSavedView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// UpdateSavedView renames a view of an entity and replaces its filter. It
+// returns pgx.ErrNoRows if the entity has no such view.
+func (q *Queries) UpdateSavedView(ctx context.Context, id, entityID, name string, filter map[string]interface{}) (SavedView, error) {
+	return scanSavedView(q.Pool.QueryRow(ctx,
+		`UPDATE saved_views
+		SET name = $3, filter = $4, updated_at = NOW()
+		WHERE id = $1 AND entity_id = $2
+		RETURNING `+savedViewColumns,
+		id, entityID, name, filter,
+	))
+}
+
+// DeleteSavedView removes a view of an entity and reports whether it existed
+func (q *Queries) DeleteSavedView(ctx context.Context, id, entityID string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx,
+		`DELETE FROM saved_views WHERE id = $1 AND entity_id = $2`,
+		id, entityID,
+	)
+	return tag.RowsAffected() > 0, err
+}
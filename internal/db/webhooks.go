@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Webhook is a subscription to the events of a channel
+type Webhook struct {
+	ID                      string
+	Channel                 string
+	URL                     string
+	EventTypes              []string
+	Secret                  string
+	PreviousSecret          *string
+	PreviousSecretExpiresAt *time.Time
+	Active                  bool
+	CreatedBy               string
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+}
+
+// WebhookDelivery is an event delivered, or being delivered, to a webhook
+type WebhookDelivery struct {
+	ID             string
+	WebhookID      string
+	EventType      string
+	Event          map[string]interface{}
+	Status         string
+	Attempts       int
+	ResponseStatus *int
+	Error          *string
+	CreatedAt      time.Time
+	LastAttemptAt  *time.Time
+	DeliveredAt    *time.Time
+}
+
+type CreateWebhookParams struct {
+	ID         string
+	Channel    string
+	URL        string
+	EventTypes []string
+	Secret     string
+	CreatedBy  string
+}
+
+const webhookColumns = `id, channel, url, event_types, secret, previous_secret, previous_secret_expires_at,
+	active, created_by, created_at, updated_at`
+
+const webhookDeliveryColumns = `id, webhook_id, event_type, event, status, attempts, response_status, error,
+	created_at, last_attempt_at, delivered_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (Webhook, error) {
+	var w Webhook
+	err := row.Scan(&w.ID, &w.Channel, &w.URL, &w.EventTypes, &w.Secret, &w.PreviousSecret, &w.PreviousSecretExpiresAt,
+		&w.Active, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Event, &d.Status, &d.Attempts, &d.ResponseStatus, &d.Error,
+		&d.CreatedAt, &d.LastAttemptAt, &d.DeliveredAt)
+	return d, err
+}
+
+// CreateWebhook subscribes a URL to the events of a channel
+func (q *Queries) CreateWebhook(ctx context.Context, p CreateWebhookParams) (Webhook, error) {
+	return scanWebhook(q.Pool.QueryRow(ctx,
+		`INSERT INTO webhooks (id, channel, url, event_types, secret, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+webhookColumns,
+		p.ID, p.Channel, p.URL, p.EventTypes, p.Secret, p.CreatedBy,
+	))
+}
+
+// GetWebhook returns a webhook by ID
+func (q *Queries) GetWebhook(ctx context.Context, id string) (Webhook, error) {
+	return scanWebhook(q.Pool.QueryRow(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`,
+		id,
+	))
+}
+
+// ListWebhooks returns the webhooks of a channel, oldest first, only the
+// active ones if activeOnly is set
+func (q *Queries) ListWebhooks(ctx context.Context, channel string, activeOnly bool) ([]Webhook, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks
+		WHERE channel = $1 AND (active OR NOT $2::boolean)
+		ORDER BY created_at, id`,
+		channel, activeOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// UpdateWebhook changes the URL, event types and active flag of a webhook;
+// nil values keep the current ones
+func (q *Queries) UpdateWebhook(ctx context.Context, id string, url *string, eventTypes []string, active *bool) (Webhook, error) {
+	return scanWebhook(q.Pool.QueryRow(ctx,
+		`UPDATE webhooks
+		SET url = COALESCE($2, url),
+			event_types = COALESCE($3, event_types),
+			active = COALESCE($4, active),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+webhookColumns,
+		id, url, eventTypes, active,
+	))
+}
+
+// RotateWebhookSecret replaces the secret of a webhook. The old secret
+// stays valid as previous_secret until previousExpiresAt.
+func (q *Queries) RotateWebhookSecret(ctx context.Context, id, secret string, previousExpiresAt time.Time) (Webhook, error) {
+	return scanWebhook(q.Pool.QueryRow(ctx,
+		`UPDATE webhooks
+		SET previous_secret = secret, previous_secret_expires_at = $3, secret = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+webhookColumns,
+		id, secret, previousExpiresAt,
+	))
+}
+
+// DeleteWebhook removes a webhook with its deliveries and reports whether
+// it existed
+func (q *Queries) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	tag, err := q.Pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	return tag.RowsAffected() > 0, err
+}
+
+// CreateWebhookDelivery records a pending delivery of an event
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, id, webhookID, eventType string, event map[string]interface{}) (WebhookDelivery, error) {
+	return scanWebhookDelivery(q.Pool.QueryRow(ctx,
+		`INSERT INTO webhook_deliveries (id, webhook_id, event_type, event)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+webhookDeliveryColumns,
+		id, webhookID, eventType, event,
+	))
+}
+
+// GetWebhookDelivery returns a delivery by ID
+func (q *Queries) GetWebhookDelivery(ctx context.Context, id string) (WebhookDelivery, error) {
+	return scanWebhookDelivery(q.Pool.QueryRow(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id = $1`,
+		id,
+	))
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first,
+// optionally only those with a status
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, webhookID string, status *string, limit, offset int) ([]WebhookDelivery, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2::text IS NULL OR status = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`,
+		webhookID, status, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt counts a delivery attempt and stores its outcome
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, id, status string, responseStatus *int, errMsg *string) error {
+	_, err := q.Pool.Exec(ctx,
+		`UPDATE webhook_deliveries
+		SET status = $2, response_status = $3, error = $4, attempts = attempts + 1, last_attempt_at = NOW(),
+			delivered_at = CASE WHEN $2 = 'DELIVERED' THEN NOW() ELSE delivered_at END
+		WHERE id = $1`,
+		id, status, responseStatus, errMsg,
+	)
+	return err
+}
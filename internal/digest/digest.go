@@ -0,0 +1,134 @@
+// Package digest compiles and renders the periodic summaries of open
+// inquiries sent to entities that prefer them over individual pings
+package digest
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"pxbox/internal/db"
+)
+
+// DefaultExpiringWithin is how close a deadline has to be for a request to
+// be listed as expiring soon
+const DefaultExpiringWithin = 24 * time.Hour
+
+// ExpiringWithinFromEnv returns the expiring-soon window from
+// DIGEST_EXPIRING_WITHIN
+func ExpiringWithinFromEnv() time.Duration {
+	if v := os.Getenv("DIGEST_EXPIRING_WITHIN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultExpiringWithin
+}
+
+// Item is a request listed in a digest
+type Item struct {
+	RequestID string     `json:"requestId"`
+	Title     string     `json:"title,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DueAt     *time.Time `json:"dueAt,omitempty"`
+}
+
+// Digest summarizes the open inquiries of an entity
+type Digest struct {
+	EntityID     string    `json:"entityId"`
+	Period       string    `json:"period"` // "daily" or "weekly"
+	Since        time.Time `json:"since"`
+	New          []Item    `json:"new"`
+	Overdue      []Item    `json:"overdue"`
+	ExpiringSoon []Item    `json:"expiringSoon"`
+}
+
+// Build sorts the items of a digest into its sections
+func Build(entityID, period string, since time.Time, items []db.DigestItem) *Digest {
+	d := &Digest{EntityID: entityID, Period: period, Since: since, New: []Item{}, Overdue: []Item{}, ExpiringSoon: []Item{}}
+	for _, it := range items {
+		item := Item{RequestID: it.RequestID, Title: it.Title, CreatedBy: it.CreatedBy, CreatedAt: it.CreatedAt, DueAt: it.DueAt}
+		switch it.Section {
+		case db.DigestOverdue:
+			d.Overdue = append(d.Overdue, item)
+		case db.DigestExpiring:
+			d.ExpiringSoon = append(d.ExpiringSoon, item)
+		default:
+			d.New = append(d.New, item)
+		}
+	}
+	return d
+}
+
+// Empty reports whether the digest lists nothing
+func (d *Digest) Empty() bool {
+	return len(d.New) == 0 && len(d.Overdue) == 0 && len(d.ExpiringSoon) == 0
+}
+
+//go:embed digest.tmpl
+var defaultTemplate string
+
+// Renderer renders digests as text
+type Renderer struct {
+	tmpl *template.Template
+}
+
+// funcs are available to digest templates. "local" formats a time in the
+// entity's timezone; it is bound per render.
+var funcs = template.FuncMap{
+	"local": func(t time.Time) string { return t.UTC().Format("Mon 2 Jan 15:04") },
+	"label": func(it Item) string {
+		if it.Title != "" {
+			return it.Title
+		}
+		return it.RequestID
+	},
+}
+
+// NewRenderer parses a digest template; an empty text uses the built-in one
+func NewRenderer(text string) (*Renderer, error) {
+	if text == "" {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New("digest").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest template: %w", err)
+	}
+	return &Renderer{tmpl: tmpl}, nil
+}
+
+// RendererFromEnv uses the template file at DIGEST_TEMPLATE, or the
+// built-in template
+func RendererFromEnv() (*Renderer, error) {
+	path := os.Getenv("DIGEST_TEMPLATE")
+	if path == "" {
+		return NewRenderer("")
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digest template: %w", err)
+	}
+	return NewRenderer(string(text))
+}
+
+// Render renders a digest with times in loc
+func (r *Renderer) Render(d *Digest, loc *time.Location) (string, error) {
+	tmpl, err := r.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"local": func(t time.Time) string { return t.In(loc).Format("Mon 2 Jan 15:04") },
+	})
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("failed to render digest: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
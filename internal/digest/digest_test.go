@@ -0,0 +1,44 @@
+package digest
+
+import (
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildAndRender(t *testing.T) {
+	since := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 3, 6, 17, 0, 0, 0, time.UTC)
+	d := Build("e1", "daily", since, []db.DigestItem{
+		{RequestID: "r1", Title: "Expense report", CreatedBy: "billing", Section: db.DigestOverdue, DueAt: &due},
+		{RequestID: "r2", CreatedBy: "hr", Section: db.DigestNew},
+	})
+	assert.Len(t, d.Overdue, 1)
+	assert.Len(t, d.New, 1)
+	assert.Empty(t, d.ExpiringSoon)
+	assert.False(t, d.Empty())
+
+	r, err := NewRenderer("")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		berlin = time.UTC
+	}
+	text, err := r.Render(d, berlin)
+	require.NoError(t, err)
+	assert.Contains(t, text, "Your daily inquiry summary")
+	assert.Contains(t, text, "Overdue (1):\n- Expense report from billing, due Wed 6 Mar")
+	assert.Contains(t, text, "- r2 from hr")
+	assert.NotContains(t, text, "Due soon")
+
+	assert.True(t, Build("e1", "weekly", since, nil).Empty())
+}
+
+func TestNewRendererRejectsInvalidTemplate(t *testing.T) {
+	_, err := NewRenderer("{{.Missing")
+	assert.Error(t, err)
+}
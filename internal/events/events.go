@@ -0,0 +1,186 @@
+// Package events defines the events pxbox publishes to WebSocket clients,
+// webhooks and the event backend. Every event is built from a typed struct
+// by New and travels in the same envelope:
+//
+//	{"type": "request.answered", "version": 1, "occurredAt": "...", "data": {...}}
+//
+// The registry holds the data struct and version of every event type, so
+// Validate can check an event before it is published. A breaking change to
+// the data of a type raises its version; adding an optional field does not.
+// docs/events.md lists the types and their fields.
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"pxbox/internal/correlation"
+)
+
+// ErrInvalid is returned by Validate for events that do not match their
+// registered shape
+var ErrInvalid = errors.New("invalid event")
+
+// Data is the payload of an event. Each event type has its own struct.
+type Data interface {
+	EventType() string
+}
+
+// envelopeFields are the fields an event may carry besides its data. The
+// bus adds seq; pubsub.MarkSandbox adds sandbox.
+var envelopeFields = map[string]bool{
+	"type":          true,
+	"version":       true,
+	"occurredAt":    true,
+	"data":          true,
+	"correlationId": true,
+	"causationId":   true,
+	"seq":           true,
+	"sandbox":       true,
+}
+
+type registration struct {
+	version  int
+	data     reflect.Type
+	required []string // Data fields without omitempty
+}
+
+var registry = map[string]registration{}
+
+// register adds the data struct of an event type at a version
+func register(version int, data Data) {
+	t := reflect.TypeOf(data)
+	reg := registration{version: version, data: t}
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && !strings.Contains(opts, "omitempty") {
+			reg.required = append(reg.required, name)
+		}
+	}
+	registry[data.EventType()] = reg
+}
+
+// New wraps data in the envelope of its type, occurring now, with the
+// correlation and causation IDs of ctx. The data is returned as a map, as
+// consumers and the event stores handle events.
+func New(ctx context.Context, data Data) map[string]interface{} {
+	eventType := data.EventType()
+	var fields map[string]interface{}
+	raw, err := json.Marshal(data)
+	if err == nil {
+		err = json.Unmarshal(raw, &fields)
+	}
+	if err != nil {
+		// Validate rejects the event; the data structs always encode
+		fields = nil
+	}
+	event := map[string]interface{}{
+		"type":       eventType,
+		"version":    registry[eventType].version,
+		"occurredAt": time.Now().UTC().Format(time.RFC3339Nano),
+		"data":       fields,
+	}
+	if id := correlation.ID(ctx); id != "" {
+		event["correlationId"] = id
+		event["causationId"] = correlation.CausationID(ctx)
+	}
+	return event
+}
+
+// Validate checks that an event has a registered type and version, an
+// occurrence time and data with all required and no unknown fields
+func Validate(event map[string]interface{}) error {
+	eventType, _ := event["type"].(string)
+	reg, ok := registry[eventType]
+	if !ok {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalid, eventType)
+	}
+	for key := range event {
+		if !envelopeFields[key] {
+			return fmt.Errorf("%w: %s: unexpected field %q outside data", ErrInvalid, eventType, key)
+		}
+	}
+	if v, ok := number(event["version"]); !ok || v != reg.version {
+		return fmt.Errorf("%w: %s: version %v, want %d", ErrInvalid, eventType, event["version"], reg.version)
+	}
+	at, _ := event["occurredAt"].(string)
+	if _, err := time.Parse(time.RFC3339Nano, at); err != nil {
+		return fmt.Errorf("%w: %s: occurredAt %q is not an RFC 3339 time", ErrInvalid, eventType, at)
+	}
+
+	data, ok := event["data"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: %s: data is not an object", ErrInvalid, eventType)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, eventType, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(reflect.New(reg.data).Interface()); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, eventType, err)
+	}
+	for _, field := range reg.required {
+		if _, ok := data[field]; !ok {
+			return fmt.Errorf("%w: %s: missing field %q", ErrInvalid, eventType, field)
+		}
+	}
+	return nil
+}
+
+func number(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), float64(int(n)) == n
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
+
+// Types returns the registered event types, sorted
+func Types() []string {
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Version returns the current version of an event type, or 0 for unknown
+// types
+func Version(eventType string) int {
+	return registry[eventType].version
+}
+
+// Type returns the type of an event
+func Type(event map[string]interface{}) string {
+	t, _ := event["type"].(string)
+	return t
+}
+
+// DataOf returns the data of an event, or nil
+func DataOf(event map[string]interface{}) map[string]interface{} {
+	data, _ := event["data"].(map[string]interface{})
+	return data
+}
+
+// String returns a string field of an event's data, or ""
+func String(event map[string]interface{}, field string) string {
+	s, _ := DataOf(event)[field].(string)
+	return s
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pxbox/internal/correlation"
+)
+
+func TestNewValidatesForEveryType(t *testing.T) {
+	require.NotEmpty(t, Types())
+	for _, eventType := range Types() {
+		data := reflect.New(registry[eventType].data).Elem().Interface().(Data)
+		event := New(context.Background(), data)
+		assert.Equal(t, eventType, Type(event))
+		assert.Equal(t, 1, event["version"])
+		assert.NoError(t, Validate(event), eventType)
+
+		// As read back from a stream or a job payload
+		raw, err := json.Marshal(event)
+		require.NoError(t, err)
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal(raw, &decoded))
+		assert.NoError(t, Validate(decoded), eventType)
+	}
+}
+
+func TestNew(t *testing.T) {
+	event := New(context.Background(), RequestCreated{RequestID: "r1", BundleID: "b1"})
+	assert.Equal(t, "request.created", Type(event))
+	assert.Equal(t, map[string]interface{}{"requestId": "r1", "bundleId": "b1"}, DataOf(event))
+	assert.Equal(t, "r1", String(event, "requestId"))
+	assert.Equal(t, "", String(event, "entityId"))
+	assert.NotEmpty(t, event["occurredAt"])
+	assert.NotContains(t, event, "correlationId")
+
+	ctx := correlation.With(context.Background(), "req-abc", "task-1")
+	event = New(ctx, RequestCreated{RequestID: "r1"})
+	assert.Equal(t, "req-abc", event["correlationId"])
+	assert.Equal(t, "task-1", event["causationId"])
+	assert.NoError(t, Validate(event))
+}
+
+func TestValidateRejects(t *testing.T) {
+	valid := func() map[string]interface{} {
+		event := New(context.Background(), RequestUnclaimed{RequestID: "r1", Reason: "released"})
+		event["seq"] = int64(3)
+		event["sandbox"] = true
+		return event
+	}
+	require.NoError(t, Validate(valid()))
+
+	cases := map[string]func(map[string]interface{}){
+		"unknown type":     func(e map[string]interface{}) { e["type"] = "request.sent" },
+		"no type":          func(e map[string]interface{}) { delete(e, "type") },
+		"flat field":       func(e map[string]interface{}) { e["requestId"] = "r1" },
+		"other version":    func(e map[string]interface{}) { e["version"] = 2 },
+		"no version":       func(e map[string]interface{}) { delete(e, "version") },
+		"no occurredAt":    func(e map[string]interface{}) { delete(e, "occurredAt") },
+		"bad occurredAt":   func(e map[string]interface{}) { e["occurredAt"] = "yesterday" },
+		"no data":          func(e map[string]interface{}) { delete(e, "data") },
+		"unknown field":    func(e map[string]interface{}) { DataOf(e)["status"] = "PENDING" },
+		"missing field":    func(e map[string]interface{}) { delete(DataOf(e), "reason") },
+		"wrong field type": func(e map[string]interface{}) { DataOf(e)["requestId"] = 7 },
+	}
+	for name, change := range cases {
+		event := valid()
+		change(event)
+		assert.ErrorIs(t, Validate(event), ErrInvalid, name)
+	}
+}
+
+func TestOptionalFields(t *testing.T) {
+	event := New(context.Background(), FlowCreated{FlowID: "f1"})
+	assert.NotContains(t, DataOf(event), "parentFlowId")
+	assert.NoError(t, Validate(event))
+
+	DataOf(event)["parentFlowId"] = "f0"
+	assert.NoError(t, Validate(event))
+}
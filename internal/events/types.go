@@ -0,0 +1,421 @@
+package events
+
+import (
+	"pxbox/internal/digest"
+	"pxbox/internal/model"
+)
+
+func init() {
+	for _, data := range []Data{
+		RequestCreated{}, RequestClaimed{}, RequestUnclaimed{}, RequestDelivered{},
+		RequestAnswered{}, RequestCancelled{}, RequestExpired{}, RequestPurged{},
+		RequestUpdated{}, RequestDeadlineChanged{}, RequestDeadlineApproaching{},
+		RequestNeedsAttention{}, RequestReminder{}, RequestBotFailed{}, RequestDeferred{},
+		RequestAccepted{}, RequestRejected{},
+		InquiryUnsnoozed{}, InquiryDigest{}, CommentCreated{},
+		BundleCreated{}, BundleCompleted{},
+		FileUploaded{}, FileScanned{}, FilePreviewed{},
+		EntityUpdated{}, EntityDeactivated{}, EntityReactivated{}, EntityMerged{},
+		EntityOnline{}, EntityOffline{},
+		FlowCreated{}, FlowSuspended{}, FlowCompleted{}, FlowFailed{}, FlowUpdated{},
+		FlowTimedOut{},
+		JobFailed{}, ExportCompleted{}, ExportFailed{}, ErasureCompleted{}, ErasureFailed{},
+		LoadgenTick{},
+	} {
+		register(1, data)
+	}
+}
+
+// Times in event data are RFC 3339 strings in UTC.
+
+// RequestCreated is published when a request is created. Requestors get it
+// without the entity.
+type RequestCreated struct {
+	RequestID string `json:"requestId"`
+	EntityID  string `json:"entityId,omitempty"`
+	BundleID  string `json:"bundleId,omitempty"`
+}
+
+func (RequestCreated) EventType() string { return "request.created" }
+
+// RequestClaimed is published when a member of a group claims a request
+type RequestClaimed struct {
+	RequestID      string  `json:"requestId"`
+	ClaimedBy      string  `json:"claimedBy"`
+	ClaimedAt      *string `json:"claimedAt"`
+	ClaimExpiresAt string  `json:"claimExpiresAt,omitempty"`
+}
+
+func (RequestClaimed) EventType() string { return "request.claimed" }
+
+// RequestUnclaimed is published when a claim is released or expires
+type RequestUnclaimed struct {
+	RequestID string `json:"requestId"`
+	Reason    string `json:"reason"` // "released" or "expired"
+}
+
+func (RequestUnclaimed) EventType() string { return "request.unclaimed" }
+
+// RequestDelivered is published when the entity first receives a request
+type RequestDelivered struct {
+	RequestID   string `json:"requestId"`
+	EntityID    string `json:"entityId"`
+	DeliveredAt string `json:"deliveredAt"`
+}
+
+func (RequestDelivered) EventType() string { return "request.delivered" }
+
+// RequestAnswered is published when a request is answered. Only the
+// requestor's copy carries the answer, with x-sensitive properties masked
+// and Redacted set.
+type RequestAnswered struct {
+	RequestID string                   `json:"requestId"`
+	Payload   map[string]interface{}   `json:"payload,omitempty"`
+	Files     []map[string]interface{} `json:"files,omitempty"`
+	Redacted  bool                     `json:"redacted,omitempty"`
+}
+
+func (RequestAnswered) EventType() string { return "request.answered" }
+
+// RequestCancelled is published when a request is cancelled
+type RequestCancelled struct {
+	RequestID string `json:"requestId"`
+}
+
+func (RequestCancelled) EventType() string { return "request.cancelled" }
+
+// RequestExpired is published when a request passes its deadline
+type RequestExpired struct {
+	RequestID string `json:"requestId"`
+	Reason    string `json:"reason"`
+}
+
+func (RequestExpired) EventType() string { return "request.expired" }
+
+// RequestPurged is published when a sandbox request is deleted
+type RequestPurged struct {
+	RequestID string `json:"requestId"`
+}
+
+func (RequestPurged) EventType() string { return "request.purged" }
+
+// RequestUpdated is published when the tags of a request change
+type RequestUpdated struct {
+	RequestID string   `json:"requestId"`
+	Tags      []string `json:"tags"`
+	Version   int      `json:"version"` // Of the request
+}
+
+func (RequestUpdated) EventType() string { return "request.updated" }
+
+// RequestDeadlineChanged is published when a deadline is extended or
+// shortened
+type RequestDeadlineChanged struct {
+	RequestID          string  `json:"requestId"`
+	DeadlineAt         string  `json:"deadlineAt"`
+	PreviousDeadlineAt *string `json:"previousDeadlineAt"`
+	Version            int     `json:"version"` // Of the request
+}
+
+func (RequestDeadlineChanged) EventType() string { return "request.deadline_changed" }
+
+// RequestAccepted is published when the requestor accepts an answer
+type RequestAccepted struct {
+	RequestID string `json:"requestId"`
+	Version   int    `json:"version"` // Of the request
+}
+
+func (RequestAccepted) EventType() string { return "request.accepted" }
+
+// RequestRejected is published when the requestor rejects an answer. A
+// reopened request is PENDING again and waits for a corrected answer.
+type RequestRejected struct {
+	RequestID  string  `json:"requestId"`
+	Reason     *string `json:"reason,omitempty"`
+	Reopened   bool    `json:"reopened"`
+	DeadlineAt *string `json:"deadlineAt,omitempty"` // New deadline of a reopened request
+	Version    int     `json:"version"`              // Of the request
+}
+
+func (RequestRejected) EventType() string { return "request.rejected" }
+
+// RequestDeadlineApproaching is published to the entity ahead of a deadline
+type RequestDeadlineApproaching struct {
+	RequestID  string `json:"requestId"`
+	DeadlineAt string `json:"deadlineAt"`
+}
+
+func (RequestDeadlineApproaching) EventType() string { return "request.deadline_approaching" }
+
+// RequestNeedsAttention is published to the entity when a request it has
+// not answered becomes due for attention
+type RequestNeedsAttention struct {
+	RequestID   string `json:"requestId"`
+	AttentionAt string `json:"attentionAt"`
+}
+
+func (RequestNeedsAttention) EventType() string { return "request.needs_attention" }
+
+// RequestReminder is published when a reminder is due
+type RequestReminder struct {
+	RequestID  string `json:"requestId"`
+	ReminderID string `json:"reminderId"`
+}
+
+func (RequestReminder) EventType() string { return "request.reminder" }
+
+// RequestBotFailed is published to the requestor when a bot's answer is
+// rejected
+type RequestBotFailed struct {
+	RequestID string      `json:"requestId"`
+	EntityID  string      `json:"entityId"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+func (RequestBotFailed) EventType() string { return "request.bot_failed" }
+
+// RequestDeferred is published to the requestor when a request is created
+// during a maintenance window of its entity
+type RequestDeferred struct {
+	RequestID     string  `json:"requestId"`
+	EntityID      string  `json:"entityId"`
+	DeferredUntil string  `json:"deferredUntil"`        // When the entity is expected back
+	DeadlineAt    *string `json:"deadlineAt,omitempty"` // Set when the window moved the deadline
+	Reason        *string `json:"reason,omitempty"`
+}
+
+func (RequestDeferred) EventType() string { return "request.deferred" }
+
+// InquiryUnsnoozed is published when a snoozed inquiry returns to the inbox
+type InquiryUnsnoozed struct {
+	RequestID string `json:"requestId"`
+	EntityID  string `json:"entityId"`
+}
+
+func (InquiryUnsnoozed) EventType() string { return "inquiry.unsnoozed" }
+
+// InquiryDigest is the daily or weekly summary of an entity's open
+// inquiries
+type InquiryDigest struct {
+	EntityID     string        `json:"entityId"`
+	Period       string        `json:"period"`
+	Since        string        `json:"since"`
+	New          []digest.Item `json:"new"`
+	Overdue      []digest.Item `json:"overdue"`
+	ExpiringSoon []digest.Item `json:"expiringSoon"`
+	Text         string        `json:"text"`
+}
+
+func (InquiryDigest) EventType() string { return "inquiry.digest" }
+
+// CommentCreated is published when a comment is added to a request
+type CommentCreated struct {
+	RequestID string         `json:"requestId"`
+	Comment   *model.Comment `json:"comment"`
+}
+
+func (CommentCreated) EventType() string { return "comment.created" }
+
+// BundleCreated is published when a bundle of requests is created
+type BundleCreated struct {
+	BundleID   string   `json:"bundleId"`
+	EntityID   string   `json:"entityId"`
+	RequestIDs []string `json:"requestIds"`
+}
+
+func (BundleCreated) EventType() string { return "bundle.created" }
+
+// BundleCompleted is published when the last request of a bundle is
+// answered
+type BundleCompleted struct {
+	BundleID    string   `json:"bundleId"`
+	EntityID    string   `json:"entityId"`
+	RequestIDs  []string `json:"requestIds"`
+	CompletedAt *string  `json:"completedAt"`
+}
+
+func (BundleCompleted) EventType() string { return "bundle.completed" }
+
+// FileUploaded is published when an upload for a request completes
+type FileUploaded struct {
+	RequestID string      `json:"requestId"`
+	File      *model.File `json:"file"`
+}
+
+func (FileUploaded) EventType() string { return "file.uploaded" }
+
+// FileScanned is published when the malware scan of a file finishes
+type FileScanned struct {
+	RequestID  string `json:"requestId"`
+	Key        string `json:"key"`
+	ScanStatus string `json:"scanStatus"`
+	ScanResult string `json:"scanResult,omitempty"`
+}
+
+func (FileScanned) EventType() string { return "file.scanned" }
+
+// FilePreviewed is published when the preview of an answer file is ready
+type FilePreviewed struct {
+	RequestID  string `json:"requestId"`
+	ResponseID string `json:"responseId"`
+	URL        string `json:"url"`
+	PreviewURL string `json:"previewUrl"`
+}
+
+func (FilePreviewed) EventType() string { return "file.previewed" }
+
+// EntityUpdated is published when an entity's handle or meta change
+type EntityUpdated struct {
+	EntityID string                 `json:"entityId"`
+	Handle   string                 `json:"handle"`
+	Meta     map[string]interface{} `json:"meta"`
+}
+
+func (EntityUpdated) EventType() string { return "entity.updated" }
+
+// EntityDeactivated is published when an entity stops accepting requests
+type EntityDeactivated struct {
+	EntityID      string `json:"entityId"`
+	DeactivatedAt string `json:"deactivatedAt"`
+}
+
+func (EntityDeactivated) EventType() string { return "entity.deactivated" }
+
+// EntityReactivated is published when a deactivated entity accepts requests
+// again
+type EntityReactivated struct {
+	EntityID string `json:"entityId"`
+}
+
+func (EntityReactivated) EventType() string { return "entity.reactivated" }
+
+// EntityMerged is published to both entities when one is merged into the
+// other
+type EntityMerged struct {
+	SourceID string `json:"sourceId"`
+	TargetID string `json:"targetId"`
+}
+
+func (EntityMerged) EventType() string { return "entity.merged" }
+
+// EntityOnline is published when an entity's first connection opens
+type EntityOnline struct {
+	EntityID string `json:"entityId"`
+}
+
+func (EntityOnline) EventType() string { return "entity.online" }
+
+// EntityOffline is published when an entity's last connection closes
+type EntityOffline struct {
+	EntityID   string `json:"entityId"`
+	LastSeenAt string `json:"lastSeenAt"`
+}
+
+func (EntityOffline) EventType() string { return "entity.offline" }
+
+// FlowCreated is published when a flow starts
+type FlowCreated struct {
+	FlowID       string `json:"flowId"`
+	ParentFlowID string `json:"parentFlowId,omitempty"`
+}
+
+func (FlowCreated) EventType() string { return "flow.created" }
+
+// FlowSuspended is published when a flow waits for input
+type FlowSuspended struct {
+	FlowID string `json:"flowId"`
+}
+
+func (FlowSuspended) EventType() string { return "flow.suspended" }
+
+// FlowCompleted is published when a flow finishes
+type FlowCompleted struct {
+	FlowID string `json:"flowId"`
+}
+
+func (FlowCompleted) EventType() string { return "flow.completed" }
+
+// FlowFailed is published when a flow step fails
+type FlowFailed struct {
+	FlowID string `json:"flowId"`
+	Error  string `json:"error"`
+}
+
+func (FlowFailed) EventType() string { return "flow.failed" }
+
+// FlowUpdated is published when a flow resumes running or is cancelled
+type FlowUpdated struct {
+	FlowID string `json:"flowId"`
+	Status string `json:"status"`
+}
+
+func (FlowUpdated) EventType() string { return "flow.updated" }
+
+// FlowTimedOut is published when a request a flow waits on passes its
+// deadline and the flow moves on
+type FlowTimedOut struct {
+	FlowID    string `json:"flowId"`
+	RequestID string `json:"requestId"`
+	Step      string `json:"step"`
+}
+
+func (FlowTimedOut) EventType() string { return "flow.timed_out" }
+
+// JobFailed is published to the ops channel when a background job fails
+// for good
+type JobFailed struct {
+	TaskID   string `json:"taskId"`
+	TaskType string `json:"taskType"`
+	Queue    string `json:"queue"`
+	Retried  int    `json:"retried"`
+	Error    string `json:"error"`
+}
+
+func (JobFailed) EventType() string { return "job.failed" }
+
+// ExportCompleted is published when an export file is ready to download
+type ExportCompleted struct {
+	ExportID string `json:"exportId"`
+	Format   string `json:"format"`
+	Count    int    `json:"count"`
+	URL      string `json:"url"`
+}
+
+func (ExportCompleted) EventType() string { return "export.completed" }
+
+// ExportFailed is published when an export could not be written
+type ExportFailed struct {
+	ExportID string `json:"exportId"`
+	Error    string `json:"error"`
+}
+
+func (ExportFailed) EventType() string { return "export.failed" }
+
+// ErasureCompleted is published when an entity's data is erased
+type ErasureCompleted struct {
+	ErasureID string              `json:"erasureId"`
+	EntityID  string              `json:"entityId"`
+	Mode      string              `json:"mode"`
+	Report    model.ErasureReport `json:"report"`
+}
+
+func (ErasureCompleted) EventType() string { return "erasure.completed" }
+
+// ErasureFailed is published when an erasure stops on an error
+type ErasureFailed struct {
+	ErasureID string `json:"erasureId"`
+	EntityID  string `json:"entityId"`
+	Error     string `json:"error"`
+}
+
+func (ErasureFailed) EventType() string { return "erasure.failed" }
+
+// LoadgenTick is published by pxbox-loadgen to measure delivery latency
+type LoadgenTick struct {
+	SentAt int64  `json:"sentAt"` // Microseconds since the start of the run
+	Pad    string `json:"pad"`
+}
+
+func (LoadgenTick) EventType() string { return "loadgen.tick" }
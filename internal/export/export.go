@@ -0,0 +1,214 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/seal"
+)
+
+// Format represents an export output format
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+// ParseFormat parses a format name, defaulting to NDJSON when empty
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "":
+		return FormatNDJSON, nil
+	case FormatCSV, FormatNDJSON:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", s)
+	}
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+// Extension returns the file extension for the format
+func (f Format) Extension() string {
+	if f == FormatCSV {
+		return "csv"
+	}
+	return "ndjson"
+}
+
+// Job describes an asynchronous export run by the job server
+type Job struct {
+	ID          string          `json:"id"`
+	Format      Format          `json:"format"`
+	Filter      db.ExportFilter `json:"filter"`
+	RequestedBy string          `json:"requestedBy"`
+}
+
+// Record is a single exported request together with its latest response
+type Record struct {
+	RequestID  string                   `json:"requestId"`
+	Status     string                   `json:"status"`
+	EntityID   string                   `json:"entityId"`
+	CreatedBy  string                   `json:"createdBy"`
+	SchemaKind string                   `json:"schemaKind"`
+	FlowID     *string                  `json:"flowId,omitempty"`
+	DeadlineAt *string                  `json:"deadlineAt,omitempty"`
+	ExpiresAt  *string                  `json:"expiresAt,omitempty"`
+	CreatedAt  string                   `json:"createdAt"`
+	UpdatedAt  string                   `json:"updatedAt"`
+	ResponseID *string                  `json:"responseId,omitempty"`
+	AnsweredBy *string                  `json:"answeredBy,omitempty"`
+	AnsweredAt *string                  `json:"answeredAt,omitempty"`
+	Payload    map[string]interface{}   `json:"payload,omitempty"`
+	Files      []map[string]interface{} `json:"files,omitempty"`
+}
+
+var csvHeader = []string{
+	"requestId", "status", "entityId", "createdBy", "schemaKind", "flowId",
+	"deadlineAt", "expiresAt", "createdAt", "updatedAt",
+	"responseId", "answeredBy", "answeredAt", "payload",
+}
+
+// NewRecord builds an export record from database rows
+func NewRecord(r db.Request, resp *db.Response) Record {
+	rec := Record{
+		RequestID:  r.ID,
+		Status:     r.Status,
+		EntityID:   r.EntityID,
+		CreatedBy:  r.CreatedBy,
+		SchemaKind: r.SchemaKind,
+		FlowID:     r.FlowID,
+		DeadlineAt: formatTime(r.DeadlineAt),
+		ExpiresAt:  formatTime(r.ExpiresAt),
+		CreatedAt:  r.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  r.UpdatedAt.Format(time.RFC3339),
+	}
+	if resp != nil {
+		rec.ResponseID = &resp.ID
+		rec.AnsweredBy = &resp.AnsweredBy
+		rec.AnsweredAt = formatTime(&resp.AnsweredAt)
+		rec.Payload = resp.Payload
+		rec.Files = resp.Files
+	}
+	return rec
+}
+
+// Writer encodes records in a given format
+type Writer struct {
+	format Format
+	csv    *csv.Writer
+	json   *json.Encoder
+	count  int
+}
+
+// NewWriter creates a new export writer
+func NewWriter(w io.Writer, format Format) *Writer {
+	ew := &Writer{format: format}
+	if format == FormatCSV {
+		ew.csv = csv.NewWriter(w)
+	} else {
+		ew.json = json.NewEncoder(w)
+	}
+	return ew
+}
+
+// Write encodes a single record
+func (w *Writer) Write(rec Record) error {
+	if w.format != FormatCSV {
+		w.count++
+		return w.json.Encode(rec)
+	}
+
+	if w.count == 0 {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	w.count++
+
+	payload := ""
+	if rec.Payload != nil {
+		b, err := json.Marshal(rec.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		payload = string(b)
+	}
+
+	return w.csv.Write([]string{
+		rec.RequestID, rec.Status, rec.EntityID, rec.CreatedBy, rec.SchemaKind, deref(rec.FlowID),
+		deref(rec.DeadlineAt), deref(rec.ExpiresAt), rec.CreatedAt, rec.UpdatedAt,
+		deref(rec.ResponseID), deref(rec.AnsweredBy), deref(rec.AnsweredAt), payload,
+	})
+}
+
+// Close flushes buffered output. For CSV, the header is written even when no
+// records were exported.
+func (w *Writer) Close() error {
+	if w.format != FormatCSV {
+		return nil
+	}
+	if w.count == 0 {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Count returns the number of records written
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Run streams all requests matching the filter into w and returns the number
+// of exported records. Encrypted response payloads are decrypted with
+// sealer.
+func Run(ctx context.Context, queries *db.Queries, sealer *seal.Sealer, filter db.ExportFilter, format Format, w io.Writer) (int, error) {
+	ew := NewWriter(w, format)
+	err := queries.StreamRequestsWithResponses(ctx, filter, func(r db.Request, resp *db.Response) error {
+		if resp != nil {
+			payload, err := sealer.Open(ctx, resp.Payload, seal.Field("responses", "payload", resp.ID))
+			if err != nil {
+				return err
+			}
+			resp.Payload = payload
+		}
+		return ew.Write(NewRecord(r, resp))
+	})
+	if err != nil {
+		return ew.Count(), fmt.Errorf("failed to export requests: %w", err)
+	}
+	if err := ew.Close(); err != nil {
+		return ew.Count(), fmt.Errorf("failed to flush export: %w", err)
+	}
+	return ew.Count(), nil
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
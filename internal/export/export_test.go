@@ -0,0 +1,96 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRows() (db.Request, *db.Response) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	req := db.Request{
+		ID:         "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		CreatedBy:  "client-1",
+		EntityID:   "entity-1",
+		Status:     "ANSWERED",
+		SchemaKind: "jsonschema",
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	}
+	resp := &db.Response{
+		ID:         "01ARZ3NDEKTSV4RRFFQ69G5FAW",
+		RequestID:  req.ID,
+		AnsweredBy: "entity-1",
+		AnsweredAt: created.Add(time.Hour),
+		Payload:    map[string]interface{}{"name": "John"},
+	}
+	return req, resp
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatNDJSON, f)
+
+	f, err = ParseFormat("csv")
+	require.NoError(t, err)
+	assert.Equal(t, FormatCSV, f)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestWriter_CSV(t *testing.T) {
+	req, resp := testRows()
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf, FormatCSV)
+	require.NoError(t, w.Write(NewRecord(req, resp)))
+	require.NoError(t, w.Write(NewRecord(req, nil)))
+	require.NoError(t, w.Close())
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, csvHeader, rows[0])
+	assert.Equal(t, req.ID, rows[1][0])
+	assert.Equal(t, resp.ID, rows[1][10])
+	assert.Equal(t, `{"name":"John"}`, rows[1][13])
+	assert.Equal(t, "", rows[2][10])
+	assert.Equal(t, 2, w.Count())
+}
+
+func TestWriter_CSVEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatCSV)
+	require.NoError(t, w.Close())
+	assert.Equal(t, strings.Join(csvHeader, ",")+"\n", buf.String())
+}
+
+func TestWriter_NDJSON(t *testing.T) {
+	req, resp := testRows()
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf, FormatNDJSON)
+	require.NoError(t, w.Write(NewRecord(req, resp)))
+	require.NoError(t, w.Write(NewRecord(req, nil)))
+	require.NoError(t, w.Close())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var rec Record
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	assert.Equal(t, req.ID, rec.RequestID)
+	require.NotNil(t, rec.ResponseID)
+	assert.Equal(t, resp.ID, *rec.ResponseID)
+	assert.Equal(t, "John", rec.Payload["name"])
+}
@@ -0,0 +1,117 @@
+// Package fieldmask projects JSON documents down to a set of field paths, so
+// requestors can ask for only the parts of a response they need.
+package fieldmask
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPath is returned for malformed field paths
+var ErrInvalidPath = errors.New("invalid field path")
+
+// Mask is a parsed list of field paths. Each path is a list of object keys.
+type Mask [][]string
+
+// Parse parses a comma-separated field list such as
+// "payload.approved,payload.amount". Each entry may be a dotted path or a
+// JSON pointer ("/payload/approved").
+func Parse(spec string) (Mask, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	return ParseList(strings.Split(spec, ","))
+}
+
+// ParseList parses individual field paths
+func ParseList(fields []string) (Mask, error) {
+	var mask Mask
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+
+		var segments []string
+		if strings.HasPrefix(f, "/") {
+			for _, s := range strings.Split(f[1:], "/") {
+				segments = append(segments, strings.NewReplacer("~1", "/", "~0", "~").Replace(s))
+			}
+		} else {
+			segments = strings.Split(f, ".")
+		}
+
+		for _, s := range segments {
+			if s == "" {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidPath, f)
+			}
+		}
+		mask = append(mask, segments)
+	}
+	return mask, nil
+}
+
+// Empty reports whether the mask selects everything
+func (m Mask) Empty() bool {
+	return len(m) == 0
+}
+
+// Apply returns a copy of doc containing only the masked paths. Paths that
+// do not exist, or that descend into a non-object value, are left out. An
+// empty mask returns doc unchanged.
+func (m Mask) Apply(doc map[string]interface{}) map[string]interface{} {
+	if m.Empty() {
+		return doc
+	}
+
+	out := make(map[string]interface{})
+	for _, path := range m {
+		value, ok := lookup(doc, path)
+		if !ok {
+			continue
+		}
+		set(out, path, value)
+	}
+	return out
+}
+
+// ApplyTo marshals v to a JSON object and applies the mask to it
+func (m Mask) ApplyTo(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("value is not a JSON object: %w", err)
+	}
+	return m.Apply(doc), nil
+}
+
+func lookup(doc map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, key := range path {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func set(doc map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := doc[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[key] = next
+		}
+		doc = next
+	}
+	doc[path[len(path)-1]] = value
+}
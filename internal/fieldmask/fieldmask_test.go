@@ -0,0 +1,59 @@
+package fieldmask
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	mask, err := Parse("payload.approved, /payload/a~1b,id")
+	require.NoError(t, err)
+	assert.Equal(t, Mask{{"payload", "approved"}, {"payload", "a/b"}, {"id"}}, mask)
+
+	mask, err = Parse("")
+	require.NoError(t, err)
+	assert.True(t, mask.Empty())
+
+	_, err = Parse("payload..amount")
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	doc := map[string]interface{}{
+		"id": "r1",
+		"payload": map[string]interface{}{
+			"approved": true,
+			"amount":   12.5,
+			"notes":    "long text",
+		},
+		"files": []interface{}{"a"},
+	}
+
+	mask, err := Parse("payload.approved,payload.amount,payload.missing,files.0")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"payload": map[string]interface{}{
+			"approved": true,
+			"amount":   12.5,
+		},
+	}, mask.Apply(doc))
+
+	assert.Equal(t, doc, Mask(nil).Apply(doc))
+}
+
+func TestApplyTo(t *testing.T) {
+	type response struct {
+		ID      string                 `json:"id"`
+		Payload map[string]interface{} `json:"payload"`
+	}
+
+	mask, err := Parse("id")
+	require.NoError(t, err)
+
+	out, err := mask.ApplyTo(response{ID: "r1", Payload: map[string]interface{}{"x": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "r1"}, out)
+}
@@ -0,0 +1,357 @@
+// Package form turns a request's JSON Schema and UI hints into a plain HTML
+// form, for answering without a client app, and decodes the submitted
+// values back into a response payload
+package form
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pxbox/internal/schema"
+)
+
+// ErrUnsupported is returned for schemas a flat HTML form cannot represent,
+// such as nested objects
+var ErrUnsupported = errors.New("schema cannot be rendered as an HTML form")
+
+// Form is the renderable shape of a request's schema
+type Form struct {
+	Title       string
+	Description string
+	SubmitLabel string
+	Fields      []*Field
+	Errors      []string // Failures not tied to a single field
+}
+
+// Field is one top-level property of the schema
+type Field struct {
+	Name        string
+	Label       string
+	Description string
+	Placeholder string
+	// Widget is an input type ("text", "email", "date", "number", ...) or
+	// one of "textarea", "select", "radio", "checkbox" and "checkboxes"
+	Widget    string
+	Required  bool
+	Value     string
+	Selected  map[string]bool // For "checkboxes"
+	Options   []Option
+	Min       string
+	Max       string
+	Step      string
+	MinLength string
+	MaxLength string
+	Pattern   string
+	Error     string
+}
+
+// Option is a choice of an enum property
+type Option struct {
+	Value string
+	Label string
+}
+
+// Build lays out schema as a form, hinted by uiHints (an @rjsf uiSchema)
+// and filled with values, e.g. the request's prefill
+func Build(s, uiHints, values map[string]interface{}) (*Form, error) {
+	if _, ok := s["$ref"]; ok {
+		return nil, fmt.Errorf("%w: referenced schemas are not supported", ErrUnsupported)
+	}
+	properties, ok := s["properties"].(map[string]interface{})
+	if !ok || len(properties) == 0 {
+		return nil, fmt.Errorf("%w: schema has no properties", ErrUnsupported)
+	}
+
+	f := &Form{
+		Title:       firstString(uiHints, "ui:title", "title"),
+		Description: firstString(uiHints, "ui:description", "description"),
+		SubmitLabel: "Submit",
+	}
+	if f.Title == "" {
+		f.Title = firstString(s, "title")
+	}
+	if f.Description == "" {
+		f.Description = firstString(s, "description")
+	}
+	if options, ok := uiHints["ui:submitButtonOptions"].(map[string]interface{}); ok {
+		if text, ok := options["submitText"].(string); ok && text != "" {
+			f.SubmitLabel = text
+		}
+	} else if text := firstString(uiHints, "submitLabel"); text != "" {
+		f.SubmitLabel = text
+	}
+
+	required := make(map[string]bool)
+	for _, name := range stringList(s["required"]) {
+		required[name] = true
+	}
+	for _, name := range order(properties, stringList(uiHints["ui:order"])) {
+		prop, _ := properties[name].(map[string]interface{})
+		hints, _ := uiHints[name].(map[string]interface{})
+		field, err := buildField(name, prop, hints, values[name])
+		if err != nil {
+			return nil, err
+		}
+		if field == nil {
+			continue
+		}
+		field.Required = required[name]
+		f.Fields = append(f.Fields, field)
+	}
+	return f, nil
+}
+
+func buildField(name string, prop, hints map[string]interface{}, value interface{}) (*Field, error) {
+	widget := firstString(hints, "ui:widget", "widget")
+	if widget == "hidden" {
+		return nil, nil
+	}
+	field := &Field{
+		Name:        name,
+		Label:       firstString(hints, "ui:title", "title"),
+		Description: firstString(hints, "ui:description", "description", "ui:help"),
+		Placeholder: firstString(hints, "ui:placeholder", "placeholder"),
+		Value:       formatValue(value),
+	}
+	if field.Label == "" {
+		field.Label = firstString(prop, "title")
+	}
+	if field.Label == "" {
+		field.Label = name
+	}
+	if field.Description == "" {
+		field.Description = firstString(prop, "description")
+	}
+
+	switch typ, _ := prop["type"].(string); typ {
+	case "string":
+		field.Options = options(prop)
+		field.MinLength = formatValue(prop["minLength"])
+		field.MaxLength = formatValue(prop["maxLength"])
+		field.Pattern = firstString(prop, "pattern")
+		switch {
+		case len(field.Options) > 0:
+			field.Widget = "select"
+			if widget == "radio" {
+				field.Widget = "radio"
+			}
+		case widget == "textarea" || widget == "password":
+			field.Widget = widget
+		default:
+			field.Widget = stringInput(firstString(prop, "format"))
+		}
+	case "integer", "number":
+		field.Widget = "number"
+		field.Min = formatValue(prop["minimum"])
+		field.Max = formatValue(prop["maximum"])
+		field.Step = "any"
+		if typ == "integer" {
+			field.Step = "1"
+		}
+		if widget == "range" && field.Min != "" && field.Max != "" {
+			field.Widget = "range"
+		}
+	case "boolean":
+		field.Widget = "checkbox"
+		if value == true {
+			field.Value = "true"
+		} else {
+			field.Value = ""
+		}
+	case "array":
+		items, _ := prop["items"].(map[string]interface{})
+		field.Options = options(items)
+		if len(field.Options) == 0 {
+			return nil, fmt.Errorf("%w: property %q is an array of free values", ErrUnsupported, name)
+		}
+		field.Widget = "checkboxes"
+		field.Value = ""
+		field.Selected = make(map[string]bool)
+		if list, ok := value.([]interface{}); ok {
+			for _, v := range list {
+				field.Selected[formatValue(v)] = true
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: property %q has type %q", ErrUnsupported, name, typ)
+	}
+	return field, nil
+}
+
+// stringInput picks the input type for a string format
+func stringInput(format string) string {
+	switch format {
+	case "email":
+		return "email"
+	case "uri", "url":
+		return "url"
+	case "date":
+		return "date"
+	case "time":
+		return "time"
+	default:
+		return "text"
+	}
+}
+
+// options lists the choices of an enum, labelled by enumNames or
+// x-enumNames where given
+func options(prop map[string]interface{}) []Option {
+	enum, _ := prop["enum"].([]interface{})
+	if len(enum) == 0 {
+		return nil
+	}
+	names, _ := prop["x-enumNames"].([]interface{})
+	if names == nil {
+		names, _ = prop["enumNames"].([]interface{})
+	}
+	out := make([]Option, len(enum))
+	for i, v := range enum {
+		out[i] = Option{Value: formatValue(v), Label: formatValue(v)}
+		if i < len(names) {
+			if label, ok := names[i].(string); ok && label != "" {
+				out[i].Label = label
+			}
+		}
+	}
+	return out
+}
+
+// order sorts property names by uiOrder, where "*" stands for the
+// properties not listed, and alphabetically otherwise
+func order(properties map[string]interface{}, uiOrder []string) []string {
+	rest := make([]string, 0, len(properties))
+	listed := make(map[string]bool)
+	for _, name := range uiOrder {
+		listed[name] = true
+	}
+	for name := range properties {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	if len(uiOrder) == 0 {
+		return rest
+	}
+
+	out := make([]string, 0, len(properties))
+	wildcard := false
+	for _, name := range uiOrder {
+		if name == "*" {
+			out = append(out, rest...)
+			wildcard = true
+			continue
+		}
+		if _, ok := properties[name]; ok {
+			out = append(out, name)
+		}
+	}
+	if !wildcard {
+		out = append(out, rest...)
+	}
+	return out
+}
+
+// Decode converts submitted form values into a payload for schema. Values
+// are typed by the schema; those that do not parse are kept as strings for
+// validation to report. Empty inputs are left out.
+func Decode(s map[string]interface{}, values url.Values) map[string]interface{} {
+	properties, _ := s["properties"].(map[string]interface{})
+	payload := make(map[string]interface{})
+	for name, raw := range properties {
+		prop, _ := raw.(map[string]interface{})
+		switch typ, _ := prop["type"].(string); typ {
+		case "boolean":
+			if _, ok := values[name]; ok {
+				payload[name] = true
+			} else {
+				payload[name] = false
+			}
+		case "array":
+			items, _ := prop["items"].(map[string]interface{})
+			list := make([]interface{}, 0, len(values[name]))
+			for _, v := range values[name] {
+				list = append(list, decodeValue(items, v))
+			}
+			payload[name] = list
+		default:
+			v := values.Get(name)
+			if v == "" {
+				continue
+			}
+			payload[name] = decodeValue(prop, v)
+		}
+	}
+	return payload
+}
+
+func decodeValue(prop map[string]interface{}, v string) interface{} {
+	switch typ, _ := prop["type"].(string); typ {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+// SetViolations attaches validation failures to the fields they concern;
+// the others are listed on the form
+func (f *Form) SetViolations(violations []schema.Violation) {
+	byName := make(map[string]*Field, len(f.Fields))
+	for _, field := range f.Fields {
+		byName[field.Name] = field
+	}
+	for _, v := range violations {
+		name, _, _ := strings.Cut(strings.TrimPrefix(v.InstanceLocation, "/"), "/")
+		name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+		if field, ok := byName[name]; ok && name != "" && field.Error == "" {
+			field.Error = v.Message
+			continue
+		}
+		f.Errors = append(f.Errors, v.Message)
+	}
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := m[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// formatValue renders a JSON value for an input
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,142 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"pxbox/internal/schema"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = map[string]interface{}{
+	"type":  "object",
+	"title": "Expense report",
+	"properties": map[string]interface{}{
+		"name":     map[string]interface{}{"type": "string", "title": "Name", "maxLength": float64(50)},
+		"email":    map[string]interface{}{"type": "string", "format": "email"},
+		"amount":   map[string]interface{}{"type": "number", "minimum": float64(0)},
+		"nights":   map[string]interface{}{"type": "integer"},
+		"approved": map[string]interface{}{"type": "boolean"},
+		"currency": map[string]interface{}{"type": "string", "enum": []interface{}{"EUR", "CZK"}, "enumNames": []interface{}{"Euro", "Koruna"}},
+		"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": []interface{}{"travel", "food"}}},
+	},
+	"required": []interface{}{"name", "amount"},
+}
+
+func TestBuild(t *testing.T) {
+	hints := map[string]interface{}{
+		"ui:order":               []interface{}{"name", "amount", "*"},
+		"name":                   map[string]interface{}{"ui:placeholder": "Ada Lovelace"},
+		"nights":                 map[string]interface{}{"ui:widget": "hidden"},
+		"ui:submitButtonOptions": map[string]interface{}{"submitText": "Send"},
+	}
+	prefill := map[string]interface{}{"name": "Ada", "amount": float64(12.5), "approved": true, "tags": []interface{}{"food"}}
+
+	f, err := Build(testSchema, hints, prefill)
+	require.NoError(t, err)
+	assert.Equal(t, "Expense report", f.Title)
+	assert.Equal(t, "Send", f.SubmitLabel)
+
+	var names []string
+	byName := make(map[string]*Field)
+	for _, field := range f.Fields {
+		names = append(names, field.Name)
+		byName[field.Name] = field
+	}
+	assert.Equal(t, []string{"name", "amount", "approved", "currency", "email", "tags"}, names)
+
+	assert.Equal(t, "text", byName["name"].Widget)
+	assert.Equal(t, "Ada", byName["name"].Value)
+	assert.Equal(t, "Ada Lovelace", byName["name"].Placeholder)
+	assert.Equal(t, "50", byName["name"].MaxLength)
+	assert.True(t, byName["name"].Required)
+	assert.Equal(t, "number", byName["amount"].Widget)
+	assert.Equal(t, "12.5", byName["amount"].Value)
+	assert.Equal(t, "0", byName["amount"].Min)
+	assert.Equal(t, "email", byName["email"].Widget)
+	assert.Equal(t, "true", byName["approved"].Value)
+	assert.Equal(t, "select", byName["currency"].Widget)
+	assert.Equal(t, []Option{{"EUR", "Euro"}, {"CZK", "Koruna"}}, byName["currency"].Options)
+	assert.Equal(t, "checkboxes", byName["tags"].Widget)
+	assert.True(t, byName["tags"].Selected["food"])
+}
+
+func TestBuild_Unsupported(t *testing.T) {
+	for name, s := range map[string]map[string]interface{}{
+		"ref":    {"$ref": "https://example.com/schema.json"},
+		"empty":  {"type": "object"},
+		"nested": {"type": "object", "properties": map[string]interface{}{"address": map[string]interface{}{"type": "object"}}},
+		"array":  {"type": "object", "properties": map[string]interface{}{"lines": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}}},
+	} {
+		_, err := Build(s, nil, nil)
+		assert.True(t, errors.Is(err, ErrUnsupported), name)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	values := url.Values{
+		"name":     {"Ada"},
+		"email":    {""},
+		"amount":   {"12.5"},
+		"nights":   {"three"},
+		"currency": {"EUR"},
+		"tags":     {"travel", "food"},
+		"unknown":  {"ignored"},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"name":     "Ada",
+		"amount":   12.5,
+		"nights":   "three",
+		"approved": false,
+		"currency": "EUR",
+		"tags":     []interface{}{"travel", "food"},
+	}, Decode(testSchema, values))
+
+	values.Set("nights", "3")
+	values.Set("approved", "true")
+	payload := Decode(testSchema, values)
+	assert.Equal(t, int64(3), payload["nights"])
+	assert.Equal(t, true, payload["approved"])
+}
+
+func TestSetViolations(t *testing.T) {
+	f, err := Build(testSchema, nil, nil)
+	require.NoError(t, err)
+	f.SetViolations([]schema.Violation{
+		{InstanceLocation: "/amount", Message: "must be >= 0"},
+		{InstanceLocation: "", Message: "missing properties: 'name'"},
+	})
+	for _, field := range f.Fields {
+		if field.Name == "amount" {
+			assert.Equal(t, "must be >= 0", field.Error)
+		} else {
+			assert.Empty(t, field.Error, field.Name)
+		}
+	}
+	assert.Equal(t, []string{"missing properties: 'name'"}, f.Errors)
+}
+
+func TestRender(t *testing.T) {
+	f, err := Build(testSchema, nil, map[string]interface{}{"name": `<script>alert(1)</script>`})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Render(&buf, Page{Form: f, Respondent: true, Attachments: []Attachment{{Name: "invoice.pdf", URL: "https://files.example.com/invoice.pdf"}}}))
+	html := buf.String()
+	assert.Contains(t, html, `<form method="post">`)
+	assert.Contains(t, html, `name="amount"`)
+	assert.Contains(t, html, `<option value="EUR">Euro</option>`)
+	assert.Contains(t, html, `name="`+RespondentEmailField+`"`)
+	assert.Contains(t, html, `href="https://files.example.com/invoice.pdf"`)
+	assert.NotContains(t, html, "<script>")
+
+	buf.Reset()
+	require.NoError(t, Render(&buf, Page{Message: "Thank you"}))
+	assert.Contains(t, buf.String(), "Thank you")
+	assert.False(t, strings.Contains(buf.String(), "<form"))
+}
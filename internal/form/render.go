@@ -0,0 +1,49 @@
+package form
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+)
+
+//go:embed form.html
+var pageTemplate string
+
+var page = template.Must(template.New("form").Parse(pageTemplate))
+
+// Page is a rendered form page, or a message in place of the form
+type Page struct {
+	Lang        string
+	Form        *Form
+	Message     string // Shown instead of the form when set
+	Deadline    string // e.g. "2025-01-03 17:00 CET (due in 2d)"
+	Attachments []Attachment
+	// Respondent asks who is answering, for share links
+	Respondent      bool
+	RespondentName  string
+	RespondentEmail string
+}
+
+// Attachment is a file from the requestor, linked from the form
+type Attachment struct {
+	Name string
+	URL  string
+}
+
+// Respondent field names; the colon keeps them apart from schema properties
+const (
+	RespondentNameField  = "pxbox:respondentName"
+	RespondentEmailField = "pxbox:respondentEmail"
+)
+
+// Render writes p as a standalone HTML document
+func Render(w io.Writer, p Page) error {
+	if p.Lang == "" {
+		p.Lang = "en"
+	}
+	return page.Execute(w, struct {
+		Page
+		NameField  string
+		EmailField string
+	}{p, RespondentNameField, RespondentEmailField})
+}
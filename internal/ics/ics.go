@@ -0,0 +1,117 @@
+// Package ics writes iCalendar (RFC 5545) feeds that calendar clients can
+// subscribe to
+package ics
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar feeds
+const ContentType = "text/calendar; charset=utf-8"
+
+// timeLayout is the UTC date-time form of iCalendar
+const timeLayout = "20060102T150405Z"
+
+// maxLineOctets is the longest content line before it is folded
+const maxLineOctets = 75
+
+// Event is a VEVENT. An event with a zero End is a point in time.
+type Event struct {
+	UID         string // Stable across feed refreshes, so clients update rather than duplicate
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	URL         string
+	// Alarms are display reminders, each the time before Start it fires;
+	// 0 fires at Start
+	Alarms []time.Duration
+}
+
+// Calendar is a VCALENDAR of events
+type Calendar struct {
+	Name   string // Shown by clients as the subscription's name
+	Events []Event
+}
+
+// Bytes renders the calendar with CRLF line endings, folding long lines.
+// now is the DTSTAMP of its events.
+func (c Calendar) Bytes(now time.Time) []byte {
+	var b bytes.Buffer
+	line := func(name, value string) {
+		writeFolded(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//pxbox//deadlines//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", now.UTC().Format(timeLayout))
+		line("DTSTART", e.Start.UTC().Format(timeLayout))
+		end := e.End
+		if end.IsZero() {
+			end = e.Start
+		}
+		line("DTEND", end.UTC().Format(timeLayout))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		for _, before := range e.Alarms {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("DESCRIPTION", escape(e.Summary))
+			line("TRIGGER", trigger(before))
+			line("END", "VALARM")
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.Bytes()
+}
+
+// escape escapes a TEXT value
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// trigger returns the TRIGGER of an alarm firing before the start
+func trigger(before time.Duration) string {
+	if before <= 0 {
+		return "PT0S"
+	}
+	return fmt.Sprintf("-PT%dM", int(before.Round(time.Minute).Minutes()))
+}
+
+// writeFolded writes a content line, folded into lines of at most 75
+// octets without splitting UTF-8 sequences
+func writeFolded(b *bytes.Buffer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with the space
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,41 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarBytes(t *testing.T) {
+	start := time.Date(2024, 3, 1, 17, 0, 0, 0, time.FixedZone("CET", 3600))
+	cal := Calendar{
+		Name: "Deadlines",
+		Events: []Event{{
+			UID:     "r1-deadline@pxbox",
+			Start:   start,
+			Summary: "Due: Invoice, VAT; please",
+			Alarms:  []time.Duration{time.Hour, 0},
+		}},
+	}
+	out := string(cal.Bytes(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	assert.Contains(t, out, "DTSTAMP:20240201T000000Z\r\n")
+	assert.Contains(t, out, "DTSTART:20240301T160000Z\r\nDTEND:20240301T160000Z\r\n")
+	assert.Contains(t, out, `SUMMARY:Due: Invoice\, VAT\; please`)
+	assert.Contains(t, out, "TRIGGER:-PT60M\r\n")
+	assert.Contains(t, out, "TRIGGER:PT0S\r\n")
+	assert.Equal(t, 2, strings.Count(out, "BEGIN:VALARM"))
+}
+
+func TestFolding(t *testing.T) {
+	cal := Calendar{Events: []Event{{UID: "u", Summary: strings.Repeat("ž", 100)}}}
+	for _, line := range strings.Split(string(cal.Bytes(time.Now())), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineOctets)
+		assert.True(t, strings.ToValidUTF8(line, "?") == line, "line splits a character: %q", line)
+	}
+	assert.Equal(t, `a\\b\nc`, escape("a\\b\nc"))
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"pxbox/internal/model"
+	"pxbox/internal/seal"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// maxBotReplyBytes caps the reply of a bot handler read for an answer
+const maxBotReplyBytes = 1 << 20
+
+// BotAnswerHandler posts the answer a bot handler returned for a request,
+// as the bot. Errors wrapping asynq.SkipRetry are not retried.
+type BotAnswerHandler func(ctx context.Context, requestID string, payload map[string]interface{}, files []map[string]interface{}) error
+
+// SetBotAnswerHandler sets how answers returned by bot handlers are posted
+func (js *JobServer) SetBotAnswerHandler(h BotAnswerHandler) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.botAnswer = h
+}
+
+// botReply is what a bot handler may return to answer a request right away
+type botReply struct {
+	Payload map[string]interface{}   `json:"payload"`
+	Files   []map[string]interface{} `json:"files,omitempty"`
+}
+
+// handleBotDispatch pushes a request to the handler of the bot it is
+// addressed to. A reply with a payload answers the request; an empty reply
+// leaves the bot to answer later through the API or WebSocket.
+func (js *JobServer) handleBotDispatch(ctx context.Context, t *asynq.Task) error {
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	req, err := js.db.Queries.GetRequestByID(ctx, p.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to get request: %w", err)
+	}
+	if req.Status != string(model.StatusPending) || (req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now())) {
+		return nil
+	}
+	handler, err := js.db.Queries.GetBotHandler(ctx, req.EntityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get bot handler: %w", err)
+	}
+
+	prefill, err := js.sealer.Open(ctx, req.Prefill, seal.Field("requests", "prefill", req.ID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt prefill: %w", err)
+	}
+	event := map[string]interface{}{
+		"type":       "request.created",
+		"requestId":  req.ID,
+		"entityId":   req.EntityID,
+		"createdBy":  req.CreatedBy,
+		"schemaKind": req.SchemaKind,
+		"schema":     req.SchemaPayload,
+		"uiHints":    req.UIHints,
+		"prefill":    prefill,
+		"tags":       req.Tags,
+		"version":    req.Version,
+	}
+	if req.ExpiresAt != nil {
+		event["expiresAt"] = req.ExpiresAt.Format(time.RFC3339)
+	}
+	if req.DeadlineAt != nil {
+		event["deadlineAt"] = req.DeadlineAt.Format(time.RFC3339)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bot request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, handler.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid bot handler url: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	mac := hmac.New(sha256.New, []byte(handler.Secret))
+	mac.Write(body)
+	httpReq.Header.Set(CallbackSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+
+	httpResp, err := js.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("bot dispatch failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode >= 300 {
+		return fmt.Errorf("bot handler returned %s", httpResp.Status)
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(httpResp.Body, maxBotReplyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read bot reply: %w", err)
+	}
+	var answer botReply
+	if len(bytes.TrimSpace(reply)) > 0 {
+		if err := json.Unmarshal(reply, &answer); err != nil {
+			return fmt.Errorf("invalid bot reply: %v: %w", err, asynq.SkipRetry)
+		}
+	}
+	if answer.Payload == nil {
+		js.logger(ctx).Info("Request pushed to bot", zap.String("request_id", req.ID), zap.String("entity_id", req.EntityID))
+		return nil
+	}
+
+	js.mu.RLock()
+	h := js.botAnswer
+	js.mu.RUnlock()
+	if h == nil {
+		return errors.New("no bot answer handler configured")
+	}
+	if err := h(ctx, req.ID, answer.Payload, answer.Files); err != nil {
+		return err
+	}
+	js.logger(ctx).Info("Request answered by bot", zap.String("request_id", req.ID), zap.String("entity_id", req.EntityID))
+	return nil
+}
+
+// EnqueueBotDispatch enqueues pushing a request to its bot's handler
+func EnqueueBotDispatch(ctx context.Context, client Enqueuer, requestID string) error {
+	task, err := requestTask(ctx, "bot:dispatch", requestID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pxbox/internal/fieldmask"
+	"pxbox/internal/schema"
+	"pxbox/internal/seal"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+)
+
+// CallbackSignatureHeader carries the hex HMAC-SHA256 of the callback body,
+// keyed by the request's callback secret
+const CallbackSignatureHeader = "X-PxBox-Signature"
+
+// handleCallback delivers the answered request to its callbackUrl
+func (js *JobServer) handleCallback(ctx context.Context, t *asynq.Task) error {
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	requestID := p.RequestID
+
+	req, err := js.db.Queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to get request: %w", err)
+	}
+	if req.CallbackURL == nil || *req.CallbackURL == "" {
+		return nil
+	}
+
+	resp, err := js.db.Queries.GetResponseByRequestID(ctx, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to get response: %w", err)
+	}
+	payload, err := js.sealer.Open(ctx, resp.Payload, seal.Field("responses", "payload", resp.ID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt response: %w", err)
+	}
+
+	event := map[string]interface{}{
+		"type":       "request.answered",
+		"requestId":  req.ID,
+		"entityId":   req.EntityID,
+		"status":     req.Status,
+		"responseId": resp.ID,
+		"answeredBy": resp.AnsweredBy,
+		"answeredAt": resp.AnsweredAt.Format(time.RFC3339),
+		"payload":    payload,
+		"files":      resp.Files,
+	}
+	if paths := schema.SensitivePaths(req.SchemaPayload); len(paths) > 0 {
+		event["payload"] = schema.Redact(payload, paths)
+		event["redacted"] = true
+	}
+
+	// Project the body down to the requested fields, always keeping the
+	// identifiers needed to correlate the delivery
+	mask, err := fieldmask.ParseList(req.CallbackFields)
+	if err != nil {
+		return fmt.Errorf("invalid callback fields: %w", err)
+	}
+	if !mask.Empty() {
+		projected := mask.Apply(event)
+		for _, key := range []string{"type", "requestId", "responseId"} {
+			projected[key] = event[key]
+		}
+		event = projected
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal callback: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, *req.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid callback url: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if req.CallbackSecret != nil && *req.CallbackSecret != "" {
+		mac := hmac.New(sha256.New, []byte(*req.CallbackSecret))
+		mac.Write(body)
+		httpReq.Header.Set(CallbackSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	httpResp, err := js.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("callback delivery failed: %w", err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned %s", httpResp.Status)
+	}
+
+	js.logger(ctx).Info("Callback delivered", zap.String("request_id", requestID), zap.Int("status", httpResp.StatusCode))
+	return nil
+}
+
+func EnqueueCallback(ctx context.Context, client Enqueuer, requestID string) error {
+	task, err := requestTask(ctx, "request:callback", requestID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrJobNotFound is returned for an unknown task ID
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotDead is returned when retrying a task that is not archived
+	ErrJobNotDead = errors.New("job is not in the dead-letter queue")
+)
+
+// DeadJob is a task that exhausted its retries
+type DeadJob struct {
+	ID           string    `json:"id"`
+	Queue        string    `json:"queue"`
+	Type         string    `json:"type"`
+	Payload      string    `json:"payload"`
+	Retried      int       `json:"retried"`
+	MaxRetry     int       `json:"maxRetry"`
+	LastError    string    `json:"lastError"`
+	LastFailedAt time.Time `json:"lastFailedAt"`
+}
+
+// DeadLetters lists and requeues archived tasks
+type DeadLetters struct {
+	inspector *asynq.Inspector
+	queries   *db.Queries // Instead of inspector with JOB_BACKEND=postgres
+}
+
+// NewDeadLetters creates a dead-letter view over the queues of inspector
+func NewDeadLetters(inspector *asynq.Inspector) *DeadLetters {
+	return &DeadLetters{inspector: inspector}
+}
+
+// NewPGDeadLetters creates a dead-letter view over the archived jobs of the
+// jobs table
+func NewPGDeadLetters(queries *db.Queries) *DeadLetters {
+	return &DeadLetters{queries: queries}
+}
+
+// List returns up to limit archived tasks of queue, or of all queues when
+// queue is empty
+func (d *DeadLetters) List(queue string, limit int) ([]DeadJob, error) {
+	queues := Queues
+	if queue != "" {
+		queues = []string{queue}
+	}
+
+	jobs := make([]DeadJob, 0)
+	if d.queries != nil {
+		archived, err := d.queries.ListArchivedJobs(context.Background(), queues, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range archived {
+			jobs = append(jobs, deadJobFromDB(j))
+		}
+		return jobs, nil
+	}
+
+	for _, q := range queues {
+		if len(jobs) >= limit {
+			break
+		}
+		tasks, err := d.inspector.ListArchivedTasks(q, asynq.PageSize(limit-len(jobs)))
+		if errors.Is(err, asynq.ErrQueueNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			jobs = append(jobs, deadJob(t))
+		}
+	}
+	return jobs, nil
+}
+
+// Retry moves an archived task back to its queue for immediate processing.
+// An empty queue searches all queues.
+func (d *DeadLetters) Retry(queue, id string) (DeadJob, error) {
+	queues := Queues
+	if queue != "" {
+		queues = []string{queue}
+	}
+
+	if d.queries != nil {
+		return d.retryDB(queues, id)
+	}
+	for _, q := range queues {
+		info, err := d.inspector.GetTaskInfo(q, id)
+		if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+			continue
+		}
+		if err != nil {
+			return DeadJob{}, err
+		}
+		if info.State != asynq.TaskStateArchived {
+			return DeadJob{}, ErrJobNotDead
+		}
+		if err := d.inspector.RunTask(q, id); err != nil {
+			return DeadJob{}, err
+		}
+		return deadJob(info), nil
+	}
+	return DeadJob{}, ErrJobNotFound
+}
+
+func deadJob(t *asynq.TaskInfo) DeadJob {
+	return DeadJob{
+		ID:           t.ID,
+		Queue:        t.Queue,
+		Type:         t.Type,
+		Payload:      string(t.Payload),
+		Retried:      t.Retried,
+		MaxRetry:     t.MaxRetry,
+		LastError:    t.LastErr,
+		LastFailedAt: t.LastFailedAt,
+	}
+}
+
+// retryDB requeues an archived job of the jobs table
+func (d *DeadLetters) retryDB(queues []string, id string) (DeadJob, error) {
+	ctx := context.Background()
+	j, err := d.queries.GetJob(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeadJob{}, ErrJobNotFound
+	}
+	if err != nil {
+		return DeadJob{}, err
+	}
+	found := false
+	for _, q := range queues {
+		found = found || q == j.Queue
+	}
+	if !found {
+		return DeadJob{}, ErrJobNotFound
+	}
+	if j.State != db.JobArchived {
+		return DeadJob{}, ErrJobNotDead
+	}
+
+	dead := deadJobFromDB(j)
+	if _, err := d.queries.RequeueJob(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DeadJob{}, ErrJobNotDead // Requeued in the meantime
+		}
+		return DeadJob{}, err
+	}
+	return dead, nil
+}
+
+func deadJobFromDB(j db.Job) DeadJob {
+	dead := DeadJob{
+		ID:       j.ID,
+		Queue:    j.Queue,
+		Type:     j.Type,
+		Payload:  string(j.Payload),
+		Retried:  j.Retried,
+		MaxRetry: j.MaxRetry,
+	}
+	if j.LastError != nil {
+		dead.LastError = *j.LastError
+	}
+	if j.LastFailedAt != nil {
+		dead.LastFailedAt = *j.LastFailedAt
+	}
+	return dead
+}
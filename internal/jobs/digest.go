@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/digest"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+)
+
+// digestLimit caps the requests listed in one digest
+const digestLimit = 200
+
+// SetDigestRenderer sets the template digests are rendered with and how
+// soon a deadline has to be for a request to be listed as expiring. It
+// must be called before Start.
+func (js *JobServer) SetDigestRenderer(r *digest.Renderer, expiringWithin time.Duration) {
+	js.digests = r
+	js.digestWithin = expiringWithin
+}
+
+func (js *JobServer) handleDigest(ctx context.Context, t *asynq.Task) error {
+	var p DigestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	// The entity may have turned digests off since they were scheduled
+	prefs := js.preferences(ctx, p.EntityID)
+	if prefs.Digest == model.DigestOff {
+		return nil
+	}
+
+	since := p.Slot.Add(-prefs.DigestPeriod())
+	items, err := js.db.Queries.ListDigestItems(ctx, p.EntityID, since, time.Now().Add(js.digestWithin), digestLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list digest items: %w", err)
+	}
+	d := digest.Build(p.EntityID, prefs.Digest, since, items)
+	if d.Empty() {
+		return nil
+	}
+	text, err := js.digests.Render(d, prefs.Location())
+	if err != nil {
+		return err
+	}
+
+	err = js.notify(ctx, p.EntityID, events.New(ctx, events.InquiryDigest{
+		EntityID:     p.EntityID,
+		Period:       d.Period,
+		Since:        d.Since.Format(time.RFC3339),
+		New:          d.New,
+		Overdue:      d.Overdue,
+		ExpiringSoon: d.ExpiringSoon,
+		Text:         text,
+	}))
+	if err != nil {
+		return err
+	}
+	js.logger(ctx).Info("Digest sent",
+		zap.String("entity_id", p.EntityID),
+		zap.Int("new", len(d.New)),
+		zap.Int("overdue", len(d.Overdue)),
+		zap.Int("expiring", len(d.ExpiringSoon)),
+	)
+	return nil
+}
+
+// EnqueueDigest enqueues the digest of an entity for a slot. Enqueuing the
+// same slot twice is not an error and sends one digest.
+func EnqueueDigest(ctx context.Context, client Enqueuer, entityID string, slot time.Time) error {
+	task, err := newPayloadTask(ctx, "digest:send", &DigestPayload{EntityID: entityID, Slot: slot})
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("digest:%s:%d", entityID, slot.Unix())))
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"pxbox/internal/audit"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+)
+
+// ErasureHandler performs a recorded erasure of an entity's data. It must
+// skip erasures that already completed.
+type ErasureHandler func(ctx context.Context, erasureID string) error
+
+// SetErasureHandler sets how entity:erase tasks are handled
+func (js *JobServer) SetErasureHandler(h ErasureHandler) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.erasure = h
+}
+
+func (js *JobServer) handleErasure(ctx context.Context, t *asynq.Task) error {
+	var p ErasurePayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	js.mu.RLock()
+	h := js.erasure
+	js.mu.RUnlock()
+	if h == nil {
+		return errors.New("no erasure handler configured")
+	}
+
+	if err := h(audit.WithActor(ctx, audit.SystemActor), p.ErasureID); err != nil {
+		return err
+	}
+	js.logger(ctx).Info("Erasure handled", zap.String("erasure_id", p.ErasureID))
+	return nil
+}
+
+// EnqueueErasure enqueues a recorded erasure
+func EnqueueErasure(ctx context.Context, client Enqueuer, erasureID string) error {
+	task, err := newPayloadTask(ctx, "entity:erase", &ErasurePayload{ErasureID: erasureID})
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
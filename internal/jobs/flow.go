@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"pxbox/internal/audit"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+)
+
+// FlowTimeoutHandler resumes a flow whose suspension identified by
+// suspendID reached its deadline. It must ignore suspensions that already
+// ended.
+type FlowTimeoutHandler func(ctx context.Context, flowID, suspendID string) error
+
+// SetFlowTimeoutHandler sets how flow:timeout tasks are handled. The flow
+// service lives above this package, so it is wired in by the caller.
+func (js *JobServer) SetFlowTimeoutHandler(h FlowTimeoutHandler) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.flowTimeout = h
+}
+
+func (js *JobServer) handleFlowTimeout(ctx context.Context, t *asynq.Task) error {
+	var p FlowTimeoutPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	js.mu.RLock()
+	h := js.flowTimeout
+	js.mu.RUnlock()
+	if h == nil {
+		// Retried until the flow service is wired in
+		return errors.New("no flow timeout handler configured")
+	}
+
+	if err := h(audit.WithActor(ctx, audit.SystemActor), p.FlowID, p.SuspendID); err != nil {
+		return err
+	}
+	js.logger(ctx).Info("Flow timeout handled", zap.String("flow_id", p.FlowID), zap.String("suspend_id", p.SuspendID))
+	return nil
+}
+
+// ScheduleFlowTimeout enqueues the timeout of a flow suspension and returns
+// the task ID, so it can be cancelled when the flow resumes in time
+func ScheduleFlowTimeout(ctx context.Context, client Enqueuer, flowID, suspendID string, deadlineAt time.Time) (string, error) {
+	task, err := newPayloadTask(ctx, "flow:timeout", &FlowTimeoutPayload{FlowID: flowID, SuspendID: suspendID})
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessIn(time.Until(deadlineAt))))
+}
+
+// FlowTickHandler runs the step of a flow that ticks on a timer. tickID
+// identifies the scheduled tick; handlers must ignore ticks that were
+// superseded.
+type FlowTickHandler func(ctx context.Context, flowID, tickID string) error
+
+// SetFlowTickHandler sets how flow:tick tasks are handled
+func (js *JobServer) SetFlowTickHandler(h FlowTickHandler) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.flowTick = h
+}
+
+func (js *JobServer) handleFlowTick(ctx context.Context, t *asynq.Task) error {
+	var p FlowTickPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	js.mu.RLock()
+	h := js.flowTick
+	js.mu.RUnlock()
+	if h == nil {
+		return errors.New("no flow tick handler configured")
+	}
+
+	return h(audit.WithActor(ctx, audit.SystemActor), p.FlowID, p.TickID)
+}
+
+// ScheduleFlowTick enqueues the next timed step of a flow and returns the
+// task ID
+func ScheduleFlowTick(ctx context.Context, client Enqueuer, flowID, tickID string, at time.Time) (string, error) {
+	task, err := newPayloadTask(ctx, "flow:tick", &FlowTickPayload{FlowID: flowID, TickID: tickID})
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessAt(at)))
+}
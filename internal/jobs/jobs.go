@@ -2,48 +2,130 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"sync"
 	"time"
 
+	"pxbox/internal/audit"
+	"pxbox/internal/breaker"
+	"pxbox/internal/correlation"
 	"pxbox/internal/db"
+	"pxbox/internal/digest"
+	"pxbox/internal/events"
+	"pxbox/internal/export"
+	"pxbox/internal/model"
 	"pxbox/internal/pubsub"
+	"pxbox/internal/seal"
+	"pxbox/internal/storage"
 
 	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
 type JobServer struct {
-	server *asynq.Server
-	client *asynq.Client
-	db     *db.Pool
-	bus    *pubsub.Bus
-	log    *zap.Logger
+	servers    []*asynq.Server // The shared server, then one per dedicated lane
+	workers    []*pgWorker     // Instead of servers with JOB_BACKEND=postgres
+	client     Enqueuer
+	db         *db.Pool
+	bus        *pubsub.Bus
+	audit      *audit.Logger
+	httpClient *http.Client
+	log        *zap.Logger
+	sealer     *seal.Sealer
+
+	digests      *digest.Renderer
+	digestWithin time.Duration
+
+	mu          sync.RWMutex
+	flowTimeout FlowTimeoutHandler
+	flowTick    FlowTickHandler
+	erasure     ErasureHandler
+	botAnswer   BotAnswerHandler
+	notifiers   map[string]Notifier
 }
 
+// jobConcurrency is the number of jobs the shared workers run at once;
+// dedicated lanes add workers of their own
+const jobConcurrency = 10
+
 func NewJobServer(redisAddr string, dbPool *db.Pool, bus *pubsub.Bus, log *zap.Logger) (*JobServer, *asynq.Client) {
 	redisOpt := asynq.RedisClientOpt{Addr: redisAddr}
-	
-	server := asynq.NewServer(
-		redisOpt,
-		asynq.Config{
-			Concurrency: 10,
-			Queues: map[string]int{
-				"critical": 6,
-				"default":  3,
-				"low":       1,
+	js := newJobServer(dbPool, bus, log)
+
+	// Tasks that exhaust their retries are archived by asynq, which serves
+	// as the dead-letter queue; handleError announces them
+	newServer := func(concurrency int, weights map[string]int) *asynq.Server {
+		return asynq.NewServer(
+			redisOpt,
+			asynq.Config{
+				Concurrency:    concurrency,
+				Queues:         weights,
+				RetryDelayFunc: retryDelay,
+				ErrorHandler:   asynq.ErrorHandlerFunc(js.handleError),
 			},
-		},
-	)
+		)
+	}
+	js.servers = append(js.servers, newServer(jobConcurrency, sharedWeights()))
+	for _, lane := range dedicatedLanes() {
+		js.servers = append(js.servers, newServer(lane.Dedicated, map[string]int{lane.Name: 1}))
+	}
 
 	client := asynq.NewClient(redisOpt)
+	js.client = client
+	return js, client
+}
+
+// NewPGJobServer creates a job server that runs the jobs of the jobs table
+// instead of asynq, for JOB_BACKEND=postgres. Archived jobs serve as the
+// dead-letter queue.
+func NewPGJobServer(dbPool *db.Pool, bus *pubsub.Bus, log *zap.Logger) (*JobServer, *PGQueue) {
+	js := newJobServer(dbPool, bus, log)
+	queue := NewPGQueue(dbPool.Queries)
+	js.client = queue
+	js.workers = append(js.workers, &pgWorker{queries: dbPool.Queries, onError: js.handleError, log: log,
+		concurrency: jobConcurrency, order: queueOrder})
+	for _, lane := range dedicatedLanes() {
+		name := lane.Name
+		js.workers = append(js.workers, &pgWorker{queries: dbPool.Queries, onError: js.handleError, log: log,
+			concurrency: lane.Dedicated, order: func() []string { return []string{name} }})
+	}
+	return js, queue
+}
 
-	return &JobServer{
-		server: server,
-		client: client,
-		db:     dbPool,
-		bus:    bus,
-		log:    log,
-	}, client
+func newJobServer(dbPool *db.Pool, bus *pubsub.Bus, log *zap.Logger) *JobServer {
+	// Outbound callbacks get a breaker per destination host so a slow
+	// endpoint fails fast instead of tying up workers
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: breaker.NewTransport(nil, breaker.FromEnv(breaker.Settings{
+			OnStateChange: breaker.LogStateChange(log),
+		})),
+	}
+
+	js := &JobServer{}
+	js.db = dbPool
+	js.bus = bus
+	js.audit = audit.NewLogger(dbPool.Queries, log)
+	js.httpClient = httpClient
+	js.log = log
+	js.digests, _ = digest.NewRenderer("")
+	js.digestWithin = digest.DefaultExpiringWithin
+	js.notifiers = map[string]Notifier{
+		model.ChannelWebSocket: func(ctx context.Context, entityID string, event map[string]interface{}) error {
+			return bus.PublishEntity(entityID, event)
+		},
+	}
+	return js
+}
+
+// SetSealer lets jobs decrypt the response payloads they deliver and
+// export. It must be called before Start.
+func (js *JobServer) SetSealer(sealer *seal.Sealer) {
+	js.sealer = sealer
 }
 
 func (js *JobServer) Start() error {
@@ -52,22 +134,87 @@ func (js *JobServer) Start() error {
 	// Register job handlers
 	mux.HandleFunc("deadline:notify", js.handleDeadlineNotification)
 	mux.HandleFunc("deadline:expire", js.handleDeadlineExpiry)
+	mux.HandleFunc("request:expire", js.handleRequestExpiry)
 	mux.HandleFunc("request:autocancel", js.handleAutoCancel)
 	mux.HandleFunc("request:attention", js.handleAttentionNotification)
 	mux.HandleFunc("reminder:snooze", js.handleReminder)
+	mux.HandleFunc("request:unclaim", js.handleClaimExpiry)
+	mux.HandleFunc("export:requests", js.handleExport)
+	mux.HandleFunc("request:callback", js.handleCallback)
+	mux.HandleFunc("bot:dispatch", js.handleBotDispatch)
+	mux.HandleFunc("request:notify", js.handleRequestNotification)
+	mux.HandleFunc("webhook:deliver", js.handleWebhookDelivery)
+	mux.HandleFunc("file:scan", js.handleFileScan)
+	mux.HandleFunc("file:thumbnail", js.handleThumbnail)
+	mux.HandleFunc("flow:timeout", js.handleFlowTimeout)
+	mux.HandleFunc("flow:tick", js.handleFlowTick)
+	mux.HandleFunc("entity:erase", js.handleErasure)
+	mux.HandleFunc("notify:deliver", js.handleNotifyDeliver)
+	mux.HandleFunc("digest:send", js.handleDigest)
+	mux.Use(boundContext, requestMemo, correlate)
+
+	for _, w := range js.workers {
+		w.handler = mux
+		w.start()
+	}
+	for i, server := range js.servers {
+		if err := server.Start(mux); err != nil {
+			for _, started := range js.servers[:i] {
+				started.Shutdown()
+			}
+			return err
+		}
+	}
+	return nil
+}
 
-	return js.server.Start(mux)
+// correlate gives each run of a job the correlation ID it was enqueued
+// with, with the task as the cause of what it does
+func correlate(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		return next.ProcessTask(taskContext(ctx, t), t)
+	})
+}
+
+// logger returns the server's logger with the correlation IDs of ctx
+func (js *JobServer) logger(ctx context.Context) *zap.Logger {
+	return correlation.Logger(ctx, js.log)
+}
+
+// requestMemo lets each run of a job share the requests it looks up by ID
+func requestMemo(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		return next.ProcessTask(db.WithRequestMemo(ctx), t)
+	})
 }
 
 func (js *JobServer) Stop() {
-	js.server.Shutdown()
-	js.client.Close()
+	if js.workers != nil {
+		var wg sync.WaitGroup
+		for _, w := range js.workers {
+			wg.Add(1)
+			go func(w *pgWorker) {
+				defer wg.Done()
+				w.stop()
+			}(w)
+		}
+		wg.Wait()
+		return
+	}
+	for _, server := range js.servers {
+		server.Shutdown()
+	}
+	js.client.(*asynq.Client).Close()
 }
 
 // Job handlers
 
 func (js *JobServer) handleDeadlineNotification(ctx context.Context, t *asynq.Task) error {
-	requestID := string(t.Payload())
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	requestID := p.RequestID
 	
 	req, err := js.db.Queries.GetRequestByID(ctx, requestID)
 	if err != nil {
@@ -78,81 +225,161 @@ func (js *JobServer) handleDeadlineNotification(ctx context.Context, t *asynq.Ta
 	if req.Status != "PENDING" {
 		return nil
 	}
+	if deadlineMoved(req.DeadlineAt, time.Hour) {
+		return nil
+	}
 
-	// Publish notification event
-	_ = js.bus.PublishEntity(req.EntityID, map[string]interface{}{
-		"type":      "request.deadline_approaching",
-		"requestId": requestID,
-		"deadlineAt": req.DeadlineAt.Format(time.RFC3339),
-	})
+	// Notify the entity, unless it is in its quiet hours
+	err = js.notify(ctx, req.EntityID, pubsub.MarkSandbox(events.New(ctx, events.RequestDeadlineApproaching{
+		RequestID:  requestID,
+		DeadlineAt: req.DeadlineAt.Format(time.RFC3339),
+	}), req.Sandbox))
+	if err != nil {
+		return err
+	}
 
-	js.log.Info("Deadline notification sent", zap.String("request_id", requestID))
+	js.logger(ctx).Info("Deadline notification sent", zap.String("request_id", requestID))
 	return nil
 }
 
 func (js *JobServer) handleDeadlineExpiry(ctx context.Context, t *asynq.Task) error {
-	requestID := string(t.Payload())
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	requestID := p.RequestID
 	
 	req, err := js.db.Queries.GetRequestByID(ctx, requestID)
 	if err != nil {
 		return fmt.Errorf("failed to get request: %w", err)
 	}
+	if deadlineMoved(req.DeadlineAt, 0) {
+		return nil
+	}
+	return js.expireRequest(ctx, req, "deadline")
+}
+
+// handleRequestExpiry expires a request once its expiresAt has passed. The
+// request has been hidden from queues and closed to answers since then;
+// this records the status and tells the entity and requestor.
+func (js *JobServer) handleRequestExpiry(ctx context.Context, t *asynq.Task) error {
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	req, err := js.db.Queries.GetRequestByID(ctx, p.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to get request: %w", err)
+	}
+	if req.ExpiresAt == nil || deadlineMoved(req.ExpiresAt, 0) {
+		return nil
+	}
+	return js.expireRequest(ctx, req, "expiresAt")
+}
 
-	// Only expire if still pending
-	if req.Status != "PENDING" {
+// expireRequest moves an open request to EXPIRED and publishes
+// request.expired with the reason: "deadline" or "expiresAt"
+func (js *JobServer) expireRequest(ctx context.Context, req db.Request, reason string) error {
+	// Only expire requests that are still open
+	if !model.RequestStatusMachine.CanTransition(model.Status(req.Status), model.StatusExpired) {
 		return nil
 	}
 
-	// Update status to EXPIRED
-	if err := js.db.Queries.UpdateRequestStatus(ctx, requestID, "EXPIRED"); err != nil {
+	// Update status to EXPIRED, unless the request changed in the meantime
+	if err := js.db.Queries.UpdateRequestStatus(ctx, req.ID, string(model.StatusExpired), &req.Version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
 		return fmt.Errorf("failed to update status: %w", err)
 	}
 
-	// Publish expiry event
-	_ = js.bus.PublishEntity(req.EntityID, map[string]interface{}{
-		"type":      "request.expired",
-		"requestId": requestID,
+	js.audit.Record(ctx, audit.Entry{
+		Actor:        audit.SystemActor,
+		Action:       audit.ActionExpire,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   req.ID,
+		BeforeStatus: req.Status,
+		AfterStatus:  "EXPIRED",
+		Meta:         map[string]interface{}{"reason": reason},
 	})
 
-	js.log.Info("Request expired", zap.String("request_id", requestID))
+	// Publish expiry event
+	event := pubsub.MarkSandbox(events.New(ctx, events.RequestExpired{
+		RequestID: req.ID,
+		Reason:    reason,
+	}), req.Sandbox)
+	_ = js.bus.PublishEntity(req.EntityID, event)
+	_ = js.bus.PublishRequestor(req.CreatedBy, event)
+
+	js.logger(ctx).Info("Request expired", zap.String("request_id", req.ID), zap.String("reason", reason))
 	return nil
 }
 
+// deadlineMoved reports whether a deadline task fired for a deadline that
+// has since been extended: the task was due lead before the deadline, but
+// the deadline is now further away. A minute of slack absorbs clock skew.
+func deadlineMoved(deadlineAt *time.Time, lead time.Duration) bool {
+	return deadlineAt != nil && time.Until(*deadlineAt) > lead+time.Minute
+}
+
 func (js *JobServer) handleAutoCancel(ctx context.Context, t *asynq.Task) error {
-	requestID := string(t.Payload())
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	requestID := p.RequestID
 	
 	req, err := js.db.Queries.GetRequestByID(ctx, requestID)
 	if err != nil {
 		return fmt.Errorf("failed to get request: %w", err)
 	}
 
-	// Only auto-cancel if still pending
-	if req.Status != "PENDING" {
+	// Only auto-cancel requests that are still open
+	if !model.RequestStatusMachine.CanTransition(model.Status(req.Status), model.StatusCancelled) {
+		return nil
+	}
+	if req.AutocancelGrace != nil && deadlineMoved(req.DeadlineAt, -*req.AutocancelGrace) {
 		return nil
 	}
 
-	// Cancel the request directly via database
-	if err := js.db.Queries.UpdateRequestStatus(ctx, requestID, "CANCELLED"); err != nil {
+	// Cancel the request directly via database, unless it changed in the meantime
+	if err := js.db.Queries.UpdateRequestStatus(ctx, requestID, string(model.StatusCancelled), &req.Version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
 		return fmt.Errorf("failed to cancel request: %w", err)
 	}
 
-	// Publish cancellation event
-	_ = js.bus.PublishRequest(requestID, map[string]interface{}{
-		"type": "request.cancelled",
-		"requestId": requestID,
+	js.audit.Record(ctx, audit.Entry{
+		Actor:        audit.SystemActor,
+		Action:       audit.ActionCancel,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   requestID,
+		BeforeStatus: req.Status,
+		AfterStatus:  "CANCELLED",
+		Meta:         map[string]interface{}{"reason": "autocancel"},
 	})
 
-	_ = js.bus.PublishEntity(req.EntityID, map[string]interface{}{
-		"type": "request.cancelled",
-		"requestId": requestID,
-	})
+	// Publish cancellation event
+	_ = js.bus.PublishRequest(requestID, pubsub.MarkSandbox(events.New(ctx, events.RequestCancelled{
+		RequestID: requestID,
+	}), req.Sandbox))
 
-	js.log.Info("Request auto-cancelled", zap.String("request_id", requestID))
+	_ = js.bus.PublishEntity(req.EntityID, pubsub.MarkSandbox(events.New(ctx, events.RequestCancelled{
+		RequestID: requestID,
+	}), req.Sandbox))
+
+	js.logger(ctx).Info("Request auto-cancelled", zap.String("request_id", requestID))
 	return nil
 }
 
 func (js *JobServer) handleAttentionNotification(ctx context.Context, t *asynq.Task) error {
-	requestID := string(t.Payload())
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	requestID := p.RequestID
 	
 	req, err := js.db.Queries.GetRequestByID(ctx, requestID)
 	if err != nil {
@@ -164,84 +391,273 @@ func (js *JobServer) handleAttentionNotification(ctx context.Context, t *asynq.T
 		return nil
 	}
 
-	// Publish attention notification event
-	_ = js.bus.PublishEntity(req.EntityID, map[string]interface{}{
-		"type":      "request.needs_attention",
-		"requestId": requestID,
-		"attentionAt": req.AttentionAt.Format(time.RFC3339),
-	})
+	// Notify the entity, unless it is in its quiet hours
+	err = js.notify(ctx, req.EntityID, pubsub.MarkSandbox(events.New(ctx, events.RequestNeedsAttention{
+		RequestID:   requestID,
+		AttentionAt: req.AttentionAt.Format(time.RFC3339),
+	}), req.Sandbox))
+	if err != nil {
+		return err
+	}
 
-	js.log.Info("Attention notification sent", zap.String("request_id", requestID))
+	js.logger(ctx).Info("Attention notification sent", zap.String("request_id", requestID))
 	return nil
 }
 
 func (js *JobServer) handleReminder(ctx context.Context, t *asynq.Task) error {
-	reminderID := string(t.Payload())
+	var p ReminderPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	reminderID := p.ReminderID
 	
-	// Get reminder details
+	// Get reminder details. Reminders that were cancelled, replaced by a
+	// later snooze or already delivered are skipped.
 	reminder, err := js.db.Queries.GetReminderByID(ctx, reminderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		js.logger(ctx).Info("Reminder no longer exists", zap.String("reminder_id", reminderID))
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get reminder: %w", err)
 	}
+	if reminder.DeliveredAt != nil {
+		return nil
+	}
+
+	// Remind the entity, or hold the reminder until its quiet hours end
+	err = js.notify(ctx, reminder.EntityID, events.New(ctx, events.RequestReminder{
+		RequestID:  reminder.RequestID,
+		ReminderID: reminderID,
+	}))
+	if err != nil {
+		return err
+	}
+	if _, err := js.db.Queries.MarkReminderDelivered(ctx, reminderID); err != nil {
+		js.logger(ctx).Warn("Failed to record reminder delivery", zap.String("reminder_id", reminderID), zap.Error(err))
+	}
+
+	// Bring the inquiry back unless it was snoozed again for longer
+	unsnoozed, err := js.db.Queries.UnsnoozeRequest(ctx, reminder.RequestID, reminder.RemindAt)
+	if err != nil {
+		return fmt.Errorf("failed to clear snooze: %w", err)
+	}
+	if unsnoozed {
+		_ = js.bus.PublishEntity(reminder.EntityID, events.New(ctx, events.InquiryUnsnoozed{
+			RequestID: reminder.RequestID,
+			EntityID:  reminder.EntityID,
+		}))
+	}
+
+	js.logger(ctx).Info("Reminder sent", zap.String("reminder_id", reminderID), zap.String("request_id", reminder.RequestID))
+	return nil
+}
+
+func (js *JobServer) handleClaimExpiry(ctx context.Context, t *asynq.Task) error {
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	requestID := p.RequestID
+
+	req, err := js.db.Queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to get request: %w", err)
+	}
+
+	// Release the claim only if it is still the one that lapsed; a released
+	// and re-claimed request carries a later expiry
+	if err := js.db.Queries.UnclaimRequest(ctx, requestID, true, &req.Version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to unclaim request: %w", err)
+	}
 
-	// Publish reminder event
-	_ = js.bus.PublishEntity(reminder.EntityID, map[string]interface{}{
-		"type":      "request.reminder",
-		"requestId": reminder.RequestID,
-		"reminderId": reminderID,
+	js.audit.Record(ctx, audit.Entry{
+		Actor:        audit.SystemActor,
+		Action:       audit.ActionUnclaim,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   requestID,
+		BeforeStatus: req.Status,
+		AfterStatus:  "PENDING",
+		Meta:         map[string]interface{}{"reason": "expired", "claimedBy": req.ClaimedBy},
 	})
 
-	js.log.Info("Reminder sent", zap.String("reminder_id", reminderID), zap.String("request_id", reminder.RequestID))
+	event := pubsub.MarkSandbox(events.New(ctx, events.RequestUnclaimed{
+		RequestID: requestID,
+		Reason:    "expired",
+	}), req.Sandbox)
+	_ = js.bus.PublishRequest(requestID, event)
+	_ = js.bus.PublishEntity(req.EntityID, event)
+
+	js.logger(ctx).Info("Claim expired", zap.String("request_id", requestID))
+	return nil
+}
+
+func (js *JobServer) handleExport(ctx context.Context, t *asynq.Task) error {
+	var p ExportPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	job := p.Job
+
+	stor, err := storage.NewFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	objectName := fmt.Sprintf("exports/%s.%s", job.ID, job.Format.Extension())
+
+	// Stream the export straight into storage
+	pr, pw := io.Pipe()
+	countCh := make(chan int, 1)
+	go func() {
+		count, err := export.Run(ctx, js.db.Queries, js.sealer, job.Filter, job.Format, pw)
+		countCh <- count
+		pw.CloseWithError(err)
+	}()
+
+	if err := stor.Put(ctx, objectName, pr); err != nil {
+		pr.CloseWithError(err)
+		_ = js.bus.PublishRequestor(job.RequestedBy, events.New(ctx, events.ExportFailed{
+			ExportID: job.ID,
+			Error:    err.Error(),
+		}))
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	count := <-countCh
+
+	url, err := stor.PresignGet(ctx, objectName, 24*time.Hour)
+	if err != nil {
+		return fmt.Errorf("failed to presign export: %w", err)
+	}
+
+	_ = js.bus.PublishRequestor(job.RequestedBy, events.New(ctx, events.ExportCompleted{
+		ExportID: job.ID,
+		Format:   string(job.Format),
+		Count:    count,
+		URL:      url,
+	}))
+
+	js.logger(ctx).Info("Export completed", zap.String("export_id", job.ID), zap.Int("count", count))
 	return nil
 }
 
 // Schedule jobs
 
-func ScheduleDeadlineNotification(client *asynq.Client, requestID string, deadlineAt time.Time) error {
+// ScheduleDeadlineNotification, ScheduleDeadlineExpiry and
+// ScheduleAutoCancel return the ID of the enqueued task so it can be
+// cancelled when the deadline moves, or "" if nothing was scheduled
+
+func ScheduleDeadlineNotification(ctx context.Context, client Enqueuer, requestID string, deadlineAt time.Time) (string, error) {
 	// Schedule notification 1 hour before deadline
 	notifyAt := deadlineAt.Add(-1 * time.Hour)
 	if notifyAt.Before(time.Now()) {
-		return nil // Already past notification time
+		return "", nil // Already past notification time
 	}
 
-	task := asynq.NewTask("deadline:notify", []byte(requestID))
-	_, err := client.Enqueue(task, asynq.ProcessIn(time.Until(notifyAt)))
-	return err
+	task, err := requestTask(ctx, "deadline:notify", requestID)
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessIn(time.Until(notifyAt))))
 }
 
-func ScheduleDeadlineExpiry(client *asynq.Client, requestID string, deadlineAt time.Time) error {
+func ScheduleDeadlineExpiry(ctx context.Context, client Enqueuer, requestID string, deadlineAt time.Time) (string, error) {
 	if deadlineAt.Before(time.Now()) {
-		return nil // Already expired
+		return "", nil // Already expired
 	}
 
-	task := asynq.NewTask("deadline:expire", []byte(requestID))
-	_, err := client.Enqueue(task, asynq.ProcessIn(time.Until(deadlineAt)))
-	return err
+	task, err := requestTask(ctx, "deadline:expire", requestID)
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessIn(time.Until(deadlineAt))))
 }
 
-func ScheduleAutoCancel(client *asynq.Client, requestID string, gracePeriod time.Duration) error {
-	task := asynq.NewTask("request:autocancel", []byte(requestID))
-	_, err := client.Enqueue(task, asynq.ProcessIn(gracePeriod))
-	return err
+// ScheduleRequestExpiry schedules the expiry of a request at its expiresAt
+func ScheduleRequestExpiry(ctx context.Context, client Enqueuer, requestID string, expiresAt time.Time) (string, error) {
+	task, err := requestTask(ctx, "request:expire", requestID)
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessAt(expiresAt)))
+}
+
+func ScheduleAutoCancel(ctx context.Context, client Enqueuer, requestID string, gracePeriod time.Duration) (string, error) {
+	task, err := requestTask(ctx, "request:autocancel", requestID)
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessIn(gracePeriod)))
+}
+
+// requestTask creates a task of taskType about one request
+func requestTask(ctx context.Context, taskType, requestID string) (*asynq.Task, error) {
+	return newPayloadTask(ctx, taskType, &RequestPayload{RequestID: requestID})
+}
+
+func enqueueID(info *asynq.TaskInfo, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
 }
 
-func ScheduleAttentionNotification(client *asynq.Client, requestID string, attentionAt time.Time) error {
+// CancelTask deletes a scheduled task from whichever queue holds it. Tasks
+// that already ran or were deleted are ignored.
+func CancelTask(inspector *asynq.Inspector, taskID string) error {
+	for _, queue := range Queues {
+		err := inspector.DeleteTask(queue, taskID)
+		if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+			continue
+		}
+		return err
+	}
+	return nil
+}
+
+func ScheduleAttentionNotification(ctx context.Context, client Enqueuer, requestID string, attentionAt time.Time) error {
 	if attentionAt.Before(time.Now()) {
 		return nil // Already past attention time
 	}
 
-	task := asynq.NewTask("request:attention", []byte(requestID))
-	_, err := client.Enqueue(task, asynq.ProcessIn(time.Until(attentionAt)))
+	task, err := requestTask(ctx, "request:attention", requestID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task, asynq.ProcessIn(time.Until(attentionAt)))
 	return err
 }
 
-func ScheduleReminder(client *asynq.Client, reminderID string, remindAt time.Time) error {
+func ScheduleReminder(ctx context.Context, client Enqueuer, reminderID string, remindAt time.Time) (string, error) {
 	if remindAt.Before(time.Now()) {
-		return nil // Already past reminder time
+		return "", nil // Already past reminder time
 	}
 
-	task := asynq.NewTask("reminder:snooze", []byte(reminderID))
-	_, err := client.Enqueue(task, asynq.ProcessIn(time.Until(remindAt)))
+	task, err := newPayloadTask(ctx, "reminder:snooze", &ReminderPayload{ReminderID: reminderID})
+	if err != nil {
+		return "", err
+	}
+	return enqueueID(client.Enqueue(task, asynq.ProcessIn(time.Until(remindAt))))
+}
+
+func ScheduleClaimExpiry(ctx context.Context, client Enqueuer, requestID string, expiresAt time.Time) error {
+	task, err := requestTask(ctx, "request:unclaim", requestID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task, asynq.ProcessIn(time.Until(expiresAt)))
 	return err
 }
 
+
+func EnqueueExport(ctx context.Context, client Enqueuer, job export.Job) error {
+	task, err := newPayloadTask(ctx, "export:requests", &ExportPayload{Job: job})
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/model"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Notifier sends a notification event to an entity on one channel
+type Notifier func(ctx context.Context, entityID string, event map[string]interface{}) error
+
+// SetNotifier sets how notifications are sent on a channel. The websocket
+// channel publishes to the entity's event channel unless replaced.
+func (js *JobServer) SetNotifier(channel string, n Notifier) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.notifiers[channel] = n
+}
+
+// notify sends a notification to an entity on the channels its preferences
+// enable. Within the entity's quiet hours it is held back as a
+// notify:deliver task that runs when they end.
+func (js *JobServer) notify(ctx context.Context, entityID string, event map[string]interface{}) error {
+	return js.notifyExcept(ctx, entityID, event, nil)
+}
+
+// notifyExcept is notify without the except channels, for events that
+// were already sent on them
+func (js *JobServer) notifyExcept(ctx context.Context, entityID string, event map[string]interface{}, except []string) error {
+	prefs := js.preferences(ctx, entityID)
+	if until, quiet := prefs.QuietUntil(time.Now()); quiet {
+		task, err := newPayloadTask(ctx, "notify:deliver", &NotifyPayload{EntityID: entityID, Event: event, Except: except})
+		if err != nil {
+			return err
+		}
+		if _, err := js.client.Enqueue(task, asynq.ProcessAt(until)); err != nil {
+			return fmt.Errorf("failed to defer notification: %w", err)
+		}
+		js.logger(ctx).Debug("Notification deferred to end of quiet hours",
+			zap.String("entity_id", entityID),
+			zap.Any("type", event["type"]),
+			zap.Time("until", until),
+		)
+		return nil
+	}
+
+	js.deliver(ctx, entityID, event, prefs, except)
+	return nil
+}
+
+// preferences returns an entity's notification preferences, the defaults
+// if it set none or they cannot be read
+func (js *JobServer) preferences(ctx context.Context, entityID string) model.NotificationPreferences {
+	p, err := js.db.Queries.GetNotificationPreferences(ctx, entityID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			js.logger(ctx).Warn("Failed to read notification preferences", zap.String("entity_id", entityID), zap.Error(err))
+		}
+		return model.DefaultNotificationPreferences()
+	}
+	return p
+}
+
+// deliver sends a notification on every enabled channel but except. A
+// failing channel is logged and does not hold back the others.
+func (js *JobServer) deliver(ctx context.Context, entityID string, event map[string]interface{}, prefs model.NotificationPreferences, except []string) {
+	js.mu.RLock()
+	notifiers := make(map[string]Notifier, len(js.notifiers))
+	for channel, n := range js.notifiers {
+		notifiers[channel] = n
+	}
+	js.mu.RUnlock()
+
+	for _, channel := range except {
+		delete(notifiers, channel)
+	}
+	for channel, n := range notifiers {
+		if !prefs.Enabled(channel) {
+			continue
+		}
+		if err := n(ctx, entityID, event); err != nil {
+			js.logger(ctx).Warn("Failed to send notification",
+				zap.String("entity_id", entityID),
+				zap.String("channel", channel),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (js *JobServer) handleNotifyDeliver(ctx context.Context, t *asynq.Task) error {
+	var p NotifyPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	// Drop notifications about requests that were closed in the meantime
+	if requestID := eventRequestID(p.Event); requestID != "" {
+		req, err := js.db.Queries.GetRequestByID(ctx, requestID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get request: %w", err)
+		}
+		if req.Status != string(model.StatusPending) && req.Status != string(model.StatusClaimed) {
+			return nil
+		}
+	}
+
+	js.deliver(ctx, p.EntityID, p.Event, js.preferences(ctx, p.EntityID), p.Except)
+	return nil
+}
+
+// eventRequestID returns the request an event is about, if any
+func eventRequestID(event map[string]interface{}) string {
+	data, _ := event["data"].(map[string]interface{})
+	requestID, _ := data["requestId"].(string)
+	return requestID
+}
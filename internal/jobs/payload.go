@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pxbox/internal/correlation"
+	"pxbox/internal/export"
+
+	"github.com/hibiken/asynq"
+)
+
+// PayloadVersion is the schema version written into task payloads. Adding
+// optional fields keeps the version, since handlers ignore fields they do
+// not know; it is bumped only when a field changes meaning or becomes
+// required.
+const PayloadVersion = 1
+
+// PayloadMeta is embedded in every task payload. The correlation and
+// causation IDs are those of the API call or task that enqueued it.
+type PayloadMeta struct {
+	Version       int       `json:"v"`
+	EnqueuedAt    time.Time `json:"enqueuedAt"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	CausationID   string    `json:"causationId,omitempty"`
+}
+
+func (m *PayloadMeta) stamp(ctx context.Context) {
+	m.Version = PayloadVersion
+	m.EnqueuedAt = time.Now().UTC()
+	m.CorrelationID = correlation.ID(ctx)
+	m.CausationID = correlation.CausationID(ctx)
+}
+
+func (m *PayloadMeta) version() int {
+	return m.Version
+}
+
+// RequestPayload is the payload of tasks about one request: deadline
+// notification and expiry, auto-cancel, attention, claim expiry,
+// callbacks and bot dispatch
+type RequestPayload struct {
+	PayloadMeta
+	RequestID string `json:"requestId"`
+}
+
+func (p *RequestPayload) fromLegacy(id string) { p.RequestID = id }
+
+// ReminderPayload is the payload of reminder:snooze tasks
+type ReminderPayload struct {
+	PayloadMeta
+	ReminderID string `json:"reminderId"`
+}
+
+func (p *ReminderPayload) fromLegacy(id string) { p.ReminderID = id }
+
+// FileScanPayload is the payload of file:scan tasks
+type FileScanPayload struct {
+	PayloadMeta
+	Key string `json:"key"`
+}
+
+func (p *FileScanPayload) fromLegacy(id string) { p.Key = id }
+
+// ExportPayload is the payload of export:requests tasks
+type ExportPayload struct {
+	PayloadMeta
+	export.Job
+}
+
+// FlowTimeoutPayload is the payload of flow:timeout tasks
+type FlowTimeoutPayload struct {
+	PayloadMeta
+	FlowID    string `json:"flowId"`
+	SuspendID string `json:"suspendId"`
+}
+
+// FlowTickPayload is the payload of flow:tick tasks
+type FlowTickPayload struct {
+	PayloadMeta
+	FlowID string `json:"flowId"`
+	TickID string `json:"tickId"`
+}
+
+// ErasurePayload is the payload of entity:erase tasks
+type ErasurePayload struct {
+	PayloadMeta
+	ErasureID string `json:"erasureId"`
+}
+
+// NotifyPayload is the payload of notify:deliver tasks, notifications
+// held back during quiet hours
+type NotifyPayload struct {
+	PayloadMeta
+	EntityID string                 `json:"entityId"`
+	Event    map[string]interface{} `json:"event"`
+	Except   []string               `json:"except,omitempty"` // Channels it was already sent on
+}
+
+// DigestPayload is the payload of digest:send tasks
+type DigestPayload struct {
+	PayloadMeta
+	EntityID string    `json:"entityId"`
+	Slot     time.Time `json:"slot"` // When the digest was due
+}
+
+// WebhookPayload is the payload of webhook:deliver tasks
+type WebhookPayload struct {
+	PayloadMeta
+	DeliveryID string `json:"deliveryId"`
+}
+
+type payload interface {
+	stamp(ctx context.Context)
+	version() int
+}
+
+// legacyPayload is implemented by payloads of task types that used to
+// carry a bare ID, so tasks queued before an upgrade still run
+type legacyPayload interface {
+	fromLegacy(id string)
+}
+
+// newPayloadTask stamps and encodes p as the payload of a new task
+func newPayloadTask(ctx context.Context, taskType string, p payload) (*asynq.Task, error) {
+	p.stamp(ctx)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", taskType, err)
+	}
+	return newTask(taskType, data), nil
+}
+
+// taskContext returns ctx with the correlation ID in the payload of t and
+// t as the causation ID. Tasks without one, enqueued by the scheduler or
+// before an upgrade, start a correlation of their own.
+func taskContext(ctx context.Context, t *asynq.Task) context.Context {
+	var meta PayloadMeta
+	if data := t.Payload(); len(data) > 0 && data[0] == '{' {
+		_ = json.Unmarshal(data, &meta)
+	}
+	causation := currentTask(ctx).ID
+	if causation == "" {
+		causation = correlation.New()
+	}
+	if meta.CorrelationID == "" {
+		meta.CorrelationID = causation
+	}
+	return correlation.With(ctx, meta.CorrelationID, causation)
+}
+
+// decodePayload reads the payload of t into p. Malformed payloads and
+// payloads of a newer schema version are not retried; they go straight to
+// the dead-letter queue, from where they can be requeued once the worker
+// understands them.
+func decodePayload(t *asynq.Task, p payload) error {
+	data := t.Payload()
+	if len(data) > 0 && data[0] != '{' {
+		if lp, ok := p.(legacyPayload); ok {
+			lp.fromLegacy(string(data))
+			return nil
+		}
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return fmt.Errorf("invalid %s payload: %v: %w", t.Type(), err, asynq.SkipRetry)
+	}
+	if v := p.version(); v > PayloadVersion {
+		return fmt.Errorf("%s payload version %d is newer than supported %d: %w", t.Type(), v, PayloadVersion, asynq.SkipRetry)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pxbox/internal/correlation"
+	"pxbox/internal/export"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	task, err := requestTask(context.Background(), "deadline:expire", "req-1")
+	require.NoError(t, err)
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(task.Payload(), &raw))
+	assert.Equal(t, float64(PayloadVersion), raw["v"])
+	assert.Equal(t, "req-1", raw["requestId"])
+	assert.Contains(t, raw, "enqueuedAt")
+
+	var p RequestPayload
+	require.NoError(t, decodePayload(task, &p))
+	assert.Equal(t, "req-1", p.RequestID)
+	assert.Equal(t, PayloadVersion, p.Version)
+	assert.False(t, p.EnqueuedAt.IsZero())
+
+	task, err = newPayloadTask(context.Background(), "export:requests", &ExportPayload{Job: export.Job{ID: "exp-1", RequestedBy: "client-1"}})
+	require.NoError(t, err)
+	var ep ExportPayload
+	require.NoError(t, decodePayload(task, &ep))
+	assert.Equal(t, "exp-1", ep.ID)
+	assert.Equal(t, "client-1", ep.RequestedBy)
+}
+
+func TestDecodePayload(t *testing.T) {
+	t.Run("legacy bare ID", func(t *testing.T) {
+		var p ReminderPayload
+		require.NoError(t, decodePayload(asynq.NewTask("reminder:snooze", []byte("rem-1")), &p))
+		assert.Equal(t, "rem-1", p.ReminderID)
+		assert.Zero(t, p.Version)
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		var p FileScanPayload
+		require.NoError(t, decodePayload(asynq.NewTask("file:scan", []byte(`{"v":1,"key":"k","extra":true}`)), &p))
+		assert.Equal(t, "k", p.Key)
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		var p RequestPayload
+		err := decodePayload(asynq.NewTask("request:callback", []byte(`{"v":2,"requestId":"req-1"}`)), &p)
+		assert.True(t, errors.Is(err, asynq.SkipRetry))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		var job ThumbnailJob
+		err := decodePayload(asynq.NewTask("file:thumbnail", []byte(`{"v":`)), &job)
+		assert.True(t, errors.Is(err, asynq.SkipRetry))
+	})
+}
+
+func TestTaskContext(t *testing.T) {
+	ctx := correlation.With(context.Background(), "req-abc", "")
+	task, err := requestTask(ctx, "request:callback", "req-1")
+	require.NoError(t, err)
+	var p RequestPayload
+	require.NoError(t, decodePayload(task, &p))
+	assert.Equal(t, "req-abc", p.CorrelationID)
+	assert.Equal(t, "req-abc", p.CausationID)
+
+	// The task run keeps the correlation and is the cause of what it does
+	running := context.WithValue(context.Background(), runningTaskKey{}, runningTask{ID: "task-1"})
+	ctx = taskContext(running, task)
+	assert.Equal(t, "req-abc", correlation.ID(ctx))
+	assert.Equal(t, "task-1", correlation.CausationID(ctx))
+
+	// Scheduled and legacy tasks start their own correlation
+	ctx = taskContext(running, asynq.NewTask("reminder:snooze", []byte("rem-1")))
+	assert.Equal(t, "task-1", correlation.ID(ctx))
+	assert.Equal(t, "task-1", correlation.CausationID(ctx))
+}
@@ -0,0 +1,298 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+// Enqueuer puts tasks on a job queue. *asynq.Client implements it, and so
+// does PGQueue for JOB_BACKEND=postgres.
+type Enqueuer interface {
+	Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error)
+}
+
+// Job queue backends, selected by JOB_BACKEND
+const (
+	BackendRedis    = "redis"
+	BackendPostgres = "postgres"
+)
+
+// BackendFromEnv returns the job queue backend of JOB_BACKEND: asynq on
+// "redis" (default) or the jobs table on "postgres"
+func BackendFromEnv() (string, error) {
+	switch backend := os.Getenv("JOB_BACKEND"); backend {
+	case "", BackendRedis:
+		return BackendRedis, nil
+	case BackendPostgres:
+		return BackendPostgres, nil
+	default:
+		return "", fmt.Errorf("unknown JOB_BACKEND %q (use redis or postgres)", backend)
+	}
+}
+
+// RedisRequired reports whether anything is configured to use Redis: the
+// event bus (EVENT_BACKEND), the given job queue backend or the request and
+// schema $ref caches (REQUEST_CACHE, SCHEMA_REF_CACHE). Without it, presence,
+// leader election and checkpoints use Postgres as well.
+func RedisRequired(jobBackend string) bool {
+	return os.Getenv("EVENT_BACKEND") != "postgres" ||
+		jobBackend != BackendPostgres ||
+		os.Getenv("REQUEST_CACHE") == "redis" ||
+		os.Getenv("SCHEMA_REF_CACHE") == "redis"
+}
+
+const (
+	// pgPollInterval is how long an idle worker waits before looking for
+	// due jobs again
+	pgPollInterval = time.Second
+	// pgJobTimeout bounds a single run of a job, like asynq's default
+	// task timeout; its lease lasts a minute longer
+	pgJobTimeout = 30 * time.Minute
+	// pgShutdownTimeout is how long Stop lets running jobs finish before
+	// cancelling them
+	pgShutdownTimeout = 8 * time.Second
+)
+
+// PGQueue keeps tasks in the jobs table, so deployments with Postgres as
+// their only datastore get durable scheduled jobs. Tasks keep their asynq
+// types and payloads and run through the same handlers.
+type PGQueue struct {
+	queries *db.Queries
+	tx      db.Querier
+}
+
+// NewPGQueue creates a job queue on the jobs table
+func NewPGQueue(queries *db.Queries) *PGQueue {
+	return &PGQueue{queries: queries, tx: queries}
+}
+
+// WithQuerier returns a queue that enqueues through q, so that inside
+// db.Queries.InTx jobs commit or roll back with the transaction
+func (q *PGQueue) WithQuerier(tx db.Querier) *PGQueue {
+	return &PGQueue{queries: q.queries, tx: tx}
+}
+
+// Enqueue inserts a task. The Queue, ProcessAt, ProcessIn, MaxRetry and
+// TaskID options are honoured; the queue and retry limit default to the
+// lane and policy of the task type.
+func (q *PGQueue) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	j := db.Job{
+		ID:       ulid.Make().String(),
+		Queue:    QueueFor(task.Type()),
+		Type:     task.Type(),
+		Payload:  task.Payload(),
+		RunAt:    time.Now(),
+		MaxRetry: PolicyFor(task.Type()).MaxRetry,
+	}
+	for _, opt := range opts {
+		switch opt.Type() {
+		case asynq.QueueOpt:
+			j.Queue = opt.Value().(string)
+		case asynq.ProcessAtOpt:
+			j.RunAt = opt.Value().(time.Time)
+		case asynq.ProcessInOpt:
+			j.RunAt = time.Now().Add(opt.Value().(time.Duration))
+		case asynq.MaxRetryOpt:
+			j.MaxRetry = opt.Value().(int)
+		case asynq.TaskIDOpt:
+			j.ID = opt.Value().(string)
+		default:
+			return nil, fmt.Errorf("job option %s is not supported by the database queue", opt)
+		}
+	}
+
+	if err := q.tx.InsertJob(context.Background(), j); err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s: %w", j.Type, err)
+	}
+	return &asynq.TaskInfo{
+		ID:            j.ID,
+		Queue:         j.Queue,
+		Type:          j.Type,
+		Payload:       j.Payload,
+		State:         asynq.TaskStateScheduled,
+		MaxRetry:      j.MaxRetry,
+		NextProcessAt: j.RunAt,
+	}, nil
+}
+
+// Cancel deletes a job that has not started. Jobs that already ran or
+// were deleted are ignored.
+func (q *PGQueue) Cancel(taskID string) error {
+	_, err := q.queries.CancelJob(context.Background(), taskID)
+	return err
+}
+
+// runningTask describes the task a handler runs, under either queue
+type runningTask struct {
+	ID       string
+	Queue    string
+	Retried  int
+	MaxRetry int
+}
+
+type runningTaskKey struct{}
+
+// currentTask returns the task ctx belongs to. asynq keeps this in its own
+// context values, which the database queue cannot set.
+func currentTask(ctx context.Context) runningTask {
+	if t, ok := ctx.Value(runningTaskKey{}).(runningTask); ok {
+		return t
+	}
+	var t runningTask
+	t.ID, _ = asynq.GetTaskID(ctx)
+	t.Queue, _ = asynq.GetQueueName(ctx)
+	t.Retried, _ = asynq.GetRetryCount(ctx)
+	t.MaxRetry, _ = asynq.GetMaxRetry(ctx)
+	return t
+}
+
+// queueOrder returns the lanes of the shared workers in a random order
+// weighted by their weights, so busy higher queues do not starve the lower
+// ones
+func queueOrder() []string {
+	weights := sharedWeights()
+	remaining := make([]string, 0, len(weights))
+	for _, name := range Queues {
+		if weights[name] > 0 {
+			remaining = append(remaining, name)
+		}
+	}
+	order := make([]string, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0
+		for _, name := range remaining {
+			total += weights[name]
+		}
+		pick := rand.Intn(total)
+		for i, name := range remaining {
+			if pick < weights[name] {
+				order = append(order, name)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			pick -= weights[name]
+		}
+	}
+	return order
+}
+
+// pgWorker runs the jobs of a PGQueue with a fixed number of goroutines
+type pgWorker struct {
+	queries     *db.Queries
+	handler     asynq.Handler
+	onError     func(ctx context.Context, t *asynq.Task, err error)
+	log         *zap.Logger
+	concurrency int
+	order       func() []string // The queues to claim from, most preferred first
+
+	quit   chan struct{}
+	ctx    context.Context // Cancelled when running jobs are abandoned
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (w *pgWorker) start() {
+	w.quit = make(chan struct{})
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go w.run()
+	}
+}
+
+// stop stops taking jobs and waits for the running ones, cancelling them
+// after pgShutdownTimeout. Cancelled jobs are retried.
+func (w *pgWorker) stop() {
+	close(w.quit)
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(pgShutdownTimeout):
+		w.cancel()
+		<-done
+	}
+	w.cancel()
+}
+
+func (w *pgWorker) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.quit:
+			return
+		default:
+		}
+
+		j, err := w.queries.ClaimJob(w.ctx, w.order(), pgJobTimeout+time.Minute)
+		if err == nil {
+			w.process(j)
+			continue
+		}
+		if !errors.Is(err, pgx.ErrNoRows) && w.ctx.Err() == nil {
+			w.log.Warn("Failed to claim job", zap.Error(err))
+		}
+		select {
+		case <-w.quit:
+			return
+		case <-time.After(pgPollInterval):
+		}
+	}
+}
+
+func (w *pgWorker) process(j db.Job) {
+	task := asynq.NewTask(j.Type, j.Payload)
+	ctx := context.WithValue(w.ctx, runningTaskKey{}, runningTask{
+		ID:       j.ID,
+		Queue:    j.Queue,
+		Retried:  j.Retried,
+		MaxRetry: j.MaxRetry,
+	})
+	ctx, cancel := context.WithTimeout(ctx, pgJobTimeout)
+	err := w.call(ctx, task)
+	cancel()
+
+	// Record the outcome even if the worker is stopping
+	bg := context.Background()
+	if err == nil {
+		if err := w.queries.CompleteJob(bg, j.ID); err != nil {
+			w.log.Warn("Failed to complete job", zap.String("task_id", j.ID), zap.Error(err))
+		}
+		return
+	}
+
+	w.onError(ctx, task, err)
+	if j.Retried < j.MaxRetry && !errors.Is(err, asynq.SkipRetry) {
+		err = w.queries.RetryJob(bg, j.ID, time.Now().Add(retryDelay(j.Retried, err, task)), err.Error())
+	} else {
+		err = w.queries.ArchiveJob(bg, j.ID, err.Error())
+	}
+	if err != nil {
+		w.log.Warn("Failed to record job failure", zap.String("task_id", j.ID), zap.Error(err))
+	}
+}
+
+// call runs the handler, turning a panic into an error as asynq does
+func (w *pgWorker) call(ctx context.Context, task *asynq.Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.handler.ProcessTask(ctx, task)
+}
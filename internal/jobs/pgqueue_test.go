@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueOrder(t *testing.T) {
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		order := queueOrder()
+		assert.ElementsMatch(t, Queues, order)
+		first[order[0]]++
+	}
+	// Weighted 6:3:1, so every queue comes first sometimes, critical most
+	assert.Greater(t, first["critical"], first["default"])
+	assert.Greater(t, first["default"], first["low"])
+	assert.Greater(t, first["low"], 0)
+}
+
+func TestCurrentTask(t *testing.T) {
+	assert.Equal(t, runningTask{}, currentTask(context.Background()))
+
+	task := runningTask{ID: "01J", Queue: "low", Retried: 2, MaxRetry: 3}
+	ctx := context.WithValue(context.Background(), runningTaskKey{}, task)
+	assert.Equal(t, task, currentTask(ctx))
+}
+
+func TestRedisRequired(t *testing.T) {
+	t.Setenv("EVENT_BACKEND", "")
+	t.Setenv("REQUEST_CACHE", "")
+	t.Setenv("SCHEMA_REF_CACHE", "")
+	assert.True(t, RedisRequired(BackendPostgres), "the event bus defaults to Redis")
+
+	t.Setenv("EVENT_BACKEND", "postgres")
+	assert.False(t, RedisRequired(BackendPostgres))
+	assert.True(t, RedisRequired(BackendRedis))
+
+	t.Setenv("SCHEMA_REF_CACHE", "redis")
+	assert.True(t, RedisRequired(BackendPostgres))
+}
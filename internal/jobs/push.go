@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/push"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// notificationTexts are the title and body of the push and chat
+// notifications of each event type; other events are not sent. %s is the
+// request's title.
+var notificationTexts = map[string][2]string{
+	"request.created":              {"New request", "%s"},
+	"request.reminder":             {"Reminder", "%s is waiting for you"},
+	"request.deadline_approaching": {"Deadline in 1 hour", "%s is due soon"},
+	"request.needs_attention":      {"Needs attention", "%s is still open"},
+}
+
+// SetPushGateway sends notifications to the registered devices of entities
+// on the push channel. It must be called before Start.
+func (js *JobServer) SetPushGateway(g *push.Gateway) {
+	js.SetNotifier(model.ChannelPush, func(ctx context.Context, entityID string, event map[string]interface{}) error {
+		return js.sendPush(ctx, g, entityID, event)
+	})
+}
+
+// sendPush sends an event about a request to every device of an entity the
+// gateway supports. The request ID is the collapse key, so a device shows
+// one notification per request, and the badge is the number of open
+// requests. Tokens the push service rejects are forgotten.
+func (js *JobServer) sendPush(ctx context.Context, g *push.Gateway, entityID string, event map[string]interface{}) error {
+	eventType, _ := event["type"].(string)
+	texts, ok := notificationTexts[eventType]
+	requestID := eventRequestID(event)
+	if !ok || requestID == "" || event["sandbox"] == true {
+		return nil
+	}
+
+	devices, err := js.db.Queries.ListDevices(ctx, entityID)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	msg := push.Message{
+		Title:       texts[0],
+		Body:        fmt.Sprintf(texts[1], js.requestTitle(ctx, requestID)),
+		CollapseKey: requestID,
+		Data:        map[string]string{"type": eventType, "requestId": requestID},
+	}
+	if open, err := js.db.Queries.CountOpenRequests(ctx, entityID); err == nil {
+		msg.Badge = &open
+	}
+
+	var failed error
+	for _, d := range devices {
+		if !g.Supports(d.Platform) {
+			continue
+		}
+		err := g.Send(ctx, d.Platform, d.Token, msg)
+		if errors.Is(err, push.ErrInvalidToken) {
+			if err := js.db.Queries.DeleteDeviceToken(ctx, d.Platform, d.Token); err != nil {
+				js.logger(ctx).Warn("Failed to forget invalid push token", zap.String("device_id", d.ID), zap.Error(err))
+			} else {
+				js.logger(ctx).Info("Forgot invalid push token", zap.String("entity_id", entityID), zap.String("device_id", d.ID))
+			}
+			continue
+		}
+		if err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// requestTitle returns the schema title of a request, or its ID if it has
+// none
+func (js *JobServer) requestTitle(ctx context.Context, requestID string) string {
+	if req, err := js.db.Queries.GetRequestByID(ctx, requestID); err == nil {
+		if title, _ := req.SchemaPayload["title"].(string); title != "" {
+			return title
+		}
+	}
+	return "Request " + requestID
+}
+
+// EnqueueRequestNotification sends request.created to the entity of a new
+// request on its channels other than the WebSocket, which the request
+// service publishes to itself
+func EnqueueRequestNotification(ctx context.Context, client Enqueuer, requestID string) error {
+	task, err := requestTask(ctx, "request:notify", requestID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
+
+func (js *JobServer) handleRequestNotification(ctx context.Context, t *asynq.Task) error {
+	var p RequestPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	req, err := js.db.Queries.GetRequestByID(ctx, p.RequestID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get request: %w", err)
+	}
+	if req.Status != string(model.StatusPending) || (req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now())) {
+		return nil
+	}
+
+	created := events.New(ctx, events.RequestCreated{RequestID: req.ID, EntityID: req.EntityID})
+	return js.notifyExcept(ctx, req.EntityID, created, []string{model.ChannelWebSocket})
+}
@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Lane is a job queue and the workers it gets
+type Lane struct {
+	Name string
+	// Weight is the lane's share of the shared workers when every lane has
+	// jobs waiting; 0 leaves the lane to its dedicated workers
+	Weight int
+	// Dedicated is the number of workers serving only this lane, so its
+	// jobs run even while the shared workers are busy with long ones
+	Dedicated int
+}
+
+// QueueConfig sorts tasks into lanes by type, so bulk work such as exports
+// cannot hold up latency-sensitive work such as deadline expiry
+type QueueConfig struct {
+	Lanes  []Lane
+	Routes map[string]string // Lane by task type; other types go to "default"
+}
+
+// DefaultQueueConfig runs scheduled state changes in "critical", with two
+// workers of its own, and exports, thumbnails and digests in "low"
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Lanes: []Lane{
+			{Name: "critical", Weight: 6, Dedicated: 2},
+			{Name: "default", Weight: 3},
+			{Name: "low", Weight: 1},
+		},
+		Routes: map[string]string{
+			"deadline:notify":    "critical",
+			"deadline:expire":    "critical",
+			"request:expire":     "critical",
+			"request:autocancel": "critical",
+			"request:unclaim":    "critical",
+			"flow:timeout":       "critical",
+			"flow:tick":          "critical",
+			"export:requests":    "low",
+			"file:thumbnail":     "low",
+			"digest:send":        "low",
+		},
+	}
+}
+
+// QueuesFromEnv starts from DefaultQueueConfig and applies JOB_QUEUES,
+// lane weights as "default=3,bulk=1"; JOB_DEDICATED_WORKERS, dedicated
+// workers as "critical=2"; and JOB_ROUTES, lanes by task type as
+// "export:requests=bulk". Lanes not listed keep their defaults, and new
+// lanes are added as they are named.
+func QueuesFromEnv() (QueueConfig, error) {
+	cfg := DefaultQueueConfig()
+	lane := func(name string) *Lane {
+		for i := range cfg.Lanes {
+			if cfg.Lanes[i].Name == name {
+				return &cfg.Lanes[i]
+			}
+		}
+		cfg.Lanes = append(cfg.Lanes, Lane{Name: name})
+		return &cfg.Lanes[len(cfg.Lanes)-1]
+	}
+
+	if v := os.Getenv("JOB_QUEUES"); v != "" {
+		pairs, err := parsePairs("JOB_QUEUES", v)
+		if err != nil {
+			return cfg, err
+		}
+		for _, p := range pairs {
+			n, err := strconv.Atoi(p[1])
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("invalid JOB_QUEUES weight %q for %s", p[1], p[0])
+			}
+			lane(p[0]).Weight = n
+		}
+	}
+	if v := os.Getenv("JOB_DEDICATED_WORKERS"); v != "" {
+		pairs, err := parsePairs("JOB_DEDICATED_WORKERS", v)
+		if err != nil {
+			return cfg, err
+		}
+		for _, p := range pairs {
+			n, err := strconv.Atoi(p[1])
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("invalid JOB_DEDICATED_WORKERS count %q for %s", p[1], p[0])
+			}
+			lane(p[0]).Dedicated = n
+		}
+	}
+	if v := os.Getenv("JOB_ROUTES"); v != "" {
+		pairs, err := parsePairs("JOB_ROUTES", v)
+		if err != nil {
+			return cfg, err
+		}
+		for _, p := range pairs {
+			cfg.Routes[p[0]] = p[1]
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+// parsePairs splits "a=1,b=2" into its pairs
+func parsePairs(name, v string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, item := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid %s entry %q (use name=value)", name, item)
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, nil
+}
+
+func (c QueueConfig) validate() error {
+	lanes := make(map[string]bool, len(c.Lanes))
+	shared := false
+	for _, l := range c.Lanes {
+		if lanes[l.Name] {
+			return fmt.Errorf("job queue %q is configured twice", l.Name)
+		}
+		lanes[l.Name] = true
+		if l.Weight == 0 && l.Dedicated == 0 {
+			return fmt.Errorf("job queue %q has neither a weight nor dedicated workers", l.Name)
+		}
+		shared = shared || l.Weight > 0
+	}
+	if !lanes["default"] {
+		return fmt.Errorf("the default job queue is required")
+	}
+	if !shared {
+		return fmt.Errorf("at least one job queue needs a weight above 0")
+	}
+	for taskType, lane := range c.Routes {
+		if !lanes[lane] {
+			return fmt.Errorf("task type %s is routed to unknown job queue %q", taskType, lane)
+		}
+	}
+	return nil
+}
+
+// queues is the configuration in use, set by UseQueues
+var queues = DefaultQueueConfig()
+
+// Queues are the queues the job server processes
+var Queues = queueNames(queues)
+
+// UseQueues makes the job server and the enqueue functions use cfg. It
+// must be called at startup, before jobs are enqueued or served.
+func UseQueues(cfg QueueConfig) {
+	queues = cfg
+	Queues = queueNames(cfg)
+}
+
+// QueueFor returns the lane tasks of taskType are enqueued in
+func QueueFor(taskType string) string {
+	if lane, ok := queues.Routes[taskType]; ok {
+		return lane
+	}
+	return "default"
+}
+
+func queueNames(cfg QueueConfig) []string {
+	names := make([]string, len(cfg.Lanes))
+	for i, l := range cfg.Lanes {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// sharedWeights are the lanes served by the shared workers, by weight
+func sharedWeights() map[string]int {
+	weights := make(map[string]int)
+	for _, l := range queues.Lanes {
+		if l.Weight > 0 {
+			weights[l.Name] = l.Weight
+		}
+	}
+	return weights
+}
+
+// dedicatedLanes are the lanes with workers of their own
+func dedicatedLanes() []Lane {
+	var lanes []Lane
+	for _, l := range queues.Lanes {
+		if l.Dedicated > 0 {
+			lanes = append(lanes, l)
+		}
+	}
+	return lanes
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuesFromEnv(t *testing.T) {
+	cfg, err := QueuesFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultQueueConfig(), cfg)
+
+	t.Setenv("JOB_QUEUES", "low=0, bulk=1")
+	t.Setenv("JOB_DEDICATED_WORKERS", "critical=4,low=1")
+	t.Setenv("JOB_ROUTES", "export:requests=bulk")
+	cfg, err = QueuesFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []Lane{
+		{Name: "critical", Weight: 6, Dedicated: 4},
+		{Name: "default", Weight: 3},
+		{Name: "low", Dedicated: 1},
+		{Name: "bulk", Weight: 1},
+	}, cfg.Lanes)
+	assert.Equal(t, "bulk", cfg.Routes["export:requests"])
+
+	for env, value := range map[string]string{
+		"JOB_QUEUES":            "default",
+		"JOB_DEDICATED_WORKERS": "critical=-1",
+		"JOB_ROUTES":            "export:requests=nowhere",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			_, err := QueuesFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestQueueConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultQueueConfig().validate())
+	assert.Error(t, QueueConfig{Lanes: []Lane{{Name: "critical", Weight: 1}}}.validate(), "default lane is required")
+	assert.Error(t, QueueConfig{Lanes: []Lane{{Name: "default"}}}.validate(), "lane without workers")
+	assert.Error(t, QueueConfig{Lanes: []Lane{{Name: "default", Dedicated: 1}}}.validate(), "no shared lane")
+}
+
+func TestUseQueues(t *testing.T) {
+	defer UseQueues(DefaultQueueConfig())
+
+	assert.Equal(t, "critical", QueueFor("deadline:expire"))
+	assert.Equal(t, "low", QueueFor("export:requests"))
+	assert.Equal(t, "default", QueueFor("request:callback"))
+
+	UseQueues(QueueConfig{
+		Lanes:  []Lane{{Name: "default", Weight: 1}, {Name: "deadlines", Dedicated: 2}},
+		Routes: map[string]string{"deadline:expire": "deadlines"},
+	})
+	assert.Equal(t, []string{"default", "deadlines"}, Queues)
+	assert.Equal(t, "deadlines", QueueFor("deadline:expire"))
+	assert.Equal(t, "default", QueueFor("export:requests"))
+	// Dedicated-only lanes are left out of the shared workers' order
+	assert.Equal(t, []string{"default"}, queueOrder())
+	assert.Equal(t, []Lane{{Name: "deadlines", Dedicated: 2}}, dedicatedLanes())
+}
@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+
+	"pxbox/internal/events"
+)
+
+// RetryPolicy is how often and how fast a task type is retried before it
+// is archived in the dead-letter queue
+type RetryPolicy struct {
+	MaxRetry  int
+	BaseDelay time.Duration // Delay before the first retry, doubled per attempt
+	MaxDelay  time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{MaxRetry: 5, BaseDelay: 10 * time.Second, MaxDelay: 10 * time.Minute}
+
+// retryPolicies sets the retry behaviour per task type. Scheduled state
+// changes are cheap and idempotent, so they retry quickly; callbacks wait
+// out receiver outages for longer.
+var retryPolicies = map[string]RetryPolicy{
+	"deadline:notify":    {MaxRetry: 3, BaseDelay: 5 * time.Second, MaxDelay: time.Minute},
+	"deadline:expire":    {MaxRetry: 10, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	"request:expire":     {MaxRetry: 10, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	"request:autocancel": {MaxRetry: 10, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	"request:attention":  {MaxRetry: 3, BaseDelay: 5 * time.Second, MaxDelay: time.Minute},
+	"reminder:snooze":    {MaxRetry: 5, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	"request:unclaim":    {MaxRetry: 10, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	"export:requests":    {MaxRetry: 3, BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute},
+	"request:callback":   {MaxRetry: 10, BaseDelay: 30 * time.Second, MaxDelay: time.Hour},
+	"bot:dispatch":       {MaxRetry: 10, BaseDelay: 10 * time.Second, MaxDelay: 30 * time.Minute},
+	"request:notify":     {MaxRetry: 3, BaseDelay: 5 * time.Second, MaxDelay: time.Minute},
+	"webhook:deliver":    {MaxRetry: 12, BaseDelay: 30 * time.Second, MaxDelay: time.Hour},
+	"file:scan":          {MaxRetry: 5, BaseDelay: 15 * time.Second, MaxDelay: 10 * time.Minute},
+	"file:thumbnail":     {MaxRetry: 3, BaseDelay: 15 * time.Second, MaxDelay: 5 * time.Minute},
+	"flow:timeout":       {MaxRetry: 10, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	"flow:tick":          {MaxRetry: 3, BaseDelay: 5 * time.Second, MaxDelay: time.Minute},
+	"entity:erase":       {MaxRetry: 10, BaseDelay: 30 * time.Second, MaxDelay: 30 * time.Minute},
+	"notify:deliver":     {MaxRetry: 3, BaseDelay: 5 * time.Second, MaxDelay: time.Minute},
+	"digest:send":        {MaxRetry: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute},
+}
+
+// PolicyFor returns the retry policy of a task type
+func PolicyFor(taskType string) RetryPolicy {
+	if p, ok := retryPolicies[taskType]; ok {
+		return p
+	}
+	return defaultRetryPolicy
+}
+
+// newTask creates a task carrying the retry limit and the lane of its type
+func newTask(taskType string, payload []byte) *asynq.Task {
+	return asynq.NewTask(taskType, payload, asynq.MaxRetry(PolicyFor(taskType).MaxRetry), asynq.Queue(QueueFor(taskType)))
+}
+
+// retryDelay backs off exponentially per task type, with up to 20% jitter
+// so tasks that failed together do not retry together
+func retryDelay(n int, err error, t *asynq.Task) time.Duration {
+	p := PolicyFor(t.Type())
+	d := p.BaseDelay
+	for i := 0; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// handleError logs failed attempts and announces tasks that will not be
+// retried again, which are archived as dead letters
+func (js *JobServer) handleError(ctx context.Context, t *asynq.Task, err error) {
+	ctx = taskContext(ctx, t)
+	task := currentTask(ctx)
+	retried, maxRetry, taskID, queue := task.Retried, task.MaxRetry, task.ID, task.Queue
+
+	if retried < maxRetry && !errors.Is(err, asynq.SkipRetry) {
+		js.logger(ctx).Warn("Job failed, will retry",
+			zap.String("type", t.Type()), zap.String("task_id", taskID),
+			zap.Int("retried", retried), zap.Int("max_retry", maxRetry), zap.Error(err))
+		return
+	}
+
+	js.logger(ctx).Error("Job failed permanently",
+		zap.String("type", t.Type()), zap.String("task_id", taskID), zap.String("queue", queue),
+		zap.Int("retried", retried), zap.Error(err))
+	_ = js.bus.PublishOps(events.New(ctx, events.JobFailed{
+		TaskID:   taskID,
+		TaskType: t.Type(),
+		Queue:    queue,
+		Retried:  retried,
+		Error:    err.Error(),
+	}))
+}
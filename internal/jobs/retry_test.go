@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	task := asynq.NewTask("request:callback", nil)
+	p := PolicyFor("request:callback")
+
+	within := func(d, want time.Duration) {
+		t.Helper()
+		assert.GreaterOrEqual(t, d, want)
+		assert.LessOrEqual(t, d, want+want/5)
+	}
+	within(retryDelay(0, errors.New("boom"), task), p.BaseDelay)
+	within(retryDelay(2, errors.New("boom"), task), 4*p.BaseDelay)
+	within(retryDelay(50, errors.New("boom"), task), p.MaxDelay)
+
+	assert.Equal(t, defaultRetryPolicy, PolicyFor("unknown:type"))
+}
+
+func TestRetryPolicies(t *testing.T) {
+	for taskType, p := range retryPolicies {
+		assert.Greater(t, p.MaxRetry, 0, taskType)
+		assert.LessOrEqual(t, p.BaseDelay, p.MaxDelay, taskType)
+	}
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pxbox/internal/events"
+	"pxbox/internal/scan"
+	"pxbox/internal/storage"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// handleFileScan scans an uploaded file and moves it to quarantine if a
+// threat is found. The file is marked as errored once all retries fail.
+func (js *JobServer) handleFileScan(ctx context.Context, t *asynq.Task) error {
+	var p FileScanPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+	key := p.Key
+
+	file, err := js.db.Queries.GetFileByKey(ctx, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // Deleted in the meantime
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+	if file.ScanStatus != scan.StatusPending {
+		return nil
+	}
+
+	result, err := js.scanFile(ctx, key)
+	if err != nil {
+		if task := currentTask(ctx); task.Retried >= task.MaxRetry {
+			reason := err.Error()
+			js.recordScan(ctx, file.RequestID, key, scan.StatusError, &reason)
+		}
+		return fmt.Errorf("failed to scan %s: %w", key, err)
+	}
+
+	if !result.Infected {
+		js.recordScan(ctx, file.RequestID, key, scan.StatusClean, nil)
+		return nil
+	}
+
+	if err := js.quarantine(ctx, key); err != nil {
+		return fmt.Errorf("failed to quarantine %s: %w", key, err)
+	}
+	js.recordScan(ctx, file.RequestID, key, scan.StatusInfected, &result.Signature)
+	js.logger(ctx).Warn("Infected file quarantined", zap.String("key", key), zap.String("signature", result.Signature))
+	return nil
+}
+
+func (js *JobServer) scanFile(ctx context.Context, key string) (scan.Result, error) {
+	scanner, err := scan.NewFromEnv()
+	if err != nil {
+		return scan.Result{}, err
+	}
+	if scanner == nil {
+		return scan.Result{}, fmt.Errorf("no scanner configured")
+	}
+
+	stor, err := storage.NewFromEnv()
+	if err != nil {
+		return scan.Result{}, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	content, err := stor.Get(ctx, key)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	defer content.Close()
+	return scanner.Scan(ctx, content)
+}
+
+// quarantine moves an object under scan.QuarantinePrefix, out of reach of
+// its download URL
+func (js *JobServer) quarantine(ctx context.Context, key string) error {
+	stor, err := storage.NewFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	content, err := stor.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if err := stor.Put(ctx, scan.QuarantinePrefix+key, content); err != nil {
+		return err
+	}
+	return stor.Delete(ctx, key)
+}
+
+// recordScan stores a scan outcome and notifies the owning request's
+// subscribers
+func (js *JobServer) recordScan(ctx context.Context, requestID *string, key, status string, result *string) {
+	if err := js.db.Queries.SetFileScanResult(ctx, key, status, result); err != nil {
+		js.logger(ctx).Error("Failed to record scan result", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if requestID == nil {
+		return
+	}
+	data := events.FileScanned{RequestID: *requestID, Key: key, ScanStatus: status}
+	if result != nil {
+		data.ScanResult = *result
+	}
+	_ = js.bus.PublishRequest(*requestID, events.New(ctx, data))
+}
+
+func EnqueueFileScan(ctx context.Context, client Enqueuer, key string) error {
+	task, err := newPayloadTask(ctx, "file:scan", &FileScanPayload{Key: key})
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
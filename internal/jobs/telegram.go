@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pxbox/internal/model"
+	"pxbox/internal/telegram"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// SetTelegramBot sends notifications to the linked Telegram chats of
+// entities on the telegram channel. It must be called before Start.
+func (js *JobServer) SetTelegramBot(bot *telegram.Bot) {
+	js.SetNotifier(model.ChannelTelegram, func(ctx context.Context, entityID string, event map[string]interface{}) error {
+		return js.sendTelegram(ctx, bot, entityID, event)
+	})
+}
+
+// sendTelegram sends an event about a request to the linked chat of an
+// entity. While the request is pending and its schema is a single boolean
+// or enum, the message gets a button per answer. Chats Telegram no longer
+// delivers to are unlinked.
+func (js *JobServer) sendTelegram(ctx context.Context, bot *telegram.Bot, entityID string, event map[string]interface{}) error {
+	eventType, _ := event["type"].(string)
+	texts, ok := notificationTexts[eventType]
+	requestID := eventRequestID(event)
+	if !ok || requestID == "" || event["sandbox"] == true {
+		return nil
+	}
+
+	chat, err := js.db.Queries.GetTelegramChat(ctx, entityID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && chat.ChatID == nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Telegram chat: %w", err)
+	}
+
+	text := texts[0] + ": " + fmt.Sprintf(texts[1], js.requestTitle(ctx, requestID))
+	var buttons []telegram.Button
+	if req, err := js.db.Queries.GetRequestByID(ctx, requestID); err == nil {
+		if description, _ := req.SchemaPayload["description"].(string); description != "" {
+			text += "\n\n" + description
+		}
+		if req.Status == string(model.StatusPending) && model.SchemaKind(req.SchemaKind) == model.SchemaKindJSON {
+			if _, choices, ok := telegram.Choices(req.SchemaPayload); ok {
+				for i, c := range choices {
+					buttons = append(buttons, telegram.Button{Text: c.Label, Data: telegram.AnswerData(requestID, i)})
+				}
+			}
+		}
+	}
+
+	err = bot.SendMessage(ctx, *chat.ChatID, text, buttons)
+	if errors.Is(err, telegram.ErrChatUnavailable) {
+		if err := js.db.Queries.UnlinkTelegramChatID(ctx, *chat.ChatID); err != nil {
+			js.logger(ctx).Warn("Failed to unlink Telegram chat", zap.String("entity_id", entityID), zap.Error(err))
+		} else {
+			js.logger(ctx).Info("Unlinked unavailable Telegram chat", zap.String("entity_id", entityID))
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/preview"
+	"pxbox/internal/scan"
+	"pxbox/internal/storage"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+// ThumbnailJob asks for a preview of one file attached to a response
+type ThumbnailJob struct {
+	PayloadMeta
+	ResponseID string `json:"responseId"`
+	RequestID  string `json:"requestId"`
+	URL        string `json:"url"`
+	MIME       string `json:"mime"`
+}
+
+// PreviewName returns the storage object holding the preview of an object
+func PreviewName(objectName string) string {
+	return "previews/" + objectName + ".jpg"
+}
+
+// handleThumbnail renders a preview of a response file, stores it next to
+// the original and records its URL as previewUrl in the response's files
+func (js *JobServer) handleThumbnail(ctx context.Context, t *asynq.Task) error {
+	var job ThumbnailJob
+	if err := decodePayload(t, &job); err != nil {
+		return err
+	}
+
+	gen := preview.NewGeneratorFromEnv()
+	if !gen.Supports(job.MIME) {
+		return nil
+	}
+
+	stor, err := storage.NewFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	resolver, ok := stor.(storage.URLResolver)
+	if !ok {
+		return nil
+	}
+	key, ok := resolver.ObjectName(job.URL)
+	if !ok {
+		return nil // Hosted elsewhere
+	}
+
+	// Never open content the scanner flagged
+	file, err := js.db.Queries.GetFileByKey(ctx, key)
+	if err == nil && file.ScanStatus == scan.StatusInfected {
+		return nil
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+
+	content, err := stor.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	thumb, err := gen.Generate(ctx, content, job.MIME)
+	content.Close()
+	if err != nil {
+		// Broken or oversized files will not get better on retry
+		js.logger(ctx).Warn("Failed to generate preview", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+
+	previewKey := PreviewName(key)
+	if err := stor.Put(ctx, previewKey, bytes.NewReader(thumb)); err != nil {
+		return fmt.Errorf("failed to store preview: %w", err)
+	}
+	if err := js.recordPreview(ctx, job.ResponseID, previewKey, thumb); err != nil {
+		return err
+	}
+
+	previewURL, err := stor.PresignGet(ctx, previewKey, 24*time.Hour)
+	if err != nil {
+		return fmt.Errorf("failed to presign preview: %w", err)
+	}
+	if err := js.db.Queries.SetResponseFilePreview(ctx, job.ResponseID, job.URL, previewURL); err != nil {
+		return fmt.Errorf("failed to record preview: %w", err)
+	}
+
+	_ = js.bus.PublishRequest(job.RequestID, events.New(ctx, events.FilePreviewed{
+		RequestID:  job.RequestID,
+		ResponseID: job.ResponseID,
+		URL:        job.URL,
+		PreviewURL: previewURL,
+	}))
+	return nil
+}
+
+// recordPreview adds the preview to the files table so the file proxy
+// serves it, kept for as long as the response exists
+func (js *JobServer) recordPreview(ctx context.Context, responseID, key string, content []byte) error {
+	expiresAt := time.Now().Add(time.Hour)
+	_, err := js.db.Queries.CreatePendingFile(ctx, db.CreateFileParams{
+		ID:        ulid.Make().String(),
+		ObjectKey: key,
+		Name:      key,
+		MIME:      preview.ContentType,
+		ExpiresAt: &expiresAt,
+	})
+	// No row is returned if an earlier attempt already completed it
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to record preview: %w", err)
+	}
+	if err == nil {
+		sum := sha256.Sum256(content)
+		_, err = js.db.Queries.CompleteFileUpload(ctx, key, preview.ContentType, int64(len(content)), hex.EncodeToString(sum[:]), scan.StatusNone)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to record preview: %w", err)
+		}
+	}
+
+	if err := js.db.Queries.AttachFilesToResponse(ctx, responseID, []string{key}); err != nil {
+		return fmt.Errorf("failed to attach preview: %w", err)
+	}
+	return nil
+}
+
+func EnqueueThumbnail(ctx context.Context, client Enqueuer, job ThumbnailJob) error {
+	task, err := newPayloadTask(ctx, "file:thumbnail", &job)
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// defaultTaskTimeout bounds a run of task types without their own timeout.
+// Most jobs change a few rows or make one HTTP call.
+const defaultTaskTimeout = 2 * time.Minute
+
+// taskTimeouts bound single runs of the task types that take longer:
+// exports stream every matching request, erasures and digests touch many
+// rows, and scans and thumbnails read whole files
+var taskTimeouts = map[string]time.Duration{
+	"export:requests": 30 * time.Minute,
+	"entity:erase":    10 * time.Minute,
+	"digest:send":     5 * time.Minute,
+	"file:scan":       10 * time.Minute,
+	"file:thumbnail":  5 * time.Minute,
+}
+
+// TimeoutFor returns how long a single run of a task type may take
+func TimeoutFor(taskType string) time.Duration {
+	if d, ok := taskTimeouts[taskType]; ok {
+		return d
+	}
+	return defaultTaskTimeout
+}
+
+// boundContext gives each run of a job a deadline, so that its database
+// statements and HTTP calls cannot outlive it. A timed out run fails and is
+// retried like any other failure.
+func boundContext(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutFor(t.Type()))
+		defer cancel()
+		return next.ProcessTask(ctx, t)
+	})
+}
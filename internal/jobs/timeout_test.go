@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundContext(t *testing.T) {
+	for taskType, want := range map[string]time.Duration{
+		"export:requests": 30 * time.Minute,
+		"deadline:notify": defaultTaskTimeout,
+	} {
+		var deadline time.Time
+		h := boundContext(asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+			var ok bool
+			deadline, ok = ctx.Deadline()
+			require.True(t, ok)
+			return nil
+		}))
+		require.NoError(t, h.ProcessTask(context.Background(), asynq.NewTask(taskType, nil)))
+		assert.WithinDuration(t, time.Now().Add(want), deadline, time.Second, taskType)
+	}
+}
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pxbox/internal/pubsub"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Headers of webhook deliveries, besides CallbackSignatureHeader
+const (
+	// WebhookPreviousSignatureHeader carries the signature under the
+	// previous secret while a rotated-out secret is still valid
+	WebhookPreviousSignatureHeader = "X-PxBox-Signature-Previous"
+	WebhookIDHeader                = "X-PxBox-Webhook"
+	WebhookDeliveryHeader          = "X-PxBox-Delivery" // Same on every attempt, for deduplication
+	WebhookEventHeader             = "X-PxBox-Event"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "PENDING"
+	WebhookDelivered = "DELIVERED"
+	WebhookFailed    = "FAILED" // Retries exhausted; the task is in the dead-letter queue
+)
+
+// handleWebhookDelivery posts a recorded event to its webhook and records
+// the attempt. Deliveries of deleted webhooks are dropped; deliveries of
+// paused ones are left pending.
+func (js *JobServer) handleWebhookDelivery(ctx context.Context, t *asynq.Task) error {
+	var p WebhookPayload
+	if err := decodePayload(t, &p); err != nil {
+		return err
+	}
+
+	d, err := js.db.Queries.GetWebhookDelivery(ctx, p.DeliveryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	hook, err := js.db.Queries.GetWebhook(ctx, d.WebhookID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if !hook.Active {
+		return nil
+	}
+
+	// CloudEvents are identified by the delivery, so a receiver sees the
+	// same ID on every attempt
+	contentType := "application/json"
+	event := d.Event
+	if format := js.bus.EventFormat(); format.CloudEvents {
+		contentType = pubsub.CloudEventsContentType
+		event = format.Encode(hook.Channel, event, d.ID, d.CreatedAt)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %v: %w", err, asynq.SkipRetry)
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set(WebhookIDHeader, hook.ID)
+	httpReq.Header.Set(WebhookDeliveryHeader, d.ID)
+	httpReq.Header.Set(WebhookEventHeader, d.EventType)
+	httpReq.Header.Set(CallbackSignatureHeader, signBody(hook.Secret, body))
+	if hook.PreviousSecret != nil && hook.PreviousSecretExpiresAt != nil && hook.PreviousSecretExpiresAt.After(time.Now()) {
+		httpReq.Header.Set(WebhookPreviousSignatureHeader, signBody(*hook.PreviousSecret, body))
+	}
+
+	var status *int
+	httpResp, err := js.httpClient.Do(httpReq)
+	if err == nil {
+		httpResp.Body.Close()
+		status = &httpResp.StatusCode
+		if httpResp.StatusCode >= 300 {
+			err = fmt.Errorf("webhook returned %s", httpResp.Status)
+		}
+	}
+
+	if err == nil {
+		if recErr := js.db.Queries.RecordWebhookAttempt(ctx, d.ID, WebhookDelivered, status, nil); recErr != nil {
+			js.logger(ctx).Warn("Failed to record webhook delivery", zap.String("delivery_id", d.ID), zap.Error(recErr))
+		}
+		js.logger(ctx).Info("Webhook delivered",
+			zap.String("webhook_id", hook.ID),
+			zap.String("delivery_id", d.ID),
+			zap.Int("status", *status),
+		)
+		return nil
+	}
+
+	// The last attempt marks the delivery failed; a retry from the
+	// dead-letter queue sets it back
+	next := WebhookPending
+	if task := currentTask(ctx); task.Retried >= task.MaxRetry {
+		next = WebhookFailed
+	}
+	msg := err.Error()
+	if recErr := js.db.Queries.RecordWebhookAttempt(ctx, d.ID, next, status, &msg); recErr != nil {
+		js.logger(ctx).Warn("Failed to record webhook delivery", zap.String("delivery_id", d.ID), zap.Error(recErr))
+	}
+	return fmt.Errorf("webhook delivery failed: %w", err)
+}
+
+// signBody returns the hex HMAC-SHA256 of body keyed by secret
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EnqueueWebhookDelivery enqueues posting a recorded delivery to its
+// webhook
+func EnqueueWebhookDelivery(ctx context.Context, client Enqueuer, deliveryID string) error {
+	task, err := newPayloadTask(ctx, "webhook:deliver", &WebhookPayload{DeliveryID: deliveryID})
+	if err != nil {
+		return err
+	}
+	_, err = client.Enqueue(task)
+	return err
+}
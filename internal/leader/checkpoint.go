@@ -0,0 +1,119 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// Checkpoint keeps the progress of a singleton task in Redis or Postgres,
+// so the next leader can continue a run that was interrupted. Progress is
+// stored as JSON and expires after ttl, so a checkpoint left by an
+// abandoned run does not stay around forever.
+type Checkpoint struct {
+	store checkpointStore
+	key   string
+	ttl   time.Duration
+}
+
+// checkpointStore keeps the JSON progress of tasks by key
+type checkpointStore interface {
+	// load reports false if key has no unexpired progress
+	load(ctx context.Context, key string) ([]byte, bool, error)
+	save(ctx context.Context, key string, b []byte, ttl time.Duration) error
+	clear(ctx context.Context, key string) error
+}
+
+// NewCheckpoint creates a checkpoint in Redis for the task named key
+func NewCheckpoint(rdb *redis.Client, key string, ttl time.Duration) *Checkpoint {
+	return &Checkpoint{
+		store: redisCheckpoints{rdb: rdb},
+		key:   "checkpoint:" + key,
+		ttl:   ttl,
+	}
+}
+
+// NewPostgresCheckpoint creates a checkpoint in the checkpoints table for
+// the task named key, for deployments without Redis
+func NewPostgresCheckpoint(queries *db.Queries, key string, ttl time.Duration) *Checkpoint {
+	return &Checkpoint{
+		store: pgCheckpoints{queries: queries},
+		key:   "checkpoint:" + key,
+		ttl:   ttl,
+	}
+}
+
+// Load decodes the saved progress into v. It reports false if there is none.
+func (c *Checkpoint) Load(ctx context.Context, v interface{}) (bool, error) {
+	b, ok, err := c.store.load(ctx, c.key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// Save replaces the saved progress with v
+func (c *Checkpoint) Save(ctx context.Context, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.store.save(ctx, c.key, b, c.ttl)
+}
+
+// Clear removes the saved progress once the task has finished
+func (c *Checkpoint) Clear(ctx context.Context) error {
+	return c.store.clear(ctx, c.key)
+}
+
+type redisCheckpoints struct {
+	rdb *redis.Client
+}
+
+func (r redisCheckpoints) load(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := r.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (r redisCheckpoints) save(ctx context.Context, key string, b []byte, ttl time.Duration) error {
+	return r.rdb.Set(ctx, key, b, ttl).Err()
+}
+
+func (r redisCheckpoints) clear(ctx context.Context, key string) error {
+	return r.rdb.Del(ctx, key).Err()
+}
+
+type pgCheckpoints struct {
+	queries *db.Queries
+}
+
+func (p pgCheckpoints) load(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := p.queries.GetCheckpoint(ctx, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (p pgCheckpoints) save(ctx context.Context, key string, b []byte, ttl time.Duration) error {
+	return p.queries.SaveCheckpoint(ctx, key, b, time.Now().Add(ttl))
+}
+
+func (p pgCheckpoints) clear(ctx context.Context, key string) error {
+	return p.queries.DeleteCheckpoint(ctx, key)
+}
@@ -0,0 +1,163 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// renewScript extends the lease only if it is still held by this instance
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease only if it is still held by this instance
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Elector implements leader election on top of a lease so that exactly one
+// instance runs a singleton task at a time. The lease is a Redis key
+// (NewElector) or a Postgres advisory lock (NewPostgresElector).
+type Elector struct {
+	lease lease
+	key   string
+	id    string
+	ttl   time.Duration
+	log   *zap.Logger
+}
+
+// lease is what an Elector campaigns for. renew reports false once the
+// lease is no longer held by this instance.
+type lease interface {
+	acquire(ctx context.Context) (bool, error)
+	renew(ctx context.Context) (bool, error)
+	release(ctx context.Context) error
+}
+
+// NewElector creates a new elector campaigning for key under the given
+// instance id. The lease expires after ttl unless renewed.
+func NewElector(rdb *redis.Client, key, id string, ttl time.Duration, log *zap.Logger) *Elector {
+	key = "leader:" + key
+	return &Elector{
+		lease: &redisLease{rdb: rdb, key: key, id: id, ttl: ttl},
+		key:   key,
+		id:    id,
+		ttl:   ttl,
+		log:   log,
+	}
+}
+
+// Run campaigns for leadership until ctx is cancelled. Whenever this instance
+// holds the lease, fn is called with a context that is cancelled as soon as
+// leadership is lost. Run waits for fn to return before campaigning again.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) {
+	retry := e.ttl / 3
+	for {
+		acquired, err := e.lease.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.log.Warn("Leader election failed", zap.String("key", e.key), zap.Error(err))
+		}
+
+		if acquired {
+			e.log.Info("Acquired leadership", zap.String("key", e.key), zap.String("id", e.id))
+			e.lead(ctx, fn)
+			e.log.Info("Lost leadership", zap.String("key", e.key), zap.String("id", e.id))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// TryLead runs fn once if this instance can take the lease right away, for
+// tasks that should run once per start rather than continuously. It reports
+// false without calling fn when another instance holds the lease.
+func (e *Elector) TryLead(ctx context.Context, fn func(ctx context.Context)) (bool, error) {
+	acquired, err := e.lease.acquire(ctx)
+	if err != nil || !acquired {
+		return false, err
+	}
+	e.lead(ctx, fn)
+	return true, nil
+}
+
+// lead runs fn while renewing the lease, and releases the lease afterwards
+func (e *Elector) lead(ctx context.Context, fn func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Give up the lease as soon as fn is done
+		defer cancel()
+		fn(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+renew:
+	for {
+		select {
+		case <-leaderCtx.Done():
+			break renew
+		case <-ticker.C:
+			ok, err := e.lease.renew(leaderCtx)
+			if err != nil || !ok {
+				if err != nil && leaderCtx.Err() == nil {
+					e.log.Warn("Failed to renew leadership", zap.String("key", e.key), zap.Error(err))
+				}
+				break renew
+			}
+		}
+	}
+
+	cancel()
+	wg.Wait()
+
+	// Release with a fresh context since ctx may already be cancelled
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer releaseCancel()
+	if err := e.lease.release(releaseCtx); err != nil {
+		e.log.Warn("Failed to release leadership", zap.String("key", e.key), zap.Error(err))
+	}
+}
+
+// redisLease is a key set to the instance id that expires after ttl
+type redisLease struct {
+	rdb *redis.Client
+	key string
+	id  string
+	ttl time.Duration
+}
+
+func (l *redisLease) acquire(ctx context.Context) (bool, error) {
+	return l.rdb.SetNX(ctx, l.key, l.id, l.ttl).Result()
+}
+
+func (l *redisLease) renew(ctx context.Context) (bool, error) {
+	ok, err := renewScript.Run(ctx, l.rdb, []string{l.key}, l.id, l.ttl.Milliseconds()).Int()
+	return ok != 0, err
+}
+
+func (l *redisLease) release(ctx context.Context) error {
+	if err := releaseScript.Run(ctx, l.rdb, []string{l.key}, l.id).Err(); err != nil && err != redis.Nil {
+		return err
+	}
+	return nil
+}
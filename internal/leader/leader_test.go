@@ -0,0 +1,175 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func TestRedisLease(t *testing.T) {
+	mr, rdb := newRedis(t)
+	ctx := context.Background()
+	a := &redisLease{rdb: rdb, key: "leader:task", id: "a", ttl: time.Minute}
+	b := &redisLease{rdb: rdb, key: "leader:task", id: "b", ttl: time.Minute}
+
+	ok, err := a.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, mr.TTL("leader:task"))
+	ok, err = b.acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Renewing restores the full lease
+	mr.FastForward(40 * time.Second)
+	ok, err = a.renew(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, mr.TTL("leader:task"))
+	ok, err = b.renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Only the holder releases it
+	require.NoError(t, b.release(ctx))
+	assert.True(t, mr.Exists("leader:task"))
+	require.NoError(t, a.release(ctx))
+	assert.False(t, mr.Exists("leader:task"))
+
+	// A lapsed lease is lost and taken by the next instance
+	ok, err = a.acquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	mr.FastForward(2 * time.Minute)
+	ok, err = b.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = a.renew(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTryLead(t *testing.T) {
+	mr, rdb := newRedis(t)
+	ctx := context.Background()
+	e := NewElector(rdb, "task", "a", time.Minute, zap.NewNop())
+
+	ran := false
+	led, err := e.TryLead(ctx, func(ctx context.Context) {
+		ran = true
+		got, _ := mr.Get("leader:task")
+		assert.Equal(t, "a", got)
+	})
+	require.NoError(t, err)
+	assert.True(t, led)
+	assert.True(t, ran)
+	assert.False(t, mr.Exists("leader:task"), "lease released once fn returns")
+
+	require.NoError(t, mr.Set("leader:task", "b"))
+	led, err = e.TryLead(ctx, func(ctx context.Context) { t.Error("ran without the lease") })
+	require.NoError(t, err)
+	assert.False(t, led)
+	got, _ := mr.Get("leader:task")
+	assert.Equal(t, "b", got)
+}
+
+func TestLeadershipLost(t *testing.T) {
+	mr, rdb := newRedis(t)
+	e := NewElector(rdb, "task", "a", 30*time.Millisecond, zap.NewNop())
+
+	stopped := make(chan struct{})
+	led, err := e.TryLead(context.Background(), func(ctx context.Context) {
+		// Another instance took the lease; the next renewal notices
+		assert.NoError(t, mr.Set("leader:task", "b"))
+		select {
+		case <-ctx.Done():
+			close(stopped)
+		case <-time.After(time.Second):
+		}
+	})
+	require.NoError(t, err)
+	assert.True(t, led)
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("leader context not cancelled after losing the lease")
+	}
+	got, _ := mr.Get("leader:task")
+	assert.Equal(t, "b", got, "the new holder's lease is kept")
+}
+
+func TestRun(t *testing.T) {
+	_, rdb := newRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	a := NewElector(rdb, "task", "a", 30*time.Millisecond, zap.NewNop())
+	b := NewElector(rdb, "task", "b", 30*time.Millisecond, zap.NewNop())
+
+	leaders := make(chan string, 2)
+	lead := func(id string) func(context.Context) {
+		return func(ctx context.Context) {
+			leaders <- id
+			<-ctx.Done()
+		}
+	}
+	done := make(chan struct{}, 2)
+	go func() { a.Run(ctx, lead("a")); done <- struct{}{} }()
+	first := <-leaders
+	go func() { b.Run(ctx, lead("b")); done <- struct{}{} }()
+
+	// The follower keeps waiting while the leader renews its lease
+	select {
+	case id := <-leaders:
+		t.Fatalf("%s led while %s held the lease", id, first)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	<-done
+	<-done
+}
+
+func TestCheckpoint(t *testing.T) {
+	mr, rdb := newRedis(t)
+	ctx := context.Background()
+	c := NewCheckpoint(rdb, "task", time.Hour)
+
+	type progress struct {
+		After string `json:"after"`
+		Done  int    `json:"done"`
+	}
+	var got progress
+	ok, err := c.Load(ctx, &got)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Save(ctx, progress{After: "flow-9", Done: 9}))
+	assert.Equal(t, time.Hour, mr.TTL("checkpoint:task"))
+	ok, err = c.Load(ctx, &got)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, progress{After: "flow-9", Done: 9}, got)
+
+	require.NoError(t, c.Clear(ctx))
+	ok, err = c.Load(ctx, &got)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Abandoned progress expires
+	require.NoError(t, c.Save(ctx, progress{Done: 1}))
+	mr.FastForward(2 * time.Hour)
+	ok, err = c.Load(ctx, &got)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,91 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// lockConn is the database session a Postgres lease holds its lock on
+type lockConn interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Ping(ctx context.Context) error
+	Release()
+}
+
+// NewPostgresElector creates an elector whose lease is a session advisory
+// lock taken with pg_try_advisory_lock, for deployments without Redis. The
+// lock is taken on a connection of pool, which is then taken out of the
+// pool and held for as long as this instance leads; Postgres drops the lock
+// when that session ends, so a crashed leader never blocks the others. ttl
+// only sets how often the session is checked and how often followers retry.
+func NewPostgresElector(pool *pgxpool.Pool, key, id string, ttl time.Duration, log *zap.Logger) *Elector {
+	key = "leader:" + key
+	return &Elector{
+		lease: &pgLease{
+			connect: func(ctx context.Context) (lockConn, error) { return pool.Acquire(ctx) },
+			key:     key,
+		},
+		key: key,
+		id:  id,
+		ttl: ttl,
+		log: log,
+	}
+}
+
+// pgLease is a session advisory lock. Leader keys are locked in the two
+// key space, so they never collide with the single key locks of flows and
+// migrations.
+type pgLease struct {
+	connect func(ctx context.Context) (lockConn, error)
+	key     string
+	conn    lockConn // Holds the lock while leading
+}
+
+func (l *pgLease) acquire(ctx context.Context) (bool, error) {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext('leader'), hashtext($1))`, l.key).Scan(&ok); err != nil || !ok {
+		conn.Release()
+		return false, err
+	}
+	// A leader holds its connection for long, so it leaves the pool rather
+	// than take a slot from queries
+	if pooled, ok := conn.(interface{ Hijack() *pgx.Conn }); ok {
+		conn = ownConn{pooled.Hijack()}
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// renew checks that the session holding the lock is still alive
+func (l *pgLease) renew(ctx context.Context) (bool, error) {
+	if err := l.conn.Ping(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// release unlocks and closes the connection, which would also end the lock
+func (l *pgLease) release(ctx context.Context) error {
+	conn := l.conn
+	l.conn = nil
+	defer conn.Release()
+	var unlocked bool
+	return conn.QueryRow(ctx, `SELECT pg_advisory_unlock(hashtext('leader'), hashtext($1))`, l.key).Scan(&unlocked)
+}
+
+// ownConn is a connection taken out of the pool; releasing closes it
+type ownConn struct {
+	*pgx.Conn
+}
+
+func (c ownConn) Release() {
+	c.Close(context.Background())
+}
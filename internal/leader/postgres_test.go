@@ -0,0 +1,116 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// advisoryLocks stands in for the advisory locks of a Postgres server
+type advisoryLocks struct {
+	held map[string]*fakeConn
+}
+
+// fakeConn is a session of advisoryLocks
+type fakeConn struct {
+	locks    *advisoryLocks
+	dead     bool
+	released bool
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	key := args[0].(string)
+	switch {
+	case c.dead:
+		return fakeRow{err: errors.New("connection closed")}
+	case sql == `SELECT pg_try_advisory_lock(hashtext('leader'), hashtext($1))`:
+		holder, ok := c.locks.held[key]
+		if ok && holder != c {
+			return fakeRow{value: false}
+		}
+		c.locks.held[key] = c
+		return fakeRow{value: true}
+	case sql == `SELECT pg_advisory_unlock(hashtext('leader'), hashtext($1))`:
+		if c.locks.held[key] != c {
+			return fakeRow{value: false}
+		}
+		delete(c.locks.held, key)
+		return fakeRow{value: true}
+	}
+	return fakeRow{err: errors.New("unexpected query " + sql)}
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.dead {
+		return errors.New("connection closed")
+	}
+	return nil
+}
+
+func (c *fakeConn) Release() {
+	c.released = true
+}
+
+type fakeRow struct {
+	value bool
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*bool) = r.value
+	return nil
+}
+
+func TestPostgresLease(t *testing.T) {
+	locks := &advisoryLocks{held: map[string]*fakeConn{}}
+	var conns []*fakeConn
+	connect := func(ctx context.Context) (lockConn, error) {
+		conn := &fakeConn{locks: locks}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	ctx := context.Background()
+	a := &pgLease{connect: connect, key: "leader:task"}
+	b := &pgLease{connect: connect, key: "leader:task"}
+
+	ok, err := a.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, conns[0].released, "the session holding the lock is kept")
+
+	ok, err = b.acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, conns[1].released)
+
+	ok, err = a.renew(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, a.release(ctx))
+	assert.True(t, conns[0].released)
+	assert.Empty(t, locks.held)
+
+	// Losing the session loses the lease
+	ok, err = b.acquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	conns[2].dead = true
+	delete(locks.held, "leader:task")
+	ok, err = b.renew(ctx)
+	assert.Error(t, err)
+	assert.False(t, ok)
+	assert.Error(t, b.release(ctx))
+	assert.True(t, conns[2].released)
+
+	ok, err = a.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
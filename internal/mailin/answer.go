@@ -0,0 +1,150 @@
+package mailin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNotSimple is returned for schemas whose answers cannot be written as
+// an email: anything but an object of strings, numbers, booleans and enums
+var ErrNotSimple = errors.New("the request needs the full answer form")
+
+// quoteHeader matches the line mail clients put above a quoted message,
+// e.g. "On Mon, 3 Feb 2025 at 10:00, Ada <ada@example.com> wrote:"
+var quoteHeader = regexp.MustCompile(`(?i)^(on\b.*\bwrote:|-+ ?original message ?-+|-+ ?forwarded message ?-+|_{10,})$`)
+
+// Reply returns the text a reply adds: the lines above the quoted message
+// and the signature
+func Reply(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var kept []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") || quoteHeader.MatchString(trimmed) || line == "-- " || trimmed == "--" {
+			break
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// Answers extracts the answer to a schema from the text of a reply. Each
+// "key: value" line sets the property named key, or titled key, ignoring
+// case; values are converted to the property's type. A reply without such
+// lines is the value of the schema's only property.
+func Answers(schema map[string]interface{}, text string) (map[string]interface{}, error) {
+	if t, set := schema["type"]; set && t != "object" {
+		return nil, ErrNotSimple
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) == 0 {
+		return nil, ErrNotSimple
+	}
+	byKey := map[string]string{}
+	for name, p := range properties {
+		property, _ := p.(map[string]interface{})
+		if !scalar(property) {
+			return nil, ErrNotSimple
+		}
+		byKey[strings.ToLower(name)] = name
+		if title, _ := property["title"].(string); title != "" {
+			byKey[strings.ToLower(title)] = name
+		}
+	}
+
+	answers := map[string]interface{}{}
+	for _, line := range strings.Split(text, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name, ok := byKey[strings.ToLower(strings.TrimSpace(key))]
+		if !ok {
+			continue
+		}
+		v, err := convert(properties[name].(map[string]interface{}), strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		answers[name] = v
+	}
+	if len(answers) > 0 {
+		return answers, nil
+	}
+
+	if len(properties) == 1 && text != "" {
+		for name, p := range properties {
+			property := p.(map[string]interface{})
+			value := text
+			if property["type"] != "string" || property["enum"] != nil {
+				// Only strings are free text; other values are one line
+				value = strings.TrimSpace(strings.SplitN(text, "\n", 2)[0])
+			}
+			v, err := convert(property, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return map[string]interface{}{name: v}, nil
+		}
+	}
+	return nil, errors.New(`no answer found; write one "field: value" line per field`)
+}
+
+// scalar reports whether a property takes a string, number, boolean or one
+// of an enum of them
+func scalar(property map[string]interface{}) bool {
+	if enum, ok := property["enum"].([]interface{}); ok {
+		for _, v := range enum {
+			switch v.(type) {
+			case string, float64, bool:
+			default:
+				return false
+			}
+		}
+		return len(enum) > 0
+	}
+	switch property["type"] {
+	case "string", "number", "integer", "boolean":
+		return true
+	}
+	return false
+}
+
+// convert parses a value written in an email as the type of property
+func convert(property map[string]interface{}, value string) (interface{}, error) {
+	if enum, ok := property["enum"].([]interface{}); ok {
+		for _, v := range enum {
+			if strings.EqualFold(fmt.Sprint(v), value) {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of the choices", value)
+	}
+	switch property["type"] {
+	case "boolean":
+		switch strings.ToLower(value) {
+		case "yes", "y", "true", "1":
+			return true, nil
+		case "no", "n", "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not yes or no", value)
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", value)
+		}
+		// As decoded from JSON
+		return float64(n), nil
+	case "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+// Package mailin turns inbound email into answers: it issues the signed
+// reply addresses of requests, receives email from Amazon SES and Mailgun,
+// and extracts answers from the text of a reply
+package mailin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"net/mail"
+	"os"
+	"strings"
+)
+
+const (
+	// localPrefix starts the local part of reply addresses
+	localPrefix = "reply+"
+	// signatureLen is the length of the address signature, 80 bits
+	signatureLen = 16
+)
+
+var signatureEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Addresser issues reply addresses for requests, reply+<id>.<signature>@
+// <domain>. The signature makes them unguessable, so an email to one is
+// trusted to come from the request's entity.
+type Addresser struct {
+	secret []byte
+	domain string
+}
+
+// NewAddresser creates an addresser signing with secret for addresses at
+// domain
+func NewAddresser(secret, domain string) *Addresser {
+	return &Addresser{secret: []byte(secret), domain: strings.ToLower(strings.TrimPrefix(domain, "@"))}
+}
+
+// FromEnv creates an addresser from EMAIL_REPLY_DOMAIN and
+// EMAIL_REPLY_SECRET. It returns nil unless both are set.
+func FromEnv() *Addresser {
+	secret, domain := os.Getenv("EMAIL_REPLY_SECRET"), os.Getenv("EMAIL_REPLY_DOMAIN")
+	if secret == "" || domain == "" {
+		return nil
+	}
+	return NewAddresser(secret, domain)
+}
+
+// Address returns the reply address of a request
+func (a *Addresser) Address(requestID string) string {
+	return localPrefix + strings.ToLower(requestID) + "." + a.sign(requestID) + "@" + a.domain
+}
+
+// RequestID returns the request of a reply address, which may carry a
+// display name. Addresses at other domains or with a wrong signature are
+// not reply addresses.
+func (a *Addresser) RequestID(address string) (string, bool) {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 || !strings.EqualFold(address[at+1:], a.domain) {
+		return "", false
+	}
+	local := strings.ToLower(address[:at])
+	if !strings.HasPrefix(local, localPrefix) {
+		return "", false
+	}
+	local = local[len(localPrefix):]
+	dot := strings.LastIndexByte(local, '.')
+	if dot <= 0 {
+		return "", false
+	}
+	// Request IDs are upper case ULIDs; mail servers may fold the case of
+	// the local part
+	requestID := strings.ToUpper(local[:dot])
+	if !hmac.Equal([]byte(local[dot+1:]), []byte(a.sign(requestID))) {
+		return "", false
+	}
+	return requestID, true
+}
+
+func (a *Addresser) sign(requestID string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte("reply:" + strings.ToUpper(requestID)))
+	return strings.ToLower(signatureEncoding.EncodeToString(mac.Sum(nil)))[:signatureLen]
+}
+
+// Message is an inbound email
+type Message struct {
+	From       string
+	Recipients []string // To and Cc, or the envelope recipients
+	Subject    string
+	Text       string // The text/plain body
+	Raw        []byte // The whole message, RFC 5322
+}
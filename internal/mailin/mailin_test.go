@@ -0,0 +1,200 @@
+package mailin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const requestID = "01JABCDEFGHJKMNPQRSTVWXYZ0"
+
+func TestAddress(t *testing.T) {
+	a := NewAddresser("s3cret", "@Reply.Example.com")
+	address := a.Address(requestID)
+	assert.True(t, strings.HasPrefix(address, "reply+01jabcdefghjkmnpqrstvwxyz0."))
+	assert.True(t, strings.HasSuffix(address, "@reply.example.com"))
+
+	for _, in := range []string{address, strings.ToUpper(address), `"Requests" <` + address + `>`} {
+		id, ok := a.RequestID(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, requestID, id)
+	}
+
+	local := strings.TrimSuffix(address, "@reply.example.com")
+	for _, in := range []string{
+		local + "@other.example.com",
+		strings.Replace(address, "01jabc", "01jabd", 1),
+		"reply+" + strings.ToLower(requestID) + "@reply.example.com",
+		"ada@reply.example.com",
+	} {
+		_, ok := a.RequestID(in)
+		assert.False(t, ok, in)
+	}
+	_, ok := NewAddresser("other", "reply.example.com").RequestID(address)
+	assert.False(t, ok)
+}
+
+const multipartEmail = "From: Ada <ada@example.com>\r\n" +
+	"To: reply+abc.def@reply.example.com\r\n" +
+	"Cc: bob@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Re:_Approve_=E2=9C=93?=\r\n" +
+	"Content-Type: multipart/alternative; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>yes</p>\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"approved: yes=\r\n" +
+	"\r\n" +
+	"note: caf=C3=A9\r\n" +
+	"--b1--\r\n"
+
+func TestParse(t *testing.T) {
+	msg, err := Parse([]byte(multipartEmail))
+	require.NoError(t, err)
+	assert.Equal(t, "Ada <ada@example.com>", msg.From)
+	assert.Equal(t, "Re: Approve ✓", msg.Subject)
+	assert.Equal(t, []string{"reply+abc.def@reply.example.com", "bob@example.com"}, msg.Recipients)
+	assert.Equal(t, "approved: yes\nnote: café", msg.Text)
+
+	_, err = Parse([]byte("Subject: hi\r\nContent-Type: text/html\r\n\r\n<p>hi</p>"))
+	assert.ErrorIs(t, err, ErrNoText)
+}
+
+func TestReply(t *testing.T) {
+	text := "approved: yes\n\n-- \nAda\n"
+	assert.Equal(t, "approved: yes", Reply(text))
+	text = "No\r\n\r\nOn Mon, 3 Feb 2025 at 10:00, pxbox <reply@example.com> wrote:\r\n> Approve?\r\n"
+	assert.Equal(t, "No", Reply(text))
+	assert.Equal(t, "fine", Reply("fine\n> quoted\nmore"))
+}
+
+func TestAnswers(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"approved": map[string]interface{}{"type": "boolean", "title": "Approve"},
+			"count":    map[string]interface{}{"type": "integer"},
+			"size":     map[string]interface{}{"enum": []interface{}{"Small", "Large"}},
+			"note":     map[string]interface{}{"type": "string"},
+		},
+	}
+	got, err := Answers(schema, "Approve: Yes\ncount: 3\nsize: large\nnote: ship it: today\nignored line")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"approved": true, "count": 3.0, "size": "Large", "note": "ship it: today"}, got)
+
+	_, err = Answers(schema, "count: many")
+	assert.ErrorContains(t, err, "count")
+	_, err = Answers(schema, "just text")
+	assert.Error(t, err)
+
+	// The whole reply answers a single property
+	single := map[string]interface{}{"properties": map[string]interface{}{"comment": map[string]interface{}{"type": "string"}}}
+	got, err = Answers(single, "Looks good.\nThanks")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"comment": "Looks good.\nThanks"}, got)
+
+	nested := map[string]interface{}{"properties": map[string]interface{}{"items": map[string]interface{}{"type": "array"}}}
+	_, err = Answers(nested, "items: a")
+	assert.ErrorIs(t, err, ErrNotSimple)
+}
+
+// mailgunForm returns a form signed with key as Mailgun signs webhook calls
+func mailgunForm(key string, timestamp time.Time, token string) url.Values {
+	form := url.Values{
+		"timestamp":  {strconv.FormatInt(timestamp.Unix(), 10)},
+		"token":      {token},
+		"recipient":  {"reply+abc.def@reply.example.com"},
+		"from":       {"ada@example.com"},
+		"subject":    {"Re: Approve"},
+		"body-plain": {"yes\n> Approve?"},
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(form.Get("timestamp") + token))
+	form.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return form
+}
+
+func parseMailgunForm(form url.Values, key string) (*Message, error) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ParseMailgun(r, key)
+}
+
+func TestParseMailgun(t *testing.T) {
+	form := mailgunForm("key", time.Now(), "tok-parse")
+	_, err := parseMailgunForm(form, "other")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	msg, err := parseMailgunForm(form, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reply+abc.def@reply.example.com"}, msg.Recipients)
+	assert.Equal(t, "yes\n> Approve?", msg.Text)
+	parsed, err := Parse(msg.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, "Re: Approve", parsed.Subject)
+}
+
+func TestParseMailgunStale(t *testing.T) {
+	for _, at := range []time.Time{time.Now().Add(-MailgunMaxAge - time.Minute), time.Now().Add(MailgunMaxAge + time.Minute)} {
+		_, err := parseMailgunForm(mailgunForm("key", at, "tok-stale"), "key")
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	}
+	// Refused before its token is recorded
+	_, err := parseMailgunForm(mailgunForm("key", time.Now(), "tok-stale"), "key")
+	assert.NoError(t, err)
+}
+
+func TestParseMailgunReplayed(t *testing.T) {
+	form := mailgunForm("key", time.Now(), "tok-replay")
+	_, err := parseMailgunForm(form, "key")
+	require.NoError(t, err)
+	_, err = parseMailgunForm(form, "key")
+	assert.ErrorIs(t, err, ErrReplayed)
+
+	// Tokens are forgotten once they expire
+	cache := &tokenCache{seen: map[string]time.Time{}}
+	assert.True(t, cache.use("a", time.Now().Add(-time.Second)))
+	assert.True(t, cache.use("a", time.Now().Add(time.Minute)))
+	assert.False(t, cache.use("a", time.Now().Add(time.Minute)))
+}
+
+func TestParseSES(t *testing.T) {
+	notification, err := json.Marshal(map[string]interface{}{
+		"notificationType": "Received",
+		"mail":             map[string]interface{}{"destination": []string{"reply+abc.def@reply.example.com"}},
+		"receipt":          map[string]interface{}{"action": map[string]interface{}{"type": "SNS", "encoding": "BASE64"}},
+		"content":          base64.StdEncoding.EncodeToString([]byte(multipartEmail)),
+	})
+	require.NoError(t, err)
+	body, err := json.Marshal(map[string]interface{}{"Type": "Notification", "Message": string(notification)})
+	require.NoError(t, err)
+
+	msg, subscribeURL, err := ParseSES(body)
+	require.NoError(t, err)
+	assert.Empty(t, subscribeURL)
+	assert.Contains(t, msg.Recipients, "reply+abc.def@reply.example.com")
+	assert.Equal(t, []byte(multipartEmail), msg.Raw)
+
+	msg, subscribeURL, err = ParseSES([]byte(`{"Type":"SubscriptionConfirmation","SubscribeURL":"https://sns.eu-west-1.amazonaws.com/?Action=ConfirmSubscription"}`))
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	assert.Equal(t, "https://sns.eu-west-1.amazonaws.com/?Action=ConfirmSubscription", subscribeURL)
+	_, _, err = ParseSES([]byte(`{"Type":"SubscriptionConfirmation","SubscribeURL":"https://sns.example.com/"}`))
+	assert.Error(t, err)
+}
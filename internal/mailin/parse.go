@@ -0,0 +1,102 @@
+package mailin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+// MaxMessageBytes is the largest inbound email accepted
+const MaxMessageBytes = 10 << 20
+
+// maxPartDepth bounds the nesting of multipart bodies
+const maxPartDepth = 5
+
+// ErrNoText is returned for messages without a text/plain body
+var ErrNoText = errors.New("email has no plain text body")
+
+var wordDecoder = new(mime.WordDecoder)
+
+// Parse parses a raw RFC 5322 message, taking its sender, To and Cc
+// recipients, subject and first text/plain body
+func Parse(raw []byte) (*Message, error) {
+	if len(raw) > MaxMessageBytes {
+		return nil, fmt.Errorf("email exceeds %d bytes", MaxMessageBytes)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email: %w", err)
+	}
+
+	msg := &Message{Raw: raw, From: m.Header.Get("From")}
+	if subject, err := wordDecoder.DecodeHeader(m.Header.Get("Subject")); err == nil {
+		msg.Subject = subject
+	}
+	for _, field := range []string{"To", "Cc"} {
+		if list, err := m.Header.AddressList(field); err == nil {
+			for _, addr := range list {
+				msg.Recipients = append(msg.Recipients, addr.Address)
+			}
+		}
+	}
+
+	text, err := textBody(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+	msg.Text = text
+	return msg, nil
+}
+
+// textBody returns the first text/plain part of a body
+func textBody(contentType, encoding string, body io.Reader, depth int) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type: %w", err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxPartDepth || params["boundary"] == "" {
+			return "", ErrNoText
+		}
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return "", ErrNoText
+			}
+			if err != nil {
+				return "", fmt.Errorf("invalid multipart body: %w", err)
+			}
+			text, err := textBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if !errors.Is(err, ErrNoText) {
+				return text, err
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", ErrNoText
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	text, err := io.ReadAll(io.LimitReader(body, MaxMessageBytes))
+	if err != nil {
+		return "", fmt.Errorf("invalid text body: %w", err)
+	}
+	return strings.ReplaceAll(string(text), "\r\n", "\n"), nil
+}
@@ -0,0 +1,176 @@
+package mailin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnauthenticated is returned for webhook calls without a valid
+// signature
+var ErrUnauthenticated = errors.New("inbound email is not signed")
+
+// ErrReplayed is returned for a signed webhook call whose token was already
+// used
+var ErrReplayed = errors.New("inbound email was already received")
+
+// MailgunMaxAge is how far the timestamp of a Mailgun webhook call may be
+// from now
+const MailgunMaxAge = 5 * time.Minute
+
+// mailgunTokens remembers the tokens of Mailgun calls until their
+// timestamps are too old to be accepted anyway
+var mailgunTokens = &tokenCache{seen: map[string]time.Time{}}
+
+// tokenCache records tokens until they expire
+type tokenCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// use records token until expiresAt and reports whether it was unused
+func (c *tokenCache) use(token string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for t, exp := range c.seen {
+		if !exp.After(now) {
+			delete(c.seen, t)
+		}
+	}
+	if _, ok := c.seen[token]; ok {
+		return false
+	}
+	c.seen[token] = expiresAt
+	return true
+}
+
+// ParseMailgun reads an email Mailgun forwards to a route's URL, checking
+// its signature with the webhook signing key. Mailgun sends the raw message
+// to URLs ending in "mime", such as ?format=mime; otherwise a plain one is
+// rebuilt from the parsed fields. Calls timestamped more than MailgunMaxAge
+// from now are refused, and so are tokens this process has already seen.
+func ParseMailgun(r *http.Request, signingKey string) (*Message, error) {
+	if err := r.ParseMultipartForm(MaxMessageBytes); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, fmt.Errorf("invalid Mailgun form: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(r.FormValue("timestamp") + r.FormValue("token")))
+	signature, err := hex.DecodeString(r.FormValue("signature"))
+	if signingKey == "" || err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrUnauthenticated
+	}
+	seconds, err := strconv.ParseInt(r.FormValue("timestamp"), 10, 64)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	timestamp := time.Unix(seconds, 0)
+	if age := time.Since(timestamp); age > MailgunMaxAge || age < -MailgunMaxAge {
+		return nil, fmt.Errorf("%w: timestamp %s is too far from now", ErrUnauthenticated, timestamp.UTC().Format(time.RFC3339))
+	}
+	if !mailgunTokens.use(r.FormValue("token"), timestamp.Add(MailgunMaxAge)) {
+		return nil, ErrReplayed
+	}
+
+	var msg *Message
+	if raw := r.FormValue("body-mime"); raw != "" {
+		if msg, err = Parse([]byte(raw)); err != nil {
+			return nil, err
+		}
+	} else {
+		msg = &Message{From: r.FormValue("from"), Subject: r.FormValue("subject"), Text: r.FormValue("body-plain")}
+		msg.Raw = plainMessage(msg, r.FormValue("recipient"))
+	}
+	for _, recipient := range strings.Split(r.FormValue("recipient"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			msg.Recipients = append(msg.Recipients, recipient)
+		}
+	}
+	return msg, nil
+}
+
+// plainMessage rebuilds a text message from parsed fields
+func plainMessage(msg *Message, to string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", oneLine(msg.From), oneLine(to), oneLine(msg.Subject), time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Text, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// snsHost matches the hosts Amazon SNS sends subscription confirmations
+// from
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com$`)
+
+// ParseSES reads an Amazon SNS message carrying an email an SES receipt
+// rule published. For the confirmation SNS sends when the endpoint is
+// subscribed, it returns no message and the URL that confirms it.
+func ParseSES(body []byte) (*Message, string, error) {
+	var envelope struct {
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, "", fmt.Errorf("invalid SNS message: %w", err)
+	}
+	switch envelope.Type {
+	case "SubscriptionConfirmation":
+		u, err := url.Parse(envelope.SubscribeURL)
+		if err != nil || u.Scheme != "https" || !snsHost.MatchString(u.Hostname()) {
+			return nil, "", fmt.Errorf("invalid SNS subscribe URL %q", envelope.SubscribeURL)
+		}
+		return nil, u.String(), nil
+	case "Notification":
+	default:
+		return nil, "", fmt.Errorf("unexpected SNS message type %q", envelope.Type)
+	}
+
+	var notification struct {
+		NotificationType string `json:"notificationType"`
+		Mail             struct {
+			Destination []string `json:"destination"`
+		} `json:"mail"`
+		Receipt struct {
+			Action struct {
+				Encoding string `json:"encoding"`
+			} `json:"action"`
+		} `json:"receipt"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(envelope.Message), &notification); err != nil {
+		return nil, "", fmt.Errorf("invalid SES notification: %w", err)
+	}
+	if notification.NotificationType != "Received" || notification.Content == "" {
+		return nil, "", fmt.Errorf("SES notification %q carries no email", notification.NotificationType)
+	}
+	raw := []byte(notification.Content)
+	if strings.EqualFold(notification.Receipt.Action.Encoding, "BASE64") {
+		decoded, err := base64.StdEncoding.DecodeString(notification.Content)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid SES content: %w", err)
+		}
+		raw = decoded
+	}
+	msg, err := Parse(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	msg.Recipients = append(msg.Recipients, notification.Mail.Destination...)
+	return msg, "", nil
+}
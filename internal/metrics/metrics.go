@@ -0,0 +1,91 @@
+// Package metrics holds the Prometheus metrics of pxbox and serves them
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the pxbox metrics along with Go runtime and process
+// metrics
+var Registry = prometheus.NewRegistry()
+
+// QuotaRejections counts requests refused by a quota, labelled by the quota
+// ("open_per_requestor", "open_per_entity", "daily_per_requestor")
+var QuotaRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pxbox_quota_rejections_total",
+	Help: "Requests refused because a quota was exceeded.",
+}, []string{"quota"})
+
+// DBPoolConnections is the number of Postgres pool connections by state
+// ("idle", "acquired", "constructing"), and the pool's limit ("max")
+var DBPoolConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pxbox_db_pool_connections",
+	Help: "Postgres pool connections by state, and the pool size limit.",
+}, []string{"state"})
+
+// DBPoolAcquires counts connections taken from the Postgres pool
+var DBPoolAcquires = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pxbox_db_pool_acquires_total",
+	Help: "Connections acquired from the Postgres pool.",
+})
+
+// DBPoolEmptyAcquires counts acquires that found no idle connection and
+// had to wait for one to be created or released
+var DBPoolEmptyAcquires = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pxbox_db_pool_empty_acquires_total",
+	Help: "Postgres pool acquires that waited because no connection was idle.",
+})
+
+// DBPoolAcquireWait sums the time spent acquiring pool connections;
+// divided by DBPoolAcquires it gives the average wait
+var DBPoolAcquireWait = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pxbox_db_pool_acquire_wait_seconds_total",
+	Help: "Time spent acquiring connections from the Postgres pool.",
+})
+
+// SchemaCompileDuration is how long compiling a request schema took,
+// including fetching its remote $refs
+var SchemaCompileDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "pxbox_schema_compile_seconds",
+	Help:    "Time spent compiling request schemas.",
+	Buckets: prometheus.ExponentialBuckets(0.0005, 4, 9),
+})
+
+// SchemaComplexity is the number of objects and arrays in compiled
+// schemas; compare it with SCHEMA_MAX_NODES
+var SchemaComplexity = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "pxbox_schema_complexity_nodes",
+	Help:    "Objects and arrays in compiled request schemas.",
+	Buckets: prometheus.ExponentialBuckets(4, 4, 8),
+})
+
+// SchemaRejections counts schemas refused by a compile limit, labelled by
+// the limit ("too_complex", "timeout")
+var SchemaRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pxbox_schema_rejections_total",
+	Help: "Request schemas refused because they exceeded a compile limit.",
+}, []string{"reason"})
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		QuotaRejections,
+		DBPoolConnections,
+		DBPoolAcquires,
+		DBPoolEmptyAcquires,
+		DBPoolAcquireWait,
+		SchemaCompileDuration,
+		SchemaComplexity,
+		SchemaRejections,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,205 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays names the days of the week as business calendars list them
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// HolidayLayout is the format of business calendar holidays
+const HolidayLayout = "2006-01-02"
+
+// BusinessCalendar sets the working hours and holidays business deadlines
+// are counted in, in the calendar's timezone
+type BusinessCalendar struct {
+	Timezone  string   `json:"timezone"`  // IANA zone working hours follow
+	WorkDays  []string `json:"workDays"`  // "mon" to "sun"
+	WorkStart string   `json:"workStart"` // HH:MM
+	WorkEnd   string   `json:"workEnd"`   // HH:MM, after WorkStart
+	Holidays  []string `json:"holidays"`  // YYYY-MM-DD days off
+	UpdatedAt string   `json:"updatedAt,omitempty"`
+}
+
+// DefaultBusinessCalendar applies to entities that never set one: Monday
+// to Friday, 09:00 to 17:00 UTC, without holidays
+func DefaultBusinessCalendar() BusinessCalendar {
+	return BusinessCalendar{
+		Timezone:  "UTC",
+		WorkDays:  []string{"mon", "tue", "wed", "thu", "fri"},
+		WorkStart: "09:00",
+		WorkEnd:   "17:00",
+		Holidays:  []string{},
+	}
+}
+
+// Validate checks the calendar's timezone, days and hours
+func (c BusinessCalendar) Validate() error {
+	if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" || c.Timezone == "Local" {
+		return fmt.Errorf("unknown timezone %q", c.Timezone)
+	}
+	if len(c.WorkDays) == 0 {
+		return fmt.Errorf("workDays must list at least one day")
+	}
+	for _, d := range c.WorkDays {
+		if weekdayIndex(d) < 0 {
+			return fmt.Errorf("unknown work day %q, expected mon to sun", d)
+		}
+	}
+	start, err := ParseClock(c.WorkStart)
+	if err != nil {
+		return fmt.Errorf("workStart: %w", err)
+	}
+	end, err := ParseClock(c.WorkEnd)
+	if err != nil {
+		return fmt.Errorf("workEnd: %w", err)
+	}
+	if end <= start {
+		return fmt.Errorf("workEnd must be after workStart")
+	}
+	for _, h := range c.Holidays {
+		if _, err := time.Parse(HolidayLayout, h); err != nil {
+			return fmt.Errorf("invalid holiday %q, expected YYYY-MM-DD", h)
+		}
+	}
+	return nil
+}
+
+func weekdayIndex(day string) int {
+	for i, d := range weekdays {
+		if d == day {
+			return i
+		}
+	}
+	return -1
+}
+
+// Location returns the calendar's timezone, UTC if it is unknown
+func (c BusinessCalendar) Location() *time.Location {
+	if loc, err := time.LoadLocation(c.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// DayLength is the working time of one business day
+func (c BusinessCalendar) DayLength() time.Duration {
+	start, _ := ParseClock(c.WorkStart)
+	end, _ := ParseClock(c.WorkEnd)
+	return time.Duration(end-start) * time.Minute
+}
+
+// searchDays bounds how far ahead a calendar is searched for working time,
+// so one with every day a holiday cannot loop forever
+const searchDays = 3 * 366
+
+// workingDay returns the working hours of the day i days after t's, or
+// false if that day is off
+func (c BusinessCalendar) workingDay(t time.Time, i int) (start, end time.Time, ok bool) {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d+i, 0, 0, 0, 0, t.Location())
+	working := false
+	for _, w := range c.WorkDays {
+		working = working || weekdayIndex(w) == int(day.Weekday())
+	}
+	for _, h := range c.Holidays {
+		working = working && h != day.Format(HolidayLayout)
+	}
+	if !working {
+		return time.Time{}, time.Time{}, false
+	}
+	from, _ := ParseClock(c.WorkStart)
+	to, _ := ParseClock(c.WorkEnd)
+	return time.Date(day.Year(), day.Month(), day.Day(), from/60, from%60, 0, 0, t.Location()),
+		time.Date(day.Year(), day.Month(), day.Day(), to/60, to%60, 0, 0, t.Location()), true
+}
+
+// NextWorking returns t if it falls inside working hours, otherwise the
+// start of the next working hours. It returns false if there are none
+// within three years.
+func (c BusinessCalendar) NextWorking(t time.Time) (time.Time, bool) {
+	local := t.In(c.Location())
+	for i := 0; i < searchDays; i++ {
+		start, end, ok := c.workingDay(local, i)
+		switch {
+		case !ok || !local.Before(end):
+			continue
+		case local.Before(start):
+			return start, true
+		default:
+			return local, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// AddWorkingTime returns the time d of working time after t, counting only
+// working hours. It returns false if the calendar runs out of working time
+// within three years.
+func (c BusinessCalendar) AddWorkingTime(t time.Time, d time.Duration) (time.Time, bool) {
+	first := t.In(c.Location())
+	local := first
+	for i := 0; i < searchDays; i++ {
+		start, end, ok := c.workingDay(first, i)
+		if !ok || !local.Before(end) {
+			continue
+		}
+		if local.Before(start) {
+			local = start
+		}
+		left := end.Sub(local)
+		if d <= left {
+			return local.Add(d), true
+		}
+		d -= left
+		local = end
+	}
+	return time.Time{}, false
+}
+
+// BusinessDuration is an amount of working time such as "3 business days"
+type BusinessDuration struct {
+	Count int
+	Days  bool // Business days if set, business hours otherwise
+}
+
+// ParseBusinessDuration parses "N business days" or "N business hours"
+// (singular for one)
+func ParseBusinessDuration(s string) (BusinessDuration, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) != 3 || fields[1] != "business" {
+		return BusinessDuration{}, fmt.Errorf("invalid business duration %q, expected e.g. \"3 business days\"", s)
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n <= 0 {
+		return BusinessDuration{}, fmt.Errorf("invalid business duration %q, the count must be a positive integer", s)
+	}
+	switch fields[2] {
+	case "day", "days":
+		return BusinessDuration{Count: n, Days: true}, nil
+	case "hour", "hours":
+		return BusinessDuration{Count: n}, nil
+	}
+	return BusinessDuration{}, fmt.Errorf("invalid business duration %q, the unit must be days or hours", s)
+}
+
+// Add returns the time the business duration ends when started at t. A
+// business day is a full day of working hours, so "1 business day" from
+// Friday 10:00 with Monday to Friday hours ends Monday 10:00.
+func (c BusinessCalendar) Add(t time.Time, d BusinessDuration) (time.Time, bool) {
+	unit := time.Hour
+	if d.Days {
+		unit = c.DayLength()
+	}
+	return c.AddWorkingTime(t, time.Duration(d.Count)*unit)
+}
+
+// CalendarFeed is the token of an entity's deadline calendar feed. The
+// token is only returned when it is created.
+type CalendarFeed struct {
+	Token     string `json:"token,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusinessCalendarAdd(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	c := DefaultBusinessCalendar()
+	c.Timezone = "Europe/Prague"
+	c.Holidays = []string{"2024-03-04"}
+	require.NoError(t, c.Validate())
+
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, prague) }
+	for _, tc := range []struct {
+		from     time.Time
+		duration string
+		want     time.Time
+	}{
+		// Friday 2024-03-01; Monday the 4th is a holiday
+		{at(1, 10, 0), "1 business day", at(5, 10, 0)},
+		{at(1, 16, 0), "3 business days", at(7, 16, 0)},
+		{at(1, 16, 0), "2 business hours", at(5, 10, 0)},
+		// Outside working hours the count starts when they do
+		{at(2, 12, 0), "3 business days", at(7, 17, 0)},
+		{at(5, 7, 30), "1 business hour", at(5, 10, 0)},
+		// The calendar's timezone counts, not the caller's
+		{time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC), "1 business hour", at(5, 10, 30)},
+	} {
+		d, err := ParseBusinessDuration(tc.duration)
+		require.NoError(t, err)
+		got, ok := c.Add(tc.from, d)
+		assert.True(t, ok)
+		assert.True(t, tc.want.Equal(got), "%s + %s: %s", tc.from, tc.duration, got)
+	}
+
+	next, ok := c.NextWorking(at(2, 12, 0))
+	assert.True(t, ok)
+	assert.True(t, at(5, 9, 0).Equal(next), next)
+	next, _ = c.NextWorking(at(5, 11, 0))
+	assert.True(t, at(5, 11, 0).Equal(next), next)
+}
+
+func TestParseBusinessDuration(t *testing.T) {
+	d, err := ParseBusinessDuration("1 Business Day")
+	require.NoError(t, err)
+	assert.Equal(t, BusinessDuration{Count: 1, Days: true}, d)
+	d, err = ParseBusinessDuration("12 business hours")
+	require.NoError(t, err)
+	assert.Equal(t, BusinessDuration{Count: 12}, d)
+
+	for _, s := range []string{"", "3 days", "0 business days", "3 business weeks", "three business days"} {
+		_, err := ParseBusinessDuration(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBusinessCalendarValidate(t *testing.T) {
+	for _, c := range []BusinessCalendar{
+		{Timezone: "Mars/Olympus", WorkDays: []string{"mon"}, WorkStart: "09:00", WorkEnd: "17:00"},
+		{Timezone: "UTC", WorkStart: "09:00", WorkEnd: "17:00"},
+		{Timezone: "UTC", WorkDays: []string{"funday"}, WorkStart: "09:00", WorkEnd: "17:00"},
+		{Timezone: "UTC", WorkDays: []string{"mon"}, WorkStart: "17:00", WorkEnd: "09:00"},
+		{Timezone: "UTC", WorkDays: []string{"mon"}, WorkStart: "09:00", WorkEnd: "17:00", Holidays: []string{"24-12-2024"}},
+	} {
+		assert.Error(t, c.Validate(), c)
+	}
+
+	// A calendar without working time gives up instead of looping
+	c := DefaultBusinessCalendar()
+	c.WorkDays = []string{"sat"}
+	for d := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); d.Year() < 2028; d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Saturday {
+			c.Holidays = append(c.Holidays, d.Format(HolidayLayout))
+		}
+	}
+	_, ok := c.AddWorkingTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Hour)
+	assert.False(t, ok)
+}
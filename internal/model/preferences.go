@@ -0,0 +1,140 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Notification channels
+const (
+	ChannelWebSocket = "websocket"
+	ChannelPush      = "push"     // Mobile push to registered devices
+	ChannelTelegram  = "telegram" // Messages to the linked Telegram chat
+)
+
+// NotificationChannels lists the channels notifications can be sent on
+var NotificationChannels = []string{ChannelWebSocket, ChannelPush, ChannelTelegram}
+
+// Digest frequencies
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DefaultDigestAt is when digests are sent unless an entity chooses
+const DefaultDigestAt = "08:00"
+
+// NotificationPreferences controls how and when an entity is notified
+type NotificationPreferences struct {
+	Channels   []string    `json:"channels"` // Enabled channels; every channel when nil
+	QuietHours *QuietHours `json:"quietHours,omitempty"`
+	Digest     string      `json:"digest"`   // DigestOff, DigestDaily or DigestWeekly
+	DigestAt   string      `json:"digestAt"` // Local HH:MM digests are sent at; weekly ones on Mondays
+	Timezone   string      `json:"timezone"` // IANA zone quiet hours and digests follow
+	UpdatedAt  string      `json:"updatedAt,omitempty"`
+}
+
+// QuietHours is a daily window, in the entity's timezone, during which
+// notifications are held back. End before Start wraps past midnight.
+type QuietHours struct {
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM
+}
+
+// DefaultNotificationPreferences applies to entities that never set any
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{Digest: DigestOff, DigestAt: DefaultDigestAt, Timezone: "UTC"}
+}
+
+// Location returns the preferences' timezone, UTC if it is unknown
+func (p NotificationPreferences) Location() *time.Location {
+	if loc, err := time.LoadLocation(p.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// Enabled reports whether notifications are sent on channel
+func (p NotificationPreferences) Enabled(channel string) bool {
+	if p.Channels == nil {
+		return true
+	}
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// QuietUntil reports whether t falls inside the quiet hours and, if so,
+// when they end
+func (p NotificationPreferences) QuietUntil(t time.Time) (time.Time, bool) {
+	if p.QuietHours == nil {
+		return time.Time{}, false
+	}
+	start, err1 := ParseClock(p.QuietHours.Start)
+	end, err2 := ParseClock(p.QuietHours.End)
+	if err1 != nil || err2 != nil || start == end {
+		return time.Time{}, false
+	}
+
+	local := t.In(p.Location())
+	now := local.Hour()*60 + local.Minute()
+	endAt := func(days int) time.Time {
+		y, m, d := local.Date()
+		return time.Date(y, m, d+days, end/60, end%60, 0, 0, local.Location())
+	}
+	switch {
+	case start < end && now >= start && now < end:
+		return endAt(0), true
+	case start > end && now >= start:
+		return endAt(1), true
+	case start > end && now < end:
+		return endAt(0), true
+	}
+	return time.Time{}, false
+}
+
+// DigestSlot returns the latest time at or before t a digest is due: today
+// or yesterday at DigestAt for daily digests, the latest Monday for weekly
+// ones. It returns false when digests are off.
+func (p NotificationPreferences) DigestSlot(t time.Time) (time.Time, bool) {
+	if p.Digest != DigestDaily && p.Digest != DigestWeekly {
+		return time.Time{}, false
+	}
+	at, err := ParseClock(p.DigestAt)
+	if err != nil {
+		at, _ = ParseClock(DefaultDigestAt)
+	}
+
+	local := t.In(p.Location())
+	y, m, d := local.Date()
+	slot := time.Date(y, m, d, at/60, at%60, 0, 0, local.Location())
+	if slot.After(local) {
+		slot = time.Date(y, m, d-1, at/60, at%60, 0, 0, local.Location())
+	}
+	if p.Digest == DigestWeekly {
+		back := (int(slot.Weekday()) + 6) % 7 // Days since Monday
+		slot = time.Date(slot.Year(), slot.Month(), slot.Day()-back, at/60, at%60, 0, 0, local.Location())
+	}
+	return slot, true
+}
+
+// DigestPeriod returns how far back a digest looks
+func (p NotificationPreferences) DigestPeriod() time.Duration {
+	if p.Digest == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// ParseClock parses a time of day as HH:MM into minutes after midnight
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuietUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	overnight := NotificationPreferences{
+		QuietHours: &QuietHours{Start: "22:00", End: "07:30"},
+		Timezone:   "Europe/Berlin",
+	}
+
+	for _, tc := range []struct {
+		at    time.Time
+		quiet bool
+		until time.Time
+	}{
+		{time.Date(2024, 3, 4, 23, 15, 0, 0, berlin), true, time.Date(2024, 3, 5, 7, 30, 0, 0, berlin)},
+		{time.Date(2024, 3, 5, 6, 0, 0, 0, berlin), true, time.Date(2024, 3, 5, 7, 30, 0, 0, berlin)},
+		{time.Date(2024, 3, 5, 7, 30, 0, 0, berlin), false, time.Time{}},
+		{time.Date(2024, 3, 5, 12, 0, 0, 0, berlin), false, time.Time{}},
+		// The window follows the entity's timezone, not the caller's
+		{time.Date(2024, 3, 5, 21, 30, 0, 0, time.UTC), true, time.Date(2024, 3, 6, 7, 30, 0, 0, berlin)},
+	} {
+		until, quiet := overnight.QuietUntil(tc.at)
+		assert.Equal(t, tc.quiet, quiet, tc.at)
+		assert.True(t, tc.until.Equal(until), "%s: %s", tc.at, until)
+	}
+
+	daytime := NotificationPreferences{QuietHours: &QuietHours{Start: "12:00", End: "13:00"}}
+	until, quiet := daytime.QuietUntil(time.Date(2024, 3, 5, 12, 30, 0, 0, time.UTC))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2024, 3, 5, 13, 0, 0, 0, time.UTC), until)
+
+	_, quiet = NotificationPreferences{}.QuietUntil(time.Now())
+	assert.False(t, quiet)
+}
+
+func TestNotificationChannelEnabled(t *testing.T) {
+	assert.True(t, DefaultNotificationPreferences().Enabled(ChannelWebSocket))
+	assert.False(t, NotificationPreferences{Channels: []string{}}.Enabled(ChannelWebSocket))
+}
+
+func TestDigestSlot(t *testing.T) {
+	daily := NotificationPreferences{Digest: DigestDaily, DigestAt: "08:00"}
+	slot, ok := daily.DigestSlot(time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC)) // Wednesday
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC), slot)
+	slot, _ = daily.DigestSlot(time.Date(2024, 3, 6, 7, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC), slot)
+
+	weekly := NotificationPreferences{Digest: DigestWeekly, DigestAt: "08:00"}
+	slot, _ = weekly.DigestSlot(time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC), slot)
+	// Monday before the digest time belongs to the previous week
+	slot, _ = weekly.DigestSlot(time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 2, 26, 8, 0, 0, 0, time.UTC), slot)
+
+	_, ok = DefaultNotificationPreferences().DigestSlot(time.Now())
+	assert.False(t, ok)
+}
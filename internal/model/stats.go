@@ -0,0 +1,54 @@
+package model
+
+// Stats sources
+const (
+	StatsLive         = "live"         // Aggregated from the tables on every call
+	StatsMaterialized = "materialized" // Read from views refreshed periodically
+)
+
+// RequestStats counts the requests created over a range of days
+type RequestStats struct {
+	From         string           `json:"from"` // First day, YYYY-MM-DD, UTC
+	To           string           `json:"to"`   // Last day, inclusive
+	Source       string           `json:"source"`
+	RefreshedAt  *string          `json:"refreshedAt,omitempty"` // When materialized stats were last refreshed
+	Total        int64            `json:"total"`
+	ByStatus     map[string]int64 `json:"byStatus"`
+	BySchemaKind map[string]int64 `json:"bySchemaKind"`
+	ByDay        []DayCount       `json:"byDay"`    // Every day of the range, oldest first
+	ByEntity     []EntityCount    `json:"byEntity"` // Busiest entities first
+}
+
+// DayCount is a count for a day
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// EntityCount is a count for an entity
+type EntityCount struct {
+	EntityID string `json:"entityId"`
+	Count    int64  `json:"count"`
+}
+
+// FlowStats summarizes the flows created over a range of days by kind
+type FlowStats struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Source      string          `json:"source"`
+	RefreshedAt *string         `json:"refreshedAt,omitempty"`
+	Kinds       []FlowKindStats `json:"kinds"`
+}
+
+// FlowKindStats are the outcomes of the flows of one kind
+type FlowKindStats struct {
+	Kind     string           `json:"kind"`
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"byStatus"`
+	// CompletionRate is the share of finished flows (completed, cancelled
+	// or failed) that completed; 0 when none finished
+	CompletionRate float64 `json:"completionRate"`
+	// AvgDurationSeconds is the mean time from start to completion of the
+	// completed flows
+	AvgDurationSeconds *float64 `json:"avgDurationSeconds,omitempty"`
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is returned when a status change is not allowed from
+// the current status
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// TransitionError describes a rejected status change
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: %s -> %s", ErrInvalidTransition, e.From, e.To)
+}
+
+// Unwrap lets errors.Is match ErrInvalidTransition
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// StatusMachine holds the legal status transitions, keyed by target status
+type StatusMachine struct {
+	sources map[Status][]Status
+}
+
+// RequestStatusMachine is the request lifecycle: PENDING may be claimed and
+// a claim released again, and PENDING or CLAIMED requests may be answered,
+// cancelled or expire. The requestor may review an ANSWERED request: accept
+// it, reject it, or reject it and reopen it to PENDING for a corrected
+// answer. ACCEPTED, REJECTED, CANCELLED and EXPIRED are terminal.
+var RequestStatusMachine = StatusMachine{
+	sources: map[Status][]Status{
+		StatusPending:   {StatusClaimed, StatusAnswered},
+		StatusClaimed:   {StatusPending},
+		StatusAnswered:  {StatusPending, StatusClaimed},
+		StatusCancelled: {StatusPending, StatusClaimed},
+		StatusExpired:   {StatusPending, StatusClaimed},
+		StatusAccepted:  {StatusAnswered},
+		StatusRejected:  {StatusAnswered},
+	},
+}
+
+// IsOpen reports whether a request in status s still waits for an answer
+func (s Status) IsOpen() bool {
+	return s == StatusPending || s == StatusClaimed
+}
+
+// IsAnswered reports whether a request in status s has an answer that was
+// not rejected: ANSWERED, waiting for review, or ACCEPTED
+func (s Status) IsAnswered() bool {
+	return s == StatusAnswered || s == StatusAccepted
+}
+
+// Sources returns the statuses from which a move to "to" is allowed
+func (m StatusMachine) Sources(to Status) []Status {
+	return m.sources[to]
+}
+
+// CanTransition reports whether a move from one status to another is allowed
+func (m StatusMachine) CanTransition(from, to Status) bool {
+	for _, s := range m.sources[to] {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a *TransitionError if the move is not allowed
+func (m StatusMachine) Check(from, to Status) error {
+	if !m.CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// IsTerminal reports whether no transition leaves status s
+func (m StatusMachine) IsTerminal(s Status) bool {
+	for to := range m.sources {
+		if m.CanTransition(s, to) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestStatusMachine(t *testing.T) {
+	statuses := []Status{StatusPending, StatusClaimed, StatusAnswered, StatusCancelled, StatusExpired, StatusAccepted, StatusRejected}
+
+	allowed := map[Status][]Status{
+		StatusPending:  {StatusClaimed, StatusAnswered, StatusCancelled, StatusExpired},
+		StatusClaimed:  {StatusPending, StatusAnswered, StatusCancelled, StatusExpired},
+		StatusAnswered: {StatusAccepted, StatusRejected, StatusPending},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, s := range allowed[from] {
+				if s == to {
+					want = true
+				}
+			}
+
+			t.Run(string(from)+"->"+string(to), func(t *testing.T) {
+				if got := RequestStatusMachine.CanTransition(from, to); got != want {
+					t.Fatalf("CanTransition = %v, want %v", got, want)
+				}
+
+				err := RequestStatusMachine.Check(from, to)
+				if want && err != nil {
+					t.Fatalf("Check returned %v", err)
+				}
+				if !want {
+					var te *TransitionError
+					if !errors.As(err, &te) || !errors.Is(err, ErrInvalidTransition) {
+						t.Fatalf("Check returned %v, want *TransitionError", err)
+					}
+					if te.From != from || te.To != to {
+						t.Fatalf("TransitionError = %+v", te)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRequestStatusMachineTerminal(t *testing.T) {
+	tests := map[Status]bool{
+		StatusPending:   false,
+		StatusClaimed:   false,
+		StatusAnswered:  false,
+		StatusCancelled: true,
+		StatusExpired:   true,
+		StatusAccepted:  true,
+		StatusRejected:  true,
+	}
+
+	for status, want := range tests {
+		if got := RequestStatusMachine.IsTerminal(status); got != want {
+			t.Errorf("IsTerminal(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
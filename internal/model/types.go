@@ -9,8 +9,21 @@ const (
 	StatusAnswered Status = "ANSWERED"
 	StatusCancelled Status = "CANCELLED"
 	StatusExpired  Status = "EXPIRED"
+	// StatusAccepted and StatusRejected are set by the requestor's review
+	// of an answer
+	StatusAccepted Status = "ACCEPTED"
+	StatusRejected Status = "REJECTED"
 )
 
+// Valid reports whether s is a known request status
+func (s Status) Valid() bool {
+	switch s {
+	case StatusPending, StatusClaimed, StatusAnswered, StatusCancelled, StatusExpired, StatusAccepted, StatusRejected:
+		return true
+	}
+	return false
+}
+
 // SchemaKind represents the type of schema
 type SchemaKind string
 
@@ -30,8 +43,20 @@ const (
 	FlowStatusCompleted   FlowStatus = "COMPLETED"
 	FlowStatusCancelled   FlowStatus = "CANCELLED"
 	FlowStatusFailed      FlowStatus = "FAILED"
+	// FlowStatusArchived is set by the worker some time after a flow
+	// finished; the flow's ArchivedStatus keeps how it finished
+	FlowStatusArchived    FlowStatus = "ARCHIVED"
 )
 
+// Valid reports whether s is a known flow status
+func (s FlowStatus) Valid() bool {
+	switch s {
+	case FlowStatusRunning, FlowStatusSuspended, FlowStatusWaitingInput, FlowStatusCompleted, FlowStatusCancelled, FlowStatusFailed, FlowStatusArchived:
+		return true
+	}
+	return false
+}
+
 // EntityKind represents entity type
 type EntityKind string
 
@@ -42,6 +67,15 @@ const (
 	EntityKindBot   EntityKind = "bot"
 )
 
+// Valid reports whether k is a known entity kind
+func (k EntityKind) Valid() bool {
+	switch k {
+	case EntityKindUser, EntityKindGroup, EntityKindRole, EntityKindBot:
+		return true
+	}
+	return false
+}
+
 // Entity represents a routable target
 type Entity struct {
 	ID        string                 `json:"id"`
@@ -49,9 +83,22 @@ type Entity struct {
 	Handle    string                 `json:"handle,omitempty"`
 	Meta      map[string]interface{} `json:"meta,omitempty"`
 	CreatedAt string                 `json:"createdAt,omitempty"`
+	Sandbox   bool                   `json:"sandbox,omitempty"`
+	// DeactivatedAt is set while the entity accepts no new requests
+	DeactivatedAt *string `json:"deactivatedAt,omitempty"`
 }
 
-// Request represents a data-entry request
+// Request represents a data-entry request.
+//
+// DeadlineAt is when the answer is due: the entity is warned an hour
+// before, and when it passes the request expires and may be auto-cancelled
+// after a grace period. Until the expiry job has run the request can still
+// be answered.
+//
+// ExpiresAt is when the request stops being valid at all. From that moment
+// it is hidden from the entity's queue and inquiry listings, and claims and
+// answers are rejected with request_expired, whether or not the expiry job
+// that marks it EXPIRED has run yet.
 type Request struct {
 	ID            string                 `json:"id"`
 	CreatedBy     string                 `json:"createdBy"`
@@ -65,10 +112,78 @@ type Request struct {
 	DeadlineAt    *string                `json:"deadlineAt,omitempty"`
 	AttentionAt   *string                `json:"attentionAt,omitempty"`
 	CallbackURL   *string                `json:"callbackUrl,omitempty"`
+	CallbackFields []string              `json:"callbackFields,omitempty"`
 	FilesPolicy   map[string]interface{} `json:"filesPolicy,omitempty"`
 	FlowID        *string                `json:"flowId,omitempty"`
+	Sandbox       bool                   `json:"sandbox,omitempty"`
+	Tags          []string               `json:"tags,omitempty"`
+	DeliveredAt   *string                `json:"deliveredAt,omitempty"` // When the entity's client first received it
+	ReadAt        *string                `json:"readAt,omitempty"`
+	SnoozedUntil  *string                `json:"snoozedUntil,omitempty"`
+	ClaimedBy     *string                `json:"claimedBy,omitempty"`
+	ClaimedAt     *string                `json:"claimedAt,omitempty"`
+	ClaimExpiresAt *string               `json:"claimExpiresAt,omitempty"`
+	Locale        *string                `json:"locale,omitempty"`
+	Timezone      *string                `json:"timezone,omitempty"`
+	DeferredUntil *string                `json:"deferredUntil,omitempty"` // End of the maintenance window it arrived in
+	DeadlineDisplay  *TimeDisplay        `json:"deadlineDisplay,omitempty"`
+	AttentionDisplay *TimeDisplay        `json:"attentionDisplay,omitempty"`
+	Attachments   []map[string]interface{} `json:"attachments,omitempty"` // Files from the requestor
+	BundleID      *string                `json:"bundleId,omitempty"`
+	Bundle        *Bundle                `json:"bundle,omitempty"` // Set on queue entries standing in for a bundle
 	CreatedAt     string                 `json:"createdAt,omitempty"`
 	UpdatedAt     string                 `json:"updatedAt,omitempty"`
+	Version       int                    `json:"version"`
+}
+
+// TimeDisplay renders a timestamp for display, computed server-side so
+// every client shows the same text
+type TimeDisplay struct {
+	Local    string `json:"local"`    // In the request's timezone, e.g. "2025-01-03 17:00 CET"
+	Timezone string `json:"timezone"` // IANA name, "UTC" if the request has none
+	Relative string `json:"relative"` // e.g. "due in 3h", "overdue by 2d"
+}
+
+// BundleStatus is the aggregate status of the requests of a bundle
+type BundleStatus string
+
+const (
+	BundlePending    BundleStatus = "PENDING"     // No request answered yet
+	BundleInProgress BundleStatus = "IN_PROGRESS" // Some requests answered
+	BundleCompleted  BundleStatus = "COMPLETED"   // All requests answered
+	BundleIncomplete BundleStatus = "INCOMPLETE"  // A request was cancelled, expired unanswered or its answer rejected
+)
+
+// ShareLink is a single-use public answer link for a request. The token
+// is only returned when the link is created.
+type ShareLink struct {
+	ID        string  `json:"id"`
+	RequestID string  `json:"requestId"`
+	Token     string  `json:"token,omitempty"`
+	ExpiresAt string  `json:"expiresAt"`
+	UsedAt    *string `json:"usedAt,omitempty"`
+	UsedBy    *string `json:"usedBy,omitempty"` // Ad-hoc entity that answered
+	CreatedAt string  `json:"createdAt"`
+}
+
+// Bundle groups several requests to one entity into one logical packet
+type Bundle struct {
+	ID          string       `json:"id"`
+	EntityID    string       `json:"entityId"`
+	CreatedBy   string       `json:"createdBy"`
+	Title       *string      `json:"title,omitempty"`
+	Status      BundleStatus `json:"status"`
+	Total       int          `json:"total"`
+	Answered    int          `json:"answered"`
+	Requests    []BundleItem `json:"requests"`
+	CreatedAt   string       `json:"createdAt"`
+	CompletedAt *string      `json:"completedAt,omitempty"`
+}
+
+// BundleItem is a request of a bundle with its status
+type BundleItem struct {
+	RequestID string `json:"requestId"`
+	Status    Status `json:"status"`
 }
 
 // Response represents a response to a request
@@ -79,17 +194,239 @@ type Response struct {
 	Payload     map[string]interface{} `json:"payload"`
 	Files       []map[string]interface{} `json:"files,omitempty"`
 	AnsweredAt string                 `json:"answeredAt,omitempty"`
+	Redacted   bool                   `json:"redacted,omitempty"` // Sensitive properties of the payload are masked
+	Review     *ResponseReview        `json:"review,omitempty"`
+}
+
+// ResponseReview is the requestor's verdict on an answer
+type ResponseReview struct {
+	Status     Status  `json:"status"` // ACCEPTED or REJECTED
+	Reason     *string `json:"reason,omitempty"`
+	ReviewedBy string  `json:"reviewedBy"`
+	ReviewedAt string  `json:"reviewedAt"`
+}
+
+// Comment is a message in the clarification thread of a request.
+// AuthorRole is "entity" for the target entity and "requestor" for the
+// client that created the request.
+type Comment struct {
+	ID         string                   `json:"id"`
+	RequestID  string                   `json:"requestId"`
+	Author     string                   `json:"author"`
+	AuthorRole string                   `json:"authorRole"`
+	Body       string                   `json:"body"`
+	Files      []map[string]interface{} `json:"files,omitempty"`
+	CreatedAt  string                   `json:"createdAt"`
+}
+
+// ActivityItem is one entry in the timeline of a request. Kind is what
+// happened, e.g. "created", "delivered", "claimed" or "commented"; Status is
+// the request status it left behind, if it changed one.
+type ActivityItem struct {
+	At      string                 `json:"at"`
+	Kind    string                 `json:"kind"`
+	Actor   string                 `json:"actor,omitempty"`
+	Status  string                 `json:"status,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Device is a mobile app of an entity that gets push notifications.
+// Platform is "fcm" or "apns"; the token is not returned.
+type Device struct {
+	ID        string  `json:"id"`
+	Platform  string  `json:"platform"`
+	Name      *string `json:"name,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+// TelegramLink is the Telegram chat of an entity. The link code, sent to
+// the bot as "/start <code>", is only returned when it is created.
+type TelegramLink struct {
+	Linked        bool    `json:"linked"`
+	LinkedAt      *string `json:"linkedAt,omitempty"`
+	Code          string  `json:"code,omitempty"`
+	CodeExpiresAt *string `json:"codeExpiresAt,omitempty"`
+	URL           string  `json:"url,omitempty"` // Opens the bot with the code, if its username is known
+}
+
+// Reminder brings a snoozed request back to its entity at RemindAt.
+// DeliveredAt is set once it was sent.
+type Reminder struct {
+	ID          string  `json:"id"`
+	RequestID   string  `json:"requestId"`
+	EntityID    string  `json:"entityId"`
+	RemindAt    string  `json:"remindAt"`
+	DeliveredAt *string `json:"deliveredAt,omitempty"`
+	CreatedAt   string  `json:"createdAt"`
+}
+
+// MaintenanceWindow puts an entity away from StartsAt to EndsAt. Requests
+// created during it are marked deferred until EndsAt, and with
+// PauseDeadlines their deadlines move out by the rest of the window.
+type MaintenanceWindow struct {
+	ID             string  `json:"id"`
+	EntityID       string  `json:"entityId"`
+	StartsAt       string  `json:"startsAt"`
+	EndsAt         string  `json:"endsAt"`
+	PauseDeadlines bool    `json:"pauseDeadlines"`
+	Reason         *string `json:"reason,omitempty"`
+	CreatedBy      string  `json:"createdBy"`
+	CreatedAt      string  `json:"createdAt"`
+}
+
+// ViewFilter is the inquiry filter stored in a saved view. Empty fields
+// match all inquiries.
+type ViewFilter struct {
+	Status    string   `json:"status,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	CreatedBy string   `json:"createdBy,omitempty"` // Requestor client ID
+	SortBy    string   `json:"sortBy,omitempty"`    // "created" or "deadline"
+}
+
+// SavedView is a named inquiry filter of an entity
+type SavedView struct {
+	ID        string     `json:"id"`
+	EntityID  string     `json:"entityId"`
+	Name      string     `json:"name"`
+	Filter    ViewFilter `json:"filter"`
+	CreatedAt string     `json:"createdAt,omitempty"`
+	UpdatedAt string     `json:"updatedAt,omitempty"`
+}
+
+// BotHandler is the URL requests addressed to a bot are pushed to. The
+// secret signing them is only returned when the handler is registered.
+type BotHandler struct {
+	EntityID  string  `json:"entityId"`
+	URL       string  `json:"url"`
+	Secret    *string `json:"secret,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+// Webhook is a subscription to the events of a requestor or an entity. The
+// secret signing deliveries is only returned when the webhook is created or
+// its secret rotated.
+type Webhook struct {
+	ID                      string   `json:"id"`
+	ClientID                string   `json:"clientId,omitempty"` // Requestor whose events are delivered
+	EntityID                string   `json:"entityId,omitempty"` // Or entity whose events are delivered
+	URL                     string   `json:"url"`
+	Events                  []string `json:"events"`
+	Active                  bool     `json:"active"`
+	Secret                  *string  `json:"secret,omitempty"`
+	PreviousSecretExpiresAt *string  `json:"previousSecretExpiresAt,omitempty"`
+	CreatedBy               string   `json:"createdBy"`
+	CreatedAt               string   `json:"createdAt"`
+	UpdatedAt               string   `json:"updatedAt"`
+}
+
+// WebhookDelivery is an event posted, or being posted, to a webhook
+type WebhookDelivery struct {
+	ID             string                 `json:"id"`
+	WebhookID      string                 `json:"webhookId"`
+	EventType      string                 `json:"eventType"`
+	Event          map[string]interface{} `json:"event"`
+	Status         string                 `json:"status"` // PENDING, DELIVERED or FAILED
+	Attempts       int                    `json:"attempts"`
+	ResponseStatus *int                   `json:"responseStatus,omitempty"`
+	Error          *string                `json:"error,omitempty"`
+	CreatedAt      string                 `json:"createdAt"`
+	LastAttemptAt  *string                `json:"lastAttemptAt,omitempty"`
+	DeliveredAt    *string                `json:"deliveredAt,omitempty"`
+}
+
+// File is an object uploaded through the file proxy
+type File struct {
+	ID         string  `json:"id"`
+	Key        string  `json:"key"`
+	RequestID  *string `json:"requestId,omitempty"`
+	Name       string  `json:"name"`
+	URL        string  `json:"url,omitempty"`
+	Size       int64   `json:"size"`
+	MIME       string  `json:"mime"`
+	SHA256     string  `json:"sha256,omitempty"`
+	Status     string  `json:"status"`
+	CreatedAt  string  `json:"createdAt,omitempty"`
+	UploadedAt *string `json:"uploadedAt,omitempty"`
+	ScanStatus string  `json:"scanStatus,omitempty"`
+	ScanResult *string `json:"scanResult,omitempty"`
+}
+
+// Erasure is a run erasing the data of an entity
+type Erasure struct {
+	ID          string         `json:"id"`
+	EntityID    string         `json:"entityId"`
+	Mode        string         `json:"mode"`
+	Status      string         `json:"status"`
+	RequestedBy string         `json:"requestedBy"`
+	Report      *ErasureReport `json:"report,omitempty"`
+	Error       *string        `json:"error,omitempty"`
+	CreatedAt   string         `json:"createdAt,omitempty"`
+	StartedAt   *string        `json:"startedAt,omitempty"`
+	CompletedAt *string        `json:"completedAt,omitempty"`
+}
+
+// ErasureReport counts what an erasure removed or anonymized
+type ErasureReport struct {
+	Requests          int64 `json:"requests"`
+	Responses         int64 `json:"responses"`
+	Comments          int64 `json:"comments"`
+	Reminders         int64 `json:"reminders"`
+	Files             int64 `json:"files"`
+	Identities        int64 `json:"identities"`
+	Devices           int64 `json:"devices"`
+	TelegramChats     int64 `json:"telegramChats"`
+	CalendarFeeds     int64 `json:"calendarFeeds"`
+	WebhookDeliveries int64 `json:"webhookDeliveries"`
+	Objects           int64 `json:"objects"`       // Storage objects deleted
+	ObjectsFailed     int64 `json:"objectsFailed"` // Storage objects that could not be deleted
+	Events            int64 `json:"events"`        // Stream events deleted
+	EntityDeleted     bool  `json:"entityDeleted"`
+}
+
+// EntityMerge is the outcome of merging one entity into another
+type EntityMerge struct {
+	SourceID string      `json:"sourceId"`
+	Target   *Entity     `json:"target"`
+	Report   MergeReport `json:"report"`
+}
+
+// MergeReport counts what a merge moved from the source entity to the
+// target
+type MergeReport struct {
+	Requests           int64 `json:"requests"`
+	Claims             int64 `json:"claims"`
+	Responses          int64 `json:"responses"`
+	Comments           int64 `json:"comments"`
+	Flows              int64 `json:"flows"`
+	Bundles            int64 `json:"bundles"`
+	ShareLinks         int64 `json:"shareLinks"` // Share links the source answered through
+	Reminders          int64 `json:"reminders"`
+	Identities         int64 `json:"identities"`
+	Devices            int64 `json:"devices"`
+	TelegramChats      int64 `json:"telegramChats"` // Moved only if the target has none
+	CalendarFeeds      int64 `json:"calendarFeeds"` // Moved only if the target has none
+	SavedViews         int64 `json:"savedViews"`
+	MaintenanceWindows int64 `json:"maintenanceWindows"`
+	BusinessCalendars  int64 `json:"businessCalendars"` // Moved only if the target has none
+	Preferences        int64 `json:"preferences"`
+	Redirects          int64 `json:"redirects"` // Earlier merges into the source, now pointing at the target
 }
 
 // Flow represents a durable workflow
 type Flow struct {
-	ID          string                 `json:"id"`
-	Kind        string                 `json:"kind"`
-	OwnerEntity string                 `json:"ownerEntity"`
-	Status      FlowStatus             `json:"status"`
-	Cursor      map[string]interface{} `json:"cursor"`
-	LastEventID *string                `json:"lastEventId,omitempty"`
-	CreatedAt   string                 `json:"createdAt,omitempty"`
-	UpdatedAt   string                 `json:"updatedAt,omitempty"`
+	ID           string                 `json:"id"`
+	Kind         string                 `json:"kind"`
+	OwnerEntity  string                 `json:"ownerEntity"`
+	Status       FlowStatus             `json:"status"`
+	Cursor       map[string]interface{} `json:"cursor"`
+	LastEventID  *string                `json:"lastEventId,omitempty"`
+	ParentFlowID *string                `json:"parentFlowId,omitempty"`
+	Children     []*Flow                `json:"children,omitempty"` // Set when the flow tree is requested
+	CreatedAt    string                 `json:"createdAt,omitempty"`
+	UpdatedAt    string                 `json:"updatedAt,omitempty"`
+	ArchivedStatus FlowStatus           `json:"archivedStatus,omitempty"` // How an ARCHIVED flow finished
+	ArchivedAt   string                 `json:"archivedAt,omitempty"`
 }
 
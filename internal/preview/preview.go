@@ -0,0 +1,176 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // Register decoders
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the type of generated previews
+const ContentType = "image/jpeg"
+
+// maxPixels rejects images that would take too much memory to decode
+const maxPixels = 50_000_000
+
+// ErrUnsupported is returned for content types without a preview
+var ErrUnsupported = errors.New("preview not supported for this content type")
+
+// Generator renders small JPEG previews of images and PDFs
+type Generator struct {
+	// MaxSize bounds the width and height of a preview in pixels
+	MaxSize int
+	// PDFToPPM is the path of poppler's pdftoppm, used to render the first
+	// page of PDFs; PDFs are not previewed if empty
+	PDFToPPM string
+}
+
+// NewGeneratorFromEnv creates a generator sized by THUMBNAIL_SIZE (default
+// 256). pdftoppm is taken from PDFTOPPM_PATH or looked up in PATH.
+func NewGeneratorFromEnv() *Generator {
+	g := &Generator{MaxSize: 256}
+	if v := os.Getenv("THUMBNAIL_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			g.MaxSize = n
+		}
+	}
+	if p := os.Getenv("PDFTOPPM_PATH"); p != "" {
+		g.PDFToPPM = p
+	} else if p, err := exec.LookPath("pdftoppm"); err == nil {
+		g.PDFToPPM = p
+	}
+	return g
+}
+
+// Supports reports whether a preview can be generated for contentType
+func (g *Generator) Supports(contentType string) bool {
+	switch mediaType(contentType) {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	case "application/pdf":
+		return g.PDFToPPM != ""
+	}
+	return false
+}
+
+// Generate renders a preview of r, which holds content of contentType
+func (g *Generator) Generate(ctx context.Context, r io.Reader, contentType string) ([]byte, error) {
+	if !g.Supports(contentType) {
+		return nil, ErrUnsupported
+	}
+	if mediaType(contentType) == "application/pdf" {
+		page, err := g.renderPDF(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(page)
+	}
+	return g.thumbnail(r)
+}
+
+func (g *Generator) thumbnail(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large to preview", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(io.MultiReader(&buf, r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, Scale(src, g.MaxSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// renderPDF renders the first page of a PDF to PNG with pdftoppm
+func (g *Generator) renderPDF(ctx context.Context, r io.Reader) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "pxbox-preview-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, err := os.Create(dir + "/in.pdf")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(in, r)
+	in.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, g.PDFToPPM, "-png", "-singlefile", "-f", "1", "-l", "1",
+		"-scale-to", strconv.Itoa(g.MaxSize), dir+"/in.pdf", dir+"/page")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(dir + "/page.png")
+}
+
+// Scale shrinks src to fit within maxSize x maxSize, averaging the source
+// pixels covered by each output pixel. Transparent areas become white, since
+// JPEG has no alpha. Images that already fit are only flattened.
+func Scale(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSize || h > maxSize {
+		if w >= h {
+			w, h = maxSize, max(1, h*maxSize/b.Dx())
+		} else {
+			w, h = max(1, w*maxSize/b.Dy()), maxSize
+		}
+	}
+
+	flat := image.NewRGBA(b)
+	draw.Draw(flat, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, b, src, b.Min, draw.Over)
+	if w == b.Dx() && h == b.Dy() {
+		return flat
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := flat.RGBAAt(sx, sy)
+					r += uint32(c.R)
+					g += uint32(c.G)
+					bl += uint32(c.B)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return dst
+}
+
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
@@ -0,0 +1,59 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+
+	dst := Scale(src, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 25), dst.Bounds())
+	r, g, b, _ := dst.At(50, 10).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	assert.Zero(t, g)
+	assert.Zero(t, b)
+
+	// Small images keep their size
+	assert.Equal(t, image.Rect(0, 0, 400, 100), Scale(src, 500).Bounds())
+
+	// Transparency is flattened onto white
+	clear := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	r, g, b, _ = Scale(clear, 10).At(5, 5).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, b})
+}
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1000, 500))))
+
+	g := &Generator{MaxSize: 64}
+	out, err := g.Generate(context.Background(), &buf, "image/png")
+	require.NoError(t, err)
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	require.NoError(t, err)
+	assert.Equal(t, 64, cfg.Width)
+	assert.Equal(t, 32, cfg.Height)
+
+	_, err = g.Generate(context.Background(), strings.NewReader("%PDF-1.4"), "application/pdf")
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	_, err = g.Generate(context.Background(), strings.NewReader("not an image"), "image/png")
+	assert.Error(t, err)
+}
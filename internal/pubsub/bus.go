@@ -3,39 +3,156 @@ package pubsub
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"os"
+	"time"
 
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+
+	"github.com/oklog/ulid/v2"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
 type Bus struct {
-	rdb     *redis.Client
-	log     *zap.Logger
-	ctx     context.Context
-	wsHub   WSHub
-	streams *Streams
+	broadcaster Broadcaster
+	listener    *PGNotifier // Set with the Postgres backend
+	log         *zap.Logger
+	ctx         context.Context
+	wsHub       WSHub
+	streams     EventStore
+	hooks       Dispatcher
+	format      EventFormat
+	sink        Sink
+}
+
+// Broadcaster announces published events outside the process: Redis
+// pub/sub or Postgres NOTIFY
+type Broadcaster interface {
+	Broadcast(channel string, seq int64, event map[string]interface{}, data []byte) error
+}
+
+// EventStore keeps published events for replay: Redis Streams or the
+// stream_events table
+type EventStore interface {
+	PublishEvent(channel string, event map[string]interface{}) (int64, error)
+	GetLastSequence(channel, connectionID string) (int64, error)
+	AcknowledgeSequence(channel, connectionID string, sequence int64) error
+	ReplayEvents(channel string, sinceSeq int64, limit int64) ([]StreamEvent, error)
+	DeleteEvents(channel string) (int64, error)
+	DeleteEventsWhere(channel string, match func(event map[string]interface{}) bool) (int64, error)
+	SetRetention(policies map[string]Retention)
+	RetentionFor(channel string) Retention
 }
 
 type WSHub interface {
 	Publish(channel string, message map[string]interface{})
 }
 
+// Dispatcher receives every published event, e.g. to deliver it to the
+// webhooks subscribed to its channel
+type Dispatcher interface {
+	Dispatch(channel string, event map[string]interface{})
+}
+
+// New creates a bus on Redis: pub/sub for announcing events and Streams
+// for replay
 func New(rdb *redis.Client, log *zap.Logger) *Bus {
 	return &Bus{
-		rdb:     rdb,
+		broadcaster: redisBroadcaster{rdb: rdb},
+		log:         log,
+		ctx:         context.Background(),
+		streams:     NewStreams(rdb, log),
+	}
+}
+
+// NewPostgres creates a bus on Postgres alone: NOTIFY for announcing events,
+// which Listen delivers to the hubs of the other processes, and the
+// stream_events table for replay
+func NewPostgres(pool *db.Pool, log *zap.Logger) *Bus {
+	streams := NewPGStreams(pool.Queries, log)
+	notifier := &PGNotifier{
+		pool:    pool.Pool,
+		queries: pool.Queries,
+		streams: streams,
+		origin:  ulid.Make().String(),
 		log:     log,
-		ctx:     context.Background(),
-		streams: NewStreams(rdb, log),
+	}
+	return &Bus{
+		broadcaster: notifier,
+		listener:    notifier,
+		log:         log,
+		ctx:         context.Background(),
+		streams:     streams,
 	}
 }
 
+// NewFromEnv creates the bus selected by EVENT_BACKEND: "redis" (default)
+// or "postgres". rdb may be nil with the Postgres backend.
+func NewFromEnv(rdb *redis.Client, pool *db.Pool, log *zap.Logger) (*Bus, error) {
+	switch backend := os.Getenv("EVENT_BACKEND"); backend {
+	case "", "redis":
+		if rdb == nil {
+			return nil, fmt.Errorf("EVENT_BACKEND=redis needs a Redis connection")
+		}
+		return New(rdb, log), nil
+	case "postgres":
+		return NewPostgres(pool, log), nil
+	default:
+		return nil, fmt.Errorf("unknown EVENT_BACKEND %q (use redis or postgres)", backend)
+	}
+}
+
+// Listen delivers the events published by other processes to the WebSocket
+// hub until ctx is done. Only the Postgres backend delivers between
+// processes; with Redis it returns at once.
+func (b *Bus) Listen(ctx context.Context) {
+	if b.listener == nil {
+		return
+	}
+	b.listener.Listen(ctx, func(channel string, event map[string]interface{}) {
+		if b.wsHub != nil {
+			b.wsHub.Publish(channel, event)
+		}
+	})
+}
+
 // SetWSHub sets the WebSocket hub for event broadcasting
 func (b *Bus) SetWSHub(hub WSHub) {
 	b.wsHub = hub
 }
 
-// GetStreams returns the streams provider
-func (b *Bus) GetStreams() *Streams {
+// Sink mirrors published events to an external system such as Kafka or
+// NATS. Send is called in publish order and must not block on the network.
+type Sink interface {
+	Send(channel string, seq int64, data []byte) error
+	Close() error
+}
+
+// SetSink sets the sink every published event is mirrored to
+func (b *Bus) SetSink(s Sink) {
+	b.sink = s
+}
+
+// SetEventFormat sets the format events are published to Redis pub/sub and
+// the sink in
+func (b *Bus) SetEventFormat(f EventFormat) {
+	b.format = f
+}
+
+// EventFormat returns the format events are published in outside pxbox
+func (b *Bus) EventFormat() EventFormat {
+	return b.format
+}
+
+// SetDispatcher sets the dispatcher published events are handed to
+func (b *Bus) SetDispatcher(d Dispatcher) {
+	b.hooks = d
+}
+
+// GetStreams returns the event store
+func (b *Bus) GetStreams() EventStore {
 	return b.streams
 }
 
@@ -57,40 +174,87 @@ func (b *Bus) PublishRequestor(clientID string, event map[string]interface{}) er
 	return b.Publish(channel, event)
 }
 
-// Publish publishes an event to a channel
+// PublishOps publishes an operational event, such as a failed background
+// job, to the "ops" channel
+func (b *Bus) PublishOps(event map[string]interface{}) error {
+	return b.Publish("ops", event)
+}
+
+// Publish publishes an event to a channel. Events that do not match their
+// registered shape (see package events) are refused.
 func (b *Bus) Publish(channel string, event map[string]interface{}) error {
-	data, err := json.Marshal(event)
-	if err != nil {
+	if err := events.Validate(event); err != nil {
+		b.log.Error("Refusing to publish invalid event", zap.String("channel", channel), zap.Error(err))
 		return err
 	}
 
-	// Publish to Redis pub/sub
-	err = b.rdb.Publish(b.ctx, channel, data).Err()
+	data, err := json.Marshal(b.format.Encode(channel, event, "", time.Now()))
 	if err != nil {
-		b.log.Error("Failed to publish event", zap.String("channel", channel), zap.Error(err))
 		return err
 	}
 
-	// Also publish to Redis Streams for replay
+	// Store for replay first, so announcements carry the sequence
 	seq, err := b.streams.PublishEvent(channel, event)
 	if err != nil {
 		b.log.Warn("Failed to publish to stream", zap.String("channel", channel), zap.Error(err))
 		// Continue even if stream publish fails
 	}
 
-	// Add sequence number to event for WebSocket
-	eventWithSeq := make(map[string]interface{})
-	for k, v := range event {
-		eventWithSeq[k] = v
+	// Announce to other processes
+	if err := b.broadcaster.Broadcast(channel, seq, event, data); err != nil {
+		b.log.Error("Failed to publish event", zap.String("channel", channel), zap.Error(err))
+		return err
 	}
-	eventWithSeq["seq"] = seq
+
+	// Mirror to the external sink, in the same format as pub/sub
+	if b.sink != nil {
+		if err := b.sink.Send(channel, seq, data); err != nil {
+			b.log.Warn("Failed to mirror event to sink", zap.String("channel", channel), zap.Error(err))
+		}
+	}
+
+	eventWithSeq := withSeq(event, seq)
 
 	// Broadcast to WebSocket hub if available
 	if b.wsHub != nil {
 		b.wsHub.Publish(channel, eventWithSeq)
 	}
 
+	// Hand off to webhooks without holding up the publisher
+	if b.hooks != nil {
+		go b.hooks.Dispatch(channel, eventWithSeq)
+	}
+
 	b.log.Debug("Published event", zap.String("channel", channel), zap.Int64("seq", seq), zap.String("event", string(data)))
 	return nil
 }
 
+// withSeq returns a copy of event with its sequence number, as sent to
+// WebSocket clients
+func withSeq(event map[string]interface{}, seq int64) map[string]interface{} {
+	out := make(map[string]interface{}, len(event)+1)
+	for k, v := range event {
+		out[k] = v
+	}
+	out["seq"] = seq
+	return out
+}
+
+// redisBroadcaster publishes events to Redis pub/sub in the configured
+// format
+type redisBroadcaster struct {
+	rdb *redis.Client
+}
+
+func (r redisBroadcaster) Broadcast(channel string, seq int64, event map[string]interface{}, data []byte) error {
+	return r.rdb.Publish(context.Background(), channel, data).Err()
+}
+
+// MarkSandbox flags an event as concerning sandbox data, so consumers can
+// tell test traffic apart. Events about regular data are returned unchanged.
+func MarkSandbox(event map[string]interface{}, sandbox bool) map[string]interface{} {
+	if sandbox {
+		event["sandbox"] = true
+	}
+	return event
+}
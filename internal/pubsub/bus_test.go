@@ -0,0 +1,36 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"pxbox/internal/events"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("EVENT_BACKEND", "kafka")
+	_, err := NewFromEnv(nil, nil, zap.NewNop())
+	assert.Error(t, err)
+
+	t.Setenv("EVENT_BACKEND", "")
+	_, err = NewFromEnv(nil, nil, zap.NewNop())
+	assert.Error(t, err, "the Redis backend needs a client")
+}
+
+func TestWithSeq(t *testing.T) {
+	event := map[string]interface{}{"type": "request.created"}
+	assert.Equal(t, map[string]interface{}{"type": "request.created", "seq": int64(7)}, withSeq(event, 7))
+	assert.NotContains(t, event, "seq")
+}
+
+func TestPublishRefusesInvalidEvents(t *testing.T) {
+	b := New(nil, zap.NewNop())
+	for _, event := range []map[string]interface{}{
+		{"type": "request.created", "requestId": "r1"},
+		{"type": "request.sent", "version": 1, "occurredAt": "2024-01-01T00:00:00Z", "data": map[string]interface{}{}},
+	} {
+		assert.ErrorIs(t, b.Publish("entity:e1", event), events.ErrInvalid)
+	}
+}
@@ -0,0 +1,94 @@
+package pubsub
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"pxbox/internal/events"
+)
+
+// CloudEventsContentType is the content type of a CloudEvent in structured
+// mode
+const CloudEventsContentType = "application/cloudevents+json"
+
+// cloudEventTypePrefix namespaces event types, e.g. "pxbox.request.answered"
+const cloudEventTypePrefix = "pxbox."
+
+// EventFormat selects how events are encoded for consumers outside pxbox:
+// Redis pub/sub subscribers and webhooks. WebSocket clients always get the
+// native envelope.
+type EventFormat struct {
+	CloudEvents bool
+	Source      string // CloudEvents source attribute
+}
+
+// EventFormatFromEnv reads EVENT_FORMAT, "native" (the default) or
+// "cloudevents", and EVENT_SOURCE, the source of CloudEvents (default
+// "pxbox")
+func EventFormatFromEnv() (EventFormat, error) {
+	f := EventFormat{Source: os.Getenv("EVENT_SOURCE")}
+	if f.Source == "" {
+		f.Source = "pxbox"
+	}
+	switch strings.ToLower(os.Getenv("EVENT_FORMAT")) {
+	case "", "native":
+	case "cloudevents":
+		f.CloudEvents = true
+	default:
+		return f, fmt.Errorf("invalid EVENT_FORMAT %q; use native or cloudevents", os.Getenv("EVENT_FORMAT"))
+	}
+	return f, nil
+}
+
+// Encode returns event in the format, as published on channel. id and at
+// identify the occurrence; without an id one is derived from the event's
+// sequence number.
+func (f EventFormat) Encode(channel string, event map[string]interface{}, id string, at time.Time) map[string]interface{} {
+	if !f.CloudEvents {
+		return event
+	}
+	return ToCloudEvent(f.Source, channel, event, id, at)
+}
+
+// ToCloudEvent wraps an event in a CloudEvents 1.0 envelope. The event
+// itself, with its version and data, becomes the data; its type is
+// prefixed with "pxbox." and the request, flow or entity it concerns
+// becomes the subject.
+func ToCloudEvent(source, channel string, event map[string]interface{}, id string, at time.Time) map[string]interface{} {
+	if id == "" {
+		if seq, ok := event["seq"].(int64); ok && seq > 0 {
+			id = fmt.Sprintf("%s/%d", channel, seq)
+		} else {
+			id = ulid.Make().String()
+		}
+	}
+	eventType, _ := event["type"].(string)
+	ce := map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              id,
+		"source":          source,
+		"type":            cloudEventTypePrefix + eventType,
+		"time":            at.UTC().Format(time.RFC3339Nano),
+		"datacontenttype": "application/json",
+		"pxboxchannel":    channel,
+		"data":            event,
+	}
+	if subject := eventSubject(event); subject != "" {
+		ce["subject"] = subject
+	}
+	return ce
+}
+
+// eventSubject names what an event is about, e.g. "request/<id>"
+func eventSubject(event map[string]interface{}) string {
+	for _, key := range []string{"requestId", "flowId", "entityId"} {
+		if id := events.String(event, key); id != "" {
+			return strings.TrimSuffix(key, "Id") + "/" + id
+		}
+	}
+	return ""
+}
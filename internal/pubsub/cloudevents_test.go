@@ -0,0 +1,52 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventFormatFromEnv(t *testing.T) {
+	t.Setenv("EVENT_FORMAT", "")
+	t.Setenv("EVENT_SOURCE", "")
+	f, err := EventFormatFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, EventFormat{Source: "pxbox"}, f)
+
+	t.Setenv("EVENT_FORMAT", "CloudEvents")
+	t.Setenv("EVENT_SOURCE", "https://pxbox.example.com")
+	f, err = EventFormatFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, EventFormat{CloudEvents: true, Source: "https://pxbox.example.com"}, f)
+
+	t.Setenv("EVENT_FORMAT", "xml")
+	_, err = EventFormatFromEnv()
+	assert.Error(t, err)
+}
+
+func TestEventFormatEncode(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := map[string]interface{}{"type": "request.answered", "version": 1, "data": map[string]interface{}{"requestId": "r1"}, "seq": int64(7)}
+
+	native := EventFormat{Source: "pxbox"}
+	assert.Equal(t, event, native.Encode("requestor:c1", event, "", at))
+
+	ce := EventFormat{CloudEvents: true, Source: "pxbox"}.Encode("requestor:c1", event, "", at)
+	assert.Equal(t, map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              "requestor:c1/7",
+		"source":          "pxbox",
+		"type":            "pxbox.request.answered",
+		"subject":         "request/r1",
+		"time":            "2024-01-01T12:00:00Z",
+		"datacontenttype": "application/json",
+		"pxboxchannel":    "requestor:c1",
+		"data":            event,
+	}, ce)
+
+	ce = ToCloudEvent("pxbox", "entity:e1", map[string]interface{}{"type": "flow.completed", "data": map[string]interface{}{"flowId": "f1"}}, "d1", at)
+	assert.Equal(t, "d1", ce["id"])
+	assert.Equal(t, "flow/f1", ce["subject"])
+}
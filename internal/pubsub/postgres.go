@@ -0,0 +1,315 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// NotifyChannel is the Postgres NOTIFY channel events are announced on
+// with EVENT_BACKEND=postgres
+const NotifyChannel = "pxbox_events"
+
+// maxNotifyPayload keeps NOTIFY payloads below Postgres' 8000 byte limit;
+// larger events are announced by sequence and read from stream_events
+const maxNotifyPayload = 7900
+
+// sweepInterval is how often events past their retention age are removed
+// from channels that have gone quiet
+const sweepInterval = 10 * time.Minute
+
+// PGStreams keeps events for replay in the stream_events table, in place of
+// Redis Streams
+type PGStreams struct {
+	retentions
+
+	queries *db.Queries
+	log     *zap.Logger
+	ctx     context.Context
+}
+
+// NewPGStreams creates an event store on Postgres
+func NewPGStreams(queries *db.Queries, log *zap.Logger) *PGStreams {
+	return &PGStreams{queries: queries, log: log, ctx: context.Background()}
+}
+
+// PublishEvent stores an event under the channel's next sequence number,
+// trimming the channel to its retention
+func (s *PGStreams) PublishEvent(channel string, event map[string]interface{}) (int64, error) {
+	r := s.RetentionFor(channel)
+	seq, err := s.queries.AppendStreamEvent(s.ctx, channel, event, r.MaxLen, r.MaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store event: %w", err)
+	}
+	return seq, nil
+}
+
+// GetLastSequence gets the last acknowledged sequence for a channel and connection
+func (s *PGStreams) GetLastSequence(channel, connectionID string) (int64, error) {
+	seq, err := s.queries.GetStreamAck(s.ctx, channel, connectionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// AcknowledgeSequence records an acknowledgment for a sequence number
+func (s *PGStreams) AcknowledgeSequence(channel, connectionID string, sequence int64) error {
+	if err := s.queries.SetStreamAck(s.ctx, channel, connectionID, sequence); err != nil {
+		return fmt.Errorf("failed to acknowledge sequence: %w", err)
+	}
+	return nil
+}
+
+// ReplayEvents returns up to limit events of a channel with a sequence
+// number above sinceSeq, oldest first
+func (s *PGStreams) ReplayEvents(channel string, sinceSeq int64, limit int64) ([]StreamEvent, error) {
+	stored, err := s.queries.ListStreamEvents(s.ctx, channel, sinceSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	events := make([]StreamEvent, len(stored))
+	for i, e := range stored {
+		events[i] = StreamEvent{Channel: e.Channel, Sequence: e.Seq, Event: e.Event, Timestamp: e.CreatedAt}
+	}
+	return events, nil
+}
+
+// getEvent returns a single stored event
+func (s *PGStreams) getEvent(ctx context.Context, channel string, seq int64) (map[string]interface{}, error) {
+	e, err := s.queries.GetStreamEvent(ctx, channel, seq)
+	if err != nil {
+		return nil, err
+	}
+	return e.Event, nil
+}
+
+// DeleteEvents removes all stored events of a channel and returns how many
+// there were. The sequence counter is kept, so sequences are not reused.
+func (s *PGStreams) DeleteEvents(channel string) (int64, error) {
+	n, err := s.queries.DeleteStreamEvents(s.ctx, channel, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteEventsWhere removes the stored events of a channel for which match
+// returns true and returns how many it removed
+func (s *PGStreams) DeleteEventsWhere(channel string, match func(event map[string]interface{}) bool) (int64, error) {
+	var deleted int64
+	var since int64
+	for {
+		events, err := s.queries.ListStreamEvents(s.ctx, channel, since, 1000)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to read events: %w", err)
+		}
+
+		seqs := make([]int64, 0)
+		for _, e := range events {
+			if match(e.Event) {
+				seqs = append(seqs, e.Seq)
+			}
+		}
+		if len(seqs) > 0 {
+			n, err := s.queries.DeleteStreamEvents(s.ctx, channel, seqs)
+			deleted += n
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete events: %w", err)
+			}
+		}
+
+		if len(events) < 1000 {
+			return deleted, nil
+		}
+		since = events[len(events)-1].Seq
+	}
+}
+
+// Sweep removes the events past their retention age. Publishing trims the
+// channel published to; the sweep catches channels that went quiet.
+func (s *PGStreams) Sweep(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	policies := make(map[string]Retention, len(s.retention))
+	for kind, r := range s.retention {
+		policies[kind] = r
+	}
+	s.mu.RUnlock()
+
+	now := time.Now()
+	types := make([]string, 0, len(policies))
+	var deleted int64
+	for kind, r := range policies {
+		if kind == "default" {
+			continue
+		}
+		types = append(types, kind)
+		if r.MaxAge == 0 {
+			continue
+		}
+		n, err := s.queries.DeleteExpiredStreamEvents(ctx, []string{kind}, false, now.Add(-r.MaxAge))
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if r := s.RetentionFor("default"); r.MaxAge > 0 {
+		n, err := s.queries.DeleteExpiredStreamEvents(ctx, types, true, now.Add(-r.MaxAge))
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// notification is the payload of a NOTIFY on NotifyChannel
+type notification struct {
+	Origin  string                 `json:"o"`
+	Channel string                 `json:"c"`
+	Seq     int64                  `json:"s"`
+	Event   map[string]interface{} `json:"e,omitempty"` // Left out if too large
+}
+
+// PGNotifier announces events to the other processes with NOTIFY and
+// delivers the events they announce
+type PGNotifier struct {
+	pool    *pgxpool.Pool
+	queries *db.Queries
+	streams *PGStreams
+	origin  string
+	log     *zap.Logger
+}
+
+// Broadcast announces an event on NotifyChannel
+func (n *PGNotifier) Broadcast(channel string, seq int64, event map[string]interface{}, data []byte) error {
+	payload, err := json.Marshal(notification{Origin: n.origin, Channel: channel, Seq: seq, Event: event})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		if seq == 0 {
+			return fmt.Errorf("event of %d bytes is too large to announce without a stored copy", len(payload))
+		}
+		if payload, err = json.Marshal(notification{Origin: n.origin, Channel: channel, Seq: seq}); err != nil {
+			return err
+		}
+	}
+	return n.queries.NotifyEvent(context.Background(), NotifyChannel, string(payload))
+}
+
+// Listen passes the events other processes announce to deliver until ctx
+// is done, reconnecting when the connection fails. Events announced while
+// reconnecting are not delivered; clients catch up by replaying.
+func (n *PGNotifier) Listen(ctx context.Context, deliver func(channel string, event map[string]interface{})) {
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sweep.C:
+				if deleted, err := n.streams.Sweep(ctx); err != nil {
+					n.log.Warn("Failed to remove expired events", zap.Error(err))
+				} else if deleted > 0 {
+					n.log.Debug("Removed expired events", zap.Int64("count", deleted))
+				}
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		err := n.listen(ctx, deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		n.log.Warn("Event listener disconnected; reconnecting", zap.Error(err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (n *PGNotifier) listen(ctx context.Context, deliver func(channel string, event map[string]interface{})) error {
+	pooled, err := n.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays in LISTEN mode, so it does not go back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return err
+	}
+	for {
+		nt, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var msg notification
+		if err := json.Unmarshal([]byte(nt.Payload), &msg); err != nil {
+			n.log.Warn("Malformed event notification", zap.Error(err))
+			continue
+		}
+		if msg.Origin == n.origin {
+			continue
+		}
+		event := msg.Event
+		if event == nil {
+			if event, err = n.streams.getEvent(ctx, msg.Channel, msg.Seq); err != nil {
+				n.log.Warn("Failed to load announced event", zap.String("channel", msg.Channel), zap.Int64("seq", msg.Seq), zap.Error(err))
+				continue
+			}
+		}
+		deliver(msg.Channel, withSeq(event, msg.Seq))
+	}
+}
+
+// NewPGPresence creates presence tracking for one API instance on the
+// presence_leases and presence_last_seen tables, in place of Redis. A ttl
+// of 0 uses 60s.
+func NewPGPresence(queries *db.Queries, bus *Bus, instance string, ttl time.Duration, log *zap.Logger) *Presence {
+	return newPresence(pgPresence{queries: queries}, bus, instance, ttl, log)
+}
+
+// pgPresence keeps presence leases in Postgres
+type pgPresence struct {
+	queries *db.Queries
+}
+
+func (p pgPresence) renew(ctx context.Context, entityID, instance string, expiresAt time.Time) error {
+	return p.queries.RenewPresenceLease(ctx, entityID, instance, expiresAt)
+}
+
+func (p pgPresence) clear(ctx context.Context, entityID, instance string, lastSeenAt time.Time) error {
+	return p.queries.ClearPresenceLease(ctx, entityID, instance, lastSeenAt)
+}
+
+func (p pgPresence) online(ctx context.Context, entityID string) (bool, error) {
+	return p.queries.EntityOnline(ctx, entityID)
+}
+
+func (p pgPresence) lastSeen(ctx context.Context, entityID string) (*time.Time, error) {
+	t, err := p.queries.GetEntityLastSeen(ctx, entityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,213 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"pxbox/internal/events"
+)
+
+const defaultPresenceTTL = 60 * time.Second
+
+// PresenceStatus reports whether an entity has an open connection on any
+// instance
+type PresenceStatus struct {
+	EntityID   string     `json:"entityId"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+// Presence records which entities are connected, shared between API
+// instances through Redis (NewPresence) or Postgres (NewPGPresence). Each
+// instance holds a lease per connected entity and renews it while the
+// entity stays connected, so the leases of a crashed instance lapse after
+// the TTL. Transitions are published as entity.online and entity.offline
+// on the "presence:<id>" channel.
+type Presence struct {
+	store    presenceStore
+	bus      *Bus
+	log      *zap.Logger
+	instance string
+	ttl      time.Duration
+}
+
+// presenceStore keeps the leases of instances on entities and when each
+// entity was last seen
+type presenceStore interface {
+	// renew extends the lease of instance on entityID until expiresAt and
+	// drops lapsed leases of other instances
+	renew(ctx context.Context, entityID, instance string, expiresAt time.Time) error
+	// clear drops the lease of instance and records when entityID was last
+	// seen
+	clear(ctx context.Context, entityID, instance string, lastSeenAt time.Time) error
+	// online reports whether any instance holds an unexpired lease
+	online(ctx context.Context, entityID string) (bool, error)
+	// lastSeen returns when entityID was last seen, or nil
+	lastSeen(ctx context.Context, entityID string) (*time.Time, error)
+}
+
+// NewPresence creates presence tracking for one API instance on Redis. A
+// ttl of 0 uses 60s.
+func NewPresence(rdb *redis.Client, bus *Bus, instance string, ttl time.Duration, log *zap.Logger) *Presence {
+	return newPresence(redisPresence{rdb: rdb}, bus, instance, ttl, log)
+}
+
+func newPresence(store presenceStore, bus *Bus, instance string, ttl time.Duration, log *zap.Logger) *Presence {
+	if ttl <= 0 {
+		ttl = defaultPresenceTTL
+	}
+	return &Presence{store: store, bus: bus, log: log, instance: instance, ttl: ttl}
+}
+
+// Connected records that this instance gained its first connection of
+// entityID, announcing entity.online if no other instance had one
+func (p *Presence) Connected(entityID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wasOnline, err := p.store.online(ctx, entityID)
+	if err != nil {
+		p.log.Warn("Failed to read presence", zap.String("entityID", entityID), zap.Error(err))
+	}
+	if err := p.renew(ctx, entityID); err != nil {
+		p.log.Warn("Failed to record presence", zap.String("entityID", entityID), zap.Error(err))
+		return
+	}
+	if !wasOnline {
+		p.publish(ctx, entityID, events.EntityOnline{EntityID: entityID})
+	}
+}
+
+// Disconnected records that the last connection of entityID on this
+// instance closed, announcing entity.offline if no other instance has one
+func (p *Presence) Disconnected(entityID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if err := p.store.clear(ctx, entityID, p.instance, now); err != nil {
+		p.log.Warn("Failed to clear presence", zap.String("entityID", entityID), zap.Error(err))
+		return
+	}
+
+	online, err := p.store.online(ctx, entityID)
+	if err != nil {
+		p.log.Warn("Failed to read presence", zap.String("entityID", entityID), zap.Error(err))
+		return
+	}
+	if !online {
+		p.publish(ctx, entityID, events.EntityOffline{EntityID: entityID, LastSeenAt: now.UTC().Format(time.RFC3339)})
+	}
+}
+
+// Status returns the presence of entityID across all instances
+func (p *Presence) Status(ctx context.Context, entityID string) (PresenceStatus, error) {
+	status := PresenceStatus{EntityID: entityID}
+	online, err := p.store.online(ctx, entityID)
+	if err != nil {
+		return status, fmt.Errorf("failed to read presence: %w", err)
+	}
+	status.Online = online
+	if online {
+		return status, nil
+	}
+
+	lastSeen, err := p.store.lastSeen(ctx, entityID)
+	if err != nil {
+		return status, fmt.Errorf("failed to read last seen: %w", err)
+	}
+	if lastSeen != nil {
+		t := lastSeen.UTC()
+		status.LastSeenAt = &t
+	}
+	return status, nil
+}
+
+// Run renews this instance's leases for the entities returned by connected
+// until ctx is done
+func (p *Presence) Run(ctx context.Context, connected func() []string) {
+	ticker := time.NewTicker(p.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, entityID := range connected() {
+				if err := p.renew(ctx, entityID); err != nil {
+					p.log.Warn("Failed to renew presence", zap.String("entityID", entityID), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// renew extends this instance's lease on entityID
+func (p *Presence) renew(ctx context.Context, entityID string) error {
+	return p.store.renew(ctx, entityID, p.instance, time.Now().Add(p.ttl))
+}
+
+func (p *Presence) publish(ctx context.Context, entityID string, data events.Data) {
+	if err := p.bus.Publish("presence:"+entityID, events.New(ctx, data)); err != nil {
+		p.log.Warn("Failed to publish presence", zap.String("entityID", entityID), zap.Error(err))
+	}
+}
+
+// redisPresence keeps each entity's leases in the sorted set
+// "presence:entity:<id>", scored by their expiry, and when it was last seen
+// in "presence:lastseen:<id>"
+type redisPresence struct {
+	rdb *redis.Client
+}
+
+func presenceKey(entityID string) string {
+	return "presence:entity:" + entityID
+}
+
+func lastSeenKey(entityID string) string {
+	return "presence:lastseen:" + entityID
+}
+
+func (r redisPresence) renew(ctx context.Context, entityID, instance string, expiresAt time.Time) error {
+	key := presenceKey(entityID)
+	pipe := r.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: instance})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(time.Now().Unix(), 10))
+	pipe.Expire(ctx, key, 2*time.Until(expiresAt))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r redisPresence) clear(ctx context.Context, entityID, instance string, lastSeenAt time.Time) error {
+	pipe := r.rdb.TxPipeline()
+	pipe.ZRem(ctx, presenceKey(entityID), instance)
+	pipe.Set(ctx, lastSeenKey(entityID), lastSeenAt.Unix(), 0)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r redisPresence) online(ctx context.Context, entityID string) (bool, error) {
+	n, err := r.rdb.ZCount(ctx, presenceKey(entityID), strconv.FormatInt(time.Now().Unix(), 10), "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r redisPresence) lastSeen(ctx context.Context, entityID string) (*time.Time, error) {
+	secs, err := r.rdb.Get(ctx, lastSeenKey(entityID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := time.Unix(secs, 0)
+	return &t, nil
+}
@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// recordingHub keeps the types of the events delivered to it by channel
+type recordingHub struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func (h *recordingHub) Publish(channel string, message map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events[channel] = append(h.events[channel], message["type"].(string))
+}
+
+func (h *recordingHub) types(channel string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events[channel]
+}
+
+func TestPresence(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	hub := &recordingHub{events: map[string][]string{}}
+	bus := New(rdb, zap.NewNop())
+	bus.SetWSHub(hub)
+	a := NewPresence(rdb, bus, "api-a", time.Minute, zap.NewNop())
+	b := NewPresence(rdb, bus, "api-b", time.Minute, zap.NewNop())
+	ctx := context.Background()
+
+	status, err := a.Status(ctx, "ent-1")
+	require.NoError(t, err)
+	assert.Equal(t, PresenceStatus{EntityID: "ent-1"}, status)
+
+	// Only the first instance to see the entity announces it
+	a.Connected("ent-1")
+	b.Connected("ent-1")
+	assert.Equal(t, []string{"entity.online"}, hub.types("presence:ent-1"))
+	status, err = b.Status(ctx, "ent-1")
+	require.NoError(t, err)
+	assert.True(t, status.Online)
+	assert.Nil(t, status.LastSeenAt)
+
+	// ...and only the last one to lose it
+	a.Disconnected("ent-1")
+	assert.Equal(t, []string{"entity.online"}, hub.types("presence:ent-1"))
+	b.Disconnected("ent-1")
+	assert.Equal(t, []string{"entity.online", "entity.offline"}, hub.types("presence:ent-1"))
+	status, err = a.Status(ctx, "ent-1")
+	require.NoError(t, err)
+	assert.False(t, status.Online)
+	require.NotNil(t, status.LastSeenAt)
+	assert.WithinDuration(t, time.Now(), *status.LastSeenAt, 2*time.Second)
+}
+
+func TestPresenceLeaseLapses(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := redisPresence{rdb: rdb}
+	ctx := context.Background()
+
+	// A crashed instance's lease is not renewed
+	lapsed := redis.Z{Score: float64(time.Now().Add(-10 * time.Second).Unix()), Member: "api-a"}
+	require.NoError(t, rdb.ZAdd(ctx, presenceKey("ent-1"), lapsed).Err())
+	online, err := store.online(ctx, "ent-1")
+	require.NoError(t, err)
+	assert.False(t, online)
+
+	require.NoError(t, store.renew(ctx, "ent-1", "api-b", time.Now().Add(time.Minute)))
+	members, err := rdb.ZRange(ctx, presenceKey("ent-1"), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api-b"}, members, "lapsed leases are dropped on renewal")
+}
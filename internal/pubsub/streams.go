@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -20,11 +23,64 @@ type StreamEvent struct {
 	Timestamp time.Time
 }
 
+// Each channel's events are kept in the stream events:<channel>. An event's
+// entry ID is <seq>-0, where seq is the channel's counter in seq:<channel>,
+// so replay can start exactly after a sequence. The counter is incremented
+// and the entry added in one script, which keeps IDs in counter order across
+// instances.
+
+// DefaultRetention applies to channels without their own retention
+var DefaultRetention = Retention{MaxLen: 10000, MaxAge: 24 * time.Hour}
+
+// Retention limits how much history a channel's stream keeps
+type Retention struct {
+	MaxLen int64         // Approximate number of events kept; 0 is unlimited
+	MaxAge time.Duration // Events older than this are trimmed; 0 keeps them
+}
+
+// publishScript increments the channel's counter, adds the event under it
+// and trims the stream. Expired entries are removed from the head, at most
+// 100 per publish; the stream key expires when the channel stays idle for
+// MaxAge. The counter never expires, so sequences are not reused.
+//
+// KEYS: stream, counter. ARGV: data, timestamp (ms), max length, max age (ms)
+var publishScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+local maxLen = tonumber(ARGV[3])
+local maxAge = tonumber(ARGV[4])
+if maxLen > 0 then
+  redis.call('XADD', KEYS[1], 'MAXLEN', '~', maxLen, seq .. '-0', 'seq', seq, 'ts', ARGV[2], 'data', ARGV[1])
+else
+  redis.call('XADD', KEYS[1], seq .. '-0', 'seq', seq, 'ts', ARGV[2], 'data', ARGV[1])
+end
+if maxAge > 0 then
+  local cutoff = tonumber(ARGV[2]) - maxAge
+  local expired = nil
+  for _, entry in ipairs(redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', 100)) do
+    local fields = entry[2]
+    local ts = 0
+    for i = 1, #fields, 2 do
+      if fields[i] == 'ts' then ts = tonumber(fields[i + 1]) end
+    end
+    if ts >= cutoff then break end
+    expired = entry[1]
+  end
+  if expired then
+    local expiredSeq = tonumber(string.match(expired, '^(%d+)'))
+    redis.call('XTRIM', KEYS[1], 'MINID', (expiredSeq + 1) .. '-0')
+  end
+  redis.call('PEXPIRE', KEYS[1], maxAge)
+end
+return seq
+`)
+
 // Streams manages Redis Streams for event replay
 type Streams struct {
-	rdb  *redis.Client
-	log  *zap.Logger
-	ctx  context.Context
+	retentions
+
+	rdb *redis.Client
+	log *zap.Logger
+	ctx context.Context
 }
 
 // NewStreams creates a new Streams manager
@@ -36,71 +92,94 @@ func NewStreams(rdb *redis.Client, log *zap.Logger) *Streams {
 	}
 }
 
-// PublishEvent publishes an event to a Redis Stream with sequence number
-func (s *Streams) PublishEvent(channel string, event map[string]interface{}) (int64, error) {
-	streamKey := fmt.Sprintf("stream:%s", channel)
-	
-	// Get next sequence number
-	seq, err := s.getNextSequence(channel)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get sequence: %w", err)
+// retentions holds the retention per channel type of an event store
+type retentions struct {
+	mu        sync.RWMutex
+	retention map[string]Retention // By channel type, e.g. "entity"; "default" for the rest
+}
+
+// SetRetention sets the retention per channel type, the part of the channel
+// name before the first colon ("entity", "request", "ops", ...). The entry
+// "default" applies to the other channels; without it DefaultRetention does.
+func (r *retentions) SetRetention(policies map[string]Retention) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retention = policies
+}
+
+// RetentionFor returns the retention of a channel
+func (r *retentions) RetentionFor(channel string) Retention {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kind, _, _ := strings.Cut(channel, ":")
+	if p, ok := r.retention[kind]; ok {
+		return p
 	}
-	
-	// Add sequence to event
-	eventWithSeq := make(map[string]interface{})
-	for k, v := range event {
-		eventWithSeq[k] = v
+	if p, ok := r.retention["default"]; ok {
+		return p
 	}
-	eventWithSeq["seq"] = seq
-	eventWithSeq["channel"] = channel
-	eventWithSeq["timestamp"] = time.Now().Format(time.RFC3339)
-	
-	// Marshal event data
-	eventData, err := json.Marshal(eventWithSeq)
+	return DefaultRetention
+}
+
+// RetentionFromEnv reads STREAM_RETENTION, a comma-separated list of
+// <channel type>=<max length>/<max age> entries such as
+// "default=10000/24h,presence=100/1h,ops=50000/168h". Either limit may be 0.
+func RetentionFromEnv() (map[string]Retention, error) {
+	policies := map[string]Retention{}
+	for _, item := range strings.Split(os.Getenv("STREAM_RETENTION"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, limits, ok := strings.Cut(item, "=")
+		maxLen, maxAge, ok2 := strings.Cut(limits, "/")
+		if !ok || !ok2 || kind == "" {
+			return nil, fmt.Errorf("invalid STREAM_RETENTION entry %q", item)
+		}
+		n, err := strconv.ParseInt(maxLen, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid max length in STREAM_RETENTION entry %q", item)
+		}
+		age, err := time.ParseDuration(maxAge)
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("invalid max age in STREAM_RETENTION entry %q", item)
+		}
+		policies[kind] = Retention{MaxLen: n, MaxAge: age}
+	}
+	return policies, nil
+}
+
+// PublishEvent adds an event to the channel's stream and returns its
+// sequence number
+func (s *Streams) PublishEvent(channel string, event map[string]interface{}) (int64, error) {
+	data, err := json.Marshal(event)
 	if err != nil {
 		return 0, fmt.Errorf("failed to marshal event: %w", err)
 	}
-	
-	// Add to stream
-	args := redis.XAddArgs{
-		Stream: streamKey,
-		ID:     "*", // Auto-generate ID
-		Values: map[string]interface{}{
-			"data": string(eventData),
-		},
-	}
-	
-	id, err := s.rdb.XAdd(s.ctx, &args).Result()
+
+	r := s.RetentionFor(channel)
+	seq, err := publishScript.Run(s.ctx, s.rdb,
+		[]string{streamKey(channel), seqKey(channel)},
+		string(data), time.Now().UnixMilli(), r.MaxLen, r.MaxAge.Milliseconds(),
+	).Int64()
 	if err != nil {
 		return 0, fmt.Errorf("failed to add to stream: %w", err)
 	}
-	
-	// Parse sequence from ID (format: timestamp-sequence)
-	seqFromID, _ := parseStreamID(id)
-	if seqFromID > 0 {
-		seq = seqFromID
-	}
-	
+
 	s.log.Debug("Published event to stream",
 		zap.String("channel", channel),
 		zap.Int64("sequence", seq),
-		zap.String("stream_id", id),
 	)
-	
+
 	return seq, nil
 }
 
-// GetNextSequence gets the next sequence number for a channel
-func (s *Streams) getNextSequence(channel string) (int64, error) {
-	seqKey := fmt.Sprintf("seq:%s", channel)
-	
-	// Increment and get sequence
-	seq, err := s.rdb.Incr(s.ctx, seqKey).Result()
-	if err != nil {
-		return 0, fmt.Errorf("failed to increment sequence: %w", err)
-	}
-	
-	return seq, nil
+func streamKey(channel string) string {
+	return "events:" + channel
+}
+
+func seqKey(channel string) string {
+	return "seq:" + channel
 }
 
 // GetLastSequence gets the last acknowledged sequence for a channel and connection
@@ -141,107 +220,87 @@ func (s *Streams) AcknowledgeSequence(channel, connectionID string, sequence int
 	return nil
 }
 
-// ReplayEvents replays events from a given sequence number
+// ReplayEvents returns up to limit events of a channel with a sequence
+// number above sinceSeq, oldest first. Events that were trimmed are
+// skipped, so the first sequence returned can be above sinceSeq+1.
 func (s *Streams) ReplayEvents(channel string, sinceSeq int64, limit int64) ([]StreamEvent, error) {
-	streamKey := fmt.Sprintf("stream:%s", channel)
-	
-	// Convert sequence to stream ID (approximate)
-	// Format: timestamp-sequence (milliseconds-sequence)
-	startID := fmt.Sprintf("%d-%d", time.Now().Add(-24*time.Hour).UnixMilli(), sinceSeq)
-	
-	args := redis.XReadArgs{
-		Streams: []string{streamKey, startID},
-		Count:   limit,
-	}
-	
-	streams, err := s.rdb.XRead(s.ctx, &args).Result()
-	if err == redis.Nil {
-		return []StreamEvent{}, nil // No events
-	}
+	msgs, err := s.rdb.XRangeN(s.ctx, streamKey(channel), fmt.Sprintf("%d-0", sinceSeq+1), "+", limit).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read stream: %w", err)
 	}
-	
-	var events []StreamEvent
-	for _, stream := range streams {
-		for _, msg := range stream.Messages {
-			data, ok := msg.Values["data"].(string)
-			if !ok {
-				continue
-			}
-			
-			var eventData map[string]interface{}
-			if err := json.Unmarshal([]byte(data), &eventData); err != nil {
-				s.log.Warn("Failed to unmarshal event", zap.Error(err))
-				continue
-			}
-			
-			seq, _ := eventData["seq"].(float64)
-			channelName, _ := eventData["channel"].(string)
-			timestampStr, _ := eventData["timestamp"].(string)
-			
-			var timestamp time.Time
-			if timestampStr != "" {
-				timestamp, _ = time.Parse(time.RFC3339, timestampStr)
-			}
-			if timestamp.IsZero() {
-				timestamp = time.Now()
-			}
-			
-			// Remove metadata from event
-			event := make(map[string]interface{})
-			for k, v := range eventData {
-				if k != "seq" && k != "channel" && k != "timestamp" {
-					event[k] = v
-				}
-			}
-			
-			events = append(events, StreamEvent{
-				Channel:   channelName,
-				Sequence:  int64(seq),
-				Event:     event,
-				Timestamp: timestamp,
-			})
+
+	events := make([]StreamEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		data, _ := msg.Values["data"].(string)
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			s.log.Warn("Failed to unmarshal event", zap.String("channel", channel), zap.String("id", msg.ID), zap.Error(err))
+			continue
+		}
+
+		seqStr, _ := msg.Values["seq"].(string)
+		seq, err := strconv.ParseInt(seqStr, 10, 64)
+		if err != nil {
+			s.log.Warn("Stream entry without sequence", zap.String("channel", channel), zap.String("id", msg.ID))
+			continue
 		}
+		tsStr, _ := msg.Values["ts"].(string)
+		ts, _ := strconv.ParseInt(tsStr, 10, 64)
+
+		events = append(events, StreamEvent{
+			Channel:   channel,
+			Sequence:  seq,
+			Event:     event,
+			Timestamp: time.UnixMilli(ts),
+		})
 	}
-	
+
 	return events, nil
 }
 
-// parseStreamID parses a Redis Stream ID (format: timestamp-sequence)
-func parseStreamID(id string) (int64, error) {
-	parts := splitStreamID(id)
-	if len(parts) < 2 {
-		return 0, fmt.Errorf("invalid stream ID format")
-	}
-	
-	seq, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse sequence: %w", err)
+// DeleteEvents removes all stored events of a channel and returns how many
+// there were. The sequence counter is kept, so sequences are not reused.
+func (s *Streams) DeleteEvents(channel string) (int64, error) {
+	pipe := s.rdb.TxPipeline()
+	n := pipe.XLen(s.ctx, streamKey(channel))
+	pipe.Del(s.ctx, streamKey(channel))
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return 0, fmt.Errorf("failed to delete stream: %w", err)
 	}
-	
-	return seq, nil
+	return n.Val(), nil
 }
 
-// splitStreamID splits a Redis Stream ID into parts
-func splitStreamID(id string) []string {
-	// Redis Stream IDs are in format: timestamp-sequence
-	// They can also have "-0" suffix for auto-generated IDs
-	var parts []string
-	lastDash := -1
-	for i := len(id) - 1; i >= 0; i-- {
-		if id[i] == '-' {
-			lastDash = i
-			break
+// DeleteEventsWhere removes the stored events of a channel for which match
+// returns true and returns how many it removed
+func (s *Streams) DeleteEventsWhere(channel string, match func(event map[string]interface{}) bool) (int64, error) {
+	var deleted int64
+	start := "-"
+	for {
+		msgs, err := s.rdb.XRangeN(s.ctx, streamKey(channel), start, "+", 1000).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to read stream: %w", err)
 		}
+
+		var ids []string
+		for _, msg := range msgs {
+			data, _ := msg.Values["data"].(string)
+			var event map[string]interface{}
+			if json.Unmarshal([]byte(data), &event) == nil && match(event) {
+				ids = append(ids, msg.ID)
+			}
+		}
+		if len(ids) > 0 {
+			n, err := s.rdb.XDel(s.ctx, streamKey(channel), ids...).Result()
+			deleted += n
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete stream entries: %w", err)
+			}
+		}
+
+		if len(msgs) < 1000 {
+			return deleted, nil
+		}
+		// Continue exclusively after the last entry read
+		start = "(" + msgs[len(msgs)-1].ID
 	}
-	
-	if lastDash > 0 {
-		parts = append(parts, id[:lastDash], id[lastDash+1:])
-	} else {
-		parts = append(parts, id)
-	}
-	
-	return parts
 }
-
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionFromEnv(t *testing.T) {
+	t.Setenv("STREAM_RETENTION", "")
+	policies, err := RetentionFromEnv()
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	t.Setenv("STREAM_RETENTION", "default=500/2h, presence=100/0s,ops=0/168h")
+	policies, err = RetentionFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Retention{
+		"default":  {MaxLen: 500, MaxAge: 2 * time.Hour},
+		"presence": {MaxLen: 100},
+		"ops":      {MaxAge: 168 * time.Hour},
+	}, policies)
+
+	for _, bad := range []string{"default", "default=100", "=100/1h", "default=x/1h", "default=-1/1h", "default=100/soon"} {
+		t.Setenv("STREAM_RETENTION", bad)
+		_, err = RetentionFromEnv()
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRetentionFor(t *testing.T) {
+	s := NewStreams(nil, nil)
+	assert.Equal(t, DefaultRetention, s.RetentionFor("entity:e1"))
+
+	s.SetRetention(map[string]Retention{
+		"default":  {MaxLen: 50},
+		"presence": {MaxLen: 10, MaxAge: time.Minute},
+	})
+	assert.Equal(t, Retention{MaxLen: 10, MaxAge: time.Minute}, s.RetentionFor("presence:e1"))
+	assert.Equal(t, Retention{MaxLen: 50}, s.RetentionFor("entity:e1"))
+	assert.Equal(t, Retention{MaxLen: 50}, s.RetentionFor("ops"))
+}
@@ -0,0 +1,162 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	apnsEndpoint        = "https://api.push.apple.com"
+	apnsSandboxEndpoint = "https://api.sandbox.push.apple.com"
+	// apnsTokenTTL is how long a provider token is reused. APNs refuses
+	// tokens older than an hour and throttles providers that sign new ones
+	// more often than every 20 minutes.
+	apnsTokenTTL = 50 * time.Minute
+	// maxCollapseID is the longest apns-collapse-id APNs accepts
+	maxCollapseID = 64
+)
+
+// APNs sends messages through the APNs HTTP/2 provider API, authenticated
+// with a token signed by a .p8 signing key
+type APNs struct {
+	client   *http.Client
+	key      *ecdsa.PrivateKey
+	keyID    string
+	teamID   string
+	topic    string
+	endpoint string
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNs creates an APNs sender for the app topic (its bundle ID) with the
+// PEM signing key keyPEM. endpoint is the production or sandbox APNs, or a
+// test server.
+func NewAPNs(client *http.Client, keyPEM []byte, keyID, teamID, topic, endpoint string) (*APNs, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, fmt.Errorf("APNs needs a key ID, team ID and topic")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs signing key: %w", err)
+	}
+	return &APNs{client: client, key: key, keyID: keyID, teamID: teamID, topic: topic, endpoint: strings.TrimSuffix(endpoint, "/")}, nil
+}
+
+// APNsFromEnv creates an APNs sender from the signing key in APNS_KEY_FILE,
+// APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC, sending to the sandbox if
+// APNS_SANDBOX is true. It returns nil if APNS_KEY_FILE is not set.
+func APNsFromEnv(client *http.Client) (*APNs, error) {
+	path := os.Getenv("APNS_KEY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNS_KEY_FILE: %w", err)
+	}
+	endpoint := apnsEndpoint
+	if os.Getenv("APNS_SANDBOX") == "true" {
+		endpoint = apnsSandboxEndpoint
+	}
+	return NewAPNs(client, keyPEM, os.Getenv("APNS_KEY_ID"), os.Getenv("APNS_TEAM_ID"), os.Getenv("APNS_TOPIC"), endpoint)
+}
+
+// Send sends an alert to an APNs device token. The collapse key becomes the
+// apns-collapse-id and the data keys sit next to "aps".
+func (a *APNs) Send(ctx context.Context, token string, m Message) error {
+	aps := map[string]interface{}{
+		"alert": map[string]string{"title": m.Title, "body": m.Body},
+		"sound": "default",
+	}
+	if m.Badge != nil {
+		aps["badge"] = *m.Badge
+	}
+	payload := map[string]interface{}{}
+	for k, v := range m.Data {
+		payload[k] = v
+	}
+	payload["aps"] = aps
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	providerToken, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	if m.CollapseKey != "" && len(m.CollapseKey) <= maxCollapseID {
+		req.Header.Set("apns-collapse-id", m.CollapseKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("APNs request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&failure)
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		failure.Reason == "BadDeviceToken",
+		failure.Reason == "DeviceTokenNotForTopic":
+		return ErrInvalidToken
+	case failure.Reason == "ExpiredProviderToken":
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	}
+	return fmt.Errorf("APNs returned %d: %s", resp.StatusCode, failure.Reason)
+}
+
+// providerToken returns the cached provider token, signing a new one when
+// it is due
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.issuedAt) < apnsTokenTTL {
+		return a.token, nil
+	}
+
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": a.teamID,
+		"iat": now.Unix(),
+	})
+	t.Header["kid"] = a.keyID
+	signed, err := t.SignedString(a.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign APNs token: %w", err)
+	}
+	a.token, a.issuedAt = signed, now
+	return signed, nil
+}
@@ -0,0 +1,220 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	fcmEndpoint = "https://fcm.googleapis.com"
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// ServiceAccount is the part of a Google service account key FCM needs
+type ServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCM sends messages through the FCM HTTP v1 API, authenticated with an
+// OAuth2 access token obtained for a service account
+type FCM struct {
+	client    *http.Client
+	account   ServiceAccount
+	key       *rsa.PrivateKey
+	projectID string
+	endpoint  string
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCM creates an FCM sender for the project of account, or projectID if
+// it is set. endpoint overrides https://fcm.googleapis.com, for tests.
+func NewFCM(client *http.Client, account ServiceAccount, projectID, endpoint string) (*FCM, error) {
+	if projectID == "" {
+		projectID = account.ProjectID
+	}
+	if projectID == "" || account.ClientEmail == "" || account.PrivateKey == "" || account.TokenURI == "" {
+		return nil, fmt.Errorf("FCM service account needs project_id, client_email, private_key and token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM private key: %w", err)
+	}
+	if endpoint == "" {
+		endpoint = fcmEndpoint
+	}
+	return &FCM{client: client, account: account, key: key, projectID: projectID, endpoint: strings.TrimSuffix(endpoint, "/")}, nil
+}
+
+// FCMFromEnv creates an FCM sender from the service account key in
+// FCM_CREDENTIALS_FILE, for the project in FCM_PROJECT_ID or the key's. It
+// returns nil if FCM_CREDENTIALS_FILE is not set.
+func FCMFromEnv(client *http.Client) (*FCM, error) {
+	path := os.Getenv("FCM_CREDENTIALS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM_CREDENTIALS_FILE: %w", err)
+	}
+	var account ServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("invalid FCM_CREDENTIALS_FILE: %w", err)
+	}
+	return NewFCM(client, account, os.Getenv("FCM_PROJECT_ID"), "")
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *fcmAndroid       `json:"android,omitempty"`
+}
+
+type fcmAndroid struct {
+	CollapseKey  string                 `json:"collapse_key,omitempty"`
+	Notification map[string]interface{} `json:"notification,omitempty"`
+}
+
+// Send sends a message to an FCM registration token. Android devices get
+// the collapse key as both collapse_key and notification tag, so a newer
+// notification replaces the shown one, and the badge as notification_count.
+func (f *FCM) Send(ctx context.Context, token string, m Message) error {
+	msg := fcmMessage{
+		Token:        token,
+		Notification: fcmNotification{Title: m.Title, Body: m.Body},
+		Data:         m.Data,
+	}
+	if m.CollapseKey != "" || m.Badge != nil {
+		msg.Android = &fcmAndroid{CollapseKey: m.CollapseKey, Notification: map[string]interface{}{}}
+		if m.CollapseKey != "" {
+			msg.Android.Notification["tag"] = m.CollapseKey
+		}
+		if m.Badge != nil {
+			msg.Android.Notification["notification_count"] = *m.Badge
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"message": msg})
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		f.endpoint+"/v1/projects/"+url.PathEscape(f.projectID)+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("FCM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&failure)
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrInvalidToken
+	}
+	for _, d := range failure.Error.Details {
+		if d.ErrorCode == "UNREGISTERED" {
+			return ErrInvalidToken
+		}
+	}
+	return fmt.Errorf("FCM returned %d %s: %s", resp.StatusCode, failure.Error.Status, failure.Error.Message)
+}
+
+// token returns a cached access token, exchanging a signed assertion for a
+// new one a minute before it expires
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Now().Add(time.Minute).Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("FCM token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("FCM token request returned %d", resp.StatusCode)
+	}
+	var result struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result); err != nil || result.AccessToken == "" {
+		return "", fmt.Errorf("invalid FCM token response: %v", err)
+	}
+	seconds, _ := strconv.Atoi(result.ExpiresIn.String())
+	if seconds <= 0 {
+		seconds = 3600
+	}
+	f.accessToken = result.AccessToken
+	f.expiresAt = now.Add(time.Duration(seconds) * time.Second)
+	return f.accessToken, nil
+}
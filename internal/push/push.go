@@ -0,0 +1,92 @@
+// Package push sends mobile push notifications through Firebase Cloud
+// Messaging and the Apple Push Notification service
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Device platforms
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+)
+
+// ErrInvalidToken is returned when the push service reports a device token
+// as unregistered or malformed; the token should be forgotten
+var ErrInvalidToken = errors.New("push token is no longer valid")
+
+// Message is a push notification
+type Message struct {
+	Title string
+	Body  string
+	// CollapseKey makes a newer notification with the same key replace an
+	// undelivered or displayed older one
+	CollapseKey string
+	// Badge is the app icon badge count; nil leaves it unchanged
+	Badge *int
+	// Data is passed to the app with the notification
+	Data map[string]string
+}
+
+// Sender delivers messages to the devices of one platform
+type Sender interface {
+	Send(ctx context.Context, token string, m Message) error
+}
+
+// Gateway sends messages through the sender of each configured platform
+type Gateway struct {
+	senders map[string]Sender
+}
+
+// NewGateway creates a gateway from senders by platform
+func NewGateway(senders map[string]Sender) *Gateway {
+	return &Gateway{senders: senders}
+}
+
+// FromEnv configures FCM from FCM_CREDENTIALS_FILE and APNs from
+// APNS_KEY_FILE (see FCMFromEnv and APNsFromEnv). It returns nil if
+// neither is set.
+func FromEnv() (*Gateway, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	senders := map[string]Sender{}
+
+	fcm, err := FCMFromEnv(client)
+	if err != nil {
+		return nil, err
+	}
+	if fcm != nil {
+		senders[PlatformFCM] = fcm
+	}
+	apns, err := APNsFromEnv(client)
+	if err != nil {
+		return nil, err
+	}
+	if apns != nil {
+		senders[PlatformAPNs] = apns
+	}
+
+	if len(senders) == 0 {
+		return nil, nil
+	}
+	return NewGateway(senders), nil
+}
+
+// Supports reports whether the gateway can send to platform
+func (g *Gateway) Supports(platform string) bool {
+	_, ok := g.senders[platform]
+	return ok
+}
+
+// Send sends a message to a device of platform
+func (g *Gateway) Send(ctx context.Context, platform, token string, m Message) error {
+	s, ok := g.senders[platform]
+	if !ok {
+		return fmt.Errorf("push platform %q is not configured", platform)
+	}
+	return s.Send(ctx, token, m)
+}
@@ -0,0 +1,108 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCMSend(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	tokenRequests := 0
+	var sent map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "expires_in": 3600})
+		case "/v1/projects/demo/messages:send":
+			assert.Equal(t, "Bearer at", r.Header.Get("Authorization"))
+			var body struct {
+				Message map[string]interface{} `json:"message"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			sent = body.Message
+			if sent["token"] == "gone" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+			}
+		default:
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	defer srv.Close()
+
+	fcm, err := NewFCM(srv.Client(), ServiceAccount{
+		ProjectID:   "demo",
+		ClientEmail: "push@demo.iam.gserviceaccount.com",
+		PrivateKey:  string(keyPEM),
+		TokenURI:    srv.URL + "/token",
+	}, "", srv.URL)
+	require.NoError(t, err)
+
+	badge := 3
+	msg := Message{Title: "New request", Body: "Invoice", CollapseKey: "r1", Badge: &badge, Data: map[string]string{"requestId": "r1"}}
+	require.NoError(t, fcm.Send(context.Background(), "device", msg))
+	assert.Equal(t, "device", sent["token"])
+	android := sent["android"].(map[string]interface{})
+	assert.Equal(t, "r1", android["collapse_key"])
+	assert.EqualValues(t, 3, android["notification"].(map[string]interface{})["notification_count"])
+
+	assert.ErrorIs(t, fcm.Send(context.Background(), "gone", msg), ErrInvalidToken)
+	assert.Equal(t, 1, tokenRequests, "the access token is reused")
+}
+
+func TestAPNsSend(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	var headers http.Header
+	var sent map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&sent))
+		switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		}
+	}))
+	defer srv.Close()
+
+	apns, err := NewAPNs(srv.Client(), keyPEM, "KEY123", "TEAM123", "com.example.pxbox", srv.URL)
+	require.NoError(t, err)
+
+	badge := 2
+	msg := Message{Title: "Due soon", Body: "Invoice", CollapseKey: "r1", Badge: &badge, Data: map[string]string{"requestId": "r1"}}
+	require.NoError(t, apns.Send(context.Background(), "abc", msg))
+	assert.Equal(t, "com.example.pxbox", headers.Get("apns-topic"))
+	assert.Equal(t, "r1", headers.Get("apns-collapse-id"))
+	assert.True(t, strings.HasPrefix(headers.Get("Authorization"), "bearer "))
+	assert.Equal(t, "r1", sent["requestId"])
+	assert.EqualValues(t, 2, sent["aps"].(map[string]interface{})["badge"])
+
+	assert.ErrorIs(t, apns.Send(context.Background(), "gone", msg), ErrInvalidToken)
+	assert.ErrorIs(t, apns.Send(context.Background(), "bad", msg), ErrInvalidToken)
+}
@@ -0,0 +1,52 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPScanner posts file content to an external scanning service. The
+// service answers 200 with {"infected": bool, "signature": "..."}.
+type HTTPScanner struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPScanner creates a scanner for the service at url. A nil client
+// uses one with a 2 minute timeout.
+func NewHTTPScanner(url string, client *http.Client) *HTTPScanner {
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+	return &HTTPScanner{url: url, client: client}
+}
+
+func (h *HTTPScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, r)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to reach scanner: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("scanner returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body); err != nil {
+		return Result{}, fmt.Errorf("invalid scanner response: %w", err)
+	}
+	return Result{Infected: body.Infected, Signature: body.Signature}, nil
+}
@@ -0,0 +1,96 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Scan statuses recorded on uploaded files
+const (
+	StatusNone     = "none"     // Not scanned: scanning was disabled at upload time
+	StatusPending  = "pending"  // Waiting for the scan job
+	StatusClean    = "clean"    // No threat found
+	StatusInfected = "infected" // Threat found; the object was quarantined
+	StatusError    = "error"    // Scanning failed after all retries
+)
+
+// QuarantinePrefix is where infected objects are moved in storage
+const QuarantinePrefix = "quarantine/"
+
+// Result is the outcome of scanning one file
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected threat, if any
+}
+
+// Scanner checks file content for malware
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Enabled reports whether a scanner is configured with SCAN_BACKEND
+func Enabled() bool {
+	return os.Getenv("SCAN_BACKEND") != ""
+}
+
+// NewFromEnv creates the scanner selected by SCAN_BACKEND: "clamav" talks
+// to clamd at CLAMAV_ADDR, "http" posts files to SCAN_HTTP_URL. It returns
+// nil if scanning is disabled.
+func NewFromEnv() (Scanner, error) {
+	switch backend := os.Getenv("SCAN_BACKEND"); backend {
+	case "":
+		return nil, nil
+	case "clamav":
+		addr := os.Getenv("CLAMAV_ADDR")
+		if addr == "" {
+			addr = "localhost:3310"
+		}
+		return NewClamAV(addr), nil
+	case "http":
+		url := os.Getenv("SCAN_HTTP_URL")
+		if url == "" {
+			return nil, fmt.Errorf("SCAN_BACKEND=http requires SCAN_HTTP_URL")
+		}
+		return NewHTTPScanner(url, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown SCAN_BACKEND %q", backend)
+	}
+}
+
+// Enforcement decides which files a response may reference, by scan status
+type Enforcement string
+
+const (
+	// EnforceClean only accepts files that were scanned clean, or uploaded
+	// while scanning was disabled
+	EnforceClean Enforcement = "clean"
+	// EnforceFailed rejects infected files and files whose scan failed, but
+	// accepts files still waiting for their scan
+	EnforceFailed Enforcement = "failed"
+	// EnforceOff accepts any file
+	EnforceOff Enforcement = "off"
+)
+
+// EnforcementFromEnv reads SCAN_ENFORCE, defaulting to EnforceClean
+func EnforcementFromEnv() Enforcement {
+	switch e := Enforcement(os.Getenv("SCAN_ENFORCE")); e {
+	case EnforceFailed, EnforceOff:
+		return e
+	default:
+		return EnforceClean
+	}
+}
+
+// Allows reports whether a file with the given scan status may be referenced
+func (e Enforcement) Allows(status string) bool {
+	switch e {
+	case EnforceOff:
+		return true
+	case EnforceFailed:
+		return status != StatusInfected && status != StatusError
+	default:
+		return status == StatusClean || status == StatusNone
+	}
+}
@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClamd accepts one INSTREAM session and replies based on the content
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			cmd, _ := r.ReadString(0)
+			if cmd != "zINSTREAM\x00" {
+				conn.Close()
+				continue
+			}
+			var content strings.Builder
+			for {
+				var size uint32
+				if err := binary.Read(r, binary.BigEndian, &size); err != nil || size == 0 {
+					break
+				}
+				io.CopyN(&content, r, int64(size))
+			}
+			if strings.Contains(content.String(), "EICAR") {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamAV(t *testing.T) {
+	c := NewClamAV(fakeClamd(t))
+
+	res, err := c.Scan(context.Background(), strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.False(t, res.Infected)
+
+	res, err = c.Scan(context.Background(), strings.NewReader("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR"))
+	require.NoError(t, err)
+	assert.True(t, res.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", res.Signature)
+}
+
+func TestParseClamReply(t *testing.T) {
+	_, err := parseClamReply("INSTREAM size limit exceeded. ERROR")
+	assert.Error(t, err)
+}
+
+func TestHTTPScanner(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		infected := strings.Contains(string(body), "virus")
+		json.NewEncoder(w).Encode(map[string]interface{}{"infected": infected, "signature": "Test.Virus"})
+	}))
+	defer srv.Close()
+
+	s := NewHTTPScanner(srv.URL, nil)
+	res, err := s.Scan(context.Background(), strings.NewReader("fine"))
+	require.NoError(t, err)
+	assert.False(t, res.Infected)
+
+	res, err = s.Scan(context.Background(), strings.NewReader("a virus"))
+	require.NoError(t, err)
+	assert.True(t, res.Infected)
+	assert.Equal(t, "Test.Virus", res.Signature)
+}
+
+func TestEnforcement(t *testing.T) {
+	assert.True(t, EnforceClean.Allows(StatusClean))
+	assert.True(t, EnforceClean.Allows(StatusNone))
+	assert.False(t, EnforceClean.Allows(StatusPending))
+	assert.False(t, EnforceClean.Allows(StatusInfected))
+
+	assert.True(t, EnforceFailed.Allows(StatusPending))
+	assert.False(t, EnforceFailed.Allows(StatusError))
+	assert.False(t, EnforceFailed.Allows(StatusInfected))
+
+	assert.True(t, EnforceOff.Allows(StatusInfected))
+}
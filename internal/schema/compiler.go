@@ -4,19 +4,35 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"pxbox/internal/metrics"
+
 	"github.com/hashicorp/golang-lru/v2/expirable"
 	js "github.com/santhosh-tekuri/jsonschema/v5"
 )
 
+// Drafts lists the JSON Schema drafts the compiler understands, identified
+// by their "$schema" URL. Schemas without "$schema" use the first one.
+var Drafts = []string{
+	js.Draft2020.URL(),
+	js.Draft2019.URL(),
+	js.Draft7.URL(),
+	js.Draft6.URL(),
+	js.Draft4.URL(),
+}
+
 type Compiler struct {
-	compiler      *js.Compiler
-	cache         *expirable.LRU[string, *js.Schema]
-	refAllowlist  []string // Allowed URL patterns for $ref resolution
+	cache        *expirable.LRU[string, *js.Schema]
+	refAllowlist []string // Allowed URL patterns for $ref resolution
+	refs         RefOptions
+	limits       Limits
 }
 
 // NewCompilerWithCache creates a new compiler with cache
@@ -26,16 +42,35 @@ func NewCompilerWithCache(maxSize int) *Compiler {
 
 // NewCompilerWithCacheAndAllowlist creates a new compiler with cache and $ref allowlist
 func NewCompilerWithCacheAndAllowlist(maxSize int, allowlist []string) *Compiler {
-	c := js.NewCompiler()
-	c.ExtractAnnotations = true
-	
+	return NewCompilerWithOptions(maxSize, RefOptions{Allowlist: allowlist})
+}
+
+// NewCompilerWithOptions creates a new compiler with cache whose remote $refs
+// are resolved according to opts
+func NewCompilerWithOptions(maxSize int, opts RefOptions) *Compiler {
+	if opts.Cache == nil {
+		opts.Cache = NewMemoryRefCache()
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = defaultRefCacheTTL
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
 	return &Compiler{
-		compiler:     c,
 		cache:        expirable.NewLRU[string, *js.Schema](maxSize, nil, time.Hour),
-		refAllowlist: allowlist,
+		refAllowlist: opts.Allowlist,
+		refs:         opts,
+		limits:       DefaultLimits,
 	}
 }
 
+// SetLimits replaces DefaultLimits; call it before the compiler is used
+func (c *Compiler) SetLimits(limits Limits) {
+	c.limits = limits
+}
+
 // matchesPattern checks if a URL matches an allowlist pattern
 // Supports:
 // - Exact match: "https://example.com/schema.json"
@@ -72,13 +107,21 @@ func (c *Compiler) key(schema map[string]interface{}) string {
 	return string(b)
 }
 
-// Prepare compiles and caches a schema
+// Prepare compiles and caches a schema. Schemas over the complexity limits
+// are refused before compiling, and compiling is abandoned after the
+// compile timeout.
 func (c *Compiler) Prepare(ctx context.Context, schema map[string]interface{}) error {
 	key := c.key(schema)
 	if _, ok := c.cache.Get(key); ok {
 		return nil // Already cached
 	}
 
+	nodes, err := c.limits.checkComplexity(schema)
+	if err != nil {
+		metrics.SchemaRejections.WithLabelValues("too_complex").Inc()
+		return err
+	}
+
 	// Validate $ref URLs against allowlist if configured
 	if len(c.refAllowlist) > 0 {
 		if err := c.validateRefs(schema); err != nil {
@@ -92,19 +135,57 @@ func (c *Compiler) Prepare(ctx context.Context, schema map[string]interface{}) e
 		return fmt.Errorf("failed to marshal schema: %w", err)
 	}
 
+	if c.limits.CompileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.limits.CompileTimeout)
+		defer cancel()
+	}
+
+	// Each schema gets a compiler of its own, which is not safe for
+	// concurrent use; a compile that times out then holds up nobody else.
+	// Fetched $refs are shared through the ref cache.
+	compiler := js.NewCompiler()
+	compiler.ExtractAnnotations = true
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+		return c.loadURL(ctx, s)
+	}
+
 	// Add resource to compiler
 	// Use a hash-based URL to avoid URL parsing issues with JSON content
 	hash := fmt.Sprintf("%x", schemaBytes)
 	resourceURL := fmt.Sprintf("mem://schema/%s.json", hash[:16])
-	if err := c.compiler.AddResource(resourceURL, bytes.NewReader(schemaBytes)); err != nil {
+	if err := compiler.AddResource(resourceURL, bytes.NewReader(schemaBytes)); err != nil {
 		return fmt.Errorf("failed to add resource: %w", err)
 	}
 
-	// Compile schema
-	compiled, err := c.compiler.Compile(resourceURL)
-	if err != nil {
-		return fmt.Errorf("failed to compile schema: %w", err)
+	// Compile schema; an abandoned compile finishes in the background
+	type result struct {
+		schema *js.Schema
+		err    error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		compiled, err := compiler.Compile(resourceURL)
+		done <- result{compiled, err}
+	}()
+
+	var compiled *js.Schema
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return fmt.Errorf("failed to compile schema: %w", r.err)
+		}
+		compiled = r.schema
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			metrics.SchemaRejections.WithLabelValues("timeout").Inc()
+			return fmt.Errorf("%w after %s", ErrCompileTimeout, time.Since(start).Round(time.Millisecond))
+		}
+		return ctx.Err()
 	}
+	metrics.SchemaCompileDuration.Observe(time.Since(start).Seconds())
+	metrics.SchemaComplexity.Observe(float64(nodes))
 
 	c.cache.Add(key, compiled)
 	return nil
@@ -114,10 +195,10 @@ func (c *Compiler) Prepare(ctx context.Context, schema map[string]interface{}) e
 func (c *Compiler) validateRefs(schema interface{}) error {
 	switch v := schema.(type) {
 	case map[string]interface{}:
-		// Check for $ref
-		if ref, ok := v["$ref"].(string); ok {
+		// Check for $ref; fragments point into the same document
+		if ref, ok := v["$ref"].(string); ok && !strings.HasPrefix(ref, "#") {
 			if !c.isRefAllowed(ref) {
-				return fmt.Errorf("$ref URL not allowed: %s (not in allowlist)", ref)
+				return fmt.Errorf("%w: %s (not in allowlist)", ErrRefNotAllowed, ref)
 			}
 		}
 		// Recursively check nested objects and arrays
@@ -152,11 +233,11 @@ func (c *Compiler) isRefAllowed(refURL string) bool {
 	return false
 }
 
-// Validate validates a value against a schema
+// Validate validates a value against a schema. A jsonexample schema is
+// validated as the permissive schema ExampleSchema infers from it.
 func (c *Compiler) Validate(ctx context.Context, kind string, schema map[string]interface{}, value map[string]interface{}) error {
 	if kind == "jsonexample" {
-		// For JSON examples, we don't validate strictly
-		return nil
+		schema = ExampleSchema(schema)
 	}
 
 	key := c.key(schema)
@@ -190,3 +271,47 @@ func (c *Compiler) Validate(ctx context.Context, kind string, schema map[string]
 	return nil
 }
 
+
+// Violation is a single reason a value failed validation
+type Violation struct {
+	InstanceLocation string `json:"instanceLocation"`         // JSON pointer into the value
+	Keyword          string `json:"keyword"`                  // e.g. "required", "minimum"
+	KeywordLocation  string `json:"keywordLocation"`          // Path through the schema, following $refs
+	SchemaLocation   string `json:"schemaLocation,omitempty"` // Absolute URI of the failing keyword
+	Message          string `json:"message"`
+}
+
+// Violations lists the individual failures behind a Validate error, or nil
+// if err is not a validation failure
+func Violations(err error) []Violation {
+	var ve *js.ValidationError
+	if !errors.As(err, &ve) {
+		return nil
+	}
+
+	var out []Violation
+	var walk func(e *js.ValidationError)
+	walk = func(e *js.ValidationError) {
+		if len(e.Causes) == 0 {
+			out = append(out, Violation{
+				InstanceLocation: e.InstanceLocation,
+				Keyword:          keyword(e.KeywordLocation),
+				KeywordLocation:  e.KeywordLocation,
+				SchemaLocation:   e.AbsoluteKeywordLocation,
+				Message:          e.Message,
+			})
+			return
+		}
+		for _, c := range e.Causes {
+			walk(c)
+		}
+	}
+	walk(ve)
+	return out
+}
+
+// keyword returns the last token of a JSON pointer into a schema
+func keyword(location string) string {
+	token := location[strings.LastIndex(location, "/")+1:]
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+}
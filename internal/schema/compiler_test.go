@@ -61,7 +61,7 @@ func TestCompiler_ValidateJSONExample(t *testing.T) {
 	compiler := NewCompilerWithCache(64)
 	ctx := context.Background()
 
-	// JSON example kind should not validate strictly
+	// JSON examples only check the types of the example's fields
 	schema := map[string]interface{}{
 		"example": map[string]interface{}{
 			"name": "test",
@@ -73,6 +73,44 @@ func TestCompiler_ValidateJSONExample(t *testing.T) {
 	}
 
 	err := compiler.Validate(ctx, "jsonexample", schema, value)
-	assert.NoError(t, err) // JSON examples don't validate strictly
+	assert.NoError(t, err)
+
+	err = compiler.Validate(ctx, "jsonexample", schema, map[string]interface{}{"name": 1})
+	assert.Error(t, err)
 }
 
+
+func TestViolations(t *testing.T) {
+	compiler := NewCompilerWithCache(64)
+	ctx := context.Background()
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"age":  map[string]interface{}{"type": "integer", "minimum": 0},
+		},
+		"required": []string{"name"},
+	}
+
+	err := compiler.Validate(ctx, "jsonschema", schema, map[string]interface{}{"age": -1})
+	require.Error(t, err)
+
+	violations := Violations(err)
+	require.Len(t, violations, 2)
+
+	byKeyword := map[string]Violation{}
+	for _, v := range violations {
+		assert.NotEmpty(t, v.Message)
+		assert.NotEmpty(t, v.SchemaLocation)
+		byKeyword[v.Keyword] = v
+	}
+	require.Contains(t, byKeyword, "required")
+	require.Contains(t, byKeyword, "minimum")
+	assert.Equal(t, "", byKeyword["required"].InstanceLocation)
+	assert.Equal(t, "/required", byKeyword["required"].KeywordLocation)
+	assert.Equal(t, "/age", byKeyword["minimum"].InstanceLocation)
+	assert.Equal(t, "/properties/age/minimum", byKeyword["minimum"].KeywordLocation)
+
+	assert.Nil(t, Violations(assert.AnError))
+}
@@ -0,0 +1,82 @@
+package schema
+
+// ExampleSchema infers a permissive JSON Schema from the example of a
+// jsonexample request schema, {"example": {...}}. Every field of the
+// example gets the type of its example value, and arrays the type their
+// items share; fields may be left out and fields the example does not have
+// are allowed. null and mixed arrays constrain nothing. Example values are
+// kept as "examples" so clients can show them as placeholders.
+func ExampleSchema(schema map[string]interface{}) map[string]interface{} {
+	inferred := inferSchema(schema["example"])
+	if inferred["type"] != "object" {
+		// Responses are objects; an example of another shape says nothing
+		// about their fields
+		inferred = map[string]interface{}{"type": "object"}
+	}
+	for _, key := range []string{"title", "description"} {
+		if v, ok := schema[key]; ok {
+			inferred[key] = v
+		}
+	}
+	return inferred
+}
+
+func inferSchema(example interface{}) map[string]interface{} {
+	switch v := example.(type) {
+	case map[string]interface{}:
+		properties := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			properties[key] = inferSchema(value)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case []interface{}:
+		out := map[string]interface{}{"type": "array"}
+		if items := commonItems(v); items != nil {
+			out["items"] = items
+		}
+		return out
+	case string:
+		return map[string]interface{}{"type": "string", "examples": []interface{}{v}}
+	case bool:
+		return map[string]interface{}{"type": "boolean", "examples": []interface{}{v}}
+	case float64, int, int64:
+		// 30 in an example does not rule out 30.5 in an answer
+		return map[string]interface{}{"type": "number", "examples": []interface{}{v}}
+	}
+	return map[string]interface{}{}
+}
+
+// commonItems returns the schema of the items of an example array if they
+// all have the same type, or nil. Object items share the properties of all
+// of them; a property whose type differs between items is unconstrained.
+func commonItems(items []interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	for _, item := range items {
+		s := inferSchema(item)
+		if s["type"] == nil {
+			return nil
+		}
+		switch {
+		case out == nil:
+			out = s
+		case out["type"] != s["type"]:
+			return nil
+		case s["type"] == "object":
+			merged := out["properties"].(map[string]interface{})
+			for key, prop := range s["properties"].(map[string]interface{}) {
+				existing, ok := merged[key].(map[string]interface{})
+				switch {
+				case !ok:
+					merged[key] = prop
+				case existing["type"] != prop.(map[string]interface{})["type"]:
+					merged[key] = map[string]interface{}{}
+				}
+			}
+		}
+	}
+	if out != nil && out["type"] != "object" && out["type"] != "array" {
+		// One example value does not stand for all the items
+		delete(out, "examples")
+	}
+	return out
+}
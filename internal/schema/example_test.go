@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExampleSchema(t *testing.T) {
+	got := ExampleSchema(map[string]interface{}{
+		"title": "Contact",
+		"example": map[string]interface{}{
+			"name":    "Ada",
+			"age":     float64(36),
+			"active":  true,
+			"note":    nil,
+			"tags":    []interface{}{"a", "b"},
+			"mixed":   []interface{}{"a", float64(1)},
+			"address": map[string]interface{}{"city": "London"},
+			"phones": []interface{}{
+				map[string]interface{}{"kind": "home", "number": "1"},
+				map[string]interface{}{"kind": float64(2), "ext": "9"},
+			},
+		},
+	})
+
+	assert.Equal(t, "Contact", got["title"])
+	assert.Equal(t, "object", got["type"])
+	assert.NotContains(t, got, "required")
+	props := got["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "examples": []interface{}{"Ada"}}, props["name"])
+	assert.Equal(t, "number", props["age"].(map[string]interface{})["type"])
+	assert.Equal(t, "boolean", props["active"].(map[string]interface{})["type"])
+	assert.Equal(t, map[string]interface{}{}, props["note"])
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}, props["tags"])
+	assert.Equal(t, map[string]interface{}{"type": "array"}, props["mixed"])
+	assert.Equal(t, "object", props["address"].(map[string]interface{})["type"])
+
+	phone := props["phones"].(map[string]interface{})["items"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{}, phone["kind"])
+	assert.Contains(t, phone, "number")
+	assert.Contains(t, phone, "ext")
+
+	// Responses are objects whatever the example
+	assert.Equal(t, map[string]interface{}{"type": "object"}, ExampleSchema(map[string]interface{}{"example": "text"}))
+}
+
+func TestValidateExample(t *testing.T) {
+	c := NewCompilerWithCache(8)
+	ctx := context.Background()
+	s := map[string]interface{}{
+		"example": map[string]interface{}{
+			"name": "Ada",
+			"age":  float64(36),
+			"tags": []interface{}{"a"},
+		},
+	}
+
+	require.NoError(t, c.Validate(ctx, "jsonexample", s, map[string]interface{}{"name": "Grace", "age": 36.5, "extra": 1}))
+	require.NoError(t, c.Validate(ctx, "jsonexample", s, map[string]interface{}{}))
+
+	err := c.Validate(ctx, "jsonexample", s, map[string]interface{}{"age": "old"})
+	require.Error(t, err)
+	assert.Equal(t, "/age", Violations(err)[0].InstanceLocation)
+	assert.Error(t, c.Validate(ctx, "jsonexample", s, map[string]interface{}{"tags": []interface{}{1}}))
+}
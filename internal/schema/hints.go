@@ -0,0 +1,297 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidHints is wrapped by the errors of NormalizeHints
+var ErrInvalidHints = errors.New("invalid uiHints")
+
+type hintType int
+
+const (
+	hintString hintType = iota
+	hintStrings
+	hintBool
+	hintObject
+)
+
+// hintKeys is the uiHints vocabulary, the part of the @rjsf uiSchema that
+// renderers are expected to understand, with the type of each hint
+var hintKeys = map[string]hintType{
+	"ui:widget":      hintString,
+	"ui:field":       hintString,
+	"ui:title":       hintString,
+	"ui:description": hintString,
+	"ui:help":        hintString,
+	"ui:placeholder": hintString,
+	"ui:classNames":  hintString,
+	"ui:enumNames":   hintStrings,
+	"ui:order":       hintStrings,
+	"ui:autofocus":   hintBool,
+	"ui:disabled":    hintBool,
+	"ui:readonly":    hintBool,
+	"ui:label":       hintBool,
+	"ui:options":     hintObject,
+
+	// Form-wide hints, only allowed at the top level
+	"ui:submitButtonOptions": hintObject,
+	"submitLabel":            hintString,
+}
+
+// formHints may only be given for the whole form
+var formHints = map[string]bool{
+	"ui:submitButtonOptions": true,
+	"submitLabel":            true,
+}
+
+// hintAliases are hints accepted without the "ui:" prefix. An alias holding
+// an object is taken for the hints of a property of the same name.
+var hintAliases = map[string]bool{
+	"widget":      true,
+	"title":       true,
+	"description": true,
+	"help":        true,
+	"placeholder": true,
+	"enumNames":   true,
+	"order":       true,
+}
+
+// compositionKeywords make the properties of a schema node depend on more
+// than its own "properties"
+var compositionKeywords = []string{"$ref", "allOf", "anyOf", "oneOf", "if", "dependentSchemas", "patternProperties"}
+
+// NormalizeHints checks uiHints against the hint vocabulary and returns
+// them in canonical form: aliases such as "widget" become "ui:widget", also
+// in "x-i18n" bundles, and "ui:order", given as an array or a
+// comma-separated string and merged with "order", becomes one array without
+// duplicates. Objects under other keys hold the hints of the property of
+// that name, as in an @rjsf uiSchema.
+//
+// Known hints of the wrong type are always rejected. In strict mode so are
+// unknown keys, hints for properties schema does not declare and "ui:order"
+// entries that are not properties; otherwise unknown keys are kept as they
+// are. schema may be nil when the properties are not known. hints itself is
+// not modified.
+func NormalizeHints(hints, schema map[string]interface{}, strict bool) (map[string]interface{}, error) {
+	if hints == nil {
+		return nil, nil
+	}
+	n := hintNormalizer{strict: strict}
+	return n.normalize(hints, schema, "", true)
+}
+
+type hintNormalizer struct {
+	strict bool
+}
+
+func (n hintNormalizer) normalize(hints, schema map[string]interface{}, path string, top bool) (map[string]interface{}, error) {
+	properties := declaredProperties(schema)
+	out := make(map[string]interface{}, len(hints))
+	var order []string
+	seen := map[string]bool{}
+
+	keys := make([]string, 0, len(hints))
+	for key := range hints {
+		keys = append(keys, key)
+	}
+	// ui:order before order, so the explicit hint comes first
+	sort.Slice(keys, func(i, j int) bool {
+		iui, jui := strings.HasPrefix(keys[i], "ui:"), strings.HasPrefix(keys[j], "ui:")
+		if iui != jui {
+			return iui
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		value := hints[key]
+		_, isObject := value.(map[string]interface{})
+		name := key
+		if hintAliases[key] && !isObject {
+			name = "ui:" + key
+		}
+		kind, known := hintKeys[name]
+		if known && formHints[name] && !top {
+			known = false
+		}
+
+		switch {
+		case strings.HasPrefix(key, "x-"):
+			out[key] = value
+		case known && name == "ui:order":
+			entries, err := orderList(value)
+			if err != nil {
+				return nil, n.errorf(path, key, "%v", err)
+			}
+			for _, entry := range entries {
+				if !seen[entry] {
+					seen[entry] = true
+					order = append(order, entry)
+				}
+			}
+		case known:
+			if !hintOfType(value, kind) {
+				return nil, n.errorf(path, key, "must be %s", kind)
+			}
+			if _, dup := out[name]; dup {
+				// Both "ui:title" and "title": the prefixed hint wins
+				continue
+			}
+			out[name] = value
+		case isObject && !strings.HasPrefix(key, "ui:"):
+			child, declared := properties[key]
+			if n.strict && properties != nil && !declared && key != "items" && key != "additionalProperties" {
+				return nil, n.errorf(path, key, "schema has no such property")
+			}
+			if key == "items" && !declared {
+				child = schema["items"]
+			}
+			childSchema, _ := child.(map[string]interface{})
+			normalized, err := n.normalize(value.(map[string]interface{}), childSchema, path+"/"+key, false)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = normalized
+		case n.strict:
+			return nil, n.errorf(path, key, "unknown hint")
+		default:
+			out[key] = value
+		}
+	}
+
+	if order != nil {
+		if n.strict && properties != nil {
+			for _, entry := range order {
+				if _, ok := properties[entry]; !ok && entry != "*" {
+					return nil, n.errorf(path, "ui:order", "schema has no property %q", entry)
+				}
+			}
+		}
+		list := make([]interface{}, len(order))
+		for i, entry := range order {
+			list[i] = entry
+		}
+		out["ui:order"] = list
+	}
+	if bundles, ok := out[i18nKeyword].(map[string]interface{}); ok {
+		out[i18nKeyword] = canonicalBundles(bundles)
+	}
+	return out, nil
+}
+
+func (n hintNormalizer) errorf(path, key, format string, args ...interface{}) error {
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Errorf("%w: %s at %s: %s", ErrInvalidHints, key, path, fmt.Sprintf(format, args...))
+}
+
+func (k hintType) String() string {
+	switch k {
+	case hintString:
+		return "a string"
+	case hintStrings:
+		return "an array of strings"
+	case hintBool:
+		return "a boolean"
+	}
+	return "an object"
+}
+
+func hintOfType(value interface{}, kind hintType) bool {
+	switch kind {
+	case hintString:
+		_, ok := value.(string)
+		return ok
+	case hintStrings:
+		_, ok := stringsOf(value)
+		return ok
+	case hintBool:
+		_, ok := value.(bool)
+		return ok
+	}
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+// orderList reads a "ui:order" given as an array of property names or as a
+// comma-separated string
+func orderList(value interface{}) ([]string, error) {
+	var entries []string
+	if s, ok := value.(string); ok {
+		entries = strings.Split(s, ",")
+	} else if list, ok := stringsOf(value); ok {
+		entries = list
+	} else {
+		return nil, errors.New("must be an array of property names")
+	}
+	out := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+func stringsOf(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		out := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out[i] = s
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// declaredProperties returns the properties of a schema node, or nil if
+// they are unknown or may come from elsewhere, e.g. a $ref or an allOf
+func declaredProperties(schema map[string]interface{}) map[string]interface{} {
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, keyword := range compositionKeywords {
+		if _, ok := schema[keyword]; ok {
+			return nil
+		}
+	}
+	return properties
+}
+
+// canonicalBundles renames the aliased hints of "x-i18n" bundles, so a
+// translation of "title" still applies once it is "ui:title"
+func canonicalBundles(bundles map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(bundles))
+	for locale, bundle := range bundles {
+		translations, ok := bundle.(map[string]interface{})
+		if !ok {
+			out[locale] = bundle
+			continue
+		}
+		renamed := make(map[string]interface{}, len(translations))
+		for key, value := range translations {
+			if _, isObject := value.(map[string]interface{}); hintAliases[key] && !isObject {
+				if _, dup := translations["ui:"+key]; dup {
+					continue
+				}
+				key = "ui:" + key
+			}
+			renamed[key] = value
+		}
+		out[locale] = renamed
+	}
+	return out
+}
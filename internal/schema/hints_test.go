@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hintsSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"name":  map[string]interface{}{"type": "string"},
+		"email": map[string]interface{}{"type": "string"},
+		"address": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"street": map[string]interface{}{"type": "string"},
+			},
+		},
+	},
+}
+
+func TestNormalizeHints(t *testing.T) {
+	hints := map[string]interface{}{
+		"ui:order": []interface{}{"email", "name"},
+		"order":    "name, address,*",
+		"title":    "Contact",
+		"name": map[string]interface{}{
+			"widget":   "textarea",
+			"help":     "As on your ID",
+			"ui:title": "Full name",
+			"title":    "Name",
+		},
+		"address": map[string]interface{}{
+			"street": map[string]interface{}{"placeholder": "Main St 1"},
+		},
+		"submitLabel": "Send",
+		"x-i18n": map[string]interface{}{
+			"cs": map[string]interface{}{"title": "Kontakt", "submitLabel": "Odeslat"},
+		},
+	}
+
+	out, err := NormalizeHints(hints, hintsSchema, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"ui:order": []interface{}{"email", "name", "address", "*"},
+		"ui:title": "Contact",
+		"name": map[string]interface{}{
+			"ui:widget": "textarea",
+			"ui:help":   "As on your ID",
+			"ui:title":  "Full name",
+		},
+		"address": map[string]interface{}{
+			"street": map[string]interface{}{"ui:placeholder": "Main St 1"},
+		},
+		"submitLabel": "Send",
+		"x-i18n": map[string]interface{}{
+			"cs": map[string]interface{}{"ui:title": "Kontakt", "submitLabel": "Odeslat"},
+		},
+	}, out)
+	assert.Contains(t, hints, "order", "input is not modified")
+
+	// Translations still apply to the canonical keys
+	assert.Equal(t, "Kontakt", LocalizeHints(out, []string{"cs"})["ui:title"])
+}
+
+func TestNormalizeHintsUnknownKeys(t *testing.T) {
+	typo := map[string]interface{}{
+		"name": map[string]interface{}{"ui:widge": "textarea"},
+	}
+	_, err := NormalizeHints(typo, hintsSchema, true)
+	assert.ErrorIs(t, err, ErrInvalidHints)
+	assert.ErrorContains(t, err, "ui:widge at /name")
+
+	// Lenient mode keeps what it does not know
+	out, err := NormalizeHints(typo, hintsSchema, false)
+	require.NoError(t, err)
+	assert.Equal(t, typo, out)
+
+	strictOnly := map[string]map[string]interface{}{
+		"unknown property": {"phone": map[string]interface{}{"ui:widget": "tel"}},
+		"unknown order":    {"ui:order": []interface{}{"name", "phone"}},
+		"nested form hint": {"name": map[string]interface{}{"submitLabel": "Send"}},
+		"unprefixed":       {"name": map[string]interface{}{"autofocus": true}},
+	}
+	for name, hints := range strictOnly {
+		_, err := NormalizeHints(hints, hintsSchema, true)
+		assert.ErrorIs(t, err, ErrInvalidHints, name)
+		_, err = NormalizeHints(hints, hintsSchema, false)
+		assert.NoError(t, err, name)
+	}
+
+	// Without declared properties any property may have hints
+	_, err = NormalizeHints(strictOnly["unknown property"], map[string]interface{}{"$ref": "https://example.com/s.json"}, true)
+	assert.NoError(t, err)
+}
+
+func TestNormalizeHintsTypes(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"widget":    {"name": map[string]interface{}{"ui:widget": 3}},
+		"alias":     {"name": map[string]interface{}{"placeholder": true}},
+		"enumNames": {"name": map[string]interface{}{"ui:enumNames": []interface{}{"A", 2}}},
+		"order":     {"ui:order": 7},
+		"options":   {"name": map[string]interface{}{"ui:options": "rows=3"}},
+		"submit":    {"submitLabel": []interface{}{"Send"}},
+	}
+	for name, hints := range cases {
+		_, err := NormalizeHints(hints, hintsSchema, false)
+		assert.ErrorIs(t, err, ErrInvalidHints, name)
+	}
+}
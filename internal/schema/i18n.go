@@ -0,0 +1,167 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// i18nKeyword holds the translations of a schema node or UI hints object,
+// keyed by locale: {"x-i18n": {"cs": {"title": "Jméno"}}}
+const i18nKeyword = "x-i18n"
+
+// translatable lists the schema keywords a translation may replace.
+// Validation keywords are left alone so that every language accepts the
+// same answers.
+var translatable = map[string]bool{
+	"title":       true,
+	"description": true,
+	"examples":    true,
+	"enumNames":   true,
+	"x-enumNames": true,
+}
+
+// dataKeywords hold instance values rather than subschemas and are not
+// searched for translations
+var dataKeywords = map[string]bool{
+	"const":    true,
+	"default":  true,
+	"enum":     true,
+	"examples": true,
+}
+
+// Localize returns a copy of schema with its titles, descriptions and
+// examples resolved into the first of locales that has a translation, and
+// the "x-i18n" bundles removed. Each node falls back on its own: a node
+// without a matching translation keeps its original text. schema itself is
+// not modified.
+func Localize(schema map[string]interface{}, locales []string) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	return localize(schema, locales, translatable).(map[string]interface{})
+}
+
+// LocalizeHints is Localize for UI hints. Any hint may be translated,
+// e.g. {"submitLabel": "Send", "x-i18n": {"cs": {"submitLabel": "Odeslat"}}}.
+func LocalizeHints(hints map[string]interface{}, locales []string) map[string]interface{} {
+	if hints == nil {
+		return nil
+	}
+	return localize(hints, locales, nil).(map[string]interface{})
+}
+
+// localize copies node, applying translations to the keys allowed (all
+// keys if allowed is nil)
+func localize(node interface{}, locales []string, allowed map[string]bool) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			switch {
+			case key == i18nKeyword:
+			case allowed != nil && dataKeywords[key]:
+				out[key] = value
+			default:
+				out[key] = localize(value, locales, allowed)
+			}
+		}
+		bundles, _ := v[i18nKeyword].(map[string]interface{})
+		if translation, ok := pickLocale(bundles, locales).(map[string]interface{}); ok {
+			for key, value := range translation {
+				if allowed == nil || allowed[key] {
+					out[key] = value
+				}
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = localize(item, locales, allowed)
+		}
+		return out
+	default:
+		return node
+	}
+}
+
+// pickLocale returns the bundle of the first locale that has one, trying
+// each locale as given and then its base language ("cs-CZ", then "cs").
+// Locales are matched case-insensitively.
+func pickLocale(bundles map[string]interface{}, locales []string) interface{} {
+	if len(bundles) == 0 {
+		return nil
+	}
+	byTag := make(map[string]interface{}, len(bundles))
+	for tag, bundle := range bundles {
+		byTag[strings.ToLower(tag)] = bundle
+	}
+	for _, locale := range locales {
+		tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+		if bundle, ok := byTag[tag]; ok {
+			return bundle
+		}
+		if base, _, found := strings.Cut(tag, "-"); found {
+			if bundle, ok := byTag[base]; ok {
+				return bundle
+			}
+		}
+	}
+	return nil
+}
+
+// CheckI18n verifies the "x-i18n" bundles of schema or UI hints: each must
+// map valid locales to objects of translations.
+func CheckI18n(node interface{}) error {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key != i18nKeyword {
+				if err := CheckI18n(value); err != nil {
+					return err
+				}
+				continue
+			}
+			bundles, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be an object keyed by locale", i18nKeyword)
+			}
+			for locale, bundle := range bundles {
+				if !ValidLocale(locale) {
+					return fmt.Errorf("%s: invalid locale %q", i18nKeyword, locale)
+				}
+				if _, ok := bundle.(map[string]interface{}); !ok {
+					return fmt.Errorf("%s: translations for %q must be an object", i18nKeyword, locale)
+				}
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := CheckI18n(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidLocale reports whether locale looks like a BCP 47 language tag,
+// e.g. "cs" or "pt-BR"
+func ValidLocale(locale string) bool {
+	parts := strings.Split(locale, "-")
+	if len(parts[0]) < 2 || len(parts[0]) > 3 || len(locale) > 35 {
+		return false
+	}
+	for i, part := range parts {
+		if part == "" || len(part) > 8 {
+			return false
+		}
+		for _, c := range part {
+			isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+			if !isLetter && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func i18nSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "object",
+		"title": "Contact",
+		"x-i18n": map[string]interface{}{
+			"cs": map[string]interface{}{"title": "Kontakt", "type": "string"},
+			"de": map[string]interface{}{"title": "Kontakt"},
+		},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"title":       "Name",
+				"description": "Your full name",
+				"x-i18n": map[string]interface{}{
+					"CS": map[string]interface{}{"title": "Jméno"},
+				},
+			},
+			"email": map[string]interface{}{"type": "string", "title": "E-mail"},
+		},
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	s := i18nSchema()
+
+	cs := Localize(s, []string{"cs-CZ"})
+	assert.Equal(t, "Kontakt", cs["title"])
+	assert.Equal(t, "object", cs["type"], "validation keywords are not translated")
+	assert.NotContains(t, cs, "x-i18n")
+	name := cs["properties"].(map[string]interface{})["name"].(map[string]interface{})
+	assert.Equal(t, "Jméno", name["title"])
+	assert.Equal(t, "Your full name", name["description"], "missing translations fall back to the original")
+	assert.NotContains(t, name, "x-i18n")
+
+	// The first locale with a translation wins, per node
+	fr := Localize(s, []string{"fr", "de"})
+	assert.Equal(t, "Kontakt", fr["title"])
+	name = fr["properties"].(map[string]interface{})["name"].(map[string]interface{})
+	assert.Equal(t, "Name", name["title"])
+
+	// The input is left untouched
+	assert.Equal(t, "Contact", s["title"])
+	assert.Contains(t, s, "x-i18n")
+	assert.Nil(t, Localize(nil, []string{"cs"}))
+}
+
+func TestLocalizeHints(t *testing.T) {
+	hints := map[string]interface{}{
+		"submitLabel": "Send",
+		"layout":      "wizard",
+		"x-i18n": map[string]interface{}{
+			"cs": map[string]interface{}{"submitLabel": "Odeslat"},
+		},
+	}
+	assert.Equal(t, map[string]interface{}{"submitLabel": "Odeslat", "layout": "wizard"}, LocalizeHints(hints, []string{"cs"}))
+	assert.Equal(t, map[string]interface{}{"submitLabel": "Send", "layout": "wizard"}, LocalizeHints(hints, nil))
+}
+
+func TestCheckI18n(t *testing.T) {
+	assert.NoError(t, CheckI18n(i18nSchema()))
+	assert.Error(t, CheckI18n(map[string]interface{}{"x-i18n": "cs"}))
+	assert.Error(t, CheckI18n(map[string]interface{}{"x-i18n": map[string]interface{}{"cs": "Jméno"}}))
+	assert.Error(t, CheckI18n(map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"x-i18n": map[string]interface{}{"czech!": map[string]interface{}{}}}},
+	}))
+}
+
+func TestValidLocale(t *testing.T) {
+	for _, locale := range []string{"cs", "en-US", "pt-BR", "zh-Hant-TW", "es-419"} {
+		assert.True(t, ValidLocale(locale), locale)
+	}
+	for _, locale := range []string{"", "c", "cs-", "1a", "en_US", "czech"} {
+		assert.False(t, ValidLocale(locale), locale)
+	}
+}
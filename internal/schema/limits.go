@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSchemaTooComplex is returned by Prepare for schemas over the node or
+	// depth limit
+	ErrSchemaTooComplex = errors.New("schema too complex")
+	// ErrCompileTimeout is returned by Prepare when compiling a schema,
+	// including fetching its remote $refs, takes longer than the limit
+	ErrCompileTimeout = errors.New("schema compilation timed out")
+)
+
+// Limits bound the schemas the compiler accepts, so a pathological schema
+// cannot hold up the request that submits it. Zero fields are unlimited.
+type Limits struct {
+	// MaxNodes is the largest number of objects and arrays in a schema,
+	// not counting the documents of remote $refs
+	MaxNodes int
+	// MaxDepth is the deepest nesting of objects and arrays
+	MaxDepth int
+	// CompileTimeout bounds compiling a schema and fetching its $refs
+	CompileTimeout time.Duration
+}
+
+// DefaultLimits are generous for hand-written forms and generated schemas
+var DefaultLimits = Limits{
+	MaxNodes:       10000,
+	MaxDepth:       64,
+	CompileTimeout: 5 * time.Second,
+}
+
+// LimitsFromEnv reads the limits from SCHEMA_MAX_NODES, SCHEMA_MAX_DEPTH and
+// SCHEMA_COMPILE_TIMEOUT, starting from DefaultLimits
+func LimitsFromEnv() (Limits, error) {
+	limits := DefaultLimits
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"SCHEMA_MAX_NODES", &limits.MaxNodes},
+		{"SCHEMA_MAX_DEPTH", &limits.MaxDepth},
+	} {
+		if s := os.Getenv(v.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return limits, fmt.Errorf("invalid %s: %q", v.name, s)
+			}
+			*v.dst = n
+		}
+	}
+	if s := os.Getenv("SCHEMA_COMPILE_TIMEOUT"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return limits, fmt.Errorf("invalid SCHEMA_COMPILE_TIMEOUT: %q", s)
+		}
+		limits.CompileTimeout = d
+	}
+	return limits, nil
+}
+
+// Complexity returns the number of objects and arrays in a schema and how
+// deeply they nest
+func Complexity(schema interface{}) (nodes, depth int) {
+	var walk func(node interface{}, level int)
+	walk = func(node interface{}, level int) {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			nodes++
+			depth = max(depth, level)
+			for _, child := range v {
+				walk(child, level+1)
+			}
+		case []interface{}:
+			nodes++
+			depth = max(depth, level)
+			for _, child := range v {
+				walk(child, level+1)
+			}
+		}
+	}
+	walk(schema, 1)
+	return nodes, depth
+}
+
+// checkComplexity returns the number of nodes of schema, or
+// ErrSchemaTooComplex if it is over the limits
+func (l Limits) checkComplexity(schema map[string]interface{}) (int, error) {
+	nodes, depth := Complexity(schema)
+	if l.MaxNodes > 0 && nodes > l.MaxNodes {
+		return nodes, fmt.Errorf("%w: %d objects and arrays, at most %d allowed", ErrSchemaTooComplex, nodes, l.MaxNodes)
+	}
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return nodes, fmt.Errorf("%w: nested %d levels deep, at most %d allowed", ErrSchemaTooComplex, depth, l.MaxDepth)
+	}
+	return nodes, nil
+}
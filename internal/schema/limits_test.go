@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplexity(t *testing.T) {
+	nodes, depth := Complexity(map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name"},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+		},
+	})
+	assert.Equal(t, 4, nodes)
+	assert.Equal(t, 3, depth)
+}
+
+func TestPrepareRefusesComplexSchemas(t *testing.T) {
+	ctx := context.Background()
+	c := NewCompilerWithCache(8)
+	c.SetLimits(Limits{MaxNodes: 10, MaxDepth: 4})
+
+	wide := map[string]interface{}{}
+	for i := 0; i < 10; i++ {
+		wide[string(rune('a'+i))] = map[string]interface{}{"type": "string"}
+	}
+	err := c.Prepare(ctx, map[string]interface{}{"type": "object", "properties": wide})
+	assert.ErrorIs(t, err, ErrSchemaTooComplex)
+
+	var deep interface{} = map[string]interface{}{"type": "string"}
+	for i := 0; i < 4; i++ {
+		deep = map[string]interface{}{"allOf": []interface{}{deep}}
+	}
+	err = c.Prepare(ctx, deep.(map[string]interface{}))
+	assert.ErrorIs(t, err, ErrSchemaTooComplex)
+
+	assert.NoError(t, c.Prepare(ctx, map[string]interface{}{"type": "object"}))
+}
+
+func TestPrepareTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewCompilerWithOptions(8, RefOptions{})
+	c.SetLimits(Limits{CompileTimeout: 50 * time.Millisecond})
+	start := time.Now()
+	err := c.Prepare(context.Background(), refSchema(srv.URL+"/slow.json"))
+	assert.ErrorIs(t, err, ErrCompileTimeout)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	limits, err := LimitsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLimits, limits)
+
+	t.Setenv("SCHEMA_MAX_NODES", "500")
+	t.Setenv("SCHEMA_MAX_DEPTH", "0")
+	t.Setenv("SCHEMA_COMPILE_TIMEOUT", "250ms")
+	limits, err = LimitsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Limits{MaxNodes: 500, MaxDepth: 0, CompileTimeout: 250 * time.Millisecond}, limits)
+
+	t.Setenv("SCHEMA_MAX_NODES", "many")
+	_, err = LimitsFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidPages is returned when a schema's "x-pages" are malformed
+var ErrInvalidPages = errors.New("invalid x-pages")
+
+// Page is one step of a multi-step form, declared in the "x-pages" array of
+// an object schema. A page shows the listed top-level properties and is
+// visible only when the answers given so far match its "if" schema.
+type Page struct {
+	ID     string                 `json:"id"`
+	Title  string                 `json:"title,omitempty"`
+	Fields []string               `json:"fields"`
+	If     map[string]interface{} `json:"if,omitempty"`
+}
+
+// Pages returns the pages declared by schema in order, or nil if it has none
+func Pages(schema map[string]interface{}) ([]Page, error) {
+	raw, ok := schema["x-pages"]
+	if !ok {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPages, err)
+	}
+	var pages []Page
+	if err := json.Unmarshal(b, &pages); err != nil {
+		return nil, fmt.Errorf("%w: must be an array of pages: %v", ErrInvalidPages, err)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	seenPage := make(map[string]bool)
+	seenField := make(map[string]string)
+	for _, p := range pages {
+		if p.ID == "" {
+			return nil, fmt.Errorf("%w: page without id", ErrInvalidPages)
+		}
+		if seenPage[p.ID] {
+			return nil, fmt.Errorf("%w: duplicate page %q", ErrInvalidPages, p.ID)
+		}
+		seenPage[p.ID] = true
+		if len(p.Fields) == 0 {
+			return nil, fmt.Errorf("%w: page %q has no fields", ErrInvalidPages, p.ID)
+		}
+		for _, f := range p.Fields {
+			if _, ok := properties[f]; !ok {
+				return nil, fmt.Errorf("%w: page %q refers to unknown property %q", ErrInvalidPages, p.ID, f)
+			}
+			if other, ok := seenField[f]; ok {
+				return nil, fmt.Errorf("%w: property %q is on pages %q and %q", ErrInvalidPages, f, other, p.ID)
+			}
+			seenField[f] = p.ID
+		}
+	}
+	return pages, nil
+}
+
+// PageSchema derives the subschema that validates only the fields of page.
+// Definitions and the draft are kept so local $refs still resolve.
+func PageSchema(schema map[string]interface{}, page Page) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	fields := make(map[string]bool, len(page.Fields))
+	pageProps := make(map[string]interface{}, len(page.Fields))
+	for _, f := range page.Fields {
+		fields[f] = true
+		pageProps[f] = properties[f]
+	}
+
+	var required []string
+	switch req := schema["required"].(type) {
+	case []interface{}:
+		for _, r := range req {
+			if name, ok := r.(string); ok && fields[name] {
+				required = append(required, name)
+			}
+		}
+	case []string:
+		for _, name := range req {
+			if fields[name] {
+				required = append(required, name)
+			}
+		}
+	}
+
+	sub := map[string]interface{}{
+		"type":       "object",
+		"properties": pageProps,
+	}
+	if len(required) > 0 {
+		sub["required"] = required
+	}
+	for _, key := range []string{"$schema", "$defs", "definitions"} {
+		if v, ok := schema[key]; ok {
+			sub[key] = v
+		}
+	}
+	return sub
+}
+
+// VisiblePages returns the pages whose "if" condition matches payload
+func (c *Compiler) VisiblePages(ctx context.Context, pages []Page, payload map[string]interface{}) ([]Page, error) {
+	var visible []Page
+	for _, p := range pages {
+		if p.If != nil {
+			err := c.Validate(ctx, "jsonschema", p.If, payload)
+			if Violations(err) != nil {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: page %q: %v", ErrInvalidPages, p.ID, err)
+			}
+		}
+		visible = append(visible, p)
+	}
+	return visible, nil
+}
+
+// PreparePages checks a schema's pages and compiles their conditions
+func (c *Compiler) PreparePages(ctx context.Context, schema map[string]interface{}) error {
+	pages, err := Pages(schema)
+	if err != nil {
+		return err
+	}
+	for _, p := range pages {
+		if p.If == nil {
+			continue
+		}
+		if err := c.Prepare(ctx, p.If); err != nil {
+			return fmt.Errorf("%w: page %q condition: %v", ErrInvalidPages, p.ID, err)
+		}
+	}
+	return nil
+}
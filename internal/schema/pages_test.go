@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wizardSchema decodes like a schema received over the API
+func wizardSchema(t *testing.T) map[string]interface{} {
+	var s map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer", "minimum": 0},
+			"guardian": {"$ref": "#/$defs/person"}
+		},
+		"required": ["name", "age"],
+		"$defs": {"person": {"type": "string", "minLength": 1}},
+		"x-pages": [
+			{"id": "basics", "fields": ["name", "age"]},
+			{"id": "guardian", "fields": ["guardian"],
+			 "if": {"properties": {"age": {"maximum": 17}}, "required": ["age"]}}
+		]
+	}`), &s))
+	return s
+}
+
+func TestPages(t *testing.T) {
+	pages, err := Pages(wizardSchema(t))
+	require.NoError(t, err)
+	require.Len(t, pages, 2)
+	assert.Equal(t, "basics", pages[0].ID)
+	assert.Equal(t, []string{"guardian"}, pages[1].Fields)
+	assert.NotNil(t, pages[1].If)
+
+	pages, err = Pages(map[string]interface{}{"type": "object"})
+	assert.NoError(t, err)
+	assert.Nil(t, pages)
+
+	tests := map[string]interface{}{
+		"not an array":     "basics",
+		"missing id":       []interface{}{map[string]interface{}{"fields": []interface{}{"name"}}},
+		"no fields":        []interface{}{map[string]interface{}{"id": "a"}},
+		"unknown property": []interface{}{map[string]interface{}{"id": "a", "fields": []interface{}{"nope"}}},
+		"duplicate page": []interface{}{
+			map[string]interface{}{"id": "a", "fields": []interface{}{"name"}},
+			map[string]interface{}{"id": "a", "fields": []interface{}{"age"}},
+		},
+		"field on two pages": []interface{}{
+			map[string]interface{}{"id": "a", "fields": []interface{}{"name"}},
+			map[string]interface{}{"id": "b", "fields": []interface{}{"name"}},
+		},
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := wizardSchema(t)
+			s["x-pages"] = raw
+			_, err := Pages(s)
+			assert.ErrorIs(t, err, ErrInvalidPages)
+		})
+	}
+}
+
+func TestPageSchema(t *testing.T) {
+	s := wizardSchema(t)
+	pages, err := Pages(s)
+	require.NoError(t, err)
+
+	sub := PageSchema(s, pages[0])
+	assert.Equal(t, []string{"name", "age"}, sub["required"])
+	assert.Len(t, sub["properties"], 2)
+
+	sub = PageSchema(s, pages[1])
+	assert.NotContains(t, sub, "required")
+	assert.Contains(t, sub, "$defs")
+
+	// Only the page's own fields are checked, and local $refs still resolve
+	c := NewCompilerWithCache(16)
+	ctx := context.Background()
+	assert.NoError(t, c.Validate(ctx, "jsonschema", PageSchema(s, pages[0]), map[string]interface{}{"name": "Al", "age": 12}))
+	assert.Error(t, c.Validate(ctx, "jsonschema", PageSchema(s, pages[0]), map[string]interface{}{"name": "Al"}))
+	assert.NoError(t, c.Validate(ctx, "jsonschema", PageSchema(s, pages[1]), map[string]interface{}{"guardian": "Bo"}))
+	assert.Error(t, c.Validate(ctx, "jsonschema", PageSchema(s, pages[1]), map[string]interface{}{"guardian": ""}))
+}
+
+func TestVisiblePages(t *testing.T) {
+	s := wizardSchema(t)
+	pages, err := Pages(s)
+	require.NoError(t, err)
+
+	c := NewCompilerWithCache(16)
+	ctx := context.Background()
+	require.NoError(t, c.PreparePages(ctx, s))
+
+	ids := func(payload map[string]interface{}) []string {
+		visible, err := c.VisiblePages(ctx, pages, payload)
+		require.NoError(t, err)
+		var out []string
+		for _, p := range visible {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"basics"}, ids(map[string]interface{}{}))
+	assert.Equal(t, []string{"basics"}, ids(map[string]interface{}{"age": 30}))
+	assert.Equal(t, []string{"basics", "guardian"}, ids(map[string]interface{}{"age": 12}))
+}
@@ -0,0 +1,311 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	js "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const defaultRefCacheTTL = 24 * time.Hour
+
+// maxRefSize caps the size of a fetched remote schema
+const maxRefSize = 1 << 20
+
+var (
+	// ErrRefNotAllowed is returned when a $ref points outside the allowlist
+	ErrRefNotAllowed = errors.New("$ref URL not allowed")
+	// ErrRefNotCached is returned in strict mode when a remote $ref has not
+	// been prefetched
+	ErrRefNotCached = errors.New("$ref not cached and network fetches are disabled")
+)
+
+// RefOptions controls how remote $refs are resolved
+type RefOptions struct {
+	// Allowlist restricts $ref URLs to these patterns; empty allows all
+	Allowlist []string
+	// Strict disables network fetches while compiling; remote $refs must
+	// have been loaded with Prefetch
+	Strict bool
+	// Cache keeps fetched documents; defaults to an in-process cache
+	Cache RefCache
+	// CacheTTL is how long fetched documents are kept (default 24h)
+	CacheTTL time.Duration
+	// Preload lists URLs to fetch at startup with Prefetch
+	Preload []string
+	// HTTPClient fetches remote documents (default: 10s timeout)
+	HTTPClient *http.Client
+}
+
+// RefOptionsFromEnv reads $ref settings from SCHEMA_REF_ALLOWLIST,
+// SCHEMA_REF_STRICT, SCHEMA_REF_CACHE, SCHEMA_REF_CACHE_DIR,
+// SCHEMA_REF_CACHE_TTL and SCHEMA_REF_PRELOAD. rdb is only used when
+// SCHEMA_REF_CACHE=redis.
+func RefOptionsFromEnv(rdb *redis.Client) (RefOptions, error) {
+	opts := RefOptions{
+		Allowlist: splitList(os.Getenv("SCHEMA_REF_ALLOWLIST")),
+		Strict:    os.Getenv("SCHEMA_REF_STRICT") == "true",
+		Preload:   splitList(os.Getenv("SCHEMA_REF_PRELOAD")),
+	}
+
+	if v := os.Getenv("SCHEMA_REF_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid SCHEMA_REF_CACHE_TTL: %w", err)
+		}
+		opts.CacheTTL = ttl
+	}
+
+	switch kind := os.Getenv("SCHEMA_REF_CACHE"); kind {
+	case "", "memory":
+		opts.Cache = NewMemoryRefCache()
+	case "redis":
+		if rdb == nil {
+			return opts, fmt.Errorf("SCHEMA_REF_CACHE=redis requires a Redis client")
+		}
+		opts.Cache = NewRedisRefCache(rdb)
+	case "disk":
+		dir := os.Getenv("SCHEMA_REF_CACHE_DIR")
+		if dir == "" {
+			dir = "./storage/schema-refs"
+		}
+		cache, err := NewDiskRefCache(dir)
+		if err != nil {
+			return opts, err
+		}
+		opts.Cache = cache
+	default:
+		return opts, fmt.Errorf("unknown SCHEMA_REF_CACHE %q", kind)
+	}
+	return opts, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// loadURL resolves a $ref document for the underlying compiler: local files
+// are read directly, remote documents come from the cache or, unless strict,
+// from the network
+func (c *Compiler) loadURL(ctx context.Context, s string) (io.ReadCloser, error) {
+	if !c.isRefAllowed(s) {
+		return nil, fmt.Errorf("%w: %s (not in allowlist)", ErrRefNotAllowed, s)
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return js.LoadURL(s)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	data, ok, err := c.refs.Cache.Get(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read $ref cache: %w", err)
+	}
+	if !ok {
+		if c.refs.Strict {
+			return nil, fmt.Errorf("%w: %s", ErrRefNotCached, s)
+		}
+		if data, err = c.fetch(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Prefetch downloads the given $ref documents into the cache, so they can
+// be resolved later without network access even in strict mode
+func (c *Compiler) Prefetch(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		if !c.isRefAllowed(u) {
+			return fmt.Errorf("%w: %s (not in allowlist)", ErrRefNotAllowed, u)
+		}
+		if _, err := c.fetch(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch downloads a remote document and stores it in the cache
+func (c *Compiler) fetch(ctx context.Context, s string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/schema+json, application/json")
+
+	resp, err := c.refs.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", s, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: status %d", s, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRefSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", s, err)
+	}
+	if len(data) > maxRefSize {
+		return nil, fmt.Errorf("failed to fetch %s: document larger than %d bytes", s, maxRefSize)
+	}
+
+	if err := c.refs.Cache.Set(ctx, s, data, c.refs.CacheTTL); err != nil {
+		return nil, fmt.Errorf("failed to cache %s: %w", s, err)
+	}
+	return data, nil
+}
+
+// RefCache stores fetched $ref documents by URL
+type RefCache interface {
+	Get(ctx context.Context, url string) ([]byte, bool, error)
+	Set(ctx context.Context, url string, data []byte, ttl time.Duration) error
+}
+
+// MemoryRefCache is a RefCache local to the process
+type MemoryRefCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryRef
+}
+
+type memoryRef struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemoryRefCache creates an empty in-process cache
+func NewMemoryRefCache() *MemoryRefCache {
+	return &MemoryRefCache{entries: make(map[string]memoryRef)}
+}
+
+func (m *MemoryRefCache) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[url]
+	if !ok || time.Now().After(e.expiresAt) {
+		delete(m.entries, url)
+		return nil, false, nil
+	}
+	return e.data, true, nil
+}
+
+func (m *MemoryRefCache) Set(ctx context.Context, url string, data []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[url] = memoryRef{data: data, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// RedisRefCache shares fetched documents between instances through Redis
+type RedisRefCache struct {
+	rdb *redis.Client
+}
+
+// NewRedisRefCache creates a cache storing documents under "schema:ref:<sha256>"
+func NewRedisRefCache(rdb *redis.Client) *RedisRefCache {
+	return &RedisRefCache{rdb: rdb}
+}
+
+func (r *RedisRefCache) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	data, err := r.rdb.Get(ctx, "schema:ref:"+urlKey(url)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (r *RedisRefCache) Set(ctx context.Context, url string, data []byte, ttl time.Duration) error {
+	return r.rdb.Set(ctx, "schema:ref:"+urlKey(url), data, ttl).Err()
+}
+
+// DiskRefCache keeps fetched documents as files, surviving restarts. The
+// file's modification time records when the entry expires.
+type DiskRefCache struct {
+	dir string
+}
+
+// NewDiskRefCache creates a cache in dir, creating it if needed
+func NewDiskRefCache(dir string) (*DiskRefCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create $ref cache directory: %w", err)
+	}
+	return &DiskRefCache{dir: dir}, nil
+}
+
+func (d *DiskRefCache) path(url string) string {
+	return filepath.Join(d.dir, urlKey(url)+".json")
+}
+
+func (d *DiskRefCache) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	path := d.path(url)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if time.Now().After(info.ModTime()) {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (d *DiskRefCache) Set(ctx context.Context, url string, data []byte, ttl time.Duration) error {
+	// Write to a temp file first so readers never see a partial document
+	tmp, err := os.CreateTemp(d.dir, "ref-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ttl)
+	if err := os.Chtimes(tmp.Name(), expiresAt, expiresAt); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(url))
+}
+
+func urlKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func refServer(t *testing.T) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write([]byte(`{"type": "string", "minLength": 2}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func refSchema(url string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"$ref": url},
+		},
+	}
+}
+
+func TestCompiler_RemoteRefIsCached(t *testing.T) {
+	srv, hits := refServer(t)
+	cache := NewMemoryRefCache()
+	ctx := context.Background()
+
+	c := NewCompilerWithOptions(8, RefOptions{Cache: cache})
+	require.NoError(t, c.Validate(ctx, "jsonschema", refSchema(srv.URL+"/name.json"), map[string]interface{}{"name": "Al"}))
+	assert.Error(t, c.Validate(ctx, "jsonschema", refSchema(srv.URL+"/name.json"), map[string]interface{}{"name": "A"}))
+
+	// A fresh compiler sharing the cache does not fetch again
+	c2 := NewCompilerWithOptions(8, RefOptions{Cache: cache})
+	require.NoError(t, c2.Prepare(ctx, refSchema(srv.URL+"/name.json")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+}
+
+func TestCompiler_StrictRefs(t *testing.T) {
+	srv, hits := refServer(t)
+	ctx := context.Background()
+
+	c := NewCompilerWithOptions(8, RefOptions{Strict: true})
+	err := c.Prepare(ctx, refSchema(srv.URL+"/name.json"))
+	assert.ErrorIs(t, err, ErrRefNotCached)
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits))
+
+	// Prefetched documents resolve without further fetches
+	c = NewCompilerWithOptions(8, RefOptions{Strict: true})
+	require.NoError(t, c.Prefetch(ctx, []string{srv.URL + "/name.json"}))
+	require.NoError(t, c.Prepare(ctx, refSchema(srv.URL+"/name.json")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+}
+
+func TestCompiler_RefAllowlist(t *testing.T) {
+	srv, hits := refServer(t)
+	ctx := context.Background()
+
+	c := NewCompilerWithOptions(8, RefOptions{Allowlist: []string{"https://schemas.example.com/*"}})
+	err := c.Prepare(ctx, refSchema(srv.URL+"/name.json"))
+	assert.ErrorIs(t, err, ErrRefNotAllowed)
+	assert.ErrorIs(t, c.Prefetch(ctx, []string{srv.URL + "/name.json"}), ErrRefNotAllowed)
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits))
+
+	// Local fragments are always allowed
+	local := map[string]interface{}{
+		"$defs":      map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+		"properties": map[string]interface{}{"name": map[string]interface{}{"$ref": "#/$defs/name"}},
+	}
+	assert.NoError(t, c.Prepare(ctx, local))
+}
+
+func TestDiskRefCache(t *testing.T) {
+	cache, err := NewDiskRefCache(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, ok, err := cache.Get(ctx, "https://example.com/a.json")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "https://example.com/a.json", []byte(`{}`), time.Hour))
+	data, ok, err := cache.Get(ctx, "https://example.com/a.json")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `{}`, string(data))
+
+	require.NoError(t, cache.Set(ctx, "https://example.com/a.json", []byte(`{}`), -time.Second))
+	_, ok, err = cache.Get(ctx, "https://example.com/a.json")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,186 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidResponseLimits is returned when a schema's "x-limits" are
+	// malformed
+	ErrInvalidResponseLimits = errors.New("invalid x-limits")
+	// ErrResponseTooLarge is returned by ResponseLimits.Check for payloads
+	// over a limit
+	ErrResponseTooLarge = errors.New("response payload too large")
+)
+
+// ResponseLimits bound the size of the answers to a request, declared in
+// the "x-limits" object at the root of its schema. They are checked before
+// schema validation, so oversized answers are refused without walking the
+// whole schema and never reach the database. Zero fields are unlimited.
+type ResponseLimits struct {
+	// MaxBytes is the largest payload, encoded as JSON
+	MaxBytes int `json:"maxBytes,omitempty"`
+	// MaxArrayItems is the most items of any array in the payload
+	MaxArrayItems int `json:"maxArrayItems,omitempty"`
+	// MaxStringLength is the most characters of any string in the payload
+	MaxStringLength int `json:"maxStringLength,omitempty"`
+}
+
+// LimitViolation describes a limit a payload exceeds
+type LimitViolation struct {
+	Limit string `json:"limit"` // "maxBytes", "maxArrayItems" or "maxStringLength"
+	Max   int    `json:"max"`
+	// InstanceLocation is a JSON pointer to the array or string over the
+	// limit; "" for the whole payload
+	InstanceLocation string `json:"instanceLocation"`
+}
+
+// ResponseLimitError is returned by ResponseLimits.Check and wraps
+// ErrResponseTooLarge
+type ResponseLimitError struct {
+	LimitViolation
+}
+
+func (e *ResponseLimitError) Error() string {
+	where := e.InstanceLocation
+	if where == "" {
+		where = "payload"
+	}
+	return fmt.Sprintf("%s is over %s of %d", where, e.Limit, e.Max)
+}
+
+func (e *ResponseLimitError) Unwrap() error {
+	return ErrResponseTooLarge
+}
+
+// ResponseLimitsOf returns the limits declared by schema, or zero limits if
+// it has none
+func ResponseLimitsOf(schema map[string]interface{}) (ResponseLimits, error) {
+	var limits ResponseLimits
+	raw, ok := schema["x-limits"]
+	if !ok {
+		return limits, nil
+	}
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return limits, fmt.Errorf("%w: must be an object", ErrInvalidResponseLimits)
+	}
+	for key, value := range object {
+		var dst *int
+		switch key {
+		case "maxBytes":
+			dst = &limits.MaxBytes
+		case "maxArrayItems":
+			dst = &limits.MaxArrayItems
+		case "maxStringLength":
+			dst = &limits.MaxStringLength
+		default:
+			return limits, fmt.Errorf("%w: unknown limit %q", ErrInvalidResponseLimits, key)
+		}
+		n, ok := value.(float64)
+		if i, isInt := value.(int); isInt {
+			n, ok = float64(i), true
+		}
+		if !ok || n < 1 || n != float64(int(n)) {
+			return limits, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidResponseLimits, key)
+		}
+		*dst = int(n)
+	}
+	return limits, nil
+}
+
+// ResponseLimitsFromEnv reads server-wide limits from RESPONSE_MAX_BYTES,
+// RESPONSE_MAX_ARRAY_ITEMS and RESPONSE_MAX_STRING_LENGTH. They apply to
+// every request, also those declaring looser limits of their own.
+func ResponseLimitsFromEnv() (ResponseLimits, error) {
+	var limits ResponseLimits
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"RESPONSE_MAX_BYTES", &limits.MaxBytes},
+		{"RESPONSE_MAX_ARRAY_ITEMS", &limits.MaxArrayItems},
+		{"RESPONSE_MAX_STRING_LENGTH", &limits.MaxStringLength},
+	} {
+		if s := os.Getenv(v.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return limits, fmt.Errorf("invalid %s: %q", v.name, s)
+			}
+			*v.dst = n
+		}
+	}
+	return limits, nil
+}
+
+// Within returns l with each limit lowered to that of max where max is
+// stricter, so a request cannot allow more than the server does
+func (l ResponseLimits) Within(max ResponseLimits) ResponseLimits {
+	lower := func(a, b int) int {
+		if a == 0 || (b > 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	return ResponseLimits{
+		MaxBytes:        lower(l.MaxBytes, max.MaxBytes),
+		MaxArrayItems:   lower(l.MaxArrayItems, max.MaxArrayItems),
+		MaxStringLength: lower(l.MaxStringLength, max.MaxStringLength),
+	}
+}
+
+// Check returns a *ResponseLimitError if payload exceeds a limit.
+// Arrays and strings are checked before the size of the whole payload, so
+// the error points at the offending value when there is one.
+func (l ResponseLimits) Check(payload map[string]interface{}) error {
+	if l == (ResponseLimits{}) {
+		return nil
+	}
+	if v := l.walk(payload, ""); v != nil {
+		return &ResponseLimitError{*v}
+	}
+	if l.MaxBytes > 0 {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode payload: %w", err)
+		}
+		if len(b) > l.MaxBytes {
+			return &ResponseLimitError{LimitViolation{Limit: "maxBytes", Max: l.MaxBytes}}
+		}
+	}
+	return nil
+}
+
+func (l ResponseLimits) walk(node interface{}, location string) *LimitViolation {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if found := l.walk(child, location+"/"+pointerEscaper.Replace(key)); found != nil {
+				return found
+			}
+		}
+	case []interface{}:
+		if l.MaxArrayItems > 0 && len(v) > l.MaxArrayItems {
+			return &LimitViolation{Limit: "maxArrayItems", Max: l.MaxArrayItems, InstanceLocation: location}
+		}
+		for i, child := range v {
+			if found := l.walk(child, location+"/"+strconv.Itoa(i)); found != nil {
+				return found
+			}
+		}
+	case string:
+		// Lengths in characters, as JSON Schema's maxLength counts them
+		if l.MaxStringLength > 0 && utf8.RuneCountInString(v) > l.MaxStringLength {
+			return &LimitViolation{Limit: "maxStringLength", Max: l.MaxStringLength, InstanceLocation: location}
+		}
+	}
+	return nil
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
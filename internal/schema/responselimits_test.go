@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseLimitsOf(t *testing.T) {
+	limits, err := ResponseLimitsOf(map[string]interface{}{"type": "object"})
+	require.NoError(t, err)
+	assert.Equal(t, ResponseLimits{}, limits)
+
+	limits, err = ResponseLimitsOf(map[string]interface{}{
+		"x-limits": map[string]interface{}{"maxBytes": float64(4096), "maxArrayItems": float64(10)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ResponseLimits{MaxBytes: 4096, MaxArrayItems: 10}, limits)
+
+	for _, bad := range []interface{}{
+		"4096",
+		map[string]interface{}{"maxRows": float64(1)},
+		map[string]interface{}{"maxBytes": float64(0)},
+		map[string]interface{}{"maxBytes": 1.5},
+		map[string]interface{}{"maxBytes": "1k"},
+	} {
+		_, err := ResponseLimitsOf(map[string]interface{}{"x-limits": bad})
+		assert.ErrorIs(t, err, ErrInvalidResponseLimits, "%v", bad)
+	}
+}
+
+func TestResponseLimitsCheck(t *testing.T) {
+	limits := ResponseLimits{MaxBytes: 200, MaxArrayItems: 3, MaxStringLength: 5}
+	assert.NoError(t, limits.Check(map[string]interface{}{"name": "Žofie", "tags": []interface{}{"a", "b", "c"}}))
+
+	cases := []struct {
+		payload  map[string]interface{}
+		expected LimitViolation
+	}{
+		{
+			map[string]interface{}{"a/b": map[string]interface{}{"name": "Bartoloměj"}},
+			LimitViolation{Limit: "maxStringLength", Max: 5, InstanceLocation: "/a~1b/name"},
+		},
+		{
+			map[string]interface{}{"tags": []interface{}{"a", "b", "c", "d"}},
+			LimitViolation{Limit: "maxArrayItems", Max: 3, InstanceLocation: "/tags"},
+		},
+		{
+			map[string]interface{}{"a": "xxxxx", "b": "xxxxx", "c": "xxxxx", "d": "xxxxx", "e": "xxxxx", "f": "xxxxx",
+				"g": "xxxxx", "h": "xxxxx", "i": "xxxxx", "j": "xxxxx", "k": "xxxxx", "l": "xxxxx", "m": "xxxxx",
+				"n": "xxxxx", "o": "xxxxx", "p": "xxxxx", "q": "xxxxx", "r": "xxxxx", "s": "xxxxx", "t": "xxxxx"},
+			LimitViolation{Limit: "maxBytes", Max: 200},
+		},
+	}
+	for _, tc := range cases {
+		err := limits.Check(tc.payload)
+		assert.ErrorIs(t, err, ErrResponseTooLarge)
+		var lerr *ResponseLimitError
+		require.True(t, errors.As(err, &lerr))
+		assert.Equal(t, tc.expected, lerr.LimitViolation)
+	}
+
+	assert.NoError(t, ResponseLimits{}.Check(map[string]interface{}{"name": strings.Repeat("x", 1<<16)}))
+}
+
+func TestResponseLimitsWithin(t *testing.T) {
+	declared := ResponseLimits{MaxBytes: 1000, MaxStringLength: 50}
+	server := ResponseLimits{MaxBytes: 500, MaxArrayItems: 20, MaxStringLength: 100}
+	assert.Equal(t, ResponseLimits{MaxBytes: 500, MaxArrayItems: 20, MaxStringLength: 50}, declared.Within(server))
+	assert.Equal(t, declared, declared.Within(ResponseLimits{}))
+}
@@ -0,0 +1,168 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive properties
+const Redacted = "[REDACTED]"
+
+// SensitivePaths lists the properties schema marks with "x-sensitive":
+// true, as dotted paths into an answer, e.g. "card.number". A "*" segment
+// stands for every item of an array or every value of a map. Local "#/"
+// $refs are followed; remote ones are not.
+func SensitivePaths(schema map[string]interface{}) []string {
+	w := sensitiveWalker{root: schema, paths: map[string]bool{}, refs: map[string]bool{}}
+	w.walk(schema, nil)
+
+	paths := make([]string, 0, len(w.paths))
+	for p := range w.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+type sensitiveWalker struct {
+	root  map[string]interface{}
+	paths map[string]bool
+	refs  map[string]bool // $refs being followed, to stop on cycles
+}
+
+func (w *sensitiveWalker) walk(node interface{}, path []string) {
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if sensitive, _ := schema["x-sensitive"].(bool); sensitive && len(path) > 0 {
+		w.paths[strings.Join(path, ".")] = true
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok && strings.HasPrefix(ref, "#") && !w.refs[ref] {
+		w.refs[ref] = true
+		w.walk(resolvePointer(w.root, ref[1:]), path)
+		delete(w.refs, ref)
+	}
+
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, sub := range properties {
+			w.walk(sub, appendPath(path, name))
+		}
+	}
+	if patterns, ok := schema["patternProperties"].(map[string]interface{}); ok {
+		for _, sub := range patterns {
+			w.walk(sub, appendPath(path, "*"))
+		}
+	}
+	w.walk(schema["additionalProperties"], appendPath(path, "*"))
+
+	switch items := schema["items"].(type) {
+	case map[string]interface{}:
+		w.walk(items, appendPath(path, "*"))
+	case []interface{}:
+		for _, sub := range items {
+			w.walk(sub, appendPath(path, "*"))
+		}
+	}
+	if prefix, ok := schema["prefixItems"].([]interface{}); ok {
+		for _, sub := range prefix {
+			w.walk(sub, appendPath(path, "*"))
+		}
+	}
+
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if subs, ok := schema[keyword].([]interface{}); ok {
+			for _, sub := range subs {
+				w.walk(sub, path)
+			}
+		}
+	}
+	for _, keyword := range []string{"if", "then", "else"} {
+		w.walk(schema[keyword], path)
+	}
+}
+
+func appendPath(path []string, segment string) []string {
+	next := make([]string, len(path), len(path)+1)
+	copy(next, path)
+	return append(next, segment)
+}
+
+// resolvePointer returns the value a JSON pointer such as "/$defs/card"
+// points at in doc, or nil
+func resolvePointer(doc interface{}, pointer string) interface{} {
+	if pointer == "" {
+		return doc
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		doc = m[token]
+	}
+	return doc
+}
+
+// Redact returns a copy of value with the properties at paths replaced by
+// Redacted. value itself is left unchanged.
+func Redact(value map[string]interface{}, paths []string) map[string]interface{} {
+	if value == nil || len(paths) == 0 {
+		return value
+	}
+	redacted, _ := copyValue(value).(map[string]interface{})
+	for _, p := range paths {
+		redactPath(redacted, strings.Split(p, "."))
+	}
+	return redacted
+}
+
+func redactPath(node interface{}, path []string) {
+	last := len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, v := range n {
+			if path[0] != "*" && path[0] != key {
+				continue
+			}
+			if last {
+				n[key] = Redacted
+			} else {
+				redactPath(v, path[1:])
+			}
+		}
+	case []interface{}:
+		if path[0] != "*" {
+			return
+		}
+		for i, v := range n {
+			if last {
+				n[i] = Redacted
+			} else {
+				redactPath(v, path[1:])
+			}
+		}
+	}
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = copyValue(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyValue(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSensitivePaths(t *testing.T) {
+	s := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"ssn":  map[string]interface{}{"type": "string", "x-sensitive": true},
+			"card": map[string]interface{}{"$ref": "#/$defs/card"},
+			"accounts": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"$ref": "#/$defs/account"},
+			},
+		},
+		"$defs": map[string]interface{}{
+			"card": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"number": map[string]interface{}{"x-sensitive": true},
+					"holder": map[string]interface{}{"type": "string"},
+				},
+			},
+			"account": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"iban": map[string]interface{}{"x-sensitive": true},
+					// Cycles are not followed twice
+					"linked": map[string]interface{}{"$ref": "#/$defs/account"},
+				},
+			},
+		},
+		"allOf": []interface{}{
+			map[string]interface{}{"properties": map[string]interface{}{"pin": map[string]interface{}{"x-sensitive": true}}},
+		},
+	}
+
+	assert.Equal(t, []string{"accounts.*.iban", "card.number", "pin", "ssn"}, SensitivePaths(s))
+	assert.Empty(t, SensitivePaths(map[string]interface{}{"$ref": "https://example.com/form.json"}))
+}
+
+func TestRedact(t *testing.T) {
+	value := map[string]interface{}{
+		"name": "Ada",
+		"ssn":  "078-05-1120",
+		"card": map[string]interface{}{"number": "4111111111111111", "holder": "Ada"},
+		"accounts": []interface{}{
+			map[string]interface{}{"iban": "DE89370400440532013000"},
+			map[string]interface{}{"iban": "DE02120300000000202051"},
+		},
+	}
+
+	redacted := Redact(value, []string{"accounts.*.iban", "card.number", "pin", "ssn"})
+	assert.Equal(t, map[string]interface{}{
+		"name": "Ada",
+		"ssn":  Redacted,
+		"card": map[string]interface{}{"number": Redacted, "holder": "Ada"},
+		"accounts": []interface{}{
+			map[string]interface{}{"iban": Redacted},
+			map[string]interface{}{"iban": Redacted},
+		},
+	}, redacted)
+
+	// The original answer is untouched
+	assert.Equal(t, "078-05-1120", value["ssn"])
+	assert.Equal(t, "4111111111111111", value["card"].(map[string]interface{})["number"])
+}
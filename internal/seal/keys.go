@@ -0,0 +1,136 @@
+package seal
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider holds the master keys that wrap data keys
+type KeyProvider interface {
+	// GenerateDataKey returns a new 256-bit data key wrapped under the
+	// current master key
+	GenerateDataKey(ctx context.Context) (DataKey, error)
+	// DecryptDataKey unwraps a data key wrapped under the master key keyID
+	DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// CurrentKeyID names the master key new data keys are wrapped under
+	CurrentKeyID() string
+}
+
+// DataKey is a data key in plaintext and wrapped under a master key
+type DataKey struct {
+	KeyID     string
+	Plaintext []byte
+	Wrapped   []byte
+}
+
+// Keyring is a KeyProvider holding its master keys in memory. The first key
+// wraps new data keys; the others only unwrap existing ones.
+type Keyring struct {
+	ids  []string
+	keys map[string][]byte
+}
+
+// NewKeyring creates a keyring from master keys in order; each must be 32
+// bytes
+func NewKeyring(ids []string, keys [][]byte) (*Keyring, error) {
+	if len(ids) == 0 || len(ids) != len(keys) {
+		return nil, fmt.Errorf("keyring needs at least one key and an id per key")
+	}
+	k := &Keyring{ids: ids, keys: make(map[string][]byte, len(ids))}
+	for i, id := range ids {
+		if id == "" {
+			return nil, fmt.Errorf("key %d has no id", i+1)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", id)
+		}
+		if len(keys[i]) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(keys[i]))
+		}
+		k.keys[id] = keys[i]
+	}
+	return k, nil
+}
+
+// LoadKeyring reads a key file holding one "<id>=<base64 key>" line per
+// master key, current key first. Blank lines and lines starting with # are
+// skipped.
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer f.Close()
+
+	var ids []string
+	var keys [][]byte
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("key file line %d: expected <id>=<base64 key>", line)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("key file line %d: %w", line, err)
+		}
+		ids = append(ids, strings.TrimSpace(id))
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return NewKeyring(ids, keys)
+}
+
+// CurrentKeyID returns the id of the first key
+func (k *Keyring) CurrentKeyID() string {
+	return k.ids[0]
+}
+
+// GenerateDataKey wraps a random data key under the current key
+func (k *Keyring) GenerateDataKey(ctx context.Context) (DataKey, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return DataKey{}, err
+	}
+	id := k.CurrentKeyID()
+	gcm, err := newGCM(k.keys[id])
+	if err != nil {
+		return DataKey{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return DataKey{}, err
+	}
+	return DataKey{
+		KeyID:     id,
+		Plaintext: plaintext,
+		Wrapped:   gcm.Seal(nonce, nonce, plaintext, []byte(id)),
+	}, nil
+}
+
+// DecryptDataKey unwraps a data key wrapped under the key keyID
+func (k *Keyring) DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+	gcm, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped data key too short")
+	}
+	return gcm.Open(nil, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], []byte(keyID))
+}
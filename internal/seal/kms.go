@@ -0,0 +1,62 @@
+package seal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMS is a KeyProvider whose master key is an AWS KMS key. Credentials and
+// region come from the default AWS configuration chain.
+type KMS struct {
+	client *kms.Client
+	keyARN string
+}
+
+// NewKMS creates a provider for a KMS key given by id, ARN or alias. The
+// key is resolved to its ARN, which identifies it in sealed values.
+func NewKMS(ctx context.Context, keyID string) (*KMS, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	client := kms.NewFromConfig(cfg)
+	out, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe KMS key %s: %w", keyID, err)
+	}
+	return &KMS{client: client, keyARN: aws.ToString(out.KeyMetadata.Arn)}, nil
+}
+
+// CurrentKeyID returns the ARN of the KMS key
+func (k *KMS) CurrentKeyID() string {
+	return k.keyARN
+}
+
+// GenerateDataKey asks KMS for a data key
+func (k *KMS) GenerateDataKey(ctx context.Context) (DataKey, error) {
+	out, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(k.keyARN),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return DataKey{}, err
+	}
+	return DataKey{KeyID: k.keyARN, Plaintext: out.Plaintext, Wrapped: out.CiphertextBlob}, nil
+}
+
+// DecryptDataKey asks KMS to unwrap a data key
+func (k *KMS) DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	out, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,260 @@
+// Package seal encrypts sensitive JSON values before they are stored.
+//
+// Values are envelope-encrypted: each is encrypted with AES-256-GCM under a
+// data key, and the data key is stored next to it wrapped under a master key
+// held by a KeyProvider (a local key file or AWS KMS). A sealed value is
+// stored as a JSON object with a single "$sealed" member, so it fits the
+// JSONB column the plaintext used and plaintext written before encryption
+// was enabled still reads.
+package seal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// sealedKey is the member holding the envelope of a sealed value
+const sealedKey = "$sealed"
+
+// envelopeVersion is the version of the envelope format written by Seal
+const envelopeVersion = 1
+
+// A data key is reused for values sealed within dataKeyMaxAge, up to
+// dataKeyMaxUses times, so sealing does not call the key provider for every
+// value
+const (
+	dataKeyMaxAge  = 5 * time.Minute
+	dataKeyMaxUses = 1 << 20
+)
+
+// ErrNoKeys is returned when opening a sealed value without a key provider
+var ErrNoKeys = errors.New("value is encrypted but no payload key provider is configured")
+
+// Sealer seals and opens values. A nil Sealer stores values in plaintext.
+type Sealer struct {
+	keys KeyProvider
+
+	mu      sync.Mutex
+	current *DataKey
+	created time.Time
+	uses    int
+
+	// Unwrapped data keys by wrapped key
+	cache *lru.Cache[string, []byte]
+}
+
+// New creates a Sealer wrapping data keys with keys
+func New(keys KeyProvider) *Sealer {
+	cache, _ := lru.New[string, []byte](1024)
+	return &Sealer{keys: keys, cache: cache}
+}
+
+// FromEnv creates the Sealer configured by PAYLOAD_KEY_PROVIDER: "local"
+// reads the master keys from PAYLOAD_KEY_FILE, "aws-kms" uses the KMS key
+// PAYLOAD_KMS_KEY_ID. It returns nil when no provider is configured.
+func FromEnv(ctx context.Context) (*Sealer, error) {
+	switch provider := os.Getenv("PAYLOAD_KEY_PROVIDER"); provider {
+	case "", "none":
+		return nil, nil
+	case "local":
+		path := os.Getenv("PAYLOAD_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("PAYLOAD_KEY_FILE is required for the local key provider")
+		}
+		keys, err := LoadKeyring(path)
+		if err != nil {
+			return nil, err
+		}
+		return New(keys), nil
+	case "aws-kms":
+		keyID := os.Getenv("PAYLOAD_KMS_KEY_ID")
+		if keyID == "" {
+			return nil, fmt.Errorf("PAYLOAD_KMS_KEY_ID is required for the aws-kms key provider")
+		}
+		keys, err := NewKMS(ctx, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return New(keys), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYLOAD_KEY_PROVIDER %q", provider)
+	}
+}
+
+// Field names the stored value a ciphertext belongs to, e.g.
+// Field("responses", "payload", id). It is authenticated with the
+// ciphertext, so a sealed value copied to another row does not open.
+func Field(table, column, id string) string {
+	return table + "." + column + ":" + id
+}
+
+type envelope struct {
+	Version int    `json:"v"`
+	KeyID   string `json:"kid"`
+	DataKey string `json:"dk"`
+	Data    string `json:"ct"` // Nonce followed by the ciphertext
+}
+
+// IsSealed reports whether v is a sealed value
+func IsSealed(v map[string]interface{}) bool {
+	_, ok := v[sealedKey]
+	return ok && len(v) == 1
+}
+
+// Enabled reports whether values are sealed
+func (s *Sealer) Enabled() bool {
+	return s != nil
+}
+
+// Seal encrypts v for the stored value named by field. Nil stays nil, and
+// a nil Sealer returns v as is.
+func (s *Sealer) Seal(ctx context.Context, v map[string]interface{}, field string) (map[string]interface{}, error) {
+	if s == nil || v == nil {
+		return v, nil
+	}
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value: %w", err)
+	}
+	key, err := s.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return map[string]interface{}{sealedKey: map[string]interface{}{
+		"v":   envelopeVersion,
+		"kid": key.KeyID,
+		"dk":  base64.StdEncoding.EncodeToString(key.Wrapped),
+		"ct":  base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, []byte(field))),
+	}}, nil
+}
+
+// Open decrypts a value sealed for field. Values that are not sealed are
+// returned as is.
+func (s *Sealer) Open(ctx context.Context, v map[string]interface{}, field string) (map[string]interface{}, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+	if s == nil {
+		return nil, ErrNoKeys
+	}
+	env, err := parseEnvelope(v)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(env.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed value: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(env.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed value: %w", err)
+	}
+
+	key, err := s.unwrap(ctx, env.KeyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed value: ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(field))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", field, err)
+	}
+
+	var opened map[string]interface{}
+	if err := json.Unmarshal(plaintext, &opened); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", field, err)
+	}
+	return opened, nil
+}
+
+// Stale reports whether v needs sealing again: it is plaintext, or sealed
+// under a master key other than the current one
+func (s *Sealer) Stale(v map[string]interface{}) bool {
+	if s == nil || v == nil {
+		return false
+	}
+	if !IsSealed(v) {
+		return true
+	}
+	env, err := parseEnvelope(v)
+	return err == nil && env.KeyID != s.keys.CurrentKeyID()
+}
+
+// dataKey returns the data key to seal with, generating a new one when the
+// current one is too old or used up
+func (s *Sealer) dataKey(ctx context.Context) (*DataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil || time.Since(s.created) > dataKeyMaxAge || s.uses >= dataKeyMaxUses ||
+		s.current.KeyID != s.keys.CurrentKeyID() {
+		key, err := s.keys.GenerateDataKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate data key: %w", err)
+		}
+		s.current, s.created, s.uses = &key, time.Now(), 0
+	}
+	s.uses++
+	return s.current, nil
+}
+
+func (s *Sealer) unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	cacheKey := keyID + "/" + string(wrapped)
+	if key, ok := s.cache.Get(cacheKey); ok {
+		return key, nil
+	}
+	key, err := s.keys.DecryptDataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	s.cache.Add(cacheKey, key)
+	return key, nil
+}
+
+func parseEnvelope(v map[string]interface{}) (envelope, error) {
+	var env envelope
+	raw, err := json.Marshal(v[sealedKey])
+	if err == nil {
+		err = json.Unmarshal(raw, &env)
+	}
+	if err != nil {
+		return env, fmt.Errorf("invalid sealed value: %w", err)
+	}
+	if env.Version != envelopeVersion {
+		return env, fmt.Errorf("unsupported sealed value version %d", env.Version)
+	}
+	return env, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,103 @@
+package seal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	keys := make([][]byte, len(ids))
+	for i, id := range ids {
+		keys[i] = bytes.Repeat([]byte(id[len(id)-1:]), 32)
+	}
+	k, err := NewKeyring(ids, keys)
+	require.NoError(t, err)
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	ctx := context.Background()
+	s := New(testKeyring(t, "k1"))
+	value := map[string]interface{}{"iban": "DE89370400440532013000", "amount": 12.5}
+
+	sealed, err := s.Seal(ctx, value, Field("responses", "payload", "r1"))
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed[sealedKey].(map[string]interface{})["ct"], "DE89")
+
+	opened, err := s.Open(ctx, sealed, Field("responses", "payload", "r1"))
+	require.NoError(t, err)
+	assert.Equal(t, value, opened)
+
+	// Bound to the row it was sealed for
+	_, err = s.Open(ctx, sealed, Field("responses", "payload", "r2"))
+	assert.Error(t, err)
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	ctx := context.Background()
+	value := map[string]interface{}{"name": "Ada"}
+
+	opened, err := New(testKeyring(t, "k1")).Open(ctx, value, "f")
+	require.NoError(t, err)
+	assert.Equal(t, value, opened)
+
+	var none *Sealer
+	stored, err := none.Seal(ctx, value, "f")
+	require.NoError(t, err)
+	assert.Equal(t, value, stored)
+
+	sealed, err := New(testKeyring(t, "k1")).Seal(ctx, value, "f")
+	require.NoError(t, err)
+	_, err = none.Open(ctx, sealed, "f")
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	old := New(testKeyring(t, "k1"))
+	sealed, err := old.Seal(ctx, map[string]interface{}{"a": "b"}, "f")
+	require.NoError(t, err)
+	assert.False(t, old.Stale(sealed))
+
+	// k2 is current, k1 still opens existing values
+	rotated := New(testKeyring(t, "k2", "k1"))
+	assert.True(t, rotated.Stale(sealed))
+	assert.True(t, rotated.Stale(map[string]interface{}{"a": "b"}))
+	opened, err := rotated.Open(ctx, sealed, "f")
+	require.NoError(t, err)
+
+	resealed, err := rotated.Seal(ctx, opened, "f")
+	require.NoError(t, err)
+	assert.False(t, rotated.Stale(resealed))
+
+	// Without k1 the old value no longer opens
+	_, err = New(testKeyring(t, "k2")).Open(ctx, sealed, "f")
+	assert.Error(t, err)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, os.WriteFile(path, []byte("# current first\n2024-06="+key+"\n\n2023-01 = "+key+"\n"), 0600))
+
+	k, err := LoadKeyring(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", k.CurrentKeyID())
+	assert.Len(t, k.keys, 2)
+
+	require.NoError(t, os.WriteFile(path, []byte("k1="+base64.StdEncoding.EncodeToString([]byte("short"))+"\n"), 0600))
+	_, err = LoadKeyring(path)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("k1="+key+"\nk1="+key+"\n"), 0600))
+	_, err = LoadKeyring(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,256 @@
+// Package seed loads fixture files of entities, saved views and sample
+// requests into a database, for demos and integration environments.
+// Loading is idempotent: entities are matched by handle, views by name and
+// requests by their fixture name, so a file can be applied again after it
+// was edited.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultCreatedBy is the requestor of fixture requests that name none
+const DefaultCreatedBy = "seed"
+
+// tagPrefix marks the requests created from fixtures; the fixture name
+// follows it
+const tagPrefix = "seed:"
+
+// Fixtures is the content of a fixture file
+type Fixtures struct {
+	Entities []Entity  `json:"entities"`
+	Requests []Request `json:"requests"`
+}
+
+// Entity is an entity and its saved views
+type Entity struct {
+	Kind    model.EntityKind       `json:"kind"`
+	Handle  string                 `json:"handle"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	Sandbox bool                   `json:"sandbox,omitempty"`
+	Views   []View                 `json:"views,omitempty"`
+}
+
+// View is a saved inquiry filter of an entity
+type View struct {
+	Name   string           `json:"name"`
+	Filter model.ViewFilter `json:"filter"`
+}
+
+// Request is a sample request. It takes the fields of POST /v1/requests
+// and createdBy; the deadline, attention and expiry times can also be given
+// relative to when the fixtures are applied, e.g. deadlineIn: 48h.
+type Request struct {
+	Name string `json:"name"`
+	service.CreateRequestInput
+	DeadlineIn  string `json:"deadlineIn,omitempty"`
+	AttentionIn string `json:"attentionIn,omitempty"`
+	ExpiresIn   string `json:"expiresIn,omitempty"`
+}
+
+// Stats counts what Apply did
+type Stats struct {
+	EntitiesCreated  int `json:"entitiesCreated"`
+	EntitiesUpdated  int `json:"entitiesUpdated"`
+	ViewsCreated     int `json:"viewsCreated"`
+	ViewsUpdated     int `json:"viewsUpdated"`
+	RequestsCreated  int `json:"requestsCreated"`
+	RequestsExisting int `json:"requestsExisting"` // Created by an earlier run
+}
+
+// Load reads fixtures in YAML, or JSON, which is YAML too. Unknown fields
+// are rejected so typos do not go unnoticed.
+func Load(r io.Reader) (*Fixtures, error) {
+	var raw interface{}
+	if err := yaml.NewDecoder(r).Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid fixtures: %w", err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixtures: %w", err)
+	}
+
+	var f Fixtures
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil && string(data) != "null" {
+		return nil, fmt.Errorf("invalid fixtures: %w", err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (f *Fixtures) validate() error {
+	handles := make(map[string]bool, len(f.Entities))
+	for i, e := range f.Entities {
+		if e.Handle == "" {
+			return fmt.Errorf("entity %d has no handle", i)
+		}
+		if handles[e.Handle] {
+			return fmt.Errorf("entity %q is listed twice", e.Handle)
+		}
+		handles[e.Handle] = true
+		if !e.Kind.Valid() {
+			return fmt.Errorf("entity %q has unknown kind %q", e.Handle, e.Kind)
+		}
+	}
+	names := make(map[string]bool, len(f.Requests))
+	for i, r := range f.Requests {
+		if r.Name == "" {
+			return fmt.Errorf("request %d has no name", i)
+		}
+		// The name is kept as a tag, so it follows the rules of tags
+		tags, err := service.NormalizeTags([]string{tagPrefix + r.Name})
+		if err != nil {
+			return fmt.Errorf("request %q: %w", r.Name, err)
+		}
+		if names[tags[0]] {
+			return fmt.Errorf("request %q is listed twice", r.Name)
+		}
+		names[tags[0]] = true
+		for _, d := range []string{r.DeadlineIn, r.AttentionIn, r.ExpiresIn} {
+			if _, err := parseOffset(d); err != nil {
+				return fmt.Errorf("request %q: %w", r.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseOffset(s string) (*time.Duration, error) {
+	if s == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", s)
+	}
+	return &d, nil
+}
+
+// Apply creates or updates the entities and views of f and creates the
+// requests that do not exist yet. Entities come first, so requests can be
+// addressed to them by handle. It stops at the first error; what was
+// applied until then stays.
+func Apply(ctx context.Context, f *Fixtures, entities *service.EntityService, requests *service.RequestService) (Stats, error) {
+	var stats Stats
+	for _, e := range f.Entities {
+		if err := applyEntity(ctx, e, entities, &stats); err != nil {
+			return stats, fmt.Errorf("entity %q: %w", e.Handle, err)
+		}
+	}
+	for _, r := range f.Requests {
+		if err := applyRequest(ctx, r, requests, &stats); err != nil {
+			return stats, fmt.Errorf("request %q: %w", r.Name, err)
+		}
+	}
+	return stats, nil
+}
+
+func applyEntity(ctx context.Context, e Entity, entities *service.EntityService, stats *Stats) error {
+	existing, err := entities.ResolveEntity(ctx, "", e.Handle)
+	if errors.Is(err, service.ErrNotFound) {
+		existing, err = entities.CreateEntity(ctx, e.Kind, e.Handle, e.Meta, e.Sandbox)
+		if err != nil {
+			return err
+		}
+		stats.EntitiesCreated++
+	} else if err != nil {
+		return err
+	} else if existing.Kind != e.Kind {
+		return fmt.Errorf("exists as a %s", existing.Kind)
+	}
+
+	// Profiles and views are changed as the entity itself
+	ctx = auth.WithEntityID(ctx, existing.ID)
+	if e.Meta != nil && !reflect.DeepEqual(existing.Meta, e.Meta) {
+		if _, err := entities.UpdateEntity(ctx, existing.ID, nil, e.Meta); err != nil {
+			return err
+		}
+		stats.EntitiesUpdated++
+	}
+	if len(e.Views) == 0 {
+		return nil
+	}
+
+	views, err := entities.ListViews(ctx, existing.ID)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]string, len(views))
+	for _, v := range views {
+		byName[v.Name] = v.ID
+	}
+	for _, v := range e.Views {
+		if id, ok := byName[v.Name]; ok {
+			if _, err := entities.UpdateView(ctx, existing.ID, id, v.Name, v.Filter); err != nil {
+				return fmt.Errorf("view %q: %w", v.Name, err)
+			}
+			stats.ViewsUpdated++
+			continue
+		}
+		if _, err := entities.CreateView(ctx, existing.ID, v.Name, v.Filter); err != nil {
+			return fmt.Errorf("view %q: %w", v.Name, err)
+		}
+		stats.ViewsCreated++
+	}
+	return nil
+}
+
+func applyRequest(ctx context.Context, r Request, requests *service.RequestService, stats *Stats) error {
+	input := r.CreateRequestInput
+	if input.CreatedBy == "" {
+		input.CreatedBy = DefaultCreatedBy
+	}
+	tag := tagPrefix + r.Name
+	input.Tags = append(append([]string(nil), input.Tags...), tag)
+
+	found, err := requests.SearchRequests(ctx, db.RequestFilter{
+		CreatedBy: &input.CreatedBy,
+		Tags:      []string{tag},
+	}, "", 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		stats.RequestsExisting++
+		return nil
+	}
+
+	now := time.Now()
+	for _, t := range []struct {
+		offset string
+		at     **time.Time
+	}{
+		{r.DeadlineIn, &input.DeadlineAt},
+		{r.AttentionIn, &input.AttentionAt},
+		{r.ExpiresIn, &input.ExpiresAt},
+	} {
+		if d, _ := parseOffset(t.offset); d != nil {
+			at := now.Add(*d)
+			*t.at = &at
+		}
+	}
+
+	if _, err := requests.CreateRequest(ctx, input); err != nil {
+		return err
+	}
+	stats.RequestsCreated++
+	return nil
+}
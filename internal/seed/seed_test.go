@@ -0,0 +1,117 @@
+package seed_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+	"pxbox/internal/schema"
+	"pxbox/internal/seed"
+	"pxbox/internal/service"
+	pxtest "pxbox/internal/testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fixtures = `
+entities:
+  - kind: user
+    handle: ada
+    meta: {name: Ada}
+    views:
+      - name: Finance
+        filter: {tags: [finance], sortBy: deadline}
+  - kind: group
+    handle: accounting
+requests:
+  - name: welcome
+    entity: {handle: ada}
+    schema:
+      type: object
+      properties:
+        name: {type: string}
+    tags: [finance]
+    deadlineIn: 48h
+  - name: invoice
+    createdBy: billing
+    entity: {handle: accounting}
+    schema: {type: object}
+`
+
+func TestApply(t *testing.T) {
+	queries := pxtest.NewQueries()
+	entities := service.NewEntityService(queries)
+	requests := service.NewRequestService(queries, schema.NewCompilerWithCache(16), entities, pxtest.NewBus())
+	jobs := pxtest.NewJobClient()
+	requests.SetJobClient(jobs)
+	ctx := context.Background()
+
+	f, err := seed.Load(strings.NewReader(fixtures))
+	require.NoError(t, err)
+	stats, err := seed.Apply(ctx, f, entities, requests)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Stats{EntitiesCreated: 2, ViewsCreated: 1, RequestsCreated: 2}, stats)
+
+	ada, err := entities.ResolveEntity(ctx, "", "ada")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, ada.Meta)
+	views, err := entities.ListViews(auth.WithEntityID(ctx, ada.ID), ada.ID)
+	require.NoError(t, err)
+	require.Len(t, views, 1)
+	assert.Equal(t, model.ViewFilter{Tags: []string{"finance"}, SortBy: "deadline"}, views[0].Filter)
+
+	welcome, err := requests.SearchRequests(ctx, db.RequestFilter{Tags: []string{"seed:welcome"}}, "", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, welcome, 1)
+	assert.Equal(t, seed.DefaultCreatedBy, welcome[0].CreatedBy)
+	assert.Equal(t, []string{"finance", "seed:welcome"}, welcome[0].Tags)
+	require.NotNil(t, welcome[0].DeadlineAt)
+	assert.Len(t, jobs.Jobs("ScheduleDeadlineNotification"), 1)
+
+	// Applying again changes only what the fixtures changed
+	f.Entities[0].Meta = map[string]interface{}{"name": "Ada Lovelace"}
+	stats, err = seed.Apply(ctx, f, entities, requests)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Stats{EntitiesUpdated: 1, ViewsUpdated: 1, RequestsExisting: 2}, stats)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"syntax":        "entities: [",
+		"unknown field": "entities: [{kind: user, handle: ada, nick: x}]",
+		"no handle":     "entities: [{kind: user}]",
+		"kind":          "entities: [{kind: robot, handle: r2}]",
+		"no name":       "requests: [{entity: {handle: ada}}]",
+		"duplicate":     "requests: [{name: a}, {name: A}]",
+		"bad name":      "requests: [{name: two words}]",
+		"duration":      "requests: [{name: a, deadlineIn: tomorrow}]",
+	} {
+		_, err := seed.Load(strings.NewReader(content))
+		assert.Error(t, err, name)
+	}
+
+	f, err := seed.Load(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Empty(t, f.Entities)
+}
+
+func TestLoad_Demo(t *testing.T) {
+	r, err := os.Open("../../fixtures/demo.yaml")
+	require.NoError(t, err)
+	defer r.Close()
+	f, err := seed.Load(r)
+	require.NoError(t, err)
+
+	queries := pxtest.NewQueries()
+	entities := service.NewEntityService(queries)
+	requests := service.NewRequestService(queries, schema.NewCompilerWithCache(16), entities, pxtest.NewBus())
+	requests.SetJobClient(pxtest.NewJobClient())
+	stats, err := seed.Apply(context.Background(), f, entities, requests)
+	require.NoError(t, err)
+	assert.Equal(t, len(f.Requests), stats.RequestsCreated)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+)
+
+// maxActivityEntries bounds the audit entries and comments a timeline is
+// built from; longer histories keep their newest entries
+const maxActivityEntries = 1000
+
+// activityKinds names the timeline entries of audited request actions
+var activityKinds = map[string]string{
+	audit.ActionClaim:    "claimed",
+	audit.ActionUnclaim:  "unclaimed",
+	audit.ActionAnswer:   "answered",
+	audit.ActionAccept:   "accepted",
+	audit.ActionReject:   "rejected",
+	audit.ActionCancel:   "cancelled",
+	audit.ActionExpire:   "expired",
+	audit.ActionDeadline: "deadline_changed",
+	audit.ActionTag:      "tagged",
+	audit.ActionShare:    "shared",
+	audit.ActionUpdate:   "updated",
+	audit.ActionErase:    "erased",
+}
+
+// activity is a timeline entry before its time is formatted
+type activity struct {
+	at   time.Time
+	item model.ActivityItem
+}
+
+// GetActivity returns the history of a request, oldest first: its creation,
+// delivery and first read, the comments in its thread and every audited
+// action on it, such as claims, answers, reviews and deadline changes. Only
+// the participants and admins can read it.
+func (s *RequestService) GetActivity(ctx context.Context, id string) ([]model.ActivityItem, error) {
+	req, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if _, _, ok := commentAuthor(ctx, req); !ok && !auth.IsAdmin(ctx) {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_participant", Message: "only the target entity and the requestor can read the activity"}
+	}
+
+	timeline := []activity{{at: req.CreatedAt, item: model.ActivityItem{Kind: "created", Actor: req.CreatedBy}}}
+	if req.DeliveredAt != nil {
+		timeline = append(timeline, activity{at: *req.DeliveredAt, item: model.ActivityItem{Kind: "delivered", Actor: req.EntityID}})
+	}
+	if req.ReadAt != nil {
+		timeline = append(timeline, activity{at: *req.ReadAt, item: model.ActivityItem{Kind: "read", Actor: req.EntityID}})
+	}
+
+	resourceType := audit.ResourceRequest
+	entries, err := s.queries.ListAuditEntries(ctx, db.AuditFilter{ResourceType: &resourceType, ResourceID: &id}, maxActivityEntries, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if a, ok := auditActivity(entries[i]); ok {
+			timeline = append(timeline, a)
+		}
+	}
+
+	comments, err := s.queries.ListComments(ctx, id, maxActivityEntries, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	for _, c := range comments {
+		timeline = append(timeline, activity{at: c.CreatedAt, item: model.ActivityItem{
+			Kind:    "commented",
+			Actor:   c.Author,
+			Details: map[string]interface{}{"commentId": c.ID, "authorRole": c.AuthorRole, "body": c.Body},
+		}})
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].at.Before(timeline[j].at) })
+	result := make([]model.ActivityItem, 0, len(timeline))
+	for _, a := range timeline {
+		a.item.At = a.at.UTC().Format(time.RFC3339)
+		result = append(result, a.item)
+	}
+	return result, nil
+}
+
+// auditActivity turns an audit entry into a timeline entry. Creation and
+// comments are left to the request and its thread, which hold them even
+// without an audit log.
+func auditActivity(e db.AuditEntry) (activity, bool) {
+	if e.Action == audit.ActionCreate || e.Action == audit.ActionComment {
+		return activity{}, false
+	}
+	kind, ok := activityKinds[e.Action]
+	if !ok {
+		kind = e.Action
+	}
+	item := model.ActivityItem{Kind: kind, Actor: e.Actor, Details: e.Meta}
+	if e.AfterStatus != nil && (e.BeforeStatus == nil || *e.BeforeStatus != *e.AfterStatus) {
+		item.Status = *e.AfterStatus
+	}
+	if len(item.Details) == 0 {
+		item.Details = nil
+	}
+	return activity{at: e.OccurredAt, item: item}, true
+}
@@ -0,0 +1,57 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetActivity(t *testing.T) {
+	f := newRequestFixture(t)
+	requestor := auth.WithClientID(context.Background(), "client-1")
+	entity := auth.WithEntityID(context.Background(), f.entity.ID)
+	req := f.create(t, service.CreateRequestInput{})
+
+	_, err := f.svc.GetActivity(auth.WithClientID(context.Background(), "client-2"), req.ID)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+
+	_, err = f.svc.AddComment(entity, req.ID, "Which name?", nil)
+	require.NoError(t, err)
+	record := func(at time.Time, action, before, after string) {
+		require.NoError(t, f.queries.InsertAuditEntry(context.Background(), db.InsertAuditEntryParams{
+			OccurredAt:   at,
+			Actor:        f.entity.ID,
+			Action:       action,
+			ResourceType: audit.ResourceRequest,
+			ResourceID:   req.ID,
+			BeforeStatus: &before,
+			AfterStatus:  &after,
+		}))
+	}
+	now := time.Now()
+	record(now.Add(2*time.Hour), audit.ActionAnswer, "CLAIMED", "ANSWERED")
+	record(now.Add(time.Hour), audit.ActionClaim, "PENDING", "CLAIMED")
+	record(now.Add(time.Hour), audit.ActionComment, "", "")
+
+	items, err := f.svc.GetActivity(requestor, req.ID)
+	require.NoError(t, err)
+	kinds := make([]string, len(items))
+	for i, item := range items {
+		kinds[i] = item.Kind
+	}
+	assert.Equal(t, []string{"created", "commented", "claimed", "answered"}, kinds)
+	assert.Equal(t, "client-1", items[0].Actor)
+	assert.Equal(t, "Which name?", items[1].Details["body"])
+	assert.Equal(t, "CLAIMED", items[2].Status)
+
+	_, err = f.svc.GetActivity(entity, req.ID)
+	assert.NoError(t, err)
+}
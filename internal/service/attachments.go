@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/storage"
+)
+
+// MaxAttachments limits the files a requestor attaches to one request
+const MaxAttachments = 10
+
+// checkAttachments normalizes the files a requestor attaches to a new
+// request and checks them like entity uploads: against the request's file
+// policy and, for uploads through the file proxy, their scan status
+func (s *RequestService) checkAttachments(ctx context.Context, files []map[string]interface{}, filesPolicy map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if len(files) > MaxAttachments {
+		return nil, invalid("invalid_attachments", fmt.Sprintf("a request has at most %d attachments", MaxAttachments), nil)
+	}
+	normalized, err := storage.NormalizeFiles(files)
+	if err != nil {
+		return nil, invalid("invalid_attachments", "invalid attachment metadata", err)
+	}
+	if err := checkFilePolicy(db.Request{FilesPolicy: filesPolicy}, normalized); err != nil {
+		return nil, err
+	}
+	if err := s.checkFileScans(ctx, normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// canSeeAttachments reports whether the caller may download the
+// attachments of req: an admin, the target entity or the requestor
+func canSeeAttachments(ctx context.Context, req db.Request) bool {
+	if auth.IsAdmin(ctx) {
+		return true
+	}
+	_, _, ok := commentAuthor(ctx, req)
+	return ok
+}
+
+// attachments returns the attachments of req for the caller, with fresh
+// presigned download URLs for files in storage. Callers other than the
+// participants get none.
+func (s *RequestService) attachments(ctx context.Context, req db.Request) ([]map[string]interface{}, error) {
+	if !canSeeAttachments(ctx, req) {
+		return nil, nil
+	}
+	return s.signedAttachments(ctx, req.ID)
+}
+
+// signedAttachments returns the attachments of a request with presigned
+// download URLs, without checking who asks
+func (s *RequestService) signedAttachments(ctx context.Context, requestID string) ([]map[string]interface{}, error) {
+	files, err := s.queries.ListRequestFiles(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	if s.fileResolver == nil || s.fileStorage == nil {
+		return files, nil
+	}
+	out := make([]map[string]interface{}, len(files))
+	for i, f := range files {
+		out[i] = f
+		url, _ := f["url"].(string)
+		key, ok := s.fileResolver.ObjectName(url)
+		if !ok {
+			continue
+		}
+		presigned, err := s.fileStorage.PresignGet(ctx, key, 24*time.Hour)
+		if err != nil {
+			continue
+		}
+		signed := make(map[string]interface{}, len(f))
+		for k, v := range f {
+			signed[k] = v
+		}
+		signed["url"] = presigned
+		out[i] = signed
+	}
+	return out, nil
+}
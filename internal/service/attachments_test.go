@@ -0,0 +1,64 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func invoice(name, mime string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "url": "https://files.example.com/" + name, "size": 1024, "mime": mime}
+}
+
+func TestRequestService_Attachments(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{
+		Attachments: []map[string]interface{}{invoice("invoice.pdf", "application/pdf"), invoice("instructions.pdf", "application/pdf")},
+	})
+
+	requestor := auth.WithClientID(context.Background(), "client-1")
+	got, err := f.svc.GetRequest(requestor, req.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Attachments, 2)
+	assert.Equal(t, "invoice.pdf", got.Attachments[0]["name"])
+	assert.Equal(t, "https://files.example.com/instructions.pdf", got.Attachments[1]["url"])
+
+	entity := auth.WithEntityID(context.Background(), f.entity.ID)
+	got, err = f.svc.GetRequest(entity, req.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Attachments, 2)
+
+	// Other callers see the request without its attachments
+	got, err = f.svc.GetRequest(auth.WithClientID(context.Background(), "client-2"), req.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Attachments)
+}
+
+func TestRequestService_AttachmentsRejected(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	input := service.CreateRequestInput{Schema: nameSchema, CreatedBy: "client-1"}
+	input.Entity.Handle = "ada"
+
+	input.Attachments = []map[string]interface{}{{"name": "invoice.pdf"}}
+	_, err := f.svc.CreateRequest(ctx, input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	input.Attachments = []map[string]interface{}{invoice("invoice.pdf", "application/pdf")}
+	input.FilesPolicy = map[string]interface{}{"mime": []interface{}{"image/*"}}
+	_, err = f.svc.CreateRequest(ctx, input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	input.FilesPolicy = nil
+	input.Attachments = nil
+	for i := 0; i <= service.MaxAttachments; i++ {
+		input.Attachments = append(input.Attachments, invoice("page.pdf", "application/pdf"))
+	}
+	_, err = f.svc.CreateRequest(ctx, input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+)
+
+// MaxBatchRequests is the most requests CreateRequests takes at once
+const MaxBatchRequests = 100
+
+// BatchResult is the outcome of one request of a batch: the request
+// created, or the error that rejected it
+type BatchResult struct {
+	Request *model.Request
+	Err     error
+}
+
+// CreateRequests creates requests to the same or different entities from
+// createdBy. Each request is validated on its own and the valid ones are
+// inserted together in one transaction; rejected requests get their error
+// in the result at their index. An error is returned only if the batch is
+// malformed or the insert fails, in which case nothing is created.
+func (s *RequestService) CreateRequests(ctx context.Context, inputs []CreateRequestInput, createdBy string) ([]BatchResult, error) {
+	if len(inputs) == 0 || len(inputs) > MaxBatchRequests {
+		return nil, invalid("invalid_batch", fmt.Sprintf("a batch holds 1 to %d requests", MaxBatchRequests), nil)
+	}
+
+	results := make([]BatchResult, len(inputs))
+	prepared := make([]*preparedRequest, 0, len(inputs))
+	indexes := make([]int, 0, len(inputs))
+
+	queued := &batchQuota{byEntity: make(map[string]int64)}
+	for i, input := range inputs {
+		input.CreatedBy = createdBy
+		input.bundleID = ""
+		p, err := s.prepareRequest(ctx, input, queued)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		queued.add(p.entity.ID)
+		prepared = append(prepared, p)
+		indexes = append(indexes, i)
+	}
+	if len(prepared) == 0 {
+		return results, nil
+	}
+
+	params := make([]db.CreateRequestParams, len(prepared))
+	for i, p := range prepared {
+		params[i] = p.params
+	}
+	var created []db.Request
+	err := s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		created, err = q.CreateRequests(ctx, params)
+		if err != nil {
+			return err
+		}
+		for i, p := range prepared {
+			if err := s.insertRequestExtras(ctx, q, p, created[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create requests: %w", err)
+	}
+
+	for i, p := range prepared {
+		results[indexes[i]].Request = s.requestCreated(ctx, p, created[i])
+	}
+	return results, nil
+}
+
+// batchQuota counts the requests accepted earlier in a batch, which are
+// not in the database yet but count against the quotas of later ones
+type batchQuota struct {
+	byRequestor int64
+	byEntity    map[string]int64
+}
+
+func (b *batchQuota) add(entityID string) {
+	b.byRequestor++
+	b.byEntity[entityID]++
+}
+
+// usage returns the queued usage for a request to entityID; nil counts
+// nothing
+func (b *batchQuota) usage(entityID string) db.QuotaUsage {
+	if b == nil {
+		return db.QuotaUsage{}
+	}
+	return db.QuotaUsage{
+		OpenByRequestor: b.byRequestor,
+		OpenByEntity:    b.byEntity[entityID],
+		CreatedSince:    b.byRequestor,
+	}
+}
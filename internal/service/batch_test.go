@@ -0,0 +1,68 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batchInput(handles ...string) []service.CreateRequestInput {
+	inputs := make([]service.CreateRequestInput, len(handles))
+	for i, handle := range handles {
+		inputs[i].Entity.Handle = handle
+		inputs[i].Schema = nameSchema
+	}
+	return inputs
+}
+
+func TestRequestService_CreateRequests(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	_, err := service.NewEntityService(f.queries).CreateEntity(ctx, model.EntityKindUser, "grace", nil, false)
+	require.NoError(t, err)
+
+	inputs := batchInput("ada", "grace", "nobody")
+	deadline := time.Now().Add(2 * time.Hour)
+	inputs[1].DeadlineAt = &deadline
+
+	results, err := f.svc.CreateRequests(ctx, inputs, "client-1")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, f.entity.ID, results[0].Request.EntityID)
+	assert.Equal(t, model.StatusPending, results[0].Request.Status)
+	require.NoError(t, results[1].Err)
+	assert.Equal(t, "client-1", results[1].Request.CreatedBy)
+	assert.ErrorIs(t, results[2].Err, service.ErrNotFound)
+	assert.Nil(t, results[2].Request)
+
+	stored, err := f.svc.GetRequest(ctx, results[1].Request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPending, stored.Status)
+	assert.Len(t, f.bus.Events("requestor:client-1"), 2)
+	assert.Len(t, f.jobs.Jobs("ScheduleDeadlineNotification"), 1)
+
+	_, err = f.svc.CreateRequests(ctx, nil, "client-1")
+	assert.ErrorIs(t, err, service.ErrValidation)
+	_, err = f.svc.CreateRequests(ctx, make([]service.CreateRequestInput, service.MaxBatchRequests+1), "client-1")
+	assert.ErrorIs(t, err, service.ErrValidation)
+}
+
+func TestRequestService_CreateRequestsQuota(t *testing.T) {
+	f := newRequestFixture(t)
+	f.svc.SetQuotas(service.Quotas{MaxOpenPerEntity: 2})
+
+	// Earlier requests of the batch count before they are inserted
+	results, err := f.svc.CreateRequests(context.Background(), batchInput("ada", "ada", "ada"), "client-1")
+	require.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.ErrorIs(t, results[2].Err, service.ErrQuotaExceeded)
+}
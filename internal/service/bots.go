@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+)
+
+var errNotABot = &Error{Kind: ErrValidation, Code: "invalid_kind", Message: "only bot entities can register a handler"}
+
+// canManageBot reports whether the caller may change the handler of a bot:
+// the bot itself or an admin
+func canManageBot(ctx context.Context, entityID string) error {
+	if auth.IsAdmin(ctx) || auth.GetEntityID(ctx) == entityID {
+		return nil
+	}
+	return &Error{Kind: ErrForbidden, Code: "forbidden", Message: "a bot handler can only be changed by the bot or an admin"}
+}
+
+// SetBotHandler registers the URL requests addressed to a bot are pushed
+// to. Without a secret one is generated; the returned handler carries it.
+func (s *EntityService) SetBotHandler(ctx context.Context, entityID, handlerURL, secret string) (*model.BotHandler, error) {
+	if err := canManageBot(ctx, entityID); err != nil {
+		return nil, err
+	}
+	e, err := s.getEntity(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+	if model.EntityKind(e.Kind) != model.EntityKindBot {
+		return nil, errNotABot
+	}
+	if u, err := url.Parse(handlerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, invalid("invalid_url", "url must be an absolute http or https URL", err)
+	}
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	h, err := s.queries.UpsertBotHandler(ctx, entityID, handlerURL, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set bot handler: %w", err)
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   entityID,
+		Meta:         map[string]interface{}{"botHandler": handlerURL},
+	})
+
+	result := dbBotHandlerToModel(h)
+	result.Secret = &h.Secret
+	return result, nil
+}
+
+// GetBotHandler returns the handler of a bot, without its secret
+func (s *EntityService) GetBotHandler(ctx context.Context, entityID string) (*model.BotHandler, error) {
+	if err := canManageBot(ctx, entityID); err != nil {
+		return nil, err
+	}
+	h, err := s.queries.GetBotHandler(ctx, entityID)
+	if errors.Is(err, pgx.ErrNoRows) || db.IsInvalidText(err) {
+		return nil, notFound("bot handler", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bot handler: %w", err)
+	}
+	return dbBotHandlerToModel(h), nil
+}
+
+// DeleteBotHandler stops pushing requests to a bot; it then answers them
+// through the API or WebSocket like any other entity
+func (s *EntityService) DeleteBotHandler(ctx context.Context, entityID string) error {
+	if err := canManageBot(ctx, entityID); err != nil {
+		return err
+	}
+	deleted, err := s.queries.DeleteBotHandler(ctx, entityID)
+	if db.IsInvalidText(err) {
+		return notFound("bot handler", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete bot handler: %w", err)
+	}
+	if !deleted {
+		return notFound("bot handler", nil)
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   entityID,
+		Meta:         map[string]interface{}{"botHandler": nil},
+	})
+	return nil
+}
+
+func dbBotHandlerToModel(h db.BotHandler) *model.BotHandler {
+	return &model.BotHandler{
+		EntityID:  h.EntityID,
+		URL:       h.URL,
+		CreatedAt: h.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: h.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// dispatchToBot enqueues pushing a new request to the handler of the bot
+// it is addressed to, if the bot registered one
+func (s *RequestService) dispatchToBot(ctx context.Context, requestID, entityID string) {
+	if _, err := s.queries.GetBotHandler(ctx, entityID); err != nil {
+		return
+	}
+	_ = s.jobClient.EnqueueBotDispatch(ctx, requestID)
+}
+
+// AnswerAsBot posts the answer a bot handler returned for a request, as the
+// bot the request is addressed to, so it is validated, audited and
+// announced like any other answer. Rejected answers are reported to the
+// requestor with request.bot_failed and not retried.
+func (s *RequestService) AnswerAsBot(ctx context.Context, requestID string, payload map[string]interface{}, files []map[string]interface{}) error {
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return lookupError("request", err)
+	}
+	ctx = audit.WithActor(auth.WithEntityID(ctx, req.EntityID), req.EntityID)
+
+	_, err = s.PostResponse(ctx, requestID, req.EntityID, payload, files, nil)
+	if err == nil {
+		return nil
+	}
+	e := Classify(err)
+	if e.Kind == nil || e.Kind == ErrUnavailable {
+		return err
+	}
+	_ = s.bus.PublishRequestor(req.CreatedBy, events.New(ctx, events.RequestBotFailed{
+		RequestID: requestID,
+		EntityID:  req.EntityID,
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+	}))
+	return fmt.Errorf("bot answer rejected: %v: %w", err, asynq.SkipRetry)
+}
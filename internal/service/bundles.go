@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// MaxBundleRequests is the most requests a bundle can hold
+const MaxBundleRequests = 20
+
+// CreateBundleInput describes a bundle: requests sent together to one
+// entity. The requests take their entity and requestor from the bundle.
+type CreateBundleInput struct {
+	Entity struct {
+		ID     string `json:"id"`
+		Handle string `json:"handle"`
+	} `json:"entity"`
+	Title     *string              `json:"title,omitempty"`
+	Requests  []CreateRequestInput `json:"requests"`
+	CreatedBy string
+}
+
+// CreateBundle creates the requests of a bundle and groups them. If one of
+// them is rejected, the ones already created are cancelled and the error is
+// returned.
+func (s *RequestService) CreateBundle(ctx context.Context, input CreateBundleInput) (*model.Bundle, error) {
+	if len(input.Requests) == 0 || len(input.Requests) > MaxBundleRequests {
+		return nil, invalid("invalid_bundle", fmt.Sprintf("a bundle holds 1 to %d requests", MaxBundleRequests), nil)
+	}
+	entity, err := s.entitySvc.ResolveEntity(ctx, input.Entity.ID, input.Entity.Handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve entity: %w", err)
+	}
+	if entity.DeactivatedAt != nil {
+		return nil, ErrEntityDeactivated
+	}
+
+	bundleID := ulid.Make().String()
+	requestIDs := make([]string, 0, len(input.Requests))
+	for i, child := range input.Requests {
+		child.Entity.ID, child.Entity.Handle = entity.ID, ""
+		child.CreatedBy = input.CreatedBy
+		child.bundleID = bundleID
+		req, err := s.CreateRequest(ctx, child)
+		if err != nil {
+			s.cancelBundleRequests(ctx, requestIDs)
+			return nil, fmt.Errorf("bundle request %d: %w", i, err)
+		}
+		requestIDs = append(requestIDs, req.ID)
+	}
+
+	var bundle db.Bundle
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		bundle, err = q.CreateBundle(ctx, db.CreateBundleParams{
+			ID:         bundleID,
+			EntityID:   entity.ID,
+			CreatedBy:  input.CreatedBy,
+			Title:      input.Title,
+			RequestIDs: requestIDs,
+		})
+		return err
+	})
+	if err != nil {
+		s.cancelBundleRequests(ctx, requestIDs)
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionCreate,
+		ResourceType: audit.ResourceBundle,
+		ResourceID:   bundleID,
+		Meta:         map[string]interface{}{"entityId": entity.ID, "createdBy": input.CreatedBy, "requestIds": requestIDs},
+	})
+
+	event := pubsub.MarkSandbox(events.New(ctx, events.BundleCreated{
+		BundleID:   bundleID,
+		EntityID:   entity.ID,
+		RequestIDs: requestIDs,
+	}), entity.Sandbox)
+	_ = s.bus.PublishEntity(entity.ID, event)
+	_ = s.bus.PublishRequestor(input.CreatedBy, event)
+
+	return dbBundleToModel(bundle), nil
+}
+
+// GetBundle returns a bundle with the status of its requests
+func (s *RequestService) GetBundle(ctx context.Context, id string) (*model.Bundle, error) {
+	b, err := s.queries.GetBundle(ctx, id)
+	if err != nil {
+		return nil, lookupError("bundle", err)
+	}
+	return dbBundleToModel(b), nil
+}
+
+// completeBundle announces bundle.completed once the last open request of
+// a bundle is answered
+func (s *RequestService) completeBundle(ctx context.Context, requestID string, sandbox bool) {
+	// No rows means the request is in no bundle, the bundle has open
+	// requests left or was already announced. Other errors do not fail the
+	// answer; the bundle status is derived from its requests regardless.
+	b, err := s.queries.CompleteRequestBundle(ctx, requestID)
+	if err != nil {
+		return
+	}
+
+	bundle := dbBundleToModel(b)
+	requestIDs := make([]string, 0, len(bundle.Requests))
+	for _, item := range bundle.Requests {
+		requestIDs = append(requestIDs, item.RequestID)
+	}
+	event := pubsub.MarkSandbox(events.New(ctx, events.BundleCompleted{
+		BundleID:    bundle.ID,
+		EntityID:    bundle.EntityID,
+		RequestIDs:  requestIDs,
+		CompletedAt: bundle.CompletedAt,
+	}), sandbox)
+	_ = s.bus.PublishRequestor(bundle.CreatedBy, event)
+	_ = s.bus.PublishEntity(bundle.EntityID, event)
+}
+
+// cancelBundleRequests cancels the requests of a bundle that could not be
+// created
+func (s *RequestService) cancelBundleRequests(ctx context.Context, requestIDs []string) {
+	for _, id := range requestIDs {
+		_ = s.CancelRequest(ctx, id, nil)
+	}
+}
+
+func dbBundleToModel(b db.Bundle) *model.Bundle {
+	m := &model.Bundle{
+		ID:          b.ID,
+		EntityID:    b.EntityID,
+		CreatedBy:   b.CreatedBy,
+		Title:       b.Title,
+		Total:       len(b.Items),
+		Requests:    make([]model.BundleItem, 0, len(b.Items)),
+		CreatedAt:   b.CreatedAt.Format(time.RFC3339),
+		CompletedAt: timePtrToString(b.CompletedAt),
+	}
+	unanswerable := false
+	for _, item := range b.Items {
+		status := model.Status(item.Status)
+		m.Requests = append(m.Requests, model.BundleItem{RequestID: item.RequestID, Status: status})
+		switch {
+		case status.IsAnswered():
+			m.Answered++
+		case status == model.StatusCancelled || status == model.StatusExpired || status == model.StatusRejected:
+			unanswerable = true
+		}
+	}
+	switch {
+	case m.Total > 0 && m.Answered == m.Total:
+		m.Status = model.BundleCompleted
+	case unanswerable:
+		m.Status = model.BundleIncomplete
+	case m.Answered > 0:
+		m.Status = model.BundleInProgress
+	default:
+		m.Status = model.BundlePending
+	}
+	return m
+}
@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bundleInput(n int) service.CreateBundleInput {
+	input := service.CreateBundleInput{CreatedBy: "client-1"}
+	input.Entity.Handle = "ada"
+	for i := 0; i < n; i++ {
+		input.Requests = append(input.Requests, service.CreateRequestInput{Schema: nameSchema})
+	}
+	return input
+}
+
+func TestRequestService_CreateBundle(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+
+	bundle, err := f.svc.CreateBundle(ctx, bundleInput(3))
+	require.NoError(t, err)
+	assert.Equal(t, f.entity.ID, bundle.EntityID)
+	assert.Equal(t, model.BundlePending, bundle.Status)
+	assert.Equal(t, 3, bundle.Total)
+	require.Len(t, bundle.Requests, 3)
+
+	req, err := f.svc.GetRequest(ctx, bundle.Requests[0].RequestID)
+	require.NoError(t, err)
+	require.NotNil(t, req.BundleID)
+	assert.Equal(t, bundle.ID, *req.BundleID)
+	assert.Equal(t, "client-1", req.CreatedBy)
+
+	published := f.bus.Events("requestor:client-1")
+	require.Len(t, published, 4)
+	assert.Equal(t, bundle.ID, events.String(published[0], "bundleId"))
+	assert.Equal(t, "bundle.created", published[3]["type"])
+
+	_, err = f.svc.CreateBundle(ctx, bundleInput(0))
+	assert.ErrorIs(t, err, service.ErrValidation)
+}
+
+func TestRequestService_CreateBundleRejectedRequest(t *testing.T) {
+	f := newRequestFixture(t)
+	input := bundleInput(2)
+	past := time.Now().Add(-time.Minute)
+	input.Requests[1].ExpiresAt = &past
+
+	_, err := f.svc.CreateBundle(context.Background(), input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	// The request created before the rejected one is cancelled
+	published := f.bus.Events("requestor:client-1")
+	require.Len(t, published, 1)
+	requestID := events.String(published[0], "requestId")
+	assert.Equal(t, []string{"request.cancelled"}, f.bus.Types("request:"+requestID))
+}
+
+func TestRequestService_BundleCompletion(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	bundle, err := f.svc.CreateBundle(ctx, bundleInput(2))
+	require.NoError(t, err)
+	answer := map[string]interface{}{"name": "Ada"}
+
+	_, err = f.svc.PostResponse(ctx, bundle.Requests[0].RequestID, "", answer, nil, nil)
+	require.NoError(t, err)
+	progress, err := f.svc.GetBundle(ctx, bundle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.BundleInProgress, progress.Status)
+	assert.Equal(t, 1, progress.Answered)
+	assert.NotContains(t, f.bus.Types("requestor:client-1"), "bundle.completed")
+
+	_, err = f.svc.PostResponse(ctx, bundle.Requests[1].RequestID, "", answer, nil, nil)
+	require.NoError(t, err)
+	done, err := f.svc.GetBundle(ctx, bundle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.BundleCompleted, done.Status)
+	assert.NotNil(t, done.CompletedAt)
+
+	types := f.bus.Types("requestor:client-1")
+	assert.Equal(t, "bundle.completed", types[len(types)-1])
+	assert.Contains(t, f.bus.Types("entity:"+f.entity.ID), "bundle.completed")
+
+	_, err = f.svc.GetBundle(ctx, "missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestRequestService_BundleIncomplete(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	bundle, err := f.svc.CreateBundle(ctx, bundleInput(2))
+	require.NoError(t, err)
+
+	require.NoError(t, f.svc.CancelRequest(ctx, bundle.Requests[1].RequestID, nil))
+	got, err := f.svc.GetBundle(ctx, bundle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.BundleIncomplete, got.Status)
+}
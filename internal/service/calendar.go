@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// weekOrder lists work days the way calendars return them, Monday first
+const weekOrder = "mon tue wed thu fri sat sun"
+
+// normalizeCalendar validates a business calendar, fills in the default
+// timezone and sorts its days and holidays
+func normalizeCalendar(c model.BusinessCalendar) (model.BusinessCalendar, error) {
+	if c.Timezone == "" {
+		c.Timezone = "UTC"
+	}
+	for i, d := range c.WorkDays {
+		c.WorkDays[i] = strings.ToLower(d)
+	}
+	if err := c.Validate(); err != nil {
+		return c, invalid("invalid_calendar", err.Error(), err)
+	}
+
+	c.WorkDays = dedupe(c.WorkDays)
+	rank := func(day string) int { return strings.Index(weekOrder, day) }
+	sort.Slice(c.WorkDays, func(i, j int) bool { return rank(c.WorkDays[i]) < rank(c.WorkDays[j]) })
+
+	c.Holidays = dedupe(c.Holidays)
+	sort.Strings(c.Holidays)
+	c.UpdatedAt = ""
+	return c, nil
+}
+
+// dedupe returns values without repeats, in their first order
+func dedupe(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// entityCalendar returns the business calendar of an entity and whether it
+// set one; entities without one get the default calendar
+func entityCalendar(ctx context.Context, q db.Querier, entityID string) (model.BusinessCalendar, bool, error) {
+	c, err := q.GetBusinessCalendar(ctx, entityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.DefaultBusinessCalendar(), false, nil
+	}
+	if err != nil {
+		return c, false, fmt.Errorf("failed to get business calendar: %w", err)
+	}
+	return c, true, nil
+}
+
+// GetBusinessCalendar returns the business calendar of an entity, the
+// default one if it never set one
+func (s *EntityService) GetBusinessCalendar(ctx context.Context, entityID string) (*model.BusinessCalendar, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "business calendars"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+	c, _, err := entityCalendar(ctx, s.queries, entityID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateBusinessCalendar replaces the business calendar of an entity. It
+// applies to deadlines and reminders set from then on; existing deadlines
+// are not recomputed.
+func (s *EntityService) UpdateBusinessCalendar(ctx context.Context, entityID string, c model.BusinessCalendar) (*model.BusinessCalendar, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "business calendars"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+	c, err := normalizeCalendar(c)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.queries.UpsertBusinessCalendar(ctx, entityID, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update business calendar: %w", err)
+	}
+	return &saved, nil
+}
+
+// resolveDeadline returns the deadline of a new request for entityID:
+// input.DeadlineAt, or input.DeadlineIn counted from now in the entity's
+// business calendar
+func (s *RequestService) resolveDeadline(ctx context.Context, entityID string, input CreateRequestInput, now time.Time) (*time.Time, error) {
+	if input.DeadlineIn == nil {
+		return input.DeadlineAt, nil
+	}
+	if input.DeadlineAt != nil {
+		return nil, invalid("invalid_deadline", "set deadlineAt or deadlineIn, not both", nil)
+	}
+	d, err := model.ParseBusinessDuration(*input.DeadlineIn)
+	if err != nil {
+		return nil, invalid("invalid_deadline", err.Error(), err)
+	}
+	c, _, err := entityCalendar(ctx, s.queries, entityID)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := c.Add(now, d)
+	if !ok {
+		return nil, invalid("invalid_deadline", "the business calendar has no working time for "+*input.DeadlineIn, nil)
+	}
+	deadline = deadline.UTC()
+	return &deadline, nil
+}
+
+// workingReminder moves a reminder at remindAt into the working hours of
+// entityID, if it set a business calendar, as long as that keeps it before
+// the deadline
+func (s *RequestService) workingReminder(ctx context.Context, entityID string, remindAt time.Time, deadlineAt *time.Time) (time.Time, error) {
+	c, set, err := entityCalendar(ctx, s.queries, entityID)
+	if err != nil || !set {
+		return remindAt, err
+	}
+	at, ok := c.NextWorking(remindAt)
+	if !ok || (deadlineAt != nil && at.After(*deadlineAt)) {
+		return remindAt, nil
+	}
+	return at.UTC(), nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/ics"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxFeedRequests bounds the open requests of each status listed in a
+	// calendar feed, soonest deadline first
+	maxFeedRequests = 500
+	// feedDeadlineAlarm is how long before a deadline calendar clients
+	// remind of it
+	feedDeadlineAlarm = time.Hour
+)
+
+// errInvalidFeedToken hides whether a feed token is unknown, revoked or for
+// another entity
+var errInvalidFeedToken = &Error{Kind: ErrNotFound, Code: "invalid_feed_token", Message: "calendar feed token is invalid or revoked"}
+
+// CreateCalendarFeed issues the token of an entity's deadline calendar
+// feed, revoking the previous one. Calendar clients cannot send an
+// Authorization header, so the token goes in the feed URL; it does not
+// expire until replaced or revoked.
+func (s *EntityService) CreateCalendarFeed(ctx context.Context, entityID string) (*model.CalendarFeed, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "calendar feeds"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+	token, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := s.queries.SetCalendarFeedToken(ctx, entityID, hashShareToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar feed: %w", err)
+	}
+	return &model.CalendarFeed{Token: token, CreatedAt: createdAt.UTC().Format(time.RFC3339)}, nil
+}
+
+// DeleteCalendarFeed revokes the token of an entity's calendar feed, so
+// subscriptions using it stop updating
+func (s *EntityService) DeleteCalendarFeed(ctx context.Context, entityID string) error {
+	if err := requireEntityOrAdmin(ctx, entityID, "calendar feeds"); err != nil {
+		return err
+	}
+	deleted, err := s.queries.DeleteCalendarFeedToken(ctx, entityID)
+	if err != nil {
+		return fmt.Errorf("failed to delete calendar feed: %w", err)
+	}
+	if !deleted {
+		return notFound("calendar feed", nil)
+	}
+	return nil
+}
+
+// DeadlineCalendar returns the deadlines and attention times of the open
+// requests of an entity as a calendar. The caller proves access with the
+// entity's feed token or, without one, as the entity or an admin. link
+// returns the URL events point to for a request.
+func (s *RequestService) DeadlineCalendar(ctx context.Context, entityID, token string, link func(requestID string) string) (*ics.Calendar, error) {
+	if token != "" {
+		owner, err := s.queries.GetCalendarFeedEntity(ctx, hashShareToken(token))
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && owner != entityID) {
+			return nil, errInvalidFeedToken
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get calendar feed: %w", err)
+		}
+	} else if err := requireEntityOrAdmin(ctx, entityID, "calendar feeds"); err != nil {
+		return nil, err
+	}
+	entity, err := s.queries.GetEntityByID(ctx, entityID)
+	if err != nil {
+		return nil, lookupError("entity", err)
+	}
+
+	cal := &ics.Calendar{Name: "pxbox deadlines"}
+	if entity.Handle != nil {
+		cal.Name += " (" + *entity.Handle + ")"
+	}
+	for _, status := range []model.Status{model.StatusPending, model.StatusClaimed} {
+		st := string(status)
+		requests, err := s.queries.SearchRequests(ctx, db.RequestFilter{
+			EntityID:       &entityID,
+			Status:         &st,
+			ExcludeExpired: true,
+		}, "deadline", maxFeedRequests, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list requests: %w", err)
+		}
+		for _, req := range requests {
+			cal.Events = append(cal.Events, requestEvents(req, link(req.ID))...)
+		}
+	}
+	sort.SliceStable(cal.Events, func(i, j int) bool { return cal.Events[i].Start.Before(cal.Events[j].Start) })
+	return cal, nil
+}
+
+// requestEvents returns the calendar events of a request: its deadline,
+// reminded of an hour ahead, and its attention time
+func requestEvents(req db.Request, url string) []ics.Event {
+	title, _ := req.SchemaPayload["title"].(string)
+	if title == "" {
+		title = "Request " + req.ID
+	}
+	description := "Requested by " + req.CreatedBy
+
+	var events []ics.Event
+	if req.DeadlineAt != nil {
+		events = append(events, ics.Event{
+			UID:         req.ID + "-deadline@pxbox",
+			Start:       *req.DeadlineAt,
+			Summary:     "Due: " + title,
+			Description: description,
+			URL:         url,
+			Alarms:      []time.Duration{feedDeadlineAlarm},
+		})
+	}
+	if req.AttentionAt != nil {
+		events = append(events, ics.Event{
+			UID:         req.ID + "-attention@pxbox",
+			Start:       *req.AttentionAt,
+			Summary:     "Needs attention: " + title,
+			Description: description,
+			URL:         url,
+			Alarms:      []time.Duration{0},
+		})
+	}
+	return events
+}
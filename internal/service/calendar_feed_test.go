@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadlineCalendar(t *testing.T) {
+	f := newRequestFixture(t)
+	entitySvc := service.NewEntityService(f.queries)
+	entity := auth.WithEntityID(context.Background(), f.entity.ID)
+	link := func(id string) string { return "https://example.com/r/" + id }
+
+	deadline := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	attention := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	due := f.create(t, service.CreateRequestInput{DeadlineAt: &deadline, AttentionAt: &attention})
+	f.create(t, service.CreateRequestInput{})
+	answered := f.create(t, service.CreateRequestInput{DeadlineAt: &deadline})
+	_, err := f.svc.PostResponse(context.Background(), answered.ID, f.entity.ID, map[string]interface{}{"name": "Ada"}, nil, nil)
+	require.NoError(t, err)
+
+	// Without a token only the entity reads its feed
+	_, err = f.svc.DeadlineCalendar(context.Background(), f.entity.ID, "", link)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	cal, err := f.svc.DeadlineCalendar(entity, f.entity.ID, "", link)
+	require.NoError(t, err)
+	require.Len(t, cal.Events, 2)
+	assert.Equal(t, due.ID+"-attention@pxbox", cal.Events[0].UID)
+	assert.Equal(t, due.ID+"-deadline@pxbox", cal.Events[1].UID)
+	assert.True(t, deadline.Equal(cal.Events[1].Start))
+	assert.Equal(t, "https://example.com/r/"+due.ID, cal.Events[1].URL)
+	assert.True(t, strings.HasPrefix(cal.Events[1].Summary, "Due: "))
+
+	// Calendar clients use the token, until it is replaced or revoked
+	_, err = entitySvc.CreateCalendarFeed(context.Background(), f.entity.ID)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	feed, err := entitySvc.CreateCalendarFeed(entity, f.entity.ID)
+	require.NoError(t, err)
+	cal, err = f.svc.DeadlineCalendar(context.Background(), f.entity.ID, feed.Token, link)
+	require.NoError(t, err)
+	assert.Len(t, cal.Events, 2)
+	_, err = f.svc.DeadlineCalendar(context.Background(), "other-entity", feed.Token, link)
+	assert.Equal(t, "invalid_feed_token", service.Classify(err).Code)
+
+	rotated, err := entitySvc.CreateCalendarFeed(entity, f.entity.ID)
+	require.NoError(t, err)
+	_, err = f.svc.DeadlineCalendar(context.Background(), f.entity.ID, feed.Token, link)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	require.NoError(t, entitySvc.DeleteCalendarFeed(entity, f.entity.ID))
+	_, err = f.svc.DeadlineCalendar(context.Background(), f.entity.ID, rotated.Token, link)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	assert.ErrorIs(t, entitySvc.DeleteCalendarFeed(entity, f.entity.ID), service.ErrNotFound)
+}
@@ -0,0 +1,75 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusinessCalendar(t *testing.T) {
+	f := newRequestFixture(t)
+	entitySvc := service.NewEntityService(f.queries)
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	// Entities start with the default calendar
+	c, err := entitySvc.GetBusinessCalendar(ctx, f.entity.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.DefaultBusinessCalendar(), *c)
+
+	calendar := model.BusinessCalendar{
+		WorkDays:  []string{"Sun", "sat", "fri", "thu", "wed", "tue", "mon", "mon"},
+		WorkStart: "09:00",
+		WorkEnd:   "17:00",
+	}
+	_, err = entitySvc.UpdateBusinessCalendar(context.Background(), f.entity.ID, calendar)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	_, err = entitySvc.UpdateBusinessCalendar(ctx, f.entity.ID, model.BusinessCalendar{WorkDays: []string{"mon"}, WorkStart: "17:00", WorkEnd: "09:00"})
+	assert.Equal(t, "invalid_calendar", service.Classify(err).Code)
+
+	c, err = entitySvc.UpdateBusinessCalendar(ctx, f.entity.ID, calendar)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}, c.WorkDays)
+	assert.Equal(t, "UTC", c.Timezone)
+	assert.Empty(t, c.Holidays)
+
+	// deadlineIn is resolved into deadlineAt in the entity's calendar
+	in := "2 business days"
+	d, err := model.ParseBusinessDuration(in)
+	require.NoError(t, err)
+	want, ok := c.Add(time.Now(), d)
+	require.True(t, ok)
+	req := f.create(t, service.CreateRequestInput{DeadlineIn: &in})
+	deadline, err := time.Parse(time.RFC3339, *req.DeadlineAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, want, deadline, 5*time.Second)
+	assert.Len(t, f.jobs.Jobs("ScheduleDeadlineExpiry"), 1)
+
+	deadlineAt := time.Now().Add(time.Hour)
+	input := service.CreateRequestInput{Schema: nameSchema, DeadlineAt: &deadlineAt, DeadlineIn: &in}
+	input.Entity.Handle = "ada"
+	_, err = f.svc.CreateRequest(context.Background(), input)
+	assert.Equal(t, "invalid_deadline", service.Classify(err).Code)
+	bad := "2 days"
+	input.DeadlineAt, input.DeadlineIn = nil, &bad
+	_, err = f.svc.CreateRequest(context.Background(), input)
+	assert.Equal(t, "invalid_deadline", service.Classify(err).Code)
+
+	// Reminders outside working hours wait for the next working day
+	open := f.create(t, service.CreateRequestInput{})
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	evening := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 20, 0, 0, 0, time.UTC)
+	_, err = f.svc.Snooze(ctx, open.ID, evening)
+	require.NoError(t, err)
+	reminders, err := f.svc.ListReminders(ctx, open.ID)
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	morning := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day()+1, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, morning.Format(time.RFC3339), reminders[0].RemindAt)
+}
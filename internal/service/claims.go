@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+)
+
+// DefaultClaimTTL is how long a claim is held before it returns to the
+// queue when CLAIM_TTL is not set
+const DefaultClaimTTL = 30 * time.Minute
+
+// ClaimTTLFromEnv reads CLAIM_TTL as a duration, defaulting to
+// DefaultClaimTTL. "0" keeps claims until they are released.
+func ClaimTTLFromEnv() (time.Duration, error) {
+	v := os.Getenv("CLAIM_TTL")
+	if v == "" {
+		return DefaultClaimTTL, nil
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid CLAIM_TTL %q", v)
+	}
+	return ttl, nil
+}
+
+// SetClaimTTL sets how long claims are held; 0 disables claim expiry
+func (s *RequestService) SetClaimTTL(ttl time.Duration) {
+	s.claimTTL = ttl
+}
+
+// UnclaimRequest returns a claimed request to PENDING so another member of
+// the target entity can pick it up. Only the claimer or an admin may
+// release a claim. If expectedVersion is set, it only succeeds at that
+// version.
+func (s *RequestService) UnclaimRequest(ctx context.Context, id string, expectedVersion *int) error {
+	req, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return lookupError("request", err)
+	}
+	if req.ClaimedBy != nil && *req.ClaimedBy != auth.Actor(ctx) && !auth.IsAdmin(ctx) {
+		return &Error{Kind: ErrForbidden, Code: "not_claimer", Message: "only the claimer can release a claim"}
+	}
+
+	if req.Status != string(model.StatusClaimed) {
+		return transitionConflict(&model.TransitionError{From: model.Status(req.Status), To: model.StatusPending})
+	}
+
+	if err := s.queries.UnclaimRequest(ctx, id, false, expectedVersion); err != nil {
+		return fmt.Errorf("failed to unclaim request: %w", s.transitionError(ctx, id, model.StatusPending, expectedVersion, err))
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionUnclaim,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		BeforeStatus: string(model.StatusClaimed),
+		AfterStatus:  string(model.StatusPending),
+	})
+
+	event := pubsub.MarkSandbox(events.New(ctx, events.RequestUnclaimed{
+		RequestID: id,
+		Reason:    "released",
+	}), req.Sandbox)
+	_ = s.bus.PublishRequest(id, event)
+	_ = s.bus.PublishEntity(req.EntityID, event)
+	return nil
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimTTLFromEnv(t *testing.T) {
+	t.Setenv("CLAIM_TTL", "")
+	ttl, err := ClaimTTLFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultClaimTTL, ttl)
+
+	t.Setenv("CLAIM_TTL", "0")
+	ttl, err = ClaimTTLFromEnv()
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+
+	t.Setenv("CLAIM_TTL", "5m")
+	ttl, err = ClaimTTLFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, ttl)
+
+	for _, bad := range []string{"soon", "-1m"} {
+		t.Setenv("CLAIM_TTL", bad)
+		_, err = ClaimTTLFromEnv()
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+	"pxbox/internal/storage"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// maxCommentLength limits the body of a comment, in characters
+const maxCommentLength = 10000
+
+// Comment author roles
+const (
+	CommentByEntity    = "entity"
+	CommentByRequestor = "requestor"
+)
+
+// requestorID returns the caller's client ID, "anonymous" without one, as
+// recorded in created_by
+func requestorID(ctx context.Context) string {
+	if clientID := auth.GetClientID(ctx); clientID != "" {
+		return clientID
+	}
+	return "anonymous"
+}
+
+// commentAuthor returns who the caller is in the thread of req: the target
+// entity or the requestor client. Requests created without a client ID
+// belong to "anonymous", like in CreateRequest.
+func commentAuthor(ctx context.Context, req db.Request) (author, role string, ok bool) {
+	if entityID := auth.GetEntityID(ctx); entityID != "" && entityID == req.EntityID {
+		return entityID, CommentByEntity, true
+	}
+	clientID := requestorID(ctx)
+	if clientID == req.CreatedBy {
+		return clientID, CommentByRequestor, true
+	}
+	return "", "", false
+}
+
+// AddComment posts a comment on a request on behalf of the caller, which
+// must be the target entity or the requestor. Attached files are checked
+// against the request's file policy.
+func (s *RequestService) AddComment(ctx context.Context, requestID, body string, files []map[string]interface{}) (*model.Comment, error) {
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	author, role, ok := commentAuthor(ctx, req)
+	if !ok {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_participant", Message: "only the target entity and the requestor can comment"}
+	}
+	if model.RequestStatusMachine.IsTerminal(model.Status(req.Status)) {
+		return nil, &Error{Kind: ErrConflict, Code: "request_closed", Message: "request is " + strings.ToLower(req.Status)}
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" && len(files) == 0 {
+		return nil, invalid("invalid_comment", "comment needs a body or files", nil)
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return nil, invalid("invalid_comment", fmt.Sprintf("comment exceeds %d characters", maxCommentLength), nil)
+	}
+
+	filesParam := []map[string]interface{}{}
+	if len(files) > 0 {
+		normalized, err := storage.NormalizeFiles(files)
+		if err != nil {
+			return nil, invalid("invalid_files", "invalid file metadata", err)
+		}
+		if err := checkFilePolicy(req, normalized); err != nil {
+			return nil, err
+		}
+		if err := s.checkFileScans(ctx, normalized); err != nil {
+			return nil, err
+		}
+		filesParam = normalized
+	}
+
+	var c db.Comment
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		c, err = q.CreateComment(ctx, db.CreateCommentParams{
+			ID:         ulid.Make().String(),
+			RequestID:  requestID,
+			Author:     author,
+			AuthorRole: role,
+			Body:       body,
+			Files:      filesParam,
+		})
+		if err != nil {
+			return err
+		}
+		if keys := s.fileKeys(filesParam); len(keys) > 0 {
+			return q.AttachFilesToComment(ctx, c.ID, keys)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	comment := dbCommentToModel(c)
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionComment,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   requestID,
+		Meta:         map[string]interface{}{"commentId": c.ID, "author": author, "authorRole": role},
+	})
+
+	event := pubsub.MarkSandbox(events.New(ctx, events.CommentCreated{
+		RequestID: requestID,
+		Comment:   comment,
+	}), req.Sandbox)
+	_ = s.bus.PublishEntity(req.EntityID, event)
+	_ = s.bus.PublishRequestor(req.CreatedBy, event)
+
+	return comment, nil
+}
+
+// ListComments returns the thread of a request, oldest first. Only the
+// participants and admins can read it.
+func (s *RequestService) ListComments(ctx context.Context, requestID string, limit, offset int) ([]*model.Comment, error) {
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if _, _, ok := commentAuthor(ctx, req); !ok && !auth.IsAdmin(ctx) {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_participant", Message: "only the target entity and the requestor can read comments"}
+	}
+
+	comments, err := s.queries.ListComments(ctx, requestID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	result := make([]*model.Comment, 0, len(comments))
+	for _, c := range comments {
+		result = append(result, dbCommentToModel(c))
+	}
+	return result, nil
+}
+
+// checkFilePolicy checks comment attachments against the request's file
+// policy, like uploads for the request are
+func checkFilePolicy(req db.Request, files []map[string]interface{}) error {
+	policy, err := storage.ParseFilePolicy(req.FilesPolicy)
+	if err != nil {
+		return invalid("invalid_policy", "invalid file policy", err)
+	}
+	if policy == nil {
+		return nil
+	}
+
+	var total int64
+	for _, f := range files {
+		meta := storage.NormalizeFileMetadata(f)
+		if err := policy.ValidateFile(meta.Name, meta.MIME, meta.Size); err != nil {
+			return invalid("policy_violation", err.Error(), nil)
+		}
+		total += meta.Size
+	}
+	if policy.MaxTotalMB != nil && total > int64(*policy.MaxTotalMB*1024*1024) {
+		return invalid("policy_violation", fmt.Sprintf("files exceed the total limit of %.2f MB", *policy.MaxTotalMB), nil)
+	}
+	return nil
+}
+
+func dbCommentToModel(c db.Comment) *model.Comment {
+	return &model.Comment{
+		ID:         c.ID,
+		RequestID:  c.RequestID,
+		Author:     c.Author,
+		AuthorRole: c.AuthorRole,
+		Body:       c.Body,
+		Files:      c.Files,
+		CreatedAt:  c.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentAuthor(t *testing.T) {
+	req := db.Request{EntityID: "e1", CreatedBy: "client-1"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		author  string
+		role    string
+		allowed bool
+	}{
+		{"target entity", auth.WithEntityID(context.Background(), "e1"), "e1", CommentByEntity, true},
+		{"requestor", auth.WithClientID(context.Background(), "client-1"), "client-1", CommentByRequestor, true},
+		{"other entity", auth.WithEntityID(context.Background(), "e2"), "", "", false},
+		{"anonymous", context.Background(), "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			author, role, ok := commentAuthor(tt.ctx, req)
+			assert.Equal(t, tt.allowed, ok)
+			assert.Equal(t, tt.author, author)
+			assert.Equal(t, tt.role, role)
+		})
+	}
+
+	author, role, ok := commentAuthor(context.Background(), db.Request{EntityID: "e1", CreatedBy: "anonymous"})
+	assert.True(t, ok)
+	assert.Equal(t, "anonymous", author)
+	assert.Equal(t, CommentByRequestor, role)
+}
+
+func TestCheckFilePolicy(t *testing.T) {
+	req := db.Request{FilesPolicy: map[string]interface{}{
+		"maxFileMB":  1.0,
+		"maxTotalMB": 1.5,
+		"mime":       []interface{}{"application/pdf"},
+	}}
+	pdf := func(size float64) map[string]interface{} {
+		return map[string]interface{}{"name": "a.pdf", "url": "https://example.com/a.pdf", "size": size, "mime": "application/pdf"}
+	}
+
+	assert.NoError(t, checkFilePolicy(req, []map[string]interface{}{pdf(1000)}))
+	assert.NoError(t, checkFilePolicy(db.Request{}, []map[string]interface{}{pdf(1 << 30)}))
+
+	for name, files := range map[string][]map[string]interface{}{
+		"file too large":  {pdf(2 << 20)},
+		"total too large": {pdf(1 << 20), pdf(1 << 20)},
+		"wrong type":      {{"name": "a.png", "url": "https://example.com/a.png", "size": 10.0, "mime": "image/png"}},
+	} {
+		err := checkFilePolicy(req, files)
+		assert.True(t, errors.Is(err, ErrValidation), name)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Kinds of the deadline tasks recorded per request
+const (
+	taskDeadlineNotify = "deadline:notify"
+	taskDeadlineExpire = "deadline:expire"
+	taskAutoCancel     = "request:autocancel"
+	taskRequestExpire  = "request:expire"
+)
+
+// scheduleRequestJobs enqueues the timed jobs of a new request through
+// jobClient and records them through q: the deadline tasks, the expiry and
+// the attention notification
+func scheduleRequestJobs(ctx context.Context, jobClient JobClient, q db.Querier, req db.Request) {
+	if req.DeadlineAt != nil {
+		scheduleDeadlineTasks(ctx, jobClient, q, req.ID, *req.DeadlineAt, req.AutocancelGrace)
+	}
+	if req.ExpiresAt != nil {
+		scheduleRequestExpiry(ctx, jobClient, q, req.ID, *req.ExpiresAt)
+	}
+	if req.AttentionAt != nil {
+		_ = jobClient.ScheduleAttentionNotification(ctx, req.ID, *req.AttentionAt)
+	}
+}
+
+// scheduleDeadlineTasks enqueues the deadline notification, expiry and
+// auto-cancel of a request and records their task IDs
+func scheduleDeadlineTasks(ctx context.Context, jobClient JobClient, q db.Querier, requestID string, deadlineAt time.Time, grace *time.Duration) {
+	record := func(kind string, processAt time.Time, taskID string, err error) {
+		if err != nil || taskID == "" {
+			return
+		}
+		_ = q.SaveRequestTask(ctx, db.RequestTask{RequestID: requestID, Kind: kind, TaskID: taskID, ProcessAt: processAt})
+	}
+
+	taskID, err := jobClient.ScheduleDeadlineNotification(ctx, requestID, deadlineAt)
+	record(taskDeadlineNotify, deadlineAt.Add(-time.Hour), taskID, err)
+	taskID, err = jobClient.ScheduleDeadlineExpiry(ctx, requestID, deadlineAt)
+	record(taskDeadlineExpire, deadlineAt, taskID, err)
+
+	// Auto-cancel after expiry + grace period
+	if grace != nil && *grace > 0 {
+		cancelAt := deadlineAt.Add(*grace)
+		taskID, err = jobClient.ScheduleAutoCancel(ctx, requestID, time.Until(cancelAt))
+		record(taskAutoCancel, cancelAt, taskID, err)
+	}
+}
+
+// scheduleRequestExpiry enqueues the expiry of a request at its expiresAt
+// and records the task
+func scheduleRequestExpiry(ctx context.Context, jobClient JobClient, q db.Querier, requestID string, expiresAt time.Time) {
+	taskID, err := jobClient.ScheduleRequestExpiry(ctx, requestID, expiresAt)
+	if err != nil || taskID == "" {
+		return
+	}
+	_ = q.SaveRequestTask(ctx, db.RequestTask{RequestID: requestID, Kind: taskRequestExpire, TaskID: taskID, ProcessAt: expiresAt})
+}
+
+// isExpired reports whether a request can no longer be answered because it
+// expired: it is EXPIRED, or still open although its expiresAt has passed
+// and the expiry job has not run yet
+func isExpired(r db.Request, now time.Time) bool {
+	if r.Status == string(model.StatusExpired) {
+		return true
+	}
+	return model.Status(r.Status).IsOpen() && r.ExpiresAt != nil && !r.ExpiresAt.After(now)
+}
+
+// cancelDeadlineTasks deletes the recorded deadline tasks of a request
+func (s *RequestService) cancelDeadlineTasks(ctx context.Context, requestID string) error {
+	tasks, err := s.queries.ListRequestTasks(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		switch t.Kind {
+		case taskDeadlineNotify, taskDeadlineExpire, taskAutoCancel:
+		default:
+			continue
+		}
+		if err := s.jobClient.CancelTask(t.TaskID); err != nil {
+			return fmt.Errorf("failed to cancel %s task: %w", t.Kind, err)
+		}
+		if err := s.queries.DeleteRequestTask(ctx, requestID, t.Kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateDeadline moves the deadline of an open request and reschedules its
+// deadline notification, expiry and auto-cancel. Only the requestor or an
+// admin may change it. If expectedVersion is set, the change only applies
+// at that version.
+func (s *RequestService) UpdateDeadline(ctx context.Context, id string, deadlineAt time.Time, expectedVersion *int) (*model.Request, error) {
+	if !deadlineAt.After(time.Now()) {
+		return nil, invalid("invalid_deadline", "deadlineAt must be in the future", nil)
+	}
+
+	req, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if !auth.IsAdmin(ctx) && requestorID(ctx) != req.CreatedBy {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_requestor", Message: "only the requestor can change the deadline"}
+	}
+	if !model.Status(req.Status).IsOpen() {
+		return nil, &Error{Kind: ErrConflict, Code: "request_closed", Message: "request is " + strings.ToLower(req.Status)}
+	}
+
+	version, err := s.queries.UpdateRequestDeadline(ctx, id, deadlineAt, expectedVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, s.transitionError(ctx, id, "", expectedVersion, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deadline: %w", err)
+	}
+
+	if s.jobClient != nil {
+		// The expiry handler ignores tasks for a deadline that moved, so a
+		// task that could not be cancelled does no harm
+		if err := s.cancelDeadlineTasks(ctx, id); err != nil {
+			return nil, fmt.Errorf("failed to reschedule deadline: %w", err)
+		}
+		scheduleDeadlineTasks(ctx, s.jobClient, s.queries, id, deadlineAt, req.AutocancelGrace)
+	}
+
+	previous := timePtrToString(req.DeadlineAt)
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionDeadline,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		Meta: map[string]interface{}{
+			"previousDeadlineAt": previous,
+			"deadlineAt":         deadlineAt.UTC().Format(time.RFC3339),
+		},
+	})
+
+	event := pubsub.MarkSandbox(events.New(ctx, events.RequestDeadlineChanged{
+		RequestID:          id,
+		DeadlineAt:         deadlineAt.UTC().Format(time.RFC3339),
+		PreviousDeadlineAt: previous,
+		Version:            version,
+	}), req.Sandbox)
+	_ = s.bus.PublishEntity(req.EntityID, event)
+	_ = s.bus.PublishRequest(id, event)
+
+	req.DeadlineAt = &deadlineAt
+	req.Version = version
+	return s.requestModel(ctx, req)
+}
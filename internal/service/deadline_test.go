@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	cases := []struct {
+		name    string
+		req     db.Request
+		expired bool
+	}{
+		{"no expiry", db.Request{Status: "PENDING"}, false},
+		{"before expiry", db.Request{Status: "PENDING", ExpiresAt: &future}, false},
+		{"pending past expiry", db.Request{Status: "PENDING", ExpiresAt: &past}, true},
+		{"claimed past expiry", db.Request{Status: "CLAIMED", ExpiresAt: &past}, true},
+		{"expired by deadline", db.Request{Status: "EXPIRED"}, true},
+		{"answered before expiry", db.Request{Status: "ANSWERED", ExpiresAt: &past}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expired, isExpired(c.req, now), c.name)
+	}
+}
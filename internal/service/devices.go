@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+	"pxbox/internal/push"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// maxDevicesPerEntity bounds the devices push notifications fan out to
+	maxDevicesPerEntity = 20
+	// maxDeviceToken is longer than any FCM or APNs token
+	maxDeviceToken = 4096
+	// maxDeviceName is the longest device name
+	maxDeviceName = 100
+)
+
+// DeviceInput registers the push token of an app install
+type DeviceInput struct {
+	Platform string  `json:"platform"` // "fcm" or "apns"
+	Token    string  `json:"token"`
+	Name     *string `json:"name,omitempty"`
+}
+
+// RegisterDevice registers a device of an entity for push notifications.
+// Registering a known token again updates its name and moves it to
+// entityID, as apps keep their token when another user signs in.
+func (s *EntityService) RegisterDevice(ctx context.Context, entityID string, input DeviceInput) (*model.Device, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "devices"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+
+	switch {
+	case input.Platform != push.PlatformFCM && input.Platform != push.PlatformAPNs:
+		return nil, invalid("invalid_device", `platform must be "fcm" or "apns"`, nil)
+	case input.Token == "" || strings.IndexFunc(input.Token, unicode.IsSpace) >= 0:
+		return nil, invalid("invalid_device", "token must be a non-empty string without whitespace", nil)
+	case len(input.Token) > maxDeviceToken:
+		return nil, invalid("invalid_device", fmt.Sprintf("token can be at most %d bytes", maxDeviceToken), nil)
+	case input.Name != nil && len(*input.Name) > maxDeviceName:
+		return nil, invalid("invalid_device", fmt.Sprintf("name can be at most %d bytes", maxDeviceName), nil)
+	}
+
+	devices, err := s.queries.ListDevices(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	known := false
+	for _, d := range devices {
+		if d.Platform == input.Platform && d.Token == input.Token {
+			known = true
+			break
+		}
+	}
+	if !known && len(devices) >= maxDevicesPerEntity {
+		return nil, &Error{Kind: ErrQuotaExceeded, Code: "too_many_devices", Message: fmt.Sprintf("an entity can register at most %d devices", maxDevicesPerEntity)}
+	}
+
+	d, err := s.queries.UpsertDevice(ctx, db.Device{
+		ID:       ulid.Make().String(),
+		EntityID: entityID,
+		Platform: input.Platform,
+		Token:    input.Token,
+		Name:     input.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register device: %w", err)
+	}
+	return dbDeviceToModel(d), nil
+}
+
+// ListDevices returns the registered devices of an entity, oldest first
+func (s *EntityService) ListDevices(ctx context.Context, entityID string) ([]*model.Device, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "devices"); err != nil {
+		return nil, err
+	}
+	devices, err := s.queries.ListDevices(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	result := make([]*model.Device, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, dbDeviceToModel(d))
+	}
+	return result, nil
+}
+
+// DeleteDevice unregisters a device, e.g. when the app signs out
+func (s *EntityService) DeleteDevice(ctx context.Context, entityID, id string) error {
+	if err := requireEntityOrAdmin(ctx, entityID, "devices"); err != nil {
+		return err
+	}
+	err := s.queries.DeleteDevice(ctx, entityID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound("device", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	return nil
+}
+
+func dbDeviceToModel(d db.Device) *model.Device {
+	return &model.Device{
+		ID:        d.ID,
+		Platform:  d.Platform,
+		Name:      d.Name,
+		CreatedAt: d.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: d.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// notifyOutOfBand has request.created sent to an entity on its channels
+// other than the WebSocket, such as its devices, if it has any
+func (s *RequestService) notifyOutOfBand(ctx context.Context, requestID, entityID string) {
+	ok, err := s.queries.HasNotificationTargets(ctx, entityID)
+	if err != nil || !ok {
+		return
+	}
+	_ = s.jobClient.EnqueueRequestNotification(ctx, requestID)
+}
@@ -0,0 +1,60 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevices(t *testing.T) {
+	f := newRequestFixture(t)
+	entitySvc := service.NewEntityService(f.queries)
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	// Entities without devices are only told on the WebSocket
+	f.create(t, service.CreateRequestInput{})
+	assert.Empty(t, f.jobs.Jobs("EnqueueRequestNotification"))
+
+	// Only the entity itself or an admin manages its devices
+	_, err := entitySvc.RegisterDevice(context.Background(), f.entity.ID, service.DeviceInput{Platform: "fcm", Token: "t1"})
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	for _, input := range []service.DeviceInput{
+		{Platform: "sms", Token: "t1"},
+		{Platform: "fcm", Token: ""},
+		{Platform: "apns", Token: "a b"},
+		{Platform: "fcm", Token: strings.Repeat("x", 5000)},
+	} {
+		_, err := entitySvc.RegisterDevice(ctx, f.entity.ID, input)
+		assert.Equal(t, "invalid_device", service.Classify(err).Code, input)
+	}
+
+	name := "Pixel"
+	device, err := entitySvc.RegisterDevice(ctx, f.entity.ID, service.DeviceInput{Platform: "fcm", Token: "t1", Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, "fcm", device.Platform)
+
+	// Registering the token again keeps the device
+	renamed := "Pixel 9"
+	again, err := entitySvc.RegisterDevice(ctx, f.entity.ID, service.DeviceInput{Platform: "fcm", Token: "t1", Name: &renamed})
+	require.NoError(t, err)
+	assert.Equal(t, device.ID, again.ID)
+	devices, err := entitySvc.ListDevices(ctx, f.entity.ID)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "Pixel 9", *devices[0].Name)
+
+	// New requests are pushed to the entity's devices
+	req := f.create(t, service.CreateRequestInput{})
+	jobs := f.jobs.Jobs("EnqueueRequestNotification")
+	require.Len(t, jobs, 1)
+	assert.Equal(t, req.ID, jobs[0].ID)
+
+	require.NoError(t, entitySvc.DeleteDevice(ctx, f.entity.ID, device.ID))
+	assert.ErrorIs(t, entitySvc.DeleteDevice(ctx, f.entity.ID, device.ID), service.ErrNotFound)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/db"
+
+	"go.uber.org/zap"
+)
+
+// DigestScheduler periodically enqueues the digests that came due for
+// entities with daily or weekly digests enabled
+type DigestScheduler struct {
+	queries   db.Querier
+	jobClient JobClient
+	interval  time.Duration
+	log       *zap.Logger
+}
+
+// NewDigestScheduler creates a scheduler that checks every interval
+func NewDigestScheduler(queries db.Querier, jobClient JobClient, interval time.Duration, log *zap.Logger) *DigestScheduler {
+	return &DigestScheduler{
+		queries:   queries,
+		jobClient: jobClient,
+		interval:  interval,
+		log:       log,
+	}
+}
+
+// Run schedules digests until ctx is cancelled
+func (s *DigestScheduler) Run(ctx context.Context) {
+	s.log.Info("Digest scheduler started", zap.Duration("interval", s.interval))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.schedule(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.log.Info("Digest scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule enqueues a digest for every subscriber whose latest slot has not
+// been scheduled yet
+func (s *DigestScheduler) schedule(ctx context.Context) {
+	subscribers, err := s.queries.ListDigestSubscribers(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Error("Failed to list digest subscribers", zap.Error(err))
+		}
+		return
+	}
+
+	now := time.Now()
+	scheduled := 0
+	for _, sub := range dueDigests(subscribers, now) {
+		slot, _ := sub.Preferences.DigestSlot(now)
+		// Enqueue before recording the slot: a digest enqueued twice is
+		// deduplicated, one that is never enqueued is lost
+		if err := s.jobClient.EnqueueDigest(ctx, sub.EntityID, slot); err != nil {
+			s.log.Warn("Failed to enqueue digest", zap.String("entity_id", sub.EntityID), zap.Error(err))
+			continue
+		}
+		if _, err := s.queries.MarkDigestScheduled(ctx, sub.EntityID, slot); err != nil {
+			s.log.Warn("Failed to record digest", zap.String("entity_id", sub.EntityID), zap.Error(err))
+			continue
+		}
+		scheduled++
+	}
+	if scheduled > 0 {
+		s.log.Info("Scheduled digests", zap.Int("count", scheduled))
+	}
+}
+
+// dueDigests returns the subscribers whose latest digest slot at now is
+// later than the last one scheduled
+func dueDigests(subscribers []db.DigestSubscriber, now time.Time) []db.DigestSubscriber {
+	var due []db.DigestSubscriber
+	for _, sub := range subscribers {
+		slot, ok := sub.Preferences.DigestSlot(now)
+		if !ok {
+			continue
+		}
+		if sub.LastDigestAt != nil && !sub.LastDigestAt.Before(slot) {
+			continue
+		}
+		due = append(due, sub)
+	}
+	return due
+}
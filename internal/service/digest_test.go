@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDueDigests(t *testing.T) {
+	now := time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC) // Wednesday
+	todaySlot := time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC)
+	yesterdaySlot := todaySlot.Add(-24 * time.Hour)
+	daily := model.NotificationPreferences{Digest: model.DigestDaily, DigestAt: "08:00", Timezone: "UTC"}
+	weekly := model.NotificationPreferences{Digest: model.DigestWeekly, DigestAt: "08:00", Timezone: "UTC"}
+	late := model.NotificationPreferences{Digest: model.DigestDaily, DigestAt: "10:00", Timezone: "UTC"}
+
+	due := dueDigests([]db.DigestSubscriber{
+		{EntityID: "never", Preferences: daily},
+		{EntityID: "yesterday", Preferences: daily, LastDigestAt: &yesterdaySlot},
+		{EntityID: "today", Preferences: daily, LastDigestAt: &todaySlot},
+		// Monday's weekly digest went out already
+		{EntityID: "weekly", Preferences: weekly, LastDigestAt: &[]time.Time{time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)}[0]},
+		// Yesterday at 10:00 is the latest slot, and it was sent
+		{EntityID: "later", Preferences: late, LastDigestAt: &[]time.Time{time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)}[0]},
+		{EntityID: "off", Preferences: model.DefaultNotificationPreferences()},
+	}, now)
+
+	var ids []string
+	for _, sub := range due {
+		ids = append(ids, sub.EntityID)
+	}
+	assert.Equal(t, []string{"never", "yesterday"}, ids)
+}
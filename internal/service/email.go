@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/mailin"
+	"pxbox/internal/model"
+	"pxbox/internal/scan"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	// errEmailUnavailable is returned while no reply domain is configured
+	errEmailUnavailable = &Error{Kind: ErrUnavailable, Code: "email_unavailable", Message: "answering by email is not configured"}
+	// errNoReplyAddress is returned for email sent to none of the reply
+	// addresses of requests
+	errNoReplyAddress = &Error{Kind: ErrNotFound, Code: "unknown_recipient", Message: "the email is not addressed to a request"}
+)
+
+// SetReplyAddresser lets entities answer requests by email, replying to
+// the address addresser issues for each request
+func (s *RequestService) SetReplyAddresser(addresser *mailin.Addresser) {
+	s.replyAddr = addresser
+}
+
+// ReplyAddress returns the address that answers a request by email. Email
+// to it is trusted to come from the request's entity, so only the entity
+// and admins may see it; a notifier sets it as the Reply-To of the email
+// it sends the entity.
+func (s *RequestService) ReplyAddress(ctx context.Context, requestID string) (string, error) {
+	if s.replyAddr == nil {
+		return "", errEmailUnavailable
+	}
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return "", lookupError("request", err)
+	}
+	if !auth.IsAdmin(ctx) && auth.GetEntityID(ctx) != req.EntityID {
+		return "", &Error{Kind: ErrForbidden, Code: "forbidden", Message: "only the request's entity can answer by email"}
+	}
+	return s.replyAddr.Address(req.ID), nil
+}
+
+// AnswerByEmail answers the request an email is addressed to with the
+// answers written in it (see mailin.Answers), as the request's entity. The
+// email is stored as reply.eml and attached to the response when file
+// storage is configured. It returns the response.
+func (s *RequestService) AnswerByEmail(ctx context.Context, msg *mailin.Message) (*model.Response, error) {
+	if s.replyAddr == nil {
+		return nil, errEmailUnavailable
+	}
+	requestID := ""
+	for _, recipient := range msg.Recipients {
+		if id, ok := s.replyAddr.RequestID(recipient); ok {
+			requestID = id
+			break
+		}
+	}
+	if requestID == "" {
+		return nil, errNoReplyAddress
+	}
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+
+	if model.SchemaKind(req.SchemaKind) != model.SchemaKindJSON {
+		return nil, invalid("invalid_reply", "the request cannot be answered by email", mailin.ErrNotSimple)
+	}
+	payload, err := mailin.Answers(req.SchemaPayload, mailin.Reply(msg.Text))
+	if err != nil {
+		return nil, invalid("invalid_reply", err.Error(), err)
+	}
+	// Checked before the email is stored, so rejected replies leave no file
+	if err := s.validatePayload(ctx, req, payload); err != nil {
+		return nil, err
+	}
+
+	var files []map[string]interface{}
+	if s.fileStorage != nil && s.fileResolver != nil {
+		file, err := s.storeEmail(ctx, req, msg.Raw)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	ctx = audit.WithActor(auth.WithEntityID(ctx, req.EntityID), req.EntityID)
+	return s.PostResponse(ctx, requestID, req.EntityID, payload, files, nil)
+}
+
+// storeEmail uploads the raw email of a reply and returns its file
+// metadata. Email is not scanned for malware: only its text is used, and
+// it is kept as a record of the answer.
+func (s *RequestService) storeEmail(ctx context.Context, req db.Request, raw []byte) (map[string]interface{}, error) {
+	key := "email/" + strings.ToLower(req.ID) + "/" + ulid.Make().String() + ".eml"
+	expiresAt := time.Now().Add(OrphanTTLFromEnv())
+	if _, err := s.queries.CreatePendingFile(ctx, db.CreateFileParams{
+		ID:        ulid.Make().String(),
+		ObjectKey: key,
+		RequestID: &req.ID,
+		Name:      "reply.eml",
+		MIME:      "message/rfc822",
+		CreatedBy: &req.EntityID,
+		ExpiresAt: &expiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record email: %w", err)
+	}
+	if err := s.fileStorage.Put(ctx, key, bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("failed to store email: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	digest := hex.EncodeToString(sum[:])
+	if _, err := s.queries.CompleteFileUpload(ctx, key, "message/rfc822", int64(len(raw)), digest, scan.StatusNone); err != nil {
+		return nil, fmt.Errorf("failed to record email: %w", err)
+	}
+	url, err := s.fileStorage.PresignGet(ctx, key, 24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate email URL: %w", err)
+	}
+	return map[string]interface{}{
+		"name":   "reply.eml",
+		"url":    url,
+		"size":   int64(len(raw)),
+		"mime":   "message/rfc822",
+		"sha256": digest,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/mailin"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnswerByEmail(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{Schema: approvalSchema})
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	_, err := f.svc.ReplyAddress(ctx, req.ID)
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+
+	addresser := mailin.NewAddresser("s3cret", "reply.example.com")
+	f.svc.SetReplyAddresser(addresser)
+
+	// Only the entity or an admin learns the address
+	_, err = f.svc.ReplyAddress(context.Background(), req.ID)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	address, err := f.svc.ReplyAddress(ctx, req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, addresser.Address(req.ID), address)
+
+	reply := func(to, text string) error {
+		_, err := f.svc.AnswerByEmail(context.Background(), &mailin.Message{Recipients: []string{to}, Text: text})
+		return err
+	}
+	assert.Equal(t, "unknown_recipient", service.Classify(reply("reply+x.y@reply.example.com", "yes")).Code)
+	assert.Equal(t, "invalid_reply", service.Classify(reply(address, "maybe\n\n> Approve?")).Code)
+
+	resp, err := f.svc.AnswerByEmail(context.Background(), &mailin.Message{
+		Recipients: []string{"Requests <" + address + ">"},
+		Text:       "No\n\nOn Mon, 3 Feb 2025, pxbox wrote:\n> Approve?",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, f.entity.ID, resp.AnsweredBy)
+	assert.Equal(t, map[string]interface{}{"approved": false}, resp.Payload)
+	answered, err := f.queries.GetRequestByID(context.Background(), req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ANSWERED", answered.Status)
+
+	// A second reply finds the request answered
+	assert.ErrorIs(t, reply(address, "yes"), service.ErrConflict)
+}
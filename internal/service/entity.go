@@ -2,48 +2,92 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
 	"pxbox/internal/db"
+	"pxbox/internal/events"
 	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrInvalidEntityKind is returned when an entity kind is not recognised
+var ErrInvalidEntityKind = &Error{Kind: ErrValidation, Code: "invalid_kind", Message: "invalid entity kind. Must be: user, group, role, or bot"}
+
+// ErrHandleTaken is returned when another entity already has a handle
+var ErrHandleTaken = &Error{Kind: ErrConflict, Code: "handle_taken", Message: "handle is already taken"}
+
+// ErrEntityDeactivated is returned when a request is addressed to a
+// deactivated entity
+var ErrEntityDeactivated = &Error{Kind: ErrConflict, Code: "entity_deactivated", Message: "entity is deactivated"}
+
 type EntityService struct {
-	queries *db.Queries
+	queries db.Querier
+	bus     EventBus
+	audit   *audit.Logger
 }
 
-func NewEntityService(queries *db.Queries) *EntityService {
+func NewEntityService(queries db.Querier) *EntityService {
 	return &EntityService{queries: queries}
 }
 
-// ResolveEntity resolves an entity by ID or handle
+// SetEventBus sets the event bus used to announce profile changes
+func (s *EntityService) SetEventBus(bus EventBus) {
+	s.bus = bus
+}
+
+// SetAuditLogger enables audit logging of entity changes
+func (s *EntityService) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// ResolveEntity resolves an entity by ID or handle. IDs and handles of
+// entities merged into another one resolve to the entity they were merged
+// into.
 func (s *EntityService) ResolveEntity(ctx context.Context, id, handle string) (*model.Entity, error) {
 	if id != "" {
 		e, err := s.queries.GetEntityByID(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			e, err = s.queries.GetMergedEntity(ctx, id)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("entity not found by ID: %w", err)
+			return nil, lookupError("entity", err)
 		}
 		return dbEntityToModel(e), nil
 	}
 
 	if handle != "" {
 		e, err := s.queries.GetEntityByHandle(ctx, handle)
+		if errors.Is(err, pgx.ErrNoRows) {
+			e, err = s.queries.GetMergedEntityByHandle(ctx, handle)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("entity not found by handle: %w", err)
+			return nil, lookupError("entity", err)
 		}
 		return dbEntityToModel(e), nil
 	}
 
-	return nil, fmt.Errorf("either id or handle must be provided")
+	return nil, invalid("invalid_request", "either id or handle must be provided", nil)
 }
 
-// CreateEntity creates a new entity
-func (s *EntityService) CreateEntity(ctx context.Context, kind model.EntityKind, handle string, meta map[string]interface{}) (*model.Entity, error) {
+// CreateEntity creates a new entity. Requests addressed to a sandbox entity
+// are purged automatically once they are older than the sandbox TTL.
+func (s *EntityService) CreateEntity(ctx context.Context, kind model.EntityKind, handle string, meta map[string]interface{}, sandbox bool) (*model.Entity, error) {
+	if !kind.Valid() {
+		return nil, ErrInvalidEntityKind
+	}
 	if meta == nil {
 		meta = make(map[string]interface{})
 	}
 
-	e, err := s.queries.CreateEntity(ctx, string(kind), handle, meta)
+	e, err := s.queries.CreateEntity(ctx, string(kind), handle, meta, sandbox)
+	if db.IsUniqueViolation(err) {
+		return nil, ErrHandleTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create entity: %w", err)
 	}
@@ -51,17 +95,203 @@ func (s *EntityService) CreateEntity(ctx context.Context, kind model.EntityKind,
 	return dbEntityToModel(e), nil
 }
 
+// UpdateProfile updates an entity's handle and merges meta into its profile.
+// Nil handle or meta leave the corresponding field unchanged.
+func (s *EntityService) UpdateProfile(ctx context.Context, id string, handle *string, meta map[string]interface{}) (*model.Entity, error) {
+	if handle != nil && *handle == "" {
+		return nil, invalid("invalid_handle", "handle must not be empty", nil)
+	}
+
+	e, err := s.queries.UpdateEntity(ctx, id, handle, meta)
+	if errors.Is(err, pgx.ErrNoRows) || db.IsInvalidText(err) {
+		return nil, notFound("entity", err)
+	}
+	if db.IsUniqueViolation(err) {
+		return nil, ErrHandleTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update entity: %w", err)
+	}
+	entity := dbEntityToModel(e)
+
+	if s.bus != nil {
+		_ = s.bus.PublishEntity(entity.ID, events.New(ctx, events.EntityUpdated{
+			EntityID: entity.ID,
+			Handle:   entity.Handle,
+			Meta:     entity.Meta,
+		}))
+	}
+
+	return entity, nil
+}
+
 func dbEntityToModel(e db.Entity) *model.Entity {
 	handle := ""
 	if e.Handle != nil {
 		handle = *e.Handle
 	}
 	return &model.Entity{
-		ID:        e.ID,
-		Kind:      model.EntityKind(e.Kind),
-		Handle:    handle,
-		Meta:      e.Meta,
-		CreatedAt: e.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:            e.ID,
+		Kind:          model.EntityKind(e.Kind),
+		Handle:        handle,
+		Meta:          e.Meta,
+		CreatedAt:     e.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Sandbox:       e.Sandbox,
+		DeactivatedAt: timePtrToString(e.DeactivatedAt),
+	}
+}
+
+// UpdateEntity changes an entity's handle and merges meta into its
+// profile like UpdateProfile. Only the entity itself or an admin may
+// change it.
+func (s *EntityService) UpdateEntity(ctx context.Context, id string, handle *string, meta map[string]interface{}) (*model.Entity, error) {
+	if !auth.IsAdmin(ctx) && auth.GetEntityID(ctx) != id {
+		return nil, &Error{Kind: ErrForbidden, Code: "forbidden", Message: "an entity can only be changed by itself or an admin"}
+	}
+	entity, err := s.UpdateProfile(ctx, id, handle, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   id,
+		Meta:         map[string]interface{}{"handle": handle != nil, "meta": meta != nil},
+	})
+	return entity, nil
+}
+
+// ListEntities returns the entities matching f, newest first
+func (s *EntityService) ListEntities(ctx context.Context, f db.EntityFilter, limit, offset int) ([]*model.Entity, error) {
+	if f.Kind != nil && !model.EntityKind(*f.Kind).Valid() {
+		return nil, ErrInvalidEntityKind
+	}
+	if limit <= 0 {
+		limit = DefaultInquiryLimit
+	}
+
+	entities, err := s.queries.ListEntities(ctx, f, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entities: %w", err)
 	}
+	result := make([]*model.Entity, 0, len(entities))
+	for _, e := range entities {
+		result = append(result, dbEntityToModel(e))
+	}
+	return result, nil
+}
+
+// DeactivateEntity stops an entity from receiving new requests. Its
+// requests, responses and open requests are kept; deactivating it again
+// changes nothing.
+func (s *EntityService) DeactivateEntity(ctx context.Context, id string) (*model.Entity, error) {
+	now := time.Now()
+	return s.setDeactivated(ctx, id, &now)
+}
+
+// ReactivateEntity lets a deactivated entity receive requests again
+func (s *EntityService) ReactivateEntity(ctx context.Context, id string) (*model.Entity, error) {
+	return s.setDeactivated(ctx, id, nil)
+}
+
+func (s *EntityService) setDeactivated(ctx context.Context, id string, at *time.Time) (*model.Entity, error) {
+	before, err := s.getEntity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.queries.SetEntityDeactivated(ctx, id, at)
+	if err != nil {
+		return nil, lookupError("entity", err)
+	}
+	entity := dbEntityToModel(e)
+	if (before.DeactivatedAt != nil) == (at != nil) {
+		return entity, nil
+	}
+
+	action := audit.ActionReactivate
+	var data events.Data = events.EntityReactivated{EntityID: id}
+	if entity.DeactivatedAt != nil {
+		action = audit.ActionDeactivate
+		data = events.EntityDeactivated{EntityID: id, DeactivatedAt: *entity.DeactivatedAt}
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       action,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   id,
+	})
+	if s.bus != nil {
+		_ = s.bus.PublishEntity(id, events.New(ctx, data))
+	}
+	return entity, nil
+}
+
+// MergeEntities moves the requests, responses, flows, reminders, identities
+// and saved views of the source entity to the target in one transaction and
+// deletes the source. The source's ID and handle keep resolving to the
+// target. Both entities must be of the same kind and either both or neither
+// be sandbox entities.
+func (s *EntityService) MergeEntities(ctx context.Context, sourceID, targetID, mergedBy string) (*model.EntityMerge, error) {
+	if sourceID == "" || targetID == "" {
+		return nil, invalid("invalid_request", "sourceId and targetId are required", nil)
+	}
+	if sourceID == targetID {
+		return nil, invalid("invalid_merge", "an entity cannot be merged into itself", nil)
+	}
+	source, err := s.getEntity(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.getEntity(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if source.Kind != target.Kind {
+		return nil, invalid("invalid_merge", "only entities of the same kind can be merged", nil)
+	}
+	if source.Sandbox != target.Sandbox {
+		return nil, invalid("invalid_merge", "sandbox and regular entities cannot be merged", nil)
+	}
+
+	var report model.MergeReport
+	var merged db.Entity
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		if report, err = q.MergeEntityData(ctx, sourceID, targetID, mergedBy); err != nil {
+			return err
+		}
+		merged, err = q.GetEntityByID(ctx, targetID)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, notFound("entity", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge entities: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionMerge,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   targetID,
+		Meta:         map[string]interface{}{"sourceId": sourceID, "sourceHandle": source.Handle, "report": report},
+	})
+	if s.bus != nil {
+		event := events.New(ctx, events.EntityMerged{SourceID: sourceID, TargetID: targetID})
+		_ = s.bus.PublishEntity(sourceID, event)
+		_ = s.bus.PublishEntity(targetID, event)
+	}
+	return &model.EntityMerge{SourceID: sourceID, Target: dbEntityToModel(merged), Report: report}, nil
 }
 
+// getEntity returns an existing entity by ID, without following merges
+func (s *EntityService) getEntity(ctx context.Context, id string) (db.Entity, error) {
+	e, err := s.queries.GetEntityByID(ctx, id)
+	if db.IsInvalidText(err) {
+		return e, notFound("entity", err)
+	}
+	if err != nil {
+		return e, lookupError("entity", err)
+	}
+	return e, nil
+}
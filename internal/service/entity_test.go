@@ -1,23 +1,79 @@
-package service
+package service_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
-	"pxbox/internal/db"
 	"pxbox/internal/model"
+	"pxbox/internal/service"
+	pxtest "pxbox/internal/testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestEntityService_ResolveEntity(t *testing.T) {
-	// This is a placeholder test - in real implementation, you'd use a test database
-	t.Skip("Requires test database setup")
+	ctx := context.Background()
+	svc := service.NewEntityService(pxtest.NewQueries())
+	created, err := svc.CreateEntity(ctx, model.EntityKindUser, "ada", nil, false)
+	require.NoError(t, err)
+
+	byID, err := svc.ResolveEntity(ctx, created.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, byID.ID)
+
+	byHandle, err := svc.ResolveEntity(ctx, "", "ada")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, byHandle.ID)
+
+	_, err = svc.ResolveEntity(ctx, "", "nobody")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	_, err = svc.ResolveEntity(ctx, "", "")
+	assert.ErrorIs(t, err, service.ErrValidation)
 }
 
 func TestEntityService_CreateEntity(t *testing.T) {
-	// This is a placeholder test - in real implementation, you'd use a test database
-	t.Skip("Requires test database setup")
+	ctx := context.Background()
+	svc := service.NewEntityService(pxtest.NewQueries())
+
+	e, err := svc.CreateEntity(ctx, model.EntityKindBot, "builder", map[string]interface{}{"team": "ci"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, model.EntityKindBot, e.Kind)
+	assert.Equal(t, "ci", e.Meta["team"])
+	assert.True(t, e.Sandbox)
+
+	// Entities without a handle do not collide
+	_, err = svc.CreateEntity(ctx, model.EntityKindUser, "", nil, false)
+	require.NoError(t, err)
+	_, err = svc.CreateEntity(ctx, model.EntityKindUser, "", nil, false)
+	require.NoError(t, err)
+
+	_, err = svc.CreateEntity(ctx, model.EntityKindUser, "builder", nil, false)
+	assert.True(t, errors.Is(err, service.ErrHandleTaken))
+
+	_, err = svc.CreateEntity(ctx, model.EntityKind("robot"), "", nil, false)
+	assert.Equal(t, service.ErrInvalidEntityKind, err)
 }
 
+func TestEntityService_DeactivateEntity(t *testing.T) {
+	ctx := context.Background()
+	bus := pxtest.NewBus()
+	svc := service.NewEntityService(pxtest.NewQueries())
+	svc.SetEventBus(bus)
+	e, err := svc.CreateEntity(ctx, model.EntityKindUser, "grace", nil, false)
+	require.NoError(t, err)
+
+	deactivated, err := svc.DeactivateEntity(ctx, e.ID)
+	require.NoError(t, err)
+	require.NotNil(t, deactivated.DeactivatedAt)
+	assert.Equal(t, []string{"entity.deactivated"}, bus.Types("entity:"+e.ID))
+
+	reactivated, err := svc.ReactivateEntity(ctx, e.ID)
+	require.NoError(t, err)
+	assert.Nil(t, reactivated.DeactivatedAt)
+
+	_, err = svc.DeactivateEntity(ctx, "missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+// Erasure modes
+const (
+	ErasureAnonymize = "anonymize" // Keep requests and responses, stripped of their content
+	ErasureDelete    = "delete"    // Delete the entity with everything addressed to it
+)
+
+// EventEraser removes events stored for replay
+type EventEraser interface {
+	DeleteEvents(channel string) (int64, error)
+	DeleteEventsWhere(channel string, match func(event map[string]interface{}) bool) (int64, error)
+}
+
+// ErasureService erases the data of an entity on request of a data subject.
+// Erasures run as background jobs; each run is recorded with a report of
+// what it removed.
+type ErasureService struct {
+	queries   db.Querier
+	bus       EventBus
+	stor      storage.Storage
+	events    EventEraser
+	jobClient JobClient
+	audit     *audit.Logger
+	log       *zap.Logger
+}
+
+// NewErasureService creates an erasure service. Storage objects and stream
+// events are only removed once SetStorage and SetEventEraser are called.
+func NewErasureService(queries db.Querier, bus EventBus, log *zap.Logger) *ErasureService {
+	return &ErasureService{queries: queries, bus: bus, log: log}
+}
+
+// SetStorage sets where uploaded files are deleted from
+func (s *ErasureService) SetStorage(stor storage.Storage) {
+	s.stor = stor
+}
+
+// SetEventEraser sets where stream events are deleted from
+func (s *ErasureService) SetEventEraser(events EventEraser) {
+	s.events = events
+}
+
+// SetJobClient sets the job client erasures are enqueued with
+func (s *ErasureService) SetJobClient(client JobClient) {
+	s.jobClient = client
+}
+
+// SetAuditLogger enables audit logging of erasures
+func (s *ErasureService) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// RequestErasure records an erasure of an entity's data in the given mode,
+// anonymize by default, and enqueues it
+func (s *ErasureService) RequestErasure(ctx context.Context, entityID, mode, requestedBy string) (*model.Erasure, error) {
+	if mode == "" {
+		mode = ErasureAnonymize
+	}
+	if mode != ErasureAnonymize && mode != ErasureDelete {
+		return nil, invalid("invalid_mode", "mode must be anonymize or delete", nil)
+	}
+	if s.jobClient == nil {
+		return nil, &Error{Kind: ErrUnavailable, Code: "jobs_unavailable", Message: "background jobs are not available"}
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+
+	e, err := s.queries.CreateErasure(ctx, ulid.Make().String(), entityID, mode, requestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erasure: %w", err)
+	}
+	if err := s.jobClient.EnqueueErasure(ctx, e.ID); err != nil {
+		msg := err.Error()
+		_ = s.queries.FinishErasure(ctx, e.ID, "FAILED", nil, &msg)
+		return nil, fmt.Errorf("failed to enqueue erasure: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionErase,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   entityID,
+		AfterStatus:  e.Status,
+		Meta:         map[string]interface{}{"erasureId": e.ID, "mode": mode},
+	})
+	return dbErasureToModel(e), nil
+}
+
+// GetErasure returns an erasure with its report
+func (s *ErasureService) GetErasure(ctx context.Context, id string) (*model.Erasure, error) {
+	e, err := s.queries.GetErasure(ctx, id)
+	if err != nil {
+		return nil, lookupError("erasure", err)
+	}
+	return dbErasureToModel(e), nil
+}
+
+// RunErasure performs a recorded erasure. Stored objects and stream events
+// are removed first and the database last, so a failed run can be retried
+// until it completes. Erasures that already completed are skipped.
+func (s *ErasureService) RunErasure(ctx context.Context, id string) error {
+	e, err := s.queries.StartErasure(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start erasure: %w", err)
+	}
+
+	report, err := s.erase(ctx, e)
+	if err != nil {
+		msg := err.Error()
+		if finishErr := s.queries.FinishErasure(ctx, e.ID, "FAILED", &report, &msg); finishErr != nil {
+			s.log.Error("Failed to record erasure failure", zap.String("erasure_id", e.ID), zap.Error(finishErr))
+		}
+		_ = s.bus.PublishRequestor(e.RequestedBy, events.New(ctx, events.ErasureFailed{
+			ErasureID: e.ID,
+			EntityID:  e.EntityID,
+			Error:     msg,
+		}))
+		return err
+	}
+
+	if err := s.queries.FinishErasure(ctx, e.ID, "COMPLETED", &report, nil); err != nil {
+		return fmt.Errorf("failed to record erasure: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionErase,
+		ResourceType: audit.ResourceEntity,
+		ResourceID:   e.EntityID,
+		BeforeStatus: e.Status,
+		AfterStatus:  "COMPLETED",
+		Meta:         map[string]interface{}{"erasureId": e.ID, "mode": e.Mode, "report": report},
+	})
+	_ = s.bus.PublishRequestor(e.RequestedBy, events.New(ctx, events.ErasureCompleted{
+		ErasureID: e.ID,
+		EntityID:  e.EntityID,
+		Mode:      e.Mode,
+		Report:    report,
+	}))
+	s.log.Info("Erasure completed",
+		zap.String("erasure_id", e.ID),
+		zap.String("entity_id", e.EntityID),
+		zap.String("mode", e.Mode),
+	)
+	return nil
+}
+
+func (s *ErasureService) erase(ctx context.Context, e db.Erasure) (model.ErasureReport, error) {
+	var report model.ErasureReport
+	targets, err := s.queries.GetErasureTargets(ctx, e.EntityID)
+	if err != nil {
+		return report, fmt.Errorf("failed to list erasure targets: %w", err)
+	}
+
+	report.Objects, report.ObjectsFailed = s.deleteObjects(ctx, e, targets)
+
+	events, err := s.deleteEvents(e.EntityID, targets)
+	report.Events = events
+	if err != nil {
+		return report, fmt.Errorf("failed to delete events: %w", err)
+	}
+
+	var rows model.ErasureReport
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		if e.Mode == ErasureDelete {
+			rows, err = q.DeleteEntityData(ctx, e.EntityID, targets.ObjectKeys)
+		} else {
+			rows, err = q.AnonymizeEntityData(ctx, e.EntityID, targets.ObjectKeys)
+		}
+		return err
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to erase entity data: %w", err)
+	}
+	rows.Objects, rows.ObjectsFailed, rows.Events = report.Objects, report.ObjectsFailed, report.Events
+	return rows, nil
+}
+
+// deleteObjects removes uploaded files from storage: those recorded by the
+// upload proxy and those attached by URL that storage can resolve. Objects
+// that cannot be deleted are counted and logged but do not stop the
+// erasure.
+func (s *ErasureService) deleteObjects(ctx context.Context, e db.Erasure, targets db.ErasureTargets) (deleted, failed int64) {
+	names := make(map[string]bool, len(targets.ObjectKeys))
+	for _, key := range targets.ObjectKeys {
+		names[key] = true
+	}
+	if resolver, ok := s.stor.(storage.URLResolver); ok {
+		for _, file := range targets.Files {
+			url, _ := file["url"].(string)
+			if name, ok := resolver.ObjectName(url); ok {
+				names[name] = true
+			}
+		}
+	}
+
+	for name := range names {
+		if s.stor == nil {
+			failed++
+			continue
+		}
+		err := s.stor.Delete(ctx, name)
+		switch {
+		case err == nil:
+			deleted++
+		case errors.Is(err, fs.ErrNotExist):
+		default:
+			failed++
+			s.log.Warn("Failed to delete erased file",
+				zap.String("erasure_id", e.ID),
+				zap.String("object", name),
+				zap.Error(err),
+			)
+		}
+	}
+	if s.stor == nil && failed > 0 {
+		s.log.Warn("No storage configured; erased files were not deleted",
+			zap.String("erasure_id", e.ID),
+			zap.Int64("objects", failed),
+		)
+	}
+	return deleted, failed
+}
+
+// deleteEvents removes the entity's stream, the streams of the requests
+// involved and their events in the requestors' and ops streams
+func (s *ErasureService) deleteEvents(entityID string, targets db.ErasureTargets) (int64, error) {
+	if s.events == nil {
+		return 0, nil
+	}
+
+	total, err := s.events.DeleteEvents("entity:" + entityID)
+	if err != nil {
+		return total, err
+	}
+	requests := make(map[string]bool, len(targets.RequestIDs))
+	for _, id := range targets.RequestIDs {
+		requests[id] = true
+		n, err := s.events.DeleteEvents("request:" + id)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	involved := func(event map[string]interface{}) bool {
+		if requests[events.String(event, "requestId")] {
+			return true
+		}
+		// Events about the entity itself, such as presence changes
+		return events.String(event, "entityId") == entityID
+	}
+	channels := []string{"ops"}
+	for _, clientID := range targets.Requestors {
+		channels = append(channels, "requestor:"+clientID)
+	}
+	for _, channel := range channels {
+		n, err := s.events.DeleteEventsWhere(channel, involved)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func dbErasureToModel(e db.Erasure) *model.Erasure {
+	m := &model.Erasure{
+		ID:          e.ID,
+		EntityID:    e.EntityID,
+		Mode:        e.Mode,
+		Status:      e.Status,
+		RequestedBy: e.RequestedBy,
+		Report:      e.Report,
+		Error:       e.Error,
+		CreatedAt:   e.CreatedAt.Format(time.RFC3339),
+	}
+	if e.StartedAt != nil {
+		t := e.StartedAt.Format(time.RFC3339)
+		m.StartedAt = &t
+	}
+	if e.CompletedAt != nil {
+		t := e.CompletedAt.Format(time.RFC3339)
+		m.CompletedAt = &t
+	}
+	return m
+}
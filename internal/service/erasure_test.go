@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEventEraser holds streams in memory
+type fakeEventEraser struct {
+	streams map[string][]map[string]interface{}
+}
+
+func (f *fakeEventEraser) DeleteEvents(channel string) (int64, error) {
+	n := int64(len(f.streams[channel]))
+	delete(f.streams, channel)
+	return n, nil
+}
+
+func (f *fakeEventEraser) DeleteEventsWhere(channel string, match func(map[string]interface{}) bool) (int64, error) {
+	var kept []map[string]interface{}
+	var n int64
+	for _, event := range f.streams[channel] {
+		if match(event) {
+			n++
+			continue
+		}
+		kept = append(kept, event)
+	}
+	f.streams[channel] = kept
+	return n, nil
+}
+
+func TestErasureDeletesEvents(t *testing.T) {
+	events := &fakeEventEraser{streams: map[string][]map[string]interface{}{
+		"entity:e1":       {{"type": "request.created"}, {"type": "request.answered"}},
+		"request:r1":      {{"type": "request.answered"}},
+		"request:r9":      {{"type": "request.answered"}},
+		"requestor:app":   {eventData("requestId", "r1"), eventData("requestId", "r9"), eventData("entityId", "e1")},
+		"requestor:other": {eventData("requestId", "r1")},
+		"ops":             {eventData("requestId", "r1"), {"type": "job.failed"}},
+	}}
+	s := &ErasureService{events: events}
+
+	n, err := s.deleteEvents("e1", db.ErasureTargets{RequestIDs: []string{"r1"}, Requestors: []string{"app"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+
+	assert.NotContains(t, events.streams, "entity:e1")
+	assert.NotContains(t, events.streams, "request:r1")
+	assert.Len(t, events.streams["request:r9"], 1)
+	assert.Equal(t, []map[string]interface{}{eventData("requestId", "r9")}, events.streams["requestor:app"])
+	// Requestors that created none of the requests are not scanned
+	assert.Len(t, events.streams["requestor:other"], 1)
+	assert.Equal(t, []map[string]interface{}{{"type": "job.failed"}}, events.streams["ops"])
+}
+
+func TestRequestErasureValidatesMode(t *testing.T) {
+	s := NewErasureService(nil, nil, nil)
+	_, err := s.RequestErasure(context.Background(), "e1", "shred", "app")
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	// Without a job client nothing could run the erasure
+	_, err = s.RequestErasure(context.Background(), "e1", ErasureDelete, "app")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+}
+
+// eventData returns an event with a single data field
+func eventData(field, value string) map[string]interface{} {
+	return map[string]interface{}{"type": "request.answered", "data": map[string]interface{}{field: value}}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/breaker"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Error categories. Every error returned by a service either wraps one of
+// these or is an unexpected internal failure.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrValidation    = errors.New("validation failed")
+	ErrForbidden     = errors.New("forbidden")
+	ErrUnavailable   = errors.New("temporarily unavailable")
+	ErrTooLarge      = errors.New("too large")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// Error is a categorized service error with a stable machine-readable code
+// and optional details for the client
+type Error struct {
+	Kind    error       // One of the categories above; nil for internal errors
+	Code    string      // e.g. "not_found", "version_conflict"
+	Message string
+	Details interface{} // Optional, e.g. schema violations
+	Err     error       // Underlying cause, if any
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap exposes both the category and the cause to errors.Is/As
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+var (
+	// ErrVersionConflict is returned when a mutation's expected version does
+	// not match the request's current version
+	ErrVersionConflict = &Error{Kind: ErrConflict, Code: "version_conflict", Message: "version conflict"}
+	// ErrRequestExpired is returned when a request is claimed or answered
+	// after its expiresAt
+	ErrRequestExpired = &Error{Kind: ErrConflict, Code: "request_expired", Message: "request has expired"}
+	// ErrInvalidTransition is returned when a status change is not allowed
+	// from the request's current status
+	ErrInvalidTransition = model.ErrInvalidTransition
+)
+
+func notFound(what string, err error) error {
+	return &Error{Kind: ErrNotFound, Code: "not_found", Message: what + " not found", Err: err}
+}
+
+func invalid(code, message string, err error) error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message, Err: err}
+}
+
+// lookupError classifies a failed lookup: missing rows become ErrNotFound,
+// anything else is an internal failure
+func lookupError(what string, err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound(what, err)
+	}
+	return fmt.Errorf("failed to get %s: %w", what, err)
+}
+
+// transitionConflict reports a rejected status change as a conflict
+func transitionConflict(err error) error {
+	return &Error{Kind: ErrConflict, Code: "invalid_transition", Message: "invalid status transition", Err: err}
+}
+
+// Classify returns the category, code and details of err. Errors that do
+// not carry a category are reported as internal with an empty Kind.
+func Classify(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		// Keep the full message chain, not just the categorized part
+		return &Error{Kind: e.Kind, Code: e.Code, Message: err.Error(), Details: e.Details, Err: err}
+	}
+	switch {
+	case errors.Is(err, model.ErrInvalidTransition):
+		return &Error{Kind: ErrConflict, Code: "invalid_transition", Message: err.Error(), Err: err}
+	case errors.Is(err, breaker.ErrOpen):
+		return &Error{Kind: ErrUnavailable, Code: "unavailable", Message: err.Error(), Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrUnavailable, Code: "timeout", Message: err.Error(), Err: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Kind: ErrUnavailable, Code: "cancelled", Message: err.Error(), Err: err}
+	}
+	return &Error{Code: "internal_error", Message: err.Error(), Err: err}
+}
+
+// transitionError explains why a guarded request update matched no row
+func (s *RequestService) transitionError(ctx context.Context, id string, to model.Status, expectedVersion *int, err error) error {
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	current, getErr := s.queries.GetRequestByID(ctx, id)
+	if getErr != nil {
+		return lookupError("request", getErr)
+	}
+	if expectedVersion != nil && current.Version != *expectedVersion {
+		return fmt.Errorf("%w: expected version %d, current version %d", ErrVersionConflict, *expectedVersion, current.Version)
+	}
+	if (to == model.StatusClaimed || to == model.StatusAnswered) && isExpired(current, time.Now()) {
+		return ErrRequestExpired
+	}
+	if to != "" {
+		if err := model.RequestStatusMachine.Check(model.Status(current.Status), to); err != nil {
+			return transitionConflict(err)
+		}
+	}
+	// The request changed between the update and this check; report it as
+	// a conflict so the caller re-reads
+	return fmt.Errorf("%w: request was modified concurrently", ErrVersionConflict)
+}
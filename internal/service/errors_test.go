@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"pxbox/internal/breaker"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		code string
+	}{
+		{"not found", lookupError("request", pgx.ErrNoRows), ErrNotFound, "not_found"},
+		{"lookup failure", lookupError("request", errors.New("boom")), nil, "internal_error"},
+		{"version conflict", fmt.Errorf("%w: expected 1", ErrVersionConflict), ErrConflict, "version_conflict"},
+		{"transition", transitionConflict(model.RequestStatusMachine.Check(model.StatusAnswered, model.StatusClaimed)), ErrConflict, "invalid_transition"},
+		{"bare transition", &model.TransitionError{From: model.StatusExpired, To: model.StatusClaimed}, ErrConflict, "invalid_transition"},
+		{"validation", fmt.Errorf("wrapped: %w", invalid("invalid_schema", "invalid schema", nil)), ErrValidation, "invalid_schema"},
+		{"entity kind", ErrInvalidEntityKind, ErrValidation, "invalid_kind"},
+		{"breaker open", &breaker.OpenError{Name: "postgres"}, ErrUnavailable, "unavailable"},
+		{"timeout", fmt.Errorf("failed to get request: %w", context.DeadlineExceeded), ErrUnavailable, "timeout"},
+		{"cancelled", fmt.Errorf("failed to get request: %w", context.Canceled), ErrUnavailable, "cancelled"},
+		{"internal", errors.New("boom"), nil, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Classify(tt.err)
+			assert.Equal(t, tt.kind, e.Kind)
+			assert.Equal(t, tt.code, e.Code)
+			assert.Equal(t, tt.err.Error(), e.Message)
+			var se *Error
+			if errors.As(tt.err, &se) {
+				assert.ErrorIs(t, tt.err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestErrorUnwrapsCause(t *testing.T) {
+	err := lookupError("flow", pgx.ErrNoRows)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	assert.Equal(t, "flow not found: no rows in result set", err.Error())
+}
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/scan"
+	"pxbox/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// defaultMaxUploadBytes caps uploads without a stricter request policy
+const defaultMaxUploadBytes = 100 << 20
+
+// MaxUploadBytesFromEnv returns the upload size cap from MAX_UPLOAD_BYTES
+func MaxUploadBytesFromEnv() int64 {
+	if v := os.Getenv("MAX_UPLOAD_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxUploadBytes
+}
+
+// defaultOrphanTTL is how long an uploaded file may stay unreferenced by a
+// response before it is garbage-collected
+const defaultOrphanTTL = 24 * time.Hour
+
+// OrphanTTLFromEnv returns the unreferenced file lifetime from FILE_ORPHAN_TTL
+func OrphanTTLFromEnv() time.Duration {
+	if v := os.Getenv("FILE_ORPHAN_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultOrphanTTL
+}
+
+// FileService records signed uploads and streams file content through the
+// storage backend, enforcing the owning request's file policy
+type FileService struct {
+	queries        db.Querier
+	stor           storage.Storage
+	bus            EventBus
+	jobClient      JobClient
+	maxUploadBytes int64
+	orphanTTL      time.Duration
+}
+
+// NewFileService creates a file service on top of stor
+func NewFileService(queries db.Querier, stor storage.Storage, bus EventBus) *FileService {
+	return &FileService{
+		queries:        queries,
+		stor:           stor,
+		bus:            bus,
+		maxUploadBytes: MaxUploadBytesFromEnv(),
+		orphanTTL:      OrphanTTLFromEnv(),
+	}
+}
+
+// SetJobClient enables asynchronous malware scanning of uploads when a
+// scanner is configured
+func (s *FileService) SetJobClient(client JobClient) {
+	s.jobClient = client
+}
+
+// SignFileInput describes an upload to sign
+type SignFileInput struct {
+	Key         string
+	ContentType string
+	RequestID   string // Optional; links the file to a request and its policy
+	CreatedBy   string
+}
+
+// SignedFile holds the URLs for uploading and downloading a file, and when
+// the file is deleted unless a response references it
+type SignedFile struct {
+	Key       string `json:"key"`
+	PutURL    string `json:"putUrl"`
+	GetURL    string `json:"getUrl"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// Sign records a pending file and returns its upload and download URLs.
+// Signing a key again is allowed until content has been uploaded.
+func (s *FileService) Sign(ctx context.Context, input SignFileInput) (SignedFile, error) {
+	expiresAt := time.Now().Add(s.orphanTTL)
+	params := db.CreateFileParams{
+		ID:        ulid.Make().String(),
+		ObjectKey: input.Key,
+		Name:      input.Key,
+		MIME:      input.ContentType,
+		ExpiresAt: &expiresAt,
+	}
+	if input.RequestID != "" {
+		params.RequestID = &input.RequestID
+	}
+	if input.CreatedBy != "" {
+		params.CreatedBy = &input.CreatedBy
+	}
+	if _, err := s.queries.CreatePendingFile(ctx, params); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return SignedFile{}, &Error{Kind: ErrConflict, Code: "file_exists", Message: "file already uploaded", Err: err}
+		}
+		return SignedFile{}, fmt.Errorf("failed to record file: %w", err)
+	}
+
+	putURL, err := s.stor.PresignPut(ctx, input.Key, input.ContentType, 15*time.Minute)
+	if err != nil {
+		return SignedFile{}, fmt.Errorf("failed to generate upload URL: %w", err)
+	}
+	getURL, err := s.stor.PresignGet(ctx, input.Key, 24*time.Hour)
+	if err != nil {
+		return SignedFile{}, fmt.Errorf("failed to generate download URL: %w", err)
+	}
+	return SignedFile{
+		Key:       input.Key,
+		PutURL:    putURL,
+		GetURL:    getURL,
+		ExpiresAt: expiresAt.Format("2006-01-02T15:04:05Z07:00"),
+	}, nil
+}
+
+// Upload stores the content of a signed file. The content type is sniffed
+// from the data, and type, extension and size are checked against the
+// request's file policy while streaming; rejected content is removed from
+// storage.
+func (s *FileService) Upload(ctx context.Context, key, declaredType string, body io.Reader) (*model.File, error) {
+	f, err := s.queries.GetFileByKey(ctx, key)
+	if err != nil {
+		return nil, lookupError("file", err)
+	}
+	if f.Status != "pending" {
+		return nil, &Error{Kind: ErrConflict, Code: "file_exists", Message: "file already uploaded"}
+	}
+
+	policy, err := s.policy(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	if declaredType == "" {
+		declaredType = f.MIME
+	}
+	contentType, body, err := storage.SniffContentType(body, declaredType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	// Size is enforced while streaming below
+	if err := policy.ValidateFile(f.Name, contentType, 0); err != nil {
+		return nil, invalid("policy_violation", err.Error(), nil)
+	}
+
+	limit := s.sizeLimit(policy)
+	upload := storage.NewUploadReader(body, limit)
+	if err := s.stor.Put(ctx, key, upload); err != nil {
+		s.discard(key)
+		if errors.Is(err, storage.ErrTooLarge) {
+			return nil, fileTooLarge(limit)
+		}
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	if err := s.checkTotal(ctx, f, policy, upload.Size()); err != nil {
+		s.discard(key)
+		return nil, err
+	}
+
+	done, err := s.complete(ctx, f, contentType, upload.Size(), upload.SHA256())
+	if err != nil {
+		s.discard(key)
+		return nil, err
+	}
+	return done, nil
+}
+
+// sizeLimit returns the largest file the policy allows
+func (s *FileService) sizeLimit(policy *storage.FilePolicy) int64 {
+	limit := s.maxUploadBytes
+	if policy != nil && policy.MaxFileMB != nil {
+		if max := int64(*policy.MaxFileMB * 1024 * 1024); max < limit {
+			limit = max
+		}
+	}
+	return limit
+}
+
+func fileTooLarge(limit int64) error {
+	return &Error{Kind: ErrTooLarge, Code: "file_too_large",
+		Message: fmt.Sprintf("file exceeds maximum of %d bytes", limit)}
+}
+
+// checkTotal enforces the policy's maxTotalMB for a file of the given size
+// joining the request's uploaded files
+func (s *FileService) checkTotal(ctx context.Context, f db.File, policy *storage.FilePolicy, size int64) error {
+	if policy == nil || policy.MaxTotalMB == nil || f.RequestID == nil {
+		return nil
+	}
+	total, err := s.queries.SumRequestFileSizes(ctx, *f.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to sum file sizes: %w", err)
+	}
+	if max := int64(*policy.MaxTotalMB * 1024 * 1024); total+size > max {
+		return &Error{Kind: ErrTooLarge, Code: "policy_violation",
+			Message: fmt.Sprintf("files for this request exceed maximum total of %d bytes", max)}
+	}
+	return nil
+}
+
+// complete marks a stored file uploaded, queues its malware scan and
+// announces it on the request channel
+func (s *FileService) complete(ctx context.Context, f db.File, contentType string, size int64, sha256 string) (*model.File, error) {
+	scanStatus := scan.StatusNone
+	if s.jobClient != nil && scan.Enabled() {
+		scanStatus = scan.StatusPending
+	}
+	done, err := s.queries.CompleteFileUpload(ctx, f.ObjectKey, contentType, size, sha256, scanStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &Error{Kind: ErrConflict, Code: "file_exists", Message: "file already uploaded", Err: err}
+		}
+		return nil, fmt.Errorf("failed to record upload: %w", err)
+	}
+
+	if scanStatus == scan.StatusPending {
+		if err := s.jobClient.EnqueueFileScan(ctx, f.ObjectKey); err != nil {
+			// Record the failure so the file is not left pending forever
+			reason := "failed to schedule scan: " + err.Error()
+			_ = s.queries.SetFileScanResult(ctx, f.ObjectKey, scan.StatusError, &reason)
+			done.ScanStatus, done.ScanResult = scan.StatusError, &reason
+		}
+	}
+
+	file := s.toModel(ctx, done)
+	if file.RequestID != nil && s.bus != nil {
+		_ = s.bus.PublishRequest(*file.RequestID, events.New(ctx, events.FileUploaded{
+			RequestID: *file.RequestID,
+			File:      file,
+		}))
+	}
+	return file, nil
+}
+
+// Open returns an uploaded file and its content; the caller closes it
+func (s *FileService) Open(ctx context.Context, key string) (*model.File, io.ReadCloser, error) {
+	f, err := s.queries.GetFileByKey(ctx, key)
+	if err != nil {
+		return nil, nil, lookupError("file", err)
+	}
+	if f.Status != "uploaded" {
+		return nil, nil, notFound("file", nil)
+	}
+	if f.ScanStatus == scan.StatusInfected {
+		return nil, nil, &Error{Kind: ErrForbidden, Code: "file_quarantined", Message: "file failed the malware scan"}
+	}
+	rc, err := s.stor.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, notFound("file", err)
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return s.toModel(ctx, f), rc, nil
+}
+
+// policy returns the file policy of the request a file belongs to, if any
+func (s *FileService) policy(ctx context.Context, f db.File) (*storage.FilePolicy, error) {
+	if f.RequestID == nil {
+		return nil, nil
+	}
+	req, err := s.queries.GetRequestRef(ctx, *f.RequestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	policy, err := storage.ParseFilePolicy(req.FilesPolicy)
+	if err != nil {
+		return nil, invalid("invalid_policy", "invalid file policy", err)
+	}
+	return policy, nil
+}
+
+// discard removes a rejected or partial upload. It runs on a fresh context
+// since the request's may already be cancelled.
+func (s *FileService) discard(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.stor.Delete(ctx, key)
+}
+
+func (s *FileService) toModel(ctx context.Context, f db.File) *model.File {
+	out := &model.File{
+		ID:         f.ID,
+		Key:        f.ObjectKey,
+		RequestID:  f.RequestID,
+		Name:       f.Name,
+		Size:       f.Size,
+		MIME:       f.MIME,
+		Status:     f.Status,
+		CreatedAt:  f.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ScanStatus: f.ScanStatus,
+		ScanResult: f.ScanResult,
+	}
+	if f.SHA256 != nil {
+		out.SHA256 = *f.SHA256
+	}
+	if f.UploadedAt != nil {
+		uploadedAt := f.UploadedAt.Format("2006-01-02T15:04:05Z07:00")
+		out.UploadedAt = &uploadedAt
+	}
+	if url, err := s.stor.PresignGet(ctx, f.ObjectKey, 24*time.Hour); err == nil {
+		out.URL = url
+	}
+	return out
+}
+
+// checkFileScans rejects response files whose scan status is not allowed.
+// Files that were not uploaded through the file proxy are not checked.
+func (s *RequestService) checkFileScans(ctx context.Context, files []map[string]interface{}) error {
+	if s.fileResolver == nil || s.scanEnforce == "" || s.scanEnforce == scan.EnforceOff {
+		return nil
+	}
+	for _, key := range s.fileKeys(files) {
+		f, err := s.queries.GetFileByKey(ctx, key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get file: %w", err)
+		}
+		if !s.scanEnforce.Allows(f.ScanStatus) {
+			code := "file_not_scanned"
+			if f.ScanStatus == scan.StatusInfected {
+				code = "file_infected"
+			}
+			return &Error{
+				Kind:    ErrValidation,
+				Code:    code,
+				Message: fmt.Sprintf("file %s has scan status %s", key, f.ScanStatus),
+				Details: map[string]interface{}{"key": key, "scanStatus": f.ScanStatus},
+			}
+		}
+	}
+	return nil
+}
+
+// fileKeys returns the storage objects behind the URLs of response files
+func (s *RequestService) fileKeys(files []map[string]interface{}) []string {
+	if s.fileResolver == nil {
+		return nil
+	}
+	var keys []string
+	for _, file := range files {
+		url, _ := file["url"].(string)
+		if key, ok := s.fileResolver.ObjectName(url); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
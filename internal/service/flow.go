@@ -3,19 +3,26 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"pxbox/internal/audit"
 	"pxbox/internal/db"
+	"pxbox/internal/events"
 	"pxbox/internal/model"
 )
 
 type FlowService struct {
-	queries    *db.Queries
+	queries    db.Querier
 	bus        EventBus
 	requestSvc *RequestService
 	runner     FlowRunner // Flow runner for executing flow steps
+	audit      *audit.Logger
+
+	minTickInterval time.Duration // Shortest interval between timed ticks; see SetMinTickInterval
 }
 
-func NewFlowService(queries *db.Queries, bus EventBus, requestSvc *RequestService) *FlowService {
+func NewFlowService(queries db.Querier, bus EventBus, requestSvc *RequestService) *FlowService {
 	fs := &FlowService{
 		queries:    queries,
 		bus:        bus,
@@ -31,10 +38,35 @@ func (s *FlowService) SetRunner(runner FlowRunner) {
 	s.runner = runner
 }
 
+// SetAuditLogger sets the audit logger for recording state changes
+func (s *FlowService) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// setStatus transitions a flow to a new status and records the change in the
+// audit log
+func (s *FlowService) setStatus(ctx context.Context, flowID, before string, after model.FlowStatus, action string) error {
+	if err := s.queries.UpdateFlowStatus(ctx, flowID, string(after)); err != nil {
+		return err
+	}
+	if before == string(after) {
+		return nil
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       action,
+		ResourceType: audit.ResourceFlow,
+		ResourceID:   flowID,
+		BeforeStatus: before,
+		AfterStatus:  string(after),
+	})
+	return nil
+}
+
 type CreateFlowInput struct {
-	Kind        string
-	OwnerEntity string
-	Cursor      map[string]interface{}
+	Kind         string
+	OwnerEntity  string
+	Cursor       map[string]interface{}
+	ParentFlowID string // Set for a sub-flow spawned by a step of another flow
 }
 
 func (s *FlowService) CreateFlow(ctx context.Context, input CreateFlowInput) (*model.Flow, error) {
@@ -42,42 +74,116 @@ func (s *FlowService) CreateFlow(ctx context.Context, input CreateFlowInput) (*m
 		input.Cursor = make(map[string]interface{})
 	}
 
+	var parentID *string
+	if input.ParentFlowID != "" {
+		parent, err := s.queries.GetFlowByID(ctx, input.ParentFlowID)
+		if err != nil {
+			return nil, lookupError("parent flow", err)
+		}
+		if status := finalStatus(parent); flowFinishedEvent(status) != "" {
+			return nil, &Error{Kind: ErrConflict, Code: "flow_closed", Message: "parent flow is " + strings.ToLower(string(status))}
+		}
+		parentID = &parent.ID
+	}
+
 	flow, err := s.queries.CreateFlow(ctx, db.CreateFlowParams{
-		Kind:        input.Kind,
-		OwnerEntity: input.OwnerEntity,
-		Status:      string(model.FlowStatusRunning),
-		Cursor:      input.Cursor,
+		Kind:         input.Kind,
+		OwnerEntity:  input.OwnerEntity,
+		Status:       string(model.FlowStatusRunning),
+		Cursor:       input.Cursor,
+		ParentFlowID: parentID,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create flow: %w", err)
 	}
 
-	_ = s.bus.PublishEntity(input.OwnerEntity, map[string]interface{}{
-		"type":   "flow.created",
-		"flowId": flow.ID,
+	// Flows that tick on a timer are scheduled from the start
+	if s.armTick(ctx, flow.ID, flow.Cursor) {
+		if err := s.queries.UpdateFlowCursor(ctx, flow.ID, flow.Cursor); err != nil {
+			return nil, fmt.Errorf("failed to schedule flow tick: %w", err)
+		}
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionCreate,
+		ResourceType: audit.ResourceFlow,
+		ResourceID:   flow.ID,
+		AfterStatus:  flow.Status,
+		Meta:         map[string]interface{}{"kind": flow.Kind, "ownerEntity": flow.OwnerEntity},
 	})
 
+	created := events.FlowCreated{FlowID: flow.ID}
+	if parentID != nil {
+		created.ParentFlowID = *parentID
+	}
+	_ = s.bus.PublishEntity(input.OwnerEntity, events.New(ctx, created))
+
 	return dbFlowToModel(flow), nil
 }
 
 func (s *FlowService) GetFlow(ctx context.Context, id string) (*model.Flow, error) {
 	flow, err := s.queries.GetFlowByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("flow not found: %w", err)
+		return nil, lookupError("flow", err)
 	}
 	return dbFlowToModel(flow), nil
 }
 
 func (s *FlowService) ResumeFlow(ctx context.Context, flowID string, event string, data map[string]interface{}) error {
-	flow, err := s.queries.GetFlowByID(ctx, flowID)
+	_, err := s.ResumeFlowEvent(ctx, flowID, "", event, data)
+	return err
+}
+
+// ResumeFlowEvent resumes a flow with an event identified by eventID. An
+// event equal to the last one applied to the flow is a redelivery: it is
+// ignored and false is returned. An empty eventID is never deduplicated.
+func (s *FlowService) ResumeFlowEvent(ctx context.Context, flowID, eventID, event string, data map[string]interface{}) (bool, error) {
+	applied := false
+	var stepErr error
+	err := s.withFlowLock(ctx, flowID, func(fs *FlowService) error {
+		flow, err := fs.queries.GetFlowByID(ctx, flowID)
+		if err != nil {
+			return lookupError("flow", err)
+		}
+		if eventID != "" && flow.LastEventID != nil && *flow.LastEventID == eventID {
+			return nil
+		}
+		if err := resumable(flow.Status); err != nil {
+			return err
+		}
+		applied = true
+		stepErr, err = fs.resume(ctx, flow, eventID, event, data)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("flow not found: %w", err)
+		return false, err
+	}
+	return applied, stepErr
+}
+
+// resumable reports why a flow in status cannot take an event: only
+// running and suspended flows can
+func resumable(status string) error {
+	switch model.FlowStatus(status) {
+	case model.FlowStatusRunning, model.FlowStatusSuspended:
+		return nil
+	case model.FlowStatusArchived:
+		return errFlowArchived
 	}
+	return &Error{Kind: ErrConflict, Code: "flow_closed", Message: "flow is " + strings.ToLower(status)}
+}
+
+// resume applies an event to a flow and runs its next step. A failing step
+// marks the flow as failed and is returned as stepErr, so the failure is
+// committed; err reports that the flow could not be updated.
+func (s *FlowService) resume(ctx context.Context, flow db.Flow, eventID, event string, data map[string]interface{}) (stepErr error, err error) {
+	flowID := flow.ID
 
 	// Update cursor with event data
 	if flow.Cursor == nil {
 		flow.Cursor = make(map[string]interface{})
 	}
+	s.disarmTimeout(flow.Cursor)
 	flow.Cursor["lastEvent"] = map[string]interface{}{
 		"type": event,
 		"data": data,
@@ -85,155 +191,192 @@ func (s *FlowService) ResumeFlow(ctx context.Context, flowID string, event strin
 
 	// Update flow status and cursor
 	if err := s.queries.UpdateFlowCursor(ctx, flowID, flow.Cursor); err != nil {
-		return fmt.Errorf("failed to update cursor: %w", err)
+		return nil, fmt.Errorf("failed to update cursor: %w", err)
+	}
+	if eventID != "" {
+		if err := s.queries.SetFlowLastEventID(ctx, flowID, eventID); err != nil {
+			return nil, fmt.Errorf("failed to record event: %w", err)
+		}
 	}
 
-	if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusRunning)); err != nil {
-		return fmt.Errorf("failed to update status: %w", err)
+	if err := s.setStatus(ctx, flowID, flow.Status, model.FlowStatusRunning, audit.ActionResume); err != nil {
+		return nil, fmt.Errorf("failed to update status: %w", err)
 	}
 
 	// Execute flow step if runner is available
 	if s.runner != nil {
 		flowModel := dbFlowToModel(flow)
 		result := s.runner.Run(ctx, flowModel)
+		if result.Suspend != nil {
+			s.armTimeout(ctx, flowModel, &result)
+		}
+		s.scheduleTick(ctx, flowModel, &result)
 		
 		// Update cursor with result
 		if result.Cursor != nil {
 			if err := s.queries.UpdateFlowCursor(ctx, flowID, result.Cursor); err != nil {
-				return fmt.Errorf("failed to update cursor after step: %w", err)
+				return nil, fmt.Errorf("failed to update cursor after step: %w", err)
 			}
 		}
 
 		// Handle suspend
 		if result.Suspend != nil {
-			if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusSuspended)); err != nil {
-				return fmt.Errorf("failed to suspend flow: %w", err)
+			if err := s.setStatus(ctx, flowID, string(model.FlowStatusRunning), model.FlowStatusSuspended, audit.ActionSuspend); err != nil {
+				return nil, fmt.Errorf("failed to suspend flow: %w", err)
 			}
-			_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-				"type":   "flow.suspended",
-				"flowId": flowID,
-			})
-			return nil
+			_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowSuspended{FlowID: flowID}))
+			return nil, nil
 		}
 
 		// Handle completion
 		if result.Done {
-			if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusCompleted)); err != nil {
-				return fmt.Errorf("failed to complete flow: %w", err)
+			if err := s.setStatus(ctx, flowID, string(model.FlowStatusRunning), model.FlowStatusCompleted, audit.ActionComplete); err != nil {
+				return nil, fmt.Errorf("failed to complete flow: %w", err)
 			}
-			_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-				"type":   "flow.completed",
-				"flowId": flowID,
-			})
-			return nil
+			_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowCompleted{FlowID: flowID}))
+			s.childFinished(ctx, flow, "flow.completed", result.Cursor)
+			return nil, nil
 		}
 
 		// Handle error
 		if result.Err != nil {
-			if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusFailed)); err != nil {
-				return fmt.Errorf("failed to mark flow as failed: %w", err)
+			if err := s.setStatus(ctx, flowID, string(model.FlowStatusRunning), model.FlowStatusFailed, audit.ActionFail); err != nil {
+				return nil, fmt.Errorf("failed to mark flow as failed: %w", err)
 			}
-			_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-				"type":   "flow.failed",
-				"flowId": flowID,
-				"error":  result.Err.Error(),
-			})
-			return result.Err
+			_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowFailed{
+				FlowID: flowID,
+				Error:  result.Err.Error(),
+			}))
+			s.childFinished(ctx, flow, "flow.failed", result.Cursor)
+			return result.Err, nil
 		}
 	}
 
-	_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-		"type":   "flow.updated",
-		"flowId": flowID,
-		"status": "RUNNING",
-	})
+	_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowUpdated{
+		FlowID: flowID,
+		Status: "RUNNING",
+	}))
 
-	return nil
+	return nil, nil
 }
 
 // TickFlow executes a flow step (called by scheduler or recovery)
 func (s *FlowService) TickFlow(ctx context.Context, flowID string) error {
+	var stepErr error
+	err := s.withFlowLock(ctx, flowID, func(fs *FlowService) error {
+		var err error
+		stepErr, err = fs.tick(ctx, flowID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return stepErr
+}
+
+// tick runs the next step of a flow; errors are split as for resume
+func (s *FlowService) tick(ctx context.Context, flowID string) (stepErr error, err error) {
 	flow, err := s.queries.GetFlowByID(ctx, flowID)
 	if err != nil {
-		return fmt.Errorf("flow not found: %w", err)
+		return nil, lookupError("flow", err)
 	}
 
 	if flow.Status != string(model.FlowStatusRunning) && flow.Status != string(model.FlowStatusSuspended) {
-		return nil // Only process running or suspended flows
+		return nil, nil // Only process running or suspended flows
 	}
 
 	flowModel := dbFlowToModel(flow)
 	if s.runner == nil {
-		return fmt.Errorf("flow runner not set")
+		return nil, fmt.Errorf("flow runner not set")
 	}
 
 	result := s.runner.Run(ctx, flowModel)
+	if result.Suspend != nil {
+		s.armTimeout(ctx, flowModel, &result)
+	}
+	s.scheduleTick(ctx, flowModel, &result)
 
 	// Update cursor
 	if result.Cursor != nil {
 		if err := s.queries.UpdateFlowCursor(ctx, flowID, result.Cursor); err != nil {
-			return fmt.Errorf("failed to update cursor: %w", err)
+			return nil, fmt.Errorf("failed to update cursor: %w", err)
 		}
 	}
 
 	// Handle suspend
 	if result.Suspend != nil {
-		if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusSuspended)); err != nil {
-			return fmt.Errorf("failed to suspend flow: %w", err)
+		if err := s.setStatus(ctx, flowID, flow.Status, model.FlowStatusSuspended, audit.ActionSuspend); err != nil {
+			return nil, fmt.Errorf("failed to suspend flow: %w", err)
 		}
-		_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-			"type":   "flow.suspended",
-			"flowId": flowID,
-		})
-		return nil
+		_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowSuspended{FlowID: flowID}))
+		return nil, nil
 	}
 
 	// Handle completion
 	if result.Done {
-		if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusCompleted)); err != nil {
-			return fmt.Errorf("failed to complete flow: %w", err)
+		if err := s.setStatus(ctx, flowID, flow.Status, model.FlowStatusCompleted, audit.ActionComplete); err != nil {
+			return nil, fmt.Errorf("failed to complete flow: %w", err)
 		}
-		_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-			"type":   "flow.completed",
-			"flowId": flowID,
-		})
-		return nil
+		_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowCompleted{FlowID: flowID}))
+		s.childFinished(ctx, flow, "flow.completed", result.Cursor)
+		return nil, nil
 	}
 
 	// Handle error
 	if result.Err != nil {
-		if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusFailed)); err != nil {
-			return fmt.Errorf("failed to mark flow as failed: %w", err)
+		if err := s.setStatus(ctx, flowID, flow.Status, model.FlowStatusFailed, audit.ActionFail); err != nil {
+			return nil, fmt.Errorf("failed to mark flow as failed: %w", err)
 		}
-		_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-			"type":   "flow.failed",
-			"flowId": flowID,
-			"error":  result.Err.Error(),
-		})
-		return result.Err
+		_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowFailed{
+			FlowID: flowID,
+			Error:  result.Err.Error(),
+		}))
+		s.childFinished(ctx, flow, "flow.failed", result.Cursor)
+		return result.Err, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (s *FlowService) CancelFlow(ctx context.Context, flowID string) error {
+	return s.withFlowLock(ctx, flowID, func(fs *FlowService) error {
+		return fs.cancel(ctx, flowID)
+	})
+}
+
+func (s *FlowService) cancel(ctx context.Context, flowID string) error {
 	flow, err := s.queries.GetFlowByID(ctx, flowID)
 	if err != nil {
-		return fmt.Errorf("flow not found: %w", err)
+		return lookupError("flow", err)
+	}
+	if flow.Status == string(model.FlowStatusArchived) {
+		return errFlowArchived
 	}
 
-	if err := s.queries.UpdateFlowStatus(ctx, flowID, string(model.FlowStatusCancelled)); err != nil {
+	if err := s.setStatus(ctx, flowID, flow.Status, model.FlowStatusCancelled, audit.ActionCancel); err != nil {
 		return fmt.Errorf("failed to cancel flow: %w", err)
 	}
 
+	_, suspended := flow.Cursor["suspend"]
+	_, ticking := flow.Cursor["tick"]
+	if suspended || ticking {
+		s.disarmTimeout(flow.Cursor)
+		s.disarmTick(flow.Cursor)
+		_ = s.queries.UpdateFlowCursor(ctx, flowID, flow.Cursor)
+	}
+
+	if err := s.cancelChildren(ctx, flowID); err != nil {
+		return err
+	}
+	s.childFinished(ctx, flow, "flow.cancelled", flow.Cursor)
+
 	// Cancel all open inquiries for this flow
 	// TODO: Implement query to get requests by flow_id and cancel them
 
-	_ = s.bus.PublishEntity(flow.OwnerEntity, map[string]interface{}{
-		"type":   "flow.updated",
-		"flowId": flowID,
-		"status": "CANCELLED",
-	})
+	_ = s.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowUpdated{
+		FlowID: flowID,
+		Status: "CANCELLED",
+	}))
 
 	return nil
 }
@@ -243,15 +386,23 @@ func (s *FlowService) UpdateFlowCursor(ctx context.Context, flowID string, curso
 }
 
 func dbFlowToModel(f db.Flow) *model.Flow {
-	return &model.Flow{
-		ID:          f.ID,
-		Kind:        f.Kind,
-		OwnerEntity: f.OwnerEntity,
-		Status:      model.FlowStatus(f.Status),
-		Cursor:      f.Cursor,
-		LastEventID: f.LastEventID,
-		CreatedAt:   f.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   f.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	flow := &model.Flow{
+		ID:           f.ID,
+		Kind:         f.Kind,
+		OwnerEntity:  f.OwnerEntity,
+		Status:       model.FlowStatus(f.Status),
+		Cursor:       f.Cursor,
+		LastEventID:  f.LastEventID,
+		ParentFlowID: f.ParentFlowID,
+		CreatedAt:    f.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:    f.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if f.ArchivedStatus != nil {
+		flow.ArchivedStatus = model.FlowStatus(*f.ArchivedStatus)
+	}
+	if f.ArchivedAt != nil {
+		flow.ArchivedAt = f.ArchivedAt.Format("2006-01-02T15:04:05Z07:00")
 	}
+	return flow
 }
 
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// errFlowArchived is returned for changes to an archived flow
+var errFlowArchived = &Error{Kind: ErrConflict, Code: "flow_closed", Message: "flow is archived"}
+
+// DeleteFlow soft-deletes a finished flow along with its sub-flows. Deleted
+// flows are no longer returned, listed, counted in stats or scanned; their
+// audit trail is kept. Open flows must be cancelled first.
+func (s *FlowService) DeleteFlow(ctx context.Context, id string) error {
+	return s.withFlowLock(ctx, id, func(fs *FlowService) error {
+		return fs.deleteFlow(ctx, id)
+	})
+}
+
+func (s *FlowService) deleteFlow(ctx context.Context, id string) error {
+	tree, err := s.GetFlowTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var flows []*model.Flow
+	var collect func(f *model.Flow)
+	collect = func(f *model.Flow) {
+		flows = append(flows, f)
+		for _, child := range f.Children {
+			collect(child)
+		}
+	}
+	collect(tree)
+
+	ids := make([]string, 0, len(flows))
+	for _, f := range flows {
+		status := f.Status
+		if status == model.FlowStatusArchived {
+			status = f.ArchivedStatus
+		}
+		if flowFinishedEvent(status) == "" {
+			return &Error{Kind: ErrConflict, Code: "flow_open",
+				Message: fmt.Sprintf("flow %s is %s; cancel it before deleting", f.ID, strings.ToLower(string(f.Status)))}
+		}
+		ids = append(ids, f.ID)
+	}
+
+	if err := s.queries.SoftDeleteFlows(ctx, ids); err != nil {
+		return fmt.Errorf("failed to delete flow: %w", err)
+	}
+	for _, f := range flows {
+		s.audit.Record(ctx, audit.Entry{
+			Action:       audit.ActionDelete,
+			ResourceType: audit.ResourceFlow,
+			ResourceID:   f.ID,
+			BeforeStatus: string(f.Status),
+			AfterStatus:  string(f.Status),
+		})
+	}
+	return nil
+}
+
+// ArchiveFinishedFlows archives up to limit flows that completed, were
+// cancelled or failed before the given time. It returns the number of flows
+// archived.
+func (s *FlowService) ArchiveFinishedFlows(ctx context.Context, before time.Time, limit int) (int, error) {
+	flows, err := s.queries.ArchiveFlows(ctx, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range flows {
+		entry := audit.Entry{
+			Actor:        audit.SystemActor,
+			Action:       audit.ActionArchive,
+			ResourceType: audit.ResourceFlow,
+			ResourceID:   f.ID,
+			AfterStatus:  f.Status,
+		}
+		if f.ArchivedStatus != nil {
+			entry.BeforeStatus = *f.ArchivedStatus
+		}
+		s.audit.Record(ctx, entry)
+	}
+	return len(flows), nil
+}
+
+// FlowArchiver periodically archives flows that finished longer ago than a
+// retention period, so the flows recovery and the ticker scan stay few
+type FlowArchiver struct {
+	flowSvc   *FlowService
+	after     time.Duration
+	interval  time.Duration
+	batchSize int
+	log       *zap.Logger
+}
+
+// NewFlowArchiver creates an archiver that scans every interval for flows
+// finished more than after ago
+func NewFlowArchiver(flowSvc *FlowService, after, interval time.Duration, batchSize int, log *zap.Logger) *FlowArchiver {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &FlowArchiver{
+		flowSvc:   flowSvc,
+		after:     after,
+		interval:  interval,
+		batchSize: batchSize,
+		log:       log,
+	}
+}
+
+// Run archives finished flows until ctx is cancelled
+func (a *FlowArchiver) Run(ctx context.Context) {
+	a.log.Info("Flow archiver started",
+		zap.Duration("after", a.after),
+		zap.Duration("interval", a.interval),
+	)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.archive(ctx)
+
+		select {
+		case <-ctx.Done():
+			a.log.Info("Flow archiver stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archive drains all due batches, stopping early on error or cancellation
+func (a *FlowArchiver) archive(ctx context.Context) {
+	start := time.Now()
+	before := start.Add(-a.after)
+	total := 0
+	for ctx.Err() == nil {
+		n, err := a.flowSvc.ArchiveFinishedFlows(ctx, before, a.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.log.Error("Flow archiving failed", zap.Error(err))
+			}
+			break
+		}
+		total += n
+		if n < a.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		a.log.Info("Archived flows", zap.Int("count", total), zap.Duration("duration", time.Since(start)))
+	}
+}
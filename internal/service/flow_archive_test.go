@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archiveQueries keeps flows in memory for deleting and archiving
+type archiveQueries struct {
+	db.Querier
+	flows   map[string]db.Flow
+	deleted map[string]bool
+}
+
+func (q *archiveQueries) InTx(ctx context.Context, fn func(db.Querier) error) error {
+	return fn(q)
+}
+
+func (q *archiveQueries) LockFlow(ctx context.Context, id string) error { return nil }
+
+func (q *archiveQueries) GetFlowByID(ctx context.Context, id string) (db.Flow, error) {
+	f, ok := q.flows[id]
+	if !ok || q.deleted[id] {
+		return db.Flow{}, pgx.ErrNoRows
+	}
+	return f, nil
+}
+
+func (q *archiveQueries) ListChildFlows(ctx context.Context, parentID string) ([]db.Flow, error) {
+	var children []db.Flow
+	for _, f := range q.flows {
+		if f.ParentFlowID != nil && *f.ParentFlowID == parentID && !q.deleted[f.ID] {
+			children = append(children, f)
+		}
+	}
+	return children, nil
+}
+
+func (q *archiveQueries) SoftDeleteFlows(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		q.deleted[id] = true
+	}
+	return nil
+}
+
+func (q *archiveQueries) ArchiveFlows(ctx context.Context, finishedBefore time.Time, limit int) ([]db.Flow, error) {
+	var archived []db.Flow
+	for id, f := range q.flows {
+		if flowFinishedEvent(model.FlowStatus(f.Status)) == "" || !f.UpdatedAt.Before(finishedBefore) || len(archived) == limit {
+			continue
+		}
+		status := f.Status
+		f.ArchivedStatus = &status
+		f.Status = string(model.FlowStatusArchived)
+		q.flows[id] = f
+		archived = append(archived, f)
+	}
+	return archived, nil
+}
+
+func TestDeleteFlow(t *testing.T) {
+	parentID := "parent"
+	q := &archiveQueries{
+		flows: map[string]db.Flow{
+			"parent": {ID: "parent", Status: string(model.FlowStatusCompleted)},
+			"child":  {ID: "child", Status: string(model.FlowStatusRunning), ParentFlowID: &parentID},
+		},
+		deleted: map[string]bool{},
+	}
+	s := &FlowService{queries: q, bus: &deferredBus{}}
+	ctx := context.Background()
+
+	// An open sub-flow keeps the tree from being deleted
+	err := s.DeleteFlow(ctx, "parent")
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Equal(t, "flow_open", Classify(err).Code)
+	assert.Empty(t, q.deleted)
+
+	child := q.flows["child"]
+	child.Status = string(model.FlowStatusCancelled)
+	q.flows["child"] = child
+	require.NoError(t, s.DeleteFlow(ctx, "parent"))
+	assert.Equal(t, map[string]bool{"parent": true, "child": true}, q.deleted)
+
+	_, err = s.GetFlow(ctx, "parent")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.DeleteFlow(ctx, "parent"), ErrNotFound)
+}
+
+func TestArchiveFinishedFlows(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	q := &archiveQueries{
+		flows: map[string]db.Flow{
+			"done":    {ID: "done", Status: string(model.FlowStatusFailed), UpdatedAt: old},
+			"recent":  {ID: "recent", Status: string(model.FlowStatusCompleted), UpdatedAt: time.Now()},
+			"running": {ID: "running", Status: string(model.FlowStatusRunning), UpdatedAt: old},
+		},
+		deleted: map[string]bool{},
+	}
+	s := &FlowService{queries: q, bus: &deferredBus{}}
+	ctx := context.Background()
+
+	n, err := s.ArchiveFinishedFlows(ctx, time.Now().Add(-24*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	flow, err := s.GetFlow(ctx, "done")
+	require.NoError(t, err)
+	assert.Equal(t, model.FlowStatusArchived, flow.Status)
+	assert.Equal(t, model.FlowStatusFailed, flow.ArchivedStatus)
+	assert.Equal(t, model.FlowStatusFailed, finalStatus(q.flows["done"]))
+
+	// Archived flows are closed for good
+	assert.ErrorIs(t, s.CancelFlow(ctx, "done"), ErrConflict)
+	_, err = s.ResumeFlowEvent(ctx, "done", "", "poke", nil)
+	assert.Equal(t, "flow_closed", Classify(err).Code)
+	require.NoError(t, s.DeleteFlow(ctx, "done"))
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxFlowTreeDepth bounds how many levels of sub-flows GetFlowTree loads
+const maxFlowTreeDepth = 10
+
+// flowFinishedEvent returns the event a parent is resumed with when a child
+// flow reaches status, or "" while the child is still open
+func flowFinishedEvent(status model.FlowStatus) string {
+	switch status {
+	case model.FlowStatusCompleted:
+		return "flow.completed"
+	case model.FlowStatusFailed:
+		return "flow.failed"
+	case model.FlowStatusCancelled:
+		return "flow.cancelled"
+	}
+	return ""
+}
+
+// finalStatus is the status of a flow, or for an archived flow the status
+// it finished with
+func finalStatus(f db.Flow) model.FlowStatus {
+	if f.Status == string(model.FlowStatusArchived) && f.ArchivedStatus != nil {
+		return model.FlowStatus(*f.ArchivedStatus)
+	}
+	return model.FlowStatus(f.Status)
+}
+
+// GetFlowTree returns a flow with its sub-flows nested under children
+func (s *FlowService) GetFlowTree(ctx context.Context, id string) (*model.Flow, error) {
+	flow, err := s.GetFlow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadChildren(ctx, flow, maxFlowTreeDepth); err != nil {
+		return nil, err
+	}
+	return flow, nil
+}
+
+func (s *FlowService) loadChildren(ctx context.Context, flow *model.Flow, depth int) error {
+	if depth == 0 {
+		return nil
+	}
+	children, err := s.queries.ListChildFlows(ctx, flow.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list child flows: %w", err)
+	}
+	flow.Children = make([]*model.Flow, 0, len(children))
+	for _, c := range children {
+		child := dbFlowToModel(c)
+		if err := s.loadChildren(ctx, child, depth-1); err != nil {
+			return err
+		}
+		flow.Children = append(flow.Children, child)
+	}
+	return nil
+}
+
+// childFinished resumes the parent of a flow that just finished, once the
+// child's step has committed. The parent is resumed with event (e.g.
+// "flow.completed") and the child's ID, kind and the "result" of its cursor.
+func (s *FlowService) childFinished(ctx context.Context, child db.Flow, event string, cursor map[string]interface{}) {
+	if child.ParentFlowID == nil {
+		return
+	}
+	parentID := *child.ParentFlowID
+	data := childEventData(child, cursor)
+	s.afterCommit(func(s *FlowService) {
+		_ = s.resumeParent(ctx, parentID, child.ID, event, data)
+	})
+}
+
+func childEventData(child db.Flow, cursor map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{
+		"flowId": child.ID,
+		"kind":   child.Kind,
+	}
+	if result, ok := cursor["result"]; ok {
+		data["result"] = result
+	}
+	return data
+}
+
+// resumeParent resumes a suspended parent flow about a finished child. The
+// event ID includes the child, so each child resumes its parent only once.
+func (s *FlowService) resumeParent(ctx context.Context, parentID, childID, event string, data map[string]interface{}) error {
+	var stepErr error
+	err := s.withFlowLock(ctx, parentID, func(fs *FlowService) error {
+		parent, err := fs.queries.GetFlowByID(ctx, parentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get parent flow: %w", err)
+		}
+		eventID := event + ":" + childID
+		if parent.Status != string(model.FlowStatusSuspended) || (parent.LastEventID != nil && *parent.LastEventID == eventID) {
+			return nil
+		}
+		stepErr, err = fs.resume(ctx, parent, eventID, event, data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return stepErr
+}
+
+// cancelChildren cancels the open sub-flows of a cancelled flow, and in turn
+// theirs, once the parent's cancellation has committed
+func (s *FlowService) cancelChildren(ctx context.Context, flowID string) error {
+	children, err := s.queries.ListChildFlows(ctx, flowID)
+	if err != nil {
+		return fmt.Errorf("failed to list child flows: %w", err)
+	}
+	for _, c := range children {
+		if flowFinishedEvent(finalStatus(c)) != "" {
+			continue
+		}
+		childID := c.ID
+		s.afterCommit(func(s *FlowService) {
+			_ = s.CancelFlow(ctx, childID)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowFinishedEvent(t *testing.T) {
+	assert.Equal(t, "flow.completed", flowFinishedEvent(model.FlowStatusCompleted))
+	assert.Equal(t, "flow.failed", flowFinishedEvent(model.FlowStatusFailed))
+	assert.Equal(t, "flow.cancelled", flowFinishedEvent(model.FlowStatusCancelled))
+	assert.Empty(t, flowFinishedEvent(model.FlowStatusRunning))
+	assert.Empty(t, flowFinishedEvent(model.FlowStatusSuspended))
+}
+
+func TestChildFinishedWaitsForCommit(t *testing.T) {
+	bus := &deferredBus{}
+	s := &FlowService{bus: bus}
+	parentID := "parent-1"
+	child := db.Flow{ID: "child-1", Kind: "collect-documents", ParentFlowID: &parentID}
+
+	s.childFinished(context.Background(), child, "flow.completed", map[string]interface{}{"result": "ok"})
+	assert.Len(t, bus.after, 1)
+
+	// Flows without a parent have nobody to resume
+	s.childFinished(context.Background(), db.Flow{ID: "orphan"}, "flow.completed", nil)
+	assert.Len(t, bus.after, 1)
+
+	data := childEventData(child, map[string]interface{}{"result": "ok", "step": "done"})
+	assert.Equal(t, map[string]interface{}{"flowId": "child-1", "kind": "collect-documents", "result": "ok"}, data)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+)
+
+// FlowPage is one page of ListFlows
+type FlowPage struct {
+	Items      []*model.Flow  `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"` // Empty on the last page
+	Counts     map[string]int `json:"counts"`               // Matching flows per status, ignoring the status filter
+}
+
+// ListFlows returns the flows matching f, newest first. cursor is the
+// nextCursor of the previous page, or empty for the first page.
+func (s *FlowService) ListFlows(ctx context.Context, f db.FlowFilter, cursor string, limit int) (*FlowPage, error) {
+	if f.Status != nil && !model.FlowStatus(*f.Status).Valid() {
+		return nil, invalid("invalid_filter", "unknown flow status "+*f.Status, nil)
+	}
+	var after *db.Flow
+	if cursor != "" {
+		var err error
+		if after, err = decodeFlowCursor(cursor); err != nil {
+			return nil, invalid("invalid_cursor", "invalid cursor", err)
+		}
+	}
+
+	flows, err := s.queries.ListFlows(ctx, f, after, limit+1)
+	if err != nil {
+		return nil, flowListError(err)
+	}
+	counts, err := s.queries.CountFlowsByStatus(ctx, f)
+	if err != nil {
+		return nil, flowListError(err)
+	}
+
+	page := &FlowPage{Items: make([]*model.Flow, 0, len(flows)), Counts: counts}
+	if len(flows) > limit {
+		flows = flows[:limit]
+		page.NextCursor = encodeFlowCursor(flows[limit-1])
+	}
+	for _, flow := range flows {
+		page.Items = append(page.Items, dbFlowToModel(flow))
+	}
+	return page, nil
+}
+
+func flowListError(err error) error {
+	if db.IsInvalidText(err) {
+		return invalid("invalid_filter", "malformed ownerEntity or cursor", err)
+	}
+	return fmt.Errorf("failed to list flows: %w", err)
+}
+
+// encodeFlowCursor returns an opaque cursor pointing after flow
+func encodeFlowCursor(flow db.Flow) string {
+	raw := flow.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + flow.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFlowCursor(cursor string) (*db.Flow, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	return &db.Flow{ID: id, CreatedAt: t}, nil
+}
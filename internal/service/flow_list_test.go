@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowCursorRoundTrip(t *testing.T) {
+	flow := db.Flow{ID: "0b6f9a7e-3c1d-4e55-9a0b-1f2e3d4c5b6a", CreatedAt: time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC)}
+
+	after, err := decodeFlowCursor(encodeFlowCursor(flow))
+	require.NoError(t, err)
+	assert.Equal(t, flow.ID, after.ID)
+	assert.True(t, flow.CreatedAt.Equal(after.CreatedAt))
+
+	_, err = decodeFlowCursor("not a cursor")
+	assert.Error(t, err)
+}
+
+func TestListFlowsRejectsBadInput(t *testing.T) {
+	s := &FlowService{}
+	status := "STUCK"
+	_, err := s.ListFlows(context.Background(), db.FlowFilter{Status: &status}, "", 10)
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	_, err = s.ListFlows(context.Background(), db.FlowFilter{}, "!!", 10)
+	assert.True(t, errors.Is(err, ErrValidation))
+}
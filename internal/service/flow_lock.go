@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"pxbox/internal/db"
+)
+
+// withFlowLock runs fn in a transaction holding the flow's advisory lock, so
+// steps of one flow never interleave, whether they come from the API, the
+// ticker, recovery or a timeout job on another instance. fn gets a copy of
+// the service bound to the transaction whose events are only published
+// once it commits.
+func (s *FlowService) withFlowLock(ctx context.Context, flowID string, fn func(*FlowService) error) error {
+	bus := &deferredBus{}
+	err := s.queries.InTx(ctx, func(q db.Querier) error {
+		if err := q.LockFlow(ctx, flowID); err != nil {
+			return fmt.Errorf("failed to lock flow: %w", err)
+		}
+		locked := *s
+		locked.queries = q
+		locked.bus = bus
+		return fn(&locked)
+	})
+	if err != nil {
+		return err
+	}
+	bus.flush(s.bus)
+	for _, fn := range bus.after {
+		fn(s)
+	}
+	return nil
+}
+
+// afterCommit runs fn once the flow transaction the service is bound to
+// commits, passing the service outside the transaction. Work that locks
+// other flows goes here, so two flow locks are never held at once. Outside
+// withFlowLock, fn runs right away.
+func (s *FlowService) afterCommit(fn func(*FlowService)) {
+	if b, ok := s.bus.(*deferredBus); ok {
+		b.after = append(b.after, fn)
+		return
+	}
+	fn(s)
+}
+
+// deferredBus holds events until flush, and the work to run after commit
+type deferredBus struct {
+	events []func(EventBus)
+	after  []func(*FlowService)
+}
+
+func (b *deferredBus) PublishEntity(entityID string, event map[string]interface{}) error {
+	b.events = append(b.events, func(bus EventBus) { _ = bus.PublishEntity(entityID, event) })
+	return nil
+}
+
+func (b *deferredBus) PublishRequest(requestID string, event map[string]interface{}) error {
+	b.events = append(b.events, func(bus EventBus) { _ = bus.PublishRequest(requestID, event) })
+	return nil
+}
+
+func (b *deferredBus) PublishRequestor(clientID string, event map[string]interface{}) error {
+	b.events = append(b.events, func(bus EventBus) { _ = bus.PublishRequestor(clientID, event) })
+	return nil
+}
+
+func (b *deferredBus) flush(bus EventBus) {
+	for _, publish := range b.events {
+		publish(bus)
+	}
+	b.events = nil
+}
@@ -3,100 +3,316 @@ package service
 import (
 	"context"
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
+	"pxbox/internal/db"
 	"pxbox/internal/model"
 	"go.uber.org/zap"
 )
 
-// RecoverFlows recovers suspended/running flows on application start
-func (s *FlowService) RecoverFlows(ctx context.Context, log *zap.Logger) error {
-	// Get all running and suspended flows
-	flows, err := s.queries.GetFlowsByStatus(ctx, []string{
+// Recovery modes, chosen with FLOW_RECOVERY
+const (
+	RecoveryInAPI    = "api"    // The API server recovers in the background after it starts
+	RecoveryInWorker = "worker" // A worker recovers when it starts
+	RecoveryOff      = "off"    // Only the worker's flow ticker advances flows
+)
+
+// RecoveryCheckpoint stores how far a recovery got, so one that was
+// interrupted by a restart continues where it stopped instead of starting
+// over. Load reports false when nothing is stored.
+type RecoveryCheckpoint interface {
+	Load(ctx context.Context, v interface{}) (bool, error)
+	Save(ctx context.Context, v interface{}) error
+	Clear(ctx context.Context) error
+}
+
+// RecoveryLease lets one instance at a time run a task, such as a
+// leader.Elector. TryLead runs fn if the lease is free and reports whether
+// it ran.
+type RecoveryLease interface {
+	TryLead(ctx context.Context, fn func(ctx context.Context)) (bool, error)
+}
+
+// RecoveryOptions control how RecoverFlows scans and advances flows
+type RecoveryOptions struct {
+	Mode       string             // Which process recovers; see RecoveryInAPI
+	BatchSize  int                // Flows loaded per page
+	Rate       float64            // Flows advanced per second; 0 is unlimited
+	Checkpoint RecoveryCheckpoint // Optional; progress is not kept without it
+}
+
+// RecoveryOptionsFromEnv reads FLOW_RECOVERY (default "api"),
+// FLOW_RECOVERY_BATCH (default 100) and FLOW_RECOVERY_RATE (default 50
+// flows per second, 0 for unlimited)
+func RecoveryOptionsFromEnv() (RecoveryOptions, error) {
+	opts := RecoveryOptions{Mode: RecoveryInAPI, BatchSize: 100, Rate: 50}
+	switch v := os.Getenv("FLOW_RECOVERY"); v {
+	case "":
+	case RecoveryInAPI, RecoveryInWorker, RecoveryOff:
+		opts.Mode = v
+	default:
+		return opts, fmt.Errorf("invalid FLOW_RECOVERY %q", v)
+	}
+	if v := os.Getenv("FLOW_RECOVERY_BATCH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid FLOW_RECOVERY_BATCH %q", v)
+		}
+		opts.BatchSize = n
+	}
+	if v := os.Getenv("FLOW_RECOVERY_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 {
+			return opts, fmt.Errorf("invalid FLOW_RECOVERY_RATE %q", v)
+		}
+		opts.Rate = rate
+	}
+	return opts, nil
+}
+
+// recoveryPosition is the checkpoint of a recovery in progress
+type recoveryPosition struct {
+	// Cutoff is when the recovery started; flows updated since are making
+	// progress on their own and are skipped
+	Cutoff    time.Time `json:"cutoff"`
+	UpdatedAt time.Time `json:"updatedAt"` // Last flow of the last finished page
+	ID        string    `json:"id"`
+}
+
+// RecoverFlows advances the running and suspended flows left behind by a
+// restart. Flows are loaded in pages, oldest first, and advanced no faster
+// than opts.Rate; after each page the position is saved to opts.Checkpoint,
+// and a recovery finding a saved position continues from it. It returns the
+// number of flows advanced.
+func (s *FlowService) RecoverFlows(ctx context.Context, opts RecoveryOptions, log *zap.Logger) (int, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	statuses := []string{
 		string(model.FlowStatusRunning),
 		string(model.FlowStatusSuspended),
+	}
+
+	pos := recoveryPosition{Cutoff: time.Now()}
+	var after *db.Flow
+	if opts.Checkpoint != nil {
+		var saved recoveryPosition
+		ok, err := opts.Checkpoint.Load(ctx, &saved)
+		if err != nil {
+			log.Warn("Failed to load flow recovery checkpoint; starting over", zap.Error(err))
+		} else if ok {
+			pos = saved
+			after = &db.Flow{ID: saved.ID, UpdatedAt: saved.UpdatedAt}
+			log.Info("Resuming flow recovery", zap.Time("cutoff", pos.Cutoff), zap.String("after", pos.ID))
+		}
+	}
+
+	var limit <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	start := time.Now()
+	recovered := 0
+	for {
+		flows, err := s.queries.GetStaleFlows(ctx, statuses, pos.Cutoff, after, opts.BatchSize)
+		if err != nil {
+			return recovered, fmt.Errorf("failed to get flows: %w", err)
+		}
+
+		for _, flow := range flows {
+			if limit != nil {
+				select {
+				case <-ctx.Done():
+				case <-limit:
+				}
+			}
+			if ctx.Err() != nil {
+				return recovered, ctx.Err()
+			}
+			s.advanceFlow(ctx, dbFlowToModel(flow), log)
+			recovered++
+		}
+
+		if len(flows) < opts.BatchSize {
+			break
+		}
+		after = &flows[len(flows)-1]
+		if opts.Checkpoint != nil {
+			pos.UpdatedAt, pos.ID = after.UpdatedAt, after.ID
+			if err := opts.Checkpoint.Save(ctx, pos); err != nil {
+				log.Warn("Failed to save flow recovery checkpoint", zap.Error(err))
+			}
+		}
+	}
+
+	if opts.Checkpoint != nil {
+		if err := opts.Checkpoint.Clear(ctx); err != nil {
+			log.Warn("Failed to clear flow recovery checkpoint", zap.Error(err))
+		}
+	}
+	log.Info("Recovered flows", zap.Int("count", recovered), zap.Duration("duration", time.Since(start)))
+	return recovered, nil
+}
+
+// RecoverFlowsLeased runs RecoverFlows while holding lease, so only one
+// instance recovers at a time; instances that find the lease taken skip
+// recovery. Failures are logged, as recovery runs in the background.
+func (s *FlowService) RecoverFlowsLeased(ctx context.Context, lease RecoveryLease, opts RecoveryOptions, log *zap.Logger) {
+	ran, err := lease.TryLead(ctx, func(ctx context.Context) {
+		if _, err := s.RecoverFlows(ctx, opts, log); err != nil && ctx.Err() == nil {
+			log.Warn("Failed to recover flows", zap.Error(err))
+		}
 	})
 	if err != nil {
-		return fmt.Errorf("failed to get flows: %w", err)
+		log.Warn("Failed to start flow recovery", zap.Error(err))
+	} else if !ran {
+		log.Info("Flow recovery is already running on another instance")
 	}
+}
 
-	log.Info("Recovering flows", zap.Int("count", len(flows)))
-
-	for _, flow := range flows {
-		flowModel := dbFlowToModel(flow)
-		
-		// Check if flow is waiting for a request that has been answered
-		if flowModel.Status == model.FlowStatusSuspended {
-			// Check pending requests in cursor
-			pending, _ := flowModel.Cursor["pending"].([]interface{})
-			if pending != nil {
-				allAnswered := true
-				for _, p := range pending {
-					reqData, _ := p.(map[string]interface{})
-					requestID, _ := reqData["requestId"].(string)
-					if requestID == "" {
-						continue
-					}
+// TickDueFlows advances running/suspended flows that have been neither
+// updated nor checked since staleAfter, so flows whose resume event was
+// missed still make progress. Each scanned flow is marked checked, so a flow
+// still waiting for its request is looked at again only once staleAfter has
+// passed, not on every tick. Flows are scanned in pages of batchSize. It
+// returns the number of flows scanned.
+func (s *FlowService) TickDueFlows(ctx context.Context, staleAfter time.Duration, batchSize int, log *zap.Logger) (int, error) {
+	before := time.Now().Add(-staleAfter)
+
+	scanned := 0
+	var after *db.Flow
+	for {
+		flows, err := s.queries.GetDueFlows(ctx, before, after, batchSize)
+		if err != nil {
+			return scanned, fmt.Errorf("failed to get due flows: %w", err)
+		}
 
-					// Check request status
-					req, err := s.requestSvc.GetRequest(ctx, requestID)
+		ids := make([]string, 0, len(flows))
+		for _, flow := range flows {
+			if ctx.Err() != nil {
+				return scanned, ctx.Err()
+			}
+			s.advanceFlow(ctx, dbFlowToModel(flow), log)
+			ids = append(ids, flow.ID)
+			scanned++
+		}
+		if err := s.queries.MarkFlowsChecked(ctx, ids); err != nil {
+			return scanned, fmt.Errorf("failed to mark flows checked: %w", err)
+		}
+
+		if len(flows) < batchSize {
+			return scanned, nil
+		}
+		after = &flows[len(flows)-1]
+	}
+}
+
+// advanceFlow resumes a suspended flow whose awaited request has been
+// answered, or ticks a running flow
+func (s *FlowService) advanceFlow(ctx context.Context, flowModel *model.Flow, log *zap.Logger) {
+	// Check if flow is waiting for a request that has been answered
+	if flowModel.Status == model.FlowStatusSuspended {
+		// Check pending requests in cursor
+		pending, _ := flowModel.Cursor["pending"].([]interface{})
+		if pending != nil {
+			allAnswered := true
+			for _, p := range pending {
+				reqData, _ := p.(map[string]interface{})
+				if childID, _ := reqData["flowId"].(string); childID != "" {
+					// Waiting for a child flow whose completion may have been missed
+					child, err := s.queries.GetFlowByID(ctx, childID)
 					if err != nil {
-						log.Warn("Failed to get request during recovery",
+						log.Warn("Failed to get child flow during recovery",
 							zap.String("flowId", flowModel.ID),
-							zap.String("requestId", requestID),
+							zap.String("childFlowId", childID),
 							zap.Error(err),
 						)
 						allAnswered = false
 						continue
 					}
-
-					if req.Status == model.StatusAnswered {
-						// Request was answered, resume flow with response data
-						// Get response
-						// Note: We'd need to get the response, but for now we'll just resume
-						// The actual response data should be in the lastEvent
-						if err := s.ResumeFlow(ctx, flowModel.ID, "request.answered", map[string]interface{}{
-							"requestId": requestID,
-						}); err != nil {
-							log.Error("Failed to resume flow after recovery",
-								zap.String("flowId", flowModel.ID),
-								zap.String("requestId", requestID),
-								zap.Error(err),
-							)
-						} else {
-							log.Info("Resumed flow after recovery",
-								zap.String("flowId", flowModel.ID),
-								zap.String("requestId", requestID),
-							)
-						}
-						allAnswered = false // Don't process other requests
-						break
-					} else if req.Status == model.StatusPending || req.Status == model.StatusClaimed {
+					event := flowFinishedEvent(finalStatus(child))
+					if event == "" {
 						allAnswered = false
+						continue
 					}
+					if err := s.resumeParent(ctx, flowModel.ID, childID, event, childEventData(child, child.Cursor)); err != nil {
+						log.Error("Failed to resume parent flow after recovery",
+							zap.String("flowId", flowModel.ID),
+							zap.String("childFlowId", childID),
+							zap.Error(err),
+						)
+					}
+					allAnswered = false
+					break
+				}
+				requestID, _ := reqData["requestId"].(string)
+				if requestID == "" {
+					continue
+				}
+
+				// Check request status
+				req, err := s.requestSvc.GetRequest(ctx, requestID)
+				if err != nil {
+					log.Warn("Failed to get request during recovery",
+						zap.String("flowId", flowModel.ID),
+						zap.String("requestId", requestID),
+						zap.Error(err),
+					)
+					allAnswered = false
+					continue
 				}
 
-				if allAnswered {
-					// All pending requests are answered or cancelled
-					// Try to tick the flow
-					if err := s.TickFlow(ctx, flowModel.ID); err != nil {
-						log.Error("Failed to tick flow during recovery",
+				if req.Status.IsAnswered() {
+					// Request was answered, resume flow with response data
+					// Get response
+					// Note: We'd need to get the response, but for now we'll just resume
+					// The actual response data should be in the lastEvent
+					// Recovery and the ticker may both see the answer; the
+					// event ID makes sure it advances the flow only once
+					if _, err := s.ResumeFlowEvent(ctx, flowModel.ID, "request.answered:"+requestID, "request.answered", map[string]interface{}{
+						"requestId": requestID,
+					}); err != nil {
+						log.Error("Failed to resume flow after recovery",
 							zap.String("flowId", flowModel.ID),
+							zap.String("requestId", requestID),
 							zap.Error(err),
 						)
+					} else {
+						log.Info("Resumed flow after recovery",
+							zap.String("flowId", flowModel.ID),
+							zap.String("requestId", requestID),
+						)
 					}
+					allAnswered = false // Don't process other requests
+					break
+				} else if req.Status == model.StatusPending || req.Status == model.StatusClaimed {
+					allAnswered = false
 				}
 			}
-		} else if flowModel.Status == model.FlowStatusRunning {
-			// Try to tick running flows
-			if err := s.TickFlow(ctx, flowModel.ID); err != nil {
-				log.Error("Failed to tick flow during recovery",
-					zap.String("flowId", flowModel.ID),
-					zap.Error(err),
-				)
+
+			if allAnswered {
+				// All pending requests are answered or cancelled
+				// Try to tick the flow
+				if err := s.TickFlow(ctx, flowModel.ID); err != nil {
+					log.Error("Failed to tick flow during recovery",
+						zap.String("flowId", flowModel.ID),
+						zap.Error(err),
+					)
+				}
 			}
 		}
+	} else if flowModel.Status == model.FlowStatusRunning {
+		// Try to tick running flows
+		if err := s.TickFlow(ctx, flowModel.ID); err != nil {
+			log.Error("Failed to tick flow during recovery",
+				zap.String("flowId", flowModel.ID),
+				zap.Error(err),
+			)
+		}
 	}
-
-	return nil
 }
-
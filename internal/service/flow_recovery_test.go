@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// recoveryQueries pages through flows in memory like GetStaleFlows does
+type recoveryQueries struct {
+	db.Querier
+	flows []db.Flow
+	pages int
+}
+
+func (q *recoveryQueries) GetStaleFlows(ctx context.Context, statuses []string, updatedBefore time.Time, after *db.Flow, limit int) ([]db.Flow, error) {
+	q.pages++
+	sort.Slice(q.flows, func(i, j int) bool { return q.flows[i].UpdatedAt.Before(q.flows[j].UpdatedAt) })
+	var page []db.Flow
+	for _, f := range q.flows {
+		if !f.UpdatedAt.Before(updatedBefore) || (after != nil && !f.UpdatedAt.After(after.UpdatedAt)) {
+			continue
+		}
+		for _, status := range statuses {
+			if f.Status == status && len(page) < limit {
+				page = append(page, f)
+			}
+		}
+	}
+	return page, nil
+}
+
+// memCheckpoint keeps a recovery checkpoint in memory
+type memCheckpoint struct {
+	saved []byte
+	saves int
+}
+
+func (c *memCheckpoint) Load(ctx context.Context, v interface{}) (bool, error) {
+	if c.saved == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(c.saved, v)
+}
+
+func (c *memCheckpoint) Save(ctx context.Context, v interface{}) error {
+	c.saves++
+	b, err := json.Marshal(v)
+	c.saved = b
+	return err
+}
+
+func (c *memCheckpoint) Clear(ctx context.Context) error {
+	c.saved = nil
+	return nil
+}
+
+func TestRecoverFlows(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	q := &recoveryQueries{}
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		q.flows = append(q.flows, db.Flow{ID: id, Status: string(model.FlowStatusSuspended), UpdatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	q.flows = append(q.flows,
+		db.Flow{ID: "done", Status: string(model.FlowStatusCompleted), UpdatedAt: base},
+		db.Flow{ID: "live", Status: string(model.FlowStatusRunning), UpdatedAt: time.Now().Add(time.Hour)},
+	)
+	s := &FlowService{queries: q, bus: &deferredBus{}}
+	ctx := context.Background()
+	checkpoint := &memCheckpoint{}
+
+	n, err := s.RecoverFlows(ctx, RecoveryOptions{BatchSize: 2, Checkpoint: checkpoint}, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, 3, q.pages)
+	assert.Equal(t, 2, checkpoint.saves)
+	assert.Nil(t, checkpoint.saved, "a finished recovery clears its checkpoint")
+
+	// An interrupted recovery continues after the last finished page
+	require.NoError(t, checkpoint.Save(ctx, recoveryPosition{Cutoff: time.Now(), UpdatedAt: q.flows[3].UpdatedAt, ID: q.flows[3].ID}))
+	n, err = s.RecoverFlows(ctx, RecoveryOptions{BatchSize: 2, Checkpoint: checkpoint}, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Rate limiting waits between flows and gives up when cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	n, err = s.RecoverFlows(cancelled, RecoveryOptions{BatchSize: 2, Rate: 0.001}, zap.NewNop())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, n)
+}
+
+// fakeLease leads when free is set
+type fakeLease struct {
+	free bool
+}
+
+func (l *fakeLease) TryLead(ctx context.Context, fn func(ctx context.Context)) (bool, error) {
+	if !l.free {
+		return false, nil
+	}
+	fn(ctx)
+	return true, nil
+}
+
+func TestRecoverFlowsLeased(t *testing.T) {
+	q := &recoveryQueries{flows: []db.Flow{{ID: "a", Status: string(model.FlowStatusSuspended), UpdatedAt: time.Now().Add(-time.Hour)}}}
+	s := &FlowService{queries: q, bus: &deferredBus{}}
+	opts := RecoveryOptions{BatchSize: 10}
+
+	// Another instance holds the lease
+	s.RecoverFlowsLeased(context.Background(), &fakeLease{}, opts, zap.NewNop())
+	assert.Equal(t, 0, q.pages)
+
+	s.RecoverFlowsLeased(context.Background(), &fakeLease{free: true}, opts, zap.NewNop())
+	assert.Equal(t, 1, q.pages)
+}
+
+func TestRecoveryOptionsFromEnv(t *testing.T) {
+	opts, err := RecoveryOptionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, RecoveryOptions{Mode: RecoveryInAPI, BatchSize: 100, Rate: 50}, opts)
+
+	t.Setenv("FLOW_RECOVERY", "worker")
+	t.Setenv("FLOW_RECOVERY_BATCH", "20")
+	t.Setenv("FLOW_RECOVERY_RATE", "0")
+	opts, err = RecoveryOptionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, RecoveryOptions{Mode: RecoveryInWorker, BatchSize: 20}, opts)
+
+	t.Setenv("FLOW_RECOVERY", "always")
+	_, err = RecoveryOptionsFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flowQueries holds one flow; other db.Querier methods are not used by the
+// checks before a flow resumes
+type flowQueries struct {
+	db.Querier
+	flow   db.Flow
+	locked bool
+}
+
+func (q *flowQueries) InTx(ctx context.Context, fn func(db.Querier) error) error {
+	return fn(q)
+}
+
+func (q *flowQueries) LockFlow(ctx context.Context, id string) error {
+	q.locked = true
+	return nil
+}
+
+func (q *flowQueries) GetFlowByID(ctx context.Context, id string) (db.Flow, error) {
+	if !q.locked {
+		panic("flow read before it was locked")
+	}
+	return q.flow, nil
+}
+
+func TestResumeFinishedFlow(t *testing.T) {
+	for _, status := range []model.FlowStatus{
+		model.FlowStatusCompleted,
+		model.FlowStatusCancelled,
+		model.FlowStatusFailed,
+		model.FlowStatusWaitingInput,
+		model.FlowStatusArchived,
+	} {
+		q := &flowQueries{flow: db.Flow{ID: "flow-1", Status: string(status)}}
+		s := &FlowService{queries: q, bus: &deferredBus{}}
+		applied, err := s.ResumeFlowEvent(context.Background(), "flow-1", "event-1", "request.answered", nil)
+		assert.False(t, applied, status)
+		assert.ErrorIs(t, err, ErrConflict, status)
+		assert.Equal(t, "flow_closed", Classify(err).Code, status)
+	}
+
+	// A redelivered event is ignored whatever the flow became
+	eventID := "event-1"
+	q := &flowQueries{flow: db.Flow{ID: "flow-1", Status: string(model.FlowStatusCompleted), LastEventID: &eventID}}
+	s := &FlowService{queries: q, bus: &deferredBus{}}
+	applied, err := s.ResumeFlowEvent(context.Background(), "flow-1", eventID, "request.answered", nil)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+}
+
+func TestResumable(t *testing.T) {
+	assert.NoError(t, resumable(string(model.FlowStatusRunning)))
+	assert.NoError(t, resumable(string(model.FlowStatusSuspended)))
+	assert.Equal(t, "flow is completed", Classify(resumable(string(model.FlowStatusCompleted))).Message)
+	assert.Equal(t, errFlowArchived, resumable(string(model.FlowStatusArchived)))
+}
@@ -20,6 +20,7 @@ type StepResult struct {
 type Suspend struct {
 	Event      string     `json:"event"`       // Event type to wait for (e.g., "request.answered")
 	RequestID  *string    `json:"requestId,omitempty"` // Specific request to wait for
+	FlowID     *string    `json:"flowId,omitempty"`    // Child flow to wait for
 	DeadlineAt *time.Time `json:"deadlineAt,omitempty"` // Optional deadline
 	OnTimeout  string     `json:"onTimeout,omitempty"`  // Label/branch for timeout handling
 }
@@ -122,6 +123,41 @@ func (r *BasicFlowRunner) AwaitInput(ctx context.Context, flow *model.Flow, inpu
 	return req, suspend, nil
 }
 
+// SpawnChild creates a sub-flow of flow and suspends flow until the child
+// completes, fails or is cancelled; it is then resumed with a
+// "flow.completed", "flow.failed" or "flow.cancelled" event whose data holds
+// the child's flowId, kind and the "result" of its cursor. The child is
+// owned by the parent's owner unless input says otherwise.
+func (r *BasicFlowRunner) SpawnChild(ctx context.Context, flow *model.Flow, input CreateFlowInput) (*model.Flow, *Suspend, error) {
+	input.ParentFlowID = flow.ID
+	if input.OwnerEntity == "" {
+		input.OwnerEntity = flow.OwnerEntity
+	}
+
+	child, err := r.flowSvc.CreateFlow(ctx, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create child flow: %w", err)
+	}
+
+	suspend := &Suspend{
+		Event:  "flow.completed",
+		FlowID: &child.ID,
+	}
+
+	if flow.Cursor == nil {
+		flow.Cursor = make(map[string]interface{})
+	}
+	pending, _ := flow.Cursor["pending"].([]interface{})
+	pending = append(pending, map[string]interface{}{
+		"flowId": child.ID,
+		"type":   "flow",
+		"status": string(child.Status),
+	})
+	flow.Cursor["pending"] = pending
+
+	return child, suspend, nil
+}
+
 // GetLastEvent extracts the last event from the cursor
 func GetLastEvent(cursor map[string]interface{}) map[string]interface{} {
 	if cursor == nil {
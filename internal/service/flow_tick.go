@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// A running flow whose cursor sets "tickEvery" (a duration such as "30s", or
+// a number of seconds) advances on a timer. After every step that leaves it
+// running, the next flow:tick task is scheduled and recorded in the cursor
+// under "tick". Suspending, finishing or cancelling the flow removes the
+// record and cancels the task.
+
+// defaultMinTickInterval is the shortest tick interval unless
+// SetMinTickInterval says otherwise
+const defaultMinTickInterval = 5 * time.Second
+
+// SetMinTickInterval sets the shortest interval between timed ticks of one
+// flow; shorter tickEvery values are raised to it
+func (s *FlowService) SetMinTickInterval(d time.Duration) {
+	s.minTickInterval = d
+}
+
+// tickInterval returns the tickEvery interval of a cursor, or 0 if the flow
+// does not tick on a timer
+func tickInterval(cursor map[string]interface{}) time.Duration {
+	switch v := cursor["tickEvery"].(type) {
+	case string:
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	case float64:
+		if v > 0 {
+			return time.Duration(v * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// scheduleTick updates the tick record of a step result: a flow that keeps
+// running gets its next tick, any other outcome cancels the pending one
+func (s *FlowService) scheduleTick(ctx context.Context, flow *model.Flow, result *StepResult) {
+	cursor := result.Cursor
+	if cursor == nil {
+		cursor = flow.Cursor
+	}
+	if cursor == nil {
+		return
+	}
+
+	var changed bool
+	if result.Suspend == nil && !result.Done && result.Err == nil {
+		changed = s.armTick(ctx, flow.ID, cursor)
+	} else if _, ok := cursor["tick"]; ok {
+		s.disarmTick(cursor)
+		changed = true
+	}
+	if changed {
+		result.Cursor = cursor
+	}
+}
+
+// armTick schedules the next tick of a running flow unless one is already
+// pending. It reports whether the cursor changed.
+func (s *FlowService) armTick(ctx context.Context, flowID string, cursor map[string]interface{}) bool {
+	interval := tickInterval(cursor)
+	record, armed := cursor["tick"].(map[string]interface{})
+	if interval == 0 {
+		if armed {
+			s.disarmTick(cursor)
+		}
+		return armed
+	}
+	if armed {
+		at, _ := record["at"].(string)
+		if t, err := time.Parse(time.RFC3339, at); err == nil && t.After(time.Now()) {
+			return false
+		}
+		s.disarmTick(cursor)
+	}
+
+	min := s.minTickInterval
+	if min <= 0 {
+		min = defaultMinTickInterval
+	}
+	if interval < min {
+		interval = min
+	}
+	// Up to 10% jitter, so flows created together do not tick together
+	at := time.Now().Add(interval + time.Duration(rand.Int63n(int64(interval)/10+1)))
+
+	tickID := ulid.Make().String()
+	record = map[string]interface{}{
+		"id": tickID,
+		"at": at.UTC().Format(time.RFC3339),
+	}
+	if jc := s.jobClient(); jc != nil {
+		if taskID, err := jc.ScheduleFlowTick(ctx, flowID, tickID, at); err == nil && taskID != "" {
+			record["taskId"] = taskID
+		}
+	}
+	cursor["tick"] = record
+	return true
+}
+
+// disarmTick removes the tick record from the cursor and cancels its task
+func (s *FlowService) disarmTick(cursor map[string]interface{}) {
+	record, ok := cursor["tick"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(cursor, "tick")
+	if taskID, _ := record["taskId"].(string); taskID != "" {
+		if jc := s.jobClient(); jc != nil {
+			_ = jc.CancelTask(taskID)
+		}
+	}
+}
+
+// RunFlowTick runs the timed step identified by tickID. Ticks of flows that
+// stopped running or were rescheduled are ignored.
+func (s *FlowService) RunFlowTick(ctx context.Context, flowID, tickID string) error {
+	var stepErr error
+	err := s.withFlowLock(ctx, flowID, func(fs *FlowService) error {
+		flow, err := fs.queries.GetFlowByID(ctx, flowID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get flow: %w", err)
+		}
+
+		record, _ := flow.Cursor["tick"].(map[string]interface{})
+		if flow.Status != string(model.FlowStatusRunning) || record == nil || record["id"] != tickID {
+			return nil
+		}
+
+		// The task is running, so there is nothing left to cancel; the step
+		// schedules the next tick
+		delete(flow.Cursor, "tick")
+		if err := fs.queries.UpdateFlowCursor(ctx, flowID, flow.Cursor); err != nil {
+			return fmt.Errorf("failed to update cursor: %w", err)
+		}
+
+		stepErr, err = fs.tick(ctx, flowID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return stepErr
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tickJobClient records flow ticks
+type tickJobClient struct {
+	JobClient
+	scheduled []time.Time
+	cancelled []string
+}
+
+func (c *tickJobClient) ScheduleFlowTick(ctx context.Context, flowID, tickID string, at time.Time) (string, error) {
+	c.scheduled = append(c.scheduled, at)
+	return fmt.Sprintf("tick-%d", len(c.scheduled)), nil
+}
+
+func (c *tickJobClient) CancelTask(taskID string) error {
+	c.cancelled = append(c.cancelled, taskID)
+	return nil
+}
+
+func TestTickInterval(t *testing.T) {
+	assert.Equal(t, 30*time.Second, tickInterval(map[string]interface{}{"tickEvery": "30s"}))
+	assert.Equal(t, 90*time.Second, tickInterval(map[string]interface{}{"tickEvery": float64(90)}))
+	assert.Zero(t, tickInterval(map[string]interface{}{"tickEvery": "soon"}))
+	assert.Zero(t, tickInterval(map[string]interface{}{"tickEvery": "-1m"}))
+	assert.Zero(t, tickInterval(map[string]interface{}{}))
+}
+
+func TestScheduleTick(t *testing.T) {
+	jc := &tickJobClient{}
+	s := &FlowService{requestSvc: &RequestService{jobClient: jc}}
+	flow := &model.Flow{ID: "flow-1", Cursor: map[string]interface{}{"step": "poll", "tickEvery": "1m"}}
+
+	// A step that keeps the flow running schedules the next tick, with jitter
+	start := time.Now()
+	result := StepResult{}
+	s.scheduleTick(context.Background(), flow, &result)
+	require.NotNil(t, result.Cursor)
+	record := result.Cursor["tick"].(map[string]interface{})
+	assert.Equal(t, "tick-1", record["taskId"])
+	require.Len(t, jc.scheduled, 1)
+	assert.True(t, !jc.scheduled[0].Before(start.Add(time.Minute)))
+	assert.True(t, jc.scheduled[0].Before(start.Add(67*time.Second)))
+
+	// While it is pending, no second tick is scheduled
+	again := StepResult{Cursor: result.Cursor}
+	s.scheduleTick(context.Background(), flow, &again)
+	assert.Len(t, jc.scheduled, 1)
+
+	// Suspending cancels it
+	suspended := StepResult{Cursor: result.Cursor, Suspend: &Suspend{Event: "request.answered"}}
+	s.scheduleTick(context.Background(), flow, &suspended)
+	assert.NotContains(t, suspended.Cursor, "tick")
+	assert.Equal(t, []string{"tick-1"}, jc.cancelled)
+
+	// Intervals are raised to the minimum
+	s.SetMinTickInterval(time.Hour)
+	fast := &model.Flow{ID: "flow-2", Cursor: map[string]interface{}{"tickEvery": "1s"}}
+	s.scheduleTick(context.Background(), fast, &StepResult{})
+	require.Len(t, jc.scheduled, 2)
+	assert.True(t, jc.scheduled[1].After(start.Add(59*time.Minute)))
+
+	// Flows without tickEvery are left alone
+	plain := StepResult{}
+	s.scheduleTick(context.Background(), &model.Flow{ID: "flow-3", Cursor: map[string]interface{}{"step": "ask"}}, &plain)
+	assert.Nil(t, plain.Cursor)
+	assert.Len(t, jc.scheduled, 2)
+}
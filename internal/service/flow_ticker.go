@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/audit"
+
+	"go.uber.org/zap"
+)
+
+// FlowTicker periodically advances flows that have not made progress, so
+// flows whose resume event was missed do not stay suspended forever
+type FlowTicker struct {
+	flowSvc    *FlowService
+	interval   time.Duration
+	staleAfter time.Duration
+	batchSize  int
+	log        *zap.Logger
+}
+
+// NewFlowTicker creates a new flow ticker that scans every interval for flows
+// not updated within staleAfter
+func NewFlowTicker(flowSvc *FlowService, interval, staleAfter time.Duration, batchSize int, log *zap.Logger) *FlowTicker {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &FlowTicker{
+		flowSvc:    flowSvc,
+		interval:   interval,
+		staleAfter: staleAfter,
+		batchSize:  batchSize,
+		log:        log,
+	}
+}
+
+// Run scans and ticks due flows until ctx is cancelled
+func (t *FlowTicker) Run(ctx context.Context) {
+	t.log.Info("Flow ticker started",
+		zap.Duration("interval", t.interval),
+		zap.Duration("staleAfter", t.staleAfter),
+	)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		t.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			t.log.Info("Flow ticker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *FlowTicker) tick(ctx context.Context) {
+	start := time.Now()
+	ctx = audit.WithActor(ctx, audit.SystemActor)
+	scanned, err := t.flowSvc.TickDueFlows(ctx, t.staleAfter, t.batchSize, t.log)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.log.Error("Flow tick failed", zap.Error(err))
+		}
+		return
+	}
+	if scanned > 0 {
+		t.log.Info("Ticked due flows", zap.Int("count", scanned), zap.Duration("duration", time.Since(start)))
+	}
+}
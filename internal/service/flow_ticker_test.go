@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// tickerQueries holds flows and the requests they wait for in memory, with
+// the paging and checked marks of GetDueFlows
+type tickerQueries struct {
+	db.Querier
+	flows    map[string]*db.Flow
+	checked  map[string]time.Time
+	requests map[string]db.Request
+	afters   []string // The after flow of each page scanned; "" for the first
+	lookups  int      // Requests read
+}
+
+func newTickerQueries() *tickerQueries {
+	return &tickerQueries{flows: map[string]*db.Flow{}, checked: map[string]time.Time{}, requests: map[string]db.Request{}}
+}
+
+func (q *tickerQueries) GetDueFlows(ctx context.Context, before time.Time, after *db.Flow, limit int) ([]db.Flow, error) {
+	afterID := ""
+	if after != nil {
+		afterID = after.ID
+	}
+	q.afters = append(q.afters, afterID)
+
+	var due []db.Flow
+	for _, f := range q.flows {
+		seen := f.UpdatedAt
+		if checked, ok := q.checked[f.ID]; ok && checked.After(seen) {
+			seen = checked
+		}
+		if !seen.Before(before) || (f.Status != string(model.FlowStatusRunning) && f.Status != string(model.FlowStatusSuspended)) {
+			continue
+		}
+		if after != nil && (f.UpdatedAt.Before(after.UpdatedAt) || (f.UpdatedAt.Equal(after.UpdatedAt) && f.ID <= after.ID)) {
+			continue
+		}
+		due = append(due, *f)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].UpdatedAt.Before(due[j].UpdatedAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (q *tickerQueries) MarkFlowsChecked(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		q.checked[id] = time.Now()
+	}
+	return nil
+}
+
+func (q *tickerQueries) InTx(ctx context.Context, fn func(db.Querier) error) error {
+	return fn(q)
+}
+
+func (q *tickerQueries) LockFlow(ctx context.Context, id string) error {
+	return nil
+}
+
+func (q *tickerQueries) GetFlowByID(ctx context.Context, id string) (db.Flow, error) {
+	f, ok := q.flows[id]
+	if !ok {
+		return db.Flow{}, pgx.ErrNoRows
+	}
+	return *f, nil
+}
+
+func (q *tickerQueries) UpdateFlowCursor(ctx context.Context, id string, cursor map[string]interface{}) error {
+	q.flows[id].Cursor = cursor
+	q.flows[id].UpdatedAt = time.Now()
+	return nil
+}
+
+func (q *tickerQueries) SetFlowLastEventID(ctx context.Context, id, eventID string) error {
+	q.flows[id].LastEventID = &eventID
+	return nil
+}
+
+func (q *tickerQueries) UpdateFlowStatus(ctx context.Context, id, status string) error {
+	q.flows[id].Status = status
+	q.flows[id].UpdatedAt = time.Now()
+	return nil
+}
+
+func (q *tickerQueries) GetRequestByID(ctx context.Context, id string) (db.Request, error) {
+	q.lookups++
+	r, ok := q.requests[id]
+	if !ok {
+		return db.Request{}, pgx.ErrNoRows
+	}
+	return r, nil
+}
+
+func (q *tickerQueries) GetRequestBundleIDs(ctx context.Context, ids []string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// waitFor adds a suspended flow, last updated at, waiting for a request in
+// status
+func (q *tickerQueries) waitFor(id string, at time.Time, status model.Status) {
+	requestID := "req-" + id
+	q.requests[requestID] = db.Request{ID: requestID, Status: string(status)}
+	q.flows[id] = &db.Flow{
+		ID:        id,
+		Status:    string(model.FlowStatusSuspended),
+		Cursor:    map[string]interface{}{"pending": []interface{}{map[string]interface{}{"requestId": requestID}}},
+		UpdatedAt: at,
+	}
+}
+
+func TestTickDueFlows(t *testing.T) {
+	stale := time.Now().Add(-time.Hour)
+	q := newTickerQueries()
+	q.waitFor("answered", stale, model.StatusAnswered)
+	q.waitFor("waiting", stale.Add(time.Minute), model.StatusPending)
+	q.waitFor("recent", time.Now(), model.StatusAnswered)
+	s := &FlowService{queries: q, bus: &deferredBus{}, requestSvc: &RequestService{queries: q}}
+	ctx := context.Background()
+
+	n, err := s.TickDueFlows(ctx, 10*time.Minute, 1, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"", "answered", "waiting"}, q.afters, "each page continues after the last flow of the previous one")
+
+	// The answered flow resumes once; the others are left alone
+	assert.Equal(t, string(model.FlowStatusRunning), q.flows["answered"].Status)
+	require.NotNil(t, q.flows["answered"].LastEventID)
+	assert.Equal(t, "request.answered:req-answered", *q.flows["answered"].LastEventID)
+	assert.Equal(t, string(model.FlowStatusSuspended), q.flows["waiting"].Status)
+	assert.Nil(t, q.flows["waiting"].LastEventID)
+	assert.Equal(t, string(model.FlowStatusSuspended), q.flows["recent"].Status, "flows updated within staleAfter are not due")
+
+	// A flow still waiting is not checked again until staleAfter has passed
+	lookups := q.lookups
+	n, err = s.TickDueFlows(ctx, 10*time.Minute, 1, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, lookups, q.lookups)
+
+	q.checked["waiting"] = stale
+	n, err = s.TickDueFlows(ctx, 10*time.Minute, 1, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, string(model.FlowStatusSuspended), q.flows["waiting"].Status)
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// A suspension with a deadline is recorded in the cursor under "suspend"
+// together with the ID of its flow:timeout task. Resuming or cancelling the
+// flow removes the record and cancels the task; a task firing for a record
+// that is gone does nothing.
+
+// jobClient returns the job client of the request service, if any
+func (s *FlowService) jobClient() JobClient {
+	if s.requestSvc == nil {
+		return nil
+	}
+	return s.requestSvc.jobClient
+}
+
+// armTimeout records the suspension of a step result in its cursor and
+// schedules the timeout. A flow that suspends again on the same request and
+// deadline keeps its pending timeout.
+func (s *FlowService) armTimeout(ctx context.Context, flow *model.Flow, result *StepResult) {
+	suspend := result.Suspend
+	if result.Cursor == nil {
+		if _, armed := flow.Cursor["suspend"]; !armed && suspend.DeadlineAt == nil {
+			return
+		}
+		result.Cursor = flow.Cursor
+		if result.Cursor == nil {
+			result.Cursor = make(map[string]interface{})
+		}
+	}
+	cursor := result.Cursor
+	if suspend.DeadlineAt == nil {
+		s.disarmTimeout(cursor)
+		return
+	}
+
+	record := map[string]interface{}{
+		"event":      suspend.Event,
+		"deadlineAt": suspend.DeadlineAt.UTC().Format(time.RFC3339),
+		"onTimeout":  suspend.OnTimeout,
+	}
+	if suspend.RequestID != nil {
+		record["requestId"] = *suspend.RequestID
+	}
+	if prev, ok := cursor["suspend"].(map[string]interface{}); ok {
+		if prev["event"] == record["event"] && prev["requestId"] == record["requestId"] && prev["deadlineAt"] == record["deadlineAt"] {
+			prev["onTimeout"] = suspend.OnTimeout
+			return
+		}
+		s.disarmTimeout(cursor)
+	}
+
+	suspendID := ulid.Make().String()
+	record["id"] = suspendID
+	if jc := s.jobClient(); jc != nil {
+		if taskID, err := jc.ScheduleFlowTimeout(ctx, flow.ID, suspendID, *suspend.DeadlineAt); err == nil && taskID != "" {
+			record["taskId"] = taskID
+		}
+	}
+	cursor["suspend"] = record
+}
+
+// disarmTimeout removes the suspension record from the cursor and cancels
+// its timeout task
+func (s *FlowService) disarmTimeout(cursor map[string]interface{}) {
+	record, ok := cursor["suspend"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(cursor, "suspend")
+	if taskID, _ := record["taskId"].(string); taskID != "" {
+		if jc := s.jobClient(); jc != nil {
+			_ = jc.CancelTask(taskID)
+		}
+	}
+}
+
+// TimeoutFlow ends a suspension that reached its deadline: the awaited
+// request is cancelled and the flow resumes with a "timeout" event at the
+// suspension's onTimeout step. Suspensions that already ended are ignored.
+func (s *FlowService) TimeoutFlow(ctx context.Context, flowID, suspendID string) error {
+	var stepErr error
+	err := s.withFlowLock(ctx, flowID, func(fs *FlowService) error {
+		flow, err := fs.queries.GetFlowByID(ctx, flowID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get flow: %w", err)
+		}
+
+		record, _ := flow.Cursor["suspend"].(map[string]interface{})
+		if flow.Status != string(model.FlowStatusSuspended) || record == nil || record["id"] != suspendID {
+			return nil
+		}
+
+		requestID, _ := record["requestId"].(string)
+		if requestID != "" {
+			if err := fs.cancelAwaitedRequest(ctx, requestID); err != nil {
+				return err
+			}
+		}
+
+		// The task is running, so there is nothing left to cancel
+		delete(flow.Cursor, "suspend")
+		step, _ := record["onTimeout"].(string)
+		if step != "" {
+			flow.Cursor["step"] = step
+		}
+
+		_ = fs.bus.PublishEntity(flow.OwnerEntity, events.New(ctx, events.FlowTimedOut{
+			FlowID:    flowID,
+			RequestID: requestID,
+			Step:      step,
+		}))
+
+		stepErr, err = fs.resume(ctx, flow, "timeout:"+suspendID, "timeout", map[string]interface{}{
+			"requestId":  requestID,
+			"deadlineAt": record["deadlineAt"],
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return stepErr
+}
+
+// cancelAwaitedRequest cancels the request a timed out flow was waiting
+// for, unless it was closed in the meantime
+func (s *FlowService) cancelAwaitedRequest(ctx context.Context, requestID string) error {
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get request: %w", err)
+	}
+	if !model.RequestStatusMachine.CanTransition(model.Status(req.Status), model.StatusCancelled) {
+		return nil
+	}
+	if err := s.requestSvc.CancelRequest(ctx, requestID, &req.Version); err != nil && !errors.Is(err, ErrConflict) {
+		return err
+	}
+	return nil
+}
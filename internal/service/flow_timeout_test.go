@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeoutJobClient records flow timeouts; other JobClient methods are not
+// used by the flow timeout code
+type timeoutJobClient struct {
+	JobClient
+	scheduled []string
+	cancelled []string
+}
+
+func (c *timeoutJobClient) ScheduleFlowTimeout(ctx context.Context, flowID, suspendID string, deadlineAt time.Time) (string, error) {
+	taskID := fmt.Sprintf("task-%d", len(c.scheduled)+1)
+	c.scheduled = append(c.scheduled, taskID)
+	return taskID, nil
+}
+
+func (c *timeoutJobClient) CancelTask(taskID string) error {
+	c.cancelled = append(c.cancelled, taskID)
+	return nil
+}
+
+func TestArmTimeout(t *testing.T) {
+	jc := &timeoutJobClient{}
+	s := &FlowService{requestSvc: &RequestService{jobClient: jc}}
+	flow := &model.Flow{ID: "flow-1", Cursor: map[string]interface{}{"step": "ask"}}
+	requestID := "req-1"
+	deadline := time.Now().Add(time.Hour)
+
+	result := StepResult{Suspend: &Suspend{Event: "request.answered", RequestID: &requestID, DeadlineAt: &deadline, OnTimeout: "timeout"}}
+	s.armTimeout(context.Background(), flow, &result)
+	require.NotNil(t, result.Cursor)
+	record, ok := result.Cursor["suspend"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "req-1", record["requestId"])
+	assert.Equal(t, "timeout", record["onTimeout"])
+	assert.Equal(t, "task-1", record["taskId"])
+	assert.NotEmpty(t, record["id"])
+
+	// Suspending again on the same request keeps the pending timeout
+	flow.Cursor = result.Cursor
+	again := StepResult{Cursor: flow.Cursor, Suspend: &Suspend{Event: "request.answered", RequestID: &requestID, DeadlineAt: &deadline, OnTimeout: "timeout"}}
+	s.armTimeout(context.Background(), flow, &again)
+	assert.Equal(t, []string{"task-1"}, jc.scheduled)
+	assert.Equal(t, record["id"], again.Cursor["suspend"].(map[string]interface{})["id"])
+
+	// A new deadline replaces it
+	later := deadline.Add(time.Hour)
+	moved := StepResult{Cursor: flow.Cursor, Suspend: &Suspend{Event: "request.answered", RequestID: &requestID, DeadlineAt: &later}}
+	s.armTimeout(context.Background(), flow, &moved)
+	assert.Equal(t, []string{"task-1", "task-2"}, jc.scheduled)
+	assert.Equal(t, []string{"task-1"}, jc.cancelled)
+
+	// Resuming removes the record and cancels the task
+	s.disarmTimeout(moved.Cursor)
+	assert.NotContains(t, moved.Cursor, "suspend")
+	assert.Equal(t, []string{"task-1", "task-2"}, jc.cancelled)
+
+	// Without a deadline nothing is scheduled
+	plain := StepResult{Suspend: &Suspend{Event: "request.answered", RequestID: &requestID}}
+	s.armTimeout(context.Background(), &model.Flow{ID: "flow-2"}, &plain)
+	assert.Nil(t, plain.Cursor)
+	assert.Len(t, jc.scheduled, 2)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ResolveIdentity returns the entity linked to an identity from an external
+// provider. If there is none and provision is set, a user entity is created
+// and linked; its handle comes from the identity when still free, and the
+// email and name are kept in meta. Otherwise it returns "".
+func (s *EntityService) ResolveIdentity(ctx context.Context, id auth.Identity, provision bool) (string, error) {
+	entityID, err := s.queries.GetEntityIdentity(ctx, id.Issuer, id.Subject)
+	if err == nil {
+		return entityID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("failed to look up identity: %w", err)
+	}
+	if !provision {
+		return "", nil
+	}
+
+	meta := map[string]interface{}{"issuer": id.Issuer, "subject": id.Subject}
+	if id.Email != "" {
+		meta["email"] = id.Email
+	}
+	if id.Name != "" {
+		meta["name"] = id.Name
+	}
+
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		e, err := q.CreateProvisionedEntity(ctx, id.Handle, meta)
+		if err != nil {
+			return err
+		}
+		entityID = e.ID
+		return q.CreateEntityIdentity(ctx, id.Issuer, id.Subject, e.ID)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// A concurrent first login linked the identity first; use its entity
+		return s.queries.GetEntityIdentity(ctx, id.Issuer, id.Subject)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to provision entity: %w", err)
+	}
+	return entityID, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+)
+
+// DefaultInquiryLimit is the page size of inquiry listings without a limit
+const DefaultInquiryLimit = 50
+
+// InquiryQuery selects inquiries for ListInquiries. Empty fields match all
+// inquiries.
+type InquiryQuery struct {
+	ViewID         string // Saved view supplying the entity and default filters
+	EntityID       string
+	Status         string
+	CreatedBy      string
+	Tags           []string
+	SortBy         string // "created" (default) or "deadline"
+	IncludeDeleted bool
+	IncludeSnoozed bool
+	IncludeExpired bool // Also list open requests past their expiresAt
+	Limit          int
+	Offset         int
+}
+
+// ListInquiries returns the inquiries matching q. A saved view supplies the
+// entity and default filters; the query's status, requestor and sort order
+// override the view's and its tags add to them.
+func (s *RequestService) ListInquiries(ctx context.Context, q InquiryQuery) ([]*model.Request, error) {
+	var filter db.RequestFilter
+	sortBy := q.SortBy
+	if q.ViewID != "" {
+		view, err := s.entitySvc.GetView(ctx, "", q.ViewID)
+		if err != nil {
+			return nil, err
+		}
+		filter = ViewRequestFilter(view)
+		if sortBy == "" {
+			sortBy = view.Filter.SortBy
+		}
+	} else if q.EntityID != "" {
+		filter.EntityID = &q.EntityID
+	}
+	if q.Status != "" {
+		filter.Status = &q.Status
+	}
+	if q.CreatedBy != "" {
+		filter.CreatedBy = &q.CreatedBy
+	}
+	filter.Tags = append(filter.Tags, q.Tags...)
+	filter.IncludeDeleted = q.IncludeDeleted
+	filter.ExcludeSnoozed = !q.IncludeSnoozed
+	filter.ExcludeExpired = !q.IncludeExpired
+	if sortBy == "" {
+		sortBy = "created"
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultInquiryLimit
+	}
+	return s.SearchRequests(ctx, filter, sortBy, limit, q.Offset)
+}
+
+// EntityQueue returns the requests of an entity, newest first. Requests
+// past their expiresAt are left out, and snoozed requests unless
+// includeSnoozed is set. The requests of a bundle take a single entry: the
+// first of them on the page, carrying the bundle.
+func (s *RequestService) EntityQueue(ctx context.Context, entityID string, status *string, includeSnoozed bool, limit, offset int) ([]*model.Request, error) {
+	if limit <= 0 {
+		limit = DefaultInquiryLimit
+	}
+	requests, err := s.queries.GetEntityQueue(ctx, entityID, status, includeSnoozed, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue: %w", err)
+	}
+	ids := make([]string, 0, len(requests))
+	for _, r := range requests {
+		ids = append(ids, r.ID)
+	}
+	bundleIDs, err := s.queries.GetRequestBundleIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue bundles: %w", err)
+	}
+
+	result := make([]*model.Request, 0, len(requests))
+	seen := map[string]bool{}
+	for _, r := range requests {
+		bundleID, inBundle := bundleIDs[r.ID]
+		if inBundle && seen[bundleID] {
+			continue
+		}
+		req, err := s.requestModel(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		if inBundle {
+			seen[bundleID] = true
+			req.BundleID = &bundleID
+			if req.Bundle, err = s.GetBundle(ctx, bundleID); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, req)
+	}
+	return result, nil
+}
+
+// MarkRead records that an inquiry was read. Marking it again moves the
+// read time.
+func (s *RequestService) MarkRead(ctx context.Context, id string) error {
+	if err := s.queries.MarkInquiryRead(ctx, id); err != nil {
+		if db.IsInvalidText(err) {
+			return notFound("request", err)
+		}
+		return fmt.Errorf("failed to mark read: %w", err)
+	}
+	return nil
+}
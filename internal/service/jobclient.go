@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
 	"time"
 
+	"pxbox/internal/db"
+	"pxbox/internal/export"
 	"pxbox/internal/jobs"
 
 	"github.com/hibiken/asynq"
@@ -10,39 +13,148 @@ import (
 
 // JobClient interface for scheduling background jobs
 type JobClient interface {
-	ScheduleDeadlineNotification(requestID string, deadlineAt time.Time) error
-	ScheduleDeadlineExpiry(requestID string, deadlineAt time.Time) error
-	ScheduleAutoCancel(requestID string, gracePeriod time.Duration) error
-	ScheduleAttentionNotification(requestID string, attentionAt time.Time) error
-	ScheduleReminder(reminderID string, remindAt time.Time) error
+	ScheduleDeadlineNotification(ctx context.Context, requestID string, deadlineAt time.Time) (string, error)
+	ScheduleDeadlineExpiry(ctx context.Context, requestID string, deadlineAt time.Time) (string, error)
+	ScheduleRequestExpiry(ctx context.Context, requestID string, expiresAt time.Time) (string, error)
+	ScheduleAutoCancel(ctx context.Context, requestID string, gracePeriod time.Duration) (string, error)
+	CancelTask(taskID string) error
+	ScheduleAttentionNotification(ctx context.Context, requestID string, attentionAt time.Time) error
+	ScheduleReminder(ctx context.Context, reminderID string, remindAt time.Time) (string, error)
+	ScheduleClaimExpiry(ctx context.Context, requestID string, expiresAt time.Time) error
+	ScheduleFlowTimeout(ctx context.Context, flowID, suspendID string, deadlineAt time.Time) (string, error)
+	ScheduleFlowTick(ctx context.Context, flowID, tickID string, at time.Time) (string, error)
+	EnqueueExport(ctx context.Context, job export.Job) error
+	EnqueueCallback(ctx context.Context, requestID string) error
+	EnqueueBotDispatch(ctx context.Context, requestID string) error
+	EnqueueRequestNotification(ctx context.Context, requestID string) error
+	EnqueueWebhookDelivery(ctx context.Context, deliveryID string) error
+	EnqueueFileScan(ctx context.Context, key string) error
+	EnqueueThumbnail(ctx context.Context, job jobs.ThumbnailJob) error
+	EnqueueErasure(ctx context.Context, erasureID string) error
+	EnqueueDigest(ctx context.Context, entityID string, slot time.Time) error
+}
+
+// TxJobClient is a JobClient whose jobs can be enqueued inside a database
+// transaction, so they only exist if it commits
+type TxJobClient interface {
+	JobClient
+	WithQuerier(q db.Querier) JobClient
 }
 
 // AsynqJobClient implements JobClient using asynq
 type AsynqJobClient struct {
-	client *asynq.Client
+	client    jobs.Enqueuer
+	inspector *asynq.Inspector
 }
 
 func NewAsynqJobClient(client *asynq.Client) *AsynqJobClient {
 	return &AsynqJobClient{client: client}
 }
 
-func (c *AsynqJobClient) ScheduleDeadlineNotification(requestID string, deadlineAt time.Time) error {
-	return jobs.ScheduleDeadlineNotification(c.client, requestID, deadlineAt)
+// SetInspector enables cancelling scheduled tasks
+func (c *AsynqJobClient) SetInspector(inspector *asynq.Inspector) {
+	c.inspector = inspector
+}
+
+func (c *AsynqJobClient) ScheduleDeadlineNotification(ctx context.Context, requestID string, deadlineAt time.Time) (string, error) {
+	return jobs.ScheduleDeadlineNotification(ctx, c.client, requestID, deadlineAt)
+}
+
+func (c *AsynqJobClient) ScheduleDeadlineExpiry(ctx context.Context, requestID string, deadlineAt time.Time) (string, error) {
+	return jobs.ScheduleDeadlineExpiry(ctx, c.client, requestID, deadlineAt)
+}
+
+func (c *AsynqJobClient) ScheduleRequestExpiry(ctx context.Context, requestID string, expiresAt time.Time) (string, error) {
+	return jobs.ScheduleRequestExpiry(ctx, c.client, requestID, expiresAt)
+}
+
+func (c *AsynqJobClient) ScheduleAutoCancel(ctx context.Context, requestID string, gracePeriod time.Duration) (string, error) {
+	return jobs.ScheduleAutoCancel(ctx, c.client, requestID, gracePeriod)
+}
+
+// CancelTask deletes a scheduled task; without an inspector it does nothing
+// and the job handler has to notice the task is stale
+func (c *AsynqJobClient) CancelTask(taskID string) error {
+	if c.inspector == nil {
+		return nil
+	}
+	return jobs.CancelTask(c.inspector, taskID)
+}
+
+func (c *AsynqJobClient) ScheduleAttentionNotification(ctx context.Context, requestID string, attentionAt time.Time) error {
+	return jobs.ScheduleAttentionNotification(ctx, c.client, requestID, attentionAt)
+}
+
+func (c *AsynqJobClient) ScheduleReminder(ctx context.Context, reminderID string, remindAt time.Time) (string, error) {
+	return jobs.ScheduleReminder(ctx, c.client, reminderID, remindAt)
+}
+
+func (c *AsynqJobClient) ScheduleClaimExpiry(ctx context.Context, requestID string, expiresAt time.Time) error {
+	return jobs.ScheduleClaimExpiry(ctx, c.client, requestID, expiresAt)
+}
+
+func (c *AsynqJobClient) ScheduleFlowTimeout(ctx context.Context, flowID, suspendID string, deadlineAt time.Time) (string, error) {
+	return jobs.ScheduleFlowTimeout(ctx, c.client, flowID, suspendID, deadlineAt)
 }
 
-func (c *AsynqJobClient) ScheduleDeadlineExpiry(requestID string, deadlineAt time.Time) error {
-	return jobs.ScheduleDeadlineExpiry(c.client, requestID, deadlineAt)
+func (c *AsynqJobClient) ScheduleFlowTick(ctx context.Context, flowID, tickID string, at time.Time) (string, error) {
+	return jobs.ScheduleFlowTick(ctx, c.client, flowID, tickID, at)
 }
 
-func (c *AsynqJobClient) ScheduleAutoCancel(requestID string, gracePeriod time.Duration) error {
-	return jobs.ScheduleAutoCancel(c.client, requestID, gracePeriod)
+func (c *AsynqJobClient) EnqueueExport(ctx context.Context, job export.Job) error {
+	return jobs.EnqueueExport(ctx, c.client, job)
 }
 
-func (c *AsynqJobClient) ScheduleAttentionNotification(requestID string, attentionAt time.Time) error {
-	return jobs.ScheduleAttentionNotification(c.client, requestID, attentionAt)
+func (c *AsynqJobClient) EnqueueCallback(ctx context.Context, requestID string) error {
+	return jobs.EnqueueCallback(ctx, c.client, requestID)
 }
 
-func (c *AsynqJobClient) ScheduleReminder(reminderID string, remindAt time.Time) error {
-	return jobs.ScheduleReminder(c.client, reminderID, remindAt)
+func (c *AsynqJobClient) EnqueueBotDispatch(ctx context.Context, requestID string) error {
+	return jobs.EnqueueBotDispatch(ctx, c.client, requestID)
 }
 
+func (c *AsynqJobClient) EnqueueRequestNotification(ctx context.Context, requestID string) error {
+	return jobs.EnqueueRequestNotification(ctx, c.client, requestID)
+}
+
+func (c *AsynqJobClient) EnqueueWebhookDelivery(ctx context.Context, deliveryID string) error {
+	return jobs.EnqueueWebhookDelivery(ctx, c.client, deliveryID)
+}
+
+func (c *AsynqJobClient) EnqueueFileScan(ctx context.Context, key string) error {
+	return jobs.EnqueueFileScan(ctx, c.client, key)
+}
+
+func (c *AsynqJobClient) EnqueueThumbnail(ctx context.Context, job jobs.ThumbnailJob) error {
+	return jobs.EnqueueThumbnail(ctx, c.client, job)
+}
+
+func (c *AsynqJobClient) EnqueueErasure(ctx context.Context, erasureID string) error {
+	return jobs.EnqueueErasure(ctx, c.client, erasureID)
+}
+
+func (c *AsynqJobClient) EnqueueDigest(ctx context.Context, entityID string, slot time.Time) error {
+	return jobs.EnqueueDigest(ctx, c.client, entityID, slot)
+}
+
+// PGJobClient implements JobClient on the jobs table of JOB_BACKEND=postgres.
+// It schedules the same tasks as AsynqJobClient.
+type PGJobClient struct {
+	AsynqJobClient
+	queue *jobs.PGQueue
+}
+
+func NewPGJobClient(queue *jobs.PGQueue) *PGJobClient {
+	return &PGJobClient{AsynqJobClient: AsynqJobClient{client: queue}, queue: queue}
+}
+
+// CancelTask deletes a scheduled job that has not started
+func (c *PGJobClient) CancelTask(taskID string) error {
+	return c.queue.Cancel(taskID)
+}
+
+// WithQuerier returns a client that enqueues through q, inside its
+// transaction
+func (c *PGJobClient) WithQuerier(q db.Querier) JobClient {
+	return NewPGJobClient(c.queue.WithQuerier(q))
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// maxMaintenanceWindow is the longest an entity can be away at once
+	maxMaintenanceWindow = 90 * 24 * time.Hour
+	// maxMaintenanceReason is the longest reason shown to requestors
+	maxMaintenanceReason = 500
+)
+
+// MaintenanceWindowInput describes a new maintenance window
+type MaintenanceWindowInput struct {
+	StartsAt       time.Time `json:"startsAt"`
+	EndsAt         time.Time `json:"endsAt"`
+	PauseDeadlines bool      `json:"pauseDeadlines"`
+	Reason         *string   `json:"reason,omitempty"`
+}
+
+// CreateMaintenanceWindow puts an entity away from input.StartsAt to
+// input.EndsAt. Requests created for it in the meantime are still queued,
+// but marked deferred until the window ends, and their requestors get
+// request.deferred. With PauseDeadlines their deadlines are moved out by
+// the rest of the window; requests created before it keep theirs.
+func (s *EntityService) CreateMaintenanceWindow(ctx context.Context, entityID string, input MaintenanceWindowInput) (*model.MaintenanceWindow, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "maintenance windows"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+
+	if input.StartsAt.IsZero() {
+		input.StartsAt = time.Now()
+	}
+	switch {
+	case input.EndsAt.IsZero() || !input.EndsAt.After(input.StartsAt):
+		return nil, invalid("invalid_window", "endsAt must be after startsAt", nil)
+	case !input.EndsAt.After(time.Now()):
+		return nil, invalid("invalid_window", "endsAt must be in the future", nil)
+	case input.EndsAt.Sub(input.StartsAt) > maxMaintenanceWindow:
+		return nil, invalid("invalid_window", fmt.Sprintf("a maintenance window can last at most %d days", int(maxMaintenanceWindow.Hours()/24)), nil)
+	case input.Reason != nil && len(*input.Reason) > maxMaintenanceReason:
+		return nil, invalid("invalid_window", fmt.Sprintf("reason can be at most %d bytes", maxMaintenanceReason), nil)
+	}
+
+	w, err := s.queries.CreateMaintenanceWindow(ctx, db.MaintenanceWindow{
+		ID:             ulid.Make().String(),
+		EntityID:       entityID,
+		StartsAt:       input.StartsAt,
+		EndsAt:         input.EndsAt,
+		PauseDeadlines: input.PauseDeadlines,
+		Reason:         input.Reason,
+		CreatedBy:      auth.Actor(ctx),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create maintenance window: %w", err)
+	}
+	return dbMaintenanceWindowToModel(w), nil
+}
+
+// ListMaintenanceWindows returns the current and upcoming maintenance
+// windows of an entity, soonest first
+func (s *EntityService) ListMaintenanceWindows(ctx context.Context, entityID string) ([]*model.MaintenanceWindow, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "maintenance windows"); err != nil {
+		return nil, err
+	}
+	windows, err := s.queries.ListMaintenanceWindows(ctx, entityID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list maintenance windows: %w", err)
+	}
+	result := make([]*model.MaintenanceWindow, 0, len(windows))
+	for _, w := range windows {
+		result = append(result, dbMaintenanceWindowToModel(w))
+	}
+	return result, nil
+}
+
+// DeleteMaintenanceWindow ends or cancels a maintenance window. Requests
+// deferred by it keep their deferredUntil and deadlines.
+func (s *EntityService) DeleteMaintenanceWindow(ctx context.Context, entityID, id string) error {
+	if err := requireEntityOrAdmin(ctx, entityID, "maintenance windows"); err != nil {
+		return err
+	}
+	err := s.queries.DeleteMaintenanceWindow(ctx, entityID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound("maintenance window", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete maintenance window: %w", err)
+	}
+	return nil
+}
+
+// deferForMaintenance looks up the maintenance window entityID is in at
+// now. If there is one, the request being created is deferred until its end
+// and, if the window pauses deadlines, deadlineAt is moved out by the rest
+// of the window. It returns nil without a window.
+func (s *RequestService) deferForMaintenance(ctx context.Context, entityID string, deadlineAt *time.Time, now time.Time) (*db.MaintenanceWindow, *time.Time, error) {
+	w, err := s.queries.GetActiveMaintenanceWindow(ctx, entityID, now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, deadlineAt, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get maintenance window: %w", err)
+	}
+	if w.PauseDeadlines && deadlineAt != nil {
+		moved := deadlineAt.Add(w.EndsAt.Sub(now))
+		deadlineAt = &moved
+	}
+	return &w, deadlineAt, nil
+}
+
+func dbMaintenanceWindowToModel(w db.MaintenanceWindow) *model.MaintenanceWindow {
+	return &model.MaintenanceWindow{
+		ID:             w.ID,
+		EntityID:       w.EntityID,
+		StartsAt:       w.StartsAt.UTC().Format(time.RFC3339),
+		EndsAt:         w.EndsAt.UTC().Format(time.RFC3339),
+		PauseDeadlines: w.PauseDeadlines,
+		Reason:         w.Reason,
+		CreatedBy:      w.CreatedBy,
+		CreatedAt:      w.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
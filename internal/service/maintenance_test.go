@@ -0,0 +1,63 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	f := newRequestFixture(t)
+	entitySvc := service.NewEntityService(f.queries)
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+	now := time.Now()
+
+	// Only the entity itself or an admin manages its windows
+	_, err := entitySvc.CreateMaintenanceWindow(context.Background(), f.entity.ID, service.MaintenanceWindowInput{EndsAt: now.Add(time.Hour)})
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	_, err = entitySvc.CreateMaintenanceWindow(ctx, f.entity.ID, service.MaintenanceWindowInput{StartsAt: now, EndsAt: now.Add(-time.Hour)})
+	assert.Equal(t, "invalid_window", service.Classify(err).Code)
+
+	// Requests before the window are not deferred
+	before := f.create(t, service.CreateRequestInput{})
+	assert.Nil(t, before.DeferredUntil)
+
+	reason := "On holiday"
+	endsAt := now.Add(48 * time.Hour).Truncate(time.Second)
+	window, err := entitySvc.CreateMaintenanceWindow(ctx, f.entity.ID, service.MaintenanceWindowInput{
+		StartsAt:       now.Add(-time.Minute),
+		EndsAt:         endsAt,
+		PauseDeadlines: true,
+		Reason:         &reason,
+	})
+	require.NoError(t, err)
+	_, err = entitySvc.CreateMaintenanceWindow(ctx, f.entity.ID, service.MaintenanceWindowInput{StartsAt: now.Add(24 * time.Hour), EndsAt: now.Add(96 * time.Hour)})
+	require.NoError(t, err)
+	windows, err := entitySvc.ListMaintenanceWindows(ctx, f.entity.ID)
+	require.NoError(t, err)
+	require.Len(t, windows, 2)
+	assert.Equal(t, window.ID, windows[0].ID)
+
+	// Requests during the window are queued, deferred until it ends and
+	// get their deadline moved out by the rest of the window
+	f.bus.Reset()
+	deadline := time.Now().Add(2 * time.Hour)
+	req := f.create(t, service.CreateRequestInput{DeadlineAt: &deadline})
+	assert.Equal(t, endsAt.UTC().Format(time.RFC3339), *req.DeferredUntil)
+	moved, err := time.Parse(time.RFC3339, *req.DeadlineAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, endsAt.Add(2*time.Hour), moved, 5*time.Second)
+	assert.Equal(t, []string{"request.created", "request.deferred"}, f.bus.Types("requestor:client-1"))
+	assert.Equal(t, []string{"request.created"}, f.bus.Types("entity:"+f.entity.ID))
+
+	require.NoError(t, entitySvc.DeleteMaintenanceWindow(ctx, f.entity.ID, window.ID))
+	assert.ErrorIs(t, entitySvc.DeleteMaintenanceWindow(ctx, f.entity.ID, window.ID), service.ErrNotFound)
+	after := f.create(t, service.CreateRequestInput{})
+	assert.Nil(t, after.DeferredUntil)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CollectOrphans deletes up to limit files that no response referenced
+// before they expired, together with any chunks of unfinished resumable
+// uploads. It returns the number of files deleted.
+func (s *FileService) CollectOrphans(ctx context.Context, before time.Time, limit int, log *zap.Logger) (int, error) {
+	expired, err := s.queries.ListExpiredFiles(ctx, before, limit)
+	if err != nil || len(expired) == 0 {
+		return 0, err
+	}
+
+	// Drop the rows first, so a file attached in the meantime is kept
+	ids := make([]string, 0, len(expired))
+	for _, f := range expired {
+		ids = append(ids, f.ID)
+	}
+	deleted, err := s.queries.DeleteExpiredFiles(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	gone := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		gone[id] = true
+	}
+	for _, f := range expired {
+		if !gone[f.ID] {
+			continue
+		}
+		for _, name := range append([]string{f.ObjectKey}, f.UploadParts...) {
+			if err := s.stor.Delete(ctx, name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Warn("Failed to delete orphaned file",
+					zap.String("file_id", f.ID),
+					zap.String("object", name),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+	return len(deleted), nil
+}
+
+// StorageUsage is the volume of uploaded files owned by one entity, with the
+// part not yet referenced by any response
+type StorageUsage struct {
+	EntityID        string `json:"entityId,omitempty"`
+	Files           int64  `json:"files"`
+	Bytes           int64  `json:"bytes"`
+	UnattachedFiles int64  `json:"unattachedFiles"`
+	UnattachedBytes int64  `json:"unattachedBytes"`
+}
+
+// StorageUsage reports uploaded file volume per entity, largest first, and
+// the overall total. Files not linked to a request are listed without an
+// entity. A non-empty entityID reports only that entity.
+func (s *FileService) StorageUsage(ctx context.Context, entityID string) ([]StorageUsage, StorageUsage, error) {
+	rows, err := s.queries.GetStorageUsage(ctx, entityID)
+	if err != nil {
+		return nil, StorageUsage{}, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+
+	usage := make([]StorageUsage, 0, len(rows))
+	var total StorageUsage
+	for _, r := range rows {
+		u := StorageUsage(r)
+		usage = append(usage, u)
+		total.Files += u.Files
+		total.Bytes += u.Bytes
+		total.UnattachedFiles += u.UnattachedFiles
+		total.UnattachedBytes += u.UnattachedBytes
+	}
+	return usage, total, nil
+}
+
+// OrphanCollector periodically deletes uploaded files that were never
+// attached to a response
+type OrphanCollector struct {
+	fileSvc   *FileService
+	interval  time.Duration
+	batchSize int
+	log       *zap.Logger
+}
+
+// NewOrphanCollector creates a collector that scans every interval
+func NewOrphanCollector(fileSvc *FileService, interval time.Duration, batchSize int, log *zap.Logger) *OrphanCollector {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &OrphanCollector{
+		fileSvc:   fileSvc,
+		interval:  interval,
+		batchSize: batchSize,
+		log:       log,
+	}
+}
+
+// Run collects orphaned files until ctx is cancelled
+func (c *OrphanCollector) Run(ctx context.Context) {
+	c.log.Info("Orphaned file collector started", zap.Duration("interval", c.interval))
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.collect(ctx)
+
+		select {
+		case <-ctx.Done():
+			c.log.Info("Orphaned file collector stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect drains all expired batches, stopping early on error or
+// cancellation
+func (c *OrphanCollector) collect(ctx context.Context) {
+	start := time.Now()
+	total := 0
+	for ctx.Err() == nil {
+		n, err := c.fileSvc.CollectOrphans(ctx, start, c.batchSize, c.log)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.log.Error("Orphaned file collection failed", zap.Error(err))
+			}
+			break
+		}
+		total += n
+		if n < c.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		c.log.Info("Deleted orphaned files", zap.Int("count", total), zap.Duration("duration", time.Since(start)))
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// normalizePreferences validates notification preferences and fills in
+// the default digest, digest time and timezone
+func normalizePreferences(p model.NotificationPreferences) (model.NotificationPreferences, error) {
+	if p.Channels != nil {
+		channels := make([]string, 0, len(p.Channels))
+		seen := make(map[string]bool, len(p.Channels))
+		for _, c := range p.Channels {
+			if !knownChannel(c) {
+				return p, invalid("invalid_preferences", "unknown channel "+c, nil)
+			}
+			if !seen[c] {
+				seen[c] = true
+				channels = append(channels, c)
+			}
+		}
+		p.Channels = channels
+	}
+
+	if p.QuietHours != nil {
+		start, err := model.ParseClock(p.QuietHours.Start)
+		if err != nil {
+			return p, invalid("invalid_preferences", "quietHours.start: "+err.Error(), err)
+		}
+		end, err := model.ParseClock(p.QuietHours.End)
+		if err != nil {
+			return p, invalid("invalid_preferences", "quietHours.end: "+err.Error(), err)
+		}
+		if start == end {
+			return p, invalid("invalid_preferences", "quietHours.start and quietHours.end must differ", nil)
+		}
+	}
+
+	switch p.Digest {
+	case "":
+		p.Digest = model.DigestOff
+	case model.DigestOff, model.DigestDaily, model.DigestWeekly:
+	default:
+		return p, invalid("invalid_preferences", "digest must be off, daily or weekly", nil)
+	}
+
+	if p.DigestAt == "" {
+		p.DigestAt = model.DefaultDigestAt
+	}
+	if _, err := model.ParseClock(p.DigestAt); err != nil {
+		return p, invalid("invalid_preferences", "digestAt: "+err.Error(), err)
+	}
+
+	if p.Timezone == "" {
+		p.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return p, invalid("invalid_preferences", "unknown timezone "+p.Timezone, err)
+	}
+	p.UpdatedAt = ""
+	return p, nil
+}
+
+func knownChannel(channel string) bool {
+	for _, c := range model.NotificationChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPreferences returns the notification preferences of an entity, the
+// defaults if it never set any
+func (s *EntityService) GetPreferences(ctx context.Context, entityID string) (*model.NotificationPreferences, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "preferences"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+
+	p, err := s.queries.GetNotificationPreferences(ctx, entityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		p = model.DefaultNotificationPreferences()
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	return &p, nil
+}
+
+// UpdatePreferences replaces the notification preferences of an entity
+func (s *EntityService) UpdatePreferences(ctx context.Context, entityID string, p model.NotificationPreferences) (*model.NotificationPreferences, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "preferences"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+	p, err := normalizePreferences(p)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.queries.UpsertNotificationPreferences(ctx, entityID, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update preferences: %w", err)
+	}
+	return &saved, nil
+}
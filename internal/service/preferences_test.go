@@ -0,0 +1,35 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePreferences(t *testing.T) {
+	p, err := normalizePreferences(model.NotificationPreferences{
+		Channels:   []string{"websocket", "websocket"},
+		QuietHours: &model.QuietHours{Start: "22:00", End: "07:00"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"websocket"}, p.Channels)
+	assert.Equal(t, model.DigestOff, p.Digest)
+	assert.Equal(t, model.DefaultDigestAt, p.DigestAt)
+	assert.Equal(t, "UTC", p.Timezone)
+
+	for _, bad := range []model.NotificationPreferences{
+		{Channels: []string{"carrier-pigeon"}},
+		{QuietHours: &model.QuietHours{Start: "10pm", End: "07:00"}},
+		{QuietHours: &model.QuietHours{Start: "07:00", End: "07:00"}},
+		{Digest: "hourly"},
+		{Digest: "daily", DigestAt: "8am"},
+		{Timezone: "Mars/Olympus_Mons"},
+	} {
+		_, err := normalizePreferences(bad)
+		assert.True(t, errors.Is(err, ErrValidation), "%+v", bad)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/metrics"
+)
+
+// Quotas limit how many requests a requestor can put in front of
+// responders. Zero disables a limit. They are soft: usage is counted
+// without locking, so concurrent creates can overshoot a limit slightly.
+type Quotas struct {
+	MaxOpenPerRequestor  int // Pending or claimed requests per requestor
+	MaxOpenPerEntity     int // Pending or claimed requests per target entity
+	MaxDailyPerRequestor int // Requests per requestor in the last 24 hours
+}
+
+// Enabled reports whether any limit is set
+func (q Quotas) Enabled() bool {
+	return q.MaxOpenPerRequestor > 0 || q.MaxOpenPerEntity > 0 || q.MaxDailyPerRequestor > 0
+}
+
+// QuotasFromEnv reads QUOTA_MAX_OPEN_PER_REQUESTOR,
+// QUOTA_MAX_OPEN_PER_ENTITY and QUOTA_MAX_DAILY_PER_REQUESTOR; unset
+// limits are disabled
+func QuotasFromEnv() (Quotas, error) {
+	var q Quotas
+	for name, limit := range map[string]*int{
+		"QUOTA_MAX_OPEN_PER_REQUESTOR":  &q.MaxOpenPerRequestor,
+		"QUOTA_MAX_OPEN_PER_ENTITY":     &q.MaxOpenPerEntity,
+		"QUOTA_MAX_DAILY_PER_REQUESTOR": &q.MaxDailyPerRequestor,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Quotas{}, fmt.Errorf("invalid %s %q", name, v)
+		}
+		*limit = n
+	}
+	return q, nil
+}
+
+// SetQuotas sets the limits checked by CreateRequest
+func (s *RequestService) SetQuotas(q Quotas) {
+	s.quotas = q
+}
+
+// checkQuotas refuses a new request from createdBy to entityID if it would
+// exceed a quota. queued is added to the usage in the database.
+func (s *RequestService) checkQuotas(ctx context.Context, createdBy, entityID string, queued db.QuotaUsage) error {
+	if !s.quotas.Enabled() {
+		return nil
+	}
+	usage, err := s.queries.GetQuotaUsage(ctx, createdBy, entityID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to count quota usage: %w", err)
+	}
+	usage.OpenByRequestor += queued.OpenByRequestor
+	usage.OpenByEntity += queued.OpenByEntity
+	usage.CreatedSince += queued.CreatedSince
+
+	switch {
+	case exceeds(usage.OpenByRequestor, s.quotas.MaxOpenPerRequestor):
+		return quotaExceeded("open_per_requestor", s.quotas.MaxOpenPerRequestor, "the requestor has too many open requests")
+	case exceeds(usage.OpenByEntity, s.quotas.MaxOpenPerEntity):
+		return quotaExceeded("open_per_entity", s.quotas.MaxOpenPerEntity, "the entity has too many open requests")
+	case exceeds(usage.CreatedSince, s.quotas.MaxDailyPerRequestor):
+		return quotaExceeded("daily_per_requestor", s.quotas.MaxDailyPerRequestor, "the requestor created too many requests in the last 24 hours")
+	}
+	return nil
+}
+
+// exceeds reports whether one more would go over limit
+func exceeds(used int64, limit int) bool {
+	return limit > 0 && used >= int64(limit)
+}
+
+func quotaExceeded(quota string, limit int, message string) error {
+	metrics.QuotaRejections.WithLabelValues(quota).Inc()
+	return &Error{
+		Kind:    ErrQuotaExceeded,
+		Code:    "quota_exceeded",
+		Message: message,
+		Details: map[string]interface{}{"quota": quota, "limit": limit},
+	}
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotasFromEnv(t *testing.T) {
+	t.Setenv("QUOTA_MAX_OPEN_PER_REQUESTOR", "100")
+	t.Setenv("QUOTA_MAX_DAILY_PER_REQUESTOR", "1000")
+	q, err := service.QuotasFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, service.Quotas{MaxOpenPerRequestor: 100, MaxDailyPerRequestor: 1000}, q)
+
+	t.Setenv("QUOTA_MAX_OPEN_PER_ENTITY", "-1")
+	_, err = service.QuotasFromEnv()
+	assert.Error(t, err)
+}
+
+func TestRequestService_Quotas(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("open per requestor", func(t *testing.T) {
+		f := newRequestFixture(t)
+		f.svc.SetQuotas(service.Quotas{MaxOpenPerRequestor: 2})
+		first := f.create(t, service.CreateRequestInput{})
+		f.create(t, service.CreateRequestInput{})
+
+		input := service.CreateRequestInput{Schema: nameSchema, CreatedBy: "client-1"}
+		input.Entity.Handle = "ada"
+		_, err := f.svc.CreateRequest(ctx, input)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+		e := service.Classify(err)
+		assert.Equal(t, "quota_exceeded", e.Code)
+		assert.Equal(t, map[string]interface{}{"quota": "open_per_requestor", "limit": 2}, e.Details)
+
+		// Other requestors are not affected, and answering frees a slot
+		f.create(t, service.CreateRequestInput{CreatedBy: "client-2"})
+		_, err = f.svc.PostResponse(ctx, first.ID, f.entity.ID, map[string]interface{}{"name": "Ada"}, nil, nil)
+		require.NoError(t, err)
+		f.create(t, service.CreateRequestInput{})
+	})
+
+	t.Run("open per entity", func(t *testing.T) {
+		f := newRequestFixture(t)
+		f.svc.SetQuotas(service.Quotas{MaxOpenPerEntity: 1})
+		f.create(t, service.CreateRequestInput{})
+
+		input := service.CreateRequestInput{Schema: nameSchema, CreatedBy: "client-2"}
+		input.Entity.Handle = "ada"
+		_, err := f.svc.CreateRequest(ctx, input)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+
+	t.Run("daily per requestor", func(t *testing.T) {
+		f := newRequestFixture(t)
+		f.svc.SetQuotas(service.Quotas{MaxDailyPerRequestor: 1})
+		req := f.create(t, service.CreateRequestInput{})
+		require.NoError(t, f.svc.CancelRequest(ctx, req.ID, nil))
+
+		// Closed requests still count towards the daily quota
+		input := service.CreateRequestInput{Schema: nameSchema, CreatedBy: "client-1"}
+		input.Entity.Handle = "ada"
+		_, err := f.svc.CreateRequest(ctx, input)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"pxbox/internal/db"
+	"pxbox/internal/seal"
+)
+
+// rekeyBatch is how many rows Rekey reads at a time
+const rekeyBatch = 500
+
+// RekeyStats counts the values Rekey examined and rewrote
+type RekeyStats struct {
+	Prefills         int `json:"prefills"`
+	PrefillsSealed   int `json:"prefillsSealed"`
+	Payloads         int `json:"payloads"`
+	PayloadsSealed   int `json:"payloadsSealed"`
+	SkippedPlaintext int `json:"skippedPlaintext"` // Plaintext values left alone
+}
+
+// Rekey encrypts the stored prefills and response payloads sealed under a
+// master key other than the current one again under the current key, so
+// old keys can be retired. Plaintext values stored before encryption was
+// enabled are encrypted too when encryptPlaintext is set.
+func (s *RequestService) Rekey(ctx context.Context, encryptPlaintext bool) (RekeyStats, error) {
+	var stats RekeyStats
+	if !s.sealer.Enabled() {
+		return stats, fmt.Errorf("payload encryption is not configured")
+	}
+
+	prefills, sealed, skipped, err := s.rekey(ctx, s.queries.ListPrefills, s.queries.UpdatePrefill, prefillField, encryptPlaintext)
+	stats.Prefills, stats.PrefillsSealed, stats.SkippedPlaintext = prefills, sealed, skipped
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey prefills: %w", err)
+	}
+
+	payloads, sealed, skipped, err := s.rekey(ctx, s.queries.ListResponsePayloads, s.queries.UpdateResponsePayload, payloadField, encryptPlaintext)
+	stats.Payloads, stats.PayloadsSealed = payloads, sealed
+	stats.SkippedPlaintext += skipped
+	if err != nil {
+		return stats, fmt.Errorf("failed to rekey response payloads: %w", err)
+	}
+	return stats, nil
+}
+
+func (s *RequestService) rekey(
+	ctx context.Context,
+	list func(ctx context.Context, afterID string, limit int) ([]db.StoredValue, error),
+	update func(ctx context.Context, id string, value map[string]interface{}) error,
+	field func(id string) string,
+	encryptPlaintext bool,
+) (examined, sealed, skipped int, err error) {
+	after := ""
+	for {
+		values, err := list(ctx, after, rekeyBatch)
+		if err != nil {
+			return examined, sealed, skipped, err
+		}
+		for _, v := range values {
+			examined++
+			after = v.ID
+			if !s.sealer.Stale(v.Value) {
+				continue
+			}
+			if !seal.IsSealed(v.Value) && !encryptPlaintext {
+				skipped++
+				continue
+			}
+
+			opened, err := s.sealer.Open(ctx, v.Value, field(v.ID))
+			if err != nil {
+				return examined, sealed, skipped, fmt.Errorf("%s: %w", v.ID, err)
+			}
+			resealed, err := s.sealer.Seal(ctx, opened, field(v.ID))
+			if err != nil {
+				return examined, sealed, skipped, fmt.Errorf("%s: %w", v.ID, err)
+			}
+			if err := update(ctx, v.ID, resealed); err != nil {
+				return examined, sealed, skipped, fmt.Errorf("%s: %w", v.ID, err)
+			}
+			sealed++
+		}
+		if len(values) < rekeyBatch {
+			return examined, sealed, skipped, nil
+		}
+	}
+}
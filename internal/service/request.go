@@ -2,23 +2,47 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
 	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/fieldmask"
+	"pxbox/internal/jobs"
+	"pxbox/internal/mailin"
 	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+	"pxbox/internal/scan"
 	"pxbox/internal/schema"
+	"pxbox/internal/seal"
 	"pxbox/internal/storage"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/oklog/ulid/v2"
 )
 
 type RequestService struct {
-	queries      *db.Queries
+	queries      db.Querier
 	schemaComp   *schema.Compiler
 	entitySvc    *EntityService
 	bus          EventBus
 	jobClient    JobClient
+	audit        *audit.Logger
+	scanEnforce  scan.Enforcement
+	fileResolver storage.URLResolver
+	fileStorage  storage.Storage
+	claimTTL     time.Duration
+	sealer       *seal.Sealer
+	quotas       Quotas
+	strictHints  bool
+	respLimits   schema.ResponseLimits
+	replyAddr    *mailin.Addresser
 }
 
 type EventBus interface {
@@ -27,7 +51,7 @@ type EventBus interface {
 	PublishRequestor(clientID string, event map[string]interface{}) error
 }
 
-func NewRequestService(queries *db.Queries, schemaComp *schema.Compiler, entitySvc *EntityService, bus EventBus) *RequestService {
+func NewRequestService(queries db.Querier, schemaComp *schema.Compiler, entitySvc *EntityService, bus EventBus) *RequestService {
 	return &RequestService{
 		queries:   queries,
 		schemaComp: schemaComp,
@@ -42,6 +66,55 @@ func (s *RequestService) SetJobClient(client JobClient) {
 	s.jobClient = client
 }
 
+// SetFileResolver lets the service map response file URLs back to storage
+// objects, so referenced uploads are kept and their scan status checked
+func (s *RequestService) SetFileResolver(resolver storage.URLResolver) {
+	s.fileResolver = resolver
+}
+
+// SetFileStorage lets the service hand out presigned download URLs for
+// request attachments stored there. It needs a file resolver.
+func (s *RequestService) SetFileStorage(stor storage.Storage) {
+	s.fileStorage = stor
+}
+
+// SetFileScanEnforcement makes PostResponse reject files uploaded through
+// the file proxy whose scan status enforce does not allow. It needs a file
+// resolver.
+func (s *RequestService) SetFileScanEnforcement(enforce scan.Enforcement) {
+	s.scanEnforce = enforce
+}
+
+// SetAuditLogger sets the audit logger for recording state changes
+func (s *RequestService) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// SetSealer makes the service encrypt prefills and response payloads before
+// storing them. Values are decrypted when read, also those stored before.
+func (s *RequestService) SetSealer(sealer *seal.Sealer) {
+	s.sealer = sealer
+}
+
+// SetResponseLimits sets the server-wide limits on response payloads,
+// applied on top of those declared in a request schema's "x-limits"
+func (s *RequestService) SetResponseLimits(limits schema.ResponseLimits) {
+	s.respLimits = limits
+}
+
+// StrictUIHintsFromEnv reports whether UI_HINTS_STRICT is set, in which case
+// uiHints with unknown keys are rejected instead of stored as they are
+func StrictUIHintsFromEnv() bool {
+	v, _ := strconv.ParseBool(os.Getenv("UI_HINTS_STRICT"))
+	return v
+}
+
+// SetStrictUIHints makes CreateRequest reject uiHints with keys outside the
+// hint vocabulary
+func (s *RequestService) SetStrictUIHints(strict bool) {
+	s.strictHints = strict
+}
+
 type CreateRequestInput struct {
 	Entity      struct {
 		ID     string `json:"id"`
@@ -52,18 +125,75 @@ type CreateRequestInput struct {
 	Prefill     map[string]interface{} `json:"prefill,omitempty"`
 	ExpiresAt   *time.Time             `json:"expiresAt,omitempty"`
 	DeadlineAt  *time.Time              `json:"deadlineAt,omitempty"`
+	// DeadlineIn sets the deadline as working time from now, e.g. "3
+	// business days", counted in the entity's business calendar
+	DeadlineIn  *string                 `json:"deadlineIn,omitempty"`
 	AttentionAt *time.Time              `json:"attentionAt,omitempty"`
 	CallbackURL *string                 `json:"callbackUrl,omitempty"`
+	// CallbackFields limits the response delivered to CallbackURL
+	CallbackFields []string             `json:"callbackFields,omitempty"`
 	FilesPolicy map[string]interface{}  `json:"filesPolicy,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	// Locale is the language the schema's own texts are written in; readers
+	// asking for a language without a translation fall back to it
+	Locale      *string                 `json:"locale,omitempty"`
+	// Timezone is the IANA zone deadlines are displayed in, e.g. "Europe/Prague"
+	Timezone    *string                 `json:"timezone,omitempty"`
+	// Attachments are files from the requestor, e.g. instructions, in the
+	// metadata format of response files
+	Attachments []map[string]interface{} `json:"attachments,omitempty"`
 	CreatedBy   string
+
+	bundleID string // Set by CreateBundle
 }
 
 func (s *RequestService) CreateRequest(ctx context.Context, input CreateRequestInput) (*model.Request, error) {
+	p, err := s.prepareRequest(ctx, input, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create request in database
+	var req db.Request
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		req, err = q.CreateRequest(ctx, p.params)
+		if err != nil {
+			return err
+		}
+		return s.insertRequestExtras(ctx, q, p, req)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	return s.requestCreated(ctx, p, req), nil
+}
+
+// preparedRequest is a validated request ready to be inserted
+type preparedRequest struct {
+	input       CreateRequestInput
+	entity      *model.Entity
+	params      db.CreateRequestParams
+	attachments []map[string]interface{}
+	maintenance *db.MaintenanceWindow // The window that deferred it, if any
+}
+
+// prepareRequest resolves the entity of input, checks quotas and validates
+// the request. queued holds the requests of the same batch that are not
+// inserted yet; it is nil outside batches.
+func (s *RequestService) prepareRequest(ctx context.Context, input CreateRequestInput, queued *batchQuota) (*preparedRequest, error) {
 	// Resolve entity
 	entity, err := s.entitySvc.ResolveEntity(ctx, input.Entity.ID, input.Entity.Handle)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve entity: %w", err)
 	}
+	if entity.DeactivatedAt != nil {
+		return nil, ErrEntityDeactivated
+	}
+	if err := s.checkQuotas(ctx, input.CreatedBy, entity.ID, queued.usage(entity.ID)); err != nil {
+		return nil, err
+	}
 
 	// Detect schema kind
 	schemaKind := detectSchemaKind(input.Schema)
@@ -71,9 +201,71 @@ func (s *RequestService) CreateRequest(ctx context.Context, input CreateRequestI
 	// Validate schema if it's a JSON Schema
 	if schemaKind == model.SchemaKindJSON || schemaKind == model.SchemaKindRef {
 		if err := s.schemaComp.Prepare(ctx, input.Schema); err != nil {
-			return nil, fmt.Errorf("invalid schema: %w", err)
+			if errors.Is(err, schema.ErrSchemaTooComplex) || errors.Is(err, schema.ErrCompileTimeout) {
+				return nil, invalid("schema_too_complex", "schema exceeds the compile limits", err)
+			}
+			return nil, invalid("invalid_schema", "invalid schema", err)
+		}
+		if err := s.schemaComp.PreparePages(ctx, input.Schema); err != nil {
+			return nil, invalid("invalid_schema", "invalid schema pages", err)
 		}
 	}
+	if _, err := schema.ResponseLimitsOf(input.Schema); err != nil {
+		return nil, invalid("invalid_schema", "invalid schema limits", err)
+	}
+
+	if _, err := fieldmask.ParseList(input.CallbackFields); err != nil {
+		return nil, invalid("invalid_fields", "invalid callbackFields", err)
+	}
+
+	tags, err := NormalizeTags(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, invalid("invalid_expiry", "expiresAt must be in the future", nil)
+	}
+
+	if input.Locale != nil && !schema.ValidLocale(*input.Locale) {
+		return nil, invalid("invalid_locale", "locale must be a language tag such as en or pt-BR", nil)
+	}
+	if err := checkTimezone(input.Timezone); err != nil {
+		return nil, err
+	}
+	attachments, err := s.checkAttachments(ctx, input.Attachments, input.FilesPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.CheckI18n(input.Schema); err != nil {
+		return nil, invalid("invalid_schema", "invalid schema translations", err)
+	}
+	if err := schema.CheckI18n(input.UIHints); err != nil {
+		return nil, invalid("invalid_ui_hints", "invalid uiHints translations", err)
+	}
+	var hintsSchema map[string]interface{}
+	if schemaKind == model.SchemaKindJSON {
+		hintsSchema = input.Schema
+	}
+	if input.UIHints, err = schema.NormalizeHints(input.UIHints, hintsSchema, s.strictHints); err != nil {
+		return nil, invalid("invalid_ui_hints", "invalid uiHints", err)
+	}
+
+	now := time.Now()
+	deadlineAt, err := s.resolveDeadline(ctx, entity.ID, input, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests arriving while the entity is away are deferred
+	maintenance, deadlineAt, err := s.deferForMaintenance(ctx, entity.ID, deadlineAt, now)
+	if err != nil {
+		return nil, err
+	}
+	var deferredUntil *time.Time
+	if maintenance != nil {
+		deferredUntil = &maintenance.EndsAt
+	}
 
 	// Generate request ID
 	requestID := ulid.Make().String()
@@ -83,105 +275,286 @@ func (s *RequestService) CreateRequest(ctx context.Context, input CreateRequestI
 		input.UIHints = make(map[string]interface{})
 	}
 
-	// Create request in database
-	req, err := s.queries.CreateRequest(ctx, db.CreateRequestParams{
-		ID:              requestID,
-		CreatedBy:       input.CreatedBy,
-		EntityID:        entity.ID,
-		Status:          string(model.StatusPending),
-		SchemaKind:      string(schemaKind),
-		SchemaPayload:   input.Schema,
-		UIHints:         input.UIHints,
-		Prefill:         input.Prefill,
-		ExpiresAt:       input.ExpiresAt,
-		DeadlineAt:      input.DeadlineAt,
-		AttentionAt:     input.AttentionAt,
-		CallbackURL:     input.CallbackURL,
-		FilesPolicy:     input.FilesPolicy,
-	})
+	prefill, err := s.sealer.Seal(ctx, input.Prefill, prefillField(requestID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to encrypt prefill: %w", err)
 	}
 
-	// Publish event
-	_ = s.bus.PublishEntity(entity.ID, map[string]interface{}{
-		"type":      "request.created",
-		"requestId":  requestID,
-		"entityId":   entity.ID,
-	})
+	return &preparedRequest{
+		input:  input,
+		entity: entity,
+		params: db.CreateRequestParams{
+			ID:              requestID,
+			CreatedBy:       input.CreatedBy,
+			EntityID:        entity.ID,
+			Status:          string(model.StatusPending),
+			SchemaKind:      string(schemaKind),
+			SchemaPayload:   input.Schema,
+			UIHints:         input.UIHints,
+			Prefill:         prefill,
+			ExpiresAt:       input.ExpiresAt,
+			DeadlineAt:      deadlineAt,
+			AttentionAt:     input.AttentionAt,
+			CallbackURL:     input.CallbackURL,
+			CallbackFields:  input.CallbackFields,
+			Sandbox:         entity.Sandbox,
+			Tags:            tags,
+			FilesPolicy:     input.FilesPolicy,
+			Locale:          input.Locale,
+			Timezone:        input.Timezone,
+			DeferredUntil:   deferredUntil,
+		},
+		attachments: attachments,
+		maintenance: maintenance,
+	}, nil
+}
 
-	_ = s.bus.PublishRequestor(input.CreatedBy, map[string]interface{}{
-		"type":      "request.created",
-		"requestId":  requestID,
+// insertRequestExtras stores what belongs to a new request besides its row,
+// in the transaction that inserted it. With the job queue in the database,
+// the request's jobs are enqueued there too, so neither exists without the
+// other.
+func (s *RequestService) insertRequestExtras(ctx context.Context, q db.Querier, p *preparedRequest, req db.Request) error {
+	if len(p.attachments) > 0 {
+		if err := q.CreateRequestFiles(ctx, req.ID, p.attachments, s.fileKeys(p.attachments)); err != nil {
+			return err
+		}
+	}
+	if txJobs, ok := s.jobClient.(TxJobClient); ok {
+		scheduleRequestJobs(ctx, txJobs.WithQuerier(q), q, req)
+	}
+	return nil
+}
+
+// requestCreated audits and announces a request once it is committed and
+// schedules its jobs
+func (s *RequestService) requestCreated(ctx context.Context, p *preparedRequest, req db.Request) *model.Request {
+	input, entity := p.input, p.entity
+	requestID := req.ID
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionCreate,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   requestID,
+		AfterStatus:  req.Status,
+		Meta:         map[string]interface{}{"entityId": entity.ID, "createdBy": input.CreatedBy},
 	})
 
-	// Schedule background jobs if job client is available
-	if s.jobClient != nil {
-		// Schedule deadline notification (1h before)
-		if req.DeadlineAt != nil {
-			_ = s.jobClient.ScheduleDeadlineNotification(requestID, *req.DeadlineAt)
-			_ = s.jobClient.ScheduleDeadlineExpiry(requestID, *req.DeadlineAt)
+	// Publish event
+	created := events.RequestCreated{RequestID: requestID, EntityID: entity.ID, BundleID: input.bundleID}
+	_ = s.bus.PublishEntity(entity.ID, pubsub.MarkSandbox(events.New(ctx, created), req.Sandbox))
+
+	created.EntityID = ""
+	_ = s.bus.PublishRequestor(input.CreatedBy, pubsub.MarkSandbox(events.New(ctx, created), req.Sandbox))
+
+	if w := p.maintenance; w != nil {
+		deferred := events.RequestDeferred{
+			RequestID:     requestID,
+			EntityID:      entity.ID,
+			DeferredUntil: w.EndsAt.UTC().Format(time.RFC3339),
+			Reason:        w.Reason,
+		}
+		if w.PauseDeadlines && req.DeadlineAt != nil {
+			deadline := req.DeadlineAt.UTC().Format(time.RFC3339)
+			deferred.DeadlineAt = &deadline
 		}
+		_ = s.bus.PublishRequestor(input.CreatedBy, pubsub.MarkSandbox(events.New(ctx, deferred), req.Sandbox))
+	}
 
-		// Schedule attention notification
-		if req.AttentionAt != nil {
-			_ = s.jobClient.ScheduleAttentionNotification(requestID, *req.AttentionAt)
+	// Schedule background jobs if job client is available
+	if s.jobClient != nil {
+		// Deadline notification (1h before), expiry, auto-cancel and
+		// attention notification, unless they were enqueued with the request
+		if _, transactional := s.jobClient.(TxJobClient); !transactional {
+			scheduleRequestJobs(ctx, s.jobClient, s.queries, req)
 		}
 
-		// Schedule auto-cancel if grace period is set
-		if req.AutocancelGrace != nil && *req.AutocancelGrace > 0 {
-			// Auto-cancel after expiry + grace period
-			if req.DeadlineAt != nil {
-				cancelAt := req.DeadlineAt.Add(*req.AutocancelGrace)
-				_ = s.jobClient.ScheduleAutoCancel(requestID, time.Until(cancelAt))
-			}
+		// Push requests addressed to a bot to its handler, and tell other
+		// entities on their devices unless they are away
+		if entity.Kind == model.EntityKindBot {
+			s.dispatchToBot(ctx, requestID, entity.ID)
+		} else if p.maintenance == nil && !req.Sandbox {
+			s.notifyOutOfBand(ctx, requestID, entity.ID)
 		}
 	}
 
-	return dbRequestToModel(req), nil
+	result := dbRequestToModel(req)
+	result.Prefill = input.Prefill
+	return result
 }
 
 func (s *RequestService) GetRequest(ctx context.Context, id string) (*model.Request, error) {
 	req, err := s.queries.GetRequestByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("request not found: %w", err)
+		return nil, lookupError("request", err)
+	}
+	result, err := s.requestModel(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	bundleIDs, err := s.queries.GetRequestBundleIDs(ctx, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request bundle: %w", err)
+	}
+	if bundleID, ok := bundleIDs[id]; ok {
+		result.BundleID = &bundleID
 	}
-	return dbRequestToModel(req), nil
+	if result.Attachments, err = s.attachments(ctx, req); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetLocalizedRequest is GetRequest with the schema and UI hints resolved
+// into the first of locales that has translations, falling back on the
+// request's own locale. Translations are resolved per text, so one missing
+// from a bundle shows in the original language.
+func (s *RequestService) GetLocalizedRequest(ctx context.Context, id string, locales []string) (*model.Request, error) {
+	req, err := s.GetRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Locale != nil {
+		locales = append(locales, *req.Locale)
+	}
+	req.SchemaPayload = schema.Localize(req.SchemaPayload, locales)
+	req.UIHints = schema.LocalizeHints(req.UIHints, locales)
+	return req, nil
+}
+
+// GetRequestSchema returns the JSON Schema answers to a request are
+// validated against, localized like GetLocalizedRequest: the request's
+// schema, or for a jsonexample request the schema inferred from its example
+func (s *RequestService) GetRequestSchema(ctx context.Context, id string, locales []string) (map[string]interface{}, error) {
+	req, err := s.GetLocalizedRequest(ctx, id, locales)
+	if err != nil {
+		return nil, err
+	}
+	if req.SchemaKind == model.SchemaKindExample {
+		return schema.ExampleSchema(req.SchemaPayload), nil
+	}
+	return req.SchemaPayload, nil
 }
 
 func (s *RequestService) GetResponseByRequestID(ctx context.Context, requestID string) (*model.Response, error) {
 	resp, err := s.queries.GetResponseByRequestID(ctx, requestID)
 	if err != nil {
-		return nil, fmt.Errorf("response not found: %w", err)
+		return nil, lookupError("response", err)
 	}
-	return dbResponseToModel(resp), nil
+	if resp.Payload, err = s.sealer.Open(ctx, resp.Payload, payloadField(resp.ID)); err != nil {
+		return nil, fmt.Errorf("failed to decrypt response: %w", err)
+	}
+	result := dbResponseToModel(resp)
+
+	// Anonymous callers do not see properties the schema marks x-sensitive
+	if auth.GetUserID(ctx) == "" && auth.GetEntityID(ctx) == "" {
+		req, err := s.queries.GetRequestByID(ctx, requestID)
+		if err != nil {
+			return nil, lookupError("request", err)
+		}
+		if paths := schema.SensitivePaths(req.SchemaPayload); len(paths) > 0 {
+			result.Payload = schema.Redact(result.Payload, paths)
+			result.Redacted = true
+		}
+	}
+	return result, nil
 }
 
-func (s *RequestService) ClaimRequest(ctx context.Context, id string) error {
-	err := s.queries.ClaimRequest(ctx, id)
+// ClaimRequest claims a pending request for the caller. If expectedVersion
+// is set, the claim only succeeds at that version. With a claim TTL the
+// claim is released automatically once it lapses.
+func (s *RequestService) ClaimRequest(ctx context.Context, id string, expectedVersion *int) error {
+	claimedBy := auth.Actor(ctx)
+	var expiresAt *time.Time
+	if s.claimTTL > 0 {
+		t := time.Now().Add(s.claimTTL)
+		expiresAt = &t
+	}
+
+	err := s.queries.ClaimRequest(ctx, id, claimedBy, expiresAt, expectedVersion)
 	if err != nil {
-		return fmt.Errorf("failed to claim request: %w", err)
+		return fmt.Errorf("failed to claim request: %w", s.transitionError(ctx, id, model.StatusClaimed, expectedVersion, err))
 	}
 
-	req, _ := s.queries.GetRequestByID(ctx, id)
-	_ = s.bus.PublishRequest(id, map[string]interface{}{
-		"type": "request.claimed",
-		"requestId": id,
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionClaim,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		BeforeStatus: string(model.StatusPending),
+		AfterStatus:  string(model.StatusClaimed),
 	})
 
-	_ = s.bus.PublishEntity(req.EntityID, map[string]interface{}{
-		"type": "request.claimed",
-		"requestId": id,
-	})
+	if expiresAt != nil && s.jobClient != nil {
+		_ = s.jobClient.ScheduleClaimExpiry(ctx, id, *expiresAt)
+	}
+
+	req, _ := s.queries.GetRequestByID(ctx, id)
+	claimed := events.RequestClaimed{
+		RequestID: id,
+		ClaimedBy: claimedBy,
+		ClaimedAt: timePtrToString(req.ClaimedAt),
+	}
+	if expiresAt != nil {
+		claimed.ClaimExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	event := pubsub.MarkSandbox(events.New(ctx, claimed), req.Sandbox)
+	_ = s.bus.PublishRequest(id, event)
+	_ = s.bus.PublishEntity(req.EntityID, event)
 
 	return nil
 }
 
-func (s *RequestService) PostResponse(ctx context.Context, requestID string, answeredBy string, payload map[string]interface{}, files []map[string]interface{}) (*model.Response, error) {
+// MarkDelivered records that the calling entity's client received a request
+// and announces request.delivered to the requestor. Repeated
+// acknowledgements are ignored; only the target entity may acknowledge.
+func (s *RequestService) MarkDelivered(ctx context.Context, id string) error {
+	notTarget := &Error{Kind: ErrForbidden, Code: "not_target", Message: "only the target entity can acknowledge delivery"}
+	entityID := auth.GetEntityID(ctx)
+	if entityID == "" {
+		return notTarget
+	}
+
+	deliveredAt, err := s.queries.MarkRequestDelivered(ctx, id, entityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		req, err := s.queries.GetRequestRef(ctx, id)
+		if err != nil {
+			return lookupError("request", err)
+		}
+		if req.EntityID != entityID {
+			return notTarget
+		}
+		return nil // Already delivered
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark request delivered: %w", err)
+	}
+
+	req, _ := s.queries.GetRequestRef(ctx, id)
+	event := pubsub.MarkSandbox(events.New(ctx, events.RequestDelivered{
+		RequestID:   id,
+		EntityID:    entityID,
+		DeliveredAt: deliveredAt.UTC().Format(time.RFC3339),
+	}), req.Sandbox)
+	_ = s.bus.PublishRequest(id, event)
+	_ = s.bus.PublishRequestor(req.CreatedBy, event)
+	return nil
+}
+
+// PostResponse answers a request. If expectedVersion is set, the answer is
+// only accepted at that version.
+func (s *RequestService) PostResponse(ctx context.Context, requestID string, answeredBy string, payload map[string]interface{}, files []map[string]interface{}, expectedVersion *int) (*model.Response, error) {
 	// Get request
 	req, err := s.queries.GetRequestByID(ctx, requestID)
 	if err != nil {
-		return nil, fmt.Errorf("request not found: %w", err)
+		return nil, lookupError("request", err)
+	}
+	if expectedVersion != nil && req.Version != *expectedVersion {
+		return nil, fmt.Errorf("%w: expected version %d, current version %d", ErrVersionConflict, *expectedVersion, req.Version)
+	}
+	if isExpired(req, time.Now()) {
+		return nil, ErrRequestExpired
+	}
+	if err := model.RequestStatusMachine.Check(model.Status(req.Status), model.StatusAnswered); err != nil {
+		return nil, transitionConflict(err)
 	}
 
 	// If answeredBy is not provided or empty, use the request's entityId
@@ -193,14 +566,15 @@ func (s *RequestService) PostResponse(ctx context.Context, requestID string, ans
 	// Validate that the answeredBy entity exists
 	// Check via database query since EntityService doesn't expose GetEntity
 	if _, err := s.queries.GetEntityByID(ctx, answeredBy); err != nil {
-		return nil, fmt.Errorf("entity not found: %w", err)
+		return nil, lookupError("entity", err)
 	}
 
-	// Validate payload against schema
-	if req.SchemaKind == string(model.SchemaKindJSON) || req.SchemaKind == string(model.SchemaKindRef) {
-		if err := s.schemaComp.Validate(ctx, req.SchemaKind, req.SchemaPayload, payload); err != nil {
-			return nil, fmt.Errorf("schema validation failed: %w", err)
-		}
+	// Size limits first, so an oversized answer is not validated in full
+	if err := s.checkResponseLimits(req, payload); err != nil {
+		return nil, err
+	}
+	if err := s.validatePayload(ctx, req, payload); err != nil {
+		return nil, err
 	}
 
 	// Create response
@@ -214,61 +588,171 @@ func (s *RequestService) PostResponse(ctx context.Context, requestID string, ans
 		// Normalize and validate file metadata
 		normalized, err := storage.NormalizeFiles(filesParam)
 		if err != nil {
-			return nil, fmt.Errorf("invalid file metadata: %w", err)
+			return nil, invalid("invalid_files", "invalid file metadata", err)
 		}
 		filesParam = normalized
+		if err := s.checkFileScans(ctx, filesParam); err != nil {
+			return nil, err
+		}
 	}
-	resp, err := s.queries.CreateResponse(ctx, db.CreateResponseParams{
-		ID:         responseID,
-		RequestID:  requestID,
-		AnsweredBy: answeredBy,
-		Payload:    payload,
-		Files:      filesParam,
-	})
+	stored, err := s.sealer.Seal(ctx, payload, payloadField(responseID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create response: %w", err)
+		return nil, fmt.Errorf("failed to encrypt response: %w", err)
 	}
 
-	// Update request status
-	if err := s.queries.UpdateRequestStatus(ctx, requestID, string(model.StatusAnswered)); err != nil {
-		return nil, fmt.Errorf("failed to update request status: %w", err)
+	// Store the response and mark the request answered in one statement, so
+	// a concurrent cancel cannot interleave. The uploads it references are
+	// kept from garbage collection in the same transaction.
+	var resp db.Response
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		resp, err = q.AnswerRequest(ctx, db.CreateResponseParams{
+			ID:         responseID,
+			RequestID:  requestID,
+			AnsweredBy: answeredBy,
+			Payload:    stored,
+			Files:      filesParam,
+		}, &req.Version)
+		if err != nil {
+			return err
+		}
+		if keys := s.fileKeys(filesParam); len(keys) > 0 {
+			return q.AttachFilesToResponse(ctx, responseID, keys)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create response: %w", s.transitionError(ctx, requestID, model.StatusAnswered, &req.Version, err))
 	}
 
-	// Publish events
-	_ = s.bus.PublishRequest(requestID, map[string]interface{}{
-		"type": "request.answered",
-		"requestId": requestID,
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionAnswer,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   requestID,
+		BeforeStatus: req.Status,
+		AfterStatus:  string(model.StatusAnswered),
+		Meta:         map[string]interface{}{"responseId": responseID, "answeredBy": answeredBy},
 	})
 
-	_ = s.bus.PublishRequestor(req.CreatedBy, map[string]interface{}{
-		"type":      "request.answered",
-		"requestId":  requestID,
-		"payload":    payload,
-		"files":      files,
-	})
+	// Publish events
+	_ = s.bus.PublishRequest(requestID, pubsub.MarkSandbox(events.New(ctx, events.RequestAnswered{
+		RequestID: requestID,
+	}), req.Sandbox))
+
+	// Properties the schema marks x-sensitive are masked; the full answer is
+	// only returned by GET /v1/requests/{id}/response
+	answered := events.RequestAnswered{
+		RequestID: requestID,
+		Payload:   payload,
+		Files:     files,
+	}
+	if paths := schema.SensitivePaths(req.SchemaPayload); len(paths) > 0 {
+		answered.Payload = schema.Redact(payload, paths)
+		answered.Redacted = true
+	}
+	_ = s.bus.PublishRequestor(req.CreatedBy, pubsub.MarkSandbox(events.New(ctx, answered), req.Sandbox))
+
+	// Deliver to the requestor's callback URL in the background
+	if s.jobClient != nil && req.CallbackURL != nil && *req.CallbackURL != "" {
+		_ = s.jobClient.EnqueueCallback(ctx, requestID)
+	}
+
+	// Render previews of image and PDF attachments in the background
+	if s.jobClient != nil {
+		for _, f := range filesParam {
+			mime, _ := f["mime"].(string)
+			url, _ := f["url"].(string)
+			if !strings.HasPrefix(mime, "image/") && !strings.HasPrefix(mime, "application/pdf") {
+				continue
+			}
+			_ = s.jobClient.EnqueueThumbnail(ctx, jobs.ThumbnailJob{
+				ResponseID: responseID,
+				RequestID:  requestID,
+				URL:        url,
+				MIME:       mime,
+			})
+		}
+	}
 
+	// Announce the bundle this answer completes, if any
+	s.completeBundle(ctx, requestID, req.Sandbox)
+
+	resp.Payload = payload
 	return dbResponseToModel(resp), nil
 }
 
-func (s *RequestService) CancelRequest(ctx context.Context, id string) error {
-	if err := s.queries.UpdateRequestStatus(ctx, id, string(model.StatusCancelled)); err != nil {
-		return fmt.Errorf("failed to cancel request: %w", err)
+// CancelRequest cancels an open request. If expectedVersion is set, the
+// cancellation only succeeds at that version.
+func (s *RequestService) CancelRequest(ctx context.Context, id string, expectedVersion *int) error {
+	req, _ := s.queries.GetRequestByID(ctx, id)
+	if err := s.queries.UpdateRequestStatus(ctx, id, string(model.StatusCancelled), expectedVersion); err != nil {
+		return fmt.Errorf("failed to cancel request: %w", s.transitionError(ctx, id, model.StatusCancelled, expectedVersion, err))
 	}
 
-	req, _ := s.queries.GetRequestByID(ctx, id)
-	_ = s.bus.PublishRequest(id, map[string]interface{}{
-		"type": "request.cancelled",
-		"requestId": id,
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionCancel,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		BeforeStatus: req.Status,
+		AfterStatus:  string(model.StatusCancelled),
 	})
 
-	_ = s.bus.PublishEntity(req.EntityID, map[string]interface{}{
-		"type": "request.cancelled",
-		"requestId": id,
+	_ = s.bus.PublishRequest(id, pubsub.MarkSandbox(events.New(ctx, events.RequestCancelled{
+		RequestID: id,
+	}), req.Sandbox))
+
+	_ = s.bus.PublishEntity(req.EntityID, pubsub.MarkSandbox(events.New(ctx, events.RequestCancelled{
+		RequestID: id,
+	}), req.Sandbox))
+
+	return nil
+}
+
+// DeleteRequest soft-deletes a request so it no longer appears in inboxes. If
+// expectedVersion is set, the deletion only succeeds at that version.
+func (s *RequestService) DeleteRequest(ctx context.Context, id string, expectedVersion *int) error {
+	req, _ := s.queries.GetRequestByID(ctx, id)
+	if err := s.queries.SoftDeleteInquiry(ctx, id, expectedVersion); err != nil {
+		return fmt.Errorf("failed to delete request: %w", s.transitionError(ctx, id, "", expectedVersion, err))
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionDelete,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		BeforeStatus: req.Status,
+		AfterStatus:  req.Status,
 	})
 
 	return nil
 }
 
+// validatePayload checks an answer against the request's JSON Schema, or
+// the schema inferred from its example
+func (s *RequestService) validatePayload(ctx context.Context, req db.Request, payload map[string]interface{}) error {
+	if err := s.schemaComp.Validate(ctx, req.SchemaKind, req.SchemaPayload, payload); err != nil {
+		verr := &Error{Kind: ErrValidation, Code: "validation_failed", Message: "schema validation failed", Err: err}
+		if violations := schema.Violations(err); len(violations) > 0 {
+			verr.Details = violations
+		}
+		return verr
+	}
+	return nil
+}
+
+// checkResponseLimits enforces the "x-limits" of the request's schema and
+// the server-wide response limits
+func (s *RequestService) checkResponseLimits(req db.Request, payload map[string]interface{}) error {
+	// Declared limits were checked when the request was created
+	limits, _ := schema.ResponseLimitsOf(req.SchemaPayload)
+	err := limits.Within(s.respLimits).Check(payload)
+	var lerr *schema.ResponseLimitError
+	if errors.As(err, &lerr) {
+		return &Error{Kind: ErrTooLarge, Code: "payload_too_large", Message: "response payload too large", Details: lerr.LimitViolation, Err: err}
+	}
+	return err
+}
+
 func detectSchemaKind(schema map[string]interface{}) model.SchemaKind {
 	if _, ok := schema["$ref"]; ok {
 		return model.SchemaKindRef
@@ -280,7 +764,7 @@ func detectSchemaKind(schema map[string]interface{}) model.SchemaKind {
 }
 
 func dbRequestToModel(r db.Request) *model.Request {
-	return &model.Request{
+	req := &model.Request{
 		ID:            r.ID,
 		CreatedBy:     r.CreatedBy,
 		EntityID:      r.EntityID,
@@ -293,15 +777,48 @@ func dbRequestToModel(r db.Request) *model.Request {
 		DeadlineAt:    timePtrToString(r.DeadlineAt),
 		AttentionAt:   timePtrToString(r.AttentionAt),
 		CallbackURL:   r.CallbackURL,
+		CallbackFields: r.CallbackFields,
 		FilesPolicy:   r.FilesPolicy,
 		FlowID:        r.FlowID,
+		Sandbox:       r.Sandbox,
+		Tags:          r.Tags,
+		DeliveredAt:   timePtrToString(r.DeliveredAt),
+		ReadAt:        timePtrToString(r.ReadAt),
+		SnoozedUntil:  timePtrToString(r.SnoozedUntil),
+		ClaimedBy:     r.ClaimedBy,
+		ClaimedAt:     timePtrToString(r.ClaimedAt),
+		ClaimExpiresAt: timePtrToString(r.ClaimExpiresAt),
+		Locale:        r.Locale,
+		Timezone:      r.Timezone,
+		DeferredUntil: timePtrToString(r.DeferredUntil),
 		CreatedAt:     r.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:     r.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Version:       r.Version,
 	}
+	setTimeDisplays(req, r, time.Now())
+	return req
+}
+
+// requestModel converts a stored request, decrypting its prefill
+func (s *RequestService) requestModel(ctx context.Context, r db.Request) (*model.Request, error) {
+	prefill, err := s.sealer.Open(ctx, r.Prefill, prefillField(r.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt prefill: %w", err)
+	}
+	r.Prefill = prefill
+	return dbRequestToModel(r), nil
+}
+
+func prefillField(requestID string) string {
+	return seal.Field("requests", "prefill", requestID)
+}
+
+func payloadField(responseID string) string {
+	return seal.Field("responses", "payload", responseID)
 }
 
 func dbResponseToModel(r db.Response) *model.Response {
-	return &model.Response{
+	resp := &model.Response{
 		ID:          r.ID,
 		RequestID:   r.RequestID,
 		AnsweredBy:  r.AnsweredBy,
@@ -309,6 +826,17 @@ func dbResponseToModel(r db.Response) *model.Response {
 		Files:       r.Files,
 		AnsweredAt:  r.AnsweredAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
+	if r.Review != nil && r.ReviewedAt != nil {
+		resp.Review = &model.ResponseReview{
+			Status:     model.Status(*r.Review),
+			Reason:     r.ReviewReason,
+			ReviewedAt: r.ReviewedAt.Format("2006-01-02T15:04:05Z07:00"),
+		}
+		if r.ReviewedBy != nil {
+			resp.Review.ReviewedBy = *r.ReviewedBy
+		}
+	}
+	return resp
 }
 
 func timePtrToString(t *time.Time) *string {
@@ -1,55 +1,414 @@
-package service
+package service_test
 
 import (
 	"context"
 	"testing"
 	"time"
 
+	"pxbox/internal/auth"
 	"pxbox/internal/db"
+	"pxbox/internal/events"
 	"pxbox/internal/model"
 	"pxbox/internal/schema"
+	"pxbox/internal/service"
+	pxtest "pxbox/internal/testing"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// MockEventBus implements EventBus for testing
-type MockEventBus struct {
-	events []map[string]interface{}
+type requestFixture struct {
+	svc     *service.RequestService
+	queries *pxtest.Queries
+	bus     *pxtest.Bus
+	jobs    *pxtest.JobClient
+	entity  *model.Entity
 }
 
-func (m *MockEventBus) PublishEntity(entityID string, event map[string]interface{}) error {
-	m.events = append(m.events, event)
-	return nil
+func newRequestFixture(t *testing.T) *requestFixture {
+	queries := pxtest.NewQueries()
+	bus := pxtest.NewBus()
+	jobs := pxtest.NewJobClient()
+	entitySvc := service.NewEntityService(queries)
+	svc := service.NewRequestService(queries, schema.NewCompilerWithCache(16), entitySvc, bus)
+	svc.SetJobClient(jobs)
+
+	entity, err := entitySvc.CreateEntity(context.Background(), model.EntityKindUser, "ada", nil, false)
+	require.NoError(t, err)
+	return &requestFixture{svc: svc, queries: queries, bus: bus, jobs: jobs, entity: entity}
 }
 
-func (m *MockEventBus) PublishRequest(requestID string, event map[string]interface{}) error {
-	m.events = append(m.events, event)
-	return nil
+var nameSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"name"},
+	"properties": map[string]interface{}{
+		"name": map[string]interface{}{"type": "string"},
+	},
 }
 
-func (m *MockEventBus) PublishRequestor(clientID string, event map[string]interface{}) error {
-	m.events = append(m.events, event)
-	return nil
+func (f *requestFixture) create(t *testing.T, input service.CreateRequestInput) *model.Request {
+	if input.Entity.ID == "" && input.Entity.Handle == "" {
+		input.Entity.Handle = "ada"
+	}
+	if input.Schema == nil {
+		input.Schema = nameSchema
+	}
+	if input.CreatedBy == "" {
+		input.CreatedBy = "client-1"
+	}
+	req, err := f.svc.CreateRequest(context.Background(), input)
+	require.NoError(t, err)
+	return req
 }
 
 func TestRequestService_CreateRequest(t *testing.T) {
-	t.Skip("Requires test database setup")
+	f := newRequestFixture(t)
+	deadline := time.Now().Add(2 * time.Hour)
+
+	req := f.create(t, service.CreateRequestInput{
+		DeadlineAt: &deadline,
+		Prefill:    map[string]interface{}{"name": "Ada"},
+	})
+	assert.Equal(t, model.StatusPending, req.Status)
+	assert.Equal(t, f.entity.ID, req.EntityID)
+	assert.Equal(t, "Ada", req.Prefill["name"])
+
+	assert.Equal(t, []string{"request.created"}, f.bus.Types("entity:"+f.entity.ID))
+	assert.Equal(t, []string{"request.created"}, f.bus.Types("requestor:client-1"))
+	assert.Len(t, f.jobs.Jobs("ScheduleDeadlineNotification"), 1)
+	assert.Len(t, f.jobs.Jobs("ScheduleDeadlineExpiry"), 1)
+	assert.Empty(t, f.jobs.Jobs("ScheduleRequestExpiry"))
+}
+
+// txJobClient enqueues only through the querier of a transaction
+type txJobClient struct {
+	*pxtest.JobClient
+	queriers []db.Querier
+}
+
+func (c *txJobClient) WithQuerier(q db.Querier) service.JobClient {
+	c.queriers = append(c.queriers, q)
+	return c.JobClient
+}
+
+func TestRequestService_CreateRequestTransactionalJobs(t *testing.T) {
+	f := newRequestFixture(t)
+	jobs := &txJobClient{JobClient: pxtest.NewJobClient()}
+	f.svc.SetJobClient(jobs)
+	deadline := time.Now().Add(2 * time.Hour)
+
+	req := f.create(t, service.CreateRequestInput{DeadlineAt: &deadline})
+	assert.Len(t, jobs.queriers, 1)
+	assert.Len(t, jobs.Jobs("ScheduleDeadlineNotification"), 1)
+	assert.Len(t, jobs.Jobs("ScheduleDeadlineExpiry"), 1)
+
+	tasks, err := f.queries.ListRequestTasks(context.Background(), req.ID)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+}
+
+func TestRequestService_CreateRequestRejected(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	input := service.CreateRequestInput{Schema: nameSchema, ExpiresAt: &past}
+	input.Entity.Handle = "ada"
+	_, err := f.svc.CreateRequest(ctx, input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	input = service.CreateRequestInput{Schema: nameSchema}
+	input.Entity.Handle = "nobody"
+	_, err = f.svc.CreateRequest(ctx, input)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	assert.Empty(t, f.bus.All())
 }
 
 func TestRequestService_GetRequest(t *testing.T) {
-	t.Skip("Requires test database setup")
+	f := newRequestFixture(t)
+	created := f.create(t, service.CreateRequestInput{})
+
+	req, err := f.svc.GetRequest(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, req.ID)
+	assert.Equal(t, "client-1", req.CreatedBy)
+
+	_, err = f.svc.GetRequest(context.Background(), "missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
 }
 
 func TestRequestService_ClaimRequest(t *testing.T) {
-	t.Skip("Requires test database setup")
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{})
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	stale := req.Version + 1
+	err := f.svc.ClaimRequest(ctx, req.ID, &stale)
+	assert.ErrorIs(t, err, service.ErrVersionConflict)
+
+	require.NoError(t, f.svc.ClaimRequest(ctx, req.ID, &req.Version))
+	claimed, err := f.svc.GetRequest(ctx, req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusClaimed, claimed.Status)
+	assert.Equal(t, []string{"request.claimed"}, f.bus.Types("request:"+req.ID))
+
+	// A claimed request cannot be claimed again
+	err = f.svc.ClaimRequest(ctx, req.ID, nil)
+	assert.ErrorIs(t, err, service.ErrConflict)
+}
+
+func TestRequestService_ClaimRecordsClaimer(t *testing.T) {
+	f := newRequestFixture(t)
+	f.svc.SetClaimTTL(time.Hour)
+	req := f.create(t, service.CreateRequestInput{})
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	require.NoError(t, f.svc.ClaimRequest(ctx, req.ID, nil))
+	claimed, err := f.queries.GetRequestByID(context.Background(), req.ID)
+	require.NoError(t, err)
+	require.NotNil(t, claimed.ClaimedBy)
+	assert.Equal(t, f.entity.ID, *claimed.ClaimedBy)
+	require.NotNil(t, claimed.ClaimExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *claimed.ClaimExpiresAt, time.Minute)
+
+	published := f.bus.Events("request:" + req.ID)
+	require.Len(t, published, 1)
+	data := published[0]["data"].(map[string]interface{})
+	assert.Equal(t, f.entity.ID, data["claimedBy"])
+
+	expiries := f.jobs.Jobs("ScheduleClaimExpiry")
+	require.Len(t, expiries, 1)
+	assert.Equal(t, req.ID, expiries[0].ID)
+	assert.Equal(t, *claimed.ClaimExpiresAt, expiries[0].At)
+}
+
+// expireClaim does what the claim expiry job does when it runs: it
+// releases the claim of the request as it reads it, only if it has lapsed
+func expireClaim(f *requestFixture, requestID string) error {
+	req, err := f.queries.GetRequestByID(context.Background(), requestID)
+	if err != nil {
+		return err
+	}
+	return f.queries.UnclaimRequest(context.Background(), requestID, true, &req.Version)
+}
+
+func TestRequestService_StaleClaimExpiry(t *testing.T) {
+	f := newRequestFixture(t)
+	f.svc.SetClaimTTL(time.Hour)
+	req := f.create(t, service.CreateRequestInput{})
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	// Claimed, released and claimed again: the first expiry job is still
+	// scheduled when it is taken the second time
+	require.NoError(t, f.svc.ClaimRequest(ctx, req.ID, nil))
+	require.NoError(t, f.svc.UnclaimRequest(ctx, req.ID, nil))
+	require.NoError(t, f.svc.ClaimRequest(auth.WithClientID(context.Background(), "client-2"), req.ID, nil))
+	require.Len(t, f.jobs.Jobs("ScheduleClaimExpiry"), 2)
+
+	assert.ErrorIs(t, expireClaim(f, req.ID), pgx.ErrNoRows)
+	claimed, err := f.queries.GetRequestByID(context.Background(), req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.StatusClaimed), claimed.Status)
+	require.NotNil(t, claimed.ClaimedBy)
+	assert.Equal(t, "client-2", *claimed.ClaimedBy)
+
+	// A claim that has lapsed is released
+	f.svc.SetClaimTTL(time.Millisecond)
+	require.NoError(t, f.svc.UnclaimRequest(auth.WithClientID(context.Background(), "client-2"), req.ID, nil))
+	require.NoError(t, f.svc.ClaimRequest(ctx, req.ID, nil))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, expireClaim(f, req.ID))
+	released, err := f.queries.GetRequestByID(context.Background(), req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.StatusPending), released.Status)
+	assert.Nil(t, released.ClaimedBy)
 }
 
 func TestRequestService_PostResponse(t *testing.T) {
-	t.Skip("Requires test database setup")
+	f := newRequestFixture(t)
+	callback := "https://example.com/hook"
+	req := f.create(t, service.CreateRequestInput{CallbackURL: &callback})
+	ctx := context.Background()
+
+	_, err := f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": 42}, nil, nil)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	resp, err := f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Ada"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, f.entity.ID, resp.AnsweredBy)
+	assert.Equal(t, "Ada", resp.Payload["name"])
+
+	stored, err := f.svc.GetResponseByRequestID(ctx, req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, resp.ID, stored.ID)
+
+	answered := f.bus.Events("requestor:client-1")
+	require.Len(t, answered, 2)
+	assert.Equal(t, "request.answered", answered[1]["type"])
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, events.DataOf(answered[1])["payload"])
+	assert.Len(t, f.jobs.Jobs("EnqueueCallback"), 1)
+
+	// Answered requests take no second answer
+	_, err = f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Grace"}, nil, nil)
+	assert.ErrorIs(t, err, service.ErrConflict)
+}
+
+func TestRequestService_ExampleSchema(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	req := f.create(t, service.CreateRequestInput{
+		Schema: map[string]interface{}{
+			"example": map[string]interface{}{"name": "Ada", "age": float64(36)},
+		},
+	})
+	assert.Equal(t, model.SchemaKindExample, req.SchemaKind)
+
+	inferred, err := f.svc.GetRequestSchema(ctx, req.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "object", inferred["type"])
+	assert.Contains(t, inferred["properties"], "age")
+
+	result, err := f.svc.ValidatePage(ctx, req.ID, "", map[string]interface{}{"age": "old"})
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+
+	_, err = f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": 42}, nil, nil)
+	assert.ErrorIs(t, err, service.ErrValidation)
+	_, err = f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Grace", "extra": true}, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestRequestService_UIHints(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{UIHints: map[string]interface{}{
+		"order": "name",
+		"name":  map[string]interface{}{"widget": "textarea", "ui:widge": "radio"},
+	}})
+	assert.Equal(t, map[string]interface{}{
+		"ui:order": []interface{}{"name"},
+		"name":     map[string]interface{}{"ui:widget": "textarea", "ui:widge": "radio"},
+	}, req.UIHints)
+
+	input := service.CreateRequestInput{
+		Schema:    nameSchema,
+		CreatedBy: "client-1",
+		UIHints:   map[string]interface{}{"name": map[string]interface{}{"ui:widget": 1}},
+	}
+	input.Entity.Handle = "ada"
+	_, err := f.svc.CreateRequest(context.Background(), input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+	assert.Equal(t, "invalid_ui_hints", service.Classify(err).Code)
+
+	f.svc.SetStrictUIHints(true)
+	input.UIHints = map[string]interface{}{"name": map[string]interface{}{"ui:widge": "radio"}}
+	_, err = f.svc.CreateRequest(context.Background(), input)
+	assert.Equal(t, "invalid_ui_hints", service.Classify(err).Code)
+}
+
+func TestRequestService_ResponseLimits(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	req := f.create(t, service.CreateRequestInput{Schema: map[string]interface{}{
+		"type":     "object",
+		"x-limits": map[string]interface{}{"maxStringLength": float64(10)},
+		"properties": map[string]interface{}{
+			"name":  map[string]interface{}{"type": "string"},
+			"notes": map[string]interface{}{"type": "array"},
+		},
+	}})
+
+	_, err := f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Ada Lovelace Byron"}, nil, nil)
+	assert.ErrorIs(t, err, service.ErrTooLarge)
+	e := service.Classify(err)
+	assert.Equal(t, "payload_too_large", e.Code)
+	assert.Equal(t, schema.LimitViolation{Limit: "maxStringLength", Max: 10, InstanceLocation: "/name"}, e.Details)
+
+	// Server-wide limits apply on top of the declared ones
+	f.svc.SetResponseLimits(schema.ResponseLimits{MaxArrayItems: 2})
+	_, err = f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Ada", "notes": []interface{}{1, 2, 3}}, nil, nil)
+	assert.Equal(t, "payload_too_large", service.Classify(err).Code)
+	_, err = f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Ada", "notes": []interface{}{1, 2}}, nil, nil)
+	assert.NoError(t, err)
+
+	input := service.CreateRequestInput{
+		Schema:    map[string]interface{}{"type": "object", "x-limits": map[string]interface{}{"maxBytes": "1MB"}},
+		CreatedBy: "client-1",
+	}
+	input.Entity.Handle = "ada"
+	_, err = f.svc.CreateRequest(ctx, input)
+	assert.Equal(t, "invalid_schema", service.Classify(err).Code)
+}
+
+func TestRequestService_PostResponseRedactsSensitive(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pin": map[string]interface{}{"type": "string", "x-sensitive": true},
+		},
+	}})
+
+	_, err := f.svc.PostResponse(context.Background(), req.ID, "", map[string]interface{}{"pin": "1234"}, nil, nil)
+	require.NoError(t, err)
+
+	answered := f.bus.Events("requestor:client-1")
+	require.Len(t, answered, 2)
+	data := events.DataOf(answered[1])
+	assert.Equal(t, map[string]interface{}{"pin": schema.Redacted}, data["payload"])
+	assert.Equal(t, true, data["redacted"])
 }
 
 func TestRequestService_CancelRequest(t *testing.T) {
-	t.Skip("Requires test database setup")
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{})
+	ctx := context.Background()
+
+	require.NoError(t, f.svc.CancelRequest(ctx, req.ID, nil))
+	cancelled, err := f.svc.GetRequest(ctx, req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusCancelled, cancelled.Status)
+	assert.Equal(t, []string{"request.cancelled"}, f.bus.Types("request:"+req.ID))
+
+	_, err = f.svc.PostResponse(ctx, req.ID, "", map[string]interface{}{"name": "Ada"}, nil, nil)
+	assert.ErrorIs(t, err, service.ErrConflict)
+
+	err = f.svc.CancelRequest(ctx, "missing", nil)
+	assert.ErrorIs(t, err, service.ErrNotFound)
 }
 
+func TestRequestService_GetLocalizedRequest(t *testing.T) {
+	f := newRequestFixture(t)
+	ctx := context.Background()
+	locale := "en"
+	req := f.create(t, service.CreateRequestInput{
+		Schema: map[string]interface{}{
+			"type":   "object",
+			"title":  "Contact",
+			"x-i18n": map[string]interface{}{"cs": map[string]interface{}{"title": "Kontakt"}},
+		},
+		UIHints: map[string]interface{}{
+			"submitLabel": "Send",
+			"x-i18n":      map[string]interface{}{"cs": map[string]interface{}{"submitLabel": "Odeslat"}},
+		},
+		Locale: &locale,
+	})
+
+	got, err := f.svc.GetLocalizedRequest(ctx, req.ID, []string{"cs-CZ"})
+	require.NoError(t, err)
+	assert.Equal(t, "Kontakt", got.SchemaPayload["title"])
+	assert.Equal(t, "Odeslat", got.UIHints["submitLabel"])
+	assert.Equal(t, "en", *got.Locale)
+
+	got, err = f.svc.GetLocalizedRequest(ctx, req.ID, []string{"fr"})
+	require.NoError(t, err)
+	assert.Equal(t, "Contact", got.SchemaPayload["title"])
+	assert.NotContains(t, got.SchemaPayload, "x-i18n")
+
+	bad := "english"
+	input := service.CreateRequestInput{Schema: nameSchema, Locale: &bad, CreatedBy: "client-1"}
+	input.Entity.Handle = "ada"
+	_, err = f.svc.CreateRequest(ctx, input)
+	assert.ErrorIs(t, err, service.ErrValidation)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxReviewReason is the longest rejection reason passed on to the entity
+const maxReviewReason = 2000
+
+// RejectInput is the requestor's rejection of an answer
+type RejectInput struct {
+	Reason *string `json:"reason,omitempty"`
+	// Reopen returns the request to PENDING for a corrected answer instead
+	// of closing it as REJECTED
+	Reopen bool `json:"reopen,omitempty"`
+	// DeadlineAt replaces the deadline of a reopened request; it is required
+	// when the old one has passed
+	DeadlineAt *time.Time `json:"deadlineAt,omitempty"`
+}
+
+// AcceptResponse closes an ANSWERED request as ACCEPTED. Only the
+// requestor or an admin may review an answer. If expectedVersion is set,
+// the review only applies at that version.
+func (s *RequestService) AcceptResponse(ctx context.Context, id string, expectedVersion *int) (*model.Request, error) {
+	return s.reviewResponse(ctx, id, model.StatusAccepted, RejectInput{}, expectedVersion)
+}
+
+// RejectResponse rejects the answer to an ANSWERED request: it closes the
+// request as REJECTED or, with input.Reopen, returns it to PENDING so the
+// entity can answer again. The rejected response and the reason are kept.
+func (s *RequestService) RejectResponse(ctx context.Context, id string, input RejectInput, expectedVersion *int) (*model.Request, error) {
+	to := model.StatusRejected
+	if input.Reopen {
+		to = model.StatusPending
+	}
+	return s.reviewResponse(ctx, id, to, input, expectedVersion)
+}
+
+func (s *RequestService) reviewResponse(ctx context.Context, id string, to model.Status, input RejectInput, expectedVersion *int) (*model.Request, error) {
+	if input.Reason != nil && len(*input.Reason) > maxReviewReason {
+		return nil, invalid("invalid_review", fmt.Sprintf("reason can be at most %d bytes", maxReviewReason), nil)
+	}
+	if input.DeadlineAt != nil && !input.Reopen {
+		return nil, invalid("invalid_review", "deadlineAt only applies when reopening", nil)
+	}
+
+	req, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if !auth.IsAdmin(ctx) && requestorID(ctx) != req.CreatedBy {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_requestor", Message: "only the requestor can review the answer"}
+	}
+	if req.Status != string(model.StatusAnswered) {
+		return nil, transitionConflict(&model.TransitionError{From: model.Status(req.Status), To: to})
+	}
+
+	// A reopened request needs time left to be answered in
+	now := time.Now()
+	deadlineAt := input.DeadlineAt
+	if input.Reopen {
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+			return nil, ErrRequestExpired
+		}
+		switch {
+		case deadlineAt != nil && !deadlineAt.After(now):
+			return nil, invalid("invalid_deadline", "deadlineAt must be in the future", nil)
+		case deadlineAt == nil && req.DeadlineAt != nil && !req.DeadlineAt.After(now):
+			return nil, invalid("invalid_deadline", "the deadline has passed; set deadlineAt to reopen", nil)
+		}
+	}
+
+	review := model.StatusRejected
+	if to == model.StatusAccepted {
+		review = model.StatusAccepted
+	}
+	var version int
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		version, err = q.ReviewResponse(ctx, db.ReviewResponseParams{
+			RequestID:  id,
+			Status:     string(to),
+			Review:     string(review),
+			Reason:     input.Reason,
+			ReviewedBy: auth.Actor(ctx),
+		}, expectedVersion)
+		if err != nil || deadlineAt == nil {
+			return err
+		}
+		version, err = q.UpdateRequestDeadline(ctx, id, *deadlineAt, nil)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, s.transitionError(ctx, id, to, expectedVersion, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to review response: %w", err)
+	}
+
+	// The deadline tasks of a request outlive its answer, so a reopened
+	// request keeps them unless it got a new deadline
+	if deadlineAt != nil && s.jobClient != nil {
+		if err := s.cancelDeadlineTasks(ctx, id); err != nil {
+			return nil, fmt.Errorf("failed to reschedule deadline: %w", err)
+		}
+		scheduleDeadlineTasks(ctx, s.jobClient, s.queries, id, *deadlineAt, req.AutocancelGrace)
+	}
+
+	entry := audit.Entry{
+		Action:       audit.ActionAccept,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		BeforeStatus: req.Status,
+		AfterStatus:  string(to),
+	}
+	var event events.Data = events.RequestAccepted{RequestID: id, Version: version}
+	if review == model.StatusRejected {
+		entry.Action = audit.ActionReject
+		entry.Meta = map[string]interface{}{"reopened": input.Reopen}
+		if input.Reason != nil {
+			entry.Meta["reason"] = *input.Reason
+		}
+		event = events.RequestRejected{
+			RequestID:  id,
+			Reason:     input.Reason,
+			Reopened:   input.Reopen,
+			DeadlineAt: timePtrToString(deadlineAt),
+			Version:    version,
+		}
+	}
+	s.audit.Record(ctx, entry)
+
+	e := pubsub.MarkSandbox(events.New(ctx, event), req.Sandbox)
+	_ = s.bus.PublishEntity(req.EntityID, e)
+	_ = s.bus.PublishRequest(id, e)
+
+	updated, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	return s.requestModel(ctx, updated)
+}
@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewResponse(t *testing.T) {
+	f := newRequestFixture(t)
+	requestor := auth.WithClientID(context.Background(), "client-1")
+	answer := func(id string) {
+		_, err := f.svc.PostResponse(context.Background(), id, f.entity.ID, map[string]interface{}{"name": "Ada"}, nil, nil)
+		require.NoError(t, err)
+	}
+
+	// Only answers are reviewed, and only by their requestor
+	req := f.create(t, service.CreateRequestInput{})
+	_, err := f.svc.AcceptResponse(requestor, req.ID, nil)
+	assert.Equal(t, "invalid_transition", service.Classify(err).Code)
+	answer(req.ID)
+	_, err = f.svc.AcceptResponse(auth.WithClientID(context.Background(), "client-2"), req.ID, nil)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+
+	f.bus.Reset()
+	accepted, err := f.svc.AcceptResponse(requestor, req.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusAccepted, accepted.Status)
+	assert.Equal(t, []string{"request.accepted"}, f.bus.Types("entity:"+f.entity.ID))
+	resp, err := f.svc.GetResponseByRequestID(requestor, req.ID)
+	require.NoError(t, err)
+	require.NotNil(t, resp.Review)
+	assert.Equal(t, model.StatusAccepted, resp.Review.Status)
+	_, err = f.svc.RejectResponse(requestor, req.ID, service.RejectInput{}, nil)
+	assert.ErrorIs(t, err, service.ErrConflict)
+
+	// Rejecting without reopening closes the request
+	reason := "Wrong name"
+	closed := f.create(t, service.CreateRequestInput{})
+	answer(closed.ID)
+	rejected, err := f.svc.RejectResponse(requestor, closed.ID, service.RejectInput{Reason: &reason}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusRejected, rejected.Status)
+	_, err = f.svc.PostResponse(context.Background(), closed.ID, f.entity.ID, map[string]interface{}{"name": "Ada"}, nil, nil)
+	assert.ErrorIs(t, err, service.ErrConflict)
+
+	// Reopening needs a deadline in the future and returns the request to
+	// the queue for a corrected answer
+	deadline := time.Now().Add(time.Hour)
+	reopen := f.create(t, service.CreateRequestInput{DeadlineAt: &deadline})
+	answer(reopen.ID)
+	past := time.Now().Add(-time.Minute)
+	_, err = f.svc.RejectResponse(requestor, reopen.ID, service.RejectInput{Reopen: true, DeadlineAt: &past}, nil)
+	assert.Equal(t, "invalid_deadline", service.Classify(err).Code)
+
+	f.bus.Reset()
+	later := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	reopened, err := f.svc.RejectResponse(requestor, reopen.ID, service.RejectInput{Reason: &reason, Reopen: true, DeadlineAt: &later}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPending, reopened.Status)
+	assert.Equal(t, later.UTC().Format(time.RFC3339), *reopened.DeadlineAt)
+	events := f.bus.Events("entity:" + f.entity.ID)
+	require.Len(t, events, 1)
+	assert.Equal(t, "request.rejected", events[0]["type"])
+	assert.Len(t, f.jobs.Jobs("ScheduleDeadlineExpiry"), 2)
+
+	resp, err = f.svc.GetResponseByRequestID(requestor, reopen.ID)
+	require.NoError(t, err)
+	require.NotNil(t, resp.Review)
+	assert.Equal(t, model.StatusRejected, resp.Review.Status)
+	assert.Equal(t, reason, *resp.Review.Reason)
+
+	answer(reopen.ID)
+	resp, err = f.svc.GetResponseByRequestID(requestor, reopen.ID)
+	require.NoError(t, err)
+	assert.Nil(t, resp.Review)
+}
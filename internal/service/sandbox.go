@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/events"
+	"pxbox/internal/pubsub"
+	"pxbox/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// PurgeSandboxRequests deletes up to limit sandbox requests created before the
+// given time, along with their responses and their uploaded files: those
+// recorded by the upload proxy and those attached by URL that storage can
+// resolve. It returns the number of requests deleted.
+func (s *RequestService) PurgeSandboxRequests(ctx context.Context, before time.Time, limit int, stor storage.Storage, log *zap.Logger) (int, error) {
+	expired, err := s.queries.ListExpiredSandboxRequests(ctx, before, limit)
+	if err != nil || len(expired) == 0 {
+		return 0, err
+	}
+
+	// Remove files first: once the rows are gone nothing points at them
+	resolver, _ := stor.(storage.URLResolver)
+	ids := make([]string, 0, len(expired))
+	for _, req := range expired {
+		ids = append(ids, req.ID)
+		names := make(map[string]bool, len(req.ObjectKeys))
+		for _, key := range req.ObjectKeys {
+			names[key] = true
+		}
+		if resolver != nil {
+			for _, file := range req.Files {
+				url, _ := file["url"].(string)
+				if name, ok := resolver.ObjectName(url); ok {
+					names[name] = true
+				}
+			}
+		}
+		for name := range names {
+			if err := stor.Delete(ctx, name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Warn("Failed to delete sandbox file",
+					zap.String("request_id", req.ID),
+					zap.String("object", name),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+
+	deleted, err := s.queries.DeleteSandboxRequests(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, req := range expired {
+		s.audit.Record(ctx, audit.Entry{
+			Actor:        audit.SystemActor,
+			Action:       audit.ActionPurge,
+			ResourceType: audit.ResourceRequest,
+			ResourceID:   req.ID,
+			Meta:         map[string]interface{}{"entityId": req.EntityID, "sandbox": true},
+		})
+
+		event := pubsub.MarkSandbox(events.New(ctx, events.RequestPurged{RequestID: req.ID}), true)
+		_ = s.bus.PublishRequest(req.ID, event)
+		_ = s.bus.PublishEntity(req.EntityID, event)
+		_ = s.bus.PublishRequestor(req.CreatedBy, event)
+	}
+
+	return int(deleted), nil
+}
+
+// SandboxPurger periodically deletes sandbox requests older than a TTL, so
+// test traffic against a shared deployment does not accumulate
+type SandboxPurger struct {
+	requestSvc *RequestService
+	stor       storage.Storage
+	ttl        time.Duration
+	interval   time.Duration
+	batchSize  int
+	log        *zap.Logger
+}
+
+// NewSandboxPurger creates a purger that scans every interval for sandbox
+// requests older than ttl
+func NewSandboxPurger(requestSvc *RequestService, stor storage.Storage, ttl, interval time.Duration, batchSize int, log *zap.Logger) *SandboxPurger {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &SandboxPurger{
+		requestSvc: requestSvc,
+		stor:       stor,
+		ttl:        ttl,
+		interval:   interval,
+		batchSize:  batchSize,
+		log:        log,
+	}
+}
+
+// Run purges expired sandbox data until ctx is cancelled
+func (p *SandboxPurger) Run(ctx context.Context) {
+	p.log.Info("Sandbox purger started",
+		zap.Duration("ttl", p.ttl),
+		zap.Duration("interval", p.interval),
+	)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			p.log.Info("Sandbox purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge drains all expired batches, stopping early on error or cancellation
+func (p *SandboxPurger) purge(ctx context.Context) {
+	start := time.Now()
+	before := start.Add(-p.ttl)
+	total := 0
+	for ctx.Err() == nil {
+		n, err := p.requestSvc.PurgeSandboxRequests(ctx, before, p.batchSize, p.stor, p.log)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.log.Error("Sandbox purge failed", zap.Error(err))
+			}
+			break
+		}
+		total += n
+		if n < p.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		p.log.Info("Purged sandbox requests", zap.Int("count", total), zap.Duration("duration", time.Since(start)))
+	}
+}
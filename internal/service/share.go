@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// Share link lifetimes
+const (
+	DefaultShareTTL = 72 * time.Hour
+	MaxShareTTL     = 30 * 24 * time.Hour
+)
+
+// maxRespondentField limits the name and email an external party gives
+const maxRespondentField = 200
+
+// errInvalidShareLink hides whether a token is unknown, used or expired
+var errInvalidShareLink = &Error{Kind: ErrNotFound, Code: "invalid_share_link", Message: "share link is invalid, used or expired"}
+
+// Respondent is what an external party answering through a share link
+// tells about itself. It is stored on the ad-hoc entity.
+type Respondent struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// CreateShareLink creates a single-use public answer link for a request on
+// behalf of its requestor (or an admin). The link expires after ttl
+// (DefaultShareTTL if zero) or when the request does, whichever is first.
+func (s *RequestService) CreateShareLink(ctx context.Context, requestID string, ttl time.Duration) (*model.ShareLink, error) {
+	if ttl == 0 {
+		ttl = DefaultShareTTL
+	}
+	if ttl < 0 || ttl > MaxShareTTL {
+		return nil, invalid("invalid_ttl", fmt.Sprintf("ttl must be positive and at most %s", MaxShareTTL), nil)
+	}
+
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if !auth.IsAdmin(ctx) && requestorID(ctx) != req.CreatedBy {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_requestor", Message: "only the requestor can share a request"}
+	}
+	now := time.Now()
+	if isExpired(req, now) {
+		return nil, ErrRequestExpired
+	}
+	if err := model.RequestStatusMachine.Check(model.Status(req.Status), model.StatusAnswered); err != nil {
+		return nil, transitionConflict(err)
+	}
+
+	expiresAt := now.Add(ttl)
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(expiresAt) {
+		expiresAt = *req.ExpiresAt
+	}
+	token, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	link, err := s.queries.CreateShareLink(ctx, db.CreateShareLinkParams{
+		ID:        ulid.Make().String(),
+		TokenHash: hashShareToken(token),
+		RequestID: requestID,
+		CreatedBy: requestorID(ctx),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionShare,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   requestID,
+		Meta:         map[string]interface{}{"shareLinkId": link.ID, "expiresAt": expiresAt},
+	})
+
+	result := dbShareLinkToModel(link)
+	result.Token = token
+	return result, nil
+}
+
+// OpenShareLink returns the request behind a share link token, resolved
+// into the first of locales with translations and with its attachments. It
+// does not use the link up.
+func (s *RequestService) OpenShareLink(ctx context.Context, token string, locales []string) (*model.Request, error) {
+	link, err := s.queries.GetShareLinkByToken(ctx, hashShareToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errInvalidShareLink
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+	req, err := s.GetLocalizedRequest(ctx, link.RequestID, locales)
+	if err != nil {
+		return nil, err
+	}
+	// The link holder answers in place of the entity and sees what it would
+	if req.Attachments, err = s.signedAttachments(ctx, req.ID); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// AnswerShareLink answers the request behind a share link token. The
+// answer is recorded as given by a new ad-hoc user entity carrying the
+// respondent's details, and the link is used up; if the answer is rejected
+// the link stays usable.
+func (s *RequestService) AnswerShareLink(ctx context.Context, token string, respondent Respondent, payload map[string]interface{}, files []map[string]interface{}) (*model.Response, error) {
+	respondent.Name = strings.TrimSpace(respondent.Name)
+	respondent.Email = strings.TrimSpace(respondent.Email)
+	if utf8.RuneCountInString(respondent.Name) > maxRespondentField || utf8.RuneCountInString(respondent.Email) > maxRespondentField {
+		return nil, invalid("invalid_respondent", fmt.Sprintf("respondent name and email are limited to %d characters", maxRespondentField), nil)
+	}
+
+	link, err := s.queries.UseShareLink(ctx, hashShareToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errInvalidShareLink
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use share link: %w", err)
+	}
+
+	resp, err := s.answerShareLink(ctx, link, respondent, payload, files)
+	if err != nil {
+		_ = s.queries.ReleaseShareLink(ctx, link.ID)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *RequestService) answerShareLink(ctx context.Context, link db.ShareLink, respondent Respondent, payload map[string]interface{}, files []map[string]interface{}) (*model.Response, error) {
+	req, err := s.queries.GetRequestByID(ctx, link.RequestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	// Check the answer before recording anybody as giving it
+	if err := s.validatePayload(ctx, req, payload); err != nil {
+		return nil, err
+	}
+
+	meta := map[string]interface{}{
+		"adhoc":       true,
+		"shareLinkId": link.ID,
+		"requestId":   link.RequestID,
+	}
+	if respondent.Name != "" {
+		meta["name"] = respondent.Name
+	}
+	if respondent.Email != "" {
+		meta["email"] = respondent.Email
+	}
+	entity, err := s.entitySvc.CreateEntity(ctx, model.EntityKindUser, "", meta, req.Sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.PostResponse(ctx, link.RequestID, entity.ID, payload, files, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.queries.SetShareLinkAnswerer(ctx, link.ID, entity.ID); err != nil {
+		return nil, fmt.Errorf("failed to record share link answer: %w", err)
+	}
+	return resp, nil
+}
+
+// hashShareToken returns the stored form of a share link token
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func dbShareLinkToModel(l db.ShareLink) *model.ShareLink {
+	return &model.ShareLink{
+		ID:        l.ID,
+		RequestID: l.RequestID,
+		ExpiresAt: l.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		UsedAt:    timePtrToString(l.UsedAt),
+		UsedBy:    l.UsedBy,
+		CreatedAt: l.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
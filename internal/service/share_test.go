@@ -0,0 +1,67 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestService_ShareLink(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{})
+	requestor := auth.WithClientID(context.Background(), "client-1")
+
+	_, err := f.svc.CreateShareLink(auth.WithClientID(context.Background(), "client-2"), req.ID, 0)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	_, err = f.svc.CreateShareLink(requestor, req.ID, 31*24*time.Hour)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	link, err := f.svc.CreateShareLink(requestor, req.ID, time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, link.Token, 64)
+
+	ctx := context.Background()
+	shared, err := f.svc.OpenShareLink(ctx, link.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, req.ID, shared.ID)
+	_, err = f.svc.OpenShareLink(ctx, "wrong", nil)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	// A rejected answer leaves the link usable
+	_, err = f.svc.AnswerShareLink(ctx, link.Token, service.Respondent{}, map[string]interface{}{}, nil)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	resp, err := f.svc.AnswerShareLink(ctx, link.Token, service.Respondent{Name: " Grace ", Email: "grace@example.com"},
+		map[string]interface{}{"name": "Grace"}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, f.entity.ID, resp.AnsweredBy)
+
+	adhoc, err := f.queries.GetEntityByID(ctx, resp.AnsweredBy)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.EntityKindUser), adhoc.Kind)
+	assert.Equal(t, true, adhoc.Meta["adhoc"])
+	assert.Equal(t, "Grace", adhoc.Meta["name"])
+
+	// Links are single-use
+	_, err = f.svc.OpenShareLink(ctx, link.Token, nil)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	_, err = f.svc.AnswerShareLink(ctx, link.Token, service.Respondent{}, map[string]interface{}{"name": "Eve"}, nil)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestRequestService_ShareLinkExpiresWithRequest(t *testing.T) {
+	f := newRequestFixture(t)
+	expiresAt := time.Now().Add(time.Hour)
+	req := f.create(t, service.CreateRequestInput{ExpiresAt: &expiresAt})
+
+	link, err := f.svc.CreateShareLink(auth.WithClientID(context.Background(), "client-1"), req.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, expiresAt.Format(time.RFC3339), link.ExpiresAt)
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Snooze hides a request from the target entity's default listings until
+// remindAt, when the reminder job clears the snooze and announces
+// inquiry.unsnoozed. If the entity set a business calendar, remindAt moves
+// to its next working hours. Snoozing again replaces the previous time. It
+// returns the time the reminder is set for.
+func (s *RequestService) Snooze(ctx context.Context, id string, remindAt time.Time) (time.Time, error) {
+	entityID := auth.GetEntityID(ctx)
+	notTarget := &Error{Kind: ErrForbidden, Code: "not_target", Message: "only the target entity can snooze a request"}
+	if entityID == "" {
+		return time.Time{}, notTarget
+	}
+	if !remindAt.After(time.Now()) {
+		return time.Time{}, invalid("invalid_snooze", "remindAt must be in the future", nil)
+	}
+
+	req, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return time.Time{}, lookupError("request", err)
+	}
+	if req.EntityID != entityID {
+		return time.Time{}, notTarget
+	}
+	if req.DeletedAt != nil {
+		return time.Time{}, notFound("request", nil)
+	}
+	if !model.Status(req.Status).IsOpen() {
+		return time.Time{}, &Error{Kind: ErrConflict, Code: "request_closed", Message: "request is " + strings.ToLower(req.Status)}
+	}
+	if req.DeadlineAt != nil && remindAt.After(*req.DeadlineAt) {
+		return time.Time{}, &Error{
+			Kind:    ErrValidation,
+			Code:    "snooze_past_deadline",
+			Message: "remindAt is after the request deadline",
+			Details: map[string]interface{}{"latest": req.DeadlineAt.UTC().Format(time.RFC3339)},
+		}
+	}
+
+	// Reminders wait for the entity's working hours, if it set them
+	remindAt, err = s.workingReminder(ctx, entityID, remindAt, req.DeadlineAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// A request has one pending reminder per entity; snoozing again
+	// replaces it and its job
+	var reminder db.Reminder
+	var replaced []db.Reminder
+	err = s.queries.InTx(ctx, func(q db.Querier) error {
+		if err := q.SnoozeRequest(ctx, id, entityID, remindAt); err != nil {
+			return err
+		}
+		var err error
+		replaced, err = q.DeletePendingReminders(ctx, id, entityID)
+		if err != nil {
+			return err
+		}
+		reminder, err = q.CreateReminder(ctx, id, entityID, remindAt)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, notFound("request", err)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to snooze request: %w", err)
+	}
+
+	if s.jobClient != nil {
+		// Replaced reminders find no row when their jobs run, so a failed
+		// cancel only leaves a job with nothing to do
+		for _, r := range replaced {
+			s.cancelReminderTask(r)
+		}
+		taskID, err := s.jobClient.ScheduleReminder(ctx, reminder.ID, remindAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to schedule reminder: %w", err)
+		}
+		if taskID != "" {
+			_ = s.queries.SetReminderTask(ctx, reminder.ID, taskID)
+		}
+	}
+	return remindAt, nil
+}
+
+// ListReminders returns the reminders the calling entity set on a request
+// by snoozing it, pending and delivered
+func (s *RequestService) ListReminders(ctx context.Context, requestID string) ([]*model.Reminder, error) {
+	entityID := auth.GetEntityID(ctx)
+	if entityID == "" {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_target", Message: "only the target entity can list reminders"}
+	}
+	req, err := s.queries.GetRequestRef(ctx, requestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if req.EntityID != entityID {
+		return nil, &Error{Kind: ErrForbidden, Code: "not_target", Message: "only the target entity can list reminders"}
+	}
+
+	reminders, err := s.queries.ListReminders(ctx, requestID, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reminders: %w", err)
+	}
+	result := make([]*model.Reminder, 0, len(reminders))
+	for _, r := range reminders {
+		result = append(result, dbReminderToModel(r))
+	}
+	return result, nil
+}
+
+// CancelReminder deletes a pending reminder of the calling entity and its
+// job. The request stays snoozed until the reminder's time, but without a
+// reminder.
+func (s *RequestService) CancelReminder(ctx context.Context, id string) error {
+	entityID := auth.GetEntityID(ctx)
+	reminder, err := s.queries.GetReminderByID(ctx, id)
+	if err != nil {
+		return lookupError("reminder", err)
+	}
+	if entityID == "" || reminder.EntityID != entityID {
+		return &Error{Kind: ErrForbidden, Code: "not_owner", Message: "only the entity that snoozed the request can cancel its reminder"}
+	}
+	if reminder.DeliveredAt != nil {
+		return &Error{Kind: ErrConflict, Code: "reminder_delivered", Message: "reminder was already delivered"}
+	}
+
+	reminder, err = s.queries.DeleteReminder(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Delivered or cancelled since it was read
+		return &Error{Kind: ErrConflict, Code: "reminder_delivered", Message: "reminder was already delivered or cancelled", Err: err}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel reminder: %w", err)
+	}
+	if s.jobClient != nil {
+		s.cancelReminderTask(reminder)
+	}
+	return nil
+}
+
+// cancelReminderTask deletes the scheduled job of a removed reminder. The
+// job finds no reminder if it runs anyway, so failures are ignored.
+func (s *RequestService) cancelReminderTask(r db.Reminder) {
+	if r.TaskID != nil {
+		_ = s.jobClient.CancelTask(*r.TaskID)
+	}
+}
+
+func dbReminderToModel(r db.Reminder) *model.Reminder {
+	return &model.Reminder{
+		ID:          r.ID,
+		RequestID:   r.RequestID,
+		EntityID:    r.EntityID,
+		RemindAt:    r.RemindAt.Format(time.RFC3339),
+		DeliveredAt: timePtrToString(r.DeliveredAt),
+		CreatedAt:   r.CreatedAt.Format(time.RFC3339),
+	}
+}
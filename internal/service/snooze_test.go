@@ -0,0 +1,69 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestService_SnoozeReplacesReminder(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{})
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	_, err := f.svc.Snooze(ctx, req.ID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	later := time.Now().Add(2 * time.Hour)
+	_, err = f.svc.Snooze(ctx, req.ID, later)
+	require.NoError(t, err)
+
+	// Only the second reminder is left, and the first one's job is cancelled
+	reminders, err := f.svc.ListReminders(ctx, req.ID)
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	assert.Equal(t, later.UTC().Format(time.RFC3339), reminders[0].RemindAt)
+	assert.Nil(t, reminders[0].DeliveredAt)
+
+	scheduled := f.jobs.Jobs("ScheduleReminder")
+	require.Len(t, scheduled, 2)
+	assert.Equal(t, []string{scheduled[0].TaskID}, f.jobs.Cancelled())
+
+	_, err = f.svc.ListReminders(auth.WithEntityID(context.Background(), "someone-else"), req.ID)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+}
+
+func TestRequestService_CancelReminder(t *testing.T) {
+	f := newRequestFixture(t)
+	req := f.create(t, service.CreateRequestInput{})
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+	_, err := f.svc.Snooze(ctx, req.ID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	reminders, err := f.svc.ListReminders(ctx, req.ID)
+	require.NoError(t, err)
+	id := reminders[0].ID
+
+	err = f.svc.CancelReminder(auth.WithEntityID(context.Background(), "someone-else"), id)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+
+	require.NoError(t, f.svc.CancelReminder(ctx, id))
+	assert.Equal(t, []string{f.jobs.Jobs("ScheduleReminder")[0].TaskID}, f.jobs.Cancelled())
+	reminders, err = f.svc.ListReminders(ctx, req.ID)
+	require.NoError(t, err)
+	assert.Empty(t, reminders)
+
+	assert.ErrorIs(t, f.svc.CancelReminder(ctx, id), service.ErrNotFound)
+
+	// Delivered reminders cannot be cancelled
+	_, err = f.svc.Snooze(ctx, req.ID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	reminders, err = f.svc.ListReminders(ctx, req.ID)
+	require.NoError(t, err)
+	f.queries.DeliverReminder(reminders[0].ID)
+	assert.ErrorIs(t, f.svc.CancelReminder(ctx, reminders[0].ID), service.ErrConflict)
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// MaxStatsDays caps the range of days a stats query covers
+const MaxStatsDays = 366
+
+// defaultStatsDays is the range covered when no start day is given
+const defaultStatsDays = 30
+
+// maxStatsEntities caps the entities listed in request stats
+const maxStatsEntities = 50
+
+// StatsMaterializedFromEnv reports whether STATS_MATERIALIZED is set, in
+// which case stats are read from materialized views the worker refreshes
+func StatsMaterializedFromEnv() bool {
+	v, _ := strconv.ParseBool(os.Getenv("STATS_MATERIALIZED"))
+	return v
+}
+
+// StatsService aggregates requests and flows for dashboards
+type StatsService struct {
+	queries      db.Querier
+	materialized bool
+}
+
+// NewStatsService creates a stats service reading live aggregates, or the
+// materialized views when materialized is set
+func NewStatsService(queries db.Querier, materialized bool) *StatsService {
+	return &StatsService{queries: queries, materialized: materialized}
+}
+
+// StatsRange parses the from and to days of a stats query, YYYY-MM-DD in
+// UTC. To defaults to today and from to 30 days before it.
+func StatsRange(from, to string, now time.Time) (db.StatsFilter, error) {
+	var f db.StatsFilter
+	today := now.UTC().Truncate(24 * time.Hour)
+	f.To = today
+	if to != "" {
+		t, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return f, invalid("invalid_range", "to must be a date (YYYY-MM-DD)", err)
+		}
+		f.To = t
+	}
+	f.From = f.To.AddDate(0, 0, -(defaultStatsDays - 1))
+	if from != "" {
+		t, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return f, invalid("invalid_range", "from must be a date (YYYY-MM-DD)", err)
+		}
+		f.From = t
+	}
+	if f.To.Before(f.From) {
+		return f, invalid("invalid_range", "to must not be before from", nil)
+	}
+	if days := int(f.To.Sub(f.From)/(24*time.Hour)) + 1; days > MaxStatsDays {
+		return f, invalid("invalid_range", fmt.Sprintf("range must not exceed %d days", MaxStatsDays), nil)
+	}
+	return f, nil
+}
+
+// RequestStats counts the requests created in the filter's range by status,
+// schema kind, day and entity
+func (s *StatsService) RequestStats(ctx context.Context, f db.StatsFilter) (*model.RequestStats, error) {
+	counts, refreshedAt, err := s.queries.ListRequestCounts(ctx, f, s.materialized)
+	if err != nil {
+		return nil, statsError("requests", err)
+	}
+
+	stats := &model.RequestStats{
+		From:         f.From.Format(time.DateOnly),
+		To:           f.To.Format(time.DateOnly),
+		Source:       s.source(),
+		RefreshedAt:  timePtrToString(refreshedAt),
+		ByStatus:     map[string]int64{},
+		BySchemaKind: map[string]int64{},
+		ByDay:        []model.DayCount{},
+		ByEntity:     []model.EntityCount{},
+	}
+	byDay := map[string]int64{}
+	byEntity := map[string]int64{}
+	for _, c := range counts {
+		stats.Total += c.Count
+		stats.ByStatus[c.Status] += c.Count
+		stats.BySchemaKind[c.SchemaKind] += c.Count
+		byDay[c.Day.Format(time.DateOnly)] += c.Count
+		byEntity[c.EntityID] += c.Count
+	}
+
+	for day := f.From; !day.After(f.To); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		stats.ByDay = append(stats.ByDay, model.DayCount{Day: key, Count: byDay[key]})
+	}
+	for id, n := range byEntity {
+		stats.ByEntity = append(stats.ByEntity, model.EntityCount{EntityID: id, Count: n})
+	}
+	sort.Slice(stats.ByEntity, func(i, j int) bool {
+		a, b := stats.ByEntity[i], stats.ByEntity[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.EntityID < b.EntityID
+	})
+	if len(stats.ByEntity) > maxStatsEntities {
+		stats.ByEntity = stats.ByEntity[:maxStatsEntities]
+	}
+	return stats, nil
+}
+
+// FlowStats summarizes the flows created in the filter's range by kind:
+// counts by status, completion rate and average duration
+func (s *StatsService) FlowStats(ctx context.Context, f db.StatsFilter) (*model.FlowStats, error) {
+	counts, refreshedAt, err := s.queries.ListFlowCounts(ctx, f, s.materialized)
+	if err != nil {
+		return nil, statsError("flows", err)
+	}
+
+	stats := &model.FlowStats{
+		From:        f.From.Format(time.DateOnly),
+		To:          f.To.Format(time.DateOnly),
+		Source:      s.source(),
+		RefreshedAt: timePtrToString(refreshedAt),
+		Kinds:       summarizeFlows(counts),
+	}
+	return stats, nil
+}
+
+func statsError(what string, err error) error {
+	if db.IsInvalidText(err) {
+		return invalid("invalid_filter", "malformed entityId", err)
+	}
+	return fmt.Errorf("failed to aggregate %s: %w", what, err)
+}
+
+func (s *StatsService) source() string {
+	if s.materialized {
+		return model.StatsMaterialized
+	}
+	return model.StatsLive
+}
+
+// summarizeFlows folds daily flow counts into per-kind stats, ordered by
+// kind
+func summarizeFlows(counts []db.FlowCount) []model.FlowKindStats {
+	type totals struct {
+		stats            model.FlowKindStats
+		completedSeconds float64
+	}
+	byKind := map[string]*totals{}
+	for _, c := range counts {
+		t, ok := byKind[c.Kind]
+		if !ok {
+			t = &totals{stats: model.FlowKindStats{Kind: c.Kind, ByStatus: map[string]int64{}}}
+			byKind[c.Kind] = t
+		}
+		t.stats.Total += c.Count
+		t.stats.ByStatus[c.Status] += c.Count
+		t.completedSeconds += c.CompletedSeconds
+	}
+
+	kinds := make([]model.FlowKindStats, 0, len(byKind))
+	for _, t := range byKind {
+		completed := t.stats.ByStatus[string(model.FlowStatusCompleted)]
+		finished := completed + t.stats.ByStatus[string(model.FlowStatusCancelled)] + t.stats.ByStatus[string(model.FlowStatusFailed)]
+		if finished > 0 {
+			t.stats.CompletionRate = float64(completed) / float64(finished)
+		}
+		if completed > 0 {
+			avg := t.completedSeconds / float64(completed)
+			t.stats.AvgDurationSeconds = &avg
+		}
+		kinds = append(kinds, t.stats)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].Kind < kinds[j].Kind })
+	return kinds
+}
+
+// StatsRefresher periodically refreshes the materialized stats views
+type StatsRefresher struct {
+	queries  db.Querier
+	interval time.Duration
+	log      *zap.Logger
+}
+
+// NewStatsRefresher creates a refresher that runs every interval
+func NewStatsRefresher(queries db.Querier, interval time.Duration, log *zap.Logger) *StatsRefresher {
+	return &StatsRefresher{queries: queries, interval: interval, log: log}
+}
+
+// Run refreshes the views until ctx is cancelled
+func (r *StatsRefresher) Run(ctx context.Context) {
+	r.log.Info("Stats refresher started", zap.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := r.queries.RefreshStats(ctx); err != nil {
+			if ctx.Err() == nil {
+				r.log.Error("Failed to refresh stats", zap.Error(err))
+			}
+		} else {
+			r.log.Debug("Refreshed stats", zap.Duration("took", time.Since(start)))
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log.Info("Stats refresher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
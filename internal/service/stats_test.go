@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsRange(t *testing.T) {
+	now := time.Date(2024, 3, 6, 15, 30, 0, 0, time.UTC)
+
+	f, err := StatsRange("", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 6, 0, 0, 0, 0, time.UTC), f.From)
+	assert.Equal(t, time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC), f.To)
+
+	f, err = StatsRange("2024-01-01", "2024-01-31", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), f.From)
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), f.To)
+
+	for _, r := range [][2]string{
+		{"yesterday", ""},
+		{"2024-02-01", "2024-01-01"},
+		{"2022-01-01", "2024-01-01"},
+	} {
+		_, err := StatsRange(r[0], r[1], now)
+		assert.True(t, errors.Is(err, ErrValidation), "%v", r)
+	}
+}
+
+func TestSummarizeFlows(t *testing.T) {
+	day := time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)
+	kinds := summarizeFlows([]db.FlowCount{
+		{Day: day, Kind: "onboarding", Status: "COMPLETED", Count: 3, CompletedSeconds: 300},
+		{Day: day.AddDate(0, 0, 1), Kind: "onboarding", Status: "COMPLETED", Count: 1, CompletedSeconds: 500},
+		{Day: day, Kind: "onboarding", Status: "FAILED", Count: 1},
+		{Day: day, Kind: "onboarding", Status: "RUNNING", Count: 5},
+		{Day: day, Kind: "approval", Status: "RUNNING", Count: 2},
+	})
+
+	require.Len(t, kinds, 2)
+	assert.Equal(t, "approval", kinds[0].Kind)
+	assert.Equal(t, int64(2), kinds[0].Total)
+	assert.Zero(t, kinds[0].CompletionRate)
+	assert.Nil(t, kinds[0].AvgDurationSeconds)
+
+	onboarding := kinds[1]
+	assert.Equal(t, int64(10), onboarding.Total)
+	assert.Equal(t, map[string]int64{"COMPLETED": 4, "FAILED": 1, "RUNNING": 5}, onboarding.ByStatus)
+	assert.InDelta(t, 0.8, onboarding.CompletionRate, 1e-9)
+	require.NotNil(t, onboarding.AvgDurationSeconds)
+	assert.InDelta(t, 200, *onboarding.AvgDurationSeconds, 1e-9)
+}
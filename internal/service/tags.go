@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/db"
+	"pxbox/internal/events"
+	"pxbox/internal/model"
+	"pxbox/internal/pubsub"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const maxTags = 20
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:/-]{0,63}$`)
+
+// NormalizeTags lowercases, deduplicates and sorts tags, rejecting tags
+// that are empty, longer than 64 characters or contain other characters
+// than letters, digits and "._:/-"
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, invalid("invalid_tags", fmt.Sprintf("invalid tag %q", tag), nil)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	if len(out) > maxTags {
+		return nil, invalid("invalid_tags", fmt.Sprintf("at most %d tags are allowed", maxTags), nil)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// TagUpdate changes the tags of a request. Set replaces them; Add and
+// Remove are applied after it.
+type TagUpdate struct {
+	Set    *[]string
+	Add    []string
+	Remove []string
+}
+
+// UpdateTags applies a tag change to a request and returns the request. If
+// expectedVersion is set, the change only applies at that version.
+func (s *RequestService) UpdateTags(ctx context.Context, id string, update TagUpdate, expectedVersion *int) (*model.Request, error) {
+	req, err := s.queries.GetRequestByID(ctx, id)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if expectedVersion != nil && req.Version != *expectedVersion {
+		return nil, fmt.Errorf("%w: expected version %d, current version %d", ErrVersionConflict, *expectedVersion, req.Version)
+	}
+
+	tags := req.Tags
+	if update.Set != nil {
+		tags = *update.Set
+	}
+	remove, err := NormalizeTags(update.Remove)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]string, 0, len(tags)+len(update.Add))
+	for _, tag := range append(append([]string{}, tags...), update.Add...) {
+		if !containsString(remove, strings.ToLower(strings.TrimSpace(tag))) {
+			next = append(next, tag)
+		}
+	}
+	next, err = NormalizeTags(next)
+	if err != nil {
+		return nil, err
+	}
+
+	// Guard the write with the version that was read, so concurrent tag
+	// changes are not lost
+	version, err := s.queries.SetRequestTags(ctx, id, next, &req.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to update tags: %w", s.transitionError(ctx, id, "", &req.Version, err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tags: %w", err)
+	}
+	before := req.Tags
+	req.Tags = next
+	req.Version = version
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionTag,
+		ResourceType: audit.ResourceRequest,
+		ResourceID:   id,
+		Meta:         map[string]interface{}{"before": before, "after": next},
+	})
+
+	event := pubsub.MarkSandbox(events.New(ctx, events.RequestUpdated{
+		RequestID: id,
+		Tags:      next,
+		Version:   version,
+	}), req.Sandbox)
+	_ = s.bus.PublishRequest(id, event)
+	_ = s.bus.PublishEntity(req.EntityID, event)
+
+	return s.requestModel(ctx, req)
+}
+
+// SearchRequests lists requests matching f
+func (s *RequestService) SearchRequests(ctx context.Context, f db.RequestFilter, sortBy string, limit, offset int) ([]*model.Request, error) {
+	var err error
+	if f.Tags, err = NormalizeTags(f.Tags); err != nil {
+		return nil, err
+	}
+	if f.AnyTags, err = NormalizeTags(f.AnyTags); err != nil {
+		return nil, err
+	}
+
+	requests, err := s.queries.SearchRequests(ctx, f, sortBy, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search requests: %w", err)
+	}
+	result := make([]*model.Request, 0, len(requests))
+	for _, r := range requests {
+		req, err := s.requestModel(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, req)
+	}
+	return result, nil
+}
+
+// TagSummary counts an entity's requests per tag
+type TagSummary struct {
+	Tag    string `json:"tag"`
+	Total  int64  `json:"total"`
+	Open   int64  `json:"open"`
+	Unread int64  `json:"unread"`
+}
+
+// TagSummary returns the tags used on an entity's requests with their
+// request counts, e.g. to show mailbox folders
+func (s *EntityService) TagSummary(ctx context.Context, entityID string) ([]TagSummary, error) {
+	rows, err := s.queries.GetEntityTagSummary(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize tags: %w", err)
+	}
+	summary := make([]TagSummary, 0, len(rows))
+	for _, r := range rows {
+		summary = append(summary, TagSummary{Tag: r.Tag, Total: r.Total, Open: r.Open, Unread: r.Unread})
+	}
+	return summary, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
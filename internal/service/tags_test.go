@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Finance ", "urgent", "finance", "team/ops"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"finance", "team/ops", "urgent"}, tags)
+
+	tags, err = NormalizeTags(nil)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	tooMany := make([]string, maxTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("t%d", i)
+	}
+	for _, bad := range [][]string{
+		{""},
+		{"two words"},
+		{"-leading"},
+		{strings.Repeat("a", 65)},
+		tooMany,
+	} {
+		_, err := NormalizeTags(bad)
+		assert.True(t, errors.Is(err, ErrValidation), "%q", bad)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+	"pxbox/internal/telegram"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// telegramLinkTTL is how long a Telegram link code can be sent to the bot
+const telegramLinkTTL = 15 * time.Minute
+
+var (
+	// errInvalidLinkCode hides whether a link code is unknown, used or
+	// expired
+	errInvalidLinkCode = &Error{Kind: ErrNotFound, Code: "invalid_link_code", Message: "link code is invalid or expired"}
+	// errChatNotLinked is returned for updates from chats no entity linked
+	errChatNotLinked = &Error{Kind: ErrForbidden, Code: "chat_not_linked", Message: "this chat is not linked to an entity"}
+)
+
+// CreateTelegramLink issues a code that links the Telegram chat it is sent
+// from, as "/start <code>", to an entity. The code can be used once within
+// 15 minutes; a chat linked before stays linked until then.
+func (s *EntityService) CreateTelegramLink(ctx context.Context, entityID string) (*model.TelegramLink, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "Telegram chats"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+	code, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(telegramLinkTTL)
+	if err := s.queries.SetTelegramLinkCode(ctx, entityID, hashShareToken(code), expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to create link code: %w", err)
+	}
+	link, err := s.GetTelegramLink(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+	link.Code = code
+	return link, nil
+}
+
+// GetTelegramLink returns whether an entity has linked a Telegram chat and
+// when its pending link code expires
+func (s *EntityService) GetTelegramLink(ctx context.Context, entityID string) (*model.TelegramLink, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "Telegram chats"); err != nil {
+		return nil, err
+	}
+	chat, err := s.queries.GetTelegramChat(ctx, entityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &model.TelegramLink{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Telegram chat: %w", err)
+	}
+	link := &model.TelegramLink{Linked: chat.ChatID != nil, LinkedAt: timePtrToString(chat.LinkedAt)}
+	if chat.CodeExpiresAt != nil && chat.CodeExpiresAt.After(time.Now()) {
+		link.CodeExpiresAt = timePtrToString(chat.CodeExpiresAt)
+	}
+	return link, nil
+}
+
+// DeleteTelegramLink unlinks the Telegram chat of an entity and voids its
+// link code
+func (s *EntityService) DeleteTelegramLink(ctx context.Context, entityID string) error {
+	if err := requireEntityOrAdmin(ctx, entityID, "Telegram chats"); err != nil {
+		return err
+	}
+	deleted, err := s.queries.DeleteTelegramChat(ctx, entityID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink Telegram chat: %w", err)
+	}
+	if !deleted {
+		return notFound("Telegram chat", nil)
+	}
+	return nil
+}
+
+// LinkTelegramChat links the chat a link code was sent from to the code's
+// entity and returns the entity. A chat linked to another entity before
+// moves.
+func (s *EntityService) LinkTelegramChat(ctx context.Context, code string, chatID int64) (string, error) {
+	var entityID string
+	err := s.queries.InTx(ctx, func(q db.Querier) error {
+		var err error
+		entityID, err = q.LinkTelegramChat(ctx, hashShareToken(code), chatID)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errInvalidLinkCode
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to link Telegram chat: %w", err)
+	}
+	return entityID, nil
+}
+
+// AnswerFromTelegram answers a request with choice i of its schema (see
+// telegram.Choices), pressed in the linked chat of the entity it is
+// addressed to. The answer is posted as that entity, so it is validated,
+// audited and announced like any other. It returns the choice's label.
+func (s *RequestService) AnswerFromTelegram(ctx context.Context, chatID int64, requestID string, i int) (string, error) {
+	entityID, err := s.queries.GetTelegramChatEntity(ctx, chatID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errChatNotLinked
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get Telegram chat: %w", err)
+	}
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return "", lookupError("request", err)
+	}
+	if req.EntityID != entityID {
+		return "", &Error{Kind: ErrForbidden, Code: "forbidden", Message: "the request is not addressed to this chat's entity"}
+	}
+
+	var field string
+	var choices []telegram.Choice
+	ok := false
+	if model.SchemaKind(req.SchemaKind) == model.SchemaKindJSON {
+		field, choices, ok = telegram.Choices(req.SchemaPayload)
+	}
+	if !ok || i >= len(choices) {
+		return "", invalid("invalid_choice", "the request cannot be answered with this button", nil)
+	}
+
+	ctx = audit.WithActor(auth.WithEntityID(ctx, entityID), entityID)
+	payload := map[string]interface{}{field: choices[i].Value}
+	if _, err := s.PostResponse(ctx, requestID, entityID, payload, nil, nil); err != nil {
+		return "", err
+	}
+	return choices[i].Label, nil
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var approvalSchema = map[string]interface{}{
+	"type":       "object",
+	"required":   []interface{}{"approved"},
+	"properties": map[string]interface{}{"approved": map[string]interface{}{"type": "boolean"}},
+}
+
+func TestTelegram(t *testing.T) {
+	f := newRequestFixture(t)
+	entitySvc := service.NewEntityService(f.queries)
+	ctx := auth.WithEntityID(context.Background(), f.entity.ID)
+
+	// Only the entity itself or an admin links its chat
+	_, err := entitySvc.CreateTelegramLink(context.Background(), f.entity.ID)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+
+	link, err := entitySvc.CreateTelegramLink(ctx, f.entity.ID)
+	require.NoError(t, err)
+	assert.False(t, link.Linked)
+	assert.NotEmpty(t, link.Code)
+	assert.NotNil(t, link.CodeExpiresAt)
+
+	// The code links the chat it is sent from, once
+	_, err = entitySvc.LinkTelegramChat(context.Background(), "wrong", 42)
+	assert.Equal(t, "invalid_link_code", service.Classify(err).Code)
+	entityID, err := entitySvc.LinkTelegramChat(context.Background(), link.Code, 42)
+	require.NoError(t, err)
+	assert.Equal(t, f.entity.ID, entityID)
+	_, err = entitySvc.LinkTelegramChat(context.Background(), link.Code, 42)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	got, err := entitySvc.GetTelegramLink(ctx, f.entity.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Linked)
+	assert.Empty(t, got.Code)
+
+	// New requests are sent to the chat; answer buttons post as the entity
+	req := f.create(t, service.CreateRequestInput{Schema: approvalSchema})
+	assert.Len(t, f.jobs.Jobs("EnqueueRequestNotification"), 1)
+
+	_, err = f.svc.AnswerFromTelegram(context.Background(), 7, req.ID, 0)
+	assert.Equal(t, "chat_not_linked", service.Classify(err).Code)
+	_, err = f.svc.AnswerFromTelegram(context.Background(), 42, req.ID, 2)
+	assert.Equal(t, "invalid_choice", service.Classify(err).Code)
+	label, err := f.svc.AnswerFromTelegram(context.Background(), 42, req.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "No", label)
+	answered, err := f.queries.GetRequestByID(context.Background(), req.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ANSWERED", answered.Status)
+	_, err = f.svc.AnswerFromTelegram(context.Background(), 42, req.ID, 0)
+	assert.Error(t, err)
+
+	// Free-form schemas need the full form
+	other := f.create(t, service.CreateRequestInput{})
+	_, err = f.svc.AnswerFromTelegram(context.Background(), 42, other.ID, 0)
+	assert.Equal(t, "invalid_choice", service.Classify(err).Code)
+
+	require.NoError(t, entitySvc.DeleteTelegramLink(ctx, f.entity.ID))
+	assert.ErrorIs(t, entitySvc.DeleteTelegramLink(ctx, f.entity.ID), service.ErrNotFound)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // Timezones must resolve on hosts without a zoneinfo database
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+)
+
+// displayLayout renders local times independent of language, e.g.
+// "2025-01-03 17:00 CET"
+const displayLayout = "2006-01-02 15:04 MST"
+
+// checkTimezone verifies that tz names an IANA timezone
+func checkTimezone(tz *string) error {
+	if tz == nil {
+		return nil
+	}
+	if *tz == "" || *tz == "Local" {
+		return invalid("invalid_timezone", "timezone must be an IANA name such as Europe/Prague", nil)
+	}
+	if _, err := time.LoadLocation(*tz); err != nil {
+		return invalid("invalid_timezone", "timezone must be an IANA name such as Europe/Prague", err)
+	}
+	return nil
+}
+
+// displayTime renders t in the request's timezone (UTC without one) with a
+// relative description from now. future and past phrase the relative part,
+// e.g. "due in %s" and "overdue by %s".
+func displayTime(t *time.Time, tz *string, now time.Time, future, past string) *model.TimeDisplay {
+	if t == nil {
+		return nil
+	}
+	loc := time.UTC
+	if tz != nil {
+		if l, err := time.LoadLocation(*tz); err == nil {
+			loc = l
+		}
+	}
+	display := &model.TimeDisplay{
+		Local:    t.In(loc).Format(displayLayout),
+		Timezone: loc.String(),
+	}
+	switch d := t.Sub(now); {
+	case d >= time.Minute:
+		display.Relative = fmt.Sprintf(future, humanizeDuration(d))
+	case d <= -time.Minute:
+		display.Relative = fmt.Sprintf(past, humanizeDuration(-d))
+	default:
+		display.Relative = "now"
+	}
+	return display
+}
+
+// humanizeDuration rounds d down to its largest unit: "45m", "3h", "2d"
+func humanizeDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
+
+// setTimeDisplays fills in the display renderings of a request's deadline
+// and attention time
+func setTimeDisplays(req *model.Request, r db.Request, now time.Time) {
+	req.DeadlineDisplay = displayTime(r.DeadlineAt, r.Timezone, now, "due in %s", "overdue by %s")
+	req.AttentionDisplay = displayTime(r.AttentionAt, r.Timezone, now, "in %s", "%s ago")
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisplayTime(t *testing.T) {
+	now := time.Date(2025, 1, 3, 13, 0, 0, 0, time.UTC)
+	deadline := now.Add(3*time.Hour + 20*time.Minute)
+	prague := "Europe/Prague"
+
+	assert.Equal(t, &model.TimeDisplay{
+		Local:    "2025-01-03 17:20 CET",
+		Timezone: "Europe/Prague",
+		Relative: "due in 3h",
+	}, displayTime(&deadline, &prague, now, "due in %s", "overdue by %s"))
+
+	assert.Equal(t, &model.TimeDisplay{
+		Local:    "2025-01-03 16:20 UTC",
+		Timezone: "UTC",
+		Relative: "due in 3h",
+	}, displayTime(&deadline, nil, now, "due in %s", "overdue by %s"))
+
+	past := now.Add(-50 * time.Hour)
+	assert.Equal(t, "overdue by 2d", displayTime(&past, nil, now, "due in %s", "overdue by %s").Relative)
+	soon := now.Add(45 * time.Minute)
+	assert.Equal(t, "in 45m", displayTime(&soon, nil, now, "in %s", "%s ago").Relative)
+	assert.Equal(t, "now", displayTime(&now, nil, now, "in %s", "%s ago").Relative)
+	assert.Nil(t, displayTime(nil, nil, now, "in %s", "%s ago"))
+}
+
+func TestSetTimeDisplays(t *testing.T) {
+	now := time.Now()
+	attention := now.Add(-2 * time.Hour)
+	req := &model.Request{}
+	setTimeDisplays(req, db.Request{AttentionAt: &attention}, now)
+	assert.Nil(t, req.DeadlineDisplay)
+	assert.Equal(t, "2h ago", req.AttentionDisplay.Relative)
+}
+
+func TestCheckTimezone(t *testing.T) {
+	for _, tz := range []string{"Europe/Prague", "America/New_York", "UTC"} {
+		assert.NoError(t, checkTimezone(&tz), tz)
+	}
+	for _, tz := range []string{"", "Local", "Mars/Olympus", "CET+1"} {
+		assert.ErrorIs(t, checkTimezone(&tz), ErrValidation, tz)
+	}
+	assert.NoError(t, checkTimezone(nil))
+}
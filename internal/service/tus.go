@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+	"pxbox/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// ResumableUpload is the state of a tus upload
+type ResumableUpload struct {
+	ID        string
+	Offset    int64
+	Length    int64
+	ExpiresAt *time.Time  // When an unfinished or unreferenced upload is deleted
+	File      *model.File // Set once the upload is complete
+}
+
+// CreateUploadInput describes a resumable upload to create
+type CreateUploadInput struct {
+	Name        string
+	ContentType string
+	RequestID   string // Optional; links the file to a request and its policy
+	CreatedBy   string
+	Length      int64
+}
+
+// CreateUpload starts a resumable upload. The declared length and the file
+// name are checked against the request's file policy up front.
+func (s *FileService) CreateUpload(ctx context.Context, input CreateUploadInput) (*ResumableUpload, error) {
+	if input.Name == "" {
+		return nil, invalid("invalid_request", "filename metadata is required", nil)
+	}
+	if input.Length <= 0 {
+		return nil, invalid("invalid_request", "upload length must be positive", nil)
+	}
+
+	id := ulid.Make().String()
+	f := db.File{
+		ID:        id,
+		ObjectKey: "uploads/" + id + "/" + path.Base(input.Name),
+		Name:      input.Name,
+		MIME:      input.ContentType,
+	}
+	if input.RequestID != "" {
+		f.RequestID = &input.RequestID
+	}
+
+	policy, err := s.policy(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.ValidateFile(f.Name, input.ContentType, 0); err != nil {
+		return nil, invalid("policy_violation", err.Error(), nil)
+	}
+	if limit := s.sizeLimit(policy); input.Length > limit {
+		return nil, fileTooLarge(limit)
+	}
+	if err := s.checkTotal(ctx, f, policy, input.Length); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.orphanTTL)
+	params := db.CreateFileParams{
+		ID:           id,
+		ObjectKey:    f.ObjectKey,
+		RequestID:    f.RequestID,
+		Name:         f.Name,
+		MIME:         f.MIME,
+		UploadLength: &input.Length,
+		ExpiresAt:    &expiresAt,
+	}
+	if input.CreatedBy != "" {
+		params.CreatedBy = &input.CreatedBy
+	}
+	if _, err := s.queries.CreatePendingFile(ctx, params); err != nil {
+		return nil, fmt.Errorf("failed to record upload: %w", err)
+	}
+	return &ResumableUpload{ID: id, Length: input.Length, ExpiresAt: &expiresAt}, nil
+}
+
+// GetUpload returns the progress of a resumable upload
+func (s *FileService) GetUpload(ctx context.Context, id string) (*ResumableUpload, error) {
+	f, err := s.resumable(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	upload := &ResumableUpload{ID: f.ID, Offset: f.UploadOffset, Length: *f.UploadLength, ExpiresAt: f.ExpiresAt}
+	if f.Status == "uploaded" {
+		upload.Offset = upload.Length
+		upload.File = s.toModel(ctx, f)
+	}
+	return upload, nil
+}
+
+// WriteChunk appends a chunk at offset, which must match the bytes received
+// so far. Each chunk is stored as its own object; a chunk interrupted
+// mid-transfer is dropped, so the client resumes from the previous offset.
+// The last chunk assembles the file and completes it like a direct upload.
+func (s *FileService) WriteChunk(ctx context.Context, id string, offset int64, declaredType string, body io.Reader) (*ResumableUpload, error) {
+	f, err := s.resumable(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if f.Status != "pending" {
+		return nil, &Error{Kind: ErrConflict, Code: "file_exists", Message: "file already uploaded"}
+	}
+	if offset != f.UploadOffset {
+		return nil, &Error{Kind: ErrConflict, Code: "offset_mismatch",
+			Message: fmt.Sprintf("upload is at offset %d", f.UploadOffset)}
+	}
+
+	policy, err := s.policy(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content type is sniffed from the start of the file only
+	var contentType string
+	if offset == 0 {
+		if declaredType == "" {
+			declaredType = f.MIME
+		}
+		if contentType, body, err = storage.SniffContentType(body, declaredType); err != nil {
+			return nil, fmt.Errorf("failed to read upload: %w", err)
+		}
+		if err := policy.ValidateFile(f.Name, contentType, 0); err != nil {
+			return nil, invalid("policy_violation", err.Error(), nil)
+		}
+	}
+
+	// A chunk may not run past the declared length
+	remaining := *f.UploadLength - offset
+	part := fmt.Sprintf("uploads/.parts/%s/%s", f.ID, ulid.Make().String())
+	chunk := storage.NewUploadReader(body, remaining)
+	if err := s.stor.Put(ctx, part, chunk); err != nil {
+		s.discard(part)
+		if errors.Is(err, storage.ErrTooLarge) {
+			return nil, &Error{Kind: ErrTooLarge, Code: "file_too_large",
+				Message: fmt.Sprintf("chunk exceeds the remaining %d bytes of the upload", remaining)}
+		}
+		return nil, fmt.Errorf("failed to store chunk: %w", err)
+	}
+
+	f, err = s.queries.AppendFilePart(ctx, id, offset, chunk.Size(), part, contentType)
+	if err != nil {
+		s.discard(part)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &Error{Kind: ErrConflict, Code: "offset_mismatch", Message: "upload was modified concurrently", Err: err}
+		}
+		return nil, fmt.Errorf("failed to record chunk: %w", err)
+	}
+
+	upload := &ResumableUpload{ID: f.ID, Offset: f.UploadOffset, Length: *f.UploadLength, ExpiresAt: f.ExpiresAt}
+	if f.UploadOffset < *f.UploadLength {
+		return upload, nil
+	}
+	if upload.File, err = s.assemble(ctx, f, policy); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// assemble concatenates the chunks of a finished upload into the final
+// object, hashing it on the way, and removes the chunks
+func (s *FileService) assemble(ctx context.Context, f db.File, policy *storage.FilePolicy) (*model.File, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, part := range f.UploadParts {
+			rc, err := s.stor.Get(ctx, part)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(pw, rc)
+			rc.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	content := storage.NewUploadReader(pr, 0)
+	err := s.stor.Put(ctx, f.ObjectKey, content)
+	pr.CloseWithError(err)
+	if err != nil {
+		s.discard(f.ObjectKey)
+		return nil, fmt.Errorf("failed to assemble upload: %w", err)
+	}
+	s.discardParts(f)
+
+	if err := s.checkTotal(ctx, f, policy, content.Size()); err != nil {
+		s.discard(f.ObjectKey)
+		_ = s.queries.DeleteFile(ctx, f.ID)
+		return nil, err
+	}
+	file, err := s.complete(ctx, f, f.MIME, content.Size(), content.SHA256())
+	if err != nil {
+		s.discard(f.ObjectKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+// TerminateUpload cancels a resumable upload and removes what was received
+func (s *FileService) TerminateUpload(ctx context.Context, id string) error {
+	f, err := s.resumable(ctx, id)
+	if err != nil {
+		return err
+	}
+	if f.Status != "pending" {
+		return &Error{Kind: ErrConflict, Code: "file_exists", Message: "file already uploaded"}
+	}
+	if err := s.queries.DeleteFile(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	s.discardParts(f)
+	return nil
+}
+
+// resumable looks up a file created by CreateUpload
+func (s *FileService) resumable(ctx context.Context, id string) (db.File, error) {
+	f, err := s.queries.GetFileByID(ctx, id)
+	if err != nil {
+		return f, lookupError("upload", err)
+	}
+	if f.UploadLength == nil {
+		return f, notFound("upload", nil)
+	}
+	return f, nil
+}
+
+func (s *FileService) discardParts(f db.File) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, part := range f.UploadParts {
+		_ = s.stor.Delete(ctx, part)
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+const maxViewNameLength = 100
+
+var errViewExists = &Error{Kind: ErrConflict, Code: "view_exists", Message: "a view with this name already exists"}
+
+// requireEntityOrAdmin lets through the entity itself and admins, for
+// what an entity keeps for itself, such as its views or devices
+func requireEntityOrAdmin(ctx context.Context, entityID, what string) error {
+	if auth.IsAdmin(ctx) || (entityID != "" && auth.GetEntityID(ctx) == entityID) {
+		return nil
+	}
+	return &Error{Kind: ErrForbidden, Code: "forbidden", Message: what + " can only be managed by their entity"}
+}
+
+// normalizeView validates a view name and filter
+func normalizeView(name string, filter model.ViewFilter) (string, model.ViewFilter, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxViewNameLength {
+		return "", filter, invalid("invalid_view", fmt.Sprintf("name must have 1 to %d characters", maxViewNameLength), nil)
+	}
+	filter.Status = strings.ToUpper(filter.Status)
+	if filter.Status != "" && !model.Status(filter.Status).Valid() {
+		return "", filter, invalid("invalid_view", "unknown status "+filter.Status, nil)
+	}
+	switch filter.SortBy {
+	case "", "created", "deadline":
+	default:
+		return "", filter, invalid("invalid_view", "sortBy must be created or deadline", nil)
+	}
+	tags, err := NormalizeTags(filter.Tags)
+	if err != nil {
+		return "", filter, err
+	}
+	filter.Tags = tags
+	return name, filter, nil
+}
+
+// CreateView saves a named inquiry filter for an entity
+func (s *EntityService) CreateView(ctx context.Context, entityID, name string, filter model.ViewFilter) (*model.SavedView, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "views"); err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.GetEntityByID(ctx, entityID); err != nil {
+		return nil, lookupError("entity", err)
+	}
+	name, filter, err := normalizeView(name, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.queries.CreateSavedView(ctx, ulid.Make().String(), entityID, name, viewFilterToMap(filter))
+	if db.IsUniqueViolation(err) {
+		return nil, errViewExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create view: %w", err)
+	}
+	return dbViewToModel(v), nil
+}
+
+// ListViews returns the saved views of an entity
+func (s *EntityService) ListViews(ctx context.Context, entityID string) ([]*model.SavedView, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "views"); err != nil {
+		return nil, err
+	}
+	views, err := s.queries.ListSavedViews(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list views: %w", err)
+	}
+	result := make([]*model.SavedView, 0, len(views))
+	for _, v := range views {
+		result = append(result, dbViewToModel(v))
+	}
+	return result, nil
+}
+
+// GetView returns a saved view. A non-empty entityID must own the view.
+func (s *EntityService) GetView(ctx context.Context, entityID, id string) (*model.SavedView, error) {
+	v, err := s.queries.GetSavedView(ctx, id)
+	if err != nil {
+		return nil, lookupError("view", err)
+	}
+	if entityID != "" && v.EntityID != entityID {
+		return nil, notFound("view", nil)
+	}
+	if err := requireEntityOrAdmin(ctx, v.EntityID, "views"); err != nil {
+		return nil, err
+	}
+	return dbViewToModel(v), nil
+}
+
+// UpdateView renames a saved view and replaces its filter
+func (s *EntityService) UpdateView(ctx context.Context, entityID, id, name string, filter model.ViewFilter) (*model.SavedView, error) {
+	if err := requireEntityOrAdmin(ctx, entityID, "views"); err != nil {
+		return nil, err
+	}
+	name, filter, err := normalizeView(name, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.queries.UpdateSavedView(ctx, id, entityID, name, viewFilterToMap(filter))
+	if db.IsUniqueViolation(err) {
+		return nil, errViewExists
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, notFound("view", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update view: %w", err)
+	}
+	return dbViewToModel(v), nil
+}
+
+// DeleteView removes a saved view
+func (s *EntityService) DeleteView(ctx context.Context, entityID, id string) error {
+	if err := requireEntityOrAdmin(ctx, entityID, "views"); err != nil {
+		return err
+	}
+	deleted, err := s.queries.DeleteSavedView(ctx, id, entityID)
+	if err != nil {
+		return fmt.Errorf("failed to delete view: %w", err)
+	}
+	if !deleted {
+		return notFound("view", nil)
+	}
+	return nil
+}
+
+// ViewRequestFilter returns the request filter of a saved view, limited to
+// the view's entity
+func ViewRequestFilter(v *model.SavedView) db.RequestFilter {
+	f := db.RequestFilter{EntityID: &v.EntityID, Tags: v.Filter.Tags}
+	if v.Filter.Status != "" {
+		status := v.Filter.Status
+		f.Status = &status
+	}
+	if v.Filter.CreatedBy != "" {
+		createdBy := v.Filter.CreatedBy
+		f.CreatedBy = &createdBy
+	}
+	return f
+}
+
+func viewFilterToMap(f model.ViewFilter) map[string]interface{} {
+	data, _ := json.Marshal(f)
+	var m map[string]interface{}
+	_ = json.Unmarshal(data, &m)
+	return m
+}
+
+func dbViewToModel(v db.SavedView) *model.SavedView {
+	var filter model.ViewFilter
+	if data, err := json.Marshal(v.Filter); err == nil {
+		_ = json.Unmarshal(data, &filter)
+	}
+	return &model.SavedView{
+		ID:        v.ID,
+		EntityID:  v.EntityID,
+		Name:      v.Name,
+		Filter:    filter,
+		CreatedAt: v.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: v.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"pxbox/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeView(t *testing.T) {
+	name, filter, err := normalizeView(" Open finance ", model.ViewFilter{Status: "pending", Tags: []string{"Finance"}, SortBy: "deadline"})
+	require.NoError(t, err)
+	assert.Equal(t, "Open finance", name)
+	assert.Equal(t, model.ViewFilter{Status: "PENDING", Tags: []string{"finance"}, SortBy: "deadline"}, filter)
+
+	for _, tc := range []struct {
+		name   string
+		filter model.ViewFilter
+	}{
+		{"", model.ViewFilter{}},
+		{strings.Repeat("v", maxViewNameLength+1), model.ViewFilter{}},
+		{"v", model.ViewFilter{Status: "WAITING"}},
+		{"v", model.ViewFilter{SortBy: "priority"}},
+		{"v", model.ViewFilter{Tags: []string{"two words"}}},
+	} {
+		_, _, err := normalizeView(tc.name, tc.filter)
+		assert.True(t, errors.Is(err, ErrValidation), "%q %+v", tc.name, tc.filter)
+	}
+}
+
+func TestViewRequestFilter(t *testing.T) {
+	f := ViewRequestFilter(&model.SavedView{
+		EntityID: "e1",
+		Filter:   model.ViewFilter{Status: "PENDING", Tags: []string{"finance"}},
+	})
+	require.NotNil(t, f.EntityID)
+	assert.Equal(t, "e1", *f.EntityID)
+	require.NotNil(t, f.Status)
+	assert.Equal(t, "PENDING", *f.Status)
+	assert.Nil(t, f.CreatedBy)
+	assert.Equal(t, []string{"finance"}, f.Tags)
+}
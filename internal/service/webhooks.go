@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"pxbox/internal/audit"
+	"pxbox/internal/auth"
+	"pxbox/internal/db"
+	"pxbox/internal/jobs"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	maxWebhookEvents = 20
+	// MaxSecretGrace is how long a rotated-out webhook secret can stay valid
+	MaxSecretGrace = 7 * 24 * time.Hour
+	// dispatchTimeout bounds recording the deliveries of one event
+	dispatchTimeout = 5 * time.Second
+)
+
+// eventPattern matches an event type such as "request.answered", a
+// wildcard over a prefix such as "request.*", or "*" for every event
+var eventPattern = regexp.MustCompile(`^(\*|[a-z_]+(\.[a-z_]+)*(\.\*)?)$`)
+
+// WebhookInput describes a webhook subscription. Without EntityID the
+// webhook receives the events of the calling requestor (X-Client-ID).
+type WebhookInput struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	EntityID string   `json:"entityId,omitempty"`
+	Secret   string   `json:"secret,omitempty"` // Generated when omitted
+}
+
+// WebhookUpdate changes a webhook; nil fields are left unchanged
+type WebhookUpdate struct {
+	URL    *string  `json:"url,omitempty"`
+	Events []string `json:"events,omitempty"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// WebhookService manages webhook subscriptions and turns the events
+// published on their channels into signed deliveries, posted by the job
+// server
+type WebhookService struct {
+	queries   db.Querier
+	jobClient JobClient
+	audit     *audit.Logger
+	log       *zap.Logger
+}
+
+// NewWebhookService creates a webhook service. Events are only delivered
+// once SetJobClient is called.
+func NewWebhookService(queries db.Querier, log *zap.Logger) *WebhookService {
+	return &WebhookService{queries: queries, log: log}
+}
+
+// SetJobClient sets the job client deliveries are enqueued with
+func (s *WebhookService) SetJobClient(client JobClient) {
+	s.jobClient = client
+}
+
+// SetAuditLogger enables audit logging of webhook changes
+func (s *WebhookService) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// CreateWebhook subscribes a URL to events of the calling requestor, or of
+// an entity the caller acts as. The returned webhook carries its secret,
+// which is not returned again.
+func (s *WebhookService) CreateWebhook(ctx context.Context, input WebhookInput) (*model.Webhook, error) {
+	var channel string
+	if input.EntityID != "" {
+		if !auth.IsAdmin(ctx) && auth.GetEntityID(ctx) != input.EntityID {
+			return nil, &Error{Kind: ErrForbidden, Code: "forbidden", Message: "entity webhooks can only be created by the entity or an admin"}
+		}
+		if _, err := s.queries.GetEntityByID(ctx, input.EntityID); err != nil {
+			return nil, lookupError("entity", err)
+		}
+		channel = "entity:" + input.EntityID
+	} else {
+		clientID := auth.GetClientID(ctx)
+		if clientID == "" {
+			return nil, invalid("missing_client_id", "X-Client-ID is required for requestor webhooks", nil)
+		}
+		channel = "requestor:" + clientID
+	}
+	if err := checkWebhookURL(input.URL); err != nil {
+		return nil, err
+	}
+	events, err := normalizeEventTypes(input.Events)
+	if err != nil {
+		return nil, err
+	}
+	secret := input.Secret
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := s.queries.CreateWebhook(ctx, db.CreateWebhookParams{
+		ID:         ulid.Make().String(),
+		Channel:    channel,
+		URL:        input.URL,
+		EventTypes: events,
+		Secret:     secret,
+		CreatedBy:  auth.Actor(ctx),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionCreate,
+		ResourceType: audit.ResourceWebhook,
+		ResourceID:   w.ID,
+		Meta:         map[string]interface{}{"channel": channel, "url": w.URL, "events": events},
+	})
+
+	result := dbWebhookToModel(w)
+	result.Secret = &w.Secret
+	return result, nil
+}
+
+// ListWebhooks returns the webhooks of the calling requestor, or of an
+// entity the caller acts as
+func (s *WebhookService) ListWebhooks(ctx context.Context, entityID string) ([]*model.Webhook, error) {
+	channel := "requestor:" + auth.GetClientID(ctx)
+	if entityID != "" {
+		channel = "entity:" + entityID
+	} else if auth.GetClientID(ctx) == "" {
+		return nil, invalid("missing_client_id", "X-Client-ID is required to list requestor webhooks", nil)
+	}
+	if !canAccessWebhooks(ctx, channel) {
+		return nil, &Error{Kind: ErrForbidden, Code: "forbidden", Message: "entity webhooks can only be listed by the entity or an admin"}
+	}
+
+	hooks, err := s.queries.ListWebhooks(ctx, channel, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	result := make([]*model.Webhook, 0, len(hooks))
+	for _, w := range hooks {
+		result = append(result, dbWebhookToModel(w))
+	}
+	return result, nil
+}
+
+// GetWebhook returns a webhook of the caller, without its secret
+func (s *WebhookService) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	w, err := s.getWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return dbWebhookToModel(w), nil
+}
+
+// UpdateWebhook changes the URL or events of a webhook, or pauses and
+// resumes it. Events published while a webhook is paused are not
+// delivered.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id string, update WebhookUpdate) (*model.Webhook, error) {
+	if _, err := s.getWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	if update.URL != nil {
+		if err := checkWebhookURL(*update.URL); err != nil {
+			return nil, err
+		}
+	}
+	var events []string
+	if update.Events != nil {
+		var err error
+		if events, err = normalizeEventTypes(update.Events); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := s.queries.UpdateWebhook(ctx, id, update.URL, events, update.Active)
+	if err != nil {
+		return nil, lookupError("webhook", err)
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ResourceType: audit.ResourceWebhook,
+		ResourceID:   id,
+		Meta:         map[string]interface{}{"url": w.URL, "events": w.EventTypes, "active": w.Active},
+	})
+	return dbWebhookToModel(w), nil
+}
+
+// RotateWebhookSecret replaces the secret of a webhook. For grace after the
+// rotation deliveries are also signed with the old secret, so the receiver
+// can switch over without dropping deliveries.
+func (s *WebhookService) RotateWebhookSecret(ctx context.Context, id string, grace time.Duration) (*model.Webhook, error) {
+	if grace < 0 || grace > MaxSecretGrace {
+		return nil, invalid("invalid_grace", fmt.Sprintf("grace must be between 0 and %s", MaxSecretGrace), nil)
+	}
+	if _, err := s.getWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := s.queries.RotateWebhookSecret(ctx, id, secret, time.Now().Add(grace))
+	if err != nil {
+		return nil, lookupError("webhook", err)
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionRotate,
+		ResourceType: audit.ResourceWebhook,
+		ResourceID:   id,
+		Meta:         map[string]interface{}{"grace": grace.String()},
+	})
+
+	result := dbWebhookToModel(w)
+	result.Secret = &w.Secret
+	return result, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	if _, err := s.getWebhook(ctx, id); err != nil {
+		return err
+	}
+	deleted, err := s.queries.DeleteWebhook(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if !deleted {
+		return notFound("webhook", nil)
+	}
+	s.audit.Record(ctx, audit.Entry{
+		Action:       audit.ActionDelete,
+		ResourceType: audit.ResourceWebhook,
+		ResourceID:   id,
+	})
+	return nil
+}
+
+// ListDeliveries returns the delivery log of a webhook, newest first,
+// optionally only the deliveries with a status
+func (s *WebhookService) ListDeliveries(ctx context.Context, id, status string, limit, offset int) ([]*model.WebhookDelivery, error) {
+	if _, err := s.getWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	var statusFilter *string
+	if status != "" {
+		status = strings.ToUpper(status)
+		switch status {
+		case jobs.WebhookPending, jobs.WebhookDelivered, jobs.WebhookFailed:
+		default:
+			return nil, invalid("invalid_status", "status must be PENDING, DELIVERED or FAILED", nil)
+		}
+		statusFilter = &status
+	}
+
+	deliveries, err := s.queries.ListWebhookDeliveries(ctx, id, statusFilter, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	result := make([]*model.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		result = append(result, dbWebhookDeliveryToModel(d))
+	}
+	return result, nil
+}
+
+// Redeliver posts a recorded delivery of a webhook again, e.g. one that
+// failed while the receiver was down
+func (s *WebhookService) Redeliver(ctx context.Context, id, deliveryID string) (*model.WebhookDelivery, error) {
+	if _, err := s.getWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	if s.jobClient == nil {
+		return nil, &Error{Kind: ErrUnavailable, Code: "jobs_unavailable", Message: "background jobs are not available"}
+	}
+	d, err := s.queries.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, lookupError("delivery", err)
+	}
+	if d.WebhookID != id {
+		return nil, notFound("delivery", nil)
+	}
+	if err := s.jobClient.EnqueueWebhookDelivery(ctx, d.ID); err != nil {
+		return nil, fmt.Errorf("failed to enqueue webhook delivery: %w", err)
+	}
+	return dbWebhookDeliveryToModel(d), nil
+}
+
+// Dispatch records a delivery of an event for every active webhook of the
+// channel it was published on whose events match its type, and enqueues
+// them. It is called by the event bus after every publish; failures are
+// logged and do not affect the publisher.
+func (s *WebhookService) Dispatch(channel string, event map[string]interface{}) {
+	if s.jobClient == nil || !(strings.HasPrefix(channel, "requestor:") || strings.HasPrefix(channel, "entity:")) {
+		return
+	}
+	eventType, _ := event["type"].(string)
+	if eventType == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+	defer cancel()
+	hooks, err := s.queries.ListWebhooks(ctx, channel, true)
+	if err != nil {
+		s.log.Warn("Failed to list webhooks", zap.String("channel", channel), zap.Error(err))
+		return
+	}
+	for _, w := range hooks {
+		if !matchesEventTypes(w.EventTypes, eventType) {
+			continue
+		}
+		d, err := s.queries.CreateWebhookDelivery(ctx, ulid.Make().String(), w.ID, eventType, event)
+		if err != nil {
+			s.log.Warn("Failed to record webhook delivery", zap.String("webhook_id", w.ID), zap.Error(err))
+			continue
+		}
+		if err := s.jobClient.EnqueueWebhookDelivery(ctx, d.ID); err != nil {
+			s.log.Warn("Failed to enqueue webhook delivery", zap.String("delivery_id", d.ID), zap.Error(err))
+		}
+	}
+}
+
+// getWebhook returns a webhook the caller may manage. Webhooks of other
+// requestors and entities are reported as not found.
+func (s *WebhookService) getWebhook(ctx context.Context, id string) (db.Webhook, error) {
+	w, err := s.queries.GetWebhook(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !canAccessWebhooks(ctx, w.Channel)) {
+		return w, notFound("webhook", err)
+	}
+	if err != nil {
+		return w, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return w, nil
+}
+
+// canAccessWebhooks reports whether the caller may manage the webhooks of
+// a channel: the requestor or entity it belongs to, or an admin
+func canAccessWebhooks(ctx context.Context, channel string) bool {
+	if auth.IsAdmin(ctx) {
+		return true
+	}
+	if id, ok := strings.CutPrefix(channel, "requestor:"); ok {
+		return id != "" && auth.GetClientID(ctx) == id
+	}
+	if id, ok := strings.CutPrefix(channel, "entity:"); ok {
+		return id != "" && auth.GetEntityID(ctx) == id
+	}
+	return false
+}
+
+func checkWebhookURL(hookURL string) error {
+	if u, err := url.Parse(hookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalid("invalid_url", "url must be an absolute http or https URL", err)
+	}
+	return nil
+}
+
+// normalizeEventTypes validates and deduplicates the event types of a
+// webhook
+func normalizeEventTypes(events []string) ([]string, error) {
+	if len(events) == 0 || len(events) > maxWebhookEvents {
+		return nil, invalid("invalid_events", fmt.Sprintf("events must list 1 to %d event types", maxWebhookEvents), nil)
+	}
+	seen := make(map[string]bool, len(events))
+	result := make([]string, 0, len(events))
+	for _, e := range events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !eventPattern.MatchString(e) {
+			return nil, invalid("invalid_events", fmt.Sprintf("invalid event type %q; use e.g. request.answered or request.*", e), nil)
+		}
+		if !seen[e] {
+			seen[e] = true
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// matchesEventTypes reports whether eventType matches one of patterns
+func matchesEventTypes(patterns []string, eventType string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSecret generates a random signing secret
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func dbWebhookToModel(w db.Webhook) *model.Webhook {
+	m := &model.Webhook{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.EventTypes,
+		Active:    w.Active,
+		CreatedBy: w.CreatedBy,
+		CreatedAt: w.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: w.UpdatedAt.Format(time.RFC3339),
+	}
+	if id, ok := strings.CutPrefix(w.Channel, "entity:"); ok {
+		m.EntityID = id
+	} else {
+		m.ClientID = strings.TrimPrefix(w.Channel, "requestor:")
+	}
+	if w.PreviousSecret != nil && w.PreviousSecretExpiresAt != nil && w.PreviousSecretExpiresAt.After(time.Now()) {
+		t := w.PreviousSecretExpiresAt.Format(time.RFC3339)
+		m.PreviousSecretExpiresAt = &t
+	}
+	return m
+}
+
+func dbWebhookDeliveryToModel(d db.WebhookDelivery) *model.WebhookDelivery {
+	return &model.WebhookDelivery{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		EventType:      d.EventType,
+		Event:          d.Event,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseStatus: d.ResponseStatus,
+		Error:          d.Error,
+		CreatedAt:      d.CreatedAt.Format(time.RFC3339),
+		LastAttemptAt:  timePtrToString(d.LastAttemptAt),
+		DeliveredAt:    timePtrToString(d.DeliveredAt),
+	}
+}
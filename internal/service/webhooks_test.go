@@ -0,0 +1,140 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pxbox/internal/auth"
+	"pxbox/internal/model"
+	"pxbox/internal/service"
+	pxtest "pxbox/internal/testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newWebhookService() (*service.WebhookService, *pxtest.Queries, *pxtest.JobClient) {
+	queries := pxtest.NewQueries()
+	jobs := pxtest.NewJobClient()
+	svc := service.NewWebhookService(queries, zap.NewNop())
+	svc.SetJobClient(jobs)
+	return svc, queries, jobs
+}
+
+func TestWebhookService_CreateWebhook(t *testing.T) {
+	svc, queries, _ := newWebhookService()
+	ctx := auth.WithClientID(context.Background(), "client-1")
+
+	hook, err := svc.CreateWebhook(ctx, service.WebhookInput{
+		URL:    "https://example.com/hook",
+		Events: []string{"request.*", "Request.Answered", "request.*"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "client-1", hook.ClientID)
+	assert.Equal(t, []string{"request.*", "request.answered"}, hook.Events)
+	require.NotNil(t, hook.Secret)
+	assert.Len(t, *hook.Secret, 64)
+
+	// The secret is only returned on creation
+	got, err := svc.GetWebhook(ctx, hook.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.Secret)
+
+	_, err = svc.CreateWebhook(context.Background(), service.WebhookInput{URL: "https://example.com/hook", Events: []string{"*"}})
+	assert.ErrorIs(t, err, service.ErrValidation)
+	_, err = svc.CreateWebhook(ctx, service.WebhookInput{URL: "ftp://example.com", Events: []string{"*"}})
+	assert.ErrorIs(t, err, service.ErrValidation)
+	_, err = svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/hook", Events: []string{"request.**"}})
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	// Entity webhooks are for the entity itself
+	entity, err := queries.CreateEntity(ctx, string(model.EntityKindUser), "ada", nil, false)
+	require.NoError(t, err)
+	_, err = svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/flows", Events: []string{"flow.*"}, EntityID: entity.ID})
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	hook, err = svc.CreateWebhook(auth.WithEntityID(ctx, entity.ID), service.WebhookInput{URL: "https://example.com/flows", Events: []string{"flow.*"}, EntityID: entity.ID})
+	require.NoError(t, err)
+	assert.Equal(t, entity.ID, hook.EntityID)
+}
+
+func TestWebhookService_OtherRequestorsWebhook(t *testing.T) {
+	svc, _, _ := newWebhookService()
+	ctx := auth.WithClientID(context.Background(), "client-1")
+	hook, err := svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/hook", Events: []string{"*"}})
+	require.NoError(t, err)
+
+	other := auth.WithClientID(context.Background(), "client-2")
+	_, err = svc.GetWebhook(other, hook.ID)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	assert.ErrorIs(t, svc.DeleteWebhook(other, hook.ID), service.ErrNotFound)
+
+	hooks, err := svc.ListWebhooks(other, "")
+	require.NoError(t, err)
+	assert.Empty(t, hooks)
+}
+
+func TestWebhookService_Dispatch(t *testing.T) {
+	svc, _, jobs := newWebhookService()
+	ctx := auth.WithClientID(context.Background(), "client-1")
+	answered, err := svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/a", Events: []string{"request.answered"}})
+	require.NoError(t, err)
+	all, err := svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/b", Events: []string{"request.*"}})
+	require.NoError(t, err)
+	paused, err := svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/c", Events: []string{"*"}})
+	require.NoError(t, err)
+	inactive := false
+	_, err = svc.UpdateWebhook(ctx, paused.ID, service.WebhookUpdate{Active: &inactive})
+	require.NoError(t, err)
+
+	svc.Dispatch("requestor:client-1", map[string]interface{}{"type": "request.created", "requestId": "r1"})
+	svc.Dispatch("requestor:client-1", map[string]interface{}{"type": "request.answered", "requestId": "r1"})
+	svc.Dispatch("requestor:client-2", map[string]interface{}{"type": "request.answered", "requestId": "r2"})
+	svc.Dispatch("request:r1", map[string]interface{}{"type": "request.answered", "requestId": "r1"})
+
+	assert.Len(t, jobs.Jobs("EnqueueWebhookDelivery"), 3)
+
+	deliveries, err := svc.ListDeliveries(ctx, answered.ID, "", 50, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "request.answered", deliveries[0].EventType)
+	assert.Equal(t, "PENDING", deliveries[0].Status)
+
+	deliveries, err = svc.ListDeliveries(ctx, paused.ID, "", 50, 0)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	deliveries, err = svc.ListDeliveries(ctx, all.ID, "pending", 50, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "request.answered", deliveries[0].EventType)
+
+	_, err = svc.Redeliver(ctx, all.ID, deliveries[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, jobs.Jobs("EnqueueWebhookDelivery"), 4)
+
+	// Deliveries are only redelivered through their own webhook
+	_, err = svc.Redeliver(ctx, answered.ID, deliveries[0].ID)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestWebhookService_RotateWebhookSecret(t *testing.T) {
+	svc, queries, _ := newWebhookService()
+	ctx := auth.WithClientID(context.Background(), "client-1")
+	hook, err := svc.CreateWebhook(ctx, service.WebhookInput{URL: "https://example.com/hook", Events: []string{"*"}, Secret: "old"})
+	require.NoError(t, err)
+
+	_, err = svc.RotateWebhookSecret(ctx, hook.ID, 8*24*time.Hour)
+	assert.ErrorIs(t, err, service.ErrValidation)
+
+	rotated, err := svc.RotateWebhookSecret(ctx, hook.ID, time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, rotated.Secret)
+	assert.NotEqual(t, "old", *rotated.Secret)
+	assert.NotNil(t, rotated.PreviousSecretExpiresAt)
+
+	stored, err := queries.GetWebhook(ctx, hook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "old", *stored.PreviousSecret)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+
+	"pxbox/internal/model"
+	"pxbox/internal/schema"
+)
+
+// PageValidation is the outcome of checking a partial payload against one
+// page of a multi-step request schema
+type PageValidation struct {
+	Valid        bool               `json:"valid"`
+	Page         string             `json:"page,omitempty"`
+	Visible      bool               `json:"visible"`
+	VisiblePages []string           `json:"visiblePages,omitempty"`
+	NextPage     string             `json:"nextPage,omitempty"`
+	Errors       []schema.Violation `json:"errors,omitempty"`
+}
+
+// ValidatePage checks payload against a request's schema without answering
+// it. With a page ID only that page's fields are checked, so a client can
+// drive a wizard one step at a time; without one the whole payload is
+// checked as PostResponse would.
+func (s *RequestService) ValidatePage(ctx context.Context, requestID, pageID string, payload map[string]interface{}) (*PageValidation, error) {
+	req, err := s.queries.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return nil, lookupError("request", err)
+	}
+	if err := model.RequestStatusMachine.Check(model.Status(req.Status), model.StatusAnswered); err != nil {
+		return nil, transitionConflict(err)
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	result := &PageValidation{Valid: true, Page: pageID, Visible: true}
+
+	// An example schema has no pages
+	pages, err := schema.Pages(req.SchemaPayload)
+	if err != nil {
+		return nil, invalid("invalid_schema", "invalid schema pages", err)
+	}
+	visible, err := s.schemaComp.VisiblePages(ctx, pages, payload)
+	if err != nil {
+		return nil, invalid("invalid_schema", "invalid schema pages", err)
+	}
+	for _, p := range visible {
+		result.VisiblePages = append(result.VisiblePages, p.ID)
+	}
+
+	target := req.SchemaPayload
+	if pageID != "" {
+		page, ok := findPage(pages, pageID)
+		if !ok {
+			return nil, notFound("page", nil)
+		}
+		result.Visible = containsPage(visible, pageID)
+		result.NextPage = nextVisiblePage(pages, visible, pageID)
+		if !result.Visible {
+			// Nothing on a hidden page needs answering
+			return result, nil
+		}
+		target = schema.PageSchema(req.SchemaPayload, page)
+	}
+
+	if err := s.schemaComp.Validate(ctx, req.SchemaKind, target, payload); err != nil {
+		violations := schema.Violations(err)
+		if violations == nil {
+			return nil, invalid("invalid_schema", "invalid schema", err)
+		}
+		result.Valid = false
+		result.Errors = violations
+	}
+	return result, nil
+}
+
+func findPage(pages []schema.Page, id string) (schema.Page, bool) {
+	for _, p := range pages {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return schema.Page{}, false
+}
+
+func containsPage(pages []schema.Page, id string) bool {
+	_, ok := findPage(pages, id)
+	return ok
+}
+
+// nextVisiblePage returns the first visible page declared after id
+func nextVisiblePage(pages, visible []schema.Page, id string) string {
+	after := false
+	for _, p := range pages {
+		if after && containsPage(visible, p.ID) {
+			return p.ID
+		}
+		if p.ID == id {
+			after = true
+		}
+	}
+	return ""
+}
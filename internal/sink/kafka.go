@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Kafka sends events to Kafka topics, keyed by channel so the events of a
+// channel stay in order on one partition
+type Kafka struct {
+	writer *kafka.Writer
+	topics Topics
+}
+
+// NewKafka creates a Kafka sink. Messages are written asynchronously in
+// batches; failed batches are logged.
+func NewKafka(brokers []string, topics Topics, log *zap.Logger) *Kafka {
+	return &Kafka{
+		topics: topics,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Balancer:               &kafka.Hash{},
+			BatchTimeout:           50 * time.Millisecond,
+			RequiredAcks:           kafka.RequireOne,
+			AllowAutoTopicCreation: true,
+			Async:                  true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Warn("Failed to send events to Kafka", zap.Int("count", len(messages)), zap.Error(err))
+				}
+			},
+		},
+	}
+}
+
+func (k *Kafka) Send(channel string, seq int64, data []byte) error {
+	topic := k.topics.For(channel)
+	if topic == "" {
+		return nil
+	}
+	// With Async set WriteMessages only queues the message
+	return k.writer.WriteMessages(context.Background(), kafka.Message{
+		Topic: topic,
+		Key:   []byte(channel),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "pxbox-channel", Value: []byte(channel)},
+			{Key: "pxbox-seq", Value: []byte(strconv.FormatInt(seq, 10))},
+		},
+	})
+}
+
+// Close flushes queued messages
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
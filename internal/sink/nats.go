@@ -0,0 +1,73 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// NATS publishes events to NATS JetStream subjects. Messages carry a
+// Nats-Msg-Id of channel and sequence number, so the stream drops
+// duplicates.
+type NATS struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	topics Topics
+}
+
+// NewNATS connects to a NATS server. With a stream name the stream is
+// created, or updated to cover the subjects of topics; otherwise streams
+// are expected to exist.
+func NewNATS(url, stream string, topics Topics, log *zap.Logger) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("pxbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn, jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, msg *nats.Msg, err error) {
+		log.Warn("Failed to send event to NATS", zap.String("subject", msg.Subject), zap.Error(err))
+	}))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+	if stream != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{Name: stream, Subjects: topics.subjects()}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set up stream %s: %w", stream, err)
+		}
+	}
+	return &NATS{conn: conn, js: js, topics: topics}, nil
+}
+
+func (n *NATS) Send(channel string, seq int64, data []byte) error {
+	subject := n.topics.For(channel)
+	if subject == "" {
+		return nil
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("Pxbox-Channel", channel)
+	msg.Header.Set("Pxbox-Seq", strconv.FormatInt(seq, 10))
+	if seq > 0 {
+		msg.Header.Set(jetstream.MsgIDHeader, channel+"/"+strconv.FormatInt(seq, 10))
+	}
+	_, err := n.js.PublishMsgAsync(msg)
+	return err
+}
+
+// Close waits briefly for outstanding acknowledgements and drains the
+// connection
+func (n *NATS) Close() error {
+	select {
+	case <-n.js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+	}
+	return n.conn.Drain()
+}
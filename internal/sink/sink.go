@@ -0,0 +1,98 @@
+// Package sink mirrors the events published on the bus to Kafka or NATS
+// JetStream, for data platforms consuming the pxbox event firehose.
+package sink
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"pxbox/internal/pubsub"
+
+	"go.uber.org/zap"
+)
+
+// DefaultTopic receives the events of channel types without a mapping
+const DefaultTopic = "pxbox.events"
+
+// Topics maps channel types, the part of a channel name before the first
+// colon, to the topic their events are sent to. "default" applies to
+// channel types without an entry. A topic may contain "{type}", replaced by
+// the channel type; an empty topic drops the events.
+type Topics map[string]string
+
+// TopicsFromEnv reads EVENT_SINK_TOPICS, a comma-separated list of
+// <channel type>=<topic> entries, e.g.
+// "default=pxbox.{type},presence=,ops=pxbox.ops"
+func TopicsFromEnv() (Topics, error) {
+	topics := Topics{"default": DefaultTopic}
+	for _, item := range strings.Split(os.Getenv("EVENT_SINK_TOPICS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, topic, ok := strings.Cut(item, "=")
+		if !ok || kind == "" || strings.ContainsAny(topic, " *>") {
+			return nil, fmt.Errorf("invalid EVENT_SINK_TOPICS entry %q", item)
+		}
+		topics[kind] = topic
+	}
+	return topics, nil
+}
+
+// For returns the topic of a channel, or "" if its events are dropped
+func (t Topics) For(channel string) string {
+	kind, _, _ := strings.Cut(channel, ":")
+	topic, ok := t[kind]
+	if !ok {
+		topic = t["default"]
+	}
+	return strings.ReplaceAll(topic, "{type}", kind)
+}
+
+// subjects returns the NATS subjects covering every topic, with "{type}"
+// matching any channel type
+func (t Topics) subjects() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, topic := range t {
+		subject := strings.ReplaceAll(topic, "{type}", "*")
+		if subject != "" && !seen[subject] {
+			seen[subject] = true
+			out = append(out, subject)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NewFromEnv creates the sink selected by EVENT_SINK: "kafka" sends to the
+// brokers in KAFKA_BROKERS, "nats" to the JetStream server at NATS_URL. It
+// returns nil if no sink is configured.
+func NewFromEnv(log *zap.Logger) (pubsub.Sink, error) {
+	backend := os.Getenv("EVENT_SINK")
+	if backend == "" {
+		return nil, nil
+	}
+	topics, err := TopicsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case "kafka":
+		brokers := os.Getenv("KAFKA_BROKERS")
+		if brokers == "" {
+			return nil, fmt.Errorf("EVENT_SINK=kafka requires KAFKA_BROKERS")
+		}
+		return NewKafka(strings.Split(brokers, ","), topics, log), nil
+	case "nats":
+		url := os.Getenv("NATS_URL")
+		if url == "" {
+			url = "nats://localhost:4222"
+		}
+		return NewNATS(url, os.Getenv("NATS_STREAM"), topics, log)
+	default:
+		return nil, fmt.Errorf("unknown EVENT_SINK %q", backend)
+	}
+}
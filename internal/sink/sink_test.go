@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTopicsFromEnv(t *testing.T) {
+	t.Setenv("EVENT_SINK_TOPICS", "")
+	topics, err := TopicsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTopic, topics.For("entity:e1"))
+
+	t.Setenv("EVENT_SINK_TOPICS", "default=pxbox.{type}, presence=,ops=pxbox.admin")
+	topics, err = TopicsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "pxbox.entity", topics.For("entity:e1"))
+	assert.Equal(t, "pxbox.requestor", topics.For("requestor:c1"))
+	assert.Equal(t, "pxbox.admin", topics.For("ops"))
+	assert.Equal(t, "", topics.For("presence:e1"))
+	assert.Equal(t, []string{"pxbox.*", "pxbox.admin"}, topics.subjects())
+
+	for _, bad := range []string{"entity", "=pxbox", "entity=pxbox.>", "entity=pxbox events"} {
+		t.Setenv("EVENT_SINK_TOPICS", bad)
+		_, err = TopicsFromEnv()
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("EVENT_SINK", "")
+	s, err := NewFromEnv(zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	t.Setenv("EVENT_SINK", "kafka")
+	t.Setenv("KAFKA_BROKERS", "")
+	_, err = NewFromEnv(zap.NewNop())
+	assert.Error(t, err)
+
+	t.Setenv("KAFKA_BROKERS", "localhost:9092")
+	s, err = NewFromEnv(zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &Kafka{}, s)
+	require.NoError(t, s.Close())
+
+	t.Setenv("EVENT_SINK", "pulsar")
+	_, err = NewFromEnv(zap.NewNop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"pxbox/internal/breaker"
+)
+
+// sharedBreaker guards the storage backend for the whole process, since
+// callers construct storage per operation
+var sharedBreaker = breaker.New("storage", breaker.FromEnv(breaker.Settings{
+	IsFailure: IsStorageFailure,
+}))
+
+// IsStorageFailure reports whether err indicates the storage backend itself
+// is unhealthy. Missing objects, cancelled contexts and rejected uploads do
+// not count.
+func IsStorageFailure(err error) bool {
+	return err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, ErrTooLarge)
+}
+
+// NewFromEnv creates the configured storage backend, guarded by the shared
+// circuit breaker
+func NewFromEnv() (Storage, error) {
+	local, err := NewLocalStorageFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return WithBreaker(local, sharedBreaker), nil
+}
+
+// breakerStorage guards a Storage with a circuit breaker
+type breakerStorage struct {
+	s Storage
+	b *breaker.Breaker
+}
+
+// WithBreaker wraps s so calls fail fast while b is open
+func WithBreaker(s Storage, b *breaker.Breaker) Storage {
+	return &breakerStorage{s: s, b: b}
+}
+
+func (s *breakerStorage) PresignPut(ctx context.Context, objectName, contentType string, expiresIn time.Duration) (url string, err error) {
+	err = s.b.Execute(func() error {
+		url, err = s.s.PresignPut(ctx, objectName, contentType, expiresIn)
+		return err
+	})
+	return url, err
+}
+
+func (s *breakerStorage) PresignGet(ctx context.Context, objectName string, expiresIn time.Duration) (url string, err error) {
+	err = s.b.Execute(func() error {
+		url, err = s.s.PresignGet(ctx, objectName, expiresIn)
+		return err
+	})
+	return url, err
+}
+
+func (s *breakerStorage) Put(ctx context.Context, objectName string, reader io.Reader) error {
+	return s.b.Execute(func() error {
+		return s.s.Put(ctx, objectName, reader)
+	})
+}
+
+func (s *breakerStorage) Get(ctx context.Context, objectName string) (rc io.ReadCloser, err error) {
+	err = s.b.Execute(func() error {
+		rc, err = s.s.Get(ctx, objectName)
+		return err
+	})
+	return rc, err
+}
+
+func (s *breakerStorage) Delete(ctx context.Context, objectName string) error {
+	return s.b.Execute(func() error {
+		return s.s.Delete(ctx, objectName)
+	})
+}
+
+// ObjectName forwards to the wrapped backend if it can resolve URLs. It does
+// not touch the backend, so it is not guarded by the breaker.
+func (s *breakerStorage) ObjectName(url string) (string, bool) {
+	if r, ok := s.s.(URLResolver); ok {
+		return r.ObjectName(url)
+	}
+	return "", false
+}
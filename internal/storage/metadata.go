@@ -11,6 +11,8 @@ type FileMetadata struct {
 	Size    int64  `json:"size"`
 	MIME    string `json:"mime"`
 	SHA256  string `json:"sha256,omitempty"`
+	// PreviewURL points at a thumbnail, added once it has been generated
+	PreviewURL string `json:"previewUrl,omitempty"`
 }
 
 // NormalizeFileMetadata normalizes file metadata from a map
@@ -38,6 +40,9 @@ func NormalizeFileMetadata(file map[string]interface{}) FileMetadata {
 	if sha256, ok := file["sha256"].(string); ok {
 		meta.SHA256 = sha256
 	}
+	if previewURL, ok := file["previewUrl"].(string); ok {
+		meta.PreviewURL = previewURL
+	}
 	
 	return meta
 }
@@ -67,6 +72,9 @@ func (m FileMetadata) ToMap() map[string]interface{} {
 	if m.SHA256 != "" {
 		result["sha256"] = m.SHA256
 	}
+	if m.PreviewURL != "" {
+		result["previewUrl"] = m.PreviewURL
+	}
 	return result
 }
 
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"crypto/sha256"
@@ -21,6 +22,12 @@ type Storage interface {
 	Delete(ctx context.Context, objectName string) error
 }
 
+// URLResolver is implemented by backends that can map a URL they issued back
+// to the object it points at
+type URLResolver interface {
+	ObjectName(url string) (string, bool)
+}
+
 // LocalStorage implements Storage using local filesystem
 type LocalStorage struct {
 	baseDir string
@@ -86,6 +93,30 @@ func (s *LocalStorage) Delete(ctx context.Context, objectName string) error {
 	return nil
 }
 
+// ObjectName returns the object behind a URL issued by PresignGet or
+// PresignPut. URLs pointing elsewhere are not resolved.
+func (s *LocalStorage) ObjectName(url string) (string, bool) {
+	name, ok := strings.CutPrefix(url, s.baseURL+"/files/")
+	if !ok || name == "" || strings.Contains(name, "..") {
+		return "", false
+	}
+	return name, true
+}
+
+// NewLocalStorageFromEnv creates a local storage backend configured from
+// STORAGE_BASE_DIR and STORAGE_BASE_URL
+func NewLocalStorageFromEnv() (*LocalStorage, error) {
+	baseDir := os.Getenv("STORAGE_BASE_DIR")
+	if baseDir == "" {
+		baseDir = "./storage"
+	}
+	baseURL := os.Getenv("STORAGE_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080/v1"
+	}
+	return NewLocalStorage(baseDir, baseURL)
+}
+
 // CalculateSHA256 calculates SHA256 hash of file content
 func CalculateSHA256(reader io.Reader) (string, error) {
 	hash := sha256.New()
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorageObjectName(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "http://localhost:8080")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		url  string
+		name string
+		ok   bool
+	}{
+		{"http://localhost:8080/files/uploads/a.pdf", "uploads/a.pdf", true},
+		{"http://localhost:8080/files/", "", false},
+		{"http://localhost:8080/files/../secret", "", false},
+		{"https://example.com/files/uploads/a.pdf", "", false},
+		{"uploads/a.pdf", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			name, ok := s.ObjectName(tt.url)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.name, name)
+		})
+	}
+
+	// The breaker wrapper forwards to the backend
+	name, ok := WithBreaker(s, sharedBreaker).(URLResolver).ObjectName("http://localhost:8080/files/x")
+	assert.True(t, ok)
+	assert.Equal(t, "x", name)
+}
+
+func TestUploadReader(t *testing.T) {
+	data := []byte("hello, world")
+	sum := sha256.Sum256(data)
+
+	u := NewUploadReader(bytes.NewReader(data), int64(len(data)))
+	got, err := io.ReadAll(u)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Equal(t, int64(len(data)), u.Size())
+	assert.Equal(t, hex.EncodeToString(sum[:]), u.SHA256())
+
+	u = NewUploadReader(bytes.NewReader(data), int64(len(data))-1)
+	_, err = io.ReadAll(u)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+
+	// No limit
+	u = NewUploadReader(bytes.NewReader(data), 0)
+	_, err = io.ReadAll(u)
+	assert.NoError(t, err)
+}
+
+func TestSniffContentType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+
+	tests := []struct {
+		name     string
+		content  string
+		declared string
+		want     string
+	}{
+		{"sniffed wins over declared", png, "application/pdf", "image/png"},
+		{"unknown binary keeps declared", "\x00\x01\x02\x03", "application/x-custom", "application/x-custom"},
+		{"text declared as json", `{"a": 1}`, "application/json", "application/json"},
+		{"text declared as csv", "a,b\n1,2\n", "text/csv; charset=utf-8", "text/csv; charset=utf-8"},
+		{"text declared as image", "just text", "image/png", "text/plain; charset=utf-8"},
+		{"nothing declared", "just text", "", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct, r, err := SniffContentType(strings.NewReader(tt.content), tt.declared)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, ct)
+
+			// The sniffed bytes are not lost
+			got, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.content, string(got))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrTooLarge is returned by an UploadReader once its limit is exceeded
+var ErrTooLarge = errors.New("file too large")
+
+// UploadReader passes an upload through while counting and hashing it,
+// failing with ErrTooLarge as soon as more than limit bytes have been read
+type UploadReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+	hash  hash.Hash
+}
+
+// NewUploadReader wraps r; a limit of 0 or less disables the size cap
+func NewUploadReader(r io.Reader, limit int64) *UploadReader {
+	return &UploadReader{r: r, limit: limit, hash: sha256.New()}
+}
+
+func (u *UploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.n += int64(n)
+	if u.limit > 0 && u.n > u.limit {
+		return 0, ErrTooLarge
+	}
+	u.hash.Write(p[:n])
+	return n, err
+}
+
+// Size returns the number of bytes read so far
+func (u *UploadReader) Size() int64 {
+	return u.n
+}
+
+// SHA256 returns the hex digest of the bytes read so far
+func (u *UploadReader) SHA256() string {
+	return hex.EncodeToString(u.hash.Sum(nil))
+}
+
+// SniffContentType detects the content type of an upload from its first 512
+// bytes. The declared type is only trusted when sniffing finds nothing more
+// specific: binary data of unknown format, or plain text declared as another
+// textual type such as JSON or CSV. The returned reader yields the full
+// content including the sniffed bytes.
+func SniffContentType(r io.Reader, declared string) (string, io.Reader, error) {
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return "", nil, err
+	}
+
+	sniffed := http.DetectContentType(head)
+	declaredType, _, parseErr := mime.ParseMediaType(declared)
+	if parseErr != nil {
+		return sniffed, br, nil
+	}
+
+	switch {
+	case strings.HasPrefix(sniffed, "application/octet-stream"):
+		return declared, br, nil
+	case strings.HasPrefix(sniffed, "text/plain") && isTextual(declaredType):
+		return declared, br, nil
+	}
+	return sniffed, br, nil
+}
+
+func isTextual(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
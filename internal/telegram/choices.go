@@ -0,0 +1,48 @@
+package telegram
+
+import "fmt"
+
+// maxChoices is the most answer buttons a message gets
+const maxChoices = 10
+
+// Choice is an answer that can be given with one button
+type Choice struct {
+	Label string
+	Value interface{}
+}
+
+// Choices returns the answers of a JSON Schema that can be given from a
+// chat: an object with a single property that is a boolean or an enum of
+// up to 10 strings, numbers or booleans. The answer to choice i is
+// {field: choices[i].Value}. Other schemas need the full form.
+func Choices(schema map[string]interface{}) (field string, choices []Choice, ok bool) {
+	if t, set := schema["type"]; set && t != "object" {
+		return "", nil, false
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) != 1 {
+		return "", nil, false
+	}
+	for name, p := range properties {
+		field = name
+		property, _ := p.(map[string]interface{})
+		if enum, isEnum := property["enum"].([]interface{}); isEnum {
+			if len(enum) == 0 || len(enum) > maxChoices {
+				return "", nil, false
+			}
+			for _, v := range enum {
+				switch v.(type) {
+				case string, float64, bool:
+				default:
+					return "", nil, false
+				}
+				choices = append(choices, Choice{Label: fmt.Sprint(v), Value: v})
+			}
+			return field, choices, true
+		}
+		if property["type"] == "boolean" {
+			return field, []Choice{{Label: "Yes", Value: true}, {Label: "No", Value: false}}, true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,156 @@
+// Package telegram talks to the Telegram Bot API: it sends request
+// notifications to linked chats and decodes the updates of the bot's webhook
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const apiEndpoint = "https://api.telegram.org"
+
+// ErrChatUnavailable is returned when Telegram refuses to message a chat,
+// e.g. because the user blocked the bot; the chat should be unlinked
+var ErrChatUnavailable = errors.New("telegram chat is no longer available")
+
+// Bot is a Telegram bot
+type Bot struct {
+	client   *http.Client
+	token    string
+	username string
+	secret   string
+	endpoint string
+}
+
+// New creates a bot with its API token. username is the bot's @name
+// without the @, used for t.me links; secret is the secret token the
+// webhook is registered with. endpoint overrides https://api.telegram.org,
+// for tests.
+func New(client *http.Client, token, username, secret, endpoint string) *Bot {
+	if endpoint == "" {
+		endpoint = apiEndpoint
+	}
+	return &Bot{client: client, token: token, username: strings.TrimPrefix(username, "@"), secret: secret, endpoint: strings.TrimSuffix(endpoint, "/")}
+}
+
+// FromEnv creates a bot from TELEGRAM_BOT_TOKEN, TELEGRAM_BOT_USERNAME and
+// TELEGRAM_WEBHOOK_SECRET. It returns nil if TELEGRAM_BOT_TOKEN is not set.
+func FromEnv() *Bot {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil
+	}
+	return New(&http.Client{Timeout: 10 * time.Second}, token,
+		os.Getenv("TELEGRAM_BOT_USERNAME"), os.Getenv("TELEGRAM_WEBHOOK_SECRET"), "")
+}
+
+// StartURL returns the t.me link that opens the bot and sends it
+// "/start <payload>", or "" if the bot's username is not known
+func (b *Bot) StartURL(payload string) string {
+	if b.username == "" {
+		return ""
+	}
+	return "https://t.me/" + url.PathEscape(b.username) + "?start=" + url.QueryEscape(payload)
+}
+
+// VerifyWebhook reports whether secret is the webhook's secret token, the
+// X-Telegram-Bot-Api-Secret-Token header of updates. Without a configured
+// secret no update is accepted.
+func (b *Bot) VerifyWebhook(secret string) bool {
+	return b.secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(b.secret)) == 1
+}
+
+// Button is an inline keyboard button that sends Data back as a callback
+// query when pressed
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"callback_data"`
+}
+
+// SendMessage sends a plain text message to a chat, with inline buttons
+// one per row
+func (b *Bot) SendMessage(ctx context.Context, chatID int64, text string, buttons []Button) error {
+	params := map[string]interface{}{"chat_id": chatID, "text": text}
+	if len(buttons) > 0 {
+		params["reply_markup"] = keyboard(buttons)
+	}
+	return b.call(ctx, "sendMessage", params)
+}
+
+// EditMessage replaces the text of a message the bot sent and removes its
+// buttons
+func (b *Bot) EditMessage(ctx context.Context, chatID, messageID int64, text string) error {
+	return b.call(ctx, "editMessageText", map[string]interface{}{
+		"chat_id":      chatID,
+		"message_id":   messageID,
+		"text":         text,
+		"reply_markup": keyboard(nil),
+	})
+}
+
+// AnswerCallback acknowledges a button press, showing text to the user;
+// alert shows it as a dialog instead of a toast
+func (b *Bot) AnswerCallback(ctx context.Context, callbackID, text string, alert bool) error {
+	return b.call(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": callbackID,
+		"text":              text,
+		"show_alert":        alert,
+	})
+}
+
+func keyboard(buttons []Button) map[string]interface{} {
+	rows := make([][]Button, 0, len(buttons))
+	for _, button := range buttons {
+		rows = append(rows, []Button{button})
+	}
+	return map[string]interface{}{"inline_keyboard": rows}
+}
+
+// call invokes a Bot API method
+func (b *Bot) call(ctx context.Context, method string, params map[string]interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.endpoint+"/bot"+b.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The URL carries the bot token; keep it out of logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result); err != nil {
+		return fmt.Errorf("invalid telegram %s response: %w", method, err)
+	}
+	if result.OK {
+		return nil
+	}
+	if result.ErrorCode == http.StatusForbidden || strings.Contains(result.Description, "chat not found") {
+		return ErrChatUnavailable
+	}
+	return fmt.Errorf("telegram %s returned %d: %s", method, result.ErrorCode, result.Description)
+}
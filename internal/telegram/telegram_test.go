@@ -0,0 +1,87 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendMessage(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botT0KEN/sendMessage":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.Write([]byte(`{"ok":true,"result":{}}`))
+		default:
+			w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+		}
+	}))
+	defer srv.Close()
+	bot := New(srv.Client(), "T0KEN", "@pxbox_bot", "s3cret", srv.URL)
+
+	err := bot.SendMessage(context.Background(), 42, "New request", []Button{{Text: "Yes", Data: AnswerData("r1", 0)}})
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, got["chat_id"])
+	assert.Equal(t, map[string]interface{}{
+		"inline_keyboard": []interface{}{[]interface{}{map[string]interface{}{"text": "Yes", "callback_data": "a:r1:0"}}},
+	}, got["reply_markup"])
+
+	assert.ErrorIs(t, bot.EditMessage(context.Background(), 42, 7, "Done"), ErrChatUnavailable)
+	assert.Equal(t, "https://t.me/pxbox_bot?start=abc", bot.StartURL("abc"))
+	assert.True(t, bot.VerifyWebhook("s3cret"))
+	assert.False(t, bot.VerifyWebhook(""))
+	assert.False(t, New(nil, "T0KEN", "", "", "").VerifyWebhook(""))
+}
+
+func TestChoices(t *testing.T) {
+	field, choices, ok := Choices(map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"approved": map[string]interface{}{"type": "boolean"}},
+	})
+	require.True(t, ok)
+	assert.Equal(t, "approved", field)
+	assert.Equal(t, []Choice{{"Yes", true}, {"No", false}}, choices)
+
+	field, choices, ok = Choices(map[string]interface{}{
+		"properties": map[string]interface{}{"size": map[string]interface{}{"enum": []interface{}{"S", "M", 3.0}}},
+	})
+	require.True(t, ok)
+	assert.Equal(t, "size", field)
+	assert.Equal(t, "3", choices[2].Label)
+
+	for _, schema := range []map[string]interface{}{
+		{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "string"}}},
+		{"type": "object", "properties": map[string]interface{}{
+			"a": map[string]interface{}{"type": "boolean"},
+			"b": map[string]interface{}{"type": "boolean"},
+		}},
+		{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"enum": []interface{}{map[string]interface{}{}}}}},
+		{"type": "array"},
+	} {
+		_, _, ok := Choices(schema)
+		assert.False(t, ok, schema)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	requestID, i, ok := ParseAnswerData(AnswerData("01HZX3", 12))
+	require.True(t, ok)
+	assert.Equal(t, "01HZX3", requestID)
+	assert.Equal(t, 12, i)
+	for _, data := range []string{"", "a:", "a::1", "a:r1", "a:r1:-1", "x:r1:0"} {
+		_, _, ok := ParseAnswerData(data)
+		assert.False(t, ok, data)
+	}
+
+	payload, ok := (&Message{Text: "/start 9f3c"}).StartPayload()
+	assert.True(t, ok)
+	assert.Equal(t, "9f3c", payload)
+	_, ok = (&Message{Text: "hello"}).StartPayload()
+	assert.False(t, ok)
+}
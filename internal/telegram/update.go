@@ -0,0 +1,69 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Update is the part of a webhook update the bot handles: a text message
+// or the press of an inline button
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+// Message is a message in a chat
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+// Chat identifies a private chat, group or channel
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// CallbackQuery is the press of an inline button of Message
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data"`
+}
+
+// StartPayload returns the payload of a "/start <payload>" message, as
+// sent by t.me/<bot>?start=<payload> links
+func (m *Message) StartPayload() (string, bool) {
+	fields := strings.Fields(m.Text)
+	if len(fields) == 0 || (fields[0] != "/start" && !strings.HasPrefix(fields[0], "/start@")) {
+		return "", false
+	}
+	if len(fields) == 1 {
+		return "", true
+	}
+	return fields[1], true
+}
+
+// answerPrefix starts the callback data of answer buttons
+const answerPrefix = "a:"
+
+// AnswerData is the callback data of the button for choice i of a request.
+// Telegram limits callback data to 64 bytes.
+func AnswerData(requestID string, i int) string {
+	return answerPrefix + requestID + ":" + strconv.Itoa(i)
+}
+
+// ParseAnswerData returns the request and choice of answer button data
+func ParseAnswerData(data string) (requestID string, i int, ok bool) {
+	rest, found := strings.CutPrefix(data, answerPrefix)
+	sep := strings.LastIndexByte(rest, ':')
+	if !found || sep <= 0 {
+		return "", 0, false
+	}
+	i, err := strconv.Atoi(rest[sep+1:])
+	if err != nil || i < 0 {
+		return "", 0, false
+	}
+	return rest[:sep], i, true
+}
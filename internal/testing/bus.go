@@ -0,0 +1,97 @@
+// Package testing provides in-memory implementations of the event bus,
+// event streams, job client and database queries, so services can be unit
+// tested without Postgres or Redis. Import it under another name, e.g.
+//
+//	pxtest "pxbox/internal/testing"
+package testing
+
+import (
+	"fmt"
+	"sync"
+
+	"pxbox/internal/events"
+)
+
+// Event is an event published on a channel
+type Event struct {
+	Channel string
+	Event   map[string]interface{}
+}
+
+// Bus records published events. It implements service.EventBus and uses
+// the channel names of pubsub.Bus. Like pubsub.Bus it checks events against
+// their registered shape; an invalid event panics, failing the test.
+type Bus struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) PublishEntity(entityID string, event map[string]interface{}) error {
+	return b.Publish("entity:"+entityID, event)
+}
+
+func (b *Bus) PublishRequest(requestID string, event map[string]interface{}) error {
+	return b.Publish("request:"+requestID, event)
+}
+
+func (b *Bus) PublishRequestor(clientID string, event map[string]interface{}) error {
+	return b.Publish("requestor:"+clientID, event)
+}
+
+func (b *Bus) PublishOps(event map[string]interface{}) error {
+	return b.Publish("ops", event)
+}
+
+// Publish records an event on a channel
+func (b *Bus) Publish(channel string, event map[string]interface{}) error {
+	if err := events.Validate(event); err != nil {
+		panic(fmt.Sprintf("publish to %s: %v", channel, err))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, Event{Channel: channel, Event: event})
+	return nil
+}
+
+// Events returns the events published on a channel, oldest first
+func (b *Bus) Events(channel string) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []map[string]interface{}
+	for _, e := range b.events {
+		if e.Channel == channel {
+			out = append(out, e.Event)
+		}
+	}
+	return out
+}
+
+// Types returns the types of the events published on a channel, oldest
+// first
+func (b *Bus) Types(channel string) []string {
+	var types []string
+	for _, e := range b.Events(channel) {
+		t, _ := e["type"].(string)
+		types = append(types, t)
+	}
+	return types
+}
+
+// All returns every published event, oldest first
+func (b *Bus) All() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event(nil), b.events...)
+}
+
+// Reset forgets the published events
+func (b *Bus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = nil
+}
@@ -0,0 +1,95 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files with the current payloads")
+
+var (
+	ulidPattern = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// Golden compares the JSON encoding of payload with the golden file
+// testdata/golden/<name>.json of the calling package. IDs and timestamps
+// are replaced by placeholders first, so the file pins the shape of the
+// payload and its stable values: a renamed, removed or retyped field fails
+// the test.
+//
+// Run the tests with -update to rewrite the files after an intended change,
+// or to record the files of new payloads. A missing file fails the test
+// otherwise, so a snapshot that was deleted or never committed is noticed.
+func Golden(t *testing.T, name string, payload interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(normalize(decoded)); err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	want, err := os.ReadFile(path)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+		}
+		return
+	}
+	if os.IsNotExist(err) {
+		t.Fatalf("golden file %s is missing (run with -update to record it)\ngot:\n%s", path, got)
+	}
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("payload %s differs from %s (run with -update if the change is intended)\nwant:\n%s\ngot:\n%s", name, path, want, got)
+	}
+}
+
+// normalize replaces the values that differ between runs
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+	case string:
+		switch {
+		case ulidPattern.MatchString(v):
+			return "<ulid>"
+		case uuidPattern.MatchString(v):
+			return "<uuid>"
+		}
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return "<time>"
+		}
+	}
+	return v
+}
@@ -0,0 +1,194 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"pxbox/internal/export"
+	"pxbox/internal/jobs"
+)
+
+// Job is a call to the job client: the method called, the ID it was
+// called with (request, flow, reminder, file key...) and when the job was
+// due, if scheduled
+type Job struct {
+	Method string
+	ID     string
+	At     time.Time
+	TaskID string
+}
+
+// JobClient records scheduled and enqueued jobs instead of running them.
+// It implements service.JobClient. Set Err to make every call fail.
+type JobClient struct {
+	Err error
+
+	mu        sync.Mutex
+	jobs      []Job
+	cancelled []string
+	exports   []export.Job
+	thumbs    []jobs.ThumbnailJob
+}
+
+// NewJobClient creates a job client with no jobs
+func NewJobClient() *JobClient {
+	return &JobClient{}
+}
+
+func (c *JobClient) record(method, id string, at time.Time) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return "", c.Err
+	}
+	taskID := fmt.Sprintf("task-%d", len(c.jobs)+1)
+	c.jobs = append(c.jobs, Job{Method: method, ID: id, At: at, TaskID: taskID})
+	return taskID, nil
+}
+
+func (c *JobClient) ScheduleDeadlineNotification(ctx context.Context, requestID string, deadlineAt time.Time) (string, error) {
+	return c.record("ScheduleDeadlineNotification", requestID, deadlineAt.Add(-time.Hour))
+}
+
+func (c *JobClient) ScheduleDeadlineExpiry(ctx context.Context, requestID string, deadlineAt time.Time) (string, error) {
+	return c.record("ScheduleDeadlineExpiry", requestID, deadlineAt)
+}
+
+func (c *JobClient) ScheduleRequestExpiry(ctx context.Context, requestID string, expiresAt time.Time) (string, error) {
+	return c.record("ScheduleRequestExpiry", requestID, expiresAt)
+}
+
+func (c *JobClient) ScheduleAutoCancel(ctx context.Context, requestID string, gracePeriod time.Duration) (string, error) {
+	return c.record("ScheduleAutoCancel", requestID, time.Now().Add(gracePeriod))
+}
+
+func (c *JobClient) CancelTask(taskID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	c.cancelled = append(c.cancelled, taskID)
+	return nil
+}
+
+func (c *JobClient) ScheduleAttentionNotification(ctx context.Context, requestID string, attentionAt time.Time) error {
+	_, err := c.record("ScheduleAttentionNotification", requestID, attentionAt)
+	return err
+}
+
+func (c *JobClient) ScheduleReminder(ctx context.Context, reminderID string, remindAt time.Time) (string, error) {
+	return c.record("ScheduleReminder", reminderID, remindAt)
+}
+
+func (c *JobClient) ScheduleClaimExpiry(ctx context.Context, requestID string, expiresAt time.Time) error {
+	_, err := c.record("ScheduleClaimExpiry", requestID, expiresAt)
+	return err
+}
+
+func (c *JobClient) ScheduleFlowTimeout(ctx context.Context, flowID, suspendID string, deadlineAt time.Time) (string, error) {
+	return c.record("ScheduleFlowTimeout", flowID+"/"+suspendID, deadlineAt)
+}
+
+func (c *JobClient) ScheduleFlowTick(ctx context.Context, flowID, tickID string, at time.Time) (string, error) {
+	return c.record("ScheduleFlowTick", flowID+"/"+tickID, at)
+}
+
+func (c *JobClient) EnqueueExport(ctx context.Context, job export.Job) error {
+	if _, err := c.record("EnqueueExport", job.ID, time.Time{}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exports = append(c.exports, job)
+	return nil
+}
+
+func (c *JobClient) EnqueueCallback(ctx context.Context, requestID string) error {
+	_, err := c.record("EnqueueCallback", requestID, time.Time{})
+	return err
+}
+
+func (c *JobClient) EnqueueBotDispatch(ctx context.Context, requestID string) error {
+	_, err := c.record("EnqueueBotDispatch", requestID, time.Time{})
+	return err
+}
+
+func (c *JobClient) EnqueueRequestNotification(ctx context.Context, requestID string) error {
+	_, err := c.record("EnqueueRequestNotification", requestID, time.Time{})
+	return err
+}
+
+func (c *JobClient) EnqueueWebhookDelivery(ctx context.Context, deliveryID string) error {
+	_, err := c.record("EnqueueWebhookDelivery", deliveryID, time.Time{})
+	return err
+}
+
+func (c *JobClient) EnqueueFileScan(ctx context.Context, key string) error {
+	_, err := c.record("EnqueueFileScan", key, time.Time{})
+	return err
+}
+
+func (c *JobClient) EnqueueThumbnail(ctx context.Context, job jobs.ThumbnailJob) error {
+	if _, err := c.record("EnqueueThumbnail", job.ResponseID, time.Time{}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.thumbs = append(c.thumbs, job)
+	return nil
+}
+
+func (c *JobClient) EnqueueErasure(ctx context.Context, erasureID string) error {
+	_, err := c.record("EnqueueErasure", erasureID, time.Time{})
+	return err
+}
+
+func (c *JobClient) EnqueueDigest(ctx context.Context, entityID string, slot time.Time) error {
+	_, err := c.record("EnqueueDigest", entityID, slot)
+	return err
+}
+
+// Jobs returns the jobs recorded by a method, e.g. "EnqueueCallback", in
+// call order
+func (c *JobClient) Jobs(method string) []Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []Job
+	for _, j := range c.jobs {
+		if j.Method == method {
+			out = append(out, j)
+		}
+	}
+	return out
+}
+
+// All returns every recorded job in call order
+func (c *JobClient) All() []Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Job(nil), c.jobs...)
+}
+
+// Cancelled returns the task IDs passed to CancelTask
+func (c *JobClient) Cancelled() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.cancelled...)
+}
+
+// Exports returns the enqueued export jobs
+func (c *JobClient) Exports() []export.Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]export.Job(nil), c.exports...)
+}
+
+// Thumbnails returns the enqueued thumbnail jobs
+func (c *JobClient) Thumbnails() []jobs.ThumbnailJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]jobs.ThumbnailJob(nil), c.thumbs...)
+}
@@ -0,0 +1,1292 @@
+package testing
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"pxbox/internal/db"
+	"pxbox/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oklog/ulid/v2"
+)
+
+// Queries keeps entities, requests, responses, request tasks, reminders,
+// comments, bundles, bot handlers, webhooks, saved views, maintenance
+// windows, business calendars, calendar feed tokens, devices, Telegram
+// chats and audit entries in memory. It implements the queries of the entity and
+// request lifecycle the way db.Queries does, with the same pgx.ErrNoRows and
+// unique violation errors; any other db.Querier method panics. InTx runs the
+// function directly, so a failed transaction is not rolled back.
+type Queries struct {
+	db.Querier
+
+	mu         sync.Mutex
+	entities   map[string]db.Entity
+	requests   map[string]db.Request
+	responses  map[string]db.Response // By request ID
+	tasks      map[string]map[string]db.RequestTask
+	reminders  map[string]db.Reminder
+	bots       map[string]db.BotHandler
+	webhooks   map[string]db.Webhook
+	deliveries map[string]db.WebhookDelivery
+
+	bundles        map[string]db.Bundle
+	bundleRequests map[string][]string // Request IDs by bundle ID, in order
+
+	requestFiles map[string][]map[string]interface{} // Attachments by request ID
+	shareLinks   map[string]db.ShareLink             // By token hash
+	views        map[string]db.SavedView
+	maintenance  map[string]db.MaintenanceWindow
+	calendars    map[string]model.BusinessCalendar // By entity ID
+	feedTokens   map[string]string                 // Entity IDs by token hash
+	devices      map[string]db.Device              // By ID
+	telegram     map[string]telegramChat           // By entity ID
+	comments     map[string][]db.Comment           // By request ID, oldest first
+	auditLog     []db.AuditEntry
+}
+
+// NewQueries creates an empty database
+func NewQueries() *Queries {
+	return &Queries{
+		entities:   map[string]db.Entity{},
+		requests:   map[string]db.Request{},
+		responses:  map[string]db.Response{},
+		tasks:      map[string]map[string]db.RequestTask{},
+		reminders:  map[string]db.Reminder{},
+		bots:       map[string]db.BotHandler{},
+		webhooks:   map[string]db.Webhook{},
+		deliveries: map[string]db.WebhookDelivery{},
+
+		bundles:        map[string]db.Bundle{},
+		bundleRequests: map[string][]string{},
+
+		requestFiles: map[string][]map[string]interface{}{},
+		shareLinks:   map[string]db.ShareLink{},
+		views:        map[string]db.SavedView{},
+		maintenance:  map[string]db.MaintenanceWindow{},
+		calendars:    map[string]model.BusinessCalendar{},
+		feedTokens:   map[string]string{},
+		devices:      map[string]db.Device{},
+		telegram:     map[string]telegramChat{},
+		comments:     map[string][]db.Comment{},
+	}
+}
+
+var uniqueViolation = &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+
+func (q *Queries) InTx(ctx context.Context, fn func(db.Querier) error) error {
+	return fn(q)
+}
+
+// Entities
+
+func (q *Queries) CreateEntity(ctx context.Context, kind, handle string, meta map[string]interface{}, sandbox bool) (db.Entity, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if handle != "" && q.handleTaken(handle, "") {
+		return db.Entity{}, uniqueViolation
+	}
+	e := db.Entity{
+		ID:        ulid.Make().String(),
+		Kind:      kind,
+		Meta:      meta,
+		CreatedAt: time.Now(),
+		Sandbox:   sandbox,
+	}
+	if handle != "" {
+		e.Handle = &handle
+	}
+	q.entities[e.ID] = e
+	return e, nil
+}
+
+func (q *Queries) handleTaken(handle, exceptID string) bool {
+	for _, e := range q.entities {
+		if e.ID != exceptID && e.Handle != nil && *e.Handle == handle {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queries) GetEntityByID(ctx context.Context, id string) (db.Entity, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entities[id]
+	if !ok {
+		return db.Entity{}, pgx.ErrNoRows
+	}
+	return e, nil
+}
+
+func (q *Queries) GetEntityByHandle(ctx context.Context, handle string) (db.Entity, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range q.entities {
+		if e.Handle != nil && *e.Handle == handle {
+			return e, nil
+		}
+	}
+	return db.Entity{}, pgx.ErrNoRows
+}
+
+// GetMergedEntity finds nothing: merges are not kept in memory
+func (q *Queries) GetMergedEntity(ctx context.Context, sourceID string) (db.Entity, error) {
+	return db.Entity{}, pgx.ErrNoRows
+}
+
+// GetMergedEntityByHandle finds nothing: merges are not kept in memory
+func (q *Queries) GetMergedEntityByHandle(ctx context.Context, handle string) (db.Entity, error) {
+	return db.Entity{}, pgx.ErrNoRows
+}
+
+func (q *Queries) UpdateEntity(ctx context.Context, id string, handle *string, meta map[string]interface{}) (db.Entity, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entities[id]
+	if !ok {
+		return db.Entity{}, pgx.ErrNoRows
+	}
+	if handle != nil {
+		if q.handleTaken(*handle, id) {
+			return db.Entity{}, uniqueViolation
+		}
+		h := *handle
+		e.Handle = &h
+	}
+	merged := make(map[string]interface{}, len(e.Meta)+len(meta))
+	for k, v := range e.Meta {
+		merged[k] = v
+	}
+	for k, v := range meta {
+		merged[k] = v
+	}
+	e.Meta = merged
+	q.entities[id] = e
+	return e, nil
+}
+
+func (q *Queries) SetEntityDeactivated(ctx context.Context, id string, at *time.Time) (db.Entity, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entities[id]
+	if !ok {
+		return db.Entity{}, pgx.ErrNoRows
+	}
+	if at == nil || e.DeactivatedAt == nil {
+		e.DeactivatedAt = at
+	}
+	q.entities[id] = e
+	return e, nil
+}
+
+// Requests
+
+func (q *Queries) CreateRequest(ctx context.Context, req db.CreateRequestParams) (db.Request, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.requests[req.ID]; ok {
+		return db.Request{}, uniqueViolation
+	}
+	now := time.Now()
+	tags := req.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	r := db.Request{
+		ID:              req.ID,
+		CreatedBy:       req.CreatedBy,
+		EntityID:        req.EntityID,
+		Status:          req.Status,
+		SchemaKind:      req.SchemaKind,
+		SchemaPayload:   req.SchemaPayload,
+		UIHints:         req.UIHints,
+		Prefill:         req.Prefill,
+		ExpiresAt:       req.ExpiresAt,
+		DeadlineAt:      req.DeadlineAt,
+		AttentionAt:     req.AttentionAt,
+		AutocancelGrace: req.AutocancelGrace,
+		CallbackURL:     req.CallbackURL,
+		CallbackSecret:  req.CallbackSecret,
+		CallbackFields:  req.CallbackFields,
+		Sandbox:         req.Sandbox,
+		Tags:            tags,
+		FilesPolicy:     req.FilesPolicy,
+		FlowID:          req.FlowID,
+		Locale:          req.Locale,
+		Timezone:        req.Timezone,
+		DeferredUntil:   req.DeferredUntil,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Version:         1,
+	}
+	q.requests[r.ID] = r
+	return r, nil
+}
+
+func (q *Queries) CreateRequests(ctx context.Context, reqs []db.CreateRequestParams) ([]db.Request, error) {
+	created := make([]db.Request, 0, len(reqs))
+	for _, req := range reqs {
+		r, err := q.CreateRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, r)
+	}
+	return created, nil
+}
+
+func (q *Queries) GetRequestByID(ctx context.Context, id string) (db.Request, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.requests[id]
+	if !ok {
+		return db.Request{}, pgx.ErrNoRows
+	}
+	return r, nil
+}
+
+func (q *Queries) GetRequestRef(ctx context.Context, id string) (db.RequestRef, error) {
+	r, err := q.GetRequestByID(ctx, id)
+	if err != nil {
+		return db.RequestRef{}, err
+	}
+	return r.Ref(), nil
+}
+
+func (q *Queries) GetQuotaUsage(ctx context.Context, createdBy, entityID string, since time.Time) (db.QuotaUsage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var u db.QuotaUsage
+	for _, r := range q.requests {
+		open := (r.Status == string(model.StatusPending) || r.Status == string(model.StatusClaimed)) && r.DeletedAt == nil
+		if open && r.CreatedBy == createdBy {
+			u.OpenByRequestor++
+		}
+		if open && r.EntityID == entityID {
+			u.OpenByEntity++
+		}
+		if r.CreatedBy == createdBy && !r.CreatedAt.Before(since) {
+			u.CreatedSince++
+		}
+	}
+	return u, nil
+}
+
+// transition moves a request to status if the status machine allows it and
+// the version matches, and lets update change the row further
+func (q *Queries) transition(id string, status model.Status, expectedVersion *int, update func(r *db.Request) bool) (db.Request, error) {
+	r, ok := q.requests[id]
+	if !ok || !model.RequestStatusMachine.CanTransition(model.Status(r.Status), status) {
+		return r, pgx.ErrNoRows
+	}
+	if expectedVersion != nil && r.Version != *expectedVersion {
+		return r, pgx.ErrNoRows
+	}
+	if update != nil && !update(&r) {
+		return r, pgx.ErrNoRows
+	}
+	r.Status = string(status)
+	r.Version++
+	r.UpdatedAt = time.Now()
+	q.requests[id] = r
+	return r, nil
+}
+
+func notExpired(r *db.Request) bool {
+	return r.ExpiresAt == nil || r.ExpiresAt.After(time.Now())
+}
+
+func (q *Queries) UpdateRequestStatus(ctx context.Context, id, status string, expectedVersion *int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := q.transition(id, model.Status(status), expectedVersion, nil)
+	return err
+}
+
+func (q *Queries) ClaimRequest(ctx context.Context, id, claimedBy string, expiresAt *time.Time, expectedVersion *int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := q.transition(id, model.StatusClaimed, expectedVersion, func(r *db.Request) bool {
+		if !notExpired(r) {
+			return false
+		}
+		now := time.Now()
+		r.ClaimedBy, r.ClaimedAt, r.ClaimExpiresAt = &claimedBy, &now, expiresAt
+		return true
+	})
+	return err
+}
+
+func (q *Queries) UnclaimRequest(ctx context.Context, id string, expiredOnly bool, expectedVersion *int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := q.transition(id, model.StatusPending, expectedVersion, func(r *db.Request) bool {
+		if r.Status != string(model.StatusClaimed) {
+			return false
+		}
+		if expiredOnly && (r.ClaimExpiresAt == nil || r.ClaimExpiresAt.After(time.Now())) {
+			return false
+		}
+		r.ClaimedBy, r.ClaimedAt, r.ClaimExpiresAt = nil, nil, nil
+		return true
+	})
+	return err
+}
+
+func (q *Queries) AnswerRequest(ctx context.Context, resp db.CreateResponseParams, expectedVersion *int) (db.Response, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.transition(resp.RequestID, model.StatusAnswered, expectedVersion, notExpired); err != nil {
+		return db.Response{}, err
+	}
+	return q.createResponse(resp), nil
+}
+
+func (q *Queries) ReviewResponse(ctx context.Context, p db.ReviewResponseParams, expectedVersion *int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	resp, ok := q.responses[p.RequestID]
+	if !ok {
+		return 0, pgx.ErrNoRows
+	}
+	r, err := q.transition(p.RequestID, model.Status(p.Status), expectedVersion, func(r *db.Request) bool {
+		if r.Status != string(model.StatusAnswered) {
+			return false
+		}
+		if p.Status == string(model.StatusPending) {
+			r.ClaimedBy, r.ClaimedAt, r.ClaimExpiresAt = nil, nil, nil
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	review, reviewedBy := p.Review, p.ReviewedBy
+	resp.Review, resp.ReviewReason, resp.ReviewedBy, resp.ReviewedAt = &review, p.Reason, &reviewedBy, &now
+	q.responses[p.RequestID] = resp
+	return r.Version, nil
+}
+
+func (q *Queries) CreateResponse(ctx context.Context, resp db.CreateResponseParams) (db.Response, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.requests[resp.RequestID]; !ok {
+		return db.Response{}, &pgconn.PgError{Code: "23503", Message: "request does not exist"}
+	}
+	return q.createResponse(resp), nil
+}
+
+func (q *Queries) createResponse(resp db.CreateResponseParams) db.Response {
+	r := db.Response{
+		ID:         resp.ID,
+		RequestID:  resp.RequestID,
+		AnsweredAt: time.Now(),
+		AnsweredBy: resp.AnsweredBy,
+		Payload:    resp.Payload,
+		Files:      resp.Files,
+	}
+	q.responses[resp.RequestID] = r
+	return r
+}
+
+func (q *Queries) GetResponseByRequestID(ctx context.Context, requestID string) (db.Response, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.responses[requestID]
+	if !ok {
+		return db.Response{}, pgx.ErrNoRows
+	}
+	return r, nil
+}
+
+// AttachFilesToResponse does nothing: uploads are not kept in memory
+func (q *Queries) AttachFilesToResponse(ctx context.Context, responseID string, keys []string) error {
+	return nil
+}
+
+// CreateRequestFiles records attachments; like AttachFilesToResponse, the
+// uploads themselves are not tracked
+func (q *Queries) CreateRequestFiles(ctx context.Context, requestID string, files []map[string]interface{}, keys []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.requestFiles[requestID] = append(q.requestFiles[requestID], files...)
+	return nil
+}
+
+func (q *Queries) ListRequestFiles(ctx context.Context, requestID string) ([]map[string]interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.requestFiles[requestID], nil
+}
+
+func (q *Queries) MarkRequestDelivered(ctx context.Context, id, entityID string) (time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.requests[id]
+	if !ok || r.EntityID != entityID || r.DeliveredAt != nil {
+		return time.Time{}, pgx.ErrNoRows
+	}
+	now := time.Now()
+	r.DeliveredAt = &now
+	q.requests[id] = r
+	return now, nil
+}
+
+func (q *Queries) UpdateRequestDeadline(ctx context.Context, id string, deadlineAt time.Time, expectedVersion *int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.requests[id]
+	if !ok || !model.Status(r.Status).IsOpen() || (expectedVersion != nil && r.Version != *expectedVersion) {
+		return 0, pgx.ErrNoRows
+	}
+	r.DeadlineAt = &deadlineAt
+	r.Version++
+	r.UpdatedAt = time.Now()
+	q.requests[id] = r
+	return r.Version, nil
+}
+
+// Request tasks
+
+func (q *Queries) SaveRequestTask(ctx context.Context, t db.RequestTask) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.tasks[t.RequestID] == nil {
+		q.tasks[t.RequestID] = map[string]db.RequestTask{}
+	}
+	q.tasks[t.RequestID][t.Kind] = t
+	return nil
+}
+
+func (q *Queries) ListRequestTasks(ctx context.Context, requestID string) ([]db.RequestTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var tasks []db.RequestTask
+	for _, t := range q.tasks[requestID] {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Kind < tasks[j].Kind })
+	return tasks, nil
+}
+
+func (q *Queries) DeleteRequestTask(ctx context.Context, requestID, kind string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.tasks[requestID], kind)
+	return nil
+}
+
+// Snoozes and reminders
+
+func (q *Queries) SnoozeRequest(ctx context.Context, id, entityID string, until time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.requests[id]
+	if !ok || r.EntityID != entityID || r.DeletedAt != nil {
+		return pgx.ErrNoRows
+	}
+	r.SnoozedUntil = &until
+	r.UpdatedAt = time.Now()
+	q.requests[id] = r
+	return nil
+}
+
+func (q *Queries) GetReminderByID(ctx context.Context, id string) (db.Reminder, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.reminders[id]
+	if !ok {
+		return db.Reminder{}, pgx.ErrNoRows
+	}
+	return r, nil
+}
+
+func (q *Queries) CreateReminder(ctx context.Context, requestID, entityID string, remindAt time.Time) (db.Reminder, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, r := range q.reminders {
+		if r.RequestID == requestID && r.EntityID == entityID && r.DeliveredAt == nil {
+			return db.Reminder{}, uniqueViolation
+		}
+	}
+	r := db.Reminder{
+		ID:        ulid.Make().String(),
+		RequestID: requestID,
+		EntityID:  entityID,
+		RemindAt:  remindAt,
+		CreatedAt: time.Now(),
+	}
+	q.reminders[r.ID] = r
+	return r, nil
+}
+
+func (q *Queries) DeletePendingReminders(ctx context.Context, requestID, entityID string) ([]db.Reminder, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var deleted []db.Reminder
+	for id, r := range q.reminders {
+		if r.RequestID == requestID && r.EntityID == entityID && r.DeliveredAt == nil {
+			deleted = append(deleted, r)
+			delete(q.reminders, id)
+		}
+	}
+	return deleted, nil
+}
+
+func (q *Queries) SetReminderTask(ctx context.Context, id, taskID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r, ok := q.reminders[id]; ok {
+		r.TaskID = &taskID
+		q.reminders[id] = r
+	}
+	return nil
+}
+
+func (q *Queries) ListReminders(ctx context.Context, requestID, entityID string) ([]db.Reminder, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reminders := make([]db.Reminder, 0)
+	for _, r := range q.reminders {
+		if r.RequestID == requestID && r.EntityID == entityID {
+			reminders = append(reminders, r)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].RemindAt.Before(reminders[j].RemindAt) })
+	return reminders, nil
+}
+
+func (q *Queries) DeleteReminder(ctx context.Context, id string) (db.Reminder, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.reminders[id]
+	if !ok || r.DeliveredAt != nil {
+		return db.Reminder{}, pgx.ErrNoRows
+	}
+	delete(q.reminders, id)
+	return r, nil
+}
+
+// DeliverReminder marks a reminder delivered, as its job does
+func (q *Queries) DeliverReminder(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r, ok := q.reminders[id]; ok {
+		now := time.Now()
+		r.DeliveredAt = &now
+		q.reminders[id] = r
+	}
+}
+
+// Bot handlers
+
+func (q *Queries) UpsertBotHandler(ctx context.Context, entityID, url, secret string) (db.BotHandler, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	h, ok := q.bots[entityID]
+	if !ok {
+		h = db.BotHandler{EntityID: entityID, CreatedAt: now}
+	}
+	h.URL, h.Secret, h.UpdatedAt = url, secret, now
+	q.bots[entityID] = h
+	return h, nil
+}
+
+func (q *Queries) GetBotHandler(ctx context.Context, entityID string) (db.BotHandler, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	h, ok := q.bots[entityID]
+	if !ok {
+		return db.BotHandler{}, pgx.ErrNoRows
+	}
+	return h, nil
+}
+
+func (q *Queries) DeleteBotHandler(ctx context.Context, entityID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.bots[entityID]
+	delete(q.bots, entityID)
+	return ok, nil
+}
+
+// Webhooks
+
+func (q *Queries) CreateWebhook(ctx context.Context, p db.CreateWebhookParams) (db.Webhook, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	w := db.Webhook{
+		ID:         p.ID,
+		Channel:    p.Channel,
+		URL:        p.URL,
+		EventTypes: p.EventTypes,
+		Secret:     p.Secret,
+		Active:     true,
+		CreatedBy:  p.CreatedBy,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	q.webhooks[w.ID] = w
+	return w, nil
+}
+
+func (q *Queries) GetWebhook(ctx context.Context, id string) (db.Webhook, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w, ok := q.webhooks[id]
+	if !ok {
+		return db.Webhook{}, pgx.ErrNoRows
+	}
+	return w, nil
+}
+
+func (q *Queries) ListWebhooks(ctx context.Context, channel string, activeOnly bool) ([]db.Webhook, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []db.Webhook
+	for _, w := range q.webhooks {
+		if w.Channel == channel && (w.Active || !activeOnly) {
+			out = append(out, w)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (q *Queries) UpdateWebhook(ctx context.Context, id string, url *string, eventTypes []string, active *bool) (db.Webhook, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w, ok := q.webhooks[id]
+	if !ok {
+		return db.Webhook{}, pgx.ErrNoRows
+	}
+	if url != nil {
+		w.URL = *url
+	}
+	if eventTypes != nil {
+		w.EventTypes = eventTypes
+	}
+	if active != nil {
+		w.Active = *active
+	}
+	w.UpdatedAt = time.Now()
+	q.webhooks[id] = w
+	return w, nil
+}
+
+func (q *Queries) RotateWebhookSecret(ctx context.Context, id, secret string, previousExpiresAt time.Time) (db.Webhook, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w, ok := q.webhooks[id]
+	if !ok {
+		return db.Webhook{}, pgx.ErrNoRows
+	}
+	previous := w.Secret
+	w.Secret, w.PreviousSecret, w.PreviousSecretExpiresAt = secret, &previous, &previousExpiresAt
+	w.UpdatedAt = time.Now()
+	q.webhooks[id] = w
+	return w, nil
+}
+
+func (q *Queries) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.webhooks[id]
+	delete(q.webhooks, id)
+	for did, d := range q.deliveries {
+		if d.WebhookID == id {
+			delete(q.deliveries, did)
+		}
+	}
+	return ok, nil
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, id, webhookID, eventType string, event map[string]interface{}) (db.WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := db.WebhookDelivery{
+		ID:        id,
+		WebhookID: webhookID,
+		EventType: eventType,
+		Event:     event,
+		Status:    "PENDING",
+		CreatedAt: time.Now(),
+	}
+	q.deliveries[id] = d
+	return d, nil
+}
+
+func (q *Queries) GetWebhookDelivery(ctx context.Context, id string) (db.WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d, ok := q.deliveries[id]
+	if !ok {
+		return db.WebhookDelivery{}, pgx.ErrNoRows
+	}
+	return d, nil
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, webhookID string, status *string, limit, offset int) ([]db.WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []db.WebhookDelivery
+	for _, d := range q.deliveries {
+		if d.WebhookID == webhookID && (status == nil || d.Status == *status) {
+			out = append(out, d)
+		}
+	}
+	// Newest first; IDs are ULIDs
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	if offset >= len(out) {
+		return nil, nil
+	}
+	out = out[offset:]
+	if limit < len(out) {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// Bundles
+
+func (q *Queries) CreateBundle(ctx context.Context, p db.CreateBundleParams) (db.Bundle, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b := db.Bundle{
+		ID:        p.ID,
+		EntityID:  p.EntityID,
+		CreatedBy: p.CreatedBy,
+		Title:     p.Title,
+		CreatedAt: time.Now(),
+	}
+	q.bundles[b.ID] = b
+	for _, id := range p.RequestIDs {
+		q.bundleRequests[b.ID] = append(q.bundleRequests[b.ID], id)
+	}
+	return q.withBundleItems(b), nil
+}
+
+func (q *Queries) GetBundle(ctx context.Context, id string) (db.Bundle, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b, ok := q.bundles[id]
+	if !ok {
+		return db.Bundle{}, pgx.ErrNoRows
+	}
+	return q.withBundleItems(b), nil
+}
+
+func (q *Queries) withBundleItems(b db.Bundle) db.Bundle {
+	b.Items = nil
+	for _, id := range q.bundleRequests[b.ID] {
+		if r, ok := q.requests[id]; ok && r.DeletedAt == nil {
+			b.Items = append(b.Items, db.BundleItem{RequestID: id, Status: r.Status})
+		}
+	}
+	return b
+}
+
+func (q *Queries) GetRequestBundleIDs(ctx context.Context, requestIDs []string) (map[string]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	bundles := map[string]string{}
+	for bundleID, ids := range q.bundleRequests {
+		for _, id := range ids {
+			for _, want := range requestIDs {
+				if id == want {
+					bundles[id] = bundleID
+				}
+			}
+		}
+	}
+	return bundles, nil
+}
+
+func (q *Queries) CompleteRequestBundle(ctx context.Context, requestID string) (db.Bundle, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for bundleID, ids := range q.bundleRequests {
+		for _, id := range ids {
+			if id != requestID {
+				continue
+			}
+			b := q.bundles[bundleID]
+			if b.CompletedAt != nil {
+				return db.Bundle{}, pgx.ErrNoRows
+			}
+			for _, other := range ids {
+				if !model.Status(q.requests[other].Status).IsAnswered() {
+					return db.Bundle{}, pgx.ErrNoRows
+				}
+			}
+			now := time.Now()
+			b.CompletedAt = &now
+			q.bundles[bundleID] = b
+			return q.withBundleItems(b), nil
+		}
+	}
+	return db.Bundle{}, pgx.ErrNoRows
+}
+
+// Maintenance windows
+
+func (q *Queries) CreateMaintenanceWindow(ctx context.Context, w db.MaintenanceWindow) (db.MaintenanceWindow, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w.CreatedAt = time.Now()
+	q.maintenance[w.ID] = w
+	return w, nil
+}
+
+func (q *Queries) ListMaintenanceWindows(ctx context.Context, entityID string, now time.Time) ([]db.MaintenanceWindow, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	windows := []db.MaintenanceWindow{}
+	for _, w := range q.maintenance {
+		if w.EntityID == entityID && w.EndsAt.After(now) {
+			windows = append(windows, w)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		if !windows[i].StartsAt.Equal(windows[j].StartsAt) {
+			return windows[i].StartsAt.Before(windows[j].StartsAt)
+		}
+		return windows[i].ID < windows[j].ID
+	})
+	return windows, nil
+}
+
+func (q *Queries) GetActiveMaintenanceWindow(ctx context.Context, entityID string, at time.Time) (db.MaintenanceWindow, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var active *db.MaintenanceWindow
+	for _, w := range q.maintenance {
+		if w.EntityID == entityID && !w.StartsAt.After(at) && w.EndsAt.After(at) && (active == nil || w.EndsAt.After(active.EndsAt)) {
+			w := w
+			active = &w
+		}
+	}
+	if active == nil {
+		return db.MaintenanceWindow{}, pgx.ErrNoRows
+	}
+	return *active, nil
+}
+
+func (q *Queries) DeleteMaintenanceWindow(ctx context.Context, entityID, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w, ok := q.maintenance[id]; !ok || w.EntityID != entityID {
+		return pgx.ErrNoRows
+	}
+	delete(q.maintenance, id)
+	return nil
+}
+
+// Business calendars
+
+func (q *Queries) GetBusinessCalendar(ctx context.Context, entityID string) (model.BusinessCalendar, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c, ok := q.calendars[entityID]
+	if !ok {
+		return model.BusinessCalendar{}, pgx.ErrNoRows
+	}
+	return c, nil
+}
+
+func (q *Queries) UpsertBusinessCalendar(ctx context.Context, entityID string, c model.BusinessCalendar) (model.BusinessCalendar, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	q.calendars[entityID] = c
+	return c, nil
+}
+
+// Calendar feeds
+
+func (q *Queries) SetCalendarFeedToken(ctx context.Context, entityID, tokenHash string) (time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deleteFeedToken(entityID)
+	q.feedTokens[tokenHash] = entityID
+	return time.Now(), nil
+}
+
+func (q *Queries) GetCalendarFeedEntity(ctx context.Context, tokenHash string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entityID, ok := q.feedTokens[tokenHash]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return entityID, nil
+}
+
+func (q *Queries) DeleteCalendarFeedToken(ctx context.Context, entityID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.deleteFeedToken(entityID), nil
+}
+
+func (q *Queries) deleteFeedToken(entityID string) bool {
+	for hash, id := range q.feedTokens {
+		if id == entityID {
+			delete(q.feedTokens, hash)
+			return true
+		}
+	}
+	return false
+}
+
+// Devices
+
+func (q *Queries) UpsertDevice(ctx context.Context, d db.Device) (db.Device, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for id, existing := range q.devices {
+		if existing.Platform == d.Platform && existing.Token == d.Token {
+			existing.EntityID, existing.Name, existing.UpdatedAt = d.EntityID, d.Name, now
+			q.devices[id] = existing
+			return existing, nil
+		}
+	}
+	d.CreatedAt, d.UpdatedAt = now, now
+	q.devices[d.ID] = d
+	return d, nil
+}
+
+func (q *Queries) ListDevices(ctx context.Context, entityID string) ([]db.Device, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	devices := make([]db.Device, 0)
+	for _, d := range q.devices {
+		if d.EntityID == entityID {
+			devices = append(devices, d)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices, nil
+}
+
+func (q *Queries) DeleteDevice(ctx context.Context, entityID, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d, ok := q.devices[id]
+	if !ok || d.EntityID != entityID {
+		return pgx.ErrNoRows
+	}
+	delete(q.devices, id)
+	return nil
+}
+
+func (q *Queries) HasNotificationTargets(ctx context.Context, entityID string) (bool, error) {
+	devices, _ := q.ListDevices(ctx, entityID)
+	chat, err := q.GetTelegramChat(ctx, entityID)
+	return len(devices) > 0 || (err == nil && chat.ChatID != nil), nil
+}
+
+// Telegram chats
+
+type telegramChat struct {
+	db.TelegramChat
+	codeHash string
+}
+
+func (q *Queries) SetTelegramLinkCode(ctx context.Context, entityID, codeHash string, expiresAt time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c, ok := q.telegram[entityID]
+	if !ok {
+		c.EntityID, c.CreatedAt = entityID, time.Now()
+	}
+	c.codeHash, c.CodeExpiresAt = codeHash, &expiresAt
+	q.telegram[entityID] = c
+	return nil
+}
+
+func (q *Queries) LinkTelegramChat(ctx context.Context, codeHash string, chatID int64) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for entityID, c := range q.telegram {
+		if c.codeHash != codeHash || !c.CodeExpiresAt.After(time.Now()) {
+			continue
+		}
+		for otherID, other := range q.telegram {
+			if other.ChatID != nil && *other.ChatID == chatID {
+				other.ChatID, other.LinkedAt = nil, nil
+				q.telegram[otherID] = other
+			}
+		}
+		now := time.Now()
+		c.ChatID, c.LinkedAt, c.codeHash, c.CodeExpiresAt = &chatID, &now, "", nil
+		q.telegram[entityID] = c
+		return entityID, nil
+	}
+	return "", pgx.ErrNoRows
+}
+
+func (q *Queries) GetTelegramChat(ctx context.Context, entityID string) (db.TelegramChat, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c, ok := q.telegram[entityID]
+	if !ok {
+		return db.TelegramChat{}, pgx.ErrNoRows
+	}
+	return c.TelegramChat, nil
+}
+
+func (q *Queries) GetTelegramChatEntity(ctx context.Context, chatID int64) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for entityID, c := range q.telegram {
+		if c.ChatID != nil && *c.ChatID == chatID {
+			return entityID, nil
+		}
+	}
+	return "", pgx.ErrNoRows
+}
+
+func (q *Queries) DeleteTelegramChat(ctx context.Context, entityID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.telegram[entityID]
+	delete(q.telegram, entityID)
+	return ok, nil
+}
+
+// Comments
+
+func (q *Queries) CreateComment(ctx context.Context, p db.CreateCommentParams) (db.Comment, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c := db.Comment{
+		ID:         p.ID,
+		RequestID:  p.RequestID,
+		Author:     p.Author,
+		AuthorRole: p.AuthorRole,
+		Body:       p.Body,
+		Files:      p.Files,
+		CreatedAt:  time.Now(),
+	}
+	q.comments[p.RequestID] = append(q.comments[p.RequestID], c)
+	return c, nil
+}
+
+func (q *Queries) ListComments(ctx context.Context, requestID string, limit, offset int) ([]db.Comment, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	comments := q.comments[requestID]
+	if offset >= len(comments) {
+		return nil, nil
+	}
+	comments = comments[offset:]
+	if limit < len(comments) {
+		comments = comments[:limit]
+	}
+	return append([]db.Comment(nil), comments...), nil
+}
+
+// Audit log
+
+func (q *Queries) InsertAuditEntry(ctx context.Context, e db.InsertAuditEntryParams) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	q.auditLog = append(q.auditLog, db.AuditEntry{
+		ID:           int64(len(q.auditLog) + 1),
+		OccurredAt:   e.OccurredAt,
+		Actor:        e.Actor,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		BeforeStatus: e.BeforeStatus,
+		AfterStatus:  e.AfterStatus,
+		IP:           e.IP,
+		Meta:         e.Meta,
+	})
+	return nil
+}
+
+func (q *Queries) ListAuditEntries(ctx context.Context, f db.AuditFilter, limit, offset int) ([]db.AuditEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	matches := func(filter *string, value string) bool { return filter == nil || *filter == value }
+	var entries []db.AuditEntry
+	for i := len(q.auditLog) - 1; i >= 0; i-- {
+		e := q.auditLog[i]
+		if matches(f.Actor, e.Actor) && matches(f.Action, e.Action) &&
+			matches(f.ResourceType, e.ResourceType) && matches(f.ResourceID, e.ResourceID) &&
+			(f.Since == nil || !e.OccurredAt.Before(*f.Since)) && (f.Until == nil || e.OccurredAt.Before(*f.Until)) {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].OccurredAt.After(entries[j].OccurredAt) })
+	if offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[offset:]
+	if limit < len(entries) {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Share links
+
+func (q *Queries) CreateShareLink(ctx context.Context, p db.CreateShareLinkParams) (db.ShareLink, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l := db.ShareLink{
+		ID:        p.ID,
+		TokenHash: p.TokenHash,
+		RequestID: p.RequestID,
+		CreatedBy: p.CreatedBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: p.ExpiresAt,
+	}
+	q.shareLinks[l.TokenHash] = l
+	return l, nil
+}
+
+func (q *Queries) GetShareLinkByToken(ctx context.Context, tokenHash string) (db.ShareLink, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, ok := q.shareLinks[tokenHash]
+	if !ok || l.UsedAt != nil || !l.ExpiresAt.After(time.Now()) {
+		return db.ShareLink{}, pgx.ErrNoRows
+	}
+	return l, nil
+}
+
+func (q *Queries) UseShareLink(ctx context.Context, tokenHash string) (db.ShareLink, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, ok := q.shareLinks[tokenHash]
+	if !ok || l.UsedAt != nil || !l.ExpiresAt.After(time.Now()) {
+		return db.ShareLink{}, pgx.ErrNoRows
+	}
+	now := time.Now()
+	l.UsedAt = &now
+	q.shareLinks[tokenHash] = l
+	return l, nil
+}
+
+func (q *Queries) ReleaseShareLink(ctx context.Context, id string) error {
+	return q.updateShareLink(id, func(l *db.ShareLink) { l.UsedAt, l.UsedBy = nil, nil })
+}
+
+func (q *Queries) SetShareLinkAnswerer(ctx context.Context, id, entityID string) error {
+	return q.updateShareLink(id, func(l *db.ShareLink) { l.UsedBy = &entityID })
+}
+
+func (q *Queries) updateShareLink(id string, update func(*db.ShareLink)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for hash, l := range q.shareLinks {
+		if l.ID == id {
+			update(&l)
+			q.shareLinks[hash] = l
+		}
+	}
+	return nil
+}
+
+// SearchRequests supports the EntityID, CreatedBy, Tags and IncludeDeleted
+// filters, newest first
+func (q *Queries) SearchRequests(ctx context.Context, f db.RequestFilter, sortBy string, limit, offset int) ([]db.Request, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	matches := make([]db.Request, 0)
+	for _, r := range q.requests {
+		if (f.EntityID != nil && r.EntityID != *f.EntityID) ||
+			(f.CreatedBy != nil && r.CreatedBy != *f.CreatedBy) ||
+			(f.Status != nil && r.Status != *f.Status) ||
+			(!f.IncludeDeleted && r.DeletedAt != nil) ||
+			!hasTags(r.Tags, f.Tags) {
+			continue
+		}
+		matches = append(matches, r)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID > matches[j].ID })
+	if offset >= len(matches) {
+		return []db.Request{}, nil
+	}
+	matches = matches[offset:]
+	if limit > 0 && limit < len(matches) {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func hasTags(tags, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, t := range tags {
+			found = found || t == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Queries) CreateSavedView(ctx context.Context, id, entityID, name string, filter map[string]interface{}) (db.SavedView, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.viewNameTaken(entityID, name, "") {
+		return db.SavedView{}, uniqueViolation
+	}
+	now := time.Now()
+	v := db.SavedView{ID: id, EntityID: entityID, Name: name, Filter: filter, CreatedAt: now, UpdatedAt: now}
+	q.views[id] = v
+	return v, nil
+}
+
+func (q *Queries) viewNameTaken(entityID, name, exceptID string) bool {
+	for _, v := range q.views {
+		if v.ID != exceptID && v.EntityID == entityID && v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queries) ListSavedViews(ctx context.Context, entityID string) ([]db.SavedView, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	views := make([]db.SavedView, 0)
+	for _, v := range q.views {
+		if v.EntityID == entityID {
+			views = append(views, v)
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views, nil
+}
+
+func (q *Queries) UpdateSavedView(ctx context.Context, id, entityID, name string, filter map[string]interface{}) (db.SavedView, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	v, ok := q.views[id]
+	if !ok || v.EntityID != entityID {
+		return db.SavedView{}, pgx.ErrNoRows
+	}
+	if q.viewNameTaken(entityID, name, id) {
+		return db.SavedView{}, uniqueViolation
+	}
+	v.Name, v.Filter, v.UpdatedAt = name, filter, time.Now()
+	q.views[id] = v
+	return v, nil
+}
@@ -0,0 +1,85 @@
+package testing
+
+import (
+	"sync"
+	"time"
+
+	"pxbox/internal/ws"
+)
+
+// Streams keeps stream events and acknowledged sequences in memory. It
+// implements ws.StreamsProvider and service.EventEraser.
+type Streams struct {
+	mu     sync.Mutex
+	events map[string][]ws.StreamEvent
+	acked  map[string]int64
+}
+
+// NewStreams creates empty streams
+func NewStreams() *Streams {
+	return &Streams{events: map[string][]ws.StreamEvent{}, acked: map[string]int64{}}
+}
+
+// Append adds an event to a channel's stream and returns its sequence
+func (s *Streams) Append(channel string, event map[string]interface{}) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var seq int64 = 1
+	if events := s.events[channel]; len(events) > 0 {
+		seq = events[len(events)-1].Sequence + 1
+	}
+	s.events[channel] = append(s.events[channel], ws.StreamEvent{
+		Channel:   channel,
+		Sequence:  seq,
+		Event:     event,
+		Timestamp: time.Now(),
+	})
+	return seq
+}
+
+func (s *Streams) GetLastSequence(channel, connectionID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acked[channel+"/"+connectionID], nil
+}
+
+func (s *Streams) AcknowledgeSequence(channel, connectionID string, sequence int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked[channel+"/"+connectionID] = sequence
+	return nil
+}
+
+func (s *Streams) ReplayEvents(channel string, sinceSeq int64, limit int64) ([]ws.StreamEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ws.StreamEvent
+	for _, e := range s.events[channel] {
+		if e.Sequence > sinceSeq && int64(len(out)) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *Streams) DeleteEvents(channel string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := int64(len(s.events[channel]))
+	delete(s.events, channel)
+	return n, nil
+}
+
+func (s *Streams) DeleteEventsWhere(channel string, match func(event map[string]interface{}) bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []ws.StreamEvent
+	for _, e := range s.events[channel] {
+		if !match(e.Event) {
+			kept = append(kept, e)
+		}
+	}
+	n := int64(len(s.events[channel]) - len(kept))
+	s.events[channel] = kept
+	return n, nil
+}
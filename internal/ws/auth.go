@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"pxbox/internal/auth"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// CloseTokenExpired is the close code sent to a connection whose token
+// expired without a reauth frame
+const CloseTokenExpired = 4001
+
+// Authenticator verifies the bearer token of a reauth frame
+type Authenticator func(ctx context.Context, token string) (*auth.Principal, error)
+
+// SetAuthenticator enables reauth frames, verified by authenticate
+func (h *Hub) SetAuthenticator(authenticate Authenticator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.authenticate = authenticate
+}
+
+// SetExpiry disconnects the connection at expiresAt unless a reauth frame
+// extends it first. A zero time disables the deadline.
+func (c *Conn) SetExpiry(expiresAt time.Time) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.authTimer != nil {
+		c.authTimer.Stop()
+		c.authTimer = nil
+	}
+	c.expiresAt = expiresAt
+	if expiresAt.IsZero() {
+		return
+	}
+	userID := c.userID
+	c.authTimer = time.AfterFunc(time.Until(expiresAt), func() { c.expire(userID) })
+}
+
+// stopExpiry cancels the expiry deadline of a closing connection
+func (c *Conn) stopExpiry() {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.authTimer != nil {
+		c.authTimer.Stop()
+	}
+}
+
+// expire closes the connection because its token ran out. Closing the
+// socket ends ReadPump, which unregisters the connection.
+func (c *Conn) expire(userID string) {
+	c.hub.log.Info("Closing WebSocket connection with expired token", zap.String("userID", userID))
+	msg := websocket.FormatCloseMessage(CloseTokenExpired, "token expired")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.close()
+}
+
+// handleReauth replaces the connection's token with a fresh one. The token
+// must identify the same caller; an anonymous connection is bound to it.
+func (c *Conn) handleReauth(msg map[string]interface{}) {
+	c.hub.mu.RLock()
+	authenticate := c.hub.authenticate
+	c.hub.mu.RUnlock()
+	if authenticate == nil {
+		c.sendError("reauth_unsupported", "token authentication is not configured")
+		return
+	}
+
+	token, _ := msg["token"].(string)
+	if token == "" {
+		c.sendError("invalid_input", "token required")
+		return
+	}
+
+	p, err := authenticate(c.ctx, token)
+	if err != nil {
+		c.sendError("invalid_token", "token rejected")
+		return
+	}
+	if p.ID() == "" {
+		c.sendError("invalid_token", "token does not identify a caller")
+		return
+	}
+	if c.userID != "" && c.userID != "anonymous" && p.ID() != c.userID {
+		c.sendError("identity_mismatch", "token belongs to a different caller")
+		return
+	}
+	if c.userID != p.ID() {
+		c.bindEntity(p.ID())
+	}
+	c.SetExpiry(p.ExpiresAt)
+	c.SetAdmin(p.Admin)
+	if !p.Admin {
+		c.hub.dropPatterns(c)
+	}
+
+	ack := map[string]interface{}{"type": "ack", "ack": "reauth"}
+	if !p.ExpiresAt.IsZero() {
+		ack["expiresAt"] = p.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	c.sendJSON(ack)
+}
+
+func (c *Conn) sendError(code, message string) {
+	c.sendJSON(map[string]interface{}{
+		"type":    "error",
+		"code":    code,
+		"message": message,
+	})
+}
+
+func (c *Conn) sendJSON(v map[string]interface{}) {
+	msg, _ := json.Marshal(v)
+	select {
+	case c.send <- msg:
+	default:
+	}
+}
@@ -0,0 +1,187 @@
+package ws
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// A connection whose send buffer is full falls behind instead of losing
+// events: live events with a sequence number are skipped for it and the
+// channels they belong to are marked lagging. A catch-up goroutine then
+// sends the missed events from Streams, blocking on the buffer, until no
+// channel lags and the connection goes back to live delivery.
+
+// DefaultSendBuffer is the number of outbound messages queued per connection
+// unless SetSendBufferSize says otherwise
+const DefaultSendBuffer = 256
+
+// HubStats counts the hub's event deliveries since it started
+type HubStats struct {
+	Connections    int   `json:"connections"`
+	Behind         int   `json:"behind"`         // Connections catching up from Streams
+	Delivered      int64 `json:"delivered"`      // Live events queued to connections
+	Overflows      int64 `json:"overflows"`      // Times a connection fell behind
+	Deferred       int64 `json:"deferred"`       // Live events skipped for connections behind
+	CaughtUp       int64 `json:"caughtUp"`       // Events sent from Streams to connections behind
+	Dropped        int64 `json:"dropped"`        // Events lost because they could not be replayed
+	PublishDropped int64 `json:"publishDropped"` // Events dropped because the publish queue was full
+}
+
+type hubCounters struct {
+	delivered      atomic.Int64
+	overflows      atomic.Int64
+	deferred       atomic.Int64
+	caughtUp       atomic.Int64
+	dropped        atomic.Int64
+	publishDropped atomic.Int64
+}
+
+// SetSendBufferSize sets the send buffer of connections created afterwards
+func (h *Hub) SetSendBufferSize(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sendBuffer = n
+}
+
+func (h *Hub) sendBufferSize() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.sendBuffer <= 0 {
+		return DefaultSendBuffer
+	}
+	return h.sendBuffer
+}
+
+// Stats returns the delivery counters and the connections currently behind
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+
+	stats := HubStats{
+		Connections:    len(conns),
+		Delivered:      h.stats.delivered.Load(),
+		Overflows:      h.stats.overflows.Load(),
+		Deferred:       h.stats.deferred.Load(),
+		CaughtUp:       h.stats.caughtUp.Load(),
+		Dropped:        h.stats.dropped.Load(),
+		PublishDropped: h.stats.publishDropped.Load(),
+	}
+	for _, conn := range conns {
+		if conn.isBehind() {
+			stats.Behind++
+		}
+	}
+	return stats
+}
+
+// overflow handles an event that did not fit in the send buffer. Events
+// without a sequence number cannot be replayed and are lost. The caller
+// holds replayMu.
+func (c *Conn) overflow(channel string, seq int64) bool {
+	c.hub.stats.overflows.Add(1)
+	if seq == 0 {
+		c.hub.stats.dropped.Add(1)
+		c.hub.log.Warn("Send buffer full, dropping event without sequence",
+			zap.String("userID", c.userID),
+			zap.String("channel", channel),
+		)
+		return false
+	}
+	c.behind = true
+	c.lagging[channel] = true
+	c.hub.stats.deferred.Add(1)
+	go c.hub.catchUp(c)
+	return true
+}
+
+// deferEvent skips an event for a connection that is behind; catch-up sends
+// it later. The caller holds replayMu.
+func (c *Conn) deferEvent(channel string, seq int64) bool {
+	if seq == 0 {
+		c.hub.stats.dropped.Add(1)
+		return false
+	}
+	c.lagging[channel] = true
+	c.hub.stats.deferred.Add(1)
+	return true
+}
+
+func (c *Conn) isBehind() bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	return c.behind
+}
+
+// nextLagging takes a lagging channel. When none is left the connection is
+// caught up and returns to live delivery.
+func (c *Conn) nextLagging() (string, bool) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	for channel := range c.lagging {
+		delete(c.lagging, channel)
+		return channel, true
+	}
+	c.behind = false
+	return "", false
+}
+
+// catchUp sends a connection that fell behind the events it missed. Without
+// Streams there is nothing to catch up from, so the connection is closed and
+// the client resubscribes.
+func (h *Hub) catchUp(c *Conn) {
+	h.mu.RLock()
+	streams := h.streams
+	h.mu.RUnlock()
+	if streams == nil {
+		h.log.Warn("Closing WebSocket connection that fell behind, event replay is not configured", zap.String("userID", c.userID))
+		c.close()
+		return
+	}
+
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	for {
+		channel, ok := c.nextLagging()
+		if !ok {
+			return
+		}
+		if !h.isSubscribed(c, channel) {
+			continue
+		}
+
+		count, err := h.replayEvents(c, channel, c.sequence(channel))
+		h.stats.caughtUp.Add(int64(count))
+		if errors.Is(err, errReplayStalled) {
+			return
+		}
+		if err != nil {
+			h.log.Error("Failed to catch up connection",
+				zap.String("userID", c.userID),
+				zap.String("channel", channel),
+				zap.Error(err),
+			)
+			c.close()
+			return
+		}
+	}
+}
+
+func (h *Hub) isSubscribed(c *Conn, channel string) bool {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.subs[channel] {
+		return true
+	}
+	for pattern := range c.subs {
+		if isPattern(pattern) && matchPattern(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package ws
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// maxBatchCommands is the most commands a batch frame may carry
+const maxBatchCommands = 100
+
+// batchConcurrency is how many commands of a concurrent batch run at once
+const batchConcurrency = 8
+
+// batchReplies collects the responses of a batch's commands by command id
+// instead of sending them
+type batchReplies struct {
+	mu      sync.Mutex
+	results map[string]map[string]interface{}
+}
+
+// collect stores the response to a command of the running batch. It
+// reports false for messages that are not part of the batch, which are
+// sent as usual.
+func (b *batchReplies) collect(msgID string, response map[string]interface{}) bool {
+	if b == nil || msgID == "" {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.results[msgID]; !ok {
+		return false
+	}
+	b.results[msgID] = response
+	return true
+}
+
+// HandleBatch runs the commands of a batch frame and answers with one
+// message holding their responses in command order. Commands run one after
+// another unless "concurrent" is set.
+func (h *CommandHandler) HandleBatch(ctx context.Context, conn *Conn, msg map[string]interface{}) {
+	batchID, _ := msg["id"].(string)
+	raw, _ := msg["cmds"].([]interface{})
+	if len(raw) == 0 {
+		h.sendError(ctx, conn, batchID, "invalid_input", "cmds required")
+		return
+	}
+	if len(raw) > maxBatchCommands {
+		h.sendError(ctx, conn, batchID, "invalid_input", "a batch holds at most "+strconv.Itoa(maxBatchCommands)+" commands")
+		return
+	}
+	concurrent, _ := msg["concurrent"].(bool)
+
+	// Commands without an id are answered under their index
+	ids := make([]string, len(raw))
+	cmds := make([]map[string]interface{}, len(raw))
+	results := make([]map[string]interface{}, len(raw))
+	replies := &batchReplies{results: make(map[string]map[string]interface{}, len(raw))}
+	seen := make(map[string]bool, len(raw))
+	for i, r := range raw {
+		cmd, _ := r.(map[string]interface{})
+		id, _ := cmd["id"].(string)
+		if id == "" {
+			id = strconv.Itoa(i)
+		}
+		ids[i] = id
+		duplicate := seen[id]
+		seen[id] = true
+
+		switch {
+		case cmd == nil:
+			results[i] = batchError(id, "command must be an object")
+		case cmd["type"] != nil && cmd["type"] != "cmd":
+			results[i] = batchError(id, "only cmd messages can be batched")
+		case duplicate:
+			results[i] = batchError(id, "duplicate command id")
+		case concurrent && cmd["op"] == "createEntity":
+			// It binds the connection to the new entity, which other commands read
+			results[i] = batchError(id, "createEntity cannot run in a concurrent batch")
+		default:
+			cmd["id"] = id
+			cmds[i] = cmd
+			replies.results[id] = map[string]interface{}{}
+		}
+	}
+
+	conn.batch = replies
+	if concurrent {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, batchConcurrency)
+		for _, cmd := range cmds {
+			if cmd == nil {
+				continue
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(cmd map[string]interface{}) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				h.runBatched(ctx, conn, cmd)
+			}(cmd)
+		}
+		wg.Wait()
+	} else {
+		for _, cmd := range cmds {
+			if cmd != nil {
+				h.runBatched(ctx, conn, cmd)
+			}
+		}
+	}
+	conn.batch = nil
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		if r := replies.results[ids[i]]; len(r) > 0 {
+			results[i] = r
+		} else {
+			results[i] = map[string]interface{}{"type": "error", "id": ids[i], "code": "internal_error", "message": "command did not respond"}
+		}
+	}
+
+	h.sendResponse(conn, batchID, map[string]interface{}{
+		"type":    "batch",
+		"results": results,
+	})
+}
+
+// runBatched runs a command of a batch under its own timeout
+func (h *CommandHandler) runBatched(ctx context.Context, conn *Conn, cmd map[string]interface{}) {
+	ctx, cancel := conn.commandContext(ctx)
+	defer cancel()
+	h.HandleCommand(ctx, conn, cmd)
+}
+
+func batchError(id, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "error",
+		"id":      id,
+		"code":    "invalid_input",
+		"message": message,
+	}
+}
@@ -0,0 +1,65 @@
+package ws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestBatchCollectsResponsesInOrder(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+	h := NewCommandHandler(nil, nil, nil, zap.NewNop())
+
+	for _, concurrent := range []bool{false, true} {
+		h.HandleBatch(context.Background(), conn, map[string]interface{}{
+			"type":       "batch",
+			"id":         "b1",
+			"concurrent": concurrent,
+			"cmds": []interface{}{
+				map[string]interface{}{"type": "cmd", "id": "c1", "op": "getRequest", "data": map[string]interface{}{}},
+				map[string]interface{}{"type": "cmd", "op": "bogus"},
+				map[string]interface{}{"type": "cmd", "id": "c1", "op": "getRequest"},
+				map[string]interface{}{"type": "subscribe"},
+			},
+		})
+
+		msgs := drain(t, conn)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "batch", msgs[0]["type"])
+		assert.Equal(t, "b1", msgs[0]["id"])
+		results := msgs[0]["results"].([]interface{})
+		require.Len(t, results, 4)
+
+		first := results[0].(map[string]interface{})
+		assert.Equal(t, "c1", first["id"])
+		assert.Equal(t, "invalid_input", first["code"])
+		second := results[1].(map[string]interface{})
+		assert.Equal(t, "1", second["id"])
+		assert.Equal(t, "unknown_command", second["code"])
+		assert.Equal(t, "duplicate command id", results[2].(map[string]interface{})["message"])
+		assert.Equal(t, "only cmd messages can be batched", results[3].(map[string]interface{})["message"])
+	}
+
+	// Responses outside a batch are sent as usual
+	h.sendError(context.Background(), conn, "c9", "invalid_input", "x")
+	assert.Len(t, drain(t, conn), 1)
+}
+
+func TestBatchRejectsEmptyAndOversized(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+	h := NewCommandHandler(nil, nil, nil, zap.NewNop())
+
+	h.HandleBatch(context.Background(), conn, map[string]interface{}{"id": "b1"})
+	cmds := make([]interface{}, maxBatchCommands+1)
+	h.HandleBatch(context.Background(), conn, map[string]interface{}{"id": "b2", "cmds": cmds})
+
+	msgs := drain(t, conn)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "invalid_input", msgs[0]["code"])
+	assert.Equal(t, "b2", msgs[1]["id"])
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"time"
 
+	"pxbox/internal/correlation"
+	"pxbox/internal/db"
+	"pxbox/internal/model"
 	"pxbox/internal/service"
 
 	"go.uber.org/zap"
@@ -14,13 +17,15 @@ import (
 type CommandHandler struct {
 	requestSvc *service.RequestService
 	flowSvc    *service.FlowService
+	entitySvc  *service.EntityService
 	log        *zap.Logger
 }
 
-func NewCommandHandler(requestSvc *service.RequestService, flowSvc *service.FlowService, log *zap.Logger) *CommandHandler {
+func NewCommandHandler(requestSvc *service.RequestService, flowSvc *service.FlowService, entitySvc *service.EntityService, log *zap.Logger) *CommandHandler {
 	return &CommandHandler{
 		requestSvc: requestSvc,
 		flowSvc:    flowSvc,
+		entitySvc:  entitySvc,
 		log:        log,
 	}
 }
@@ -30,6 +35,7 @@ func (h *CommandHandler) HandleCommand(ctx context.Context, conn *Conn, cmd map[
 	op, _ := cmd["op"].(string)
 	data, _ := cmd["data"].(map[string]interface{})
 	msgID, _ := cmd["id"].(string)
+	ctx = db.WithRequestMemo(ctx)
 
 	switch op {
 	case "createRequest":
@@ -38,6 +44,8 @@ func (h *CommandHandler) HandleCommand(ctx context.Context, conn *Conn, cmd map[
 		h.handleGetRequest(ctx, conn, msgID, data)
 	case "claimRequest":
 		h.handleClaimRequest(ctx, conn, msgID, data)
+	case "unclaimRequest":
+		h.handleUnclaimRequest(ctx, conn, msgID, data)
 	case "postResponse":
 		h.handlePostResponse(ctx, conn, msgID, data)
 	case "cancelRequest":
@@ -48,23 +56,56 @@ func (h *CommandHandler) HandleCommand(ctx context.Context, conn *Conn, cmd map[
 		h.handleResumeFlow(ctx, conn, msgID, data)
 	case "cancelFlow":
 		h.handleCancelFlow(ctx, conn, msgID, data)
+	case "createEntity":
+		h.handleCreateEntity(ctx, conn, msgID, data)
+	case "updateProfile":
+		h.handleUpdateProfile(ctx, conn, msgID, data)
+	case "getMyEntity":
+		h.handleGetMyEntity(ctx, conn, msgID)
+	case "listInquiries":
+		h.handleListInquiries(ctx, conn, msgID, data)
+	case "getQueue":
+		h.handleGetQueue(ctx, conn, msgID, data)
+	case "markRead":
+		h.handleMarkRead(ctx, conn, msgID, data)
 	default:
-		h.sendError(conn, msgID, "unknown_command", "Unknown command: "+op)
+		h.sendError(ctx, conn, msgID, "unknown_command", "Unknown command: "+op)
 	}
 }
 
+// HandleDelivered records the client's receipt of a request pushed to its
+// entity and acks it
+func (h *CommandHandler) HandleDelivered(ctx context.Context, conn *Conn, msg map[string]interface{}) {
+	requestID, _ := msg["requestId"].(string)
+	if requestID == "" {
+		h.sendError(ctx, conn, "", "invalid_input", "requestId required")
+		return
+	}
+
+	if err := h.requestSvc.MarkDelivered(ctx, requestID); err != nil {
+		h.sendServiceError(ctx, conn, "", err)
+		return
+	}
+
+	h.sendResponse(conn, "", map[string]interface{}{
+		"type":      "ack",
+		"ack":       "delivered",
+		"requestId": requestID,
+	})
+}
+
 func (h *CommandHandler) handleCreateRequest(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	// Parse entity
 	entityData, _ := data["entity"].(map[string]interface{})
 	if entityData == nil {
-		h.sendError(conn, msgID, "invalid_input", "entity required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "entity required")
 		return
 	}
 
 	// Parse schema
 	schema, _ := data["schema"].(map[string]interface{})
 	if schema == nil {
-		h.sendError(conn, msgID, "invalid_input", "schema required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "schema required")
 		return
 	}
 
@@ -82,7 +123,7 @@ func (h *CommandHandler) handleCreateRequest(ctx context.Context, conn *Conn, ms
 		input.Entity.Handle = handle
 	}
 	if input.Entity.ID == "" && input.Entity.Handle == "" {
-		h.sendError(conn, msgID, "invalid_input", "entity.id or entity.handle required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "entity.id or entity.handle required")
 		return
 	}
 
@@ -96,9 +137,36 @@ func (h *CommandHandler) handleCreateRequest(ctx context.Context, conn *Conn, ms
 	if callbackURL, ok := data["callbackUrl"].(string); ok {
 		input.CallbackURL = &callbackURL
 	}
+	if locale, ok := data["locale"].(string); ok {
+		input.Locale = &locale
+	}
+	if timezone, ok := data["timezone"].(string); ok {
+		input.Timezone = &timezone
+	}
+	if fields, ok := data["callbackFields"].([]interface{}); ok {
+		for _, f := range fields {
+			if s, ok := f.(string); ok {
+				input.CallbackFields = append(input.CallbackFields, s)
+			}
+		}
+	}
 	if filesPolicy, ok := data["filesPolicy"].(map[string]interface{}); ok {
 		input.FilesPolicy = filesPolicy
 	}
+	if attachments, ok := data["attachments"].([]interface{}); ok {
+		for _, a := range attachments {
+			if file, ok := a.(map[string]interface{}); ok {
+				input.Attachments = append(input.Attachments, file)
+			}
+		}
+	}
+	if tags, ok := data["tags"].([]interface{}); ok {
+		for _, t := range tags {
+			if s, ok := t.(string); ok {
+				input.Tags = append(input.Tags, s)
+			}
+		}
+	}
 
 	// Parse time fields
 	if expiresAtStr, ok := data["expiresAt"].(string); ok && expiresAtStr != "" {
@@ -111,6 +179,9 @@ func (h *CommandHandler) handleCreateRequest(ctx context.Context, conn *Conn, ms
 			input.DeadlineAt = &t
 		}
 	}
+	if deadlineIn, ok := data["deadlineIn"].(string); ok && deadlineIn != "" {
+		input.DeadlineIn = &deadlineIn
+	}
 	if attentionAtStr, ok := data["attentionAt"].(string); ok && attentionAtStr != "" {
 		if t, err := time.Parse(time.RFC3339, attentionAtStr); err == nil {
 			input.AttentionAt = &t
@@ -120,7 +191,7 @@ func (h *CommandHandler) handleCreateRequest(ctx context.Context, conn *Conn, ms
 	// Create request
 	req, err := h.requestSvc.CreateRequest(ctx, input)
 	if err != nil {
-		h.sendError(conn, msgID, "create_failed", err.Error())
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -137,13 +208,13 @@ func (h *CommandHandler) handleCreateRequest(ctx context.Context, conn *Conn, ms
 func (h *CommandHandler) handleGetRequest(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	requestID, _ := data["requestId"].(string)
 	if requestID == "" {
-		h.sendError(conn, msgID, "invalid_input", "requestId required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "requestId required")
 		return
 	}
 
 	req, err := h.requestSvc.GetRequest(ctx, requestID)
 	if err != nil {
-		h.sendError(conn, msgID, "not_found", err.Error())
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -156,12 +227,12 @@ func (h *CommandHandler) handleGetRequest(ctx context.Context, conn *Conn, msgID
 func (h *CommandHandler) handleClaimRequest(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	requestID, _ := data["requestId"].(string)
 	if requestID == "" {
-		h.sendError(conn, msgID, "invalid_input", "requestId required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "requestId required")
 		return
 	}
 
-	if err := h.requestSvc.ClaimRequest(ctx, requestID); err != nil {
-		h.sendError(conn, msgID, "claim_failed", err.Error())
+	if err := h.requestSvc.ClaimRequest(ctx, requestID, expectedVersion(data)); err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -171,13 +242,31 @@ func (h *CommandHandler) handleClaimRequest(ctx context.Context, conn *Conn, msg
 	})
 }
 
+func (h *CommandHandler) handleUnclaimRequest(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
+	requestID, _ := data["requestId"].(string)
+	if requestID == "" {
+		h.sendError(ctx, conn, msgID, "invalid_input", "requestId required")
+		return
+	}
+
+	if err := h.requestSvc.UnclaimRequest(ctx, requestID, expectedVersion(data)); err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": map[string]string{"status": "PENDING"},
+	})
+}
+
 func (h *CommandHandler) handlePostResponse(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	requestID, _ := data["requestId"].(string)
 	payload, _ := data["payload"].(map[string]interface{})
 	files, _ := data["files"].([]interface{})
 
 	if requestID == "" || payload == nil {
-		h.sendError(conn, msgID, "invalid_input", "requestId and payload required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "requestId and payload required")
 		return
 	}
 
@@ -191,9 +280,9 @@ func (h *CommandHandler) handlePostResponse(ctx context.Context, conn *Conn, msg
 
 	// TODO: Get answeredBy from connection context
 	answeredBy := conn.userID
-	resp, err := h.requestSvc.PostResponse(ctx, requestID, answeredBy, payload, filesList)
+	resp, err := h.requestSvc.PostResponse(ctx, requestID, answeredBy, payload, filesList, expectedVersion(data))
 	if err != nil {
-		h.sendError(conn, msgID, "validation_failed", err.Error())
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -209,12 +298,12 @@ func (h *CommandHandler) handlePostResponse(ctx context.Context, conn *Conn, msg
 func (h *CommandHandler) handleCancelRequest(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	requestID, _ := data["requestId"].(string)
 	if requestID == "" {
-		h.sendError(conn, msgID, "invalid_input", "requestId required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "requestId required")
 		return
 	}
 
-	if err := h.requestSvc.CancelRequest(ctx, requestID); err != nil {
-		h.sendError(conn, msgID, "cancel_failed", err.Error())
+	if err := h.requestSvc.CancelRequest(ctx, requestID, expectedVersion(data)); err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -230,7 +319,7 @@ func (h *CommandHandler) handleCreateFlow(ctx context.Context, conn *Conn, msgID
 	cursor, _ := data["cursor"].(map[string]interface{})
 
 	if kind == "" || ownerEntity == "" {
-		h.sendError(conn, msgID, "invalid_input", "kind and ownerEntity required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "kind and ownerEntity required")
 		return
 	}
 
@@ -240,7 +329,7 @@ func (h *CommandHandler) handleCreateFlow(ctx context.Context, conn *Conn, msgID
 		Cursor:      cursor,
 	})
 	if err != nil {
-		h.sendError(conn, msgID, "create_failed", err.Error())
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -253,33 +342,42 @@ func (h *CommandHandler) handleCreateFlow(ctx context.Context, conn *Conn, msgID
 func (h *CommandHandler) handleResumeFlow(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	flowID, _ := data["flowId"].(string)
 	event, _ := data["event"].(string)
+	eventID, _ := data["eventId"].(string)
 	eventData, _ := data["data"].(map[string]interface{})
 
 	if flowID == "" || event == "" {
-		h.sendError(conn, msgID, "invalid_input", "flowId and event required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "flowId and event required")
 		return
 	}
 
-	if err := h.flowSvc.ResumeFlow(ctx, flowID, event, eventData); err != nil {
-		h.sendError(conn, msgID, "resume_failed", err.Error())
+	applied, err := h.flowSvc.ResumeFlowEvent(ctx, flowID, eventID, event, eventData)
+	if err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
+	result := map[string]interface{}{"status": "RUNNING"}
+	if !applied {
+		result = map[string]interface{}{"duplicate": true}
+		if flow, err := h.flowSvc.GetFlow(ctx, flowID); err == nil {
+			result["status"] = flow.Status
+		}
+	}
 	h.sendResponse(conn, msgID, map[string]interface{}{
 		"type": "response",
-		"data": map[string]string{"status": "RUNNING"},
+		"data": result,
 	})
 }
 
 func (h *CommandHandler) handleCancelFlow(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
 	flowID, _ := data["flowId"].(string)
 	if flowID == "" {
-		h.sendError(conn, msgID, "invalid_input", "flowId required")
+		h.sendError(ctx, conn, msgID, "invalid_input", "flowId required")
 		return
 	}
 
 	if err := h.flowSvc.CancelFlow(ctx, flowID); err != nil {
-		h.sendError(conn, msgID, "cancel_failed", err.Error())
+		h.sendServiceError(ctx, conn, msgID, err)
 		return
 	}
 
@@ -289,10 +387,96 @@ func (h *CommandHandler) handleCancelFlow(ctx context.Context, conn *Conn, msgID
 	})
 }
 
+func (h *CommandHandler) handleCreateEntity(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
+	kind, _ := data["kind"].(string)
+	handle, _ := data["handle"].(string)
+	meta, _ := data["meta"].(map[string]interface{})
+	sandbox, _ := data["sandbox"].(bool)
+
+	if !model.EntityKind(kind).Valid() {
+		h.sendError(ctx, conn, msgID, "invalid_kind", service.ErrInvalidEntityKind.Error())
+		return
+	}
+
+	entity, err := h.entitySvc.CreateEntity(ctx, model.EntityKind(kind), handle, meta, sandbox)
+	if err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	// Onboarding: an anonymous connection becomes the entity it registered
+	if conn.userID == "" || conn.userID == "anonymous" {
+		conn.bindEntity(entity.ID)
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": entity,
+	})
+}
+
+func (h *CommandHandler) handleUpdateProfile(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
+	if conn.userID == "" || conn.userID == "anonymous" {
+		h.sendError(ctx, conn, msgID, "unauthorized", "connection is not bound to an entity")
+		return
+	}
+
+	var handle *string
+	if v, ok := data["handle"].(string); ok {
+		handle = &v
+	}
+	meta, _ := data["meta"].(map[string]interface{})
+	if handle == nil && meta == nil {
+		h.sendError(ctx, conn, msgID, "invalid_input", "handle or meta required")
+		return
+	}
+
+	entity, err := h.entitySvc.UpdateProfile(ctx, conn.userID, handle, meta)
+	if err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": entity,
+	})
+}
+
+func (h *CommandHandler) handleGetMyEntity(ctx context.Context, conn *Conn, msgID string) {
+	if conn.userID == "" || conn.userID == "anonymous" {
+		h.sendError(ctx, conn, msgID, "unauthorized", "connection is not bound to an entity")
+		return
+	}
+
+	entity, err := h.entitySvc.ResolveEntity(ctx, conn.userID, "")
+	if err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": entity,
+	})
+}
+
+// expectedVersion reads the optional optimistic-concurrency version of a command
+func expectedVersion(data map[string]interface{}) *int {
+	if v, ok := data["expectedVersion"].(float64); ok {
+		version := int(v)
+		return &version
+	}
+	return nil
+}
+
 func (h *CommandHandler) sendResponse(conn *Conn, msgID string, response map[string]interface{}) {
 	if msgID != "" {
 		response["id"] = msgID
 	}
+	if conn.batch.collect(msgID, response) {
+		return
+	}
 	msg, _ := json.Marshal(response)
 	select {
 	case conn.send <- msg:
@@ -301,15 +485,35 @@ func (h *CommandHandler) sendResponse(conn *Conn, msgID string, response map[str
 	}
 }
 
-func (h *CommandHandler) sendError(conn *Conn, msgID, code, message string) {
+func (h *CommandHandler) sendError(ctx context.Context, conn *Conn, msgID, code, message string) {
+	h.sendErrorDetails(ctx, conn, msgID, code, message, nil)
+}
+
+// sendServiceError reports a service error with the code and details of its
+// category
+func (h *CommandHandler) sendServiceError(ctx context.Context, conn *Conn, msgID string, err error) {
+	e := service.Classify(err)
+	h.sendErrorDetails(ctx, conn, msgID, e.Code, e.Message, e.Details)
+}
+
+func (h *CommandHandler) sendErrorDetails(ctx context.Context, conn *Conn, msgID, code, message string, details interface{}) {
 	err := map[string]interface{}{
 		"type":    "error",
 		"code":    code,
 		"message": message,
 	}
+	if details != nil {
+		err["details"] = details
+	}
+	if id := correlation.ID(ctx); id != "" {
+		err["correlationId"] = id
+	}
 	if msgID != "" {
 		err["id"] = msgID
 	}
+	if conn.batch.collect(msgID, err) {
+		return
+	}
 	msg, _ := json.Marshal(err)
 	select {
 	case conn.send <- msg:
@@ -0,0 +1,143 @@
+package ws_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"pxbox/internal/events"
+	"pxbox/internal/schema"
+	"pxbox/internal/service"
+	pxtest "pxbox/internal/testing"
+	"pxbox/internal/ws"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// The frames sent to clients are pinned by golden files in
+// testdata/golden, so that a renamed or removed field shows up as a test
+// failure instead of breaking clients. Run with -update after an intended
+// change and mention it in the changelog.
+
+type contract struct {
+	t   *testing.T
+	hub *ws.Hub
+}
+
+func newContract(t *testing.T) *contract {
+	queries := pxtest.NewQueries()
+	entitySvc := service.NewEntityService(queries)
+	requestSvc := service.NewRequestService(queries, schema.NewCompilerWithCache(16), entitySvc, pxtest.NewBus())
+	requestSvc.SetJobClient(pxtest.NewJobClient())
+	flowSvc := service.NewFlowService(queries, pxtest.NewBus(), requestSvc)
+
+	hub := ws.NewHub(zap.NewNop())
+	hub.SetCommandHandler(ws.NewCommandHandler(requestSvc, flowSvc, entitySvc, zap.NewNop()))
+	return &contract{t: t, hub: hub}
+}
+
+// send handles msg on conn and returns the frames it produced
+func (c *contract) send(conn *ws.Conn, msg map[string]interface{}) []map[string]interface{} {
+	c.t.Helper()
+	conn.HandleMessage(msg)
+	var frames []map[string]interface{}
+	for _, raw := range conn.Sent() {
+		var frame map[string]interface{}
+		require.NoError(c.t, json.Unmarshal(raw, &frame))
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// expect handles msg and compares its single frame with the golden file
+func (c *contract) expect(name string, conn *ws.Conn, msg map[string]interface{}) map[string]interface{} {
+	c.t.Helper()
+	frames := c.send(conn, msg)
+	require.Len(c.t, frames, 1, name)
+	c.t.Run(name, func(t *testing.T) { pxtest.Golden(t, "ws/"+name, frames[0]) })
+	return frames[0]
+}
+
+func cmd(id, op string, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "cmd", "id": id, "op": op, "data": data}
+}
+
+func TestContract_Commands(t *testing.T) {
+	c := newContract(t)
+
+	// An anonymous connection registers an entity and becomes it
+	entity := ws.NewConn(nil, c.hub, "anonymous")
+	c.expect("createEntity", entity, cmd("1", "createEntity", map[string]interface{}{
+		"kind": "user", "handle": "ada", "meta": map[string]interface{}{"name": "Ada"},
+	}))
+	c.expect("getMyEntity", entity, cmd("2", "getMyEntity", nil))
+	c.expect("updateProfile", entity, cmd("3", "updateProfile", map[string]interface{}{
+		"meta": map[string]interface{}{"name": "Ada Lovelace"},
+	}))
+
+	requestor := ws.NewConn(nil, c.hub, "client-1")
+	created := c.expect("createRequest", requestor, cmd("4", "createRequest", map[string]interface{}{
+		"entity": map[string]interface{}{"handle": "ada"},
+		"schema": map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"name"},
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string"},
+			},
+		},
+		"tags": []interface{}{"onboarding"},
+	}))
+	requestID := created["data"].(map[string]interface{})["requestId"].(string)
+	ref := map[string]interface{}{"requestId": requestID}
+
+	c.expect("getRequest", requestor, cmd("5", "getRequest", ref))
+	c.expect("listInquiries", entity, cmd("6", "listInquiries", nil))
+	c.expect("delivered", entity, map[string]interface{}{"type": "delivered", "requestId": requestID})
+	c.expect("claimRequest", entity, cmd("9", "claimRequest", ref))
+	c.expect("unclaimRequest", entity, cmd("10", "unclaimRequest", ref))
+	c.expect("errorValidation", entity, cmd("11", "postResponse", map[string]interface{}{
+		"requestId": requestID, "payload": map[string]interface{}{"name": 42},
+	}))
+	c.expect("postResponse", entity, cmd("12", "postResponse", map[string]interface{}{
+		"requestId": requestID, "payload": map[string]interface{}{"name": "Ada"},
+	}))
+
+	second := c.send(requestor, cmd("13", "createRequest", map[string]interface{}{
+		"entity": map[string]interface{}{"handle": "ada"},
+		"schema": map[string]interface{}{"type": "object"},
+	}))
+	c.expect("cancelRequest", requestor, cmd("14", "cancelRequest", map[string]interface{}{
+		"requestId": second[0]["data"].(map[string]interface{})["requestId"],
+	}))
+
+	c.expect("errorNotFound", requestor, cmd("15", "getRequest", map[string]interface{}{"requestId": "01HZZZZZZZZZZZZZZZZZZZZZZZ"}))
+	c.expect("errorUnknownCommand", requestor, cmd("16", "bogus", nil))
+	c.expect("errorInvalidInput", requestor, cmd("17", "createFlow", nil))
+	c.expect("batch", requestor, map[string]interface{}{
+		"type": "batch",
+		"id":   "b1",
+		"cmds": []interface{}{
+			cmd("18", "getRequest", ref),
+			cmd("19", "cancelRequest", nil),
+		},
+	})
+}
+
+func TestContract_Subscriptions(t *testing.T) {
+	c := newContract(t)
+	streams := pxtest.NewStreams()
+	c.hub.SetStreamsProvider(streams)
+	conn := ws.NewConn(nil, c.hub, "e1")
+
+	c.expect("pong", conn, map[string]interface{}{"type": "ping"})
+	c.expect("subscribed", conn, map[string]interface{}{"type": "subscribe", "channel": "entity:e1"})
+	c.expect("unsubscribed", conn, map[string]interface{}{"type": "unsubscribe", "channel": "entity:e1"})
+	c.expect("errorInvalidFilter", conn, map[string]interface{}{"type": "subscribe", "channel": "entity:e1", "events": 42})
+
+	streams.Append("entity:e1", events.New(context.Background(), events.RequestCreated{RequestID: "01HZZZZZZZZZZZZZZZZZZZZZZZ", EntityID: "e1"}))
+	frames := c.send(conn, map[string]interface{}{"type": "subscribe", "channel": "entity:e1", "since": float64(0)})
+	require.Len(t, frames, 2)
+	t.Run("event", func(t *testing.T) { pxtest.Golden(t, "ws/event", frames[0]) })
+	t.Run("subscribedReplay", func(t *testing.T) { pxtest.Golden(t, "ws/subscribedReplay", frames[1]) })
+}
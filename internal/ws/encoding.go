@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+// Messages are JSON inside the hub. A connection that negotiated the
+// msgpack subprotocol exchanges binary MessagePack frames instead, one
+// message per frame; the conversion happens when a frame is read or
+// written.
+
+// SubprotocolMsgpack is the subprotocol a client offers to use MessagePack
+const SubprotocolMsgpack = "msgpack"
+
+// Encodings lists the message encodings the hub speaks
+var Encodings = []string{"json", SubprotocolMsgpack}
+
+// compressThreshold is the smallest frame compressed with permessage-deflate
+// when the client negotiated it; smaller frames do not gain enough to pay
+// for the compression
+const compressThreshold = 1024
+
+// decodeFrame parses an inbound frame into a message
+func (c *Conn) decodeFrame(frameType int, data []byte) (map[string]interface{}, error) {
+	if frameType == websocket.BinaryMessage {
+		if !c.msgpack {
+			return nil, fmt.Errorf("binary frames require the %s subprotocol", SubprotocolMsgpack)
+		}
+		var err error
+		if data, err = msgpackToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeBatch writes the queued messages: JSON connections get them in one
+// text frame separated by newlines, msgpack connections one binary frame
+// each
+func (c *Conn) writeBatch(batch [][]byte) error {
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	if c.msgpack {
+		for _, message := range batch {
+			data, err := jsonToMsgpack(message)
+			if err != nil {
+				c.hub.log.Error("Failed to encode message as msgpack", zap.Error(err))
+				continue
+			}
+			c.ws.EnableWriteCompression(len(data) >= compressThreshold)
+			if err := c.ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	size := len(batch) - 1
+	for _, message := range batch {
+		size += len(message)
+	}
+	c.ws.EnableWriteCompression(size >= compressThreshold)
+
+	w, err := c.ws.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	for i, message := range batch {
+		if i > 0 {
+			w.Write([]byte{'\n'})
+		}
+		w.Write(message)
+	}
+	return w.Close()
+}
+
+// jsonToMsgpack re-encodes a JSON message, keeping integers integers
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(integers(v))
+}
+
+// integers turns the json.Numbers of a decoded value into int64 where they
+// are whole, and float64 otherwise
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = integers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = integers(e)
+		}
+	}
+	return v
+}
+
+// msgpackToJSON re-encodes a MessagePack message as JSON, so handlers see
+// the same types for both encodings
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("message must be a map")
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+func TestMsgpackConversion(t *testing.T) {
+	data, err := jsonToMsgpack([]byte(`{"type":"event","seq":7,"data":{"score":1.5,"tags":["a"]}}`))
+	require.NoError(t, err)
+
+	var msg map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &msg))
+	assert.EqualValues(t, 7, msg["seq"])
+	assert.IsType(t, int64(0), msg["seq"])
+	assert.Equal(t, 1.5, msg["data"].(map[string]interface{})["score"])
+
+	back, err := msgpackToJSON(data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"event","seq":7,"data":{"score":1.5,"tags":["a"]}}`, string(back))
+
+	list, _ := msgpack.Marshal([]int{1})
+	_, err = msgpackToJSON(list)
+	assert.Error(t, err)
+}
+
+func TestMsgpackConnection(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	go hub.Run()
+	upgrader := websocket.Upgrader{Subprotocols: []string{SubprotocolMsgpack}, EnableCompression: true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn := NewConn(ws, hub, "e1")
+		hub.Register(conn)
+		go conn.WritePump()
+		go conn.ReadPump()
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{SubprotocolMsgpack}, EnableCompression: true}
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer client.Close()
+	require.Equal(t, SubprotocolMsgpack, client.Subprotocol())
+
+	frame, _ := msgpack.Marshal(map[string]interface{}{"type": "subscribe", "channel": "entity:e1"})
+	require.NoError(t, client.WriteMessage(websocket.BinaryMessage, frame))
+
+	read := func() map[string]interface{} {
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		frameType, data, err := client.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, frameType)
+		var msg map[string]interface{}
+		require.NoError(t, msgpack.Unmarshal(data, &msg))
+		return msg
+	}
+	assert.Equal(t, "subscribed", read()["ack"])
+
+	// Large enough to be compressed
+	hub.Publish("entity:e1", map[string]interface{}{"type": "request.created", "seq": int64(1), "schema": strings.Repeat("x", 4096)})
+	msg := read()
+	assert.EqualValues(t, 1, msg["seq"])
+	assert.Len(t, msg["data"].(map[string]interface{})["schema"], 4096)
+}
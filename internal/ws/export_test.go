@@ -0,0 +1,22 @@
+package ws
+
+// Hooks for the tests of package ws_test, which use the fakes of
+// internal/testing; that package imports ws.
+
+// HandleMessage processes a client message like the read loop does
+func (c *Conn) HandleMessage(msg map[string]interface{}) {
+	c.handleMessage(msg)
+}
+
+// Sent removes and returns the frames queued for the client
+func (c *Conn) Sent() [][]byte {
+	var frames [][]byte
+	for {
+		select {
+		case frame := <-c.send:
+			frames = append(frames, frame)
+		default:
+			return frames
+		}
+	}
+}
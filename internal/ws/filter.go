@@ -0,0 +1,75 @@
+package ws
+
+import "fmt"
+
+// A subscribe message may list the event types the client wants with
+// "events"; other events of the channel are neither sent live nor replayed.
+// The filter belongs to the subscription: subscribing again replaces it and
+// unsubscribing removes it.
+
+// eventFilter is the set of event types a subscription receives; nil
+// receives all of them
+type eventFilter map[string]bool
+
+func (f eventFilter) allows(eventType string) bool {
+	return f == nil || f[eventType]
+}
+
+// parseEventFilter reads the "events" list of a subscribe message
+func parseEventFilter(msg map[string]interface{}) (eventFilter, error) {
+	raw, ok := msg["events"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("events must be a list of event types")
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	filter := make(eventFilter, len(list))
+	for _, v := range list {
+		eventType, ok := v.(string)
+		if !ok || eventType == "" {
+			return nil, fmt.Errorf("events must be a list of event types")
+		}
+		filter[eventType] = true
+	}
+	return filter, nil
+}
+
+// eventType returns the type of an event, e.g. "request.created"
+func eventType(event map[string]interface{}) string {
+	t, _ := event["type"].(string)
+	return t
+}
+
+// setFilter sets the event filter of a subscription
+func (c *Conn) setFilter(channel string, filter eventFilter) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	c.filters[channel] = filter
+}
+
+// wants reports whether the connection receives an event type on a channel.
+// A channel subscribed directly uses its own filter; otherwise any matching
+// pattern subscription that allows the type will do.
+func (c *Conn) wants(channel, eventType string) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if f, ok := c.filters[channel]; ok {
+		return f.allows(eventType)
+	}
+	matched := false
+	for sub, f := range c.filters {
+		if !isPattern(sub) || !matchPattern(sub, channel) {
+			continue
+		}
+		if f.allows(eventType) {
+			return true
+		}
+		matched = true
+	}
+	return !matched
+}
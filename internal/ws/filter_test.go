@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseEventFilter(t *testing.T) {
+	f, err := parseEventFilter(map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	f, err = parseEventFilter(map[string]interface{}{"events": []interface{}{"request.created", "request.answered"}})
+	require.NoError(t, err)
+	assert.True(t, f.allows("request.created"))
+	assert.False(t, f.allows("request.claimed"))
+
+	for _, bad := range []interface{}{"request.created", []interface{}{1}, []interface{}{""}} {
+		_, err = parseEventFilter(map[string]interface{}{"events": bad})
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSubscribeWithEventFilter(t *testing.T) {
+	const channel = "entity:e1"
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+	streams := &fakeStreams{events: []StreamEvent{
+		{Channel: channel, Sequence: 1, Event: map[string]interface{}{"type": "request.created"}},
+		{Channel: channel, Sequence: 2, Event: map[string]interface{}{"type": "request.claimed"}},
+		{Channel: channel, Sequence: 3, Event: map[string]interface{}{"type": "request.answered"}},
+		{Channel: channel, Sequence: 4, Event: map[string]interface{}{"type": "request.claimed"}},
+	}}
+	hub.SetStreamsProvider(streams)
+
+	conn.handleMessage(map[string]interface{}{
+		"type":    "subscribe",
+		"channel": channel,
+		"since":   float64(0),
+		"events":  []interface{}{"request.created", "request.answered"},
+	})
+	msgs := drain(t, conn)
+	require.Len(t, msgs, 3)
+	assert.Equal(t, float64(1), msgs[0]["seq"])
+	assert.Equal(t, float64(3), msgs[1]["seq"])
+	assert.Equal(t, "subscribed", msgs[2]["ack"])
+	assert.Equal(t, float64(2), msgs[2]["replayed"])
+	assert.Equal(t, float64(4), msgs[2]["seq"])
+
+	assert.True(t, conn.wants(channel, "request.answered"))
+	assert.False(t, conn.wants(channel, "request.claimed"))
+
+	// Subscribing again without events clears the filter
+	conn.handleMessage(map[string]interface{}{"type": "subscribe", "channel": channel})
+	assert.True(t, conn.wants(channel, "request.claimed"))
+
+	conn.handleMessage(map[string]interface{}{"type": "subscribe", "channel": channel, "events": "request.created"})
+	msgs = drain(t, conn)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "invalid_input", msgs[1]["code"])
+}
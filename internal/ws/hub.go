@@ -6,6 +6,9 @@ import (
 	"sync"
 	"time"
 
+	"pxbox/internal/auth"
+	"pxbox/internal/correlation"
+
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
@@ -25,26 +28,65 @@ type StreamsProvider interface {
 	ReplayEvents(channel string, sinceSeq int64, limit int64) ([]StreamEvent, error)
 }
 
-// Hub manages WebSocket connections and channel subscriptions
+// ProtocolVersions lists the message protocol versions the hub speaks
+var ProtocolVersions = []string{"1"}
+
+// DefaultMaxMessageSize is the largest inbound message accepted unless
+// SetMaxMessageSize says otherwise
+const DefaultMaxMessageSize = 1 << 20
+
+// Hub manages WebSocket connections and channel subscriptions. Channels
+// are spread over shards, see shards.go.
 type Hub struct {
-	mu         sync.RWMutex
-	conns      map[*Conn]bool
-	subs       map[string]map[*Conn]bool // channel -> connections
-	publish    chan Event
-	log        *zap.Logger
-	cmdHandler *CommandHandler
-	ctx        context.Context
-	streams    StreamsProvider // For sequence numbers and replay
+	mu           sync.RWMutex // Guards conns and the settings
+	conns        map[*Conn]bool
+	shards       []*shard
+	patterns     patternIndex
+	quit         chan struct{} // Closed by Close to stop the shard workers
+	closeOnce    sync.Once
+	log          *zap.Logger
+	cmdHandler   *CommandHandler
+	ctx          context.Context
+	streams      StreamsProvider // For sequence numbers and replay
+	maxMessage   int64
+	cmdTimeout   time.Duration // Limit of a single command
+	sendBuffer   int           // Send buffer of new connections
+	authenticate Authenticator // Verifies reauth frames
+	stats        hubCounters
+
+	presenceMu  sync.Mutex
+	entityConns map[string]int // entity ID -> open connections
+	presence    PresenceTracker
 }
 
 // Conn represents a WebSocket connection
 type Conn struct {
-	ws     *websocket.Conn
-	send   chan []byte
-	hub    *Hub
-	userID string
-	subs   map[string]bool // subscribed channels
-	ctx    context.Context
+	ws      *websocket.Conn
+	send    chan []byte
+	hub     *Hub
+	userID  string
+	subsMu  sync.Mutex
+	subs    map[string]bool // subscribed channels and patterns
+	ctx     context.Context // Carries the entity; cancelled when the connection closes
+	base    context.Context // ctx without the entity
+	cancel  context.CancelFunc
+	done    chan struct{} // Closed when the connection is unregistered
+	msgpack bool          // Frames are MessagePack instead of JSON
+	batch   *batchReplies // Collects command responses while a batch runs
+
+	streamMu  sync.Mutex // Serializes replays and catch-up from Streams
+	replayMu  sync.Mutex
+	replaying bool                   // Live events are held back in pending
+	pending   []pendingEvent         // Live events that arrived during a replay
+	lastSeq   map[string]int64       // Highest sequence sent per channel
+	behind    bool                   // The send buffer overflowed; catching up from Streams
+	lagging   map[string]bool        // Channels with events skipped while behind
+	filters   map[string]eventFilter // Event types per subscribed channel or pattern
+
+	authMu    sync.Mutex
+	admin     bool        // May subscribe to channel patterns
+	expiresAt time.Time   // When the connection's token expires
+	authTimer *time.Timer // Disconnects the connection at expiresAt
 }
 
 // Event represents a message to be published
@@ -56,14 +98,32 @@ type Event struct {
 // NewHub creates a new WebSocket hub
 func NewHub(log *zap.Logger) *Hub {
 	return &Hub{
-		conns:   make(map[*Conn]bool),
-		subs:    make(map[string]map[*Conn]bool),
-		publish: make(chan Event, 256),
-		log:     log,
-		ctx:     context.Background(),
+		conns:       make(map[*Conn]bool),
+		shards:      newShards(),
+		quit:        make(chan struct{}),
+		log:         log,
+		ctx:         context.Background(),
+		maxMessage:  DefaultMaxMessageSize,
+		cmdTimeout:  DefaultCommandTimeout,
+		entityConns: make(map[string]int),
 	}
 }
 
+// SetMaxMessageSize limits the size of inbound messages. Connections sending
+// a larger message are closed.
+func (h *Hub) SetMaxMessageSize(n int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxMessage = n
+}
+
+// MaxMessageSize returns the inbound message size limit
+func (h *Hub) MaxMessageSize() int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.maxMessage
+}
+
 // SetCommandHandler sets the command handler for processing WebSocket commands
 func (h *Hub) SetCommandHandler(handler *CommandHandler) {
 	h.mu.Lock()
@@ -78,104 +138,143 @@ func (h *Hub) SetStreamsProvider(provider StreamsProvider) {
 	h.streams = provider
 }
 
-// Run starts the hub's event loop
+// Run delivers published events, with a worker per shard, until Close is
+// called. Call it once.
 func (h *Hub) Run() {
-	for event := range h.publish {
-		h.mu.RLock()
-		conns := h.subs[event.Channel]
-		h.mu.RUnlock()
-
-		if conns != nil {
-			msg, _ := json.Marshal(event.Message)
-			for conn := range conns {
-				select {
-				case conn.send <- msg:
-				default:
-					close(conn.send)
-					h.unregister(conn)
-				}
-			}
-		}
+	var wg sync.WaitGroup
+	for _, s := range h.shards {
+		wg.Add(1)
+		go func(s *shard) {
+			defer wg.Done()
+			s.run(h)
+		}(s)
 	}
+	wg.Wait()
+}
+
+// Close stops delivering events; later events are dropped
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() { close(h.quit) })
 }
 
 // Register adds a new connection to the hub
 func (h *Hub) Register(conn *Conn) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	h.conns[conn] = true
+	h.mu.Unlock()
+	h.trackEntity(conn.userID, 1)
 }
 
 // Unregister removes a connection from the hub
 func (h *Hub) unregister(conn *Conn) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	if _, ok := h.conns[conn]; ok {
+	_, ok := h.conns[conn]
+	if ok {
 		delete(h.conns, conn)
-		close(conn.send)
-		for channel := range conn.subs {
-			if subs := h.subs[channel]; subs != nil {
-				delete(subs, conn)
-				if len(subs) == 0 {
-					delete(h.subs, channel)
-				}
-			}
-		}
+		close(conn.done)
 	}
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	conn.cancel()
+	conn.stopExpiry()
+	// Subscribe refuses closed connections, so no subscription is added
+	// after these are removed
+	conn.subsMu.Lock()
+	for channel := range conn.subs {
+		h.removeSub(conn, channel)
+	}
+	conn.subsMu.Unlock()
+	h.trackEntity(conn.userID, -1)
 }
 
-// Subscribe adds a connection to a channel
+// Subscribe adds a connection to a channel or channel pattern
 func (h *Hub) Subscribe(conn *Conn, channel string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if h.subs[channel] == nil {
-		h.subs[channel] = make(map[*Conn]bool)
+	conn.subsMu.Lock()
+	defer conn.subsMu.Unlock()
+	select {
+	case <-conn.done:
+		return
+	default:
+	}
+	if isPattern(channel) {
+		h.patterns.add(channel, conn)
+	} else {
+		h.shardFor(channel).add(channel, conn)
 	}
-	h.subs[channel][conn] = true
 	conn.subs[channel] = true
 }
 
-// Unsubscribe removes a connection from a channel
+// Unsubscribe removes a connection from a channel or channel pattern
 func (h *Hub) Unsubscribe(conn *Conn, channel string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if subs := h.subs[channel]; subs != nil {
-		delete(subs, conn)
-		if len(subs) == 0 {
-			delete(h.subs, channel)
-		}
-	}
+	conn.subsMu.Lock()
+	defer conn.subsMu.Unlock()
+	h.removeSub(conn, channel)
 	delete(conn.subs, channel)
+	conn.forgetSequence(channel)
 }
 
-// Publish sends an event to all subscribers of a channel
+// removeSub drops a connection from the subscribers of a channel or
+// pattern. The caller holds conn.subsMu.
+func (h *Hub) removeSub(conn *Conn, channel string) {
+	if isPattern(channel) {
+		h.patterns.remove(channel, conn)
+	} else {
+		h.shardFor(channel).remove(channel, conn)
+	}
+}
+
+// Publish queues an event for the subscribers of a channel. Events of a
+// channel are delivered in the order they are published.
 func (h *Hub) Publish(channel string, message map[string]interface{}) {
 	select {
-	case h.publish <- Event{Channel: channel, Message: message}:
+	case h.shardFor(channel).queue <- Event{Channel: channel, Message: message}:
 	default:
-		h.log.Warn("Hub publish channel full, dropping event", zap.String("channel", channel))
+		h.stats.publishDropped.Add(1)
+		h.log.Warn("Hub shard queue full, dropping event", zap.String("channel", channel))
 	}
 }
 
 // NewConn creates a new connection
 func NewConn(ws *websocket.Conn, hub *Hub, userID string) *Conn {
+	base, cancel := context.WithCancel(hub.ctx)
 	return &Conn{
-		ws:     ws,
-		send:   make(chan []byte, 256),
-		hub:    hub,
-		userID: userID,
-		subs:   make(map[string]bool),
-		ctx:    hub.ctx,
+		ws:      ws,
+		send:    make(chan []byte, hub.sendBufferSize()),
+		hub:     hub,
+		userID:  userID,
+		subs:    make(map[string]bool),
+		ctx:     auth.WithEntityID(base, userID),
+		base:    base,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		msgpack: ws != nil && ws.Subprotocol() == SubprotocolMsgpack,
+
+		lastSeq: make(map[string]int64),
+		lagging: make(map[string]bool),
+		filters: make(map[string]eventFilter),
 	}
 }
 
+// bindEntity attaches the connection to an entity. Commands are processed on
+// the read goroutine, so this must only be called from a command handler.
+func (c *Conn) bindEntity(entityID string) {
+	c.hub.trackEntity(c.userID, -1)
+	c.userID = entityID
+	c.ctx = auth.WithEntityID(c.base, entityID)
+	c.hub.trackEntity(entityID, 1)
+}
+
 // ReadPump handles reading from the WebSocket connection
 func (c *Conn) ReadPump() {
 	defer func() {
 		c.hub.unregister(c)
-		c.ws.Close()
+		c.close()
 	}()
 
+	c.ws.SetReadLimit(c.hub.MaxMessageSize())
 	c.ws.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.ws.SetPongHandler(func(string) error {
 		c.ws.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -183,7 +282,7 @@ func (c *Conn) ReadPump() {
 	})
 
 	for {
-		_, message, err := c.ws.ReadMessage()
+		frameType, message, err := c.ws.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.hub.log.Error("WebSocket error", zap.Error(err))
@@ -191,8 +290,8 @@ func (c *Conn) ReadPump() {
 			break
 		}
 
-		var msg map[string]interface{}
-		if err := json.Unmarshal(message, &msg); err != nil {
+		msg, err := c.decodeFrame(frameType, message)
+		if err != nil {
 			c.hub.log.Warn("Failed to parse message", zap.Error(err))
 			continue
 		}
@@ -206,31 +305,21 @@ func (c *Conn) WritePump() {
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
 		ticker.Stop()
-		c.ws.Close()
+		c.close()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.done:
 			c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.ws.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+			c.ws.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case message := <-c.send:
+			batch := [][]byte{message}
+			for n := len(c.send); n > 0; n-- {
+				batch = append(batch, <-c.send)
 			}
-
-			w, err := c.ws.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			if err := c.writeBatch(batch); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -244,11 +333,26 @@ func (c *Conn) WritePump() {
 
 func (c *Conn) handleMessage(msg map[string]interface{}) {
 	msgType, _ := msg["type"].(string)
-	
+
 	switch msgType {
 	case "subscribe":
 		channel, _ := msg["channel"].(string)
-		if channel != "" {
+		if channel == "" {
+			break
+		}
+		filter, err := parseEventFilter(msg)
+		if err != nil {
+			c.sendError("invalid_input", err.Error())
+			break
+		}
+		if isPattern(channel) {
+			c.subscribePattern(channel, filter, msg)
+			break
+		}
+		c.setFilter(channel, filter)
+		if since, ok := c.replayStart(channel, msg); ok {
+			c.hub.SubscribeFrom(c, channel, since)
+		} else {
 			c.hub.Subscribe(c, channel)
 			c.sendAck("subscribed", channel)
 		}
@@ -274,10 +378,26 @@ func (c *Conn) handleMessage(msg map[string]interface{}) {
 		}
 	case "cmd":
 		if c.hub.cmdHandler != nil {
-			c.hub.cmdHandler.HandleCommand(c.ctx, c, msg)
+			ctx, cancel := c.commandContext(c.ctx)
+			c.hub.cmdHandler.HandleCommand(ctx, c, msg)
+			cancel()
 		} else {
 			c.hub.log.Warn("Command handler not set")
 		}
+	case "batch":
+		if c.hub.cmdHandler != nil {
+			c.hub.cmdHandler.HandleBatch(correlation.With(c.ctx, correlation.New(), ""), c, msg)
+		} else {
+			c.hub.log.Warn("Command handler not set")
+		}
+	case "reauth":
+		c.handleReauth(msg)
+	case "delivered":
+		if c.hub.cmdHandler != nil {
+			ctx, cancel := c.commandContext(c.ctx)
+			c.hub.cmdHandler.HandleDelivered(ctx, c, msg)
+			cancel()
+		}
 	case "ping":
 		c.sendAck("pong", "")
 	default:
@@ -320,8 +440,8 @@ func (h *Hub) Resume(conn *Conn, channel string, sinceSeq int64) {
 		h.log.Warn("Streams provider not set, cannot resume")
 		return
 	}
-	
-	events, err := h.streams.ReplayEvents(channel, sinceSeq, 100) // Limit to 100 events
+
+	count, err := h.replay(conn, channel, sinceSeq)
 	if err != nil {
 		h.log.Error("Failed to replay events",
 			zap.String("channel", channel),
@@ -330,29 +450,11 @@ func (h *Hub) Resume(conn *Conn, channel string, sinceSeq int64) {
 		)
 		return
 	}
-	
-	// Send replayed events to connection
-	for _, event := range events {
-		msg := map[string]interface{}{
-			"type":    "event",
-			"channel": event.Channel,
-			"seq":     event.Sequence,
-			"data":    event.Event,
-		}
-		msgBytes, _ := json.Marshal(msg)
-		select {
-		case conn.send <- msgBytes:
-		default:
-			h.log.Warn("Failed to send replayed event, connection buffer full")
-			return
-		}
-	}
-	
+
 	h.log.Info("Resumed events",
 		zap.String("channel", channel),
 		zap.String("connection", conn.userID),
 		zap.Int64("since", sinceSeq),
-		zap.Int("count", len(events)),
+		zap.Int("count", count),
 	)
 }
-
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The benchmarks measure the hub's fan-out from Publish to the send buffers
+// of subscribed connections, without sockets; cmd/pxbox-loadgen measures
+// the whole path. Each event counts as delivered once per subscriber, so
+// compare deliveries/s across hub changes:
+//
+//	go test ./internal/ws/ -run '^$' -bench Hub -benchmem
+
+// benchHub is a running hub with subs drained connections on each of
+// channels channels
+type benchHub struct {
+	hub      *Hub
+	channels []string
+	conns    []*Conn
+	wg       sync.WaitGroup
+}
+
+func newBenchHub(b *testing.B, channels, subs int) *benchHub {
+	b.Helper()
+	bh := &benchHub{hub: NewHub(zap.NewNop())}
+	go bh.hub.Run()
+	for i := 0; i < channels; i++ {
+		channel := fmt.Sprintf("bench:%d", i)
+		bh.channels = append(bh.channels, channel)
+		for j := 0; j < subs; j++ {
+			conn := NewConn(nil, bh.hub, fmt.Sprintf("e%d", j))
+			bh.hub.Register(conn)
+			bh.hub.Subscribe(conn, channel)
+			bh.conns = append(bh.conns, conn)
+			bh.wg.Add(1)
+			go bh.drain(conn)
+		}
+	}
+	b.Cleanup(bh.close)
+	return bh
+}
+
+// drain stands in for a connection's write pump
+func (bh *benchHub) drain(conn *Conn) {
+	defer bh.wg.Done()
+	for {
+		select {
+		case <-conn.send:
+		case <-conn.done:
+			return
+		}
+	}
+}
+
+func (bh *benchHub) close() {
+	for _, conn := range bh.conns {
+		bh.hub.unregister(conn)
+	}
+	bh.wg.Wait()
+	bh.hub.Close()
+}
+
+// wait blocks until n deliveries were made or dropped since start
+func (bh *benchHub) wait(b *testing.B, start, n int64) {
+	deadline := time.Now().Add(time.Minute)
+	for bh.processed()-start < n {
+		if time.Now().After(deadline) {
+			b.Fatalf("%d of %d deliveries after a minute", bh.processed()-start, n)
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+// publish queues an event like Publish, but waits instead of dropping it
+// when the queue is full
+func (bh *benchHub) publish(channel string) {
+	bh.hub.shardFor(channel).queue <- Event{Channel: channel, Message: benchEvent}
+}
+
+func (bh *benchHub) processed() int64 {
+	return bh.hub.stats.delivered.Load() + bh.hub.stats.dropped.Load()
+}
+
+func (bh *benchHub) report(b *testing.B, start time.Time, deliveries int64) {
+	b.ReportMetric(float64(deliveries)/time.Since(start).Seconds(), "deliveries/s")
+	b.ReportMetric(float64(bh.hub.stats.dropped.Load()), "dropped")
+}
+
+var benchEvent = map[string]interface{}{
+	"type":      "request.created",
+	"requestId": "01J0000000000000000000000",
+	"entityId":  "01J0000000000000000000001",
+	"status":    "PENDING",
+}
+
+// BenchmarkHubFanOut publishes to one channel with many subscribers
+func BenchmarkHubFanOut(b *testing.B) {
+	for _, subs := range []int{1, 100, 1000, 10000} {
+		b.Run(fmt.Sprintf("subs=%d", subs), func(b *testing.B) {
+			bh := newBenchHub(b, 1, subs)
+			before := bh.processed()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				bh.publish(bh.channels[0])
+			}
+			bh.wait(b, before, int64(b.N*subs))
+			bh.report(b, start, int64(b.N*subs))
+		})
+	}
+}
+
+// BenchmarkHubChannels publishes from parallel goroutines across many
+// channels with one subscriber each, as with per-entity channels
+func BenchmarkHubChannels(b *testing.B) {
+	for _, channels := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("channels=%d", channels), func(b *testing.B) {
+			bh := newBenchHub(b, channels, 1)
+			before := bh.processed()
+			b.ResetTimer()
+			start := time.Now()
+			var next sync.Mutex
+			i := 0
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					next.Lock()
+					channel := bh.channels[i%channels]
+					i++
+					next.Unlock()
+					bh.publish(channel)
+				}
+			})
+			bh.wait(b, before, int64(b.N))
+			bh.report(b, start, int64(b.N))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package ws
+
+import (
+	"context"
+
+	"pxbox/internal/service"
+)
+
+// The inquiry commands mirror GET /v1/inquiries, GET /v1/entities/{id}/queue
+// and POST /v1/inquiries/{id}/markRead. Without an entityId or view they
+// list the connection's own entity.
+
+func (h *CommandHandler) handleListInquiries(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
+	q := service.InquiryQuery{
+		Tags: stringList(data["tags"]),
+	}
+	q.ViewID, _ = data["view"].(string)
+	q.EntityID, _ = data["entityId"].(string)
+	q.Status, _ = data["status"].(string)
+	q.CreatedBy, _ = data["createdBy"].(string)
+	q.SortBy, _ = data["sortBy"].(string)
+	q.IncludeDeleted, _ = data["includeDeleted"].(bool)
+	q.IncludeSnoozed, _ = data["includeSnoozed"].(bool)
+	q.IncludeExpired, _ = data["includeExpired"].(bool)
+	q.Limit, q.Offset = pageParams(data)
+	if q.ViewID == "" && q.EntityID == "" {
+		q.EntityID = conn.userID
+	}
+
+	requests, err := h.requestSvc.ListInquiries(ctx, q)
+	if err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": map[string]interface{}{
+			"items": requests,
+			"total": len(requests),
+		},
+	})
+}
+
+func (h *CommandHandler) handleGetQueue(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
+	entityID, _ := data["entityId"].(string)
+	if entityID == "" {
+		entityID = conn.userID
+	}
+	var status *string
+	if s, _ := data["status"].(string); s != "" {
+		status = &s
+	}
+	includeSnoozed, _ := data["includeSnoozed"].(bool)
+	limit, offset := pageParams(data)
+
+	requests, err := h.requestSvc.EntityQueue(ctx, entityID, status, includeSnoozed, limit, offset)
+	if err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": map[string]interface{}{
+			"items": requests,
+		},
+	})
+}
+
+func (h *CommandHandler) handleMarkRead(ctx context.Context, conn *Conn, msgID string, data map[string]interface{}) {
+	requestID, _ := data["requestId"].(string)
+	if requestID == "" {
+		h.sendError(ctx, conn, msgID, "invalid_input", "requestId required")
+		return
+	}
+
+	if err := h.requestSvc.MarkRead(ctx, requestID); err != nil {
+		h.sendServiceError(ctx, conn, msgID, err)
+		return
+	}
+
+	h.sendResponse(conn, msgID, map[string]interface{}{
+		"type": "response",
+		"data": map[string]string{"requestId": requestID, "status": "read"},
+	})
+}
+
+// pageParams reads limit and offset; 0 selects the default limit
+func pageParams(data map[string]interface{}) (limit, offset int) {
+	if v, ok := data["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+	if v, ok := data["offset"].(float64); ok && v > 0 {
+		offset = int(v)
+	}
+	return limit, offset
+}
+
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := make([]string, 0, len(list))
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"pxbox/internal/correlation"
+)
+
+// Every connection has a context that is cancelled when it closes, and each
+// command runs in a context derived from it with the hub's command timeout,
+// so commands stop when they take too long or their client is gone.
+
+// DefaultCommandTimeout bounds a command unless SetCommandTimeout says
+// otherwise
+const DefaultCommandTimeout = 30 * time.Second
+
+// SetCommandTimeout sets how long a command may run; 0 disables the limit
+func (h *Hub) SetCommandTimeout(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cmdTimeout = d
+}
+
+func (h *Hub) commandTimeout() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cmdTimeout
+}
+
+// commandContext derives the context of one command from parent, with a
+// correlation ID of its own unless parent, a batch, has one
+func (c *Conn) commandContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if correlation.ID(parent) == "" {
+		parent = correlation.With(parent, correlation.New(), "")
+	}
+	if timeout := c.hub.commandTimeout(); timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// close cancels the connection's commands and closes its socket, which ends
+// ReadPump and unregisters the connection
+func (c *Conn) close() {
+	c.cancel()
+	c.ws.Close()
+}
@@ -0,0 +1,45 @@
+package ws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCommandContextHasTimeout(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	hub.SetCommandTimeout(time.Minute)
+	conn := NewConn(nil, hub, "e1")
+
+	ctx, cancel := conn.commandContext(conn.ctx)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	hub.SetCommandTimeout(0)
+	ctx, cancel = conn.commandContext(conn.ctx)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
+
+func TestUnregisterCancelsCommands(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+	hub.Register(conn)
+
+	ctx, cancel := conn.commandContext(conn.ctx)
+	defer cancel()
+	hub.unregister(conn)
+
+	select {
+	case <-ctx.Done():
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("command context not cancelled")
+	}
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A channel name ending in "*" subscribes to every channel starting with
+// the rest of it: "request:*" gets the events of all requests, "*" those of
+// all channels. Pattern subscriptions are live only and limited to admin
+// connections.
+
+// isPattern reports whether a subscription names a channel pattern
+func isPattern(channel string) bool {
+	return strings.Contains(channel, "*")
+}
+
+// validPattern reports whether a pattern has a single "*", at the end
+func validPattern(pattern string) bool {
+	return strings.Index(pattern, "*") == len(pattern)-1
+}
+
+// matchPattern reports whether a channel matches a valid pattern
+func matchPattern(pattern, channel string) bool {
+	return strings.HasPrefix(channel, strings.TrimSuffix(pattern, "*"))
+}
+
+// SetAdmin marks a connection as opened with an admin token, which may
+// subscribe to channel patterns
+func (c *Conn) SetAdmin(admin bool) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	c.admin = admin
+}
+
+func (c *Conn) isAdmin() bool {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.admin
+}
+
+// subscribePattern handles a subscribe message for a channel pattern
+func (c *Conn) subscribePattern(pattern string, filter eventFilter, msg map[string]interface{}) {
+	if !validPattern(pattern) {
+		c.sendError("invalid_channel", "a channel pattern must end in its only *")
+		return
+	}
+	if !c.isAdmin() {
+		c.sendError("forbidden", "channel patterns require admin access")
+		return
+	}
+	_, since := msg["since"]
+	if resume, _ := msg["resume"].(bool); since || resume {
+		c.sendError("replay_unsupported", "channel patterns cannot be replayed")
+		return
+	}
+	c.setFilter(pattern, filter)
+	c.hub.Subscribe(c, pattern)
+	c.sendAck("subscribed", pattern)
+}
+
+// dropPatterns removes the pattern subscriptions of a connection that lost
+// admin access
+func (h *Hub) dropPatterns(conn *Conn) {
+	conn.subsMu.Lock()
+	var patterns []string
+	for channel := range conn.subs {
+		if isPattern(channel) {
+			patterns = append(patterns, channel)
+		}
+	}
+	conn.subsMu.Unlock()
+
+	for _, pattern := range patterns {
+		h.Unsubscribe(conn, pattern)
+		conn.sendAck("unsubscribed", pattern)
+	}
+}
+
+// patternIndex holds the pattern subscriptions. They are few, so every
+// change rebuilds the list that delivery matches channels against.
+type patternIndex struct {
+	mu   sync.Mutex
+	subs map[string]map[*Conn]bool // pattern -> connections
+	list atomic.Pointer[[]patternSub]
+}
+
+type patternSub struct {
+	pattern string
+	conn    *Conn
+}
+
+func (p *patternIndex) add(pattern string, conn *Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.subs == nil {
+		p.subs = make(map[string]map[*Conn]bool)
+	}
+	if p.subs[pattern] == nil {
+		p.subs[pattern] = make(map[*Conn]bool)
+	}
+	p.subs[pattern][conn] = true
+	p.snapshot()
+}
+
+func (p *patternIndex) remove(pattern string, conn *Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if subs := p.subs[pattern]; subs != nil {
+		delete(subs, conn)
+		if len(subs) == 0 {
+			delete(p.subs, pattern)
+		}
+		p.snapshot()
+	}
+}
+
+func (p *patternIndex) snapshot() {
+	var list []patternSub
+	for pattern, subs := range p.subs {
+		for conn := range subs {
+			list = append(list, patternSub{pattern: pattern, conn: conn})
+		}
+	}
+	p.list.Store(&list)
+}
+
+// subscribers returns the connections subscribed to a channel directly or
+// through a pattern, each once
+func (h *Hub) subscribers(channel string) []*Conn {
+	conns := h.shardFor(channel).subscribers(channel)
+	list := h.patterns.list.Load()
+	if list == nil || len(*list) == 0 {
+		return conns
+	}
+
+	var seen map[*Conn]bool
+	for _, sub := range *list {
+		if !matchPattern(sub.pattern, channel) {
+			continue
+		}
+		if seen == nil {
+			// Copy before appending, the direct list is shared
+			seen = make(map[*Conn]bool, len(conns))
+			conns = append([]*Conn(nil), conns...)
+			for _, conn := range conns {
+				seen[conn] = true
+			}
+		}
+		if !seen[sub.conn] {
+			seen[sub.conn] = true
+			conns = append(conns, sub.conn)
+		}
+	}
+	return conns
+}
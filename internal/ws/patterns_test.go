@@ -0,0 +1,62 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestValidPattern(t *testing.T) {
+	for _, p := range []string{"*", "request:*", "entity:ab*"} {
+		assert.True(t, validPattern(p), p)
+	}
+	for _, p := range []string{"*:x", "request:*:x", "**"} {
+		assert.False(t, validPattern(p), p)
+	}
+	assert.True(t, matchPattern("request:*", "request:r1"))
+	assert.False(t, matchPattern("request:*", "requestor:c1"))
+	assert.True(t, matchPattern("*", "ops"))
+}
+
+func TestPatternSubscriptionRequiresAdmin(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+
+	conn.handleMessage(map[string]interface{}{"type": "subscribe", "channel": "request:*"})
+	msgs := drain(t, conn)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "forbidden", msgs[0]["code"])
+	assert.Empty(t, hub.subscribers("request:r1"))
+
+	conn.SetAdmin(true)
+	conn.handleMessage(map[string]interface{}{"type": "subscribe", "channel": "request:*", "since": float64(3)})
+	msgs = drain(t, conn)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "replay_unsupported", msgs[0]["code"])
+
+	conn.handleMessage(map[string]interface{}{"type": "subscribe", "channel": "request:*"})
+	msgs = drain(t, conn)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "subscribed", msgs[0]["ack"])
+	assert.Equal(t, "request:*", msgs[0]["channel"])
+}
+
+func TestSubscribersIncludePatterns(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	direct := NewConn(nil, hub, "e1")
+	ops := NewConn(nil, hub, "admin")
+	hub.Subscribe(direct, "request:r1")
+	hub.Subscribe(ops, "request:*")
+	hub.Subscribe(ops, "*")
+	hub.Subscribe(ops, "request:r1")
+
+	assert.ElementsMatch(t, []*Conn{direct, ops}, hub.subscribers("request:r1"))
+	assert.ElementsMatch(t, []*Conn{ops}, hub.subscribers("entity:e1"))
+	assert.True(t, hub.isSubscribed(ops, "request:r2"))
+
+	hub.dropPatterns(ops)
+	assert.Empty(t, hub.subscribers("entity:e1"))
+	assert.ElementsMatch(t, []*Conn{direct, ops}, hub.subscribers("request:r1"))
+}
@@ -0,0 +1,62 @@
+package ws
+
+// PresenceTracker is told when an entity gains its first connection to this
+// hub and when its last connection closes
+type PresenceTracker interface {
+	Connected(entityID string)
+	Disconnected(entityID string)
+}
+
+// SetPresenceTracker sets where entity connect and disconnect transitions
+// are reported
+func (h *Hub) SetPresenceTracker(tracker PresenceTracker) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	h.presence = tracker
+}
+
+// ConnectedEntities returns the entities with at least one open connection
+func (h *Hub) ConnectedEntities() []string {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	ids := make([]string, 0, len(h.entityConns))
+	for id := range h.entityConns {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// IsConnected reports whether entityID has an open connection to this hub
+func (h *Hub) IsConnected(entityID string) bool {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	return h.entityConns[entityID] > 0
+}
+
+// trackEntity adjusts the connection count of an entity. The tracker is
+// called under presenceMu so a quick reconnect cannot overtake the
+// disconnect before it.
+func (h *Hub) trackEntity(entityID string, delta int) {
+	if entityID == "" || entityID == "anonymous" {
+		return
+	}
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	n := h.entityConns[entityID] + delta
+	if n <= 0 {
+		delete(h.entityConns, entityID)
+	} else {
+		h.entityConns[entityID] = n
+	}
+
+	if h.presence == nil {
+		return
+	}
+	switch {
+	case delta > 0 && n == delta:
+		h.presence.Connected(entityID)
+	case delta < 0 && n <= 0:
+		h.presence.Disconnected(entityID)
+	}
+}
@@ -0,0 +1,320 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// replayPageSize is how many events are read from Streams at a time
+const replayPageSize = 100
+
+// replaySendTimeout is how long a replay waits for room in the send buffer
+// before giving up on a client that does not read
+const replaySendTimeout = 10 * time.Second
+
+var (
+	errReplayUnavailable = errors.New("event replay is not configured")
+	errReplayStalled     = errors.New("client stopped reading during replay")
+)
+
+// pendingEvent is a live event held back while a replay is running
+type pendingEvent struct {
+	channel string
+	seq     int64
+	msg     []byte
+}
+
+// eventSequence returns the sequence number the bus added to an event, or
+// 0 if it has none
+func eventSequence(message map[string]interface{}) int64 {
+	switch seq := message["seq"].(type) {
+	case int64:
+		return seq
+	case int:
+		return int64(seq)
+	case float64:
+		return int64(seq)
+	}
+	return 0
+}
+
+// eventMessage wraps an event for delivery to clients
+func eventMessage(channel string, seq int64, event map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(event))
+	for k, v := range event {
+		if k != "seq" {
+			data[k] = v
+		}
+	}
+	return map[string]interface{}{
+		"type":    "event",
+		"channel": channel,
+		"seq":     seq,
+		"data":    data,
+	}
+}
+
+// deliver queues a live event. While a replay is running the event is held
+// back; afterwards events the client already got are skipped. A full send
+// buffer puts the connection behind, see overflow. It reports false if the
+// event is lost.
+func (c *Conn) deliver(channel string, seq int64, msg []byte) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if c.replaying {
+		c.pending = append(c.pending, pendingEvent{channel: channel, seq: seq, msg: msg})
+		return true
+	}
+	if seq > 0 && seq <= c.lastSeq[channel] {
+		return true
+	}
+	if c.behind {
+		return c.deferEvent(channel, seq)
+	}
+	select {
+	case c.send <- msg:
+		if seq > 0 {
+			c.lastSeq[channel] = seq
+		}
+		c.hub.stats.delivered.Add(1)
+		return true
+	default:
+		return c.overflow(channel, seq)
+	}
+}
+
+// replayStart reads the replay options of a subscribe message: "since" is
+// the last sequence the client has, "resume": true uses its last
+// acknowledged sequence instead
+func (c *Conn) replayStart(channel string, msg map[string]interface{}) (int64, bool) {
+	if since, ok := msg["since"].(float64); ok && since >= 0 {
+		return int64(since), true
+	}
+	if resume, _ := msg["resume"].(bool); !resume {
+		return 0, false
+	}
+
+	c.hub.mu.RLock()
+	streams := c.hub.streams
+	c.hub.mu.RUnlock()
+	if streams == nil {
+		return 0, true
+	}
+	since, err := streams.GetLastSequence(channel, c.userID)
+	if err != nil {
+		c.hub.log.Warn("Failed to get last acknowledged sequence",
+			zap.String("channel", channel),
+			zap.Error(err),
+		)
+	}
+	return since, true
+}
+
+// SubscribeFrom subscribes a connection to a channel and replays the events
+// after since before any live event, so the client gets every sequence once
+// and in order. The "subscribed" ack follows the replayed events.
+func (h *Hub) SubscribeFrom(conn *Conn, channel string, since int64) {
+	conn.streamMu.Lock()
+	defer conn.streamMu.Unlock()
+	conn.startReplay()
+	h.Subscribe(conn, channel)
+
+	count, err := h.replayEvents(conn, channel, since)
+	if errors.Is(err, errReplayStalled) {
+		conn.abortReplay()
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to replay events",
+			zap.String("channel", channel),
+			zap.Int64("since", since),
+			zap.Error(err),
+		)
+		conn.sendError("replay_failed", err.Error())
+	}
+
+	ack, _ := json.Marshal(map[string]interface{}{
+		"type":     "ack",
+		"ack":      "subscribed",
+		"channel":  channel,
+		"replayed": count,
+		"seq":      conn.sequence(channel),
+	})
+	if !conn.sendWait(ack) {
+		conn.abortReplay()
+		return
+	}
+	conn.finishReplay()
+}
+
+// replay sends the events after since without subscribing
+func (h *Hub) replay(conn *Conn, channel string, since int64) (int, error) {
+	conn.streamMu.Lock()
+	defer conn.streamMu.Unlock()
+	conn.startReplay()
+	count, err := h.replayEvents(conn, channel, since)
+	if errors.Is(err, errReplayStalled) {
+		conn.abortReplay()
+	} else {
+		conn.finishReplay()
+	}
+	return count, err
+}
+
+// replayEvents sends the events of channel after since from Streams, page
+// by page. The caller holds streamMu, and live events for the channel are
+// held back (replaying) or skipped (behind) meanwhile.
+func (h *Hub) replayEvents(conn *Conn, channel string, since int64) (int, error) {
+	h.mu.RLock()
+	streams := h.streams
+	h.mu.RUnlock()
+	conn.setSequence(channel, since)
+	if streams == nil {
+		return 0, errReplayUnavailable
+	}
+
+	count := 0
+	last := since
+	for {
+		events, err := streams.ReplayEvents(channel, last, replayPageSize)
+		if err != nil {
+			return count, err
+		}
+
+		progressed := false
+		for _, e := range events {
+			if e.Sequence <= last {
+				continue
+			}
+			if last == since && e.Sequence > last+1 {
+				// The events in between were trimmed by the retention policy
+				msg, _ := json.Marshal(map[string]interface{}{
+					"type":    "error",
+					"code":    "replay_truncated",
+					"message": fmt.Sprintf("events %d to %d are no longer retained", last+1, e.Sequence-1),
+					"channel": channel,
+				})
+				if !conn.sendWait(msg) {
+					return count, errReplayStalled
+				}
+			}
+			last = e.Sequence
+			progressed = true
+			if !conn.wants(channel, eventType(e.Event)) {
+				conn.setSequence(channel, last)
+				continue
+			}
+			msg, _ := json.Marshal(eventMessage(channel, e.Sequence, e.Event))
+			if !conn.sendWait(msg) {
+				return count, errReplayStalled
+			}
+			conn.setSequence(channel, last)
+			count++
+		}
+
+		if len(events) < replayPageSize || !progressed {
+			return count, nil
+		}
+	}
+}
+
+func (c *Conn) startReplay() {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	c.replaying = true
+}
+
+// finishReplay sends the live events held back during the replay, skipping
+// those the replay already sent, and resumes live delivery. If the
+// connection is behind, events are left to the catch-up.
+func (c *Conn) finishReplay() {
+	for {
+		c.replayMu.Lock()
+		pending := c.pending
+		c.pending = nil
+		if len(pending) == 0 {
+			c.replaying = false
+			c.replayMu.Unlock()
+			return
+		}
+		c.replayMu.Unlock()
+
+		for _, e := range pending {
+			if e.seq > 0 {
+				if !c.takePending(e.channel, e.seq) {
+					continue
+				}
+			}
+			if !c.sendWait(e.msg) {
+				c.abortReplay()
+				return
+			}
+		}
+	}
+}
+
+// abortReplay drops the held back events of a connection that is being
+// closed
+func (c *Conn) abortReplay() {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	c.pending = nil
+	c.replaying = false
+}
+
+// sendWait queues a message, waiting for room in the send buffer. A client
+// that does not read within replaySendTimeout is disconnected.
+func (c *Conn) sendWait(msg []byte) bool {
+	timer := time.NewTimer(replaySendTimeout)
+	defer timer.Stop()
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.done:
+		return false
+	case <-timer.C:
+		c.hub.log.Warn("Closing WebSocket connection that stopped reading during replay", zap.String("userID", c.userID))
+		c.close()
+		return false
+	}
+}
+
+func (c *Conn) sequence(channel string) int64 {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	return c.lastSeq[channel]
+}
+
+func (c *Conn) setSequence(channel string, seq int64) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	c.lastSeq[channel] = seq
+}
+
+// takePending reports whether a held back event is to be sent, and records
+// its sequence if so
+func (c *Conn) takePending(channel string, seq int64) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if seq <= c.lastSeq[channel] {
+		return false
+	}
+	if c.behind {
+		c.deferEvent(channel, seq)
+		return false
+	}
+	c.lastSeq[channel] = seq
+	return true
+}
+
+func (c *Conn) forgetSequence(channel string) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	delete(c.lastSeq, channel)
+	delete(c.lagging, channel)
+	delete(c.filters, channel)
+}
@@ -0,0 +1,178 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeStreams serves stored events and runs onReplay on every read, to
+// publish live events while a replay is in progress
+type fakeStreams struct {
+	events   []StreamEvent
+	acked    int64
+	onReplay func()
+}
+
+func (f *fakeStreams) GetLastSequence(channel, connectionID string) (int64, error) {
+	return f.acked, nil
+}
+
+func (f *fakeStreams) AcknowledgeSequence(channel, connectionID string, sequence int64) error {
+	f.acked = sequence
+	return nil
+}
+
+func (f *fakeStreams) ReplayEvents(channel string, sinceSeq int64, limit int64) ([]StreamEvent, error) {
+	if f.onReplay != nil {
+		f.onReplay()
+	}
+	var out []StreamEvent
+	for _, e := range f.events {
+		if e.Sequence > sinceSeq && int64(len(out)) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func drain(t *testing.T, conn *Conn) []map[string]interface{} {
+	var msgs []map[string]interface{}
+	for {
+		select {
+		case data := <-conn.send:
+			var msg map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &msg))
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func liveEvent(t *testing.T, channel string, seq int64) []byte {
+	msg, err := json.Marshal(eventMessage(channel, seq, map[string]interface{}{"type": "test.event"}))
+	require.NoError(t, err)
+	return msg
+}
+
+func TestSubscribeFromReplaysWithoutGaps(t *testing.T) {
+	const channel = "entity:e1"
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+
+	streams := &fakeStreams{}
+	for seq := int64(1); seq <= 5; seq++ {
+		streams.events = append(streams.events, StreamEvent{Channel: channel, Sequence: seq, Event: map[string]interface{}{"type": "test.event"}})
+	}
+	// Event 5 also arrives live during the replay, and 6 after the read
+	streams.onReplay = func() {
+		streams.onReplay = nil
+		assert.True(t, conn.deliver(channel, 5, liveEvent(t, channel, 5)))
+		assert.True(t, conn.deliver(channel, 6, liveEvent(t, channel, 6)))
+	}
+	hub.SetStreamsProvider(streams)
+
+	hub.SubscribeFrom(conn, channel, 2)
+
+	msgs := drain(t, conn)
+	require.Len(t, msgs, 5)
+	for i, seq := range []float64{3, 4, 5} {
+		assert.Equal(t, "event", msgs[i]["type"])
+		assert.Equal(t, seq, msgs[i]["seq"])
+	}
+	assert.Equal(t, "subscribed", msgs[3]["ack"])
+	assert.Equal(t, float64(3), msgs[3]["replayed"])
+	assert.Equal(t, float64(6), msgs[4]["seq"])
+
+	// Live delivery skips sequences the client already has
+	assert.True(t, conn.deliver(channel, 6, liveEvent(t, channel, 6)))
+	assert.True(t, conn.deliver(channel, 7, liveEvent(t, channel, 7)))
+	msgs = drain(t, conn)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, float64(7), msgs[0]["seq"])
+}
+
+func TestSubscribeResumeFromAck(t *testing.T) {
+	const channel = "entity:e1"
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+	streams := &fakeStreams{acked: 4, events: []StreamEvent{
+		{Channel: channel, Sequence: 4, Event: map[string]interface{}{}},
+		{Channel: channel, Sequence: 5, Event: map[string]interface{}{}},
+	}}
+	hub.SetStreamsProvider(streams)
+
+	since, ok := conn.replayStart(channel, map[string]interface{}{"resume": true})
+	require.True(t, ok)
+	assert.Equal(t, int64(4), since)
+	_, ok = conn.replayStart(channel, map[string]interface{}{})
+	assert.False(t, ok)
+
+	hub.SubscribeFrom(conn, channel, since)
+	msgs := drain(t, conn)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, float64(5), msgs[0]["seq"])
+	assert.Equal(t, float64(5), msgs[1]["seq"])
+	assert.Equal(t, "subscribed", msgs[1]["ack"])
+}
+
+func TestOverflowCatchesUpFromStreams(t *testing.T) {
+	const channel = "entity:e1"
+	hub := NewHub(zap.NewNop())
+	hub.SetSendBufferSize(2)
+	conn := NewConn(nil, hub, "e1")
+	streams := &fakeStreams{}
+	for seq := int64(1); seq <= 5; seq++ {
+		streams.events = append(streams.events, StreamEvent{Channel: channel, Sequence: seq, Event: map[string]interface{}{"type": "test.event"}})
+	}
+	hub.SetStreamsProvider(streams)
+	hub.Subscribe(conn, channel)
+
+	// 3 does not fit and puts the connection behind; 4 and 5 are left to
+	// the catch-up
+	for seq := int64(1); seq <= 5; seq++ {
+		assert.True(t, conn.deliver(channel, seq, liveEvent(t, channel, seq)))
+	}
+	assert.True(t, conn.isBehind())
+
+	var seqs []float64
+	for len(seqs) < 5 {
+		select {
+		case data := <-conn.send:
+			var msg map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &msg))
+			seqs = append(seqs, msg["seq"].(float64))
+		case <-time.After(time.Second):
+			t.Fatalf("missing events, got %v", seqs)
+		}
+	}
+	assert.Equal(t, []float64{1, 2, 3, 4, 5}, seqs)
+	require.Eventually(t, func() bool { return !conn.isBehind() }, time.Second, 10*time.Millisecond)
+
+	assert.True(t, conn.deliver(channel, 6, liveEvent(t, channel, 6)))
+	msgs := drain(t, conn)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, float64(6), msgs[0]["seq"])
+
+	stats := hub.Stats()
+	assert.Equal(t, int64(1), stats.Overflows)
+	assert.Equal(t, int64(3), stats.CaughtUp)
+	assert.Equal(t, int64(3), stats.Delivered)
+	assert.Zero(t, stats.Dropped)
+}
+
+func TestOverflowDropsEventsWithoutSequence(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	hub.SetSendBufferSize(1)
+	conn := NewConn(nil, hub, "e1")
+
+	assert.True(t, conn.deliver("ops", 0, []byte(`{}`)))
+	assert.False(t, conn.deliver("ops", 0, []byte(`{}`)))
+	assert.False(t, conn.isBehind())
+	assert.Equal(t, int64(1), hub.Stats().Dropped)
+}
@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// Subscriptions are split over shards by a hash of the channel name. Each
+// shard has its own lock, taken only to change subscriptions, and its own
+// worker delivering the shard's events in publish order, so the events of a
+// channel keep their order while channels on different shards are served in
+// parallel. Delivery reads immutable subscriber lists and takes no lock.
+
+// hubShards is the number of shards and shard workers
+const hubShards = 64
+
+// shardQueueSize is the number of published events a shard holds before
+// Publish drops events for it
+const shardQueueSize = 256
+
+type shard struct {
+	mu       sync.Mutex // Serializes subscription changes
+	channels sync.Map   // channel -> *channelSubs
+	queue    chan Event
+}
+
+// channelSubs are the subscribers of one channel. conns is changed under
+// the shard's lock; list is a copy for delivery, replaced on every change.
+type channelSubs struct {
+	conns map[*Conn]bool
+	list  atomic.Pointer[[]*Conn]
+}
+
+func newShards() []*shard {
+	shards := make([]*shard, hubShards)
+	for i := range shards {
+		shards[i] = &shard{queue: make(chan Event, shardQueueSize)}
+	}
+	return shards
+}
+
+// shardFor returns the shard of a channel, by its FNV-1a hash
+func (h *Hub) shardFor(channel string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(channel); i++ {
+		hash ^= uint32(channel[i])
+		hash *= 16777619
+	}
+	return h.shards[hash%uint32(len(h.shards))]
+}
+
+func (s *shard) add(channel string, conn *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.channels.Load(channel); ok {
+		subs := v.(*channelSubs)
+		subs.conns[conn] = true
+		subs.snapshot()
+		return
+	}
+	// Published with its list set, as delivery reads it without the lock
+	subs := &channelSubs{conns: map[*Conn]bool{conn: true}}
+	subs.snapshot()
+	s.channels.Store(channel, subs)
+}
+
+func (s *shard) remove(channel string, conn *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.channels.Load(channel)
+	if !ok {
+		return
+	}
+	subs := v.(*channelSubs)
+	delete(subs.conns, conn)
+	if len(subs.conns) == 0 {
+		s.channels.Delete(channel)
+	}
+	subs.snapshot()
+}
+
+// subscribers returns the direct subscribers of a channel. The slice must
+// not be modified.
+func (s *shard) subscribers(channel string) []*Conn {
+	v, ok := s.channels.Load(channel)
+	if !ok {
+		return nil
+	}
+	if list := v.(*channelSubs).list.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
+func (c *channelSubs) snapshot() {
+	list := make([]*Conn, 0, len(c.conns))
+	for conn := range c.conns {
+		list = append(list, conn)
+	}
+	c.list.Store(&list)
+}
+
+// run delivers the shard's events until the hub is closed
+func (s *shard) run(h *Hub) {
+	for {
+		select {
+		case event := <-s.queue:
+			h.dispatch(event)
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// dispatch sends an event to the subscribers of its channel
+func (h *Hub) dispatch(event Event) {
+	conns := h.subscribers(event.Channel)
+	if len(conns) == 0 {
+		return
+	}
+	seq := eventSequence(event.Message)
+	msgType := eventType(event.Message)
+	msg, _ := json.Marshal(eventMessage(event.Channel, seq, event.Message))
+	for _, conn := range conns {
+		if conn.wants(event.Channel, msgType) {
+			conn.deliver(event.Channel, seq, msg)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestHubKeepsOrderPerChannel(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	hub.SetSendBufferSize(1000)
+	go hub.Run()
+	defer hub.Close()
+
+	const channels, events = 20, 50
+	conns := make([]*Conn, channels)
+	for i := range conns {
+		conns[i] = NewConn(nil, hub, "e1")
+		hub.Subscribe(conns[i], fmt.Sprintf("entity:e%d", i))
+	}
+
+	// One publisher per channel, all at once
+	var wg sync.WaitGroup
+	for i := 0; i < channels; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 1; n <= events; n++ {
+				hub.Publish(fmt.Sprintf("entity:e%d", i), map[string]interface{}{"type": "request.created", "n": n})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, conn := range conns {
+		for n := 1; n <= events; n++ {
+			select {
+			case raw := <-conn.send:
+				var msg struct {
+					Channel string `json:"channel"`
+					Data    struct {
+						N int `json:"n"`
+					} `json:"data"`
+				}
+				require.NoError(t, json.Unmarshal(raw, &msg))
+				require.Equal(t, fmt.Sprintf("entity:e%d", i), msg.Channel)
+				require.Equal(t, n, msg.Data.N)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("channel %d: event %d not delivered", i, n)
+			}
+		}
+	}
+}
+
+func TestHubUnsubscribeAndUnregister(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	conn := NewConn(nil, hub, "e1")
+	other := NewConn(nil, hub, "e2")
+	hub.Register(conn)
+	hub.Subscribe(conn, "entity:e1")
+	hub.Subscribe(conn, "request:r1")
+	hub.Subscribe(other, "request:r1")
+
+	hub.Unsubscribe(conn, "entity:e1")
+	assert.Empty(t, hub.subscribers("entity:e1"))
+	assert.ElementsMatch(t, []*Conn{conn, other}, hub.subscribers("request:r1"))
+
+	hub.unregister(conn)
+	assert.Equal(t, []*Conn{other}, hub.subscribers("request:r1"))
+
+	// A closed connection is not subscribed again
+	hub.Subscribe(conn, "entity:e1")
+	assert.Empty(t, hub.subscribers("entity:e1"))
+}
+
+func TestHubCloseStopsDelivery(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run()
+		close(stopped)
+	}()
+	hub.Close()
+	hub.Close()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after Close")
+	}
+}
+
+func TestShardSubscribeWhileDispatching(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	s := hub.shards[0]
+
+	// Readers look a channel up until it is first subscribed to, like the
+	// shard worker dispatching an event for it, and must never find it
+	// without its subscriber list
+	const channels = 2000
+	for i := 0; i < channels; i++ {
+		channel := fmt.Sprintf("request:r%d", i)
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for len(s.subscribers(channel)) == 0 {
+				}
+			}()
+		}
+		s.add(channel, NewConn(nil, hub, "e1"))
+		wg.Wait()
+		require.Len(t, s.subscribers(channel), 1)
+	}
+}
+
+func TestShardSubscribersWithoutList(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	s := hub.shardFor("request:r1")
+
+	// A channel found before its first subscriber list is published has
+	// no subscribers yet
+	s.channels.Store("request:r1", &channelSubs{conns: map[*Conn]bool{}})
+	assert.NotPanics(t, func() {
+		hub.dispatch(Event{Channel: "request:r1", Message: map[string]interface{}{"type": "request.updated"}})
+	})
+	assert.Empty(t, s.subscribers("request:r1"))
+}
@@ -1,3 +1,4 @@
+-- +goose Up
 -- Enable UUID extension
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
@@ -94,3 +95,10 @@ CREATE TABLE webhooks (
   events TEXT[] NOT NULL DEFAULT ARRAY['request.created','request.answered']
 );
 
+-- +goose Down
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE reminders;
+DROP TABLE responses;
+DROP TABLE requests;
+DROP TABLE flows;
+DROP TABLE entities;
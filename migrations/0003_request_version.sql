@@ -0,0 +1,6 @@
+-- Optimistic concurrency: bumped on every status change or deletion
+-- +goose Up
+ALTER TABLE requests ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN version;
@@ -0,0 +1,6 @@
+-- Field mask applied to the response delivered to callback_url
+-- +goose Up
+ALTER TABLE requests ADD COLUMN callback_fields TEXT[];
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN callback_fields;
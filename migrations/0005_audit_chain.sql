@@ -0,0 +1,27 @@
+-- Hash chain over the audit log: each entry stores the hash of its
+-- predecessor, so rewriting or removing an entry breaks every later hash.
+-- Entries written before this migration have no hash and are not chained.
+-- +goose Up
+ALTER TABLE audit_log ADD COLUMN prev_hash TEXT;
+ALTER TABLE audit_log ADD COLUMN hash TEXT;
+
+CREATE UNIQUE INDEX idx_audit_log_hash ON audit_log(hash);
+
+-- Periodic snapshots of the chain head, also copied to storage
+CREATE TABLE audit_anchors (
+  id BIGSERIAL PRIMARY KEY,
+  anchored_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  entry_id BIGINT NOT NULL REFERENCES audit_log(id),
+  hash TEXT NOT NULL,
+  location TEXT
+);
+
+CREATE TRIGGER audit_anchors_no_update
+  BEFORE UPDATE OR DELETE ON audit_anchors
+  FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- +goose Down
+DROP TABLE audit_anchors;
+DROP INDEX idx_audit_log_hash;
+ALTER TABLE audit_log DROP COLUMN hash;
+ALTER TABLE audit_log DROP COLUMN prev_hash;
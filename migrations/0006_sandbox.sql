@@ -0,0 +1,10 @@
+-- Sandbox entities and their requests are purged automatically after a TTL
+-- +goose Up
+ALTER TABLE entities ADD COLUMN sandbox BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE requests ADD COLUMN sandbox BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_requests_sandbox_created ON requests(created_at) WHERE sandbox;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN sandbox;
+ALTER TABLE entities DROP COLUMN sandbox;
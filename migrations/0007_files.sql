@@ -0,0 +1,21 @@
+-- Uploaded file objects. A row is created when an upload is signed and
+-- completed once the content has been received through the upload proxy.
+-- +goose Up
+CREATE TABLE files (
+  id TEXT PRIMARY KEY, -- ULID
+  object_key TEXT NOT NULL UNIQUE,
+  request_id TEXT REFERENCES requests(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  mime TEXT NOT NULL DEFAULT '',
+  size BIGINT NOT NULL DEFAULT 0,
+  sha256 TEXT,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'uploaded')),
+  created_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  uploaded_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_files_request_id ON files(request_id);
+
+-- +goose Down
+DROP TABLE files;
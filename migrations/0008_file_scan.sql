@@ -0,0 +1,14 @@
+-- Malware scan state of uploaded files. Files uploaded while scanning is
+-- disabled stay at 'none'.
+-- +goose Up
+ALTER TABLE files
+  ADD COLUMN scan_status TEXT NOT NULL DEFAULT 'none'
+    CHECK (scan_status IN ('none', 'pending', 'clean', 'infected', 'error')),
+  ADD COLUMN scan_result TEXT,
+  ADD COLUMN scanned_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE files
+  DROP COLUMN scanned_at,
+  DROP COLUMN scan_result,
+  DROP COLUMN scan_status;
@@ -0,0 +1,13 @@
+-- Resumable (tus) uploads. The declared length, the bytes received so far
+-- and the storage objects holding each received chunk, in order.
+-- +goose Up
+ALTER TABLE files
+  ADD COLUMN upload_length BIGINT,
+  ADD COLUMN upload_offset BIGINT NOT NULL DEFAULT 0,
+  ADD COLUMN upload_parts TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE files
+  DROP COLUMN upload_parts,
+  DROP COLUMN upload_offset,
+  DROP COLUMN upload_length;
@@ -0,0 +1,22 @@
+-- Orphaned file collection. A file is kept once a response references it;
+-- until then it expires and is garbage-collected.
+-- +goose Up
+ALTER TABLE files
+  ADD COLUMN response_id TEXT REFERENCES responses(id) ON DELETE SET NULL,
+  ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- Link files already referenced by a response (their URL ends with the key)
+UPDATE files f
+SET response_id = r.id
+FROM responses r, jsonb_array_elements(r.files) e
+WHERE e->>'url' LIKE '%/files/' || f.object_key;
+
+-- Give the remaining files a grace period
+UPDATE files SET expires_at = NOW() + INTERVAL '24 hours' WHERE response_id IS NULL;
+
+CREATE INDEX idx_files_expires_at ON files(expires_at) WHERE response_id IS NULL;
+
+-- +goose Down
+ALTER TABLE files
+  DROP COLUMN expires_at,
+  DROP COLUMN response_id;
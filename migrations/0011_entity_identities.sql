@@ -0,0 +1,15 @@
+-- Identities at external OpenID Connect providers linked to entities, so a
+-- login without an entity claim maps to the same entity every time
+-- +goose Up
+CREATE TABLE entity_identities (
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_entity_identities_entity ON entity_identities(entity_id);
+
+-- +goose Down
+DROP TABLE entity_identities;
@@ -0,0 +1,7 @@
+-- When the target entity's client first acknowledged receiving a request,
+-- as opposed to read_at, which records that it was opened
+-- +goose Up
+ALTER TABLE requests ADD COLUMN delivered_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN delivered_at;
@@ -0,0 +1,27 @@
+-- Clarification thread between the requestor and the target entity of a
+-- request
+-- +goose Up
+CREATE TABLE request_comments (
+  id TEXT PRIMARY KEY, -- ULID
+  request_id TEXT NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+  author TEXT NOT NULL,
+  author_role TEXT NOT NULL CHECK (author_role IN ('entity', 'requestor')),
+  body TEXT NOT NULL,
+  files JSONB NOT NULL DEFAULT '[]'::JSONB,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_request_comments_request ON request_comments(request_id, created_at);
+
+-- Files attached to a comment are kept like response files
+ALTER TABLE files ADD COLUMN comment_id TEXT REFERENCES request_comments(id) ON DELETE SET NULL;
+
+DROP INDEX idx_files_expires_at;
+CREATE INDEX idx_files_expires_at ON files(expires_at) WHERE response_id IS NULL AND comment_id IS NULL;
+
+-- +goose Down
+DROP INDEX idx_files_expires_at;
+ALTER TABLE files DROP COLUMN comment_id;
+CREATE INDEX idx_files_expires_at ON files(expires_at) WHERE response_id IS NULL;
+
+DROP TABLE request_comments;
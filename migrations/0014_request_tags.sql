@@ -0,0 +1,9 @@
+-- Free-form labels on requests, used to filter inquiries and to build
+-- mailbox folders per entity
+-- +goose Up
+ALTER TABLE requests ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_requests_tags ON requests USING GIN (tags);
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN tags;
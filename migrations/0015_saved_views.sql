@@ -0,0 +1,15 @@
+-- Named inquiry filters saved by an entity, applied with
+-- GET /v1/inquiries?view=<id>
+-- +goose Up
+CREATE TABLE saved_views (
+  id TEXT PRIMARY KEY, -- ULID
+  entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  filter JSONB NOT NULL DEFAULT '{}'::JSONB,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (entity_id, name)
+);
+
+-- +goose Down
+DROP TABLE saved_views;
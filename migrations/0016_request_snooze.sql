@@ -0,0 +1,8 @@
+-- Snoozed inquiries are hidden from default listings until snoozed_until
+-- +goose Up
+ALTER TABLE requests ADD COLUMN snoozed_until TIMESTAMPTZ;
+
+CREATE INDEX idx_requests_snoozed_until ON requests(snoozed_until) WHERE snoozed_until IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN snoozed_until;
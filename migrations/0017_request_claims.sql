@@ -0,0 +1,11 @@
+-- Who holds the claim on a request and until when; an expired claim is
+-- released back to PENDING by the request:unclaim job
+-- +goose Up
+ALTER TABLE requests ADD COLUMN claimed_by TEXT;
+ALTER TABLE requests ADD COLUMN claimed_at TIMESTAMPTZ;
+ALTER TABLE requests ADD COLUMN claim_expires_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN claim_expires_at;
+ALTER TABLE requests DROP COLUMN claimed_at;
+ALTER TABLE requests DROP COLUMN claimed_by;
@@ -0,0 +1,14 @@
+-- Scheduled asynq tasks of a request, by kind, so they can be cancelled
+-- and rescheduled when the request's deadline moves
+-- +goose Up
+CREATE TABLE request_tasks (
+  request_id TEXT NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL, -- e.g. deadline:notify
+  task_id TEXT NOT NULL,
+  process_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (request_id, kind)
+);
+
+-- +goose Down
+DROP TABLE request_tasks;
@@ -0,0 +1,9 @@
+-- Child flows spawned by a step of a parent flow; the parent stays
+-- suspended until the child finishes
+-- +goose Up
+ALTER TABLE flows ADD COLUMN parent_flow_id UUID REFERENCES flows(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_flows_parent ON flows(parent_flow_id) WHERE parent_flow_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE flows DROP COLUMN parent_flow_id;
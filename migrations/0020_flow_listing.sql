@@ -0,0 +1,6 @@
+-- Flow listing pages newest first by (created_at, id)
+-- +goose Up
+CREATE INDEX idx_flows_created ON flows(created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX idx_flows_created;
@@ -0,0 +1,20 @@
+-- Data subject erasure runs. entity_id has no foreign key, so the record and
+-- its report outlive an entity that was hard-deleted.
+-- +goose Up
+CREATE TABLE erasures (
+  id TEXT PRIMARY KEY, -- ULID
+  entity_id UUID NOT NULL,
+  mode TEXT NOT NULL CHECK (mode IN ('anonymize', 'delete')),
+  status TEXT NOT NULL CHECK (status IN ('PENDING', 'RUNNING', 'COMPLETED', 'FAILED')) DEFAULT 'PENDING',
+  requested_by TEXT NOT NULL,
+  report JSONB,
+  error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started_at TIMESTAMPTZ,
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_erasures_entity ON erasures(entity_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE erasures;
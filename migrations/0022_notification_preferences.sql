@@ -0,0 +1,15 @@
+-- How each entity wants to be notified. Entities without a row get the
+-- defaults: every channel, no quiet hours, no digest, UTC.
+-- +goose Up
+CREATE TABLE notification_preferences (
+  entity_id UUID PRIMARY KEY REFERENCES entities(id) ON DELETE CASCADE,
+  channels TEXT[], -- NULL enables every channel
+  quiet_start TEXT, -- Local time of day as HH:MM
+  quiet_end TEXT,
+  timezone TEXT NOT NULL DEFAULT 'UTC',
+  digest TEXT NOT NULL CHECK (digest IN ('off', 'daily', 'weekly')) DEFAULT 'off',
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
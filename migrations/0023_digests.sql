@@ -0,0 +1,11 @@
+-- Digests are sent at digest_at local time, daily or on Mondays;
+-- last_digest_at is the slot of the last digest sent
+-- +goose Up
+ALTER TABLE notification_preferences
+  ADD COLUMN digest_at TEXT NOT NULL DEFAULT '08:00',
+  ADD COLUMN last_digest_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE notification_preferences
+  DROP COLUMN last_digest_at,
+  DROP COLUMN digest_at;
@@ -0,0 +1,33 @@
+-- Daily aggregates for the stats endpoints. They are read instead of the
+-- live tables when STATS_MATERIALIZED is set and refreshed by the worker;
+-- the unique indexes allow REFRESH MATERIALIZED VIEW CONCURRENTLY.
+-- +goose Up
+CREATE MATERIALIZED VIEW request_stats_daily AS
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+       entity_id,
+       status,
+       schema_kind,
+       COUNT(*) AS count,
+       NOW() AS refreshed_at
+FROM requests
+WHERE deleted_at IS NULL AND NOT sandbox
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX idx_request_stats_daily ON request_stats_daily(day, entity_id, status, schema_kind);
+
+CREATE MATERIALIZED VIEW flow_stats_daily AS
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+       kind,
+       owner_entity,
+       status,
+       COUNT(*) AS count,
+       COALESCE(SUM(EXTRACT(EPOCH FROM updated_at - created_at)) FILTER (WHERE status = 'COMPLETED'), 0)::float8 AS completed_seconds,
+       NOW() AS refreshed_at
+FROM flows
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX idx_flow_stats_daily ON flow_stats_daily(day, kind, owner_entity, status);
+
+-- +goose Down
+DROP MATERIALIZED VIEW flow_stats_daily;
+DROP MATERIALIZED VIEW request_stats_daily;
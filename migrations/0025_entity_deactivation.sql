@@ -0,0 +1,10 @@
+-- Deactivated entities keep their history but receive no new requests
+-- +goose Up
+ALTER TABLE entities ADD COLUMN deactivated_at TIMESTAMPTZ;
+
+-- Entity listing pages newest first, optionally by kind
+CREATE INDEX idx_entities_kind_created ON entities(kind, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX idx_entities_kind_created;
+ALTER TABLE entities DROP COLUMN deactivated_at;
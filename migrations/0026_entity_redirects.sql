@@ -0,0 +1,16 @@
+-- Entities merged into another one. The source entity is deleted; its ID
+-- and handle keep resolving to the target through this table.
+-- +goose Up
+CREATE TABLE entity_redirects (
+  source_id UUID PRIMARY KEY,
+  source_handle TEXT,
+  target_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+  merged_by TEXT NOT NULL,
+  merged_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_entity_redirects_target ON entity_redirects(target_id);
+CREATE INDEX idx_entity_redirects_handle ON entity_redirects(source_handle) WHERE source_handle IS NOT NULL;
+
+-- +goose Down
+DROP TABLE entity_redirects;
@@ -0,0 +1,13 @@
+-- Handler URLs of bot entities. Requests addressed to a bot with a handler
+-- are pushed to it, and the handler can answer them in its reply.
+-- +goose Up
+CREATE TABLE bot_handlers (
+  entity_id UUID PRIMARY KEY REFERENCES entities(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL, -- Signs the pushed requests like callbacks
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE bot_handlers;
@@ -0,0 +1,45 @@
+-- Webhook subscriptions. Events published on channel (requestor:<clientId>
+-- or entity:<entityId>) whose type matches one of event_types are posted
+-- to url, signed with secret and, until it expires after a rotation, also
+-- with previous_secret.
+-- +goose Up
+-- 0001 created an unused placeholder under the same name
+DROP TABLE IF EXISTS webhooks;
+
+CREATE TABLE webhooks (
+  id TEXT PRIMARY KEY, -- ULID
+  channel TEXT NOT NULL,
+  url TEXT NOT NULL,
+  event_types TEXT[] NOT NULL, -- e.g. request.*, flow.completed
+  secret TEXT NOT NULL,
+  previous_secret TEXT,
+  previous_secret_expires_at TIMESTAMPTZ,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhooks_channel ON webhooks(channel) WHERE active;
+
+-- One row per event delivered to a webhook, updated on every attempt
+CREATE TABLE webhook_deliveries (
+  id TEXT PRIMARY KEY, -- ULID
+  webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_type TEXT NOT NULL,
+  event JSONB NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('PENDING', 'DELIVERED', 'FAILED')) DEFAULT 'PENDING',
+  attempts INT NOT NULL DEFAULT 0,
+  response_status INT,
+  error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_attempt_at TIMESTAMPTZ,
+  delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+CREATE INDEX idx_webhook_deliveries_request ON webhook_deliveries((event->>'requestId'));
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
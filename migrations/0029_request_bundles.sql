@@ -0,0 +1,26 @@
+-- Bundles group several requests to the same entity into one logical
+-- packet, e.g. an onboarding made of an ID form, a bank form and a
+-- contract. A bundle is complete once all of its requests are answered.
+-- +goose Up
+CREATE TABLE request_bundles (
+  id TEXT PRIMARY KEY, -- ULID
+  entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+  created_by TEXT NOT NULL, -- requestor client_id
+  title TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_request_bundles_entity ON request_bundles(entity_id, created_at DESC);
+
+CREATE TABLE bundle_requests (
+  request_id TEXT PRIMARY KEY REFERENCES requests(id) ON DELETE CASCADE,
+  bundle_id TEXT NOT NULL REFERENCES request_bundles(id) ON DELETE CASCADE,
+  position INT NOT NULL
+);
+
+CREATE INDEX idx_bundle_requests_bundle ON bundle_requests(bundle_id, position);
+
+-- +goose Down
+DROP TABLE bundle_requests;
+DROP TABLE request_bundles;
@@ -0,0 +1,8 @@
+-- Requests may name the language they are written in. Schemas and UI
+-- hints carry "x-i18n" bundles with translations; the locale is the
+-- fallback when a reader asks for a language the bundles don't cover.
+-- +goose Up
+ALTER TABLE requests ADD COLUMN locale TEXT;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN locale;
@@ -0,0 +1,8 @@
+-- The requestor's timezone, an IANA name such as "Europe/Prague".
+-- Deadlines and attention times are stored in UTC; listings also render
+-- them in this zone so every client shows the same local time.
+-- +goose Up
+ALTER TABLE requests ADD COLUMN timezone TEXT;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN timezone;
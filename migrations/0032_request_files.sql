@@ -0,0 +1,23 @@
+-- Files the requestor attaches to a request, e.g. instructions or the
+-- original invoice, in the order given. The uploaded files they point to
+-- are kept from garbage collection while the request exists.
+-- +goose Up
+CREATE TABLE request_files (
+  request_id TEXT NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  file JSONB NOT NULL, -- name, url, mime, size as in response files
+  PRIMARY KEY (request_id, position)
+);
+
+ALTER TABLE files ADD COLUMN attached_request_id TEXT REFERENCES requests(id) ON DELETE SET NULL;
+
+DROP INDEX idx_files_expires_at;
+CREATE INDEX idx_files_expires_at ON files(expires_at)
+  WHERE response_id IS NULL AND comment_id IS NULL AND attached_request_id IS NULL;
+
+-- +goose Down
+DROP INDEX idx_files_expires_at;
+ALTER TABLE files DROP COLUMN attached_request_id;
+CREATE INDEX idx_files_expires_at ON files(expires_at) WHERE response_id IS NULL AND comment_id IS NULL;
+
+DROP TABLE request_files;
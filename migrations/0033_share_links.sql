@@ -0,0 +1,19 @@
+-- Public answer links. The requestor shares a link with an external party
+-- who has no pxbox account; it can be used once, until it expires, and
+-- the party answering is recorded as an ad-hoc entity.
+-- +goose Up
+CREATE TABLE share_links (
+  id TEXT PRIMARY KEY, -- ULID
+  token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the token, which is not stored
+  request_id TEXT NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+  created_by TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  used_by UUID REFERENCES entities(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_share_links_request ON share_links(request_id);
+
+-- +goose Down
+DROP TABLE share_links;
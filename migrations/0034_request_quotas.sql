@@ -0,0 +1,8 @@
+-- Supports the per-requestor quota counts checked when creating requests
+-- +goose Up
+CREATE INDEX idx_requests_created_by_created_at ON requests(created_by, created_at);
+CREATE INDEX idx_requests_created_by_open ON requests(created_by) WHERE status IN ('PENDING', 'CLAIMED') AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_requests_created_by_open;
+DROP INDEX idx_requests_created_by_created_at;
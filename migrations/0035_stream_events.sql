@@ -0,0 +1,32 @@
+-- Event replay for EVENT_BACKEND=postgres, in place of Redis Streams. Each
+-- channel numbers its events from its row in stream_sequences; live
+-- delivery between instances uses NOTIFY on the pxbox_events channel.
+-- +goose Up
+CREATE TABLE stream_sequences (
+  channel TEXT PRIMARY KEY,
+  seq BIGINT NOT NULL
+);
+
+CREATE TABLE stream_events (
+  channel TEXT NOT NULL,
+  seq BIGINT NOT NULL,
+  event JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (channel, seq)
+);
+
+CREATE INDEX idx_stream_events_created_at ON stream_events(created_at);
+
+-- Last sequence acknowledged per channel and WebSocket connection
+CREATE TABLE stream_acks (
+  channel TEXT NOT NULL,
+  connection_id TEXT NOT NULL,
+  seq BIGINT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (channel, connection_id)
+);
+
+-- +goose Down
+DROP TABLE stream_acks;
+DROP TABLE stream_events;
+DROP TABLE stream_sequences;
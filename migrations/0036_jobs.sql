@@ -0,0 +1,27 @@
+-- Background job queue for JOB_BACKEND=postgres, in place of asynq on
+-- Redis. Jobs are pending until their run_at, active while a worker holds
+-- them until locked_until, and archived once they exhaust their retries.
+-- Completed jobs are deleted.
+-- +goose Up
+CREATE TABLE jobs (
+  id TEXT PRIMARY KEY,
+  queue TEXT NOT NULL,
+  type TEXT NOT NULL,
+  payload BYTEA NOT NULL,
+  state TEXT NOT NULL DEFAULT 'pending',
+  run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  retried INT NOT NULL DEFAULT 0,
+  max_retry INT NOT NULL,
+  locked_until TIMESTAMPTZ,
+  last_error TEXT,
+  last_failed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT jobs_state_check CHECK (state IN ('pending', 'active', 'archived'))
+);
+
+CREATE INDEX idx_jobs_due ON jobs(run_at) WHERE state = 'pending';
+CREATE INDEX idx_jobs_locked ON jobs(locked_until) WHERE state = 'active';
+CREATE INDEX idx_jobs_archived ON jobs(last_failed_at DESC) WHERE state = 'archived';
+
+-- +goose Down
+DROP TABLE jobs;
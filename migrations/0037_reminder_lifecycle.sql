@@ -0,0 +1,24 @@
+-- Reminders remember their scheduled job, so they can be cancelled, and
+-- when they were delivered. A request has at most one pending reminder
+-- per entity: snoozing again replaces it.
+-- +goose Up
+ALTER TABLE reminders ADD COLUMN task_id TEXT;
+ALTER TABLE reminders ADD COLUMN delivered_at TIMESTAMPTZ;
+
+-- Reminders already due were delivered before delivery was recorded
+UPDATE reminders SET delivered_at = remind_at WHERE remind_at <= NOW();
+
+-- Keep only the latest pending reminder of each request and entity; the
+-- jobs of the others find no reminder and do nothing
+DELETE FROM reminders r USING reminders newer
+WHERE r.delivered_at IS NULL AND newer.delivered_at IS NULL
+  AND r.request_id = newer.request_id AND r.entity_id = newer.entity_id
+  AND (r.created_at, r.id) < (newer.created_at, newer.id);
+
+CREATE UNIQUE INDEX idx_reminders_pending ON reminders(request_id, entity_id) WHERE delivered_at IS NULL;
+
+-- +goose Down
+-- Replaced reminders are not restored
+DROP INDEX idx_reminders_pending;
+ALTER TABLE reminders DROP COLUMN delivered_at;
+ALTER TABLE reminders DROP COLUMN task_id;
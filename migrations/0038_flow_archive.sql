@@ -0,0 +1,59 @@
+-- Finished flows are archived by the worker some time after they finish;
+-- archived_status keeps how they finished. Deleted flows are hidden from
+-- the API and listings but kept for the audit trail.
+-- +goose Up
+ALTER TABLE flows DROP CONSTRAINT flows_status_check;
+ALTER TABLE flows ADD CONSTRAINT flows_status_check
+  CHECK (status IN ('RUNNING','SUSPENDED','WAITING_INPUT','COMPLETED','CANCELLED','FAILED','ARCHIVED'));
+ALTER TABLE flows ADD COLUMN archived_status TEXT;
+ALTER TABLE flows ADD COLUMN archived_at TIMESTAMPTZ;
+ALTER TABLE flows ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Recovery and the ticker scan flows by status, so archived flows do not
+-- slow them down however many there are
+CREATE INDEX idx_flows_live ON flows(status, updated_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_flows_finished ON flows(updated_at, id)
+  WHERE status IN ('COMPLETED','CANCELLED','FAILED') AND deleted_at IS NULL;
+
+-- Archived flows count under the status they finished with
+DROP MATERIALIZED VIEW flow_stats_daily;
+CREATE MATERIALIZED VIEW flow_stats_daily AS
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+       kind,
+       owner_entity,
+       COALESCE(archived_status, status) AS status,
+       COUNT(*) AS count,
+       COALESCE(SUM(EXTRACT(EPOCH FROM updated_at - created_at)) FILTER (WHERE COALESCE(archived_status, status) = 'COMPLETED'), 0)::float8 AS completed_seconds,
+       NOW() AS refreshed_at
+FROM flows
+WHERE deleted_at IS NULL
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX idx_flow_stats_daily ON flow_stats_daily(day, kind, owner_entity, status);
+
+-- +goose Down
+DROP MATERIALIZED VIEW flow_stats_daily;
+CREATE MATERIALIZED VIEW flow_stats_daily AS
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+       kind,
+       owner_entity,
+       status,
+       COUNT(*) AS count,
+       COALESCE(SUM(EXTRACT(EPOCH FROM updated_at - created_at)) FILTER (WHERE status = 'COMPLETED'), 0)::float8 AS completed_seconds,
+       NOW() AS refreshed_at
+FROM flows
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX idx_flow_stats_daily ON flow_stats_daily(day, kind, owner_entity, status);
+
+DROP INDEX idx_flows_finished;
+DROP INDEX idx_flows_live;
+UPDATE flows SET status = archived_status WHERE status = 'ARCHIVED';
+-- Deleted flows would reappear without the column
+DELETE FROM flows WHERE deleted_at IS NOT NULL;
+ALTER TABLE flows DROP COLUMN deleted_at;
+ALTER TABLE flows DROP COLUMN archived_at;
+ALTER TABLE flows DROP COLUMN archived_status;
+ALTER TABLE flows DROP CONSTRAINT flows_status_check;
+ALTER TABLE flows ADD CONSTRAINT flows_status_check
+  CHECK (status IN ('RUNNING','SUSPENDED','WAITING_INPUT','COMPLETED','CANCELLED','FAILED'));
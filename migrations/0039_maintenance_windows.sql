@@ -0,0 +1,23 @@
+-- Maintenance windows put an entity away for a time range. Requests created
+-- during one are still queued, but marked deferred_until its end; with
+-- pause_deadlines their deadlines move out by the rest of the window.
+-- +goose Up
+CREATE TABLE maintenance_windows (
+  id TEXT PRIMARY KEY, -- ULID
+  entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+  starts_at TIMESTAMPTZ NOT NULL,
+  ends_at TIMESTAMPTZ NOT NULL,
+  pause_deadlines BOOLEAN NOT NULL DEFAULT FALSE,
+  reason TEXT,
+  created_by TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_maintenance_windows_entity ON maintenance_windows(entity_id, ends_at);
+
+ALTER TABLE requests ADD COLUMN deferred_until TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE requests DROP COLUMN deferred_until;
+DROP TABLE maintenance_windows;
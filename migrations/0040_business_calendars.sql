@@ -0,0 +1,16 @@
+-- Business calendars set the working hours and holidays deadlines given
+-- in business days or hours are counted in. Entities without one use
+-- Monday to Friday, 09:00 to 17:00 UTC.
+-- +goose Up
+CREATE TABLE business_calendars (
+  entity_id UUID PRIMARY KEY REFERENCES entities(id) ON DELETE CASCADE,
+  timezone TEXT NOT NULL DEFAULT 'UTC',
+  work_days TEXT[] NOT NULL, -- mon to sun
+  work_start TEXT NOT NULL, -- Local time of day as HH:MM
+  work_end TEXT NOT NULL,
+  holidays TEXT[] NOT NULL DEFAULT '{}', -- Local dates as YYYY-MM-DD
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE business_calendars;
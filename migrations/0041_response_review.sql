@@ -0,0 +1,23 @@
+-- Requestors may review answers: ACCEPTED and REJECTED requests, and the
+-- review of the response it applies to. A rejected request may be reopened
+-- to PENDING, keeping the rejected response.
+-- +goose Up
+ALTER TABLE requests DROP CONSTRAINT requests_status_check;
+ALTER TABLE requests ADD CONSTRAINT requests_status_check
+  CHECK (status IN ('PENDING','CLAIMED','ANSWERED','CANCELLED','EXPIRED','ACCEPTED','REJECTED'));
+
+ALTER TABLE responses ADD COLUMN review TEXT CHECK (review IN ('ACCEPTED','REJECTED'));
+ALTER TABLE responses ADD COLUMN review_reason TEXT;
+ALTER TABLE responses ADD COLUMN reviewed_by TEXT;
+ALTER TABLE responses ADD COLUMN reviewed_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE responses DROP COLUMN reviewed_at;
+ALTER TABLE responses DROP COLUMN reviewed_by;
+ALTER TABLE responses DROP COLUMN review_reason;
+ALTER TABLE responses DROP COLUMN review;
+
+UPDATE requests SET status = 'ANSWERED' WHERE status IN ('ACCEPTED','REJECTED');
+ALTER TABLE requests DROP CONSTRAINT requests_status_check;
+ALTER TABLE requests ADD CONSTRAINT requests_status_check
+  CHECK (status IN ('PENDING','CLAIMED','ANSWERED','CANCELLED','EXPIRED'));
@@ -0,0 +1,12 @@
+-- Calendar feeds let an entity subscribe to its deadlines from a calendar
+-- client, which cannot send an Authorization header. The feed URL carries
+-- a long-lived token, stored as its SHA-256 hash; one per entity.
+-- +goose Up
+CREATE TABLE calendar_feeds (
+  entity_id UUID PRIMARY KEY REFERENCES entities(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE calendar_feeds;
@@ -0,0 +1,19 @@
+-- Devices are the mobile apps of an entity that get push notifications,
+-- by their FCM registration token or APNs device token. A token belongs to
+-- one entity; registering it again moves it.
+-- +goose Up
+CREATE TABLE devices (
+  id TEXT PRIMARY KEY,
+  entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+  platform TEXT NOT NULL CHECK (platform IN ('fcm', 'apns')),
+  token TEXT NOT NULL,
+  name TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (platform, token)
+);
+
+CREATE INDEX idx_devices_entity ON devices(entity_id);
+
+-- +goose Down
+DROP TABLE devices;
@@ -0,0 +1,15 @@
+-- Telegram chats entities get notifications in and answer from. An entity
+-- links its chat by sending a short-lived link code to the bot; a chat
+-- belongs to one entity.
+-- +goose Up
+CREATE TABLE telegram_chats (
+  entity_id UUID PRIMARY KEY REFERENCES entities(id) ON DELETE CASCADE,
+  chat_id BIGINT UNIQUE,            -- Set once the link code was sent to the bot
+  code_hash TEXT UNIQUE,            -- SHA-256 of the pending link code
+  code_expires_at TIMESTAMPTZ,
+  linked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE telegram_chats;
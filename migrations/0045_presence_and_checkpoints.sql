@@ -0,0 +1,28 @@
+-- Presence and task checkpoints on Postgres, for deployments running
+-- without Redis (EVENT_BACKEND=postgres and JOB_BACKEND=postgres). Each API
+-- instance holds a lease per connected entity, dropped once it lapses.
+-- +goose Up
+CREATE TABLE presence_leases (
+  entity_id TEXT NOT NULL,
+  instance TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (entity_id, instance)
+);
+
+CREATE TABLE presence_last_seen (
+  entity_id TEXT PRIMARY KEY,
+  last_seen_at TIMESTAMPTZ NOT NULL
+);
+
+-- Progress of interrupted singleton tasks such as flow recovery; expired
+-- rows are ignored and replaced by the next save
+CREATE TABLE checkpoints (
+  key TEXT PRIMARY KEY,
+  progress JSONB NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE checkpoints;
+DROP TABLE presence_last_seen;
+DROP TABLE presence_leases;
@@ -0,0 +1,12 @@
+-- When the flow ticker last looked at a flow that was still waiting, so the
+-- next scans skip it until staleAfter has passed again instead of
+-- re-checking the whole backlog every interval.
+-- +goose Up
+ALTER TABLE flows ADD COLUMN checked_at TIMESTAMPTZ;
+
+CREATE INDEX idx_flows_due ON flows ((COALESCE(checked_at, updated_at)))
+  WHERE status IN ('RUNNING', 'SUSPENDED') AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_flows_due;
+ALTER TABLE flows DROP COLUMN checked_at;
@@ -0,0 +1,12 @@
+// Package migrations holds the goose migrations of the database schema.
+// They are embedded in the binaries, so running them needs no migrations
+// directory on disk.
+package migrations
+
+import "embed"
+
+// FS holds the migrations as NNNN_name.sql files, each with goose Up and
+// Down sections
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,41 @@
+package migrations_test
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"pxbox/migrations"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	names, err := fs.Glob(migrations.FS, "*.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, names)
+
+	for i, name := range names {
+		data, err := fs.ReadFile(migrations.FS, name)
+		require.NoError(t, err)
+		sql := string(data)
+
+		// Versions are numbered without gaps, so a missing file shows
+		assert.True(t, strings.HasPrefix(name, fmt.Sprintf("%04d_", i+1)), name)
+
+		up := strings.Index(sql, "-- +goose Up\n")
+		down := strings.Index(sql, "-- +goose Down\n")
+		require.True(t, up >= 0 && down > up, "%s needs Up then Down sections", name)
+		assert.Equal(t, 1, strings.Count(sql, "-- +goose Up"), name)
+		assert.Equal(t, 1, strings.Count(sql, "-- +goose Down"), name)
+		assert.NotEmpty(t, strings.TrimSpace(sql[down+len("-- +goose Down\n"):]), "%s has an empty Down section", name)
+
+		// Dollar-quoted bodies contain semicolons and must not be split
+		if strings.Contains(sql, "$$") {
+			assert.Contains(t, sql, "-- +goose StatementBegin", name)
+		}
+		assert.Equal(t, strings.Count(sql, "-- +goose StatementBegin"), strings.Count(sql, "-- +goose StatementEnd"), name)
+	}
+}
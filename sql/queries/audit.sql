@@ -0,0 +1,52 @@
+-- name: InsertAuditEntry :exec
+INSERT INTO audit_log (occurred_at, actor, action, resource_type, resource_id,
+                       before_status, after_status, ip, meta, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: LockAuditChain :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_log'));
+
+-- name: GetAuditChainHead :one
+SELECT id, occurred_at, actor, action, resource_type, resource_id,
+       before_status, after_status, ip, meta, prev_hash, hash
+FROM audit_log
+WHERE hash IS NOT NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAuditChain :many
+SELECT id, occurred_at, actor, action, resource_type, resource_id,
+       before_status, after_status, ip, meta, prev_hash, hash
+FROM audit_log
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: ListAuditEntries :many
+SELECT id, occurred_at, actor, action, resource_type, resource_id,
+       before_status, after_status, ip, meta, prev_hash, hash
+FROM audit_log
+WHERE ($1::text IS NULL OR actor = $1)
+  AND ($2::text IS NULL OR action = $2)
+  AND ($3::text IS NULL OR resource_type = $3)
+  AND ($4::text IS NULL OR resource_id = $4)
+  AND ($5::timestamptz IS NULL OR occurred_at >= $5)
+  AND ($6::timestamptz IS NULL OR occurred_at < $6)
+ORDER BY occurred_at DESC, id DESC
+LIMIT $7 OFFSET $8;
+
+-- name: InsertAuditAnchor :one
+INSERT INTO audit_anchors (entry_id, hash, location)
+VALUES ($1, $2, $3)
+RETURNING id, anchored_at, entry_id, hash, location;
+
+-- name: GetLatestAuditAnchor :one
+SELECT id, anchored_at, entry_id, hash, location
+FROM audit_anchors
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAuditAnchors :many
+SELECT id, anchored_at, entry_id, hash, location
+FROM audit_anchors
+ORDER BY id;
@@ -0,0 +1,12 @@
+-- name: UpsertBotHandler :one
+INSERT INTO bot_handlers (entity_id, url, secret)
+VALUES ($1, $2, $3)
+ON CONFLICT (entity_id) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, updated_at = NOW()
+RETURNING entity_id, url, secret, created_at, updated_at;
+
+-- name: GetBotHandler :one
+SELECT entity_id, url, secret, created_at, updated_at
+FROM bot_handlers WHERE entity_id = $1;
+
+-- name: DeleteBotHandler :execrows
+DELETE FROM bot_handlers WHERE entity_id = $1;
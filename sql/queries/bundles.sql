@@ -0,0 +1,34 @@
+-- name: CreateBundle :one
+INSERT INTO request_bundles (id, entity_id, created_by, title)
+VALUES ($1, $2, $3, $4)
+RETURNING id, entity_id, created_by, title, created_at, completed_at;
+
+-- name: AddBundleRequests :exec
+INSERT INTO bundle_requests (request_id, bundle_id, position)
+SELECT request_id, $1::text, position::int - 1
+FROM unnest($2::text[]) WITH ORDINALITY AS ids(request_id, position);
+
+-- name: GetBundle :one
+SELECT id, entity_id, created_by, title, created_at, completed_at
+FROM request_bundles WHERE id = $1;
+
+-- name: ListBundleItems :many
+SELECT br.request_id, r.status
+FROM bundle_requests br
+JOIN requests r ON r.id = br.request_id
+WHERE br.bundle_id = $1 AND r.deleted_at IS NULL
+ORDER BY br.position;
+
+-- name: GetRequestBundleIDs :many
+SELECT request_id, bundle_id FROM bundle_requests WHERE request_id = ANY($1);
+
+-- name: CompleteRequestBundle :one
+UPDATE request_bundles b SET completed_at = NOW()
+FROM bundle_requests br
+WHERE br.request_id = $1 AND b.id = br.bundle_id AND b.completed_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM bundle_requests o
+    JOIN requests r ON r.id = o.request_id
+    WHERE o.bundle_id = b.id AND r.status <> 'ANSWERED'
+  )
+RETURNING b.id, b.entity_id, b.created_by, b.title, b.created_at, b.completed_at;
@@ -0,0 +1,11 @@
+-- name: CreateComment :one
+INSERT INTO request_comments (id, request_id, author, author_role, body, files)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, request_id, author, author_role, body, files, created_at;
+
+-- name: ListComments :many
+SELECT id, request_id, author, author_role, body, files, created_at
+FROM request_comments
+WHERE request_id = $1
+ORDER BY created_at ASC, id ASC
+LIMIT $2 OFFSET $3;
@@ -0,0 +1,25 @@
+-- name: ListDigestSubscribers :many
+SELECT entity_id, last_digest_at, channels, quiet_start, quiet_end, timezone, digest, digest_at, updated_at
+FROM notification_preferences
+WHERE digest <> 'off'
+ORDER BY entity_id;
+
+-- name: MarkDigestScheduled :execrows
+UPDATE notification_preferences SET last_digest_at = $2
+WHERE entity_id = $1 AND (last_digest_at IS NULL OR last_digest_at < $2);
+
+-- name: ListDigestItems :many
+SELECT id, COALESCE(schema_payload->>'title', ''), created_by,
+       CASE
+           WHEN COALESCE(deadline_at, expires_at) < NOW() OR attention_at < NOW() THEN 'overdue'
+           WHEN COALESCE(deadline_at, expires_at) < $3 THEN 'expiring'
+           ELSE 'new'
+       END,
+       created_at, COALESCE(deadline_at, expires_at)
+FROM requests
+WHERE entity_id = $1 AND deleted_at IS NULL AND status IN ('PENDING', 'CLAIMED')
+  AND (snoozed_until IS NULL OR snoozed_until <= NOW())
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND (created_at >= $2 OR COALESCE(deadline_at, expires_at) < $3 OR attention_at < NOW())
+ORDER BY COALESCE(deadline_at, expires_at) ASC NULLS LAST, created_at ASC
+LIMIT $4;
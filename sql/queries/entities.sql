@@ -1,15 +1,36 @@
 -- name: GetEntityByID :one
-SELECT id, kind, handle, meta, created_at
+SELECT id, kind, handle, meta, created_at, sandbox, deactivated_at
 FROM entities
 WHERE id = $1;
 
 -- name: GetEntityByHandle :one
-SELECT id, kind, handle, meta, created_at
+SELECT id, kind, handle, meta, created_at, sandbox, deactivated_at
 FROM entities
 WHERE handle = $1;
 
 -- name: CreateEntity :one
-INSERT INTO entities (kind, handle, meta)
-VALUES ($1, $2, $3)
-RETURNING id, kind, handle, meta, created_at;
+INSERT INTO entities (kind, handle, meta, sandbox)
+VALUES ($1, NULLIF($2, ''), $3, $4)
+RETURNING id, kind, handle, meta, created_at, sandbox, deactivated_at;
 
+-- name: UpdateEntity :one
+UPDATE entities
+SET handle = COALESCE($2, handle),
+    meta = meta || COALESCE($3::jsonb, '{}'::jsonb)
+WHERE id = $1
+RETURNING id, kind, handle, meta, created_at, sandbox, deactivated_at;
+
+-- name: ListEntities :many
+SELECT id, kind, handle, meta, created_at, sandbox, deactivated_at
+FROM entities
+WHERE ($1::text IS NULL OR kind = $1)
+  AND ($2::text IS NULL OR handle LIKE $2)
+  AND ($3::boolean OR deactivated_at IS NULL)
+ORDER BY created_at DESC, id DESC
+LIMIT $4 OFFSET $5;
+
+-- name: SetEntityDeactivated :one
+UPDATE entities
+SET deactivated_at = CASE WHEN $2::timestamptz IS NULL THEN NULL ELSE COALESCE(deactivated_at, $2) END
+WHERE id = $1
+RETURNING id, kind, handle, meta, created_at, sandbox, deactivated_at;
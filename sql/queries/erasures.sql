@@ -0,0 +1,101 @@
+-- name: CreateErasure :one
+INSERT INTO erasures (id, entity_id, mode, requested_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, entity_id, mode, status, requested_by, report, error, created_at, started_at, completed_at;
+
+-- name: GetErasure :one
+SELECT id, entity_id, mode, status, requested_by, report, error, created_at, started_at, completed_at
+FROM erasures WHERE id = $1;
+
+-- name: StartErasure :one
+UPDATE erasures SET status = 'RUNNING', started_at = NOW()
+WHERE id = $1 AND status IN ('PENDING', 'RUNNING', 'FAILED')
+RETURNING id, entity_id, mode, status, requested_by, report, error, created_at, started_at, completed_at;
+
+-- name: FinishErasure :exec
+UPDATE erasures SET status = $2, report = $3, error = $4, completed_at = NOW()
+WHERE id = $1;
+
+-- name: GetErasureTargets :one
+WITH reqs AS (
+    SELECT id, created_by FROM requests WHERE entity_id = $1
+    UNION
+    SELECT r.id, r.created_by FROM requests r
+    JOIN responses resp ON resp.request_id = r.id
+    WHERE resp.answered_by = $1
+), resps AS (
+    SELECT id, files FROM responses
+    WHERE answered_by = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1)
+), comments AS (
+    SELECT id, files FROM request_comments
+    WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1)
+)
+SELECT
+    COALESCE((SELECT array_agg(id) FROM reqs), '{}'),
+    COALESCE((SELECT array_agg(DISTINCT created_by) FROM reqs), '{}'),
+    COALESCE((
+        SELECT array_agg(object_key) FROM files
+        WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1)
+           OR response_id IN (SELECT id FROM resps)
+           OR comment_id IN (SELECT id FROM comments)
+    ), '{}'),
+    COALESCE((
+        SELECT jsonb_agg(f) FROM (
+            SELECT f FROM resps, jsonb_array_elements(resps.files) f
+            UNION ALL
+            SELECT f FROM comments, jsonb_array_elements(comments.files) f
+        ) attached
+    ), '[]'::jsonb);
+
+-- name: DeleteErasedFiles :execrows
+DELETE FROM files WHERE object_key = ANY($1);
+
+-- name: DeleteEntityWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries
+WHERE event->>'entityId' = $2
+   OR event->>'requestId' IN (
+    SELECT id FROM requests WHERE entity_id = $1
+    UNION SELECT request_id FROM responses WHERE answered_by = $1
+  );
+
+-- name: DeleteEntityReminders :execrows
+DELETE FROM reminders
+WHERE entity_id = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1);
+
+-- name: DeleteEntityComments :execrows
+DELETE FROM request_comments
+WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1);
+
+-- name: DeleteEntityResponses :execrows
+DELETE FROM responses
+WHERE answered_by = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1);
+
+-- name: DeleteEntityIdentities :execrows
+DELETE FROM entity_identities WHERE entity_id = $1;
+
+-- name: DeleteEntityRequests :execrows
+DELETE FROM requests WHERE entity_id = $1;
+
+-- name: DeleteEntity :execrows
+DELETE FROM entities WHERE id = $1;
+
+-- name: AnonymizeEntityComments :execrows
+UPDATE request_comments SET body = '', files = '[]'::jsonb
+WHERE request_id IN (SELECT id FROM requests WHERE entity_id = $1);
+
+-- name: AnonymizeEntityResponses :execrows
+UPDATE responses SET payload = '{}'::jsonb, files = '[]'::jsonb, signature_jws = NULL
+WHERE answered_by = $1 OR request_id IN (SELECT id FROM requests WHERE entity_id = $1);
+
+-- name: AnonymizeEntityRequests :execrows
+UPDATE requests SET prefill = NULL, tags = '{}', updated_at = NOW()
+WHERE entity_id = $1;
+
+-- name: DeleteEntityPreferences :exec
+DELETE FROM notification_preferences WHERE entity_id = $1;
+
+-- name: AnonymizeEntityRedirects :exec
+UPDATE entity_redirects SET source_handle = NULL WHERE target_id = $1;
+
+-- name: AnonymizeEntity :exec
+UPDATE entities SET handle = NULL, meta = '{}'::jsonb WHERE id = $1;
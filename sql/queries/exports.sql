@@ -0,0 +1,21 @@
+-- name: StreamRequestsWithResponses :many
+SELECT r.id, r.created_by, r.entity_id, r.status, r.schema_kind, r.schema_payload,
+       r.ui_hints, r.prefill, r.expires_at, r.deadline_at, r.attention_at,
+       r.autocancel_grace, r.callback_url, r.callback_secret, r.files_policy,
+       r.flow_id, r.deleted_at, r.read_at, r.delivered_at, r.created_at, r.updated_at, r.version, r.callback_fields, r.sandbox, r.tags, r.snoozed_until, r.claimed_by, r.claimed_at, r.claim_expires_at, r.locale, r.timezone,
+       resp.id, resp.answered_at, resp.answered_by, resp.payload, resp.files
+FROM requests r
+LEFT JOIN LATERAL (
+    SELECT id, answered_at, answered_by, payload, files
+    FROM responses
+    WHERE request_id = r.id
+    ORDER BY answered_at DESC
+    LIMIT 1
+) resp ON TRUE
+WHERE r.deleted_at IS NULL
+  AND ($1::uuid IS NULL OR r.entity_id = $1)
+  AND ($2::text IS NULL OR r.status = $2)
+  AND ($3::text IS NULL OR r.created_by = $3)
+  AND ($4::timestamptz IS NULL OR r.created_at >= $4)
+  AND ($5::timestamptz IS NULL OR r.created_at < $5)
+ORDER BY r.created_at ASC;
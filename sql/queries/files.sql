@@ -0,0 +1,91 @@
+-- name: CreatePendingFile :one
+INSERT INTO files (id, object_key, request_id, name, mime, created_by, upload_length, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (object_key) DO UPDATE
+    SET request_id = EXCLUDED.request_id, name = EXCLUDED.name,
+        mime = EXCLUDED.mime, created_by = EXCLUDED.created_by, created_at = NOW(),
+        expires_at = EXCLUDED.expires_at
+    WHERE files.status = 'pending'
+RETURNING id, object_key, request_id, name, mime, size, sha256, status,
+          created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+          upload_length, upload_offset, upload_parts, response_id, expires_at;
+
+-- name: GetFileByKey :one
+SELECT id, object_key, request_id, name, mime, size, sha256, status,
+       created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+       upload_length, upload_offset, upload_parts, response_id, expires_at
+FROM files
+WHERE object_key = $1;
+
+-- name: GetFileByID :one
+SELECT id, object_key, request_id, name, mime, size, sha256, status,
+       created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+       upload_length, upload_offset, upload_parts, response_id, expires_at
+FROM files
+WHERE id = $1;
+
+-- name: AppendFilePart :one
+UPDATE files
+SET upload_offset = upload_offset + $3, upload_parts = array_append(upload_parts, $4),
+    mime = CASE WHEN $5 = '' THEN mime ELSE $5 END
+WHERE id = $1 AND upload_offset = $2 AND status = 'pending'
+RETURNING id, object_key, request_id, name, mime, size, sha256, status,
+          created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+          upload_length, upload_offset, upload_parts, response_id, expires_at;
+
+-- name: DeleteFile :exec
+DELETE FROM files WHERE id = $1;
+
+-- name: CompleteFileUpload :one
+UPDATE files
+SET status = 'uploaded', mime = $2, size = $3, sha256 = $4, uploaded_at = NOW(), scan_status = $5
+WHERE object_key = $1 AND status = 'pending'
+RETURNING id, object_key, request_id, name, mime, size, sha256, status,
+          created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+          upload_length, upload_offset, upload_parts, response_id, expires_at;
+
+-- name: SumRequestFileSizes :one
+SELECT COALESCE(SUM(size), 0)::bigint
+FROM files
+WHERE request_id = $1 AND status = 'uploaded';
+
+-- name: SetFileScanResult :exec
+UPDATE files SET scan_status = $2, scan_result = $3, scanned_at = NOW() WHERE object_key = $1;
+
+-- name: SetResponseFilePreview :exec
+UPDATE responses
+SET files = (
+    SELECT jsonb_agg(CASE WHEN f->>'url' = $2 THEN f || jsonb_build_object('previewUrl', $3::text) ELSE f END ORDER BY i)
+    FROM jsonb_array_elements(files) WITH ORDINALITY AS t(f, i)
+)
+WHERE id = $1 AND jsonb_array_length(files) > 0;
+
+-- name: AttachFilesToComment :exec
+UPDATE files SET comment_id = $1, expires_at = NULL WHERE object_key = ANY($2);
+
+-- name: AttachFilesToResponse :exec
+UPDATE files SET response_id = $1, expires_at = NULL WHERE object_key = ANY($2);
+
+-- name: ListExpiredFiles :many
+SELECT id, object_key, request_id, name, mime, size, sha256, status,
+       created_by, created_at, uploaded_at, scan_status, scan_result, scanned_at,
+       upload_length, upload_offset, upload_parts, response_id, expires_at
+FROM files
+WHERE response_id IS NULL AND comment_id IS NULL AND attached_request_id IS NULL AND (expires_at IS NULL OR expires_at < $1)
+ORDER BY expires_at ASC NULLS FIRST
+LIMIT $2;
+
+-- name: DeleteExpiredFiles :many
+DELETE FROM files WHERE id = ANY($1) AND response_id IS NULL AND comment_id IS NULL AND attached_request_id IS NULL RETURNING id;
+
+-- name: GetStorageUsage :many
+SELECT COALESCE(r.entity_id, ''),
+       COUNT(*),
+       COALESCE(SUM(f.size), 0)::bigint,
+       COUNT(*) FILTER (WHERE f.response_id IS NULL AND f.comment_id IS NULL AND f.attached_request_id IS NULL),
+       COALESCE(SUM(f.size) FILTER (WHERE f.response_id IS NULL AND f.comment_id IS NULL AND f.attached_request_id IS NULL), 0)::bigint
+FROM files f
+LEFT JOIN requests r ON r.id = COALESCE(f.request_id, f.attached_request_id)
+WHERE f.status = 'uploaded' AND ($1 = '' OR r.entity_id = $1)
+GROUP BY 1
+ORDER BY 3 DESC;
@@ -1,10 +1,10 @@
 -- name: CreateFlow :one
-INSERT INTO flows (kind, owner_entity, status, cursor, last_event_id)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, kind, owner_entity, status, cursor, last_event_id, created_at, updated_at;
+INSERT INTO flows (kind, owner_entity, status, cursor, last_event_id, parent_flow_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at;
 
 -- name: GetFlowByID :one
-SELECT id, kind, owner_entity, status, cursor, last_event_id, created_at, updated_at
+SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at
 FROM flows
 WHERE id = $1;
 
@@ -18,8 +18,49 @@ UPDATE flows
 SET cursor = $2, updated_at = NOW()
 WHERE id = $1;
 
+-- name: SetFlowLastEventID :exec
+UPDATE flows
+SET last_event_id = $2
+WHERE id = $1;
+
+-- name: ListChildFlows :many
+SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at
+FROM flows
+WHERE parent_flow_id = $1
+ORDER BY created_at ASC, id ASC;
+
+-- name: LockFlow :exec
+SELECT pg_advisory_xact_lock(hashtext('flow:' || $1));
+
+-- name: ListFlows :many
+SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at
+FROM flows
+WHERE ($1::uuid IS NULL OR owner_entity = $1)
+  AND ($2::text IS NULL OR kind = $2)
+  AND ($3::text IS NULL OR status = $3)
+  AND ($4::timestamptz IS NULL OR created_at > $4)
+  AND ($5::timestamptz IS NULL OR (created_at, id) < ($5, $6::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $7;
+
+-- name: CountFlowsByStatus :many
+SELECT status, COUNT(*)
+FROM flows
+WHERE ($1::uuid IS NULL OR owner_entity = $1)
+  AND ($2::text IS NULL OR kind = $2)
+  AND ($3::timestamptz IS NULL OR created_at > $3)
+GROUP BY status;
+
 -- name: GetRunningFlows :many
-SELECT id, kind, owner_entity, status, cursor, last_event_id, created_at, updated_at
+SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at
 FROM flows
 WHERE status IN ('RUNNING', 'WAITING_INPUT');
 
+
+-- name: GetStaleFlows :many
+SELECT id, kind, owner_entity, status, cursor, last_event_id, parent_flow_id, created_at, updated_at
+FROM flows
+WHERE status = ANY($1::text[]) AND updated_at < $2
+  AND (updated_at, id) > ($3, $4::uuid)
+ORDER BY updated_at ASC, id ASC
+LIMIT $5;
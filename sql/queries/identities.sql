@@ -0,0 +1,15 @@
+-- name: GetEntityIdentity :one
+SELECT entity_id
+FROM entity_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: CreateEntityIdentity :one
+INSERT INTO entity_identities (issuer, subject, entity_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (issuer, subject) DO NOTHING
+RETURNING entity_id;
+
+-- name: CreateProvisionedEntity :one
+INSERT INTO entities (kind, handle, meta)
+VALUES ('user', CASE WHEN EXISTS (SELECT 1 FROM entities WHERE handle = $1) THEN NULL ELSE NULLIF($1, '') END, $2)
+RETURNING id, kind, handle, meta, created_at, sandbox, deactivated_at;
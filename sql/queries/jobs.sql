@@ -0,0 +1,50 @@
+-- name: InsertJob :exec
+INSERT INTO jobs (id, queue, type, payload, run_at, max_retry)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ClaimJob :one
+UPDATE jobs SET
+  state = 'active',
+  retried = CASE WHEN state = 'active' THEN retried + 1 ELSE retried END,
+  locked_until = NOW() + make_interval(secs => $2::bigint / 1000.0)
+WHERE id = (
+  SELECT id FROM jobs
+  WHERE queue = ANY($1::text[])
+    AND ((state = 'pending' AND run_at <= NOW())
+      OR (state = 'active' AND locked_until < NOW()))
+  ORDER BY array_position($1::text[], queue), run_at
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, queue, type, payload, state, run_at, retried, max_retry, last_error, last_failed_at, created_at;
+
+-- name: CompleteJob :exec
+DELETE FROM jobs WHERE id = $1;
+
+-- name: RetryJob :exec
+UPDATE jobs SET state = 'pending', run_at = $2, retried = retried + 1, locked_until = NULL,
+  last_error = $3, last_failed_at = NOW()
+WHERE id = $1;
+
+-- name: ArchiveJob :exec
+UPDATE jobs SET state = 'archived', locked_until = NULL, last_error = $2, last_failed_at = NOW()
+WHERE id = $1;
+
+-- name: CancelJob :execrows
+DELETE FROM jobs WHERE id = $1 AND state = 'pending';
+
+-- name: GetJob :one
+SELECT id, queue, type, payload, state, run_at, retried, max_retry, last_error, last_failed_at, created_at
+FROM jobs WHERE id = $1;
+
+-- name: ListArchivedJobs :many
+SELECT id, queue, type, payload, state, run_at, retried, max_retry, last_error, last_failed_at, created_at
+FROM jobs
+WHERE state = 'archived' AND queue = ANY($1::text[])
+ORDER BY last_failed_at DESC
+LIMIT $2;
+
+-- name: RequeueJob :one
+UPDATE jobs SET state = 'pending', run_at = NOW()
+WHERE id = $1 AND state = 'archived'
+RETURNING id, queue, type, payload, state, run_at, retried, max_retry, last_error, last_failed_at, created_at;
@@ -0,0 +1,66 @@
+-- name: GetMergedEntity :one
+SELECT id, kind, handle, meta, created_at, sandbox, deactivated_at
+FROM entities
+WHERE id = (SELECT target_id FROM entity_redirects WHERE source_id = $1);
+
+-- name: GetMergedEntityByHandle :one
+SELECT id, kind, handle, meta, created_at, sandbox, deactivated_at
+FROM entities
+WHERE id = (
+    SELECT target_id FROM entity_redirects
+    WHERE source_handle = $1
+    ORDER BY merged_at DESC LIMIT 1
+);
+
+-- name: MergeEntityRequests :execrows
+UPDATE requests SET entity_id = $2, updated_at = NOW() WHERE entity_id = $1;
+
+-- name: MergeEntityClaims :execrows
+UPDATE requests SET claimed_by = $2::text WHERE claimed_by = $1::text;
+
+-- name: MergeEntityResponses :execrows
+UPDATE responses SET answered_by = $2 WHERE answered_by = $1;
+
+-- name: MergeEntityComments :execrows
+UPDATE request_comments SET author = $2::text
+WHERE author = $1::text AND author_role = 'entity';
+
+-- name: MergeEntityFlows :execrows
+UPDATE flows SET owner_entity = $2, updated_at = NOW() WHERE owner_entity = $1;
+
+-- name: MergeEntityBundles :execrows
+UPDATE request_bundles SET entity_id = $2 WHERE entity_id = $1;
+
+-- name: MergeEntityShareLinks :execrows
+UPDATE share_links SET used_by = $2 WHERE used_by = $1;
+
+-- name: MergeEntityReminders :execrows
+UPDATE reminders SET entity_id = $2 WHERE entity_id = $1;
+
+-- name: MergeEntityIdentities :execrows
+UPDATE entity_identities SET entity_id = $2 WHERE entity_id = $1;
+
+-- name: MergeEntitySavedViews :execrows
+UPDATE saved_views SET entity_id = $2, updated_at = NOW()
+WHERE entity_id = $1
+  AND name NOT IN (SELECT name FROM saved_views WHERE entity_id = $2);
+
+-- name: MergeEntityPreferences :execrows
+UPDATE notification_preferences SET entity_id = $2, updated_at = NOW()
+WHERE entity_id = $1
+  AND NOT EXISTS (SELECT 1 FROM notification_preferences WHERE entity_id = $2);
+
+-- name: MergeEntityRedirects :execrows
+UPDATE entity_redirects SET target_id = $2 WHERE target_id = $1;
+
+-- name: MergeEntityMeta :exec
+UPDATE entities t SET meta = s.meta || t.meta
+FROM entities s
+WHERE t.id = $2 AND s.id = $1;
+
+-- name: CreateEntityRedirect :exec
+INSERT INTO entity_redirects (source_id, source_handle, target_id, merged_by)
+SELECT id, handle, $2::uuid, $3::text FROM entities WHERE id = $1;
+
+-- name: DeleteMergedEntity :execrows
+DELETE FROM entities WHERE id = $1;
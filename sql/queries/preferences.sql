@@ -0,0 +1,12 @@
+-- name: GetNotificationPreferences :one
+SELECT channels, quiet_start, quiet_end, timezone, digest, digest_at, updated_at
+FROM notification_preferences
+WHERE entity_id = $1;
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (entity_id, channels, quiet_start, quiet_end, timezone, digest, digest_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (entity_id) DO UPDATE
+SET channels = EXCLUDED.channels, quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+    timezone = EXCLUDED.timezone, digest = EXCLUDED.digest, digest_at = EXCLUDED.digest_at, updated_at = NOW()
+RETURNING channels, quiet_start, quiet_end, timezone, digest, digest_at, updated_at;
@@ -0,0 +1,8 @@
+-- name: GetQuotaUsage :one
+SELECT
+  (SELECT COUNT(*) FROM requests
+   WHERE created_by = $1 AND status IN ('PENDING', 'CLAIMED') AND deleted_at IS NULL),
+  (SELECT COUNT(*) FROM requests
+   WHERE entity_id = $2 AND status IN ('PENDING', 'CLAIMED') AND deleted_at IS NULL),
+  (SELECT COUNT(*) FROM requests
+   WHERE created_by = $1 AND created_at >= $3);
@@ -0,0 +1,17 @@
+-- name: ListPrefills :many
+SELECT id, prefill FROM requests
+WHERE id > $1 AND prefill IS NOT NULL
+ORDER BY id
+LIMIT $2;
+
+-- name: ListResponsePayloads :many
+SELECT id, payload FROM responses
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdatePrefill :exec
+UPDATE requests SET prefill = $2 WHERE id = $1;
+
+-- name: UpdateResponsePayload :exec
+UPDATE responses SET payload = $2 WHERE id = $1;
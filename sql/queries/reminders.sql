@@ -1,16 +1,39 @@
 -- name: CreateReminder :one
 INSERT INTO reminders (request_id, entity_id, remind_at)
 VALUES ($1, $2, $3)
-RETURNING id, request_id, entity_id, remind_at, created_at;
+RETURNING id, request_id, entity_id, remind_at, task_id, delivered_at, created_at;
+
+-- name: GetReminderByID :one
+SELECT id, request_id, entity_id, remind_at, task_id, delivered_at, created_at
+FROM reminders
+WHERE id = $1;
 
 -- name: GetRemindersByEntity :many
-SELECT id, request_id, entity_id, remind_at, created_at
+SELECT id, request_id, entity_id, remind_at, task_id, delivered_at, created_at
 FROM reminders
 WHERE entity_id = $1
-  AND remind_at > NOW()
+  AND delivered_at IS NULL
 ORDER BY remind_at ASC;
 
--- name: DeleteReminder :exec
+-- name: DeletePendingReminders :many
 DELETE FROM reminders
-WHERE id = $1;
+WHERE request_id = $1 AND entity_id = $2 AND delivered_at IS NULL
+RETURNING id, request_id, entity_id, remind_at, task_id, delivered_at, created_at;
+
+-- name: SetReminderTask :exec
+UPDATE reminders SET task_id = $2 WHERE id = $1;
+
+-- name: ListReminders :many
+SELECT id, request_id, entity_id, remind_at, task_id, delivered_at, created_at
+FROM reminders
+WHERE request_id = $1 AND entity_id = $2
+ORDER BY remind_at, id;
+
+-- name: DeleteReminder :one
+DELETE FROM reminders
+WHERE id = $1 AND delivered_at IS NULL
+RETURNING id, request_id, entity_id, remind_at, task_id, delivered_at, created_at;
 
+-- name: MarkReminderDelivered :execrows
+UPDATE reminders SET delivered_at = NOW()
+WHERE id = $1 AND delivered_at IS NULL;
@@ -0,0 +1,10 @@
+-- name: CreateRequestFiles :exec
+INSERT INTO request_files (request_id, position, file)
+SELECT $1, t.position, t.file
+FROM jsonb_array_elements($2::jsonb) WITH ORDINALITY AS t(file, position);
+
+-- name: AttachFilesToRequest :exec
+UPDATE files SET attached_request_id = $1, expires_at = NULL WHERE object_key = ANY($2);
+
+-- name: ListRequestFiles :many
+SELECT file FROM request_files WHERE request_id = $1 ORDER BY position;
@@ -2,42 +2,81 @@
 INSERT INTO requests (
     id, created_by, entity_id, status, schema_kind, schema_payload,
     ui_hints, prefill, expires_at, deadline_at, attention_at,
-    autocancel_grace, callback_url, callback_secret, files_policy, flow_id
+    autocancel_grace, callback_url, callback_secret, files_policy, flow_id,
+    callback_fields, sandbox, tags, locale, timezone
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, COALESCE($19::text[], '{}'), $20, $21
 )
 RETURNING id, created_by, entity_id, status, schema_kind, schema_payload,
           ui_hints, prefill, expires_at, deadline_at, attention_at,
           autocancel_grace, callback_url, callback_secret, files_policy,
-          flow_id, deleted_at, read_at, created_at, updated_at;
+          flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone;
+
+-- CreateRequests (batch insert) repeats the VALUES tuple of CreateRequest
+-- once per request in a single statement; see internal/db/queries.go.
 
 -- name: GetRequestByID :one
 SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
        ui_hints, prefill, expires_at, deadline_at, attention_at,
        autocancel_grace, callback_url, callback_secret, files_policy,
-       flow_id, deleted_at, read_at, created_at, updated_at
+       flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone
 FROM requests
 WHERE id = $1;
 
--- name: UpdateRequestStatus :exec
+-- name: UpdateRequestStatus :execrows
 UPDATE requests
-SET status = $2, updated_at = NOW()
-WHERE id = $1;
+SET status = $2, version = version + 1, updated_at = NOW()
+WHERE id = $1
+  AND status = ANY($3::text[])
+  AND ($4::int IS NULL OR version = $4);
+
+-- name: ClaimRequest :execrows
+UPDATE requests
+SET status = 'CLAIMED', claimed_by = $2, claimed_at = NOW(), claim_expires_at = $3,
+    version = version + 1, updated_at = NOW()
+WHERE id = $1
+  AND status = ANY($4::text[])
+  AND ($5::int IS NULL OR version = $5)
+  AND (expires_at IS NULL OR expires_at > NOW());
 
--- name: ClaimRequest :exec
+-- name: UnclaimRequest :execrows
 UPDATE requests
-SET status = 'CLAIMED', updated_at = NOW()
-WHERE id = $1 AND status = 'PENDING';
+SET status = 'PENDING', claimed_by = NULL, claimed_at = NULL, claim_expires_at = NULL,
+    version = version + 1, updated_at = NOW()
+WHERE id = $1
+  AND status = ANY($2::text[])
+  AND ($3::int IS NULL OR version = $3)
+  AND (NOT $4::boolean OR claim_expires_at <= NOW());
+
+-- name: AnswerRequest :one
+WITH answered AS (
+    UPDATE requests
+    SET status = 'ANSWERED', version = version + 1, updated_at = NOW()
+    WHERE id = $2
+      AND status = ANY($6::text[])
+      AND ($7::int IS NULL OR version = $7)
+      AND (expires_at IS NULL OR expires_at > NOW())
+    RETURNING id
+)
+INSERT INTO responses (id, request_id, answered_by, payload, files)
+SELECT $1, answered.id, $3, $4, $5 FROM answered
+RETURNING id, request_id, answered_at, answered_by, payload, files, signature_jws;
 
 -- name: GetEntityQueue :many
 SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
        ui_hints, prefill, expires_at, deadline_at, attention_at,
        autocancel_grace, callback_url, callback_secret, files_policy,
-       flow_id, deleted_at, read_at, created_at, updated_at
+       flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone
 FROM requests
 WHERE entity_id = $1
   AND ($2::text IS NULL OR status = $2)
   AND deleted_at IS NULL
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND ($3::boolean OR snoozed_until IS NULL OR snoozed_until <= NOW())
 ORDER BY created_at DESC
-LIMIT $3 OFFSET $4;
+LIMIT $4 OFFSET $5;
 
+-- name: MarkRequestDelivered :one
+UPDATE requests SET delivered_at = NOW()
+WHERE id = $1 AND entity_id = $2 AND delivered_at IS NULL
+RETURNING delivered_at;
@@ -0,0 +1,15 @@
+-- name: ListExpiredSandboxRequests :many
+SELECT r.id, r.entity_id, r.created_by,
+       COALESCE((
+           SELECT jsonb_agg(f)
+           FROM responses resp, jsonb_array_elements(resp.files) f
+           WHERE resp.request_id = r.id
+       ), '[]'::jsonb),
+       COALESCE((SELECT array_agg(object_key) FROM files WHERE request_id = r.id), '{}')
+FROM requests r
+WHERE r.sandbox AND r.created_at < $1
+ORDER BY r.created_at ASC
+LIMIT $2;
+
+-- name: DeleteSandboxRequests :execrows
+DELETE FROM requests WHERE id = ANY($1) AND sandbox;
@@ -0,0 +1,20 @@
+-- name: SearchRequests :many
+SELECT id, created_by, entity_id, status, schema_kind, schema_payload,
+       ui_hints, prefill, expires_at, deadline_at, attention_at,
+       autocancel_grace, callback_url, callback_secret, files_policy,
+       flow_id, deleted_at, read_at, delivered_at, created_at, updated_at, version, callback_fields, sandbox, tags, snoozed_until, claimed_by, claimed_at, claim_expires_at, locale, timezone
+FROM requests
+WHERE ($1::uuid IS NULL OR entity_id = $1)
+  AND ($2::text IS NULL OR status = $2)
+  AND ($3::text IS NULL OR created_by = $3)
+  AND tags @> COALESCE($4::text[], '{}')
+  AND (COALESCE(cardinality($5::text[]), 0) = 0 OR tags && $5)
+  AND ($6::timestamptz IS NULL OR created_at >= $6)
+  AND ($7::timestamptz IS NULL OR created_at < $7)
+  AND ($8::boolean OR deleted_at IS NULL)
+  AND (NOT $9::boolean OR snoozed_until IS NULL OR snoozed_until <= NOW())
+  AND (NOT $10::boolean OR expires_at IS NULL OR expires_at > NOW())
+ORDER BY
+  CASE WHEN $11::text = 'deadline' THEN deadline_at END ASC NULLS LAST,
+  created_at DESC
+LIMIT $12 OFFSET $13;
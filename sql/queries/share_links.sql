@@ -0,0 +1,20 @@
+-- name: CreateShareLink :one
+INSERT INTO share_links (id, token_hash, request_id, created_by, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, token_hash, request_id, created_by, created_at, expires_at, used_at, used_by;
+
+-- name: GetShareLinkByToken :one
+SELECT id, token_hash, request_id, created_by, created_at, expires_at, used_at, used_by
+FROM share_links
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: UseShareLink :one
+UPDATE share_links SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING id, token_hash, request_id, created_by, created_at, expires_at, used_at, used_by;
+
+-- name: ReleaseShareLink :exec
+UPDATE share_links SET used_at = NULL, used_by = NULL WHERE id = $1;
+
+-- name: SetShareLinkAnswerer :exec
+UPDATE share_links SET used_by = $2 WHERE id = $1;
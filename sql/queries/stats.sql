@@ -0,0 +1,33 @@
+-- name: ListRequestCounts :many
+SELECT (created_at AT TIME ZONE 'UTC')::date, entity_id, status, schema_kind, COUNT(*), NULL::timestamptz
+FROM requests
+WHERE deleted_at IS NULL AND NOT sandbox
+  AND created_at >= $1::date AT TIME ZONE 'UTC' AND created_at < ($2::date + 1) AT TIME ZONE 'UTC'
+  AND ($3::uuid IS NULL OR entity_id = $3)
+GROUP BY 1, 2, 3, 4;
+
+-- name: ListRequestCountsMaterialized :many
+SELECT day, entity_id, status, schema_kind, count, refreshed_at
+FROM request_stats_daily
+WHERE day >= $1::date AND day <= $2::date AND ($3::uuid IS NULL OR entity_id = $3);
+
+-- name: ListFlowCounts :many
+SELECT (created_at AT TIME ZONE 'UTC')::date, kind, status, COUNT(*),
+       COALESCE(SUM(EXTRACT(EPOCH FROM updated_at - created_at)) FILTER (WHERE status = 'COMPLETED'), 0)::float8,
+       NULL::timestamptz
+FROM flows
+WHERE created_at >= $1::date AT TIME ZONE 'UTC' AND created_at < ($2::date + 1) AT TIME ZONE 'UTC'
+  AND ($3::uuid IS NULL OR owner_entity = $3)
+GROUP BY 1, 2, 3;
+
+-- name: ListFlowCountsMaterialized :many
+SELECT day, kind, status, SUM(count)::bigint, SUM(completed_seconds)::float8, MAX(refreshed_at)
+FROM flow_stats_daily
+WHERE day >= $1::date AND day <= $2::date AND ($3::uuid IS NULL OR owner_entity = $3)
+GROUP BY 1, 2, 3;
+
+-- name: RefreshRequestStats :exec
+REFRESH MATERIALIZED VIEW CONCURRENTLY request_stats_daily;
+
+-- name: RefreshFlowStats :exec
+REFRESH MATERIALIZED VIEW CONCURRENTLY flow_stats_daily;
@@ -0,0 +1,42 @@
+-- name: AppendStreamEvent :one
+WITH next AS (
+  INSERT INTO stream_sequences (channel, seq) VALUES ($1, 1)
+  ON CONFLICT (channel) DO UPDATE SET seq = stream_sequences.seq + 1
+  RETURNING seq
+)
+INSERT INTO stream_events (channel, seq, event)
+SELECT $1, seq, $2 FROM next
+RETURNING seq;
+
+-- name: TrimStreamEvents :exec
+DELETE FROM stream_events
+WHERE channel = $1
+  AND (($2::bigint > 0 AND seq <= $3::bigint - $2::bigint)
+    OR ($4::bigint > 0 AND created_at < NOW() - make_interval(secs => $4::bigint / 1000.0)));
+
+-- name: GetStreamEvent :one
+SELECT event, created_at FROM stream_events WHERE channel = $1 AND seq = $2;
+
+-- name: ListStreamEvents :many
+SELECT seq, event, created_at FROM stream_events
+WHERE channel = $1 AND seq > $2
+ORDER BY seq
+LIMIT $3;
+
+-- name: DeleteStreamEvents :execrows
+DELETE FROM stream_events
+WHERE channel = $1 AND ($2::bigint[] IS NULL OR seq = ANY($2));
+
+-- name: DeleteExpiredStreamEvents :execrows
+DELETE FROM stream_events
+WHERE (split_part(channel, ':', 1) = ANY($1::text[])) <> $2 AND created_at < $3;
+
+-- name: GetStreamAck :one
+SELECT seq FROM stream_acks WHERE channel = $1 AND connection_id = $2;
+
+-- name: SetStreamAck :exec
+INSERT INTO stream_acks (channel, connection_id, seq) VALUES ($1, $2, $3)
+ON CONFLICT (channel, connection_id) DO UPDATE SET seq = EXCLUDED.seq, updated_at = NOW();
+
+-- name: NotifyEvent :exec
+SELECT pg_notify($1, $2);
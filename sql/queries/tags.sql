@@ -0,0 +1,16 @@
+-- name: SetRequestTags :one
+UPDATE requests
+SET tags = COALESCE($2::text[], '{}'), version = version + 1, updated_at = NOW()
+WHERE id = $1
+  AND ($3::int IS NULL OR version = $3)
+RETURNING version;
+
+-- name: GetEntityTagSummary :many
+SELECT t.tag,
+       COUNT(*),
+       COUNT(*) FILTER (WHERE r.status IN ('PENDING', 'CLAIMED')),
+       COUNT(*) FILTER (WHERE r.status IN ('PENDING', 'CLAIMED') AND r.read_at IS NULL)
+FROM requests r, unnest(r.tags) AS t(tag)
+WHERE r.entity_id = $1 AND r.deleted_at IS NULL
+GROUP BY t.tag
+ORDER BY t.tag;
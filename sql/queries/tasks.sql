@@ -0,0 +1,22 @@
+-- name: SaveRequestTask :exec
+INSERT INTO request_tasks (request_id, kind, task_id, process_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (request_id, kind)
+DO UPDATE SET task_id = EXCLUDED.task_id, process_at = EXCLUDED.process_at, created_at = NOW();
+
+-- name: ListRequestTasks :many
+SELECT request_id, kind, task_id, process_at
+FROM request_tasks
+WHERE request_id = $1
+ORDER BY kind;
+
+-- name: DeleteRequestTask :exec
+DELETE FROM request_tasks
+WHERE request_id = $1 AND kind = $2;
+
+-- name: UpdateRequestDeadline :one
+UPDATE requests
+SET deadline_at = $2, version = version + 1, updated_at = NOW()
+WHERE id = $1 AND status IN ('PENDING', 'CLAIMED')
+  AND ($3::int IS NULL OR version = $3)
+RETURNING version;
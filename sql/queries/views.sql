@@ -0,0 +1,24 @@
+-- name: CreateSavedView :one
+INSERT INTO saved_views (id, entity_id, name, filter)
+VALUES ($1, $2, $3, $4)
+RETURNING id, entity_id, name, filter, created_at, updated_at;
+
+-- name: GetSavedView :one
+SELECT id, entity_id, name, filter, created_at, updated_at
+FROM saved_views
+WHERE id = $1;
+
+-- name: ListSavedViews :many
+SELECT id, entity_id, name, filter, created_at, updated_at
+FROM saved_views
+WHERE entity_id = $1
+ORDER BY name;
+
+-- name: UpdateSavedView :one
+UPDATE saved_views
+SET name = $3, filter = $4, updated_at = NOW()
+WHERE id = $1 AND entity_id = $2
+RETURNING id, entity_id, name, filter, created_at, updated_at;
+
+-- name: DeleteSavedView :execrows
+DELETE FROM saved_views WHERE id = $1 AND entity_id = $2;
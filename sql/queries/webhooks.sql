@@ -0,0 +1,62 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, channel, url, event_types, secret, created_by)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, channel, url, event_types, secret, previous_secret, previous_secret_expires_at,
+  active, created_by, created_at, updated_at;
+
+-- name: GetWebhook :one
+SELECT id, channel, url, event_types, secret, previous_secret, previous_secret_expires_at,
+  active, created_by, created_at, updated_at
+FROM webhooks WHERE id = $1;
+
+-- name: ListWebhooks :many
+SELECT id, channel, url, event_types, secret, previous_secret, previous_secret_expires_at,
+  active, created_by, created_at, updated_at
+FROM webhooks
+WHERE channel = $1 AND (active OR NOT $2::boolean)
+ORDER BY created_at, id;
+
+-- name: UpdateWebhook :one
+UPDATE webhooks
+SET url = COALESCE($2, url),
+    event_types = COALESCE($3, event_types),
+    active = COALESCE($4, active),
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, channel, url, event_types, secret, previous_secret, previous_secret_expires_at,
+  active, created_by, created_at, updated_at;
+
+-- name: RotateWebhookSecret :one
+UPDATE webhooks
+SET previous_secret = secret, previous_secret_expires_at = $3, secret = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, channel, url, event_types, secret, previous_secret, previous_secret_expires_at,
+  active, created_by, created_at, updated_at;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE id = $1;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, webhook_id, event_type, event)
+VALUES ($1, $2, $3, $4)
+RETURNING id, webhook_id, event_type, event, status, attempts, response_status, error,
+  created_at, last_attempt_at, delivered_at;
+
+-- name: GetWebhookDelivery :one
+SELECT id, webhook_id, event_type, event, status, attempts, response_status, error,
+  created_at, last_attempt_at, delivered_at
+FROM webhook_deliveries WHERE id = $1;
+
+-- name: ListWebhookDeliveries :many
+SELECT id, webhook_id, event_type, event, status, attempts, response_status, error,
+  created_at, last_attempt_at, delivered_at
+FROM webhook_deliveries
+WHERE webhook_id = $1 AND ($2::text IS NULL OR status = $2)
+ORDER BY created_at DESC, id DESC
+LIMIT $3 OFFSET $4;
+
+-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries
+SET status = $2, response_status = $3, error = $4, attempts = attempts + 1, last_attempt_at = NOW(),
+    delivered_at = CASE WHEN $2 = 'DELIVERED' THEN NOW() ELSE delivered_at END
+WHERE id = $1;
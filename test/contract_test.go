@@ -0,0 +1,122 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	pxtest "pxbox/internal/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAPIContract pins the status and body of the main endpoints with
+// golden files in testdata/golden/api. IDs and timestamps are normalized;
+// run with -update after an intended change to a payload.
+func TestAPIContract(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	server, _, cleanup := setupTestServerWithServices(t)
+	defer cleanup()
+
+	testDB, err := SetupTestDB()
+	require.NoError(t, err)
+	defer testDB.Close()
+
+	if err := RunMigrations(testDB); err != nil {
+		t.Logf("Migration error (may be OK if already migrated): %v", err)
+	}
+
+	// call sends a request and compares the response with the golden file
+	call := func(name, method, path, caller string, body interface{}) map[string]interface{} {
+		t.Helper()
+		var reader io.Reader = http.NoBody
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Client-ID", "test-client")
+		if caller != "" {
+			req.Header.Set("X-Entity-ID", caller)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var out interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		t.Run(name, func(t *testing.T) {
+			pxtest.Golden(t, "api/"+name, map[string]interface{}{"status": resp.StatusCode, "body": out})
+		})
+		result, _ := out.(map[string]interface{})
+		return result
+	}
+
+	entity := call("createEntity", "POST", "/v1/entities", "", map[string]interface{}{
+		"kind": "user",
+		"meta": map[string]interface{}{"name": "Ada"},
+	})
+	entityID, _ := entity["id"].(string)
+	require.NotEmpty(t, entityID)
+
+	call("getEntity", "GET", "/v1/entities/"+entityID, entityID, nil)
+	call("updateEntity", "PATCH", "/v1/entities/"+entityID, entityID, map[string]interface{}{
+		"meta": map[string]interface{}{"name": "Ada Lovelace"},
+	})
+	call("createEntityInvalidKind", "POST", "/v1/entities", "", map[string]interface{}{"kind": "robot"})
+
+	created := call("createRequest", "POST", "/v1/requests", "", map[string]interface{}{
+		"entity": map[string]interface{}{"id": entityID},
+		"schema": map[string]interface{}{
+			"type":       "object",
+			"required":   []string{"name"},
+			"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+		},
+		"tags": []string{"onboarding"},
+	})
+	requestID, _ := created["requestId"].(string)
+	require.NotEmpty(t, requestID)
+
+	call("getRequest", "GET", "/v1/requests/"+requestID, "", nil)
+	call("getRequestNotFound", "GET", "/v1/requests/00000000-0000-0000-0000-000000000000", "", nil)
+	call("listInquiries", "GET", "/v1/inquiries", entityID, nil)
+	call("entityQueue", "GET", "/v1/entities/"+entityID+"/queue", entityID, nil)
+	call("entityTags", "GET", "/v1/entities/"+entityID+"/tags", entityID, nil)
+	call("markRead", "POST", "/v1/inquiries/"+requestID+"/markRead", entityID, nil)
+	call("claimRequest", "POST", "/v1/requests/"+requestID+"/claim", entityID, nil)
+	call("unclaimRequest", "POST", "/v1/requests/"+requestID+"/unclaim", entityID, nil)
+	call("validateResponse", "POST", "/v1/requests/"+requestID+"/validate", entityID, map[string]interface{}{
+		"payload": map[string]interface{}{"name": 42},
+	})
+	call("postResponseInvalid", "POST", "/v1/requests/"+requestID+"/response", entityID, map[string]interface{}{
+		"payload": map[string]interface{}{"name": 42},
+	})
+	call("postResponse", "POST", "/v1/requests/"+requestID+"/response", entityID, map[string]interface{}{
+		"payload": map[string]interface{}{"name": "Ada"},
+	})
+	call("getResponse", "GET", "/v1/requests/"+requestID+"/response", "", nil)
+
+	views := "/v1/entities/" + entityID + "/views"
+	view := call("createView", "POST", views, entityID, map[string]interface{}{
+		"name":   "Onboarding",
+		"filter": map[string]interface{}{"tags": []string{"onboarding"}},
+	})
+	call("listViews", "GET", views, entityID, nil)
+	if viewID, _ := view["id"].(string); viewID != "" {
+		call("deleteView", "DELETE", views+"/"+viewID, entityID, nil)
+	}
+
+	other := call("createRequestToCancel", "POST", "/v1/requests", "", map[string]interface{}{
+		"entity": map[string]interface{}{"id": entityID},
+		"schema": map[string]interface{}{"type": "object"},
+	})
+	if otherID, _ := other["requestId"].(string); otherID != "" {
+		call("cancelRequest", "POST", "/v1/requests/"+otherID+"/cancel", "", nil)
+	}
+}
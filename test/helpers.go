@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"time"
 
+	"pxbox/internal/db"
+
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
@@ -34,29 +36,15 @@ func SetupTestDB() (*sql.DB, error) {
 	return db, nil
 }
 
-// RunMigrations runs migrations on test database
-func RunMigrations(db *sql.DB) error {
-	migrationsDir := "../migrations"
-	if _, err := os.Stat(migrationsDir); os.IsNotExist(err) {
-		migrationsDir = "./migrations"
-	}
-
-	// Simple migration runner for tests
-	migrationSQL, err := os.ReadFile(migrationsDir + "/0001_init.sql")
-	if err != nil {
-		return fmt.Errorf("failed to read migration: %w", err)
-	}
-
-	if _, err := db.Exec(string(migrationSQL)); err != nil {
-		return fmt.Errorf("failed to run migration: %w", err)
-	}
-
-	return nil
+// RunMigrations applies the pending migrations to the test database
+func RunMigrations(sqlDB *sql.DB) error {
+	_, err := db.Migrate(context.Background(), sqlDB)
+	return err
 }
 
 // CleanupTestDB cleans up test database
 func CleanupTestDB(db *sql.DB) error {
-	tables := []string{"reminders", "responses", "requests", "flows", "entities", "schema_migrations"}
+	tables := []string{"audit_log", "reminders", "files", "responses", "requests", "flows", "entities"}
 	for _, table := range tables {
 		if _, err := db.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", table)); err != nil {
 			// Ignore errors if table doesn't exist